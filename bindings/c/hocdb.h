@@ -13,8 +13,44 @@ extern "C" {
 #define HOCDB_TYPE_I64 1
 #define HOCDB_TYPE_F64 2
 #define HOCDB_TYPE_U64 3
+#define HOCDB_TYPE_U8 4
 #define HOCDB_TYPE_STRING 5
 #define HOCDB_TYPE_BOOL 6
+#define HOCDB_TYPE_I32 7
+#define HOCDB_TYPE_U32 8
+#define HOCDB_TYPE_F32 9
+#define HOCDB_TYPE_I16 10
+
+#define HOCDB_TYPE_BYTES 11 // 2-byte little-endian length, then up to 256 bytes
+#define HOCDB_TYPE_DECIMAL 12 // int64 counting units of 10^-scale, scale 0 unless given
+
+// String field of w bytes (1 to 128) instead of HOCDB_TYPE_STRING's 128
+#define HOCDB_TYPE_STRING_N(w) (((w) << 8) | HOCDB_TYPE_STRING)
+// Bytes field holding up to n bytes (1 to 65535) instead of HOCDB_TYPE_BYTES's 256
+#define HOCDB_TYPE_BYTES_N(n) (((n) << 8) | HOCDB_TYPE_BYTES)
+// Decimal field with scale digits (0 to 18) after the decimal point
+#define HOCDB_TYPE_DECIMAL_N(scale) (((scale) << 8) | HOCDB_TYPE_DECIMAL)
+
+// Feature bits of hocdb_features
+#define HOCDB_FEATURE_AUTO_INCREMENT (1u << 0) // hocdb_set_auto_increment
+#define HOCDB_FEATURE_NARROW_TYPES (1u << 1) // HOCDB_TYPE_I32, U32, F32 and I16
+#define HOCDB_FEATURE_STRING_WIDTH (1u << 2) // HOCDB_TYPE_STRING_N
+#define HOCDB_FEATURE_BYTES (1u << 3) // HOCDB_TYPE_BYTES and HOCDB_TYPE_BYTES_N
+#define HOCDB_FEATURE_DECIMAL (1u << 4) // HOCDB_TYPE_DECIMAL and HOCDB_TYPE_DECIMAL_N
+#define HOCDB_FEATURE_COMPRESSION (1u << 5) // Compression of the data file by the engine
+#define HOCDB_FEATURE_DELETE (1u << 6) // Deleting records
+
+/**
+ * Get the version of the library
+ * @return Semantic version as a null-terminated string, e.g. "0.1.0"
+ */
+const char* hocdb_version(void);
+
+/**
+ * Get the features the library supports
+ * @return Bitmask of HOCDB_FEATURE_* constants
+ */
+uint64_t hocdb_features(void);
 
 // Structure for schema field definition
 typedef struct {
@@ -39,6 +75,17 @@ typedef void* HOCDBHandle;
  */
 HOCDBHandle hocdb_init(const char* ticker, const char* path, const CField* schema, size_t schema_len, int64_t max_file_size, int overwrite_on_full, int flush_on_write, int auto_increment);
 
+/**
+ * Set where auto-increment continues: after the last record, or at start when
+ * that is later or the database is empty. Databases opened with auto_increment
+ * start at 1 with a step of 1 until this is called.
+ * @param handle Database handle
+ * @param start First timestamp of an empty database
+ * @param step Distance between assigned timestamps, must be positive
+ * @return 0 on success, -1 without auto_increment or for a step below 1
+ */
+int hocdb_set_auto_increment(HOCDBHandle handle, int64_t start, int64_t step);
+
 /**
  * Append a raw record to the database
  * @param handle Database handle
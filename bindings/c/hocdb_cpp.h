@@ -63,6 +63,11 @@ public:
                 case HOCDB_TYPE_F64: record_size_ += 8; break;
                 case HOCDB_TYPE_U64: record_size_ += 8; break;
                 case HOCDB_TYPE_BOOL: record_size_ += 1; break;
+                case HOCDB_TYPE_U8: record_size_ += 1; break;
+                case HOCDB_TYPE_I16: record_size_ += 2; break;
+                case HOCDB_TYPE_I32: record_size_ += 4; break;
+                case HOCDB_TYPE_U32: record_size_ += 4; break;
+                case HOCDB_TYPE_F32: record_size_ += 4; break;
                 default: throw Exception("Unsupported field type");
             }
         }
@@ -0,0 +1,317 @@
+package hocdb
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// archiveExt is the extension of the archives of ArchivePartition, tar files
+// holding the schema metadata and the segments of a partition
+const archiveExt = ".tar"
+
+// ArchivePartition writes the finished partition holding t to a self-contained
+// archive in dir and detaches it from the database like DropPartition, returning
+// the path of the archive. The archive is a tar file named after the ticker and
+// the partition, such as BTC_USD.2024-01-15.tar, holding the schema metadata and
+// the compressed segments of the partition, fetched back from cold storage if need
+// be. AttachArchive adds it back, to this database or another one of the same
+// schema.
+func (db *DB) ArchivePartition(t time.Time, dir string) (string, error) {
+	if db.readOnly {
+		return "", ErrReadOnly
+	}
+	p := db.options.PartitionBy
+	if p == PartitionNone {
+		return "", errors.New("database was opened without PartitionBy")
+	}
+	start := p.Start(t, db.options.PartitionLocation)
+	layout := "2006-01-02"
+	if p == PartitionMonth {
+		layout = "2006-01"
+	}
+	path := filepath.Join(dir, db.ticker+"."+start.Format(layout)+archiveExt)
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("failed to archive partition: %s already exists", path)
+	}
+
+	// Pinned, the segments stay where they are while they are copied
+	db.mu.Lock()
+	if db.handle == nil {
+		db.mu.Unlock()
+		return "", errors.New("database not initialized")
+	}
+	startTs, endTs := db.Timestamp(start), db.Timestamp(p.End(t, db.options.PartitionLocation))
+	var segments []segment
+	for _, s := range db.segments {
+		if s.first >= startTs && s.last < endTs {
+			segments = append(segments, s)
+		}
+	}
+	if db.segRefs == nil {
+		db.segRefs = make(map[int]int)
+	}
+	for _, s := range segments {
+		db.segRefs[s.seq]++
+	}
+	meta, err := os.ReadFile(db.metaFile())
+	db.mu.Unlock()
+	if len(segments) == 0 {
+		return "", fmt.Errorf("no finished partition holds %s", t.Format(time.RFC3339))
+	}
+	err = writeArchive(path, db.ticker, meta, segments, db.cold, err)
+	db.unpin(&snapshot{segments: segments})
+	if err != nil {
+		return "", fmt.Errorf("failed to archive partition: %w", err)
+	}
+	return path, db.DropPartition(t)
+}
+
+// writeArchive writes the archive of segments at path atomically; err is that of
+// reading the metadata meta, reported first
+func writeArchive(path, ticker string, meta []byte, segments []segment, cold *coldCache, err error) error {
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	tw := tar.NewWriter(tmp)
+	header := &tar.Header{Name: ticker + metaFileExt, Mode: 0644, Size: int64(len(meta)), ModTime: time.Now()}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := tw.Write(meta); err != nil {
+		return err
+	}
+	for _, s := range segments {
+		f, err := openSegmentData(s, cold)
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{Name: filepath.Base(s.file), Mode: 0644, Size: s.dataOffset + s.size, ModTime: time.Now()}
+		if err = tw.WriteHeader(header); err == nil {
+			_, err = io.CopyN(tw, f, header.Size)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// AttachArchive adds the partition of an archive written by ArchivePartition back
+// to the database, whose schema must match the archive's. Its records must be
+// older than those of the data file and outside the time ranges of the other
+// segments. Each segment is verified against its checksum first.
+func (db *DB) AttachArchive(path string) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	if db.options.PartitionBy == PartitionNone {
+		return errors.New("database was opened without PartitionBy")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to attach archive: %w", err)
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	var meta *metadata
+	var attached []string
+	defer func() {
+		for _, tmp := range attached {
+			os.Remove(tmp) // Left over when attaching failed
+		}
+	}()
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to attach archive: %w", err)
+		}
+		name := header.Name
+		switch {
+		case header.Typeflag != tar.TypeReg || name != filepath.Base(name):
+			return fmt.Errorf("failed to attach archive: invalid entry %s", name)
+		case strings.HasSuffix(name, metaFileExt):
+			if meta, err = db.checkArchiveMeta(tr); err != nil {
+				return fmt.Errorf("failed to attach archive: %w", err)
+			}
+		case strings.HasSuffix(name, segmentExt):
+			if meta == nil {
+				return errors.New("failed to attach archive: segment before the schema metadata")
+			}
+			tmp, err := os.CreateTemp(db.path, "."+db.ticker+".attach*")
+			if err != nil {
+				return fmt.Errorf("failed to attach archive: %w", err)
+			}
+			attached = append(attached, tmp.Name())
+			_, err = io.CopyN(tmp, tr, header.Size)
+			if err == nil {
+				err = tmp.Sync()
+			}
+			if closeErr := tmp.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				err = db.attachSegment(tmp.Name(), archivedSeq(name))
+			}
+			if err != nil {
+				return fmt.Errorf("failed to attach archive: %w", err)
+			}
+			attached = attached[:len(attached)-1]
+		}
+	}
+	if meta == nil {
+		return errors.New("failed to attach archive: no schema metadata")
+	}
+	return nil
+}
+
+// checkArchiveMeta reads the metadata of an archive from r and checks that it
+// matches the database
+func (db *DB) checkArchiveMeta(r io.Reader) (*metadata, error) {
+	var meta metadata
+	if err := json.NewDecoder(r).Decode(&meta); err != nil {
+		return nil, fmt.Errorf("invalid schema metadata: %w", err)
+	}
+	schema, err := meta.schema()
+	if err != nil {
+		return nil, err
+	}
+	if diffs := schemaDiff(schema, db.Schema()); len(diffs) > 0 {
+		return nil, &SchemaMismatchError{Ticker: db.ticker, Stored: schema, Given: db.Schema(), Diffs: diffs}
+	}
+	precision, err := parsePrecision(meta.Precision)
+	if err != nil {
+		return nil, err
+	}
+	if precision == 0 {
+		precision = time.Nanosecond
+	}
+	if precision != db.TimestampPrecision() {
+		return nil, fmt.Errorf("archive has timestamps in %v, the database in %v", precision, db.TimestampPrecision())
+	}
+	return &meta, nil
+}
+
+// archivedSeq returns the sequence number in the name of a segment file, or 0
+func archivedSeq(name string) int {
+	name = strings.TrimSuffix(name, segmentExt)
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		if seq, err := strconv.Atoi(name[i+1:]); err == nil && seq > 0 {
+			return seq
+		}
+	}
+	return 0
+}
+
+// attachSegment verifies the segment file tmp and renames it into place as a
+// segment of the database, under the sequence number seq it had when it fits
+// between its neighbors
+func (db *DB) attachSegment(tmp string, seq int) error {
+	s, err := readSegmentHeader(tmp)
+	if err != nil {
+		return err
+	}
+	if s.key != "" || s.data != "" {
+		return errors.New("archive holds a segment stub")
+	}
+	records, err := decodeSegment(s, db.schema, nil)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.handle == nil {
+		return errors.New("database not initialized")
+	}
+	if err := db.flush(); err != nil {
+		return err
+	}
+	overlap := fmt.Errorf("records from %d to %d overlap the database", s.first, s.last)
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		return err
+	}
+	v, err := db.dataView(f)
+	if err == nil && v.count > 0 {
+		var first int64
+		if first, err = v.timestampAt(0); err == nil && first <= s.last {
+			err = overlap
+		}
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+	i := sort.Search(len(db.segments), func(i int) bool { return db.segments[i].first > s.first })
+	if (i > 0 && db.segments[i-1].last >= s.first) || (i < len(db.segments) && db.segments[i].first <= s.last) {
+		return overlap
+	}
+
+	// Segments are numbered in time order
+	lo, hi := 0, int(^uint(0)>>1)
+	if i > 0 {
+		lo = db.segments[i-1].seq
+	}
+	if i < len(db.segments) {
+		hi = db.segments[i].seq
+	}
+	if seq <= lo || seq >= hi {
+		if seq = lo + 1; seq >= hi {
+			return fmt.Errorf("no sequence number left between segments %d and %d", lo, hi)
+		}
+	}
+	s.seq = seq
+	s.file = segmentFile(db.path, db.ticker, seq)
+	if _, err := os.Stat(s.file); err == nil {
+		return fmt.Errorf("%s already exists", s.file)
+	}
+	if err := os.Rename(tmp, s.file); err != nil {
+		return err
+	}
+	db.segments = slices.Insert(db.segments, i, s)
+	db.segCache, db.segCacheFile = nil, ""
+	if db.zoneMap != nil {
+		db.segmentZone(s, records)
+	}
+	if c := db.segmentCompression(); c != nil && len(c.BloomFilters) > 0 {
+		if err := writeBlooms(s, records, db.schema, c.BloomFilters); err != nil {
+			db.logError("failed to write the bloom filters of an attached segment", err)
+		}
+	}
+	db.notifyReaders(true)
+	return syncFile(db.path)
+}
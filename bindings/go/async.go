@@ -0,0 +1,244 @@
+package hocdb
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAsyncBufferSize    = 65536
+	defaultAsyncBatchSize     = 1024
+	defaultAsyncFlushInterval = 100 * time.Millisecond
+)
+
+// ErrBufferFull is returned by AppendAsync when the background writer falls behind
+// and AsyncBufferSize records are already queued
+var ErrBufferFull = errors.New("async append buffer is full")
+
+// asyncItem is a queued record, or a request to write and flush everything queued
+// before it when done is set
+type asyncItem struct {
+	data []byte
+	done chan error
+}
+
+// asyncWriter appends queued records in batches on a background goroutine
+type asyncWriter struct {
+	db       *DB
+	ch       chan asyncItem
+	quit     chan struct{}
+	exited   chan struct{}
+	batch    int
+	interval time.Duration
+
+	errMu sync.Mutex
+	err   error // First failed append since the last Flush
+}
+
+// AppendAsync queues a raw record to be appended by a background writer, which
+// appends queued records in batches of AsyncBatchSize, or every AsyncFlushInterval,
+// and flushes after each batch. It returns ErrBufferFull instead of blocking when
+// AsyncBufferSize records are waiting.
+//
+// Flush waits until everything queued before it is written and returns the first
+// error of a background append since the previous Flush, if any. Close writes the
+// remaining records. Hooks and subscriptions see queued records once they are
+// appended; OnAppend callbacks then run on the background writer and must not call
+// Flush.
+func (db *DB) AppendAsync(data []byte) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	if len(data) != db.RecordSize() {
+		return errors.New("append failed: invalid record size")
+	}
+
+	if err := db.startAsync(); err != nil {
+		return err
+	}
+
+	// Holding the read lock keeps Close from stopping the writer before the record
+	// is queued
+	db.asyncMu.RLock()
+	defer db.asyncMu.RUnlock()
+	if db.async == nil {
+		return errors.New("database not initialized")
+	}
+
+	select {
+	case db.async.ch <- asyncItem{data: append([]byte(nil), data...)}:
+		return nil
+	default:
+		return ErrBufferFull
+	}
+}
+
+// startAsync starts the background writer unless it is running
+func (db *DB) startAsync() error {
+	db.asyncMu.RLock()
+	running := db.async != nil
+	db.asyncMu.RUnlock()
+	if running {
+		return nil
+	}
+
+	db.asyncMu.Lock()
+	defer db.asyncMu.Unlock()
+	if db.async != nil {
+		return nil
+	}
+	if db.asyncStopped || !db.isOpen() {
+		return errors.New("database not initialized")
+	}
+	db.async = newAsyncWriter(db)
+	return nil
+}
+
+func newAsyncWriter(db *DB) *asyncWriter {
+	size := db.options.AsyncBufferSize
+	if size <= 0 {
+		size = defaultAsyncBufferSize
+	}
+	batch := db.options.AsyncBatchSize
+	if batch <= 0 {
+		batch = defaultAsyncBatchSize
+	}
+	interval := db.options.AsyncFlushInterval
+	if interval <= 0 {
+		interval = defaultAsyncFlushInterval
+	}
+
+	w := &asyncWriter{
+		db:       db,
+		ch:       make(chan asyncItem, size),
+		quit:     make(chan struct{}),
+		exited:   make(chan struct{}),
+		batch:    batch,
+		interval: interval,
+	}
+	go w.run()
+	return w
+}
+
+// flushAsync waits for the background writer to write and flush everything queued
+// so far. It reports false when there is no background writer.
+func (db *DB) flushAsync() (bool, error) {
+	db.asyncMu.RLock()
+	w := db.async
+	if w == nil {
+		db.asyncMu.RUnlock()
+		return false, nil
+	}
+	done := make(chan error, 1)
+	w.ch <- asyncItem{done: done}
+	db.asyncMu.RUnlock()
+
+	return true, <-done
+}
+
+// stopAsync writes the queued records and stops the background writer for good
+func (db *DB) stopAsync() {
+	db.asyncMu.Lock()
+	w := db.async
+	db.async = nil
+	db.asyncStopped = true
+	db.asyncMu.Unlock()
+
+	if w != nil {
+		close(w.quit)
+		<-w.exited
+	}
+}
+
+func (w *asyncWriter) run() {
+	defer close(w.exited)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	var batch [][]byte
+	for {
+		select {
+		case item := <-w.ch:
+			if item.done != nil {
+				w.write(batch, true)
+				batch = nil
+				item.done <- w.takeErr()
+				continue
+			}
+			batch = append(batch, item.data)
+			if len(batch) >= w.batch {
+				w.write(batch, false)
+				batch = nil
+			}
+		case <-ticker.C:
+			w.write(batch, false)
+			batch = nil
+		case <-w.quit:
+			// No more items can be queued, write what's left
+			for {
+				select {
+				case item := <-w.ch:
+					if item.done != nil {
+						w.write(batch, true)
+						batch = nil
+						item.done <- w.takeErr()
+					} else {
+						batch = append(batch, item.data)
+					}
+				default:
+					w.write(batch, false)
+					return
+				}
+			}
+		}
+	}
+}
+
+// write appends a batch under one lock and flushes it. Empty batches are only
+// flushed when forced, for Flush.
+func (w *asyncWriter) write(batch [][]byte, force bool) {
+	if len(batch) == 0 && !force {
+		return
+	}
+	db := w.db
+
+	events := make([]appendEvent, 0, len(batch))
+	db.mu.Lock()
+	for _, data := range batch {
+		if err := db.append(data); err != nil {
+			db.logError("async append failed", err)
+			w.setErr(err)
+			continue
+		}
+		events = append(events, db.noteAppend(data))
+	}
+	err := db.sync()
+	db.mu.Unlock()
+
+	for _, ev := range events {
+		ev.run()
+	}
+	if err != nil {
+		w.setErr(err)
+		return
+	}
+	db.afterFlush()
+}
+
+func (w *asyncWriter) setErr(err error) {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *asyncWriter) takeErr() error {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	err := w.err
+	w.err = nil
+	return err
+}
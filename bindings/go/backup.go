@@ -0,0 +1,334 @@
+package hocdb
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// dataFileExt is the extension the core engine uses for ticker data files
+const dataFileExt = ".bin"
+
+// dataFile returns the path of the file backing this database
+func (db *DB) dataFile() string {
+	return filepath.Join(db.dataDir(), db.ticker+dataFileExt)
+}
+
+// Snapshot writes a consistent point-in-time copy of the database into destDir.
+//
+// Pending writes are flushed and only the bytes present at that moment are copied,
+// so the snapshot never contains a partially written record. Records are only ever
+// appended to the end of a linear database, which means appends may continue while
+// the copy is in progress. A database opened with OverwriteFull that has already
+// wrapped rewrites old records in place; pause writes while snapshotting it.
+//
+// The resulting directory can be opened directly with New or copied into place
+// with Restore.
+func (db *DB) Snapshot(destDir string) error {
+	if !db.isOpen() {
+		return errors.New("database not initialized")
+	}
+
+	src, name, size, err := db.openFlushed()
+	if err != nil {
+		return fmt.Errorf("snapshot failed: %w", err)
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("snapshot failed: %w", err)
+	}
+
+	dest := filepath.Join(destDir, name)
+	destMeta := filepath.Join(destDir, db.ticker+metaFileExt)
+	for _, target := range []string{dest, destMeta} {
+		if _, err := os.Stat(target); err == nil {
+			return fmt.Errorf("snapshot failed: %s already exists", target)
+		}
+	}
+
+	// The metadata and segments go first, so a snapshot holding the data file is
+	// complete
+	if meta, err := os.ReadFile(db.metaFile()); err == nil {
+		if err := copyFileAtomic(destMeta, bytes.NewReader(meta), int64(len(meta))); err != nil {
+			return fmt.Errorf("snapshot failed: %w", err)
+		}
+	}
+	segments, release := db.copySegments()
+	defer release()
+	for _, s := range segments {
+		if err := copySegment(filepath.Join(destDir, filepath.Base(s.file)), s.dataPath()); err != nil {
+			return fmt.Errorf("snapshot failed: %w", err)
+		}
+	}
+	if err := copyFileAtomic(dest, src, size); err != nil {
+		return fmt.Errorf("snapshot failed: %w", err)
+	}
+
+	return nil
+}
+
+// copySegments returns the segments of the database as they are once its data file
+// is open for a copy, pinned against moving to another tier until release is
+// called. Segments are never rewritten, and records a compaction moves into a
+// segment after the data file was opened are in both, which opening the copy sorts
+// out.
+func (db *DB) copySegments() (segments []segment, release func()) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.readOnly {
+		if err := db.refreshSegments(); err != nil {
+			db.logError("failed to list compressed segments", err)
+		}
+	}
+	segments = append([]segment(nil), db.segments...)
+	if db.segRefs == nil {
+		db.segRefs = make(map[int]int)
+	}
+	for _, s := range segments {
+		db.segRefs[s.seq]++
+	}
+	return segments, func() { db.unpin(&snapshot{segments: segments}) }
+}
+
+// copySegment copies a segment file atomically
+func copySegment(dest, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return copyFileAtomic(dest, f, info.Size())
+}
+
+// BackupTo streams a consistent point-in-time copy of the database to w as a tar
+// archive, without staging it in a local directory first. It gives the same
+// guarantees as Snapshot. The stream can be turned back into a database with RestoreFrom.
+func (db *DB) BackupTo(w io.Writer) error {
+	if !db.isOpen() {
+		return errors.New("database not initialized")
+	}
+
+	src, name, size, err := db.openFlushed()
+	if err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	defer src.Close()
+
+	tw := tar.NewWriter(w)
+	if meta, err := os.ReadFile(db.metaFile()); err == nil {
+		header := &tar.Header{
+			Name:    db.ticker + metaFileExt,
+			Mode:    0644,
+			Size:    int64(len(meta)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("backup failed: %w", err)
+		}
+		if _, err := tw.Write(meta); err != nil {
+			return fmt.Errorf("backup failed: %w", err)
+		}
+	}
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	if _, err := io.CopyN(tw, src, size); err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	segments, release := db.copySegments()
+	defer release()
+	for _, s := range segments {
+		if err := tarFile(tw, filepath.Base(s.file), s.dataPath()); err != nil {
+			return fmt.Errorf("backup failed: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+
+	return nil
+}
+
+// tarFile writes a file to a tar archive under name
+func tarFile(tw *tar.Writer, name, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    info.Size(),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, f, info.Size())
+	return err
+}
+
+// openFlushed flushes pending writes and opens the data file, returning it together
+// with its name in a copy and the number of bytes that make up the consistent view
+// at this point. For an encrypted database it is the encrypted file.
+func (db *DB) openFlushed() (*os.File, string, int64, error) {
+	if err := db.Flush(); err != nil {
+		return nil, "", 0, err
+	}
+
+	db.mu.Lock()
+	if db.enc != nil {
+		defer db.mu.Unlock()
+		f, err := os.Open(db.enc.file.Name())
+		if err != nil {
+			return nil, "", 0, err
+		}
+		// Flushes only append chunks after size
+		return f, db.ticker + encryptedFileExt, db.enc.size, nil
+	}
+	// Opened with the lock held, so that a schema change can't replace the file
+	// between reading its record size and opening it
+	recordSize := int64(RecordSize(db.schema))
+	f, err := os.Open(db.dataFile())
+	db.mu.Unlock()
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	// A writer in another process may be in the middle of a record
+	size, err := dataEnd(f, recordSize)
+	if err != nil {
+		f.Close()
+		return nil, "", 0, err
+	}
+
+	return f, db.ticker + dataFileExt, size, nil
+}
+
+// Restore copies the data and metadata files of a snapshot taken with Snapshot from src into dest.
+// It refuses to overwrite a ticker that already exists in dest. The restored database
+// must not be open while Restore runs.
+func Restore(src, dest string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+
+	// Check every target up front so a conflict doesn't leave a half-restored directory
+	var files []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		target := filepath.Join(dest, entry.Name())
+		if _, err := os.Stat(target); err == nil {
+			return fmt.Errorf("restore failed: %s already exists", target)
+		}
+		files = append(files, entry.Name())
+	}
+
+	for _, name := range files {
+		f, err := os.Open(filepath.Join(src, name))
+		if err != nil {
+			return fmt.Errorf("restore failed: %w", err)
+		}
+		info, err := f.Stat()
+		if err == nil {
+			err = copyFileAtomic(filepath.Join(dest, name), f, info.Size())
+		}
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("restore failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// RestoreFrom reads a backup produced by BackupTo from r and writes its data files
+// into path. Like Restore, it refuses to overwrite a ticker that already exists.
+func RestoreFrom(r io.Reader, path string) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("restore failed: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// Backups are flat; anything with a directory component did not come from BackupTo
+		name := header.Name
+		if name != filepath.Base(name) || name == "." || name == ".." {
+			return fmt.Errorf("restore failed: invalid file name in backup: %s", name)
+		}
+
+		target := filepath.Join(path, name)
+		if _, err := os.Stat(target); err == nil {
+			return fmt.Errorf("restore failed: %s already exists", target)
+		}
+		if err := copyFileAtomic(target, tr, header.Size); err != nil {
+			return fmt.Errorf("restore failed: %w", err)
+		}
+	}
+}
+
+// copyFileAtomic copies the first n bytes of src into a temporary file next to dest,
+// syncs it and renames it into place so readers never observe a partial copy
+func copyFileAtomic(dest string, src io.Reader, n int64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	_, err = io.CopyN(tmp, src, n)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpName, dest)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	return nil
+}
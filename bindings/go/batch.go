@@ -0,0 +1,368 @@
+package hocdb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// batchJournalExt is the extension of the journal a Batch commit leaves next to the
+// data file of each database it writes, hidden like other temporary files
+const batchJournalExt = ".batch"
+
+// Batch collects appends to one or more databases that Commit writes together:
+// other calls see all of them or none, and after a crash during Commit, opening
+// the databases again keeps all of the records or none of them. Records are
+// checked when added, except for their timestamps, which Commit checks against the
+// databases before writing anything. A Batch is not safe for concurrent use.
+//
+// Databases opened with OverwriteFull can't take part, as records overwritten by
+// a wrap can't be restored.
+type Batch struct {
+	ops  []batchOp
+	done bool
+}
+
+type batchOp struct {
+	db   *DB
+	data []byte
+}
+
+// batchJournal is what a commit records about a database before writing to it
+type batchJournal struct {
+	Size   int64  `json:"size"`   // Size of the data file before the commit
+	Marker string `json:"marker"` // File whose existence marks the commit done
+}
+
+// batchMarker is what the commit marker holds: the journals of the commit, so that
+// a marker a crash left behind them can be removed once none of them refers to it
+type batchMarker struct {
+	Journals []string `json:"journals"`
+}
+
+// NewBatch returns an empty Batch
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+// Append adds a raw record for db to the batch
+func (b *Batch) Append(db *DB, data []byte) error {
+	if b.done {
+		return errors.New("batch is already committed")
+	}
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	if db.options.OverwriteFull {
+		return errors.New("batch can't append to a database with OverwriteFull")
+	}
+	if len(data) != RecordSize(db.Schema()) {
+		return errors.New("append failed: invalid record size")
+	}
+	b.ops = append(b.ops, batchOp{db: db, data: append([]byte(nil), data...)})
+	return nil
+}
+
+// AppendValues adds a record for db to the batch, see DB.AppendValues
+func (b *Batch) AppendValues(db *DB, values ...interface{}) error {
+	data, err := encodeRecord(nil, db.Schema(), db.TimestampPrecision(), values)
+	if err != nil {
+		return err
+	}
+	return b.Append(db, data)
+}
+
+// Len returns the number of records in the batch
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Commit writes the records of the batch and syncs them to disk. On an error no
+// record is kept. A Batch can be committed once.
+func (b *Batch) Commit() error {
+	if b.done {
+		return errors.New("batch is already committed")
+	}
+	b.done = true
+	if len(b.ops) == 0 {
+		return nil
+	}
+
+	// Lock the databases in the order of their files, so concurrent commits can't
+	// deadlock, and hold them until the records are all in
+	perDB := make(map[*DB][][]byte)
+	var dbs []*DB
+	for _, op := range b.ops {
+		if _, ok := perDB[op.db]; !ok {
+			dbs = append(dbs, op.db)
+		}
+		perDB[op.db] = append(perDB[op.db], op.data)
+	}
+	sort.Slice(dbs, func(i, j int) bool { return dbs[i].dataFile() < dbs[j].dataFile() })
+	for _, db := range dbs {
+		db.mu.Lock()
+	}
+	var events []appendEvent
+	err := commitBatch(dbs, perDB, &events)
+	for _, db := range dbs {
+		db.mu.Unlock()
+	}
+
+	for _, ev := range events {
+		ev.run()
+	}
+	return err
+}
+
+// commitBatch writes the records of a batch; the mutex of every database in dbs
+// must be held. events gets the append events of the committed records.
+func commitBatch(dbs []*DB, perDB map[*DB][][]byte, events *[]appendEvent) error {
+	for _, db := range dbs {
+		if db.handle == nil {
+			return errors.New("database not initialized")
+		}
+		if err := db.checkBatchOrder(perDB[db]); err != nil {
+			return err
+		}
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	marker := filepath.Join(dbs[0].path, ".batch-"+hex.EncodeToString(id)+".committed")
+	if abs, err := filepath.Abs(marker); err == nil {
+		marker = abs
+	}
+
+	// Journal the size of each data file first, so a crash from here on rolls back
+	var journaled []*DB
+	rollback := func(err error) error {
+		os.Remove(marker)
+		for _, db := range journaled {
+			if rbErr := db.rollbackBatch(); rbErr != nil {
+				db.logError("batch rollback failed", rbErr)
+				err = fmt.Errorf("%w; rollback failed: %v", err, rbErr)
+			}
+		}
+		return fmt.Errorf("batch commit failed: %w", err)
+	}
+	for _, db := range dbs {
+		if err := db.flush(); err != nil {
+			return rollback(err)
+		}
+		info, err := os.Stat(db.dataFile())
+		if err != nil {
+			return rollback(err)
+		}
+		data, err := json.Marshal(batchJournal{Size: info.Size(), Marker: marker})
+		if err != nil {
+			return rollback(err)
+		}
+		if err := copyFileAtomic(db.journalFile(), bytes.NewReader(data), int64(len(data))); err != nil {
+			return rollback(err)
+		}
+		journaled = append(journaled, db)
+	}
+
+	for _, db := range dbs {
+		for _, data := range perDB[db] {
+			if err := db.append(data); err != nil {
+				return rollback(err)
+			}
+		}
+		if err := db.flush(); err != nil {
+			return rollback(err)
+		}
+		if err := syncFile(db.dataFile()); err != nil {
+			return rollback(err)
+		}
+	}
+
+	// The marker is the commit point; the journals only matter until it exists
+	var m batchMarker
+	for _, db := range dbs {
+		journal := db.journalFile()
+		if abs, err := filepath.Abs(journal); err == nil {
+			journal = abs
+		}
+		m.Journals = append(m.Journals, journal)
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return rollback(err)
+	}
+	if err := copyFileAtomic(marker, bytes.NewReader(data), int64(len(data))); err != nil {
+		return rollback(err)
+	}
+	if err := syncFile(filepath.Dir(marker)); err != nil {
+		return rollback(err)
+	}
+
+	// A journal that outlived its marker would roll the commit back, so the marker
+	// goes once the removal of the journals is on disk, or removeBatchMarkers
+	// removes it on a later open
+	dirs := make(map[string]bool)
+	for _, db := range dbs {
+		os.Remove(db.journalFile())
+		dirs[db.path] = true
+	}
+	synced := true
+	for dir := range dirs {
+		if syncFile(dir) != nil {
+			synced = false
+		}
+	}
+	if synced {
+		os.Remove(marker)
+	}
+
+	for _, db := range dbs {
+		for _, data := range perDB[db] {
+			*events = append(*events, db.noteAppend(data))
+		}
+		db.unflushed = 0
+	}
+	return nil
+}
+
+// checkBatchOrder checks that records would be accepted in order after the latest
+// record of the database; db.mu must be held
+func (db *DB) checkBatchOrder(records [][]byte) error {
+	if db.options.AutoIncrement != nil {
+		return nil
+	}
+	var previous *int64
+	if latest, err := db.getLatest(db.fieldMap["timestamp"]); err == nil {
+		previous = &latest.Timestamp
+	}
+	offset, _ := timestampOffset(db.schema)
+	for _, data := range records {
+		ts := int64(binary.LittleEndian.Uint64(data[offset:]))
+		if previous != nil && ts <= *previous {
+			return &TimestampOrderError{Timestamp: ts, Previous: *previous}
+		}
+		previous = &ts
+	}
+	return nil
+}
+
+// journalFile returns the path of the batch journal of this database
+func (db *DB) journalFile() string {
+	return filepath.Join(db.path, "."+db.ticker+batchJournalExt)
+}
+
+// rollbackBatch truncates the data file to the size journaled before a failed
+// commit and reopens the engine on it; db.mu must be held
+func (db *DB) rollbackBatch() error {
+	return db.withFileClosed(func() error {
+		_, err := recoverBatch(db.ticker, db.path, db.dataDir(), true)
+		return err
+	})
+}
+
+// recoverBatch finishes a batch commit that a crash interrupted, before the engine
+// opens the data file in dataDir: without the commit marker the file is truncated
+// to its size before the commit, or always when force is set. It reports whether
+// it truncated.
+func recoverBatch(ticker, path, dataDir string, force bool) (bool, error) {
+	journalFile := filepath.Join(path, "."+ticker+batchJournalExt)
+	data, err := os.ReadFile(journalFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var journal batchJournal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return false, fmt.Errorf("invalid batch journal %s: %w", journalFile, err)
+	}
+
+	truncated := false
+	if _, err := os.Stat(journal.Marker); force || err != nil {
+		dataFile := filepath.Join(dataDir, ticker+dataFileExt)
+		if info, err := os.Stat(dataFile); err == nil && info.Size() > journal.Size {
+			if err := os.Truncate(dataFile, journal.Size); err != nil {
+				return false, err
+			}
+			if err := syncFile(dataFile); err != nil {
+				return false, err
+			}
+			truncated = true
+		}
+	}
+	return truncated, os.Remove(journalFile)
+}
+
+// removeBatchMarkers removes the commit markers in path that no journal refers to
+// any more, left by a crash between the removal of a commit's journals and its
+// marker. Markers of commits from before markers listed their journals are kept.
+func removeBatchMarkers(path string) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasPrefix(name, ".batch-") || !strings.HasSuffix(name, ".committed") {
+			continue
+		}
+		marker := filepath.Join(path, name)
+		data, err := os.ReadFile(marker)
+		if err != nil {
+			continue
+		}
+		var m batchMarker
+		if json.Unmarshal(data, &m) != nil || len(m.Journals) == 0 {
+			continue
+		}
+		if abs, err := filepath.Abs(marker); err == nil {
+			marker = abs
+		}
+		referenced := false
+		for _, journal := range m.Journals {
+			if journalRefers(journal, marker) {
+				referenced = true
+				break
+			}
+		}
+		if !referenced {
+			os.Remove(marker)
+		}
+	}
+}
+
+// journalRefers reports whether the batch journal at journalFile refers to
+// marker, or might, when it can't be read
+func journalRefers(journalFile, marker string) bool {
+	data, err := os.ReadFile(journalFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return false
+	} else if err != nil {
+		return true
+	}
+	var journal batchJournal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return true
+	}
+	return journal.Marker == marker
+}
+
+// syncFile fsyncs a file or directory
+func syncFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
@@ -0,0 +1,163 @@
+package hocdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"os"
+)
+
+// bloomFileExt is the extension of the bloom filters of a segment, named
+// <ticker>.<seq>.bloom, see Compression.BloomFilters. The file holds bloomMagic,
+// then for each field its index and the size and bits of its filter.
+const (
+	bloomFileExt      = ".bloom"
+	bloomMagic        = "HOCB"
+	bloomBitsPerValue = 10 // About 1% false positives with bloomHashes
+	bloomHashes       = 7
+)
+
+// bloomFilter tells whether a value may be in a set, with false positives but no
+// false negatives
+type bloomFilter struct {
+	bits []byte
+}
+
+func newBloomFilter(values int) *bloomFilter {
+	return &bloomFilter{bits: make([]byte, (max(64, values*bloomBitsPerValue)+7)/8)}
+}
+
+// positions calls fn with the bits of a value, derived from a single hash as in
+// Kirsch and Mitzenmacher
+func (b *bloomFilter) positions(v []byte, fn func(bit uint64)) {
+	h := fnv.New64a()
+	h.Write(v)
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	n := uint64(len(b.bits) * 8)
+	for i := uint64(0); i < bloomHashes; i++ {
+		fn((h1 + i*h2) % n)
+	}
+}
+
+func (b *bloomFilter) add(v []byte) {
+	b.positions(v, func(bit uint64) {
+		b.bits[bit/8] |= 1 << (bit % 8)
+	})
+}
+
+func (b *bloomFilter) mayContain(v []byte) bool {
+	found := true
+	b.positions(v, func(bit uint64) {
+		found = found && b.bits[bit/8]&(1<<(bit%8)) != 0
+	})
+	return found
+}
+
+// bloomFile returns the path of the bloom filters of a segment
+func bloomFile(s segment) string {
+	return s.file[:len(s.file)-len(segmentExt)] + bloomFileExt
+}
+
+// checkBloomFilters returns why the fields of Compression.BloomFilters can't have
+// bloom filters in schema, if they can't
+func checkBloomFilters(names []string, schema []Field) error {
+	for _, name := range names {
+		i := fieldIndexByName(schema, name)
+		if i < 0 {
+			return fmt.Errorf("unknown bloom filter field: %s", name)
+		}
+		if !schema[i].Type.IsString() {
+			return fmt.Errorf("field %s: only string fields can have bloom filters", name)
+		}
+	}
+	return nil
+}
+
+// fieldIndexByName returns the index of a field of schema, -1 when it has none
+func fieldIndexByName(schema []Field, name string) int {
+	for i, field := range schema {
+		if field.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeBlooms writes the bloom filters of the values of fields in the records of a
+// segment next to it
+func writeBlooms(s segment, records []byte, schema []Field, fields []string) error {
+	recordSize := RecordSize(schema)
+	buf := []byte(bloomMagic)
+	for _, name := range fields {
+		i := fieldIndexByName(schema, name)
+		if i < 0 {
+			continue
+		}
+		offset, size := 0, schema[i].Type.Size()
+		for _, field := range schema[:i] {
+			offset += field.Type.Size()
+		}
+		values := make(map[string]struct{})
+		for off := 0; off+recordSize <= len(records); off += recordSize {
+			values[string(records[off+offset:off+offset+size])] = struct{}{}
+		}
+		b := newBloomFilter(len(values))
+		for v := range values {
+			b.add([]byte(v))
+		}
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(i))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(b.bits)))
+		buf = append(buf, b.bits...)
+	}
+	return copyFileAtomic(bloomFile(s), bytes.NewReader(buf), int64(len(buf)))
+}
+
+// readBlooms reads the bloom filters of a segment by field index, nil when it has
+// none or they can't be read
+func readBlooms(s segment) map[int]*bloomFilter {
+	data, err := os.ReadFile(bloomFile(s))
+	if err != nil || !bytes.HasPrefix(data, []byte(bloomMagic)) {
+		return nil
+	}
+	blooms := make(map[int]*bloomFilter)
+	data = data[len(bloomMagic):]
+	for len(data) > 0 {
+		if len(data) < 6 || int(binary.LittleEndian.Uint32(data[2:])) > len(data)-6 {
+			return nil
+		}
+		field, n := int(binary.LittleEndian.Uint16(data)), int(binary.LittleEndian.Uint32(data[2:]))
+		if n > 0 {
+			blooms[field] = &bloomFilter{bits: data[6 : 6+n]}
+		}
+		data = data[6+n:]
+	}
+	return blooms
+}
+
+// bloomExcludes reports whether the bloom filters of a segment rule out a string
+// filter, loading them on first use; db.mu must be held
+func (db *DB) bloomExcludes(s segment, filters []Filter, matchers []matcher) bool {
+	blooms, ok := db.blooms[s.seq]
+	if !ok {
+		blooms = readBlooms(s)
+		if db.blooms == nil {
+			db.blooms = make(map[int]map[int]*bloomFilter)
+		}
+		db.blooms[s.seq] = blooms
+	}
+	if blooms == nil {
+		return false
+	}
+	for i := range matchers {
+		m := &matchers[i]
+		if m.typ != TypeString || m.never || m.isNull {
+			continue
+		}
+		if b := blooms[filters[i].FieldIndex]; b != nil && !b.mayContain(m.raw) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package hocdb
+
+import (
+	"errors"
+	"time"
+)
+
+// day is the length of a calendar day without DST changes
+const day = 24 * time.Hour
+
+// weekStart is the Monday days of multi-day buckets are counted from
+var weekStart = time.Date(1970, 1, 5, 0, 0, 0, 0, time.UTC)
+
+// TimeBucket splits time into intervals aligned on the wall clock of a location,
+// such as the daily or hourly bars of an exchange in its local time
+type TimeBucket struct {
+	Size     time.Duration  // Must be positive
+	Location *time.Location // UTC when nil
+}
+
+// Bucket returns buckets of size in loc. Buckets under a day start at local
+// midnight and every multiple of size after it, so sizes should divide a day;
+// on days with a DST change they keep to the wall clock, and the day's buckets
+// are one hour shorter or longer in total. Buckets of whole days start at local
+// midnight, those of whole weeks on Mondays.
+func Bucket(size time.Duration, loc *time.Location) TimeBucket {
+	return TimeBucket{Size: size, Location: loc}
+}
+
+func (b TimeBucket) location() *time.Location {
+	if b.Location == nil {
+		return time.UTC
+	}
+	return b.Location
+}
+
+// Start returns the start of the bucket holding t
+func (b TimeBucket) Start(t time.Time) time.Time {
+	t = t.In(b.location())
+	y, m, d := t.Date()
+	if b.Size >= day {
+		// Count days on the calendar, which DST changes don't shift
+		days := int(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Sub(weekStart) / day)
+		n := int(b.Size / day)
+		offset := days % n
+		if offset < 0 {
+			offset += n
+		}
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, b.location())
+	}
+	h, minute, s := t.Clock()
+	wall := time.Duration(h)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(s)*time.Second + time.Duration(t.Nanosecond())
+	return time.Date(y, m, d, 0, 0, 0, int(wall-wall%b.Size), b.location())
+}
+
+// End returns the end of the bucket holding t, which is the start of the next one
+func (b TimeBucket) End(t time.Time) time.Time {
+	start := b.Start(t)
+	y, m, d := start.Date()
+	if b.Size >= day {
+		return time.Date(y, m, d+int(b.Size/day), 0, 0, 0, 0, b.location())
+	}
+	h, minute, s := start.Clock()
+	wall := time.Duration(h)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(s)*time.Second + b.Size
+	if wall >= day {
+		// The last bucket of a day ends at midnight, also when size doesn't divide it
+		return time.Date(y, m, d+1, 0, 0, 0, 0, b.location())
+	}
+	return time.Date(y, m, d, 0, 0, 0, int(wall), b.location())
+}
+
+// BucketStats are the statistics of a field in one bucket
+type BucketStats struct {
+	Start, End time.Time
+	Stats
+}
+
+// QueryDay is Query over the calendar day of date in loc, from local midnight to
+// the next
+func (db *DB) QueryDay(date time.Time, loc *time.Location, filters interface{}) ([]byte, error) {
+	b := Bucket(day, loc)
+	return db.QueryTime(b.Start(date), b.End(date), filters)
+}
+
+// GetStatsBuckets returns the statistics of a field in each bucket of b that
+// overlaps [start, end), the first and last cut to the range, skipping buckets
+// without records
+func (db *DB) GetStatsBuckets(start, end time.Time, b TimeBucket, fieldIndex int) ([]BucketStats, error) {
+	if b.Size <= 0 {
+		return nil, errors.New("bucket size must be positive")
+	}
+	var result []BucketStats
+	for from := start; from.Before(end); {
+		to := b.End(from)
+		if !to.After(from) {
+			// A wall clock time repeated when DST ends may resolve to its first
+			// occurrence, before from
+			to = from.Add(b.Size)
+		}
+		if to.After(end) {
+			to = end
+		}
+		stats, err := db.GetStatsTime(from, to, fieldIndex)
+		if err != nil {
+			return nil, err
+		}
+		if stats.Count > 0 {
+			result = append(result, BucketStats{Start: from, End: to, Stats: *stats})
+		}
+		from = to
+	}
+	return result, nil
+}
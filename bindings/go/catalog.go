@@ -0,0 +1,252 @@
+package hocdb
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownTicker is matched by the errors of Catalog calls and DropTicker and
+// RenameTicker for tickers that have no database in the directory
+var ErrUnknownTicker = errors.New("unknown ticker")
+
+// Catalog manages the databases of the tickers in one data directory, one DB per
+// ticker. It opens them on first use with the schema and layout recorded by New,
+// and keeps at most maxOpen of them open, closing the least recently used one when
+// another is needed. Databases in use by a call stay open, so a Catalog may exceed
+// maxOpen while more calls than that run concurrently. It is safe for concurrent
+// use.
+type Catalog struct {
+	path    string
+	options Options
+	maxOpen int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // Open databases by ticker, nil once closed
+	lru     *list.List               // *catalogEntry, most recently used first
+}
+
+type catalogEntry struct {
+	ticker string
+	db     *DB
+	refs   int // Calls using db, which keep it open
+}
+
+// OpenCatalog opens the data directory at path, creating it if needed. Databases
+// are opened with options, except for the file layout and TimestampPrecision the
+// existing ones recorded.
+func OpenCatalog(path string, options Options, maxOpen int) (*Catalog, error) {
+	if maxOpen < 1 {
+		return nil, errors.New("catalog needs at least one open database")
+	}
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	return &Catalog{
+		path:    path,
+		options: options,
+		maxOpen: maxOpen,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}, nil
+}
+
+// Tickers returns the tickers with a database in the directory, see ListTickers
+func (c *Catalog) Tickers() ([]string, error) {
+	return ListTickers(c.path)
+}
+
+// Create creates the database of a ticker with schema, or opens the existing one
+// if its schema is the same, like New
+func (c *Catalog) Create(ticker string, schema []Field) error {
+	e, err := c.acquire(ticker, schema)
+	if err != nil {
+		return err
+	}
+	c.release(e)
+	return nil
+}
+
+// Do calls fn with the database of a ticker, which stays open until fn returns.
+// fn must not keep db or close it.
+func (c *Catalog) Do(ticker string, fn func(db *DB) error) error {
+	e, err := c.acquire(ticker, nil)
+	if err != nil {
+		return err
+	}
+	defer c.release(e)
+	return fn(e.db)
+}
+
+// Schema returns the schema of a ticker
+func (c *Catalog) Schema(ticker string) ([]Field, error) {
+	var schema []Field
+	err := c.Do(ticker, func(db *DB) error {
+		schema = db.Schema()
+		return nil
+	})
+	return schema, err
+}
+
+// Append adds a raw record to the database of a ticker
+func (c *Catalog) Append(ticker string, data []byte) error {
+	return c.Do(ticker, func(db *DB) error {
+		return db.Append(data)
+	})
+}
+
+// AppendValues adds a record to the database of a ticker, see DB.AppendValues
+func (c *Catalog) AppendValues(ticker string, values ...interface{}) error {
+	return c.Do(ticker, func(db *DB) error {
+		return db.AppendValues(values...)
+	})
+}
+
+// Query queries the database of a ticker, see DB.Query
+func (c *Catalog) Query(ticker string, startTs, endTs int64, filters interface{}) ([]byte, error) {
+	var data []byte
+	err := c.Do(ticker, func(db *DB) error {
+		var err error
+		data, err = db.Query(startTs, endTs, filters)
+		return err
+	})
+	return data, err
+}
+
+// GetStats returns the statistics of a field of a ticker, see DB.GetStats
+func (c *Catalog) GetStats(ticker string, startTs, endTs int64, fieldIndex int) (*Stats, error) {
+	var stats *Stats
+	err := c.Do(ticker, func(db *DB) error {
+		var err error
+		stats, err = db.GetStats(startTs, endTs, fieldIndex)
+		return err
+	})
+	return stats, err
+}
+
+// Drop deletes the database of a ticker, see DropTicker. It fails while a call
+// uses the database.
+func (c *Catalog) Drop(ticker string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.closeTicker(ticker); err != nil {
+		return err
+	}
+	return DropTicker(c.path, ticker)
+}
+
+// Rename renames the database of a ticker, see RenameTicker. It fails while a
+// call uses the database.
+func (c *Catalog) Rename(oldTicker, newTicker string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.closeTicker(oldTicker); err != nil {
+		return err
+	}
+	return RenameTicker(c.path, oldTicker, newTicker)
+}
+
+// closeTicker closes the database of a ticker if it is open; c.mu must be held
+func (c *Catalog) closeTicker(ticker string) error {
+	if c.entries == nil {
+		return errors.New("catalog is closed")
+	}
+	el, ok := c.entries[ticker]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*catalogEntry)
+	if e.refs > 0 {
+		return fmt.Errorf("ticker %s is in use", ticker)
+	}
+	e.db.Close()
+	c.lru.Remove(el)
+	delete(c.entries, ticker)
+	return nil
+}
+
+// Close closes every open database. The catalog can't be used afterwards.
+func (c *Catalog) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		el.Value.(*catalogEntry).db.Close()
+	}
+	c.lru.Init()
+	c.entries = nil
+}
+
+// acquire returns the entry of a ticker, opening its database if needed, with a
+// reference the caller must release. A schema creates the database if missing.
+func (c *Catalog) acquire(ticker string, schema []Field) (*catalogEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		return nil, errors.New("catalog is closed")
+	}
+	if el, ok := c.entries[ticker]; ok {
+		e := el.Value.(*catalogEntry)
+		if schema != nil {
+			if diffs := schemaDiff(e.db.Schema(), schema); len(diffs) > 0 {
+				return nil, &SchemaMismatchError{Ticker: ticker, Stored: e.db.Schema(), Given: append([]Field(nil), schema...), Diffs: diffs}
+			}
+		}
+		c.lru.MoveToFront(el)
+		e.refs++
+		return e, nil
+	}
+
+	if err := checkTicker(ticker); err != nil {
+		return nil, err
+	}
+	var db *DB
+	var err error
+	if schema != nil {
+		db, err = New(ticker, c.path, schema, c.options)
+	} else {
+		db, err = openTicker(c.path, ticker, c.options)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e := &catalogEntry{ticker: ticker, db: db, refs: 1}
+	c.entries[ticker] = c.lru.PushFront(e)
+	c.evict()
+	return e, nil
+}
+
+// release drops a reference taken by acquire
+func (c *Catalog) release(e *catalogEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.refs--
+	if c.entries != nil {
+		c.evict()
+	}
+}
+
+// evict closes the least recently used databases not in use until at most maxOpen
+// are open; c.mu must be held
+func (c *Catalog) evict() {
+	for el := c.lru.Back(); el != nil && c.lru.Len() > c.maxOpen; {
+		prev := el.Prev()
+		if e := el.Value.(*catalogEntry); e.refs == 0 {
+			e.db.Close()
+			c.lru.Remove(el)
+			delete(c.entries, e.ticker)
+		}
+		el = prev
+	}
+}
+
+// checkTicker rejects ticker names that aren't a plain file name in the directory
+func checkTicker(ticker string) error {
+	if ticker == "" || ticker == "." || ticker == ".." || strings.ContainsAny(ticker, `/\`) {
+		return fmt.Errorf("invalid ticker %q", ticker)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package hocdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// checksumFileExt is the extension of the file holding the block checksums of a
+	// data file, see Options.VerifyChecksums
+	checksumFileExt = ".crc"
+
+	// checksumBlockRecords is the number of records a checksum covers
+	checksumBlockRecords = 1024
+
+	// checksumEntrySize is the size of a block's entry: its CRC-32C and the first
+	// and last timestamps of its records
+	checksumEntrySize = 20
+)
+
+// ErrCorrupt is matched by the errors of reading records whose data no longer
+// matches the checksum written with them, see CorruptError
+var ErrCorrupt = errors.New("data file is corrupt")
+
+// CorruptError reports a block of records that fails its checksum
+type CorruptError struct {
+	Ticker  string
+	Offset  int64 // Offset of the block in the data file
+	Size    int64 // Size of the block
+	StartTs int64 // Timestamp of the first record of the block
+	EndTs   int64 // Timestamp of the last record of the block
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("%s: %v: block at offset %d (%d bytes) with timestamps %d to %d fails its checksum",
+		e.Ticker, ErrCorrupt, e.Offset, e.Size, e.StartTs, e.EndTs)
+}
+
+func (e *CorruptError) Unwrap() error {
+	return ErrCorrupt
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// blockChecksum is the entry of a block of checksumBlockRecords records
+type blockChecksum struct {
+	crc         uint32
+	first, last int64
+}
+
+// checksumFile returns the path of the block checksums of this database
+func (db *DB) checksumFile() string {
+	return filepath.Join(db.dataDir(), db.ticker+checksumFileExt)
+}
+
+// openChecksums loads the block checksums of the data file and brings them up to
+// date. They are kept with VerifyChecksums, and also without while the file exists,
+// so that they stay in step with the data file for the next open that verifies.
+func (db *DB) openChecksums() error {
+	if !db.options.VerifyChecksums {
+		if _, err := os.Stat(db.checksumFile()); err != nil {
+			return nil
+		}
+	}
+	if db.options.OverwriteFull {
+		// Wrapping rewrites blocks in place, see New
+		return os.Remove(db.checksumFile())
+	}
+	blocks, err := readChecksums(db.checksumFile())
+	if err != nil {
+		return err
+	}
+	db.checksums = blocks
+	db.checksumsOn = true
+	return db.updateChecksums()
+}
+
+// readChecksums reads a checksum file, ignoring a partial entry at its end
+func readChecksums(file string) ([]blockChecksum, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]blockChecksum, len(data)/checksumEntrySize)
+	for i := range blocks {
+		entry := data[i*checksumEntrySize:]
+		blocks[i] = blockChecksum{
+			crc:   binary.LittleEndian.Uint32(entry),
+			first: int64(binary.LittleEndian.Uint64(entry[4:])),
+			last:  int64(binary.LittleEndian.Uint64(entry[12:])),
+		}
+	}
+	return blocks, nil
+}
+
+// updateChecksums adds the checksums of the blocks completed in the data file since
+// the last update, and drops those of blocks a truncation removed; db.mu must be held
+func (db *DB) updateChecksums() error {
+	if !db.checksumsOn || db.readOnly {
+		return nil
+	}
+	info, err := os.Stat(db.dataFile())
+	if err != nil {
+		return err
+	}
+	blockSize := int64(RecordSize(db.schema)) * checksumBlockRecords
+	complete := 0
+	if info.Size() > fileHeaderSize {
+		complete = int((info.Size() - fileHeaderSize) / blockSize)
+	}
+	if complete < len(db.checksums) {
+		db.checksums = db.checksums[:complete]
+		return os.Truncate(db.checksumFile(), int64(complete)*checksumEntrySize)
+	}
+	if complete == len(db.checksums) {
+		return nil
+	}
+
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var entries []byte
+	block := make([]byte, blockSize)
+	tsOffset, _ := timestampOffset(db.schema)
+	for i := len(db.checksums); i < complete; i++ {
+		sum, err := checksumBlock(f, block, i, tsOffset)
+		if err != nil {
+			return err
+		}
+		db.checksums = append(db.checksums, sum)
+		entries = binary.LittleEndian.AppendUint32(entries, sum.crc)
+		entries = binary.LittleEndian.AppendUint64(entries, uint64(sum.first))
+		entries = binary.LittleEndian.AppendUint64(entries, uint64(sum.last))
+	}
+
+	out, err := os.OpenFile(db.checksumFile(), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = out.WriteAt(entries, int64(complete-len(entries)/checksumEntrySize)*checksumEntrySize)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// checksumBlock reads block i of a data file into buf and returns its entry
+func checksumBlock(f *os.File, buf []byte, i, tsOffset int) (blockChecksum, error) {
+	if _, err := f.ReadAt(buf, fileHeaderSize+int64(i)*int64(len(buf))); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return blockChecksum{}, err
+	}
+	recordSize := len(buf) / checksumBlockRecords
+	return blockChecksum{
+		crc:   crc32.Checksum(buf, castagnoli),
+		first: int64(binary.LittleEndian.Uint64(buf[tsOffset:])),
+		last:  int64(binary.LittleEndian.Uint64(buf[len(buf)-recordSize+tsOffset:])),
+	}, nil
+}
+
+// checkChecksums verifies the blocks holding records in [startTs, endTs) when the
+// database verifies checksums; db.mu must be held. Records not yet in a complete
+// block aren't covered.
+func (db *DB) checkChecksums(startTs, endTs int64) error {
+	if !db.options.VerifyChecksums || len(db.checksums) == 0 {
+		return nil
+	}
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	corrupt, err := db.corruptBlocks(f, db.checksums, startTs, endTs)
+	if err != nil {
+		return err
+	}
+	if len(corrupt) > 0 {
+		return corrupt[0]
+	}
+	return nil
+}
+
+// corruptBlocks returns the blocks of a data file holding records in [startTs,
+// endTs) that fail their checksums
+func (db *DB) corruptBlocks(f *os.File, blocks []blockChecksum, startTs, endTs int64) ([]*CorruptError, error) {
+	blockSize := int64(RecordSize(db.schema)) * checksumBlockRecords
+	buf := make([]byte, blockSize)
+	tsOffset, _ := timestampOffset(db.schema)
+	var corrupt []*CorruptError
+	for i, want := range blocks {
+		if want.first >= endTs || want.last < startTs {
+			continue
+		}
+		got, err := checksumBlock(f, buf, i, tsOffset)
+		if err != nil {
+			return corrupt, err
+		}
+		if got.crc == want.crc {
+			continue
+		}
+		corrupt = append(corrupt, &CorruptError{
+			Ticker:  db.ticker,
+			Offset:  fileHeaderSize + int64(i)*blockSize,
+			Size:    blockSize,
+			StartTs: want.first,
+			EndTs:   want.last,
+		})
+	}
+	return corrupt, nil
+}
+
+// resetChecksums drops the checksums of a data file that was replaced and computes
+// them anew if they are kept; db.mu must be held
+func (db *DB) resetChecksums() error {
+	db.checksums = nil
+	if err := os.Remove(db.checksumFile()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return db.updateChecksums()
+}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"hocdb"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// headerSize is the size of the "HOC1" magic and schema hash at the start of a data file
+const headerSize = 12
+
+func runCreate(e *env, fs *flag.FlagSet, args []string) error {
+	var f dbFlags
+	f.register(fs, true)
+	ticker, _, err := parseArgs(fs, args, false)
+	if err != nil {
+		return err
+	}
+	schema, err := f.parseSchema()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(f.file(ticker)); err == nil {
+		return fmt.Errorf("%s already exists", f.file(ticker))
+	}
+	if err := os.MkdirAll(f.path, 0755); err != nil {
+		return err
+	}
+	db, err := hocdb.New(ticker, f.path, schema, f.options())
+	if err != nil {
+		return err
+	}
+	db.Close()
+	return nil
+}
+
+func runAppend(e *env, fs *flag.FlagSet, args []string) error {
+	var f dbFlags
+	f.register(fs, true)
+	ticker, texts, err := parseArgs(fs, args, true)
+	if err != nil {
+		return err
+	}
+	schema, err := f.parseSchema()
+	if err != nil {
+		return err
+	}
+	if len(texts) != len(schema) {
+		return fmt.Errorf("expected %d values, got %d", len(schema), len(texts))
+	}
+
+	values := make([]interface{}, len(schema))
+	for i, field := range schema {
+		if texts[i] == "" && field.Nullable {
+			// Empty values of nullable fields are nulls, like in CSV imports
+			continue
+		}
+		if values[i], err = hocdb.ParseValue(field.Type, texts[i]); err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+	}
+	record, err := hocdb.CreateRecordBytes(schema, values...)
+	if err != nil {
+		return err
+	}
+
+	db, err := f.open(ticker)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.Append(record); err != nil {
+		return err
+	}
+	return db.Flush()
+}
+
+func runQuery(e *env, fs *flag.FlagSet, args []string) error {
+	var f dbFlags
+	var r rangeFlags
+	var where whereFlags
+	f.register(fs, true)
+	r.register(fs)
+	fs.Var(&where, "where", "only records where `field=value` (repeatable)")
+	format := fs.String("format", "table", "output format: table, csv or json")
+	limit := fs.Int("limit", 0, "maximum number of records to print (0 for all)")
+	ticker, _, err := parseArgs(fs, args, false)
+	if err != nil {
+		return err
+	}
+	if *format != "table" && *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	db, err := f.open(ticker)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	schema := db.Schema()
+
+	filters, err := where.filters(schema)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if len(filters) > 0 {
+		data, err = db.Query(r.start, r.end, filters)
+	} else {
+		data, err = db.Query(r.start, r.end, nil)
+	}
+	if err != nil {
+		return err
+	}
+	if n := *limit * hocdb.RecordSize(schema); *limit > 0 && len(data) > n {
+		data = data[:n]
+	}
+
+	switch *format {
+	case "csv":
+		return hocdb.WriteCSV(e.stdout, schema, data, hocdb.CSVOptions{})
+	case "json":
+		return hocdb.WriteJSON(e.stdout, schema, data)
+	default:
+		return writeTable(e.stdout, schema, data)
+	}
+}
+
+// writeTable prints records as aligned columns under a header
+func writeTable(w io.Writer, schema []hocdb.Field, data []byte) error {
+	records, err := hocdb.DecodeRecords(schema, data)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	names := make([]string, len(schema))
+	for i, field := range schema {
+		names[i] = field.Name
+	}
+	fmt.Fprintln(tw, strings.Join(names, "\t"))
+
+	cells := make([]string, len(schema))
+	for _, rec := range records {
+		for i, v := range rec.Values {
+			cells[i] = fmt.Sprint(v)
+			if v == nil {
+				cells[i] = "NULL"
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// whereFlags collects repeated -where field=value flags
+type whereFlags []string
+
+func (w *whereFlags) String() string {
+	return strings.Join(*w, ",")
+}
+
+func (w *whereFlags) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return errors.New("expected field=value")
+	}
+	*w = append(*w, value)
+	return nil
+}
+
+// filters converts the conditions into engine filters typed by the schema
+func (w whereFlags) filters(schema []hocdb.Field) ([]hocdb.Filter, error) {
+	var filters []hocdb.Filter
+	for _, cond := range w {
+		name, text, _ := strings.Cut(cond, "=")
+		i := fieldIndex(schema, name)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown field in -where: %s", name)
+		}
+		v, err := hocdb.ParseValue(schema[i].Type, text)
+		if err != nil {
+			return nil, fmt.Errorf("-where %s: %w", cond, err)
+		}
+		filters = append(filters, hocdb.Filter{FieldIndex: i, Value: v})
+	}
+	return filters, nil
+}
+
+func runStats(e *env, fs *flag.FlagSet, args []string) error {
+	var f dbFlags
+	var r rangeFlags
+	f.register(fs, true)
+	r.register(fs)
+	field := fs.String("field", "", "field to compute statistics of (required)")
+	ticker, _, err := parseArgs(fs, args, false)
+	if err != nil {
+		return err
+	}
+	if *field == "" {
+		return errors.New("-field is required")
+	}
+
+	db, err := f.open(ticker)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	stats, err := db.GetStatsByName(r.start, r.end, *field)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "count\t%d\n", stats.Count)
+	fmt.Fprintf(tw, "min\t%v\n", stats.Min)
+	fmt.Fprintf(tw, "max\t%v\n", stats.Max)
+	fmt.Fprintf(tw, "sum\t%v\n", stats.Sum)
+	fmt.Fprintf(tw, "mean\t%v\n", stats.Mean)
+	return tw.Flush()
+}
+
+func runExport(e *env, fs *flag.FlagSet, args []string) error {
+	var f dbFlags
+	var r rangeFlags
+	f.register(fs, true)
+	r.register(fs)
+	format := fs.String("format", "csv", "output format: csv, json (newline-delimited) or parquet")
+	output := fs.String("o", "", "output file (default: standard output)")
+	ticker, _, err := parseArgs(fs, args, false)
+	if err != nil {
+		return err
+	}
+
+	var export func(db *hocdb.DB, w io.Writer) error
+	switch *format {
+	case "csv":
+		export = func(db *hocdb.DB, w io.Writer) error { return db.ExportCSV(w, r.start, r.end, hocdb.CSVOptions{}) }
+	case "json":
+		export = func(db *hocdb.DB, w io.Writer) error { return db.ExportJSON(w, r.start, r.end) }
+	case "parquet":
+		export = func(db *hocdb.DB, w io.Writer) error { return db.ExportParquet(w, r.start, r.end) }
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	db, err := f.open(ticker)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	out, err := openOutput(e, *output)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(out)
+	if err := export(db, bw); err != nil {
+		out.Close()
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func runImport(e *env, fs *flag.FlagSet, args []string) error {
+	var f dbFlags
+	f.register(fs, true)
+	format := fs.String("format", "", "input format: csv or json (default: from the file extension, else csv)")
+	input := fs.String("file", "", "input file (default: standard input)")
+	ticker, _, err := parseArgs(fs, args, false)
+	if err != nil {
+		return err
+	}
+
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(*input)) {
+		case ".json", ".jsonl", ".ndjson":
+			*format = "json"
+		default:
+			*format = "csv"
+		}
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	in, err := openInput(e, *input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	db, err := f.open(ticker)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result *hocdb.ImportResult
+	if *format == "json" {
+		result, err = db.ImportJSON(in)
+	} else {
+		result, err = db.ImportCSV(in, hocdb.CSVMapping{})
+	}
+	if result != nil {
+		for _, lineErr := range result.Errors {
+			fmt.Fprintln(e.stderr, lineErr)
+		}
+		fmt.Fprintf(e.stdout, "imported %d records\n", result.Imported)
+	}
+	if err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("%d lines failed", len(result.Errors))
+	}
+	return nil
+}
+
+func runInspect(e *env, fs *flag.FlagSet, args []string) error {
+	var f dbFlags
+	f.register(fs, false)
+	ticker, _, err := parseArgs(fs, args, false)
+	if err != nil {
+		return err
+	}
+	var schema []hocdb.Field
+	if f.schema != "" {
+		if schema, err = f.parseSchema(); err != nil {
+			return err
+		}
+	}
+
+	// Read the file directly, so inspecting doesn't wait for the lock of a writer
+	file, err := os.Open(f.file(ticker))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(file)
+	var header [headerSize]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return errors.New("file too short for a header")
+	}
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "file\t%s\n", f.file(ticker))
+	fmt.Fprintf(tw, "size\t%d bytes\n", info.Size())
+	if string(header[:4]) == "HOC1" {
+		fmt.Fprintf(tw, "magic\tHOC1\n")
+	} else {
+		fmt.Fprintf(tw, "magic\t%q (not a HOCDB file)\n", header[:4])
+	}
+	fmt.Fprintf(tw, "schema hash\t%016x\n", binary.LittleEndian.Uint64(header[4:]))
+
+	if schema != nil {
+		recordSize := int64(hocdb.RecordSize(schema))
+		records := (info.Size() - headerSize) / recordSize
+		fmt.Fprintf(tw, "record size\t%d bytes\n", recordSize)
+		fmt.Fprintf(tw, "records\t%d\n", records)
+		if trailing := (info.Size() - headerSize) % recordSize; trailing != 0 {
+			fmt.Fprintf(tw, "trailing bytes\t%d (torn write or wrong schema)\n", trailing)
+		}
+
+		if offset := timestampOffset(schema); offset >= 0 && records > 0 {
+			first, last, wrapped, err := scanTimestamps(br, records, int(recordSize), offset)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(tw, "first timestamp\t%d\n", first)
+			fmt.Fprintf(tw, "last timestamp\t%d\n", last)
+			fmt.Fprintf(tw, "wrapped\t%v\n", wrapped)
+		}
+	}
+	return tw.Flush()
+}
+
+// timestampOffset returns the offset of the timestamp field within a record, or -1
+func timestampOffset(schema []hocdb.Field) int {
+	offset := 0
+	for _, field := range schema {
+		if field.Name == "timestamp" && field.Type == hocdb.TypeI64 {
+			return offset
+		}
+		offset += field.Type.Size()
+	}
+	return -1
+}
+
+// scanTimestamps reads every record and returns the oldest and newest timestamps,
+// and whether the records wrap around as in a full ring buffer
+func scanTimestamps(r io.Reader, records int64, recordSize, offset int) (int64, int64, bool, error) {
+	first, last := int64(math.MaxInt64), int64(math.MinInt64)
+	prev, wrapped := int64(math.MinInt64), false
+
+	buf := make([]byte, recordSize)
+	for i := int64(0); i < records; i++ {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, 0, false, err
+		}
+		ts := int64(binary.LittleEndian.Uint64(buf[offset:]))
+		if ts < prev {
+			wrapped = true
+		}
+		if ts < first {
+			first = ts
+		}
+		if ts > last {
+			last = ts
+		}
+		prev = ts
+	}
+	return first, last, wrapped, nil
+}
+
+func runCompact(e *env, fs *flag.FlagSet, args []string) error {
+	var f dbFlags
+	var r rangeFlags
+	f.register(fs, true)
+	r.register(fs)
+	ticker, _, err := parseArgs(fs, args, false)
+	if err != nil {
+		return err
+	}
+
+	before, err := os.Stat(f.file(ticker))
+	if err != nil {
+		return fmt.Errorf("no database %s in %s", ticker, f.path)
+	}
+	db, err := f.open(ticker)
+	if err != nil {
+		return err
+	}
+	schema := db.Schema()
+	data, err := db.Query(r.start, r.end, nil)
+	db.Close()
+	if err != nil {
+		return err
+	}
+
+	// Build the new file next to the old one, so it can be renamed into place
+	tmp, err := os.MkdirTemp(f.path, ".compact-"+ticker+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	out, err := hocdb.New(ticker, tmp, schema, f.options())
+	if err != nil {
+		return err
+	}
+	recordSize := hocdb.RecordSize(schema)
+	for offset := 0; offset < len(data); offset += recordSize {
+		if err := out.Append(data[offset : offset+recordSize]); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err := out.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	out.Close()
+
+	if err := os.Rename(filepath.Join(tmp, ticker+".bin"), f.file(ticker)); err != nil {
+		return err
+	}
+	after, err := os.Stat(f.file(ticker))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "compacted %s: %d records, %d -> %d bytes\n", ticker, len(data)/recordSize, before.Size(), after.Size())
+	return nil
+}
+
+func fieldIndex(schema []hocdb.Field, name string) int {
+	for i, field := range schema {
+		if field.Name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,244 @@
+/*
+Command hocdb creates, inspects and edits HOCDB databases from the shell.
+
+Usage:
+
+	hocdb <command> [flags] <ticker> [args]
+
+Commands:
+
+	create   create an empty database
+	append   append one record given as values in schema order
+	query    print the records of a time range
+	stats    print statistics of a field
+	export   write records as CSV, NDJSON or Parquet
+	import   append records from CSV or NDJSON
+	inspect  describe a data file without opening it
+	compact  rewrite a database in time order, optionally dropping a range
+
+HOCDB files don't record their schema, so commands that open a database take it
+with -schema, for example -schema timestamp:i64,price:f64,side:string. Run
+hocdb <command> -h for the flags of a command.
+
+compact replaces the data file, so the database must not be open in another
+process while it runs.
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"hocdb"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// command is a subcommand of the CLI
+type command struct {
+	name    string
+	args    string // Positional arguments, for usage messages
+	summary string
+	run     func(env *env, fs *flag.FlagSet, args []string) error
+}
+
+// env holds the standard streams, so commands can be run from tests
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"create", "<ticker>", "create an empty database", runCreate},
+		{"append", "<ticker> <value>...", "append one record given as values in schema order", runAppend},
+		{"query", "<ticker>", "print the records of a time range", runQuery},
+		{"stats", "<ticker>", "print statistics of a field", runStats},
+		{"export", "<ticker>", "write records as CSV, NDJSON or Parquet", runExport},
+		{"import", "<ticker>", "append records from CSV or NDJSON", runImport},
+		{"inspect", "<ticker>", "describe a data file without opening it", runInspect},
+		{"compact", "<ticker>", "rewrite a database in time order, optionally dropping a range", runCompact},
+	}
+}
+
+// errUsage makes run print the usage of the command
+var errUsage = errors.New("usage")
+
+func main() {
+	os.Exit(run(os.Args[1:], &env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}))
+}
+
+// run executes a command line and returns the exit code
+func run(args []string, e *env) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		usage(e.stderr)
+		return 2
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+
+		fs := flag.NewFlagSet("hocdb "+cmd.name, flag.ContinueOnError)
+		fs.SetOutput(e.stderr)
+		fs.Usage = func() {
+			fmt.Fprintf(e.stderr, "usage: hocdb %s [flags] %s\n\n%s.\n\nFlags:\n", cmd.name, cmd.args, capitalize(cmd.summary))
+			fs.PrintDefaults()
+		}
+
+		err := cmd.run(e, fs, args[1:])
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, flag.ErrHelp):
+			return 2
+		case errors.Is(err, errUsage):
+			fs.Usage()
+			return 2
+		default:
+			fmt.Fprintf(e.stderr, "hocdb %s: %v\n", cmd.name, err)
+			return 1
+		}
+	}
+
+	fmt.Fprintf(e.stderr, "hocdb: unknown command %q\n\n", args[0])
+	usage(e.stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: hocdb <command> [flags] <ticker> [args]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nRun 'hocdb <command> -h' for the flags of a command.\n")
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// dbFlags are the flags locating and opening a database
+type dbFlags struct {
+	path          string
+	schema        string
+	maxFileSize   int64
+	overwriteFull bool
+}
+
+func (f *dbFlags) register(fs *flag.FlagSet, options bool) {
+	fs.StringVar(&f.path, "path", ".", "directory holding the database files")
+	fs.StringVar(&f.schema, "schema", "", "schema as name:type pairs, e.g. timestamp:i64,price:f64")
+	if options {
+		fs.Int64Var(&f.maxFileSize, "max-file-size", 0, "maximum data file size in bytes (0 for the engine default)")
+		fs.BoolVar(&f.overwriteFull, "overwrite-full", false, "overwrite the oldest records once the file is full")
+	}
+}
+
+// parseSchema parses the -schema flag
+func (f *dbFlags) parseSchema() ([]hocdb.Field, error) {
+	if f.schema == "" {
+		return nil, errors.New("-schema is required")
+	}
+	return hocdb.ParseSchema(f.schema)
+}
+
+// file returns the data file of a ticker
+func (f *dbFlags) file(ticker string) string {
+	return filepath.Join(f.path, ticker+".bin")
+}
+
+// open opens an existing database
+func (f *dbFlags) open(ticker string) (*hocdb.DB, error) {
+	schema, err := f.parseSchema()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(f.file(ticker)); err != nil {
+		return nil, fmt.Errorf("no database %s in %s", ticker, f.path)
+	}
+	return hocdb.New(ticker, f.path, schema, f.options())
+}
+
+func (f *dbFlags) options() hocdb.Options {
+	return hocdb.Options{MaxFileSize: f.maxFileSize, OverwriteFull: f.overwriteFull}
+}
+
+// rangeFlags select a time range
+type rangeFlags struct {
+	start int64
+	end   int64
+}
+
+func (f *rangeFlags) register(fs *flag.FlagSet) {
+	f.start, f.end = math.MinInt64, math.MaxInt64
+	fs.Var(timestampFlag{&f.start}, "start", "first `timestamp` to include (default: the first record)")
+	fs.Var(timestampFlag{&f.end}, "end", "`timestamp` to stop before (default: after the last record)")
+}
+
+// timestampFlag is an int64 flag whose open-ended default is left out of the usage
+type timestampFlag struct {
+	ts *int64
+}
+
+func (f timestampFlag) String() string {
+	if f.ts == nil || *f.ts == math.MinInt64 || *f.ts == math.MaxInt64 {
+		return ""
+	}
+	return strconv.FormatInt(*f.ts, 10)
+}
+
+func (f timestampFlag) Set(text string) error {
+	v, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return errors.New("invalid timestamp")
+	}
+	*f.ts = v
+	return nil
+}
+
+// parseArgs parses the flags and returns the ticker and the remaining arguments
+func parseArgs(fs *flag.FlagSet, args []string, extra bool) (string, []string, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", nil, err
+	}
+	if fs.NArg() == 0 || (!extra && fs.NArg() > 1) {
+		return "", nil, errUsage
+	}
+	return fs.Arg(0), fs.Args()[1:], nil
+}
+
+// openOutput opens a file for writing, or returns stdout for "" and "-"
+func openOutput(e *env, name string) (io.WriteCloser, error) {
+	if name == "" || name == "-" {
+		return nopCloser{e.stdout}, nil
+	}
+	return os.Create(name)
+}
+
+// openInput opens a file for reading, or returns stdin for "" and "-"
+func openInput(e *env, name string) (io.ReadCloser, error) {
+	if name == "" || name == "-" {
+		return io.NopCloser(e.stdin), nil
+	}
+	return os.Open(name)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCLI(t *testing.T) {
+	testDir := "../../../../b_go_test_data_cli"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := "timestamp:i64,price:f64,side:string"
+	hocdb := func(stdin string, args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(args, &env{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr})
+		return code, stdout.String(), stderr.String()
+	}
+
+	if code, _, stderr := hocdb("", "create", "-path", testDir, "-schema", schema, "BTC_USD"); code != 0 {
+		t.Fatalf("create failed: %s", stderr)
+	}
+	if code, _, _ := hocdb("", "create", "-path", testDir, "-schema", schema, "BTC_USD"); code != 1 {
+		t.Errorf("Expected create to refuse an existing database, got exit code %d", code)
+	}
+
+	if code, _, stderr := hocdb("", "append", "-path", testDir, "-schema", schema, "BTC_USD", "100", "10.5", "buy"); code != 0 {
+		t.Fatalf("append failed: %s", stderr)
+	}
+	if code, _, stderr := hocdb("", "append", "-path", testDir, "-schema", schema, "BTC_USD", "200", "abc", "buy"); code != 1 || !strings.Contains(stderr, "field price") {
+		t.Errorf("Expected append to reject a bad value, got %d: %s", code, stderr)
+	}
+
+	csvInput := "timestamp,price,side\n200,11.5,sell\n300,12.5,buy\n150,1,buy\n"
+	code, stdout, stderr := hocdb(csvInput, "import", "-path", testDir, "-schema", schema, "BTC_USD")
+	if code != 1 || stdout != "imported 2 records\n" || !strings.Contains(stderr, "line 4") {
+		t.Errorf("Unexpected import result %d: %q %q", code, stdout, stderr)
+	}
+
+	code, stdout, stderr = hocdb("", "query", "-path", testDir, "-schema", schema, "-where", "side=buy", "-format", "csv", "BTC_USD")
+	if code != 0 || stdout != "timestamp,price,side\n100,10.5,buy\n300,12.5,buy\n" {
+		t.Errorf("Unexpected query result %d: %q %s", code, stdout, stderr)
+	}
+	code, stdout, _ = hocdb("", "query", "-path", testDir, "-schema", schema, "-start", "150", "-limit", "1", "BTC_USD")
+	if code != 0 || stdout != "timestamp  price  side\n200        11.5   sell\n" {
+		t.Errorf("Unexpected table %d:\n%s", code, stdout)
+	}
+
+	code, stdout, _ = hocdb("", "stats", "-path", testDir, "-schema", schema, "-field", "price", "BTC_USD")
+	if code != 0 || !strings.Contains(stdout, "count  3\n") || !strings.Contains(stdout, "max    12.5\n") {
+		t.Errorf("Unexpected stats %d:\n%s", code, stdout)
+	}
+
+	jsonFile := filepath.Join(testDir, "out.json")
+	if code, _, stderr := hocdb("", "export", "-path", testDir, "-schema", schema, "-format", "json", "-o", jsonFile, "BTC_USD"); code != 0 {
+		t.Fatalf("export failed: %s", stderr)
+	}
+	exported, err := os.ReadFile(jsonFile)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	if strings.Count(string(exported), "\n") != 3 || !strings.HasPrefix(string(exported), `{"timestamp":100,"price":10.5,"side":"buy"}`) {
+		t.Errorf("Unexpected export:\n%s", exported)
+	}
+
+	code, stdout, _ = hocdb("", "inspect", "-path", testDir, "-schema", schema, "BTC_USD")
+	if code != 0 || !strings.Contains(stdout, "magic            HOC1\n") || !strings.Contains(stdout, "records          3\n") ||
+		!strings.Contains(stdout, "last timestamp   300\n") {
+		t.Errorf("Unexpected inspect output %d:\n%s", code, stdout)
+	}
+
+	code, stdout, stderr = hocdb("", "compact", "-path", testDir, "-schema", schema, "-start", "200", "BTC_USD")
+	if code != 0 || !strings.HasPrefix(stdout, "compacted BTC_USD: 2 records") {
+		t.Fatalf("Unexpected compact result %d: %s %s", code, stdout, stderr)
+	}
+	code, stdout, _ = hocdb("", "query", "-path", testDir, "-schema", schema, "-format", "json", "BTC_USD")
+	if code != 0 || strings.Count(stdout, "\n") != 2 || !strings.HasPrefix(stdout, `{"timestamp":200`) {
+		t.Errorf("Unexpected records after compact:\n%s", stdout)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(testDir, ".compact-*")); len(matches) != 0 {
+		t.Errorf("Temporary files left behind: %v", matches)
+	}
+
+	// Usage errors
+	if code, _, _ := hocdb(""); code != 2 {
+		t.Errorf("Expected exit code 2 without a command, got %d", code)
+	}
+	if code, _, _ := hocdb("", "frobnicate"); code != 2 {
+		t.Errorf("Expected exit code 2 for an unknown command, got %d", code)
+	}
+	if code, _, stderr := hocdb("", "query", "-path", testDir, "BTC_USD"); code != 1 || !strings.Contains(stderr, "-schema is required") {
+		t.Errorf("Expected a missing schema error, got %d: %s", code, stderr)
+	}
+	if code, _, stderr := hocdb("", "query", "-path", testDir, "-schema", schema); code != 2 || !strings.Contains(stderr, "usage: hocdb query") {
+		t.Errorf("Expected usage without a ticker, got %d: %s", code, stderr)
+	}
+}
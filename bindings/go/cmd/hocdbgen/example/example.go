@@ -0,0 +1,5 @@
+// Package example holds the code hocdbgen generates for a schema with a field of
+// every type, as an example and for the tests.
+package example
+
+//go:generate go run hocdb/cmd/hocdbgen -schema timestamp:i64,price:f64,volume:u64,symbol:string(8),venue:string,payload:bytes(16),fee:decimal(2),maker:bool,qty:i32,seq:u32,ratio:f32,level:i16,kind:u8,bid_price:f64?,note:string(4)?,tag:bytes(4)? -type Trade
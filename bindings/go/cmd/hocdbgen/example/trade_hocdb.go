@@ -0,0 +1,358 @@
+// Code generated by hocdbgen -schema timestamp:i64,price:f64,volume:u64,symbol:string(8),venue:string,payload:bytes(16),fee:decimal(2),maker:bool,qty:i32,seq:u32,ratio:f32,level:i16,kind:u8,bid_price:f64?,note:string(4)?,tag:bytes(4)? -type Trade; DO NOT EDIT.
+
+package example
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hocdb"
+	"math"
+)
+
+// TradeSchema is the schema of Trade records
+var TradeSchema = []hocdb.Field{
+	{Name: "timestamp", Type: hocdb.TypeI64},
+	{Name: "price", Type: hocdb.TypeF64},
+	{Name: "volume", Type: hocdb.TypeU64},
+	{Name: "symbol", Type: hocdb.StringType(8)},
+	{Name: "venue", Type: hocdb.TypeString},
+	{Name: "payload", Type: hocdb.BytesType(16)},
+	{Name: "fee", Type: hocdb.DecimalType(2)},
+	{Name: "maker", Type: hocdb.TypeBool},
+	{Name: "qty", Type: hocdb.TypeI32},
+	{Name: "seq", Type: hocdb.TypeU32},
+	{Name: "ratio", Type: hocdb.TypeF32},
+	{Name: "level", Type: hocdb.TypeI16},
+	{Name: "kind", Type: hocdb.TypeU8},
+	{Name: "bid_price", Type: hocdb.TypeF64, Nullable: true},
+	{Name: "note", Type: hocdb.StringType(4), Nullable: true},
+	{Name: "tag", Type: hocdb.BytesType(4), Nullable: true},
+}
+
+// TradeSize is the size in bytes of a Trade record
+const TradeSize = 221
+
+// Trade is a record of TradeSchema
+type Trade struct {
+	Timestamp int64         `hocdb:"timestamp,i64"`
+	Price     float64       `hocdb:"price,f64"`
+	Volume    uint64        `hocdb:"volume,u64"`
+	Symbol    string        `hocdb:"symbol,string(8)"`
+	Venue     string        `hocdb:"venue,string"`
+	Payload   []byte        `hocdb:"payload,bytes(16)"`
+	Fee       hocdb.Decimal `hocdb:"fee,decimal(2)"`
+	Maker     bool          `hocdb:"maker,bool"`
+	Qty       int32         `hocdb:"qty,i32"`
+	Seq       uint32        `hocdb:"seq,u32"`
+	Ratio     float32       `hocdb:"ratio,f32"`
+	Level     int16         `hocdb:"level,i16"`
+	Kind      uint8         `hocdb:"kind,u8"`
+	BidPrice  *float64      `hocdb:"bid_price,f64?"`  // nil when null
+	Note      *string       `hocdb:"note,string(4)?"` // nil when null
+	Tag       []byte        `hocdb:"tag,bytes(4)?"`   // nil when null
+}
+
+// AppendRecord appends the encoded record to dst, failing when a string or blob
+// is longer than its field or a decimal has another scale
+func (r *Trade) AppendRecord(dst []byte) ([]byte, error) {
+	n := len(dst)
+	dst = append(dst, make([]byte, TradeSize)...)
+	b := dst[n:]
+	binary.LittleEndian.PutUint64(b[0:], uint64(r.Timestamp))
+	binary.LittleEndian.PutUint64(b[8:], math.Float64bits(r.Price))
+	binary.LittleEndian.PutUint64(b[16:], r.Volume)
+	if len(r.Symbol) > 8 {
+		return dst[:n], errors.New("Trade.Symbol: string longer than 8 bytes")
+	}
+	copy(b[24:32], r.Symbol)
+	if len(r.Venue) > 128 {
+		return dst[:n], errors.New("Trade.Venue: string longer than 128 bytes")
+	}
+	copy(b[32:160], r.Venue)
+	if len(r.Payload) > 16 {
+		return dst[:n], errors.New("Trade.Payload: value longer than 16 bytes")
+	}
+	binary.LittleEndian.PutUint16(b[160:], uint16(len(r.Payload)))
+	copy(b[162:], r.Payload)
+	if r.Fee.Scale != 2 && r.Fee.Unscaled != 0 {
+		return dst[:n], errors.New("Trade.Fee: decimal of scale other than 2")
+	}
+	binary.LittleEndian.PutUint64(b[178:], uint64(r.Fee.Unscaled))
+	if r.Maker {
+		b[186] = 1
+	}
+	binary.LittleEndian.PutUint32(b[187:], uint32(r.Qty))
+	binary.LittleEndian.PutUint32(b[191:], r.Seq)
+	binary.LittleEndian.PutUint32(b[195:], math.Float32bits(r.Ratio))
+	binary.LittleEndian.PutUint16(b[199:], uint16(r.Level))
+	b[201] = r.Kind
+	if r.BidPrice == nil {
+		b[220] |= 0x01
+	} else {
+		binary.LittleEndian.PutUint64(b[202:], math.Float64bits(*r.BidPrice))
+	}
+	if r.Note == nil {
+		b[220] |= 0x02
+	} else {
+		if len(*r.Note) > 4 {
+			return dst[:n], errors.New("Trade.Note: string longer than 4 bytes")
+		}
+		copy(b[210:214], *r.Note)
+	}
+	if r.Tag == nil {
+		b[220] |= 0x04
+	} else {
+		if len(r.Tag) > 4 {
+			return dst[:n], errors.New("Trade.Tag: value longer than 4 bytes")
+		}
+		binary.LittleEndian.PutUint16(b[214:], uint16(len(r.Tag)))
+		copy(b[216:], r.Tag)
+	}
+	return dst, nil
+}
+
+// DecodeRecord decodes an encoded record into r. Blob fields reuse the memory
+// of r's slices.
+func (r *Trade) DecodeRecord(b []byte) error {
+	if len(b) != TradeSize {
+		return errors.New("record size doesn't match schema")
+	}
+	r.Timestamp = int64(binary.LittleEndian.Uint64(b[0:]))
+	r.Price = math.Float64frombits(binary.LittleEndian.Uint64(b[8:]))
+	r.Volume = binary.LittleEndian.Uint64(b[16:])
+	{
+		s := b[24:32]
+		if i := bytes.IndexByte(s, 0); i >= 0 {
+			s = s[:i]
+		}
+		r.Symbol = string(s)
+	}
+	{
+		s := b[32:160]
+		if i := bytes.IndexByte(s, 0); i >= 0 {
+			s = s[:i]
+		}
+		r.Venue = string(s)
+	}
+	{
+		l := int(binary.LittleEndian.Uint16(b[160:]))
+		if l > 16 {
+			l = 16
+		}
+		r.Payload = append(r.Payload[:0], b[162:162+l]...)
+	}
+	r.Fee = hocdb.Decimal{Unscaled: int64(binary.LittleEndian.Uint64(b[178:])), Scale: 2}
+	r.Maker = b[186] != 0
+	r.Qty = int32(binary.LittleEndian.Uint32(b[187:]))
+	r.Seq = binary.LittleEndian.Uint32(b[191:])
+	r.Ratio = math.Float32frombits(binary.LittleEndian.Uint32(b[195:]))
+	r.Level = int16(binary.LittleEndian.Uint16(b[199:]))
+	r.Kind = b[201]
+	if b[220]&0x01 != 0 {
+		r.BidPrice = nil
+	} else {
+		v := math.Float64frombits(binary.LittleEndian.Uint64(b[202:]))
+		r.BidPrice = &v
+	}
+	if b[220]&0x02 != 0 {
+		r.Note = nil
+	} else {
+		s := b[210:214]
+		if i := bytes.IndexByte(s, 0); i >= 0 {
+			s = s[:i]
+		}
+		v := string(s)
+		r.Note = &v
+	}
+	if b[220]&0x04 != 0 {
+		r.Tag = nil
+	} else {
+		l := int(binary.LittleEndian.Uint16(b[214:]))
+		if l > 4 {
+			l = 4
+		}
+		r.Tag = append(make([]byte, 0, l), b[216:216+l]...)
+	}
+	return nil
+}
+
+// DecodeTrades decodes the records of data, such as query output, appending them
+// to dst
+func DecodeTrades(data []byte, dst []Trade) ([]Trade, error) {
+	if len(data)%TradeSize != 0 {
+		return dst, errors.New("data length is not a multiple of the record size")
+	}
+	for o := 0; o < len(data); o += TradeSize {
+		var r Trade
+		if err := r.DecodeRecord(data[o : o+TradeSize]); err != nil {
+			return dst, err
+		}
+		dst = append(dst, r)
+	}
+	return dst, nil
+}
+
+// TradeTimestampColumn appends the timestamp of each record of data to dst
+func TradeTimestampColumn(data []byte, dst []int64) []int64 {
+	for o := 0; o+TradeSize <= len(data); o += TradeSize {
+		b := data[o : o+TradeSize]
+		dst = append(dst, int64(binary.LittleEndian.Uint64(b[0:])))
+	}
+	return dst
+}
+
+// TradePriceColumn appends the price of each record of data to dst
+func TradePriceColumn(data []byte, dst []float64) []float64 {
+	for o := 0; o+TradeSize <= len(data); o += TradeSize {
+		b := data[o : o+TradeSize]
+		dst = append(dst, math.Float64frombits(binary.LittleEndian.Uint64(b[8:])))
+	}
+	return dst
+}
+
+// TradeVolumeColumn appends the volume of each record of data to dst
+func TradeVolumeColumn(data []byte, dst []uint64) []uint64 {
+	for o := 0; o+TradeSize <= len(data); o += TradeSize {
+		b := data[o : o+TradeSize]
+		dst = append(dst, binary.LittleEndian.Uint64(b[16:]))
+	}
+	return dst
+}
+
+// TradeSymbolColumn appends the symbol of each record of data to dst
+func TradeSymbolColumn(data []byte, dst []string) []string {
+	for o := 0; o+TradeSize <= len(data); o += TradeSize {
+		b := data[o : o+TradeSize]
+		s := b[24:32]
+		if i := bytes.IndexByte(s, 0); i >= 0 {
+			s = s[:i]
+		}
+		dst = append(dst, string(s))
+	}
+	return dst
+}
+
+// TradeVenueColumn appends the venue of each record of data to dst
+func TradeVenueColumn(data []byte, dst []string) []string {
+	for o := 0; o+TradeSize <= len(data); o += TradeSize {
+		b := data[o : o+TradeSize]
+		s := b[32:160]
+		if i := bytes.IndexByte(s, 0); i >= 0 {
+			s = s[:i]
+		}
+		dst = append(dst, string(s))
+	}
+	return dst
+}
+
+// TradePayloadColumn appends the payload of each record of data to dst. The values alias data.
+func TradePayloadColumn(data []byte, dst [][]byte) [][]byte {
+	for o := 0; o+TradeSize <= len(data); o += TradeSize {
+		b := data[o : o+TradeSize]
+		l := int(binary.LittleEndian.Uint16(b[160:]))
+		if l > 16 {
+			l = 16
+		}
+		dst = append(dst, b[162:162+l])
+	}
+	return dst
+}
+
+// TradeFeeColumn appends the fee of each record of data to dst
+func TradeFeeColumn(data []byte, dst []hocdb.Decimal) []hocdb.Decimal {
+	for o := 0; o+TradeSize <= len(data); o += TradeSize {
+		b := data[o : o+TradeSize]
+		dst = append(dst, hocdb.Decimal{Unscaled: int64(binary.LittleEndian.Uint64(b[178:])), Scale: 2})
+	}
+	return dst
+}
+
+// TradeMakerColumn appends the maker of each record of data to dst
+func TradeMakerColumn(data []byte, dst []bool) []bool {
+	for o := 0; o+TradeSize <= len(data); o += TradeSize {
+		b := data[o : o+TradeSize]
+		dst = append(dst, b[186] != 0)
+	}
+	return dst
+}
+
+// TradeQtyColumn appends the qty of each record of data to dst
+func TradeQtyColumn(data []byte, dst []int32) []int32 {
+	for o := 0; o+TradeSize <= len(data); o += TradeSize {
+		b := data[o : o+TradeSize]
+		dst = append(dst, int32(binary.LittleEndian.Uint32(b[187:])))
+	}
+	return dst
+}
+
+// TradeSeqColumn appends the seq of each record of data to dst
+func TradeSeqColumn(data []byte, dst []uint32) []uint32 {
+	for o := 0; o+TradeSize <= len(data); o += TradeSize {
+		b := data[o : o+TradeSize]
+		dst = append(dst, binary.LittleEndian.Uint32(b[191:]))
+	}
+	return dst
+}
+
+// TradeRatioColumn appends the ratio of each record of data to dst
+func TradeRatioColumn(data []byte, dst []float32) []float32 {
+	for o := 0; o+TradeSize <= len(data); o += TradeSize {
+		b := data[o : o+TradeSize]
+		dst = append(dst, math.Float32frombits(binary.LittleEndian.Uint32(b[195:])))
+	}
+	return dst
+}
+
+// TradeLevelColumn appends the level of each record of data to dst
+func TradeLevelColumn(data []byte, dst []int16) []int16 {
+	for o := 0; o+TradeSize <= len(data); o += TradeSize {
+		b := data[o : o+TradeSize]
+		dst = append(dst, int16(binary.LittleEndian.Uint16(b[199:])))
+	}
+	return dst
+}
+
+// TradeKindColumn appends the kind of each record of data to dst
+func TradeKindColumn(data []byte, dst []uint8) []uint8 {
+	for o := 0; o+TradeSize <= len(data); o += TradeSize {
+		b := data[o : o+TradeSize]
+		dst = append(dst, b[201])
+	}
+	return dst
+}
+
+// TradeBidPriceColumn appends the bid_price of each record of data to dst, zero for nulls
+func TradeBidPriceColumn(data []byte, dst []float64) []float64 {
+	for o := 0; o+TradeSize <= len(data); o += TradeSize {
+		b := data[o : o+TradeSize]
+		dst = append(dst, math.Float64frombits(binary.LittleEndian.Uint64(b[202:])))
+	}
+	return dst
+}
+
+// TradeNoteColumn appends the note of each record of data to dst, zero for nulls
+func TradeNoteColumn(data []byte, dst []string) []string {
+	for o := 0; o+TradeSize <= len(data); o += TradeSize {
+		b := data[o : o+TradeSize]
+		s := b[210:214]
+		if i := bytes.IndexByte(s, 0); i >= 0 {
+			s = s[:i]
+		}
+		dst = append(dst, string(s))
+	}
+	return dst
+}
+
+// TradeTagColumn appends the tag of each record of data to dst, zero for nulls. The values alias data.
+func TradeTagColumn(data []byte, dst [][]byte) [][]byte {
+	for o := 0; o+TradeSize <= len(data); o += TradeSize {
+		b := data[o : o+TradeSize]
+		l := int(binary.LittleEndian.Uint16(b[214:]))
+		if l > 4 {
+			l = 4
+		}
+		dst = append(dst, b[216:216+l])
+	}
+	return dst
+}
@@ -0,0 +1,456 @@
+/*
+Command hocdbgen generates a typed Go struct for the records of a HOCDB schema,
+with an encoder, a decoder and column accessors working on raw records without
+reflection, for code appending or decoding records at full speed.
+
+Usage:
+
+	hocdbgen -schema <schema> -type <name> [-o file] [-package name]
+
+The schema is written like the -schema flag of the hocdb command, for example
+timestamp:i64,price:f64,side:string(8),bid:f64?. It is typically run from a
+go:generate directive:
+
+	//go:generate go run hocdb/cmd/hocdbgen -schema timestamp:i64,price:f64 -type Tick
+
+For -type Tick, the generated file declares:
+
+	TickSchema                                  the schema, for hocdb.New
+	TickSize                                    the size of a record in bytes
+	Tick                                        a struct with a field per schema field
+	(*Tick).AppendRecord(dst []byte)            appends the encoded record to dst
+	(*Tick).DecodeRecord(data []byte)           decodes a record into the struct
+	DecodeTicks(data []byte, dst []Tick)        decodes query output into dst
+	TickPriceColumn(data []byte, dst []float64) appends the price of every record to dst
+
+Field names become exported Go names, bid_price becoming BidPrice. Nullable
+fields are pointers, nil when null, and nullable blobs nil slices; their column
+accessors return zeros for nulls. Decimal fields are hocdb.Decimal values of the
+field's scale. The tags of the struct fields describe the schema fields, for
+hocdb.SchemaFromStruct.
+*/
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"hocdb"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+// run executes a command line and returns the exit code
+func run(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("hocdbgen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	spec := fs.String("schema", "", "schema as name:type pairs, e.g. timestamp:i64,price:f64")
+	typeName := fs.String("type", "", "name of the generated struct")
+	out := fs.String("o", "", "output `file` (default: <type>_hocdb.go in lower case)")
+	pkg := fs.String("package", os.Getenv("GOPACKAGE"), "package of the generated file (default: $GOPACKAGE, set by go generate)")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: hocdbgen -schema <schema> -type <name> [-o file] [-package name]\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *spec == "" || *typeName == "" || *pkg == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	if *out == "" {
+		*out = strings.ToLower(*typeName) + "_hocdb.go"
+	}
+
+	schema, err := hocdb.ParseSchema(*spec)
+	if err == nil {
+		var src []byte
+		if src, err = generate(*pkg, *typeName, *spec, schema); err == nil {
+			err = os.WriteFile(*out, src, 0644)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "hocdbgen: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// field is a schema field with what the generated code needs to know of it
+type field struct {
+	hocdb.Field
+	goName string
+	goType string // Without the pointer of nullable fields
+	offset int
+	size   int
+	null   int // Offset of the null bit in the record, with mask
+	mask   byte
+}
+
+// pointer reports whether the struct holds the field as a pointer, nil when null
+func (f *field) pointer() bool {
+	return f.Nullable && !f.Type.IsBytes()
+}
+
+// generate returns the formatted source of the generated file for schema, parsed
+// from spec
+func generate(pkg, typeName, spec string, schema []hocdb.Field) ([]byte, error) {
+	if !token.IsIdentifier(pkg) {
+		return nil, fmt.Errorf("invalid package name %q", pkg)
+	}
+	if !token.IsIdentifier(typeName) || !token.IsExported(typeName) {
+		return nil, fmt.Errorf("type name %q is not an exported Go identifier", typeName)
+	}
+	fields, size, err := layout(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{typeName: typeName, fields: fields, imports: map[string]bool{"hocdb": true}}
+	g.schema()
+	g.printf("// %sSize is the size in bytes of a %s record\n", typeName, typeName)
+	g.printf("const %sSize = %d\n\n", typeName, size)
+	g.structType()
+	g.encoder()
+	g.decoder()
+	g.columns()
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by hocdbgen -schema %s -type %s; DO NOT EDIT.\n\npackage %s\n\nimport (\n", spec, typeName, pkg)
+	for _, path := range []string{"bytes", "encoding/binary", "errors", "hocdb", "math"} {
+		if g.imports[path] {
+			fmt.Fprintf(&src, "\t%q\n", path)
+		}
+	}
+	src.WriteString(")\n\n")
+	src.Write(g.buf.Bytes())
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid code: %w", err)
+	}
+	return formatted, nil
+}
+
+// layout returns the fields of schema with their Go names, types and offsets, and
+// the record size
+func layout(schema []hocdb.Field) ([]field, int, error) {
+	size := hocdb.RecordSize(schema)
+	if size == 0 {
+		return nil, 0, errors.New("invalid schema")
+	}
+	fields := make([]field, len(schema))
+	names := make(map[string]string)
+	bitmap := hocdb.RecordSize(nonNullable(schema)) // Offset of the null bitmap
+	offset, bit := 0, 0
+	for i, f := range schema {
+		name := goName(f.Name)
+		if other, ok := names[name]; ok {
+			return nil, 0, fmt.Errorf("fields %s and %s have the same Go name %s", other, f.Name, name)
+		}
+		names[name] = f.Name
+		if name == "" {
+			return nil, 0, fmt.Errorf("field %q has no Go name", f.Name)
+		}
+		fields[i] = field{Field: f, goName: name, goType: goType(f.Type), offset: offset, size: f.Type.Size()}
+		if f.Nullable {
+			fields[i].null, fields[i].mask = bitmap+bit/8, 1<<(bit%8)
+			bit++
+		}
+		offset += f.Type.Size()
+	}
+	return fields, size, nil
+}
+
+// nonNullable returns schema with its fields made non-nullable
+func nonNullable(schema []hocdb.Field) []hocdb.Field {
+	fields := make([]hocdb.Field, len(schema))
+	for i, f := range schema {
+		fields[i] = hocdb.Field{Name: f.Name, Type: f.Type}
+	}
+	return fields
+}
+
+// goName returns the exported Go name of a field name, such as BidPrice for
+// bid_price
+func goName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			upper = true
+		case upper:
+			if b.Len() == 0 && unicode.IsDigit(r) {
+				b.WriteByte('F')
+			}
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// goType returns the Go type of the values of a field type
+func goType(t hocdb.FieldType) string {
+	switch {
+	case t.IsString():
+		return "string"
+	case t.IsBytes():
+		return "[]byte"
+	case t.IsDecimal():
+		return "hocdb.Decimal"
+	}
+	switch t {
+	case hocdb.TypeI64:
+		return "int64"
+	case hocdb.TypeF64:
+		return "float64"
+	case hocdb.TypeU64:
+		return "uint64"
+	case hocdb.TypeBool:
+		return "bool"
+	case hocdb.TypeI32:
+		return "int32"
+	case hocdb.TypeU32:
+		return "uint32"
+	case hocdb.TypeF32:
+		return "float32"
+	case hocdb.TypeI16:
+		return "int16"
+	default:
+		return "uint8"
+	}
+}
+
+// typeExpr returns the Go expression of a field type
+func typeExpr(t hocdb.FieldType) string {
+	name := t.String()
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		// string(8) is hocdb.StringType(8)
+		return "hocdb." + strings.ToUpper(name[:1]) + name[1:i] + "Type" + name[i:]
+	}
+	return "hocdb.Type" + strings.ToUpper(name[:1]) + name[1:]
+}
+
+// generator writes the declarations of the generated file
+type generator struct {
+	typeName string
+	fields   []field
+	imports  map[string]bool
+	buf      bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) schema() {
+	g.printf("// %sSchema is the schema of %s records\n", g.typeName, g.typeName)
+	g.printf("var %sSchema = []hocdb.Field{\n", g.typeName)
+	for _, f := range g.fields {
+		g.printf("{Name: %q, Type: %s", f.Name, typeExpr(f.Type))
+		if f.Nullable {
+			g.printf(", Nullable: true")
+		}
+		g.printf("},\n")
+	}
+	g.printf("}\n\n")
+}
+
+func (g *generator) structType() {
+	g.printf("// %s is a record of %sSchema\n", g.typeName, g.typeName)
+	g.printf("type %s struct {\n", g.typeName)
+	for _, f := range g.fields {
+		ptr, comment := "", ""
+		if f.pointer() {
+			ptr = "*"
+		}
+		if f.Nullable {
+			comment = " // nil when null"
+		}
+		tag := f.Name + "," + f.Type.String()
+		if f.Nullable {
+			tag += "?"
+		}
+		g.printf("%s %s%s `hocdb:%q`%s\n", f.goName, ptr, f.goType, tag, comment)
+	}
+	g.printf("}\n\n")
+}
+
+func (g *generator) encoder() {
+	g.imports["encoding/binary"] = true
+	g.printf("// AppendRecord appends the encoded record to dst, failing when a string or blob\n")
+	g.printf("// is longer than its field or a decimal has another scale\n")
+	g.printf("func (r *%s) AppendRecord(dst []byte) ([]byte, error) {\n", g.typeName)
+	g.printf("n := len(dst)\n")
+	g.printf("dst = append(dst, make([]byte, %sSize)...)\n", g.typeName)
+	g.printf("b := dst[n:]\n")
+	for _, f := range g.fields {
+		v := "r." + f.goName
+		if f.pointer() {
+			v = "*" + v
+		}
+		if f.Nullable {
+			g.printf("if r.%s == nil {\nb[%d] |= %#02x\n} else {\n", f.goName, f.null, f.mask)
+		}
+		g.encodeValue(f, v)
+		if f.Nullable {
+			g.printf("}\n")
+		}
+	}
+	g.printf("return dst, nil\n}\n\n")
+}
+
+// encodeValue writes the statements encoding the value v of a field into b
+func (g *generator) encodeValue(f field, v string) {
+	o := f.offset
+	fail := func(msg string) {
+		g.imports["errors"] = true
+		g.printf("return dst[:n], errors.New(%q)\n", g.typeName+"."+f.goName+": "+msg)
+	}
+	switch t := f.Type; {
+	case t.IsString():
+		g.printf("if len(%s) > %d {\n", v, f.size)
+		fail(fmt.Sprintf("string longer than %d bytes", f.size))
+		g.printf("}\ncopy(b[%d:%d], %s)\n", o, o+f.size, v)
+	case t.IsBytes():
+		g.printf("if len(%s) > %d {\n", v, f.size-2)
+		fail(fmt.Sprintf("value longer than %d bytes", f.size-2))
+		g.printf("}\nbinary.LittleEndian.PutUint16(b[%d:], uint16(len(%s)))\ncopy(b[%d:], %s)\n", o, v, o+2, v)
+	case t.IsDecimal():
+		// Zero is zero at any scale
+		d := "r." + f.goName // Dereferenced by the selectors when a pointer
+		g.printf("if %s.Scale != %d && %s.Unscaled != 0 {\n", d, t.Scale(), d)
+		fail(fmt.Sprintf("decimal of scale other than %d", t.Scale()))
+		g.printf("}\nbinary.LittleEndian.PutUint64(b[%d:], uint64(%s.Unscaled))\n", o, d)
+	case t == hocdb.TypeI64:
+		g.printf("binary.LittleEndian.PutUint64(b[%d:], uint64(%s))\n", o, v)
+	case t == hocdb.TypeU64:
+		g.printf("binary.LittleEndian.PutUint64(b[%d:], %s)\n", o, v)
+	case t == hocdb.TypeF64:
+		g.imports["math"] = true
+		g.printf("binary.LittleEndian.PutUint64(b[%d:], math.Float64bits(%s))\n", o, v)
+	case t == hocdb.TypeI32:
+		g.printf("binary.LittleEndian.PutUint32(b[%d:], uint32(%s))\n", o, v)
+	case t == hocdb.TypeU32:
+		g.printf("binary.LittleEndian.PutUint32(b[%d:], %s)\n", o, v)
+	case t == hocdb.TypeF32:
+		g.imports["math"] = true
+		g.printf("binary.LittleEndian.PutUint32(b[%d:], math.Float32bits(%s))\n", o, v)
+	case t == hocdb.TypeI16:
+		g.printf("binary.LittleEndian.PutUint16(b[%d:], uint16(%s))\n", o, v)
+	case t == hocdb.TypeBool:
+		g.printf("if %s {\nb[%d] = 1\n}\n", v, o)
+	default:
+		g.printf("b[%d] = %s\n", o, v)
+	}
+}
+
+// decodeValue returns the expression decoding a field from the record b, and the
+// statements that need to run first. Blobs alias b.
+func (g *generator) decodeValue(f field) (stmts, expr string) {
+	o := f.offset
+	switch t := f.Type; {
+	case t.IsString():
+		g.imports["bytes"] = true
+		return fmt.Sprintf("s := b[%d:%d]\nif i := bytes.IndexByte(s, 0); i >= 0 {\ns = s[:i]\n}\n", o, o+f.size), "string(s)"
+	case t.IsBytes():
+		return fmt.Sprintf("l := int(binary.LittleEndian.Uint16(b[%d:]))\nif l > %d {\nl = %d\n}\n", o, f.size-2, f.size-2),
+			fmt.Sprintf("b[%d:%d+l]", o+2, o+2)
+	case t.IsDecimal():
+		return "", fmt.Sprintf("hocdb.Decimal{Unscaled: int64(binary.LittleEndian.Uint64(b[%d:])), Scale: %d}", o, t.Scale())
+	case t == hocdb.TypeI64:
+		return "", fmt.Sprintf("int64(binary.LittleEndian.Uint64(b[%d:]))", o)
+	case t == hocdb.TypeU64:
+		return "", fmt.Sprintf("binary.LittleEndian.Uint64(b[%d:])", o)
+	case t == hocdb.TypeF64:
+		g.imports["math"] = true
+		return "", fmt.Sprintf("math.Float64frombits(binary.LittleEndian.Uint64(b[%d:]))", o)
+	case t == hocdb.TypeI32:
+		return "", fmt.Sprintf("int32(binary.LittleEndian.Uint32(b[%d:]))", o)
+	case t == hocdb.TypeU32:
+		return "", fmt.Sprintf("binary.LittleEndian.Uint32(b[%d:])", o)
+	case t == hocdb.TypeF32:
+		g.imports["math"] = true
+		return "", fmt.Sprintf("math.Float32frombits(binary.LittleEndian.Uint32(b[%d:]))", o)
+	case t == hocdb.TypeI16:
+		return "", fmt.Sprintf("int16(binary.LittleEndian.Uint16(b[%d:]))", o)
+	case t == hocdb.TypeBool:
+		return "", fmt.Sprintf("b[%d] != 0", o)
+	default:
+		return "", fmt.Sprintf("b[%d]", o)
+	}
+}
+
+func (g *generator) decoder() {
+	g.printf("// DecodeRecord decodes an encoded record into r. Blob fields reuse the memory\n")
+	g.printf("// of r's slices.\n")
+	g.printf("func (r *%s) DecodeRecord(b []byte) error {\n", g.typeName)
+	g.imports["errors"] = true
+	g.printf("if len(b) != %sSize {\nreturn errors.New(\"record size doesn't match schema\")\n}\n", g.typeName)
+	for _, f := range g.fields {
+		stmts, expr := g.decodeValue(f)
+		switch {
+		case f.Type.IsBytes() && f.Nullable:
+			// Empty but not nil
+			expr = fmt.Sprintf("append(make([]byte, 0, l), %s...)", expr)
+		case f.Type.IsBytes():
+			expr = fmt.Sprintf("append(r.%s[:0], %s...)", f.goName, expr)
+		}
+		if f.Nullable {
+			g.printf("if b[%d]&%#02x != 0 {\nr.%s = nil\n} else {\n%s", f.null, f.mask, f.goName, stmts)
+			if f.pointer() {
+				g.printf("v := %s\nr.%s = &v\n}\n", expr, f.goName)
+			} else {
+				g.printf("r.%s = %s\n}\n", f.goName, expr)
+			}
+			continue
+		}
+		if stmts != "" {
+			g.printf("{\n%sr.%s = %s\n}\n", stmts, f.goName, expr)
+		} else {
+			g.printf("r.%s = %s\n", f.goName, expr)
+		}
+	}
+	g.printf("return nil\n}\n\n")
+
+	plural := g.typeName + "s"
+	g.printf("// Decode%s decodes the records of data, such as query output, appending them\n", plural)
+	g.printf("// to dst\n")
+	g.printf("func Decode%s(data []byte, dst []%s) ([]%s, error) {\n", plural, g.typeName, g.typeName)
+	g.printf("if len(data)%%%sSize != 0 {\nreturn dst, errors.New(\"data length is not a multiple of the record size\")\n}\n", g.typeName)
+	g.printf("for o := 0; o < len(data); o += %sSize {\n", g.typeName)
+	g.printf("var r %s\nif err := r.DecodeRecord(data[o : o+%sSize]); err != nil {\nreturn dst, err\n}\n", g.typeName, g.typeName)
+	g.printf("dst = append(dst, r)\n}\nreturn dst, nil\n}\n\n")
+}
+
+func (g *generator) columns() {
+	for _, f := range g.fields {
+		name := g.typeName + f.goName + "Column"
+		g.printf("// %s appends the %s of each record of data to dst", name, f.Name)
+		if f.Nullable {
+			g.printf(", zero for nulls")
+		}
+		if f.Type.IsBytes() {
+			g.printf(". The values alias data.")
+		}
+		g.printf("\n")
+		g.printf("func %s(data []byte, dst []%s) []%s {\n", name, f.goType, f.goType)
+		g.printf("for o := 0; o+%sSize <= len(data); o += %sSize {\n", g.typeName, g.typeName)
+		g.printf("b := data[o : o+%sSize]\n", g.typeName)
+		stmts, expr := g.decodeValue(f)
+		g.printf("%sdst = append(dst, %s)\n}\nreturn dst\n}\n\n", stmts, expr)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	// The example is up to date with the generator
+	src, err := os.ReadFile("example/example.go")
+	if err != nil {
+		t.Fatalf("Failed to read the example: %v", err)
+	}
+	_, directive, ok := strings.Cut(string(src), "//go:generate go run hocdb/cmd/hocdbgen ")
+	if !ok {
+		t.Fatalf("No go:generate directive in the example")
+	}
+	args := strings.Fields(strings.SplitN(directive, "\n", 2)[0])
+
+	out := filepath.Join(t.TempDir(), "trade_hocdb.go")
+	var stderr bytes.Buffer
+	if code := run(append(args, "-package", "example", "-o", out), &stderr); code != 0 {
+		t.Fatalf("hocdbgen failed: %s", stderr.String())
+	}
+	got, _ := os.ReadFile(out)
+	want, _ := os.ReadFile("example/trade_hocdb.go")
+	if !bytes.Equal(got, want) {
+		t.Errorf("example/trade_hocdb.go is out of date, run go generate ./cmd/hocdbgen/example")
+	}
+
+	for _, tc := range []struct {
+		args []string
+		code int
+		err  string
+	}{
+		{[]string{"-schema", "timestamp:i64"}, 2, "usage"},
+		{[]string{"-schema", "timestamp:i64", "-type", "tick"}, 1, "not an exported Go identifier"},
+		{[]string{"-schema", "timestamp:i64,bid_price:f64,bidPrice:f64", "-type", "Tick"}, 1, "same Go name BidPrice"},
+		{[]string{"-schema", "timestamp:i128", "-type", "Tick"}, 1, "unknown field type"},
+	} {
+		stderr.Reset()
+		args := append(tc.args, "-package", "ticks", "-o", filepath.Join(t.TempDir(), "tick_hocdb.go"))
+		if code := run(args, &stderr); code != tc.code || !strings.Contains(stderr.String(), tc.err) {
+			t.Errorf("Expected exit code %d with %q for %v, got %d: %s", tc.code, tc.err, tc.args, code, stderr.String())
+		}
+	}
+}
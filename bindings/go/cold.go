@@ -0,0 +1,403 @@
+package hocdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// coldMagic starts the stub a segment file is replaced with once ColdStorage
+	// moved the segment to object storage: the magic, header and codec of the
+	// segment follow, then the size of its compressed records as a uint64 and the
+	// key of its object, prefixed by its length as a uint16
+	coldMagic = "HOCC"
+
+	// coldCacheExt is the extension of the hidden directory next to the data file
+	// that segments fetched from cold storage are cached in by default
+	coldCacheExt = ".cache"
+
+	// defaultColdCacheSize is the size of the cache when ColdStorage.CacheSize is 0
+	defaultColdCacheSize = 1 << 30
+)
+
+// ObjectStore is object storage such as an S3 bucket, which ColdStorage moves
+// segments to. Package hocdbs3 implements it for S3-compatible storage.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// ColdStorage moves segments to object storage, leaving a stub of a few bytes in
+// place of each segment file, so that only the data file and the newest segments
+// take local disk. Queries fetch the cold segments their range and filters don't
+// rule out into a local cache; zone maps and bloom filters stay local.
+type ColdStorage struct {
+	Store ObjectStore
+
+	// Prefix is prepended to the names of segment files to form the keys of their
+	// objects. Databases of the same ticker sharing a store need different ones.
+	Prefix string
+
+	// KeepLocal is the number of newest segments Compact leaves on local disk
+	KeepLocal int
+
+	// CacheDir is the directory fetched segments are cached in, a hidden directory
+	// next to the data file by default, and CacheSize the bytes it may hold, 1 GiB
+	// by default. The least recently used segments are evicted first.
+	CacheDir  string
+	CacheSize int64
+}
+
+// coldCache caches the segments fetched from cold storage, safe for concurrent use
+type coldCache struct {
+	store ObjectStore
+	dir   string
+	limit int64
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry // By key
+	total   int64
+	clock   uint64
+}
+
+// cacheEntry is a segment in the cache, or being fetched until done is closed
+type cacheEntry struct {
+	path string
+	size int64
+	used uint64
+	done chan struct{}
+	err  error
+}
+
+// openColdCache returns the cache of a database with cold storage, picking up the
+// segments cached by earlier handles, or nil without cold storage
+func openColdCache(ticker, path string, cs *ColdStorage) (*coldCache, error) {
+	if cs == nil {
+		return nil, nil
+	}
+	if cs.Store == nil {
+		return nil, errors.New("cold storage needs a Store")
+	}
+	c := &coldCache{
+		store:   cs.Store,
+		dir:     cs.CacheDir,
+		limit:   cs.CacheSize,
+		entries: make(map[string]*cacheEntry),
+	}
+	if c.dir == "" {
+		c.dir = filepath.Join(path, "."+ticker+coldCacheExt)
+	}
+	if c.limit <= 0 {
+		c.limit = defaultColdCacheSize
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		key, err := url.PathUnescape(entry.Name())
+		info, infoErr := entry.Info()
+		if err != nil || infoErr != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		done := make(chan struct{})
+		close(done)
+		c.entries[key] = &cacheEntry{path: filepath.Join(c.dir, entry.Name()), size: info.Size(), done: done}
+		c.total += info.Size()
+	}
+	c.mu.Lock()
+	c.evict(nil)
+	c.mu.Unlock()
+	return c, nil
+}
+
+// open returns the cached object of a key, fetching it first when it isn't cached
+func (c *coldCache) open(key string) (*os.File, error) {
+	for {
+		c.mu.Lock()
+		e, ok := c.entries[key]
+		if !ok {
+			e = &cacheEntry{path: filepath.Join(c.dir, url.PathEscape(key)), done: make(chan struct{})}
+			c.entries[key] = e
+			c.mu.Unlock()
+			return c.fetch(key, e)
+		}
+		c.mu.Unlock()
+
+		<-e.done
+		if e.err != nil {
+			return nil, e.err
+		}
+		c.mu.Lock()
+		c.clock++
+		e.used = c.clock
+		f, err := os.Open(e.path)
+		c.mu.Unlock()
+		if errors.Is(err, os.ErrNotExist) {
+			continue // Evicted since it was fetched
+		}
+		return f, err
+	}
+}
+
+// fetch downloads the object of a key into the cache entry e and opens it, then
+// closes its done
+func (c *coldCache) fetch(key string, e *cacheEntry) (*os.File, error) {
+	size, err := c.download(key, e.path)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer close(e.done)
+	if err != nil {
+		e.err = fmt.Errorf("failed to fetch %s from cold storage: %w", key, err)
+		delete(c.entries, key)
+		return nil, e.err
+	}
+	c.clock++
+	e.size, e.used = size, c.clock
+	c.total += size
+	f, err := os.Open(e.path)
+	c.evict(e)
+	return f, err
+}
+
+// download copies the object of a key to file, replacing it atomically
+func (c *coldCache) download(key, file string) (int64, error) {
+	r, err := c.store.Get(context.Background(), key)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	tmp, err := os.CreateTemp(c.dir, ".fetch*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	size, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return size, os.Rename(tmp.Name(), file)
+}
+
+// add caches the local copy of a segment moved to cold storage, by linking it when
+// the cache is on the same file system; c.mu must not be held
+func (c *coldCache) add(key, file string, size int64) {
+	path := filepath.Join(c.dir, url.PathEscape(key))
+	if os.Link(file, path) != nil {
+		return
+	}
+	done := make(chan struct{})
+	close(done)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock++
+	e := &cacheEntry{path: path, size: size, used: c.clock, done: done}
+	c.entries[key] = e
+	c.total += size
+	c.evict(e)
+}
+
+// evict removes the least recently used segments until the cache fits its limit,
+// keeping keep and the segments being fetched; c.mu must be held
+func (c *coldCache) evict(keep *cacheEntry) {
+	for c.total > c.limit {
+		var oldest *cacheEntry
+		var oldestKey string
+		for key, e := range c.entries {
+			select {
+			case <-e.done:
+			default:
+				continue
+			}
+			if e != keep && (oldest == nil || e.used < oldest.used) {
+				oldest, oldestKey = e, key
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		os.Remove(oldest.path)
+		delete(c.entries, oldestKey)
+		c.total -= oldest.size
+	}
+}
+
+// remove deletes the object of a key and its cached copy
+func (c *coldCache) remove(key string) error {
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		select {
+		case <-e.done:
+			os.Remove(e.path)
+			delete(c.entries, key)
+			c.total -= e.size
+		default:
+		}
+	}
+	c.mu.Unlock()
+	return c.store.Delete(context.Background(), key)
+}
+
+// openSegmentData opens the file holding the data of a segment: the segment file,
+// the file in Tiering.WarmPath its stub points to, or its object fetched into the
+// cache for a segment in cold storage
+func openSegmentData(s segment, cold *coldCache) (*os.File, error) {
+	if s.key == "" {
+		f, err := os.Open(s.dataPath())
+		if err == nil && s.data == "" && isStub(f) {
+			f.Close()
+			err = os.ErrNotExist
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return f, err
+		}
+		// A read-only handle may have listed the segment before it moved to another
+		// tier
+		if s, err = readSegmentHeader(s.file); err != nil {
+			return nil, err
+		}
+		if s.key == "" {
+			return os.Open(s.dataPath())
+		}
+	}
+	if cold == nil {
+		return nil, fmt.Errorf("segment %s is in cold storage, which the database wasn't opened with", s.file)
+	}
+	return cold.open(s.key)
+}
+
+// isStub reports whether f is the stub of a segment in another tier
+func isStub(f *os.File) bool {
+	magic := make([]byte, len(coldMagic))
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		return false
+	}
+	return string(magic) == coldMagic || string(magic) == warmMagic
+}
+
+// readStub reads the rest of the stub of a segment in cold storage or in
+// Tiering.WarmPath after its magic, returning the segment it describes
+func readStub(f *os.File, stubMagic string) (segment, error) {
+	r := io.Reader(f)
+	magic := make([]byte, len(segmentMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || (string(magic) != segmentMagic && string(magic) != columnarMagic) {
+		return segment{}, fmt.Errorf("%s is not a HOCDB segment", f.Name())
+	}
+	var h segmentHeader
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return segment{}, fmt.Errorf("%s is not a HOCDB segment", f.Name())
+	}
+	codec := make([]byte, h.CodecLen)
+	var size uint64
+	var keyLen uint16
+	if _, err := io.ReadFull(r, codec); err != nil {
+		return segment{}, fmt.Errorf("%s is not a HOCDB segment", f.Name())
+	}
+	if binary.Read(r, binary.LittleEndian, &size) != nil || binary.Read(r, binary.LittleEndian, &keyLen) != nil {
+		return segment{}, fmt.Errorf("%s is not a HOCDB segment", f.Name())
+	}
+	ref := make([]byte, keyLen)
+	if _, err := io.ReadFull(r, ref); err != nil {
+		return segment{}, fmt.Errorf("%s is not a HOCDB segment", f.Name())
+	}
+	var key, data string
+	if stubMagic == coldMagic {
+		key = string(ref)
+	} else {
+		data = string(ref)
+	}
+	return segment{
+		file:       f.Name(),
+		key:        key,
+		data:       data,
+		codec:      string(codec),
+		columnar:   string(magic) == columnarMagic,
+		count:      h.Count,
+		first:      h.First,
+		last:       h.Last,
+		crc:        h.CRC,
+		dataOffset: int64(len(segmentMagic)+binary.Size(h)) + int64(h.CodecLen),
+		size:       int64(size),
+	}, nil
+}
+
+// segmentStub returns the stub replacing the file of segment s once its data is
+// at ref: the key of its object for coldMagic, its file for warmMagic
+func segmentStub(magic string, s segment, ref string) ([]byte, error) {
+	f, err := os.Open(s.dataPath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	if _, err := io.CopyN(&buf, f, s.dataOffset); err != nil {
+		return nil, err
+	}
+	binary.Write(&buf, binary.LittleEndian, uint64(s.size))
+	binary.Write(&buf, binary.LittleEndian, uint16(len(ref)))
+	buf.WriteString(ref)
+	return buf.Bytes(), nil
+}
+
+// moveCold moves the segments older than the newest ColdStorage.KeepLocal ones to
+// cold storage, once their newest record is older than Tiering.ColdAfter when set.
+// Segments a QueryFunc reads wait for the next time.
+func (db *DB) moveCold() error {
+	cs := db.options.ColdStorage
+	if cs == nil || db.cold == nil {
+		return nil
+	}
+	cutoff := int64(math.MaxInt64)
+	if t := db.options.Tiering; t != nil && t.ColdAfter > 0 {
+		cutoff = db.Timestamp(time.Now().Add(-t.ColdAfter))
+	}
+	db.mu.Lock()
+	var todo []segment
+	for _, s := range db.segments[:max(len(db.segments)-cs.KeepLocal, 0)] {
+		if s.key == "" && s.last < cutoff && db.segRefs[s.seq] == 0 {
+			todo = append(todo, s)
+		}
+	}
+	db.mu.Unlock()
+
+	for _, s := range todo {
+		key := cs.Prefix + filepath.Base(s.file)
+		f, err := os.Open(s.dataPath())
+		if err != nil {
+			return fmt.Errorf("failed to move %s to cold storage: %w", s.file, err)
+		}
+		err = cs.Store.Put(context.Background(), key, f, s.dataOffset+s.size)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to move %s to cold storage: %w", s.file, err)
+		}
+		replaced, err := db.replaceWithStub(s, coldMagic, key)
+		if !replaced {
+			if err := cs.Store.Delete(context.Background(), key); err != nil {
+				db.logError("failed to delete a segment from cold storage", err)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to move %s to cold storage: %w", s.file, err)
+		}
+	}
+	return nil
+}
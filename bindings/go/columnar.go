@@ -0,0 +1,342 @@
+package hocdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// columnFileExt is the extension of the column files of Options.Columnar, named
+// <ticker>.<field index>.col, and <ticker>.nulls.col for the null bitmaps
+const columnFileExt = ".col"
+
+// columnFiles returns the paths of the column files of this database, the null
+// bitmaps last when the schema has nullable fields
+func (db *DB) columnFiles() []string {
+	n := len(db.schema)
+	if nullBitmapSize(db.schema) > 0 {
+		n++
+	}
+	files := make([]string, n)
+	for i := range db.schema {
+		files[i] = filepath.Join(db.dataDir(), fmt.Sprintf("%s.%d%s", db.ticker, i, columnFileExt))
+	}
+	if n > len(db.schema) {
+		files[n-1] = filepath.Join(db.dataDir(), db.ticker+".nulls"+columnFileExt)
+	}
+	return files
+}
+
+// columnSizes returns the size of a value in each column file
+func (db *DB) columnSizes() []int {
+	sizes := make([]int, 0, len(db.schema)+1)
+	for _, field := range db.schema {
+		sizes = append(sizes, field.Type.Size())
+	}
+	if n := nullBitmapSize(db.schema); n > 0 {
+		sizes = append(sizes, n)
+	}
+	return sizes
+}
+
+// openColumns opens the column files of the data file, creating them when create
+// is set, and brings them up to date. Like checksums, they are kept without
+// Columnar while they exist, so that they stay in step with the data file.
+func (db *DB) openColumns(create bool) error {
+	files := db.columnFiles()
+	if !create {
+		if _, err := os.Stat(files[0]); err != nil {
+			return nil
+		}
+	}
+	db.colFiles = make([]*os.File, len(files))
+	for i, name := range files {
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			db.closeColumns()
+			return err
+		}
+		db.colFiles[i] = f
+	}
+	// A crash may leave columns of different lengths, the shortest holds
+	db.colRows = math.MaxInt64
+	for i, size := range db.columnSizes() {
+		info, err := db.colFiles[i].Stat()
+		if err != nil {
+			db.closeColumns()
+			return err
+		}
+		db.colRows = min64(db.colRows, info.Size()/int64(size))
+	}
+	if err := db.updateColumns(); err != nil {
+		db.closeColumns()
+		return err
+	}
+	return nil
+}
+
+// closeColumns closes the column files
+func (db *DB) closeColumns() {
+	for _, f := range db.colFiles {
+		if f != nil {
+			f.Close()
+		}
+	}
+	db.colFiles = nil
+}
+
+// updateColumns appends the records flushed to the data file since the last update
+// to the column files. When the data file no longer starts or ends with the records
+// they hold, because it was truncated or rewritten, they are cut back or rebuilt.
+// db.mu must be held.
+func (db *DB) updateColumns() error {
+	if db.colFiles == nil || db.readOnly {
+		return nil
+	}
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	recordSize := int64(RecordSize(db.schema))
+	end, err := dataEnd(f, recordSize)
+	if err != nil {
+		return err
+	}
+	rows := (end - fileHeaderSize) / recordSize
+
+	tsOffset, _ := timestampOffset(db.schema)
+	tsColumn := db.colFiles[db.timestampIndex()]
+	same, err := sameTimestamps(f, recordSize, tsOffset, min64(rows, db.colRows), func(row int64) (int64, error) {
+		return readInt64At(tsColumn, row*8)
+	})
+	if err != nil {
+		return err
+	}
+	if !same {
+		db.colRows = 0
+	}
+	if db.colRows > rows {
+		db.colRows = rows
+	}
+	sizes := db.columnSizes()
+	for i, cf := range db.colFiles {
+		if err := cf.Truncate(db.colRows * int64(sizes[i])); err != nil {
+			return err
+		}
+	}
+	if db.colRows == rows {
+		return nil
+	}
+
+	columns := make([][]byte, len(db.colFiles))
+	flush := func() error {
+		for i, cf := range db.colFiles {
+			if _, err := cf.WriteAt(columns[i], db.colRows*int64(sizes[i])); err != nil {
+				return err
+			}
+			columns[i] = columns[i][:0]
+		}
+		return nil
+	}
+	err = scanRecords(f, recordSize, tsOffset, fileHeaderSize+db.colRows*recordSize, end, func(offset, ts int64, rec []byte) bool {
+		off := 0
+		for i, size := range sizes {
+			if i == len(db.schema) {
+				off = int(recordSize) - size
+			}
+			columns[i] = append(columns[i], rec[off:off+size]...)
+			off += size
+		}
+		if len(columns[0]) >= 1<<16*sizes[0] {
+			if err = flush(); err != nil {
+				return false
+			}
+			db.colRows = (offset-fileHeaderSize)/recordSize + 1
+		}
+		return true
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		// Columns written past colRows are cut by the next update
+		return err
+	}
+	db.colRows = rows
+	return nil
+}
+
+// sameTimestamps reports whether the first and the n-th records of a data file have
+// the timestamps a copy of its first n records has, which tsAt reads, telling
+// whether the data file was rewritten since the copy was made
+func sameTimestamps(f *os.File, recordSize int64, tsOffset int, n int64, tsAt func(row int64) (int64, error)) (bool, error) {
+	if n == 0 {
+		return true, nil
+	}
+	for _, row := range []int64{0, n - 1} {
+		var buf [8]byte
+		if _, err := f.ReadAt(buf[:], fileHeaderSize+row*recordSize+int64(tsOffset)); err != nil {
+			return false, err
+		}
+		got, err := tsAt(row)
+		if err != nil {
+			return false, err
+		}
+		if got != int64(binary.LittleEndian.Uint64(buf[:])) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// timestampIndex returns the index of the timestamp field
+func (db *DB) timestampIndex() int {
+	for i, field := range db.schema {
+		if field.Name == "timestamp" {
+			return i
+		}
+	}
+	return 0
+}
+
+// resetColumns rebuilds the column files of a data file whose schema changed;
+// db.mu must be held
+func (db *DB) resetColumns(oldFiles []string) error {
+	if db.colFiles == nil {
+		return nil
+	}
+	db.closeColumns()
+	for _, name := range oldFiles {
+		os.Remove(name)
+	}
+	return db.openColumns(true)
+}
+
+// removeColumns deletes the column files; db.mu must be held
+func (db *DB) removeColumns() {
+	if db.colFiles == nil {
+		return
+	}
+	db.closeColumns()
+	for _, name := range db.columnFiles() {
+		os.Remove(name)
+	}
+}
+
+// columnStats is GetStats over the column files, reading only the timestamps and
+// the field; the data file must be flushed and db.mu held
+func (db *DB) columnStats(startTs, endTs int64, fieldIndex int) (*Stats, error) {
+	if fieldIndex < 0 || fieldIndex >= len(db.schema) {
+		return nil, errors.New("failed to get stats from HOCDB")
+	}
+	tsColumn := db.colFiles[db.timestampIndex()]
+	search := func(ts int64) (int64, error) {
+		lo, hi := int64(0), db.colRows
+		for lo < hi {
+			mid := lo + (hi-lo)/2
+			t, err := readInt64At(tsColumn, mid*8)
+			if err != nil {
+				return 0, err
+			}
+			if t < ts {
+				lo = mid + 1
+			} else {
+				hi = mid
+			}
+		}
+		return lo, nil
+	}
+	first, err := search(startTs)
+	if err != nil {
+		return nil, err
+	}
+	last, err := search(endTs)
+	if err != nil {
+		return nil, err
+	}
+
+	typ := db.schema[fieldIndex].Type
+	size := int64(typ.Size())
+	column := db.colFiles[fieldIndex]
+	var nulls *os.File
+	var nullOffset int
+	var mask byte
+	nullSize := int64(nullBitmapSize(db.schema))
+	if db.schema[fieldIndex].Nullable {
+		nulls = db.colFiles[len(db.colFiles)-1]
+		nullOffset, mask = nullBit(db.schema, fieldIndex)
+		nullOffset -= RecordSize(db.schema) - int(nullSize)
+	}
+
+	stats := &Stats{Min: math.MaxFloat64, Max: -math.MaxFloat64}
+	const chunkRows = 1 << 14
+	values := make([]byte, chunkRows*size)
+	var bitmaps []byte
+	if nulls != nil {
+		bitmaps = make([]byte, chunkRows*nullSize)
+	}
+	for i := first; i < last; i += chunkRows {
+		n := min64(chunkRows, last-i)
+		if _, err := column.ReadAt(values[:n*size], i*size); err != nil {
+			return nil, columnReadError(err)
+		}
+		if nulls != nil {
+			if _, err := nulls.ReadAt(bitmaps[:n*nullSize], i*nullSize); err != nil {
+				return nil, columnReadError(err)
+			}
+		}
+		for j := int64(0); j < n; j++ {
+			if nulls != nil && bitmaps[j*nullSize+int64(nullOffset)]&mask != 0 {
+				continue
+			}
+			val := numericValue(typ, values[j*size:])
+			stats.Min = math.Min(stats.Min, val)
+			stats.Max = math.Max(stats.Max, val)
+			stats.Sum += val
+			stats.Count++
+		}
+	}
+	return finishStats(stats), nil
+}
+
+// flushedStats flushes the data file and computes stats over the column files and
+// the segments; db.mu must be held
+func (db *DB) flushedStats(startTs, endTs int64, fieldIndex int) (*Stats, error) {
+	if err := db.flush(); err != nil {
+		return nil, err
+	}
+	stats, err := db.columnStats(startTs, endTs, fieldIndex)
+	if err != nil {
+		return nil, err
+	}
+	return db.segmentStats(stats, startTs, endTs, fieldIndex)
+}
+
+// columnReadError reports a column file shorter than the rows it should hold
+func columnReadError(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("failed to read column file: %w", err)
+}
+
+// readInt64At reads a little-endian int64 at an offset of a file
+func readInt64At(f *os.File, offset int64) (int64, error) {
+	var buf [8]byte
+	if _, err := f.ReadAt(buf[:], offset); err != nil {
+		return 0, columnReadError(err)
+	}
+	return int64(binary.LittleEndian.Uint64(buf[:])), nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
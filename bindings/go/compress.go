@@ -0,0 +1,843 @@
+package hocdb
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+const (
+	// segmentExt is the extension of the compressed segments of a ticker, named
+	// <ticker>.<sequence number>.seg next to its data file
+	segmentExt = ".seg"
+
+	// segmentMagic starts a segment file, followed by the header that segmentHeader
+	// describes and the compressed records
+	segmentMagic = "HOCZ"
+
+	// columnarMagic starts a segment whose records are encoded by encodeColumns
+	// before they are compressed
+	columnarMagic = "HOCG"
+
+	// defaultSegmentRecords is the number of records per segment when
+	// Compression.SegmentRecords is 0
+	defaultSegmentRecords = 1 << 16
+)
+
+// Compression moves the oldest records of a database into compressed segment files
+// once the data file holds two segments' worth, keeping at least one segment's
+// worth uncompressed in the data file that appends go to. Queries read the segments
+// their range overlaps. Segments are read whether or not the database is opened
+// with Compression, which only controls whether new ones are written.
+type Compression struct {
+	Codec          string // Name of a registered codec, see RegisterCodec
+	Level          int    // Compression level of the codec, 0 for its default
+	SegmentRecords int    // Records per segment, 65536 when 0
+
+	// Encoding is how records are laid out before the codec compresses them:
+	// empty for records as they are in the data file, or EncodingGorilla, which
+	// shrinks series at regular intervals with slowly changing F64 fields far
+	// more than a codec alone. "none" then skips the codec.
+	Encoding string
+
+	// BloomFilters names string fields whose values each new segment keeps a
+	// bloom filter of, so that queries with an equality filter on one of them
+	// skip the segments that can't hold the value instead of decompressing them
+	BloomFilters []string
+}
+
+// check returns why the settings are invalid, if they are
+func (c *Compression) check() error {
+	if c.Encoding != "" && c.Encoding != EncodingGorilla {
+		return fmt.Errorf("unknown compression encoding %q", c.Encoding)
+	}
+	_, err := lookupCodec(c.Codec)
+	return err
+}
+
+func (c *Compression) segmentRecords() int64 {
+	if c.SegmentRecords <= 0 {
+		return defaultSegmentRecords
+	}
+	return int64(c.SegmentRecords)
+}
+
+// Codec compresses segments. "deflate" and "none" are built in; importing
+// hocdbcompress registers "zstd" and "lz4".
+type Codec interface {
+	NewWriter(w io.Writer, level int) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{"deflate": deflateCodec{}, "none": noneCodec{}}
+)
+
+// RegisterCodec makes a codec available under a name for Compression.Codec and for
+// reading the segments written with it. It panics when the name is taken.
+func RegisterCodec(name string, codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if codec == nil {
+		panic("hocdb: RegisterCodec codec is nil")
+	}
+	if _, dup := codecs[name]; dup {
+		panic("hocdb: RegisterCodec called twice for codec " + name)
+	}
+	codecs[name] = codec
+}
+
+func lookupCodec(name string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression codec %q, import the package registering it", name)
+	}
+	return codec, nil
+}
+
+type deflateCodec struct{}
+
+func (deflateCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	return flate.NewWriter(w, level)
+}
+
+func (deflateCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
+type noneCodec struct{}
+
+func (noneCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (noneCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(r), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// segment describes a segment file
+type segment struct {
+	file        string
+	key         string // Of the object in cold storage, empty while the file is local
+	data        string // File in Tiering.WarmPath the segment file is a stub for, if any
+	seq         int
+	codec       string
+	columnar    bool  // Whether the records are encoded by encodeColumns
+	count       int64 // Number of records
+	first, last int64 // Timestamps of the first and last records
+	crc         uint32
+	dataOffset  int64 // Offset of the compressed records
+	size        int64 // Size of the compressed records
+}
+
+// SegmentInfo describes a compressed segment file, see Compact
+type SegmentInfo struct {
+	Path        string // In Tiering.WarmPath when set
+	Records     int64
+	First, Last int64 // Timestamps of the first and last records
+	Size        int64 // Size of the file in bytes
+	Codec       string
+
+	// Key is the key of the object the segment was moved to by ColdStorage, in
+	// which case Path is a stub. It is empty while the segment file is local.
+	Key string
+}
+
+func (s segment) info() SegmentInfo {
+	return SegmentInfo{Path: s.dataPath(), Records: s.count, First: s.first, Last: s.last, Size: s.dataOffset + s.size, Codec: s.codec, Key: s.key}
+}
+
+// Segments returns the compressed segments of the database in time order. They are
+// complete and never change, until RenameTicker or Drop, so archival jobs can copy
+// them as they are; ColdStorage replaces the files it moves with stubs, whose Key
+// is set. A database opened with OpenReadOnly lists those its writer
+// created so far.
+func (db *DB) Segments() ([]SegmentInfo, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if !db.opened() {
+		return nil, errors.New("database not initialized")
+	}
+	if db.readOnly {
+		if err := db.refreshSegments(); err != nil {
+			return nil, err
+		}
+	}
+	infos := make([]SegmentInfo, len(db.segments))
+	for i, s := range db.segments {
+		infos[i] = s.info()
+	}
+	return infos, nil
+}
+
+// segmentHeader is what follows the magic of a segment file, then the codec name
+type segmentHeader struct {
+	Count    int64
+	First    int64
+	Last     int64
+	CRC      uint32 // CRC-32C of the uncompressed records
+	CodecLen uint8
+}
+
+// segmentFile returns the path of segment seq of a ticker
+func segmentFile(path, ticker string, seq int) string {
+	return filepath.Join(path, fmt.Sprintf("%s.%010d%s", ticker, seq, segmentExt))
+}
+
+// removeSegment deletes the file of a segment with its zone map and bloom filters,
+// and its file in the warm tier or object in cold storage
+func (db *DB) removeSegment(s segment) {
+	os.Remove(s.file)
+	if s.data != "" {
+		os.Remove(s.data)
+	}
+	os.Remove(segmentZoneFile(s))
+	os.Remove(bloomFile(s))
+	db.removeCold(s)
+}
+
+// removeCold deletes the object of a segment in cold storage, if it has one
+func (db *DB) removeCold(s segment) {
+	if s.key == "" || db.cold == nil {
+		return
+	}
+	if err := db.cold.remove(s.key); err != nil {
+		db.logError("failed to delete a segment from cold storage", err)
+	}
+}
+
+// listSegments returns the segments of a ticker in order
+func listSegments(path, ticker string) ([]segment, error) {
+	entries, err := os.ReadDir(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var segments []segment
+	for _, entry := range entries {
+		name := entry.Name()
+		// Exactly <ticker>.<10 digits>.seg, which no other ticker's files match
+		rest, ok := strings.CutPrefix(name, ticker+".")
+		if !ok || len(rest) != 10+len(segmentExt) || !strings.HasSuffix(rest, segmentExt) {
+			continue
+		}
+		seq, err := strconv.Atoi(rest[:10])
+		if err != nil || strings.ContainsAny(rest[:10], "+-") {
+			continue
+		}
+		s, err := readSegmentHeader(filepath.Join(path, name))
+		if err != nil {
+			return nil, err
+		}
+		s.seq = seq
+		segments = append(segments, s)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].seq < segments[j].seq })
+	return segments, nil
+}
+
+// openSegments lists the segments of a ticker and drops records from the start of
+// its data file that a compaction interrupted before cutting them left in both,
+// reporting whether there were any. It runs before the engine opens the data file.
+func openSegments(ticker, path string, schema []Field) ([]segment, bool, error) {
+	segments, err := listSegments(path, ticker)
+	if err != nil || len(segments) == 0 {
+		return nil, false, err
+	}
+	tsOffset, _ := timestampOffset(schema)
+	last := segments[len(segments)-1].last
+	dropped, err := dropCompacted(filepath.Join(path, ticker+dataFileExt), int64(RecordSize(schema)), tsOffset, last)
+	return segments, dropped, err
+}
+
+// refreshSegments picks up the segments a writer compacted or dropped since the
+// last read of a read-only database, reopening the data file it cut, and the data
+// file the writer replaced; db.mu must be held
+func (db *DB) refreshSegments() error {
+	for {
+		segments, err := listSegments(db.path, db.ticker)
+		if err != nil {
+			return err
+		}
+		if len(segments) == len(db.segments) && (len(segments) == 0 || segments[len(segments)-1].seq == db.segments[len(db.segments)-1].seq) {
+			// Migrations replace the data file with a new one
+			if same, err := db.sameDataFile(); err != nil || same {
+				return err
+			}
+		}
+		// The data file is listed again after reopening it, in case the writer
+		// compacted in between
+		f, err := os.Open(db.dataFile())
+		if err != nil {
+			return err
+		}
+		db.roFile.Close()
+		db.roFile, db.segments = f, segments
+	}
+}
+
+// sameDataFile reports whether the data file a read-only database has open is still
+// the one at its path
+func (db *DB) sameDataFile() (bool, error) {
+	info, err := os.Stat(db.dataFile())
+	if err != nil {
+		return false, err
+	}
+	open, err := db.roFile.Stat()
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(info, open), nil
+}
+
+// tailStart returns where reading the data file of a read-only database starts for
+// a range starting at startTs, skipping records a writer is compacting that are
+// already in segments; db.mu must be held
+func (db *DB) tailStart(startTs int64) int64 {
+	if len(db.segments) == 0 {
+		return startTs
+	}
+	if last := db.segments[len(db.segments)-1].last; startTs <= last {
+		return last + 1
+	}
+	return startTs
+}
+
+// readSegmentHeader reads the header of a segment file
+func readSegmentHeader(file string) (segment, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return segment{}, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(segmentMagic))
+	var h segmentHeader
+	if _, err := io.ReadFull(f, magic); err == nil && (string(magic) == coldMagic || string(magic) == warmMagic) {
+		return readStub(f, string(magic))
+	}
+	if string(magic) != segmentMagic && string(magic) != columnarMagic {
+		return segment{}, fmt.Errorf("%s is not a HOCDB segment", file)
+	}
+	if err := binary.Read(f, binary.LittleEndian, &h); err != nil {
+		return segment{}, fmt.Errorf("%s is not a HOCDB segment", file)
+	}
+	codec := make([]byte, h.CodecLen)
+	if _, err := io.ReadFull(f, codec); err != nil {
+		return segment{}, fmt.Errorf("%s is not a HOCDB segment", file)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return segment{}, err
+	}
+	dataOffset := int64(len(segmentMagic)+binary.Size(h)) + int64(h.CodecLen)
+	return segment{
+		file:       file,
+		codec:      string(codec),
+		columnar:   string(magic) == columnarMagic,
+		count:      h.Count,
+		first:      h.First,
+		last:       h.Last,
+		crc:        h.CRC,
+		dataOffset: dataOffset,
+		size:       info.Size() - dataOffset,
+	}, nil
+}
+
+// writeSegment compresses records of schema into a new segment file, replacing it
+// atomically
+func writeSegment(file string, records []byte, schema []Field, c *Compression) (segment, error) {
+	codec, err := lookupCodec(c.Codec)
+	if err != nil {
+		return segment{}, err
+	}
+	recordSize := RecordSize(schema)
+	tsOffset, _ := timestampOffset(schema)
+	h := segmentHeader{
+		Count:    int64(len(records) / recordSize),
+		First:    int64(binary.LittleEndian.Uint64(records[tsOffset:])),
+		Last:     int64(binary.LittleEndian.Uint64(records[len(records)-recordSize+tsOffset:])),
+		CRC:      crc32.Checksum(records, castagnoli),
+		CodecLen: uint8(len(c.Codec)),
+	}
+	magic, data := segmentMagic, records
+	if c.Encoding == EncodingGorilla {
+		magic, data = columnarMagic, encodeColumns(records, schema)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	binary.Write(&buf, binary.LittleEndian, &h)
+	buf.WriteString(c.Codec)
+	dataOffset := int64(buf.Len())
+	w, err := codec.NewWriter(&buf, c.Level)
+	if err != nil {
+		return segment{}, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return segment{}, err
+	}
+	if err := w.Close(); err != nil {
+		return segment{}, err
+	}
+	size := int64(buf.Len())
+	if err := copyFileAtomic(file, &buf, size); err != nil {
+		return segment{}, err
+	}
+	return segment{file: file, codec: c.Codec, columnar: magic == columnarMagic, count: h.Count, first: h.First, last: h.Last, crc: h.CRC, dataOffset: dataOffset, size: size - dataOffset}, nil
+}
+
+// readSegment decompresses the records of a segment after room for a data file
+// header, so that a fileView reads them like a data file
+func (db *DB) readSegment(s segment) ([]byte, error) {
+	if db.segCache != nil && db.segCacheFile == s.file {
+		return db.segCache, nil
+	}
+	data, err := decodeSegment(s, db.schema, db.cold)
+	if err != nil {
+		return nil, err
+	}
+	db.segCache, db.segCacheFile = data, s.file
+	return data, nil
+}
+
+// decodeSegment is readSegment without the cache, safe for concurrent use
+func decodeSegment(s segment, schema []Field, cold *coldCache) ([]byte, error) {
+	codec, err := lookupCodec(s.codec)
+	if err != nil {
+		return nil, err
+	}
+	f, err := openSegmentData(s, cold)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(s.dataOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r, err := codec.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	size := s.count * int64(RecordSize(schema))
+	data := make([]byte, fileHeaderSize+size)
+	if s.columnar {
+		encoded, err := io.ReadAll(r)
+		if err == nil {
+			err = decodeColumns(data[fileHeaderSize:], encoded, schema, int(s.count))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: segment %s: %v", ErrCorrupt, s.file, err)
+		}
+	} else if _, err := io.ReadFull(r, data[fileHeaderSize:]); err != nil {
+		return nil, fmt.Errorf("%w: segment %s: %v", ErrCorrupt, s.file, err)
+	}
+	if crc32.Checksum(data[fileHeaderSize:], castagnoli) != s.crc {
+		return nil, fmt.Errorf("%w: segment %s fails its checksum", ErrCorrupt, s.file)
+	}
+	return data, nil
+}
+
+// scanSegments calls fn with a view of each segment holding records in [startTs,
+// endTs) that skip, unless nil, doesn't rule out, in time order; db.mu must be held.
+// Segments are decompressed by up to Options.QueryParallelism goroutines ahead of
+// fn, which runs on the calling goroutine.
+func (db *DB) scanSegments(startTs, endTs int64, skip func(s segment) bool, fn func(v *fileView) error) error {
+	return db.scanSegmentList(db.segments, startTs, endTs, skip, fn)
+}
+
+// scanSegmentList is scanSegments over the given segments instead of the current ones
+func (db *DB) scanSegmentList(segments []segment, startTs, endTs int64, skip func(s segment) bool, fn func(v *fileView) error) error {
+	var todo []segment
+	for _, s := range segments {
+		if s.first >= endTs || s.last < startTs || (skip != nil && skip(s)) {
+			continue
+		}
+		todo = append(todo, s)
+	}
+	tsOffset, _ := timestampOffset(db.schema)
+	view := func(s segment, data []byte) *fileView {
+		return &fileView{f: bytes.NewReader(data), size: int64(RecordSize(db.schema)), tsOffset: tsOffset, count: s.count}
+	}
+
+	workers := min(db.queryParallelism(), len(todo))
+	if workers <= 1 {
+		for _, s := range todo {
+			data, err := db.readSegment(s)
+			if err != nil {
+				return err
+			}
+			if err := fn(view(s, data)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// A slot is taken per segment until fn is done with it, which bounds the
+	// memory of the segments decompressed ahead
+	type decoded struct {
+		data []byte
+		err  error
+	}
+	results := make([]chan decoded, len(todo))
+	for i := range results {
+		results[i] = make(chan decoded, 1)
+	}
+	slots := make(chan struct{}, workers)
+	done := make(chan struct{})
+	defer close(done)
+	schema := db.schema
+	go func() {
+		for i, s := range todo {
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(i int, s segment) {
+				data, err := decodeSegment(s, schema, db.cold)
+				results[i] <- decoded{data, err}
+			}(i, s)
+		}
+	}()
+	for i, s := range todo {
+		r := <-results[i]
+		if r.err != nil {
+			return r.err
+		}
+		err := fn(view(s, r.data))
+		<-slots
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryParallelism returns how many segments a query decompresses at once
+func (db *DB) queryParallelism() int {
+	if n := db.options.QueryParallelism; n > 0 {
+		return n
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// withSegments prepends the matching records of the segments to a result in C
+// memory, returning the new result and the number of records read from segments,
+// and counting the segments read and skipped in q unless it's nil; db.mu must be
+// held
+func (db *DB) withSegments(dataPtr unsafe.Pointer, outLen int, startTs, endTs int64, filters []Filter, q *queryInfo) (unsafe.Pointer, int, int, error) {
+	if len(db.segments) == 0 {
+		return dataPtr, outLen, 0, nil
+	}
+	matchers, err := db.matchers(filters)
+	if err != nil {
+		return dataPtr, outLen, 0, err
+	}
+	var result []byte
+	scanned := 0
+	if q != nil {
+		for _, s := range db.segments {
+			if s.first >= endTs || s.last < startTs {
+				q.prune()
+			}
+		}
+	}
+	skip := func(s segment) bool {
+		excluded := db.bloomExcludes(s, filters, matchers)
+		if q != nil && excluded {
+			q.prune()
+		} else if q != nil {
+			q.bytesRead += s.size
+		}
+		return excluded
+	}
+	err = db.scanSegments(startTs, endTs, skip, func(v *fileView) error {
+		if q != nil {
+			v.limit = q.limit
+		}
+		data, n, err := v.query(startTs, endTs, matchers)
+		result = append(result, data...)
+		scanned += n
+		if q != nil {
+			q.blocksScanned++
+		}
+		return err
+	})
+	if err != nil || len(result) == 0 {
+		return dataPtr, outLen, scanned, err
+	}
+	if dataPtr != nil {
+		result = append(result, unsafe.Slice((*byte)(dataPtr), outLen)...)
+		engineFree(dataPtr)
+	}
+	return cBytes(result), len(result), scanned, nil
+}
+
+// segmentStats adds the values of the segments in [startTs, endTs) to stats
+// computed over the data file; db.mu must be held
+func (db *DB) segmentStats(stats *Stats, startTs, endTs int64, fieldIndex int) (*Stats, error) {
+	if len(db.segments) == 0 {
+		return stats, nil
+	}
+	total := &Stats{Min: math.MaxFloat64, Max: -math.MaxFloat64}
+	err := db.scanSegments(startTs, endTs, nil, func(v *fileView) error {
+		return db.scanStats(total, v, startTs, endTs, fieldIndex)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stats.Count > 0 {
+		total.Min = math.Min(total.Min, stats.Min)
+		total.Max = math.Max(total.Max, stats.Max)
+		total.Sum += stats.Sum
+		total.Count += stats.Count
+	}
+	return finishStats(total), nil
+}
+
+// Compact moves the oldest records of the data file into compressed segments when
+// it holds at least two segments' worth, see Compression, or the records of each
+// finished partition into a segment of their own, see Options.PartitionBy. Flushes
+// start it in the background, so it only needs to be called to compact right away.
+func (db *DB) Compact() error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	c := db.segmentCompression()
+	if c == nil {
+		return errors.New("database was opened without Compression or PartitionBy")
+	}
+	// Queued records must be in the data file before it is cut
+	db.asyncMu.Lock()
+	defer db.asyncMu.Unlock()
+	if w := db.async; w != nil {
+		done := make(chan error, 1)
+		w.ch <- asyncItem{done: done}
+		if err := <-done; err != nil {
+			w.setErr(err)
+		}
+	}
+
+	created, err := db.compact(c)
+	if len(created) > 0 {
+		hooks := db.segmentHooks()
+		for _, s := range created {
+			for _, fn := range hooks {
+				fn(s)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := db.moveWarm(); err != nil {
+		return err
+	}
+	return db.moveCold()
+}
+
+// compact writes the segments of Compact and cuts the data file, returning the
+// segments it wrote
+func (db *DB) compact(c *Compression) ([]SegmentInfo, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.handle == nil {
+		return nil, errors.New("database not initialized")
+	}
+	if err := db.flush(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	recordSize := int64(RecordSize(db.schema))
+	end, err := dataEnd(f, recordSize)
+	if err != nil {
+		return nil, err
+	}
+	var cuts []int64
+	if db.options.PartitionBy != PartitionNone {
+		if cuts, err = db.partitionCuts(f); err != nil {
+			return nil, err
+		}
+	} else {
+		per := c.segmentRecords()
+		for n := (end-fileHeaderSize)/recordSize/per - 1; n > 0; n-- {
+			cuts = append(cuts, per)
+		}
+		// Tiering moves the older records as well, the last of them in a smaller
+		// segment
+		old, err := db.warmRecords(f)
+		if err != nil {
+			return nil, err
+		}
+		for n := int64(len(cuts)) * per; n < old; n += per {
+			cuts = append(cuts, min64(per, old-n))
+		}
+	}
+	if len(cuts) == 0 {
+		return nil, nil
+	}
+
+	// Segments go first: a crash before the data file is cut leaves their records
+	// in both, which opening the database drops from the data file
+	seq := 1
+	if len(db.segments) > 0 {
+		seq = db.segments[len(db.segments)-1].seq + 1
+	}
+	var created []SegmentInfo
+	var buf []byte
+	from, total := int64(0), int64(0)
+	for _, n := range cuts {
+		if int64(cap(buf)) < n*recordSize {
+			buf = make([]byte, n*recordSize)
+		}
+		records := buf[:n*recordSize]
+		if _, err := f.ReadAt(records, fileHeaderSize+from*recordSize); err != nil {
+			return created, fmt.Errorf("compaction failed: %w", err)
+		}
+		from += n
+		total += n
+		s, err := db.newSegment(seq, records, c)
+		if err != nil {
+			return created, fmt.Errorf("compaction failed: %w", err)
+		}
+		s.seq = seq
+		db.segments = append(db.segments, s)
+		created = append(created, s.info())
+		if db.zoneMap != nil {
+			db.segmentZone(s, records)
+		}
+		if len(c.BloomFilters) > 0 {
+			if err := writeBlooms(s, records, db.schema, c.BloomFilters); err != nil {
+				return created, fmt.Errorf("compaction failed: %w", err)
+			}
+		}
+		seq++
+	}
+	if err := syncFile(db.path); err != nil {
+		return created, fmt.Errorf("compaction failed: %w", err)
+	}
+
+	tsOffset, _ := timestampOffset(db.schema)
+	last := db.segments[len(db.segments)-1].last
+	err = db.withFileClosed(func() error {
+		_, err := dropCompacted(db.dataFile(), recordSize, tsOffset, last)
+		return err
+	})
+	if err == nil {
+		err = db.resetChecksums()
+	}
+	db.partEnd = 0
+	if err != nil {
+		db.logError("compaction failed", err)
+		return created, fmt.Errorf("compaction failed: %w", err)
+	}
+	if db.logger != nil {
+		db.logger.Info("compacted data file", "segments", len(cuts), "records", total)
+	}
+	return created, nil
+}
+
+// maybeCompact starts a compaction in the background once the data file holds two
+// segments' worth of records, or a finished partition; db.mu must be held
+func (db *DB) maybeCompact() {
+	c := db.segmentCompression()
+	if c == nil || db.readOnly || db.compacting {
+		return
+	}
+	if db.options.PartitionBy != PartitionNone {
+		if !db.partitionDue() && !db.tierDue() {
+			return
+		}
+	} else if info, err := os.Stat(db.dataFile()); err != nil || (info.Size()-fileHeaderSize)/int64(RecordSize(db.schema)) < 2*c.segmentRecords() {
+		if !db.tierDue() {
+			return
+		}
+	}
+	db.compacting = true
+	db.compactWG.Add(1)
+	go func() {
+		defer db.compactWG.Done()
+		if err := db.Compact(); err != nil {
+			db.logError("background compaction failed", err)
+		}
+		db.mu.Lock()
+		db.compacting = false
+		db.mu.Unlock()
+	}()
+}
+
+// dropCompacted removes the records up to last from the start of a data file that
+// is not open, as they are in segments, and reports whether there were any
+func dropCompacted(file string, recordSize int64, tsOffset int, last int64) (bool, error) {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	end, err := dataEnd(f, recordSize)
+	if err != nil {
+		return false, err
+	}
+	keep := end
+	err = scanRecords(f, recordSize, tsOffset, fileHeaderSize, end, func(offset, ts int64, rec []byte) bool {
+		if ts > last {
+			keep = offset
+			return false
+		}
+		return true
+	})
+	if err != nil || keep == fileHeaderSize {
+		return false, err
+	}
+
+	data := make([]byte, fileHeaderSize+end-keep)
+	if _, err := f.ReadAt(data[:fileHeaderSize], 0); err != nil {
+		return false, err
+	}
+	if _, err := f.ReadAt(data[fileHeaderSize:], keep); err != nil {
+		return false, err
+	}
+	if err := copyFileAtomic(file, bytes.NewReader(data), int64(len(data))); err != nil {
+		return false, err
+	}
+	return true, syncFile(filepath.Dir(file))
+}
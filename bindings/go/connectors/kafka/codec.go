@@ -0,0 +1,128 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"hocdb"
+	"math/big"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// Codec decodes the value of a message into the values of a record, in schema
+// order as hocdb.CreateRecordBytes takes them. Timestamps may be time.Time values,
+// converted at the precision of the ticker's database.
+type Codec interface {
+	Decode(schema []hocdb.Field, value []byte) ([]interface{}, error)
+}
+
+// JSONCodec decodes messages holding a JSON object keyed by field name, see
+// hocdb.ParseJSONRecord
+type JSONCodec struct{}
+
+// Decode decodes a JSON object
+func (JSONCodec) Decode(schema []hocdb.Field, value []byte) ([]interface{}, error) {
+	return hocdb.ParseJSONRecord(schema, value)
+}
+
+// AvroCodec decodes messages holding an Avro record in the binary encoding, whose
+// fields are matched to schema fields by name. Unions with null are nullable, long
+// timestamps with the timestamp-millis or timestamp-micros logical types are
+// converted to the ticker's precision, and bytes decimals to hocdb decimals.
+type AvroCodec struct {
+	codec     *goavro.Codec
+	confluent bool
+}
+
+// NewAvroCodec returns a codec for messages written with an Avro schema, in JSON
+func NewAvroCodec(schema string) (*AvroCodec, error) {
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro schema: %w", err)
+	}
+	return &AvroCodec{codec: codec}, nil
+}
+
+// NewConfluentAvroCodec is NewAvroCodec for messages framed in the Confluent wire
+// format of schema registry serializers: a zero byte and the 4-byte ID of the
+// schema, which isn't checked, before the record
+func NewConfluentAvroCodec(schema string) (*AvroCodec, error) {
+	c, err := NewAvroCodec(schema)
+	if err != nil {
+		return nil, err
+	}
+	c.confluent = true
+	return c, nil
+}
+
+// Decode decodes an Avro record
+func (c *AvroCodec) Decode(schema []hocdb.Field, value []byte) ([]interface{}, error) {
+	if c.confluent {
+		if len(value) < 5 || value[0] != 0 {
+			return nil, errors.New("message isn't in the Confluent wire format")
+		}
+		value = value[5:]
+	}
+	native, rest, err := c.codec.NativeFromBinary(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%d bytes after the Avro record", len(rest))
+	}
+	record, ok := native.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("Avro schema isn't a record")
+	}
+
+	values := make([]interface{}, len(schema))
+	for i, field := range schema {
+		v, ok := record[field.Name]
+		if union, isUnion := v.(map[string]interface{}); isUnion && len(union) == 1 {
+			// goavro wraps non-null values of unions in a map keyed by their type
+			for _, inner := range union {
+				v = inner
+			}
+		}
+		switch {
+		case v == nil && field.Nullable:
+			continue
+		case !ok:
+			return nil, fmt.Errorf("missing field %s", field.Name)
+		case v == nil:
+			return nil, fmt.Errorf("field %s: null value for a field that isn't nullable", field.Name)
+		}
+		if values[i], err = avroValue(field.Type, v); err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+	}
+	return values, nil
+}
+
+// avroValue converts a value decoded by goavro into the Go value of a field type
+func avroValue(t hocdb.FieldType, v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case time.Time:
+		if t != hocdb.TypeI64 {
+			return nil, fmt.Errorf("timestamp for a %s field", t)
+		}
+		return v, nil
+	case []byte:
+		if t.IsBytes() {
+			return v, nil
+		}
+		return hocdb.ParseValue(t, string(v))
+	case *big.Rat:
+		if !t.IsDecimal() {
+			return nil, fmt.Errorf("decimal for a %s field", t)
+		}
+		return hocdb.ParseDecimal(v.FloatString(t.Scale()), t.Scale())
+	case string:
+		return hocdb.ParseValue(t, v)
+	case int32, int64, float32, float64, bool:
+		return hocdb.ParseValue(t, fmt.Sprint(v))
+	default:
+		return nil, fmt.Errorf("unsupported Avro value of type %T", v)
+	}
+}
@@ -0,0 +1,18 @@
+module hocdb/connectors/kafka
+
+go 1.23.0
+
+require (
+	github.com/linkedin/goavro/v2 v2.12.0
+	github.com/segmentio/kafka-go v0.4.50
+	hocdb v0.0.0
+)
+
+require (
+	github.com/ebitengine/purego v0.10.0 // indirect
+	github.com/golang/snappy v0.0.1 // indirect
+	github.com/klauspost/compress v1.15.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+)
+
+replace hocdb => ../../
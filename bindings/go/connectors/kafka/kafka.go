@@ -0,0 +1,239 @@
+/*
+Package kafka appends the messages of Kafka topics to HOCDB databases.
+
+A Sink reads messages with a consumer group reader of github.com/segmentio/kafka-go,
+decodes them with a Codec, JSON or Avro, and appends them to the database of a
+ticker chosen per message, by default its key, in a hocdb.Catalog. Offsets are
+committed only after the records of the messages before them are flushed, so a
+crash loses nothing: the messages since the last commit are delivered again, and
+the records they already stored are skipped.
+
+It lives in its own module so that the core hocdb bindings stay free of third-party
+dependencies.
+
+Example usage:
+
+	reader := kafkago.NewReader(kafkago.ReaderConfig{
+		Brokers: []string{"localhost:9092"},
+		GroupID: "hocdb",
+		Topic:   "trades",
+	})
+	defer reader.Close()
+	catalog, err := hocdb.OpenCatalog("./data", hocdb.Options{}, 64)
+	sink, err := kafka.NewSink(reader, catalog, kafka.Config{Schema: schema})
+	err = sink.Run(ctx)
+*/
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hocdb"
+	"math"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// MessageReader is the part of *kafkago.Reader a Sink uses. The reader must belong
+// to a consumer group for commits to be kept.
+type MessageReader interface {
+	FetchMessage(ctx context.Context) (kafkago.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafkago.Message) error
+}
+
+// Config configures a Sink
+type Config struct {
+	// Schema of the tickers, created on their first message
+	Schema []hocdb.Field
+	// Codec decodes message values, defaults to JSONCodec
+	Codec Codec
+	// Ticker returns the ticker of a message, defaults to its key, or its topic for
+	// messages without one
+	Ticker func(msg kafkago.Message) string
+	// BatchSize is the number of messages after which the tickers are flushed and
+	// the offsets committed, defaults to 1000
+	BatchSize int
+	// FlushInterval bounds the time a message waits for its batch to be flushed,
+	// defaults to one second
+	FlushInterval time.Duration
+	// OnError is called with the messages that fail to decode or append, which are
+	// then skipped and committed with the others. When nil, such a message stops
+	// Run, which returns the error without committing it.
+	OnError func(msg kafkago.Message, err error)
+}
+
+// Sink appends the messages of a reader to the tickers of a catalog. It is not
+// safe for concurrent use.
+type Sink struct {
+	reader  MessageReader
+	catalog *hocdb.Catalog
+	config  Config
+
+	resume   map[string]int64              // Newest timestamp of each ticker when first used
+	dirty    map[string]bool               // Tickers appended to since the last flush
+	offsets  map[partition]kafkago.Message // Last message of each partition in the batch
+	batched  int
+	deadline time.Time // When the batch is flushed at the latest
+}
+
+type partition struct {
+	topic string
+	id    int
+}
+
+// NewSink returns a sink of the messages of reader into the tickers of catalog
+func NewSink(reader MessageReader, catalog *hocdb.Catalog, config Config) (*Sink, error) {
+	if hocdb.RecordSize(config.Schema) == 0 {
+		return nil, errors.New("sink needs a schema")
+	}
+	if config.Codec == nil {
+		config.Codec = JSONCodec{}
+	}
+	if config.Ticker == nil {
+		config.Ticker = keyTicker
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 1000
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	return &Sink{
+		reader:  reader,
+		catalog: catalog,
+		config:  config,
+		resume:  make(map[string]int64),
+		dirty:   make(map[string]bool),
+		offsets: make(map[partition]kafkago.Message),
+	}, nil
+}
+
+// keyTicker is the default Config.Ticker
+func keyTicker(msg kafkago.Message) string {
+	if len(msg.Key) == 0 {
+		return msg.Topic
+	}
+	return string(msg.Key)
+}
+
+// Run appends messages until ctx is done or an error stops it. The messages
+// appended before it returns are flushed and committed.
+func (s *Sink) Run(ctx context.Context) error {
+	for {
+		fetchCtx, cancel := ctx, context.CancelFunc(func() {})
+		if s.batched > 0 {
+			fetchCtx, cancel = context.WithDeadline(ctx, s.deadline)
+		}
+		msg, err := s.reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				if err := s.commit(ctx); err != nil {
+					return err
+				}
+				continue
+			}
+			return s.stop(ctx, err)
+		}
+
+		if err := s.handle(msg); err != nil {
+			return s.stop(ctx, err)
+		}
+		if s.batched == 0 {
+			s.deadline = time.Now().Add(s.config.FlushInterval)
+		}
+		s.offsets[partition{msg.Topic, msg.Partition}] = msg
+		s.batched++
+		if s.batched >= s.config.BatchSize {
+			if err := s.commit(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// stop commits the batch before Run returns err, even once ctx is done
+func (s *Sink) stop(ctx context.Context, err error) error {
+	if commitErr := s.commit(context.WithoutCancel(ctx)); commitErr != nil {
+		return errors.Join(err, commitErr)
+	}
+	return err
+}
+
+// handle appends the record of a message, or hands its error to OnError
+func (s *Sink) handle(msg kafkago.Message) error {
+	ticker := s.config.Ticker(msg)
+	values, err := s.config.Codec.Decode(s.config.Schema, msg.Value)
+	if err == nil {
+		err = s.append(ticker, values)
+	}
+	if err != nil {
+		if s.config.OnError == nil {
+			return fmt.Errorf("message at offset %d of %s/%d: %w", msg.Offset, msg.Topic, msg.Partition, err)
+		}
+		s.config.OnError(msg, err)
+	}
+	return nil
+}
+
+// append appends a record to a ticker, skipping the records it already stored
+// before the last commit
+func (s *Sink) append(ticker string, values []interface{}) error {
+	resume, ok := s.resume[ticker]
+	if !ok {
+		if err := s.catalog.Create(ticker, s.config.Schema); err != nil {
+			return err
+		}
+		resume = math.MinInt64
+		err := s.catalog.Do(ticker, func(db *hocdb.DB) error {
+			info, err := db.Info()
+			if err == nil && info.Records > 0 {
+				resume = info.Newest
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		s.resume[ticker] = resume
+	}
+
+	err := s.catalog.AppendValues(ticker, values...)
+	var order *hocdb.TimestampOrderError
+	if errors.As(err, &order) && order.Timestamp <= resume {
+		// Delivered again after a crash between the flush and the commit
+		return nil
+	}
+	if err == nil {
+		s.dirty[ticker] = true
+	}
+	return err
+}
+
+// commit flushes the tickers of the batch, then commits its offsets
+func (s *Sink) commit(ctx context.Context) error {
+	for ticker := range s.dirty {
+		err := s.catalog.Do(ticker, func(db *hocdb.DB) error {
+			return db.Flush()
+		})
+		if err != nil {
+			return fmt.Errorf("failed to flush %s: %w", ticker, err)
+		}
+		delete(s.dirty, ticker)
+	}
+	if len(s.offsets) == 0 {
+		return nil
+	}
+	msgs := make([]kafkago.Message, 0, len(s.offsets))
+	for _, msg := range s.offsets {
+		msgs = append(msgs, msg)
+	}
+	if err := s.reader.CommitMessages(ctx, msgs...); err != nil {
+		return fmt.Errorf("failed to commit offsets: %w", err)
+	}
+	clear(s.offsets)
+	s.batched = 0
+	return nil
+}
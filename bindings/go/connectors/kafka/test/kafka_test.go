@@ -0,0 +1,240 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hocdb"
+	"hocdb/connectors/kafka"
+	"math/big"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+var schema = []hocdb.Field{
+	{Name: "timestamp", Type: hocdb.TypeI64},
+	{Name: "price", Type: hocdb.TypeF64},
+}
+
+// fakeReader hands out messages, then waits for ctx, cancelling it first when
+// cancel is set
+type fakeReader struct {
+	msgs    []kafkago.Message
+	commits [][]kafkago.Message
+	cancel  context.CancelFunc
+	flushed func() // Called on commits, to check what was flushed
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafkago.Message, error) {
+	if len(r.msgs) > 0 {
+		msg := r.msgs[0]
+		r.msgs = r.msgs[1:]
+		return msg, nil
+	}
+	if r.cancel != nil {
+		r.cancel()
+	}
+	<-ctx.Done()
+	return kafkago.Message{}, ctx.Err()
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	if r.flushed != nil {
+		r.flushed()
+	}
+	r.commits = append(r.commits, msgs)
+	return nil
+}
+
+func message(offset int64, key string, ts int64) kafkago.Message {
+	return kafkago.Message{
+		Topic:  "trades",
+		Offset: offset,
+		Key:    []byte(key),
+		Value:  []byte(fmt.Sprintf(`{"timestamp":%d,"price":%d.5}`, ts, ts)),
+	}
+}
+
+func run(t *testing.T, catalog *hocdb.Catalog, r *fakeReader, config kafka.Config) error {
+	t.Helper()
+	sink, err := kafka.NewSink(r, catalog, config)
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if r.cancel == nil {
+		r.cancel = cancel
+	}
+	return sink.Run(ctx)
+}
+
+func TestSink(t *testing.T) {
+	testDir := "../../../../../b_go_test_data_kafka"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	catalog, err := hocdb.OpenCatalog(testDir, hocdb.Options{}, 4)
+	if err != nil {
+		t.Fatalf("Failed to open catalog: %v", err)
+	}
+	defer catalog.Close()
+
+	msgs := []kafkago.Message{
+		message(0, "BTC", 1), message(1, "ETH", 1), message(2, "BTC", 2),
+		message(3, "ETH", 2), message(4, "BTC", 3),
+	}
+	r := &fakeReader{msgs: msgs}
+	r.flushed = func() {
+		// Committed records are on disk for other readers
+		ro, err := hocdb.OpenReadOnly("BTC", testDir, schema)
+		if err != nil {
+			t.Fatalf("Failed to open read-only: %v", err)
+		}
+		defer ro.Close()
+		data, _ := ro.Load()
+		if want := []int{1, 2, 3}[len(r.commits)]; len(data) != want*16 {
+			t.Errorf("Expected %d BTC records flushed at commit %d, got %d bytes", want, len(r.commits), len(data))
+		}
+	}
+	if err := run(t, catalog, r, kafka.Config{Schema: schema, BatchSize: 2}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected Run to stop with the context, got %v", err)
+	}
+	if len(r.commits) != 3 || r.commits[2][0].Offset != 4 {
+		t.Fatalf("Expected 3 commits ending at offset 4, got %v", r.commits)
+	}
+
+	// Delivered again after a crash before the last commit, then a new message
+	r = &fakeReader{msgs: append(msgs[2:], message(5, "BTC", 4))}
+	if err := run(t, catalog, r, kafka.Config{Schema: schema}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected Run to stop with the context, got %v", err)
+	}
+	for ticker, want := range map[string][]int64{"BTC": {1, 2, 3, 4}, "ETH": {1, 2}} {
+		data, err := catalog.Query(ticker, 0, 100, nil)
+		if err != nil {
+			t.Fatalf("Failed to query %s: %v", ticker, err)
+		}
+		records, _ := hocdb.DecodeRecords(schema, data)
+		var got []int64
+		for _, record := range records {
+			got = append(got, record.Timestamp())
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %s timestamps %v, got %v", ticker, want, got)
+		}
+	}
+
+	// Bad messages go to OnError, or stop Run without being committed
+	bad := []kafkago.Message{message(6, "BTC", 5), {Topic: "trades", Offset: 7, Key: []byte("BTC"), Value: []byte("{")}}
+	var failed []int64
+	r = &fakeReader{msgs: bad}
+	err = run(t, catalog, r, kafka.Config{Schema: schema, OnError: func(msg kafkago.Message, err error) {
+		failed = append(failed, msg.Offset)
+	}})
+	if !errors.Is(err, context.Canceled) || !reflect.DeepEqual(failed, []int64{7}) {
+		t.Errorf("Expected offset 7 to fail, got %v, %v", failed, err)
+	}
+	if n := len(r.commits); n != 1 || r.commits[0][0].Offset != 7 {
+		t.Errorf("Expected the failed message to be committed, got %v", r.commits)
+	}
+	r = &fakeReader{msgs: []kafkago.Message{message(8, "BTC", 6), bad[1]}}
+	if err := run(t, catalog, r, kafka.Config{Schema: schema}); err == nil || errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the bad message to stop Run, got %v", err)
+	}
+	if n := len(r.commits); n != 1 || r.commits[0][0].Offset != 8 {
+		t.Errorf("Expected only the message before the bad one committed, got %v", r.commits)
+	}
+}
+
+func TestSinkFlushInterval(t *testing.T) {
+	testDir := "../../../../../b_go_test_data_kafka_interval"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	catalog, err := hocdb.OpenCatalog(testDir, hocdb.Options{}, 4)
+	if err != nil {
+		t.Fatalf("Failed to open catalog: %v", err)
+	}
+	defer catalog.Close()
+
+	// The batch isn't full, so only the interval commits it
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &fakeReader{msgs: []kafkago.Message{message(0, "", 1)}, cancel: func() {}}
+	r.flushed = cancel
+	sink, err := kafka.NewSink(r, catalog, kafka.Config{Schema: schema, FlushInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+	if err := sink.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected Run to stop with the context, got %v", err)
+	}
+	if len(r.commits) != 1 {
+		t.Errorf("Expected 1 commit, got %d", len(r.commits))
+	}
+	if data, err := catalog.Query("trades", 0, 10, nil); err != nil || len(data) != 16 {
+		t.Errorf("Expected the keyless message in the topic's ticker, got %d bytes, %v", len(data), err)
+	}
+}
+
+func TestAvroCodec(t *testing.T) {
+	avroSchema := `{"type": "record", "name": "Trade", "fields": [
+		{"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "price", "type": {"type": "bytes", "logicalType": "decimal", "precision": 18, "scale": 2}},
+		{"name": "side", "type": "string"},
+		{"name": "size", "type": "int"},
+		{"name": "bid", "type": ["null", "double"]},
+		{"name": "extra", "type": "string"}
+	]}`
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.DecimalType(2)},
+		{Name: "side", Type: hocdb.StringType(8)},
+		{Name: "size", Type: hocdb.TypeF64},
+		{Name: "bid", Type: hocdb.TypeF64, Nullable: true},
+	}
+	codec, err := goavro.NewCodec(avroSchema)
+	if err != nil {
+		t.Fatalf("Failed to create Avro codec: %v", err)
+	}
+	ts := time.UnixMilli(1700000000123).UTC()
+	datum, err := codec.BinaryFromNative([]byte{0, 0, 0, 0, 42}, map[string]interface{}{
+		"timestamp": ts,
+		"price":     big.NewRat(10050, 100),
+		"side":      "buy",
+		"size":      int32(3),
+		"bid":       goavro.Union("double", 99.5),
+		"extra":     "ignored",
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	c, err := kafka.NewConfluentAvroCodec(avroSchema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	values, err := c.Decode(schema, datum)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	want := []interface{}{ts, hocdb.Decimal{Unscaled: 10050, Scale: 2}, "buy", 3.0, 99.5}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("Expected %v, got %v", want, values)
+	}
+
+	plain, _ := kafka.NewAvroCodec(avroSchema)
+	if _, err := plain.Decode(schema, datum); err == nil {
+		t.Errorf("Expected the framed message to fail without the Confluent header")
+	}
+	if _, err := c.Decode(schema, datum[5:]); err == nil {
+		t.Errorf("Expected a message without the header to fail")
+	}
+	if _, err := kafka.NewAvroCodec(`{"type": "nope"}`); err == nil {
+		t.Errorf("Expected an invalid Avro schema to fail")
+	}
+}
@@ -0,0 +1,319 @@
+/*
+Package mqtt appends the JSON messages of MQTT topics to HOCDB databases, making
+HOCDB a historian for fleets of sensors publishing to a broker.
+
+A Bridge subscribes to topic filters with a connected client of
+github.com/eclipse/paho.mqtt.golang and appends each message to the database of
+the ticker of its topic in a hocdb.Catalog, by default the topic with its slashes
+replaced by underscores. Schema fields are read from the keys of the payload
+named after them, or from those Config.Fields maps them to, nested ones included.
+Messages without a timestamp are stamped with the time they arrived.
+
+It lives in its own module so that the core hocdb bindings stay free of third-party
+dependencies.
+
+Example usage:
+
+	client := paho.NewClient(paho.NewClientOptions().AddBroker("tcp://localhost:1883"))
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	catalog, err := hocdb.OpenCatalog("./data", hocdb.Options{}, 256)
+	bridge, err := mqtt.NewBridge(client, catalog, mqtt.Config{
+		Schema: schema,
+		Topics: []string{"sensors/+/climate"},
+		Fields: map[string]string{"temperature": "readings.temp"},
+	})
+	err = bridge.Start()
+	defer bridge.Close()
+*/
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hocdb"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Config configures a Bridge
+type Config struct {
+	// Schema of the tickers, created on their first message
+	Schema []hocdb.Field
+	// Topics are the topic filters to subscribe to, with the + and # wildcards
+	Topics []string
+	// QoS is the quality of service of the subscriptions, 0 to 2
+	QoS byte
+	// Ticker returns the ticker of a topic, by default the topic with its slashes
+	// replaced by underscores, sensors_a_climate for sensors/a/climate
+	Ticker func(topic string) string
+	// Fields maps schema fields to the payload keys holding them, with dots for the
+	// keys of nested objects, such as readings.temp. Fields without an entry are
+	// read from the key of their name.
+	Fields map[string]string
+	// FlushInterval is the time between flushes of the tickers appended to, which
+	// bounds the records lost in a crash. Defaults to one second.
+	FlushInterval time.Duration
+	// OnError is called with the errors of messages, as *MessageError, which are
+	// then dropped, and of flushes. When nil, they are logged with slog.Default.
+	OnError func(err error)
+}
+
+// MessageError is the error of a message the bridge couldn't append
+type MessageError struct {
+	Topic   string
+	Payload []byte
+	Err     error
+}
+
+func (e *MessageError) Error() string {
+	return fmt.Sprintf("message on %s: %v", e.Topic, e.Err)
+}
+
+func (e *MessageError) Unwrap() error {
+	return e.Err
+}
+
+// Bridge appends the messages of MQTT subscriptions to the tickers of a catalog.
+// It is safe for concurrent use.
+type Bridge struct {
+	client  paho.Client
+	catalog *hocdb.Catalog
+	config  Config
+	decode  []hocdb.Field // Schema with a nullable timestamp
+	tsIndex int
+
+	mu      sync.Mutex
+	created map[string]bool // Tickers created by the bridge
+	dirty   map[string]bool // Tickers appended to since the last flush
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewBridge returns a bridge of the messages of the subscriptions of client, which
+// Start makes, into the tickers of catalog
+func NewBridge(client paho.Client, catalog *hocdb.Catalog, config Config) (*Bridge, error) {
+	if hocdb.RecordSize(config.Schema) == 0 {
+		return nil, errors.New("bridge needs a schema")
+	}
+	if len(config.Topics) == 0 {
+		return nil, errors.New("bridge needs topics to subscribe to")
+	}
+	if config.QoS > 2 {
+		return nil, fmt.Errorf("invalid QoS %d", config.QoS)
+	}
+	b := &Bridge{
+		client:  client,
+		catalog: catalog,
+		decode:  append([]hocdb.Field(nil), config.Schema...),
+		tsIndex: -1,
+		created: make(map[string]bool),
+		dirty:   make(map[string]bool),
+	}
+	for i, field := range config.Schema {
+		if field.Name == "timestamp" {
+			b.tsIndex = i
+			b.decode[i].Nullable = true
+		}
+	}
+	if b.tsIndex < 0 {
+		return nil, errors.New("schema has no timestamp field")
+	}
+	for name := range config.Fields {
+		if _, ok := fieldIndex(config.Schema, name); !ok {
+			return nil, fmt.Errorf("mapping of unknown field %s", name)
+		}
+	}
+
+	if config.Ticker == nil {
+		config.Ticker = func(topic string) string { return strings.ReplaceAll(topic, "/", "_") }
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	if config.OnError == nil {
+		config.OnError = func(err error) { slog.Default().Error("mqtt bridge", "error", err) }
+	}
+	b.config = config
+	return b, nil
+}
+
+func fieldIndex(schema []hocdb.Field, name string) (int, bool) {
+	for i, field := range schema {
+		if field.Name == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Start subscribes to the topics and starts flushing. The client must be connected.
+func (b *Bridge) Start() error {
+	b.mu.Lock()
+	if b.stop != nil {
+		b.mu.Unlock()
+		return errors.New("bridge is already started")
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	b.stop, b.done = stop, done
+	// Not held while subscribing, as retained messages may arrive meanwhile
+	b.mu.Unlock()
+
+	filters := make(map[string]byte, len(b.config.Topics))
+	for _, topic := range b.config.Topics {
+		filters[topic] = b.config.QoS
+	}
+	token := b.client.SubscribeMultiple(filters, func(_ paho.Client, msg paho.Message) {
+		if err := b.Ingest(msg.Topic(), msg.Payload()); err != nil {
+			b.config.OnError(&MessageError{Topic: msg.Topic(), Payload: msg.Payload(), Err: err})
+		}
+	})
+	if token.Wait(); token.Error() != nil {
+		b.mu.Lock()
+		b.stop = nil
+		b.mu.Unlock()
+		return fmt.Errorf("failed to subscribe: %w", token.Error())
+	}
+	go b.flushLoop(stop, done)
+	return nil
+}
+
+func (b *Bridge) flushLoop(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(b.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := b.Flush(); err != nil {
+				b.config.OnError(err)
+			}
+		}
+	}
+}
+
+// Close unsubscribes from the topics and flushes the tickers. The client stays
+// connected.
+func (b *Bridge) Close() error {
+	b.mu.Lock()
+	stop, done := b.stop, b.done
+	b.stop = nil
+	b.mu.Unlock()
+	if stop == nil {
+		return b.Flush()
+	}
+
+	close(stop)
+	<-done
+	var err error
+	token := b.client.Unsubscribe(b.config.Topics...)
+	if token.Wait(); token.Error() != nil {
+		err = fmt.Errorf("failed to unsubscribe: %w", token.Error())
+	}
+	return errors.Join(err, b.Flush())
+}
+
+// Ingest appends a message received on topic. The bridge's subscriptions call it,
+// and so can those of other clients.
+func (b *Bridge) Ingest(topic string, payload []byte) error {
+	received := time.Now()
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &obj); err != nil {
+		return err
+	}
+
+	// The object of the schema fields, for ParseJSONRecord
+	fields := make(map[string]json.RawMessage, len(b.config.Schema))
+	for _, field := range b.config.Schema {
+		key, ok := b.config.Fields[field.Name]
+		if !ok {
+			key = field.Name
+		}
+		if raw, ok := lookup(obj, key); ok {
+			fields[field.Name] = raw
+		}
+	}
+	var ts interface{} = received
+	if raw := fields["timestamp"]; len(raw) > 0 && raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return fmt.Errorf("field timestamp: %w", err)
+		}
+		t, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return fmt.Errorf("field timestamp: %w", err)
+		}
+		ts = t
+		delete(fields, "timestamp")
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	values, err := hocdb.ParseJSONRecord(b.decode, data)
+	if err != nil {
+		return err
+	}
+	if values[b.tsIndex] == nil {
+		values[b.tsIndex] = ts
+	}
+
+	ticker := b.config.Ticker(topic)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.created[ticker] {
+		if err := b.catalog.Create(ticker, b.config.Schema); err != nil {
+			return err
+		}
+		b.created[ticker] = true
+	}
+	if err := b.catalog.AppendValues(ticker, values...); err != nil {
+		return err
+	}
+	b.dirty[ticker] = true
+	return nil
+}
+
+// lookup returns the value of a key of obj, with dots separating the keys of
+// nested objects unless obj has the whole key
+func lookup(obj map[string]json.RawMessage, key string) (json.RawMessage, bool) {
+	for {
+		if raw, ok := obj[key]; ok {
+			return raw, true
+		}
+		name, rest, nested := strings.Cut(key, ".")
+		raw, ok := obj[name]
+		if !ok || !nested {
+			return nil, false
+		}
+		obj = nil
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, false
+		}
+		key = rest
+	}
+}
+
+// Flush flushes the tickers appended to since the last flush
+func (b *Bridge) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ticker := range b.dirty {
+		err := b.catalog.Do(ticker, func(db *hocdb.DB) error {
+			return db.Flush()
+		})
+		if err != nil {
+			return fmt.Errorf("failed to flush %s: %w", ticker, err)
+		}
+		delete(b.dirty, ticker)
+	}
+	return nil
+}
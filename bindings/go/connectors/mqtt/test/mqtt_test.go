@@ -0,0 +1,162 @@
+package mqtt_test
+
+import (
+	"errors"
+	"hocdb"
+	"hocdb/connectors/mqtt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+)
+
+// broker runs a broker publishing for the test, and returns a client connected
+// to it
+func broker(t *testing.T) (*mochi.Server, paho.Client) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a port: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	srv := mochi.New(&mochi.Options{InlineClient: true, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	srv.AddHook(new(auth.AllowHook), nil)
+	if err := srv.AddListener(listeners.NewTCP(listeners.Config{ID: "tcp", Address: addr})); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	if err := srv.Serve(); err != nil {
+		t.Fatalf("Failed to serve: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	client := paho.NewClient(paho.NewClientOptions().AddBroker("tcp://" + addr).SetClientID("hocdb"))
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatalf("Failed to connect: %v", token.Error())
+	}
+	t.Cleanup(func() { client.Disconnect(0) })
+	return srv, client
+}
+
+func TestBridge(t *testing.T) {
+	testDir := "../../../../../b_go_test_data_mqtt"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "temperature", Type: hocdb.TypeF64},
+		{Name: "humidity", Type: hocdb.TypeF64, Nullable: true},
+	}
+	catalog, err := hocdb.OpenCatalog(testDir, hocdb.Options{}, 4)
+	if err != nil {
+		t.Fatalf("Failed to open catalog: %v", err)
+	}
+	defer catalog.Close()
+	srv, client := broker(t)
+
+	config := mqtt.Config{
+		Schema:        schema,
+		Topics:        []string{"sensors/+/climate"},
+		Fields:        map[string]string{"temperature": "readings.temp"},
+		FlushInterval: 10 * time.Millisecond,
+	}
+	config.Fields["pressure"] = "p"
+	if _, err := mqtt.NewBridge(client, catalog, config); err == nil {
+		t.Errorf("Expected a mapping of an unknown field to fail")
+	}
+	delete(config.Fields, "pressure")
+	errs := make(chan error, 10)
+	config.OnError = func(err error) { errs <- err }
+	bridge, err := mqtt.NewBridge(client, catalog, config)
+	if err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+	if err := bridge.Start(); err != nil {
+		t.Fatalf("Failed to start bridge: %v", err)
+	}
+	defer bridge.Close()
+
+	start := time.Now()
+	for _, msg := range []struct{ topic, payload string }{
+		{"sensors/a/climate", `{"timestamp": 1, "readings": {"temp": 21.5}, "humidity": 40}`},
+		{"sensors/a/climate", `{"timestamp": "1970-01-01T00:00:00.000000002Z", "readings": {"temp": 22}}`},
+		{"sensors/b/climate", `{"readings": {"temp": 19}, "battery": 80}`},
+		{"sensors/b/climate", `off`},
+		{"sensors/c/power", `{"timestamp": 1, "readings": {"temp": 0}}`},
+	} {
+		if err := srv.Publish(msg.topic, []byte(msg.payload), false, 0); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+
+	var msgErr *mqtt.MessageError
+	select {
+	case err := <-errs:
+		if !errors.As(err, &msgErr) || msgErr.Topic != "sensors/b/climate" || string(msgErr.Payload) != "off" {
+			t.Errorf("Expected the error of the message that isn't JSON, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the message that isn't JSON to fail")
+	}
+
+	// The records are flushed for other readers
+	load := func(ticker string, n int) []hocdb.Record {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			ro, err := hocdb.OpenReadOnly(ticker, testDir, schema)
+			if err == nil {
+				data, _ := ro.Load()
+				ro.Close()
+				if len(data) >= n*hocdb.RecordSize(schema) {
+					records, _ := hocdb.DecodeRecords(schema, data)
+					return records
+				}
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected records of %s to be flushed: %v", ticker, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	a := load("sensors_a_climate", 2)
+	want := [][]interface{}{{int64(1), 21.5, 40.0}, {int64(2), 22.0, nil}}
+	if len(a) != 2 || !reflect.DeepEqual(a[0].Values, want[0]) || !reflect.DeepEqual(a[1].Values, want[1]) {
+		t.Errorf("Expected %v, got %v", want, a)
+	}
+	b := load("sensors_b_climate", 1)
+	if len(b) != 1 || b[0].Values[1] != 19.0 {
+		t.Fatalf("Expected one record of 19 degrees, got %v", b)
+	}
+	if ts := time.Unix(0, b[0].Timestamp()); ts.Before(start) || ts.After(time.Now()) {
+		t.Errorf("Expected the message without a timestamp stamped on arrival, got %v", ts)
+	}
+	if tickers, _ := catalog.Tickers(); len(tickers) != 2 {
+		t.Errorf("Expected the tickers of the subscribed topics only, got %v", tickers)
+	}
+
+	// Other clients' messages can be handed to the bridge directly
+	if err := bridge.Ingest("sensors/a/climate", []byte(`{"timestamp": 3, "readings": {"temp": "warm"}}`)); err == nil {
+		t.Errorf("Expected a temperature that isn't a number to fail")
+	}
+	if err := bridge.Ingest("sensors/a/climate", []byte(`{"timestamp": 3, "readings": {"temp": null}}`)); err != nil {
+		t.Errorf("Failed to ingest: %v", err)
+	}
+	if err := bridge.Close(); err != nil {
+		t.Fatalf("Failed to close bridge: %v", err)
+	}
+	if a := load("sensors_a_climate", 3); len(a) != 3 || !math.IsNaN(a[2].Values[1].(float64)) {
+		t.Errorf("Expected a third record with a NaN temperature, got %v", a)
+	}
+}
@@ -0,0 +1,275 @@
+/*
+Package nats appends the messages of NATS JetStream subjects to HOCDB databases.
+
+A Bridge pulls messages from a JetStream consumer, decodes them, by default as JSON
+objects keyed by field name, and appends them to the database of a ticker chosen
+per message, by default its subject, in a hocdb.Catalog. Messages are acknowledged
+only after their records are flushed, so delivery is at least once: a message
+that wasn't acknowledged before a crash, or in time, is delivered again. Such
+redeliveries are recognized and skipped, by timestamp, or by stream sequence when
+the schema holds it.
+
+It lives in its own module so that the core hocdb bindings stay free of third-party
+dependencies.
+
+Example usage:
+
+	nc, err := natsgo.Connect(natsgo.DefaultURL)
+	js, err := jetstream.New(nc)
+	consumer, err := js.CreateOrUpdateConsumer(ctx, "TRADES", jetstream.ConsumerConfig{
+		Durable:   "hocdb",
+		AckPolicy: jetstream.AckExplicitPolicy,
+	})
+	catalog, err := hocdb.OpenCatalog("./data", hocdb.Options{}, 64)
+	bridge, err := nats.NewBridge(consumer, catalog, nats.Config{Schema: schema})
+	err = bridge.Run(ctx)
+*/
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hocdb"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Config configures a Bridge
+type Config struct {
+	// Schema of the tickers, created on their first message
+	Schema []hocdb.Field
+	// Decode decodes the data of a message into values in schema order, defaults to
+	// hocdb.ParseJSONRecord
+	Decode func(schema []hocdb.Field, data []byte) ([]interface{}, error)
+	// Ticker returns the ticker of a message, defaults to its subject
+	Ticker func(msg jetstream.Msg) string
+	// StreamTime stamps records with the time the stream stored their message,
+	// instead of a timestamp decoded from it, which may then be left out
+	StreamTime bool
+	// SequenceField names a u64 field of Schema holding the stream sequence of the
+	// message of each record, filled in by the bridge. Redeliveries are then
+	// recognized by sequence, including by a new consumer replaying the stream.
+	SequenceField string
+	// BatchSize is the number of messages fetched at a time, defaults to 100
+	BatchSize int
+	// FlushInterval bounds the time a fetch waits for a full batch before its
+	// messages are flushed and acknowledged, and the time Run takes to return once
+	// ctx is done. Defaults to one second.
+	FlushInterval time.Duration
+	// OnError is called with the messages that fail to decode or append, which are
+	// then terminated so that they aren't delivered again. When nil, such a message
+	// stops Run, which returns the error without acknowledging it.
+	OnError func(msg jetstream.Msg, err error)
+}
+
+// Bridge appends the messages of a JetStream consumer to the tickers of a
+// catalog. It is not safe for concurrent use.
+type Bridge struct {
+	consumer jetstream.Consumer
+	catalog  *hocdb.Catalog
+	config   Config
+	decode   []hocdb.Field // Schema with the fields the bridge fills in nullable
+	tsIndex  int
+	seqIndex int // -1 without SequenceField
+
+	tickers map[string]*ticker
+	pending []jetstream.Msg // Messages to acknowledge once flushed
+}
+
+// ticker is what a bridge knows of the database of a ticker
+type ticker struct {
+	sequence uint64 // Newest stream sequence stored, with SequenceField
+	dirty    bool   // Appended to since the last flush
+}
+
+// NewBridge returns a bridge of the messages of consumer into the tickers of
+// catalog. The consumer should acknowledge messages explicitly.
+func NewBridge(consumer jetstream.Consumer, catalog *hocdb.Catalog, config Config) (*Bridge, error) {
+	if hocdb.RecordSize(config.Schema) == 0 {
+		return nil, errors.New("bridge needs a schema")
+	}
+	b := &Bridge{
+		consumer: consumer,
+		catalog:  catalog,
+		decode:   append([]hocdb.Field(nil), config.Schema...),
+		tsIndex:  -1,
+		seqIndex: -1,
+		tickers:  make(map[string]*ticker),
+	}
+	for i, field := range config.Schema {
+		switch field.Name {
+		case "timestamp":
+			b.tsIndex = i
+			b.decode[i].Nullable = b.decode[i].Nullable || config.StreamTime
+		case config.SequenceField:
+			if field.Type != hocdb.TypeU64 {
+				return nil, fmt.Errorf("sequence field %s isn't u64", field.Name)
+			}
+			b.seqIndex = i
+			b.decode[i].Nullable = true
+		}
+	}
+	if b.tsIndex < 0 {
+		return nil, errors.New("schema has no timestamp field")
+	}
+	if config.SequenceField != "" && b.seqIndex < 0 {
+		return nil, fmt.Errorf("unknown sequence field %s", config.SequenceField)
+	}
+
+	if config.Decode == nil {
+		config.Decode = hocdb.ParseJSONRecord
+	}
+	if config.Ticker == nil {
+		config.Ticker = func(msg jetstream.Msg) string { return msg.Subject() }
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	b.config = config
+	return b, nil
+}
+
+// Run appends messages until ctx is done or an error stops it. The messages
+// appended before it returns are flushed and acknowledged.
+func (b *Bridge) Run(ctx context.Context) error {
+	for ctx.Err() == nil {
+		batch, err := b.consumer.Fetch(b.config.BatchSize, jetstream.FetchMaxWait(b.config.FlushInterval))
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to fetch: %w", err), b.ack())
+		}
+		// Messages left in a batch when Run stops are delivered again
+		for msg := range batch.Messages() {
+			if err := b.handle(msg); err != nil {
+				return errors.Join(err, b.ack())
+			}
+		}
+		if err := batch.Error(); err != nil {
+			return errors.Join(fmt.Errorf("failed to fetch: %w", err), b.ack())
+		}
+		if err := b.ack(); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// handle appends the record of a message, or hands its error to OnError
+func (b *Bridge) handle(msg jetstream.Msg) error {
+	meta, err := msg.Metadata()
+	if err != nil {
+		return fmt.Errorf("message on %s: %w", msg.Subject(), err)
+	}
+	err = b.append(msg, meta)
+	if err == nil {
+		b.pending = append(b.pending, msg)
+		return nil
+	}
+	if b.config.OnError == nil {
+		return fmt.Errorf("message %d of stream %s: %w", meta.Sequence.Stream, meta.Stream, err)
+	}
+	b.config.OnError(msg, err)
+	if err := msg.Term(); err != nil {
+		return fmt.Errorf("failed to terminate message %d: %w", meta.Sequence.Stream, err)
+	}
+	return nil
+}
+
+// append appends the record of a message to its ticker, unless it is a
+// redelivery of a stored one
+func (b *Bridge) append(msg jetstream.Msg, meta *jetstream.MsgMetadata) error {
+	values, err := b.config.Decode(b.decode, msg.Data())
+	if err != nil {
+		return err
+	}
+	if b.config.StreamTime {
+		values[b.tsIndex] = meta.Timestamp
+	}
+	if b.seqIndex >= 0 {
+		values[b.seqIndex] = meta.Sequence.Stream
+	}
+
+	name := b.config.Ticker(msg)
+	t, err := b.ticker(name)
+	if err != nil {
+		return err
+	}
+	if b.seqIndex >= 0 && meta.Sequence.Stream <= t.sequence {
+		return nil
+	}
+	err = b.catalog.AppendValues(name, values...)
+	var order *hocdb.TimestampOrderError
+	if b.seqIndex < 0 && meta.NumDelivered > 1 && errors.As(err, &order) {
+		// Stored before a crash or a late acknowledgement
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	t.sequence = meta.Sequence.Stream
+	t.dirty = true
+	return nil
+}
+
+// ticker returns the state of a ticker, creating its database on first use
+func (b *Bridge) ticker(name string) (*ticker, error) {
+	if t, ok := b.tickers[name]; ok {
+		return t, nil
+	}
+	if err := b.catalog.Create(name, b.config.Schema); err != nil {
+		return nil, err
+	}
+	t := &ticker{}
+	if b.seqIndex >= 0 {
+		// The sequence of the newest record
+		err := b.catalog.Do(name, func(db *hocdb.DB) error {
+			info, err := db.Info()
+			if err != nil || info.Records == 0 {
+				return err
+			}
+			data, err := db.Query(info.Newest, info.Newest+1, nil)
+			if err != nil || len(data) == 0 {
+				return err
+			}
+			values, err := hocdb.DecodeRecord(b.config.Schema, data[len(data)-hocdb.RecordSize(b.config.Schema):])
+			if err != nil {
+				return err
+			}
+			t.sequence, _ = values[b.seqIndex].(uint64)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	b.tickers[name] = t
+	return t, nil
+}
+
+// ack flushes the tickers appended to, then acknowledges the pending messages
+func (b *Bridge) ack() error {
+	for name, t := range b.tickers {
+		if !t.dirty {
+			continue
+		}
+		err := b.catalog.Do(name, func(db *hocdb.DB) error {
+			return db.Flush()
+		})
+		if err != nil {
+			return fmt.Errorf("failed to flush %s: %w", name, err)
+		}
+		t.dirty = false
+	}
+	for i, msg := range b.pending {
+		if err := msg.Ack(); err != nil {
+			b.pending = b.pending[i:]
+			return fmt.Errorf("failed to acknowledge: %w", err)
+		}
+	}
+	b.pending = b.pending[:0]
+	return nil
+}
@@ -0,0 +1,219 @@
+package nats_test
+
+import (
+	"context"
+	"fmt"
+	"hocdb"
+	"hocdb/connectors/nats"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// jetStream runs a JetStream server with a TRADES stream on trades.>
+func jetStream(t *testing.T) jetstream.JetStream {
+	t.Helper()
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opts)
+	t.Cleanup(srv.Shutdown)
+
+	nc, err := natsgo.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(nc.Close)
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Failed to create JetStream context: %v", err)
+	}
+	if _, err := js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "TRADES", Subjects: []string{"trades.>"}}); err != nil {
+		t.Fatalf("Failed to create stream: %v", err)
+	}
+	return js
+}
+
+func publish(t *testing.T, js jetstream.JetStream, subject, data string) {
+	t.Helper()
+	if _, err := js.Publish(context.Background(), subject, []byte(data)); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+}
+
+func consumer(t *testing.T, js jetstream.JetStream, name string) jetstream.Consumer {
+	t.Helper()
+	c, err := js.CreateOrUpdateConsumer(context.Background(), "TRADES", jetstream.ConsumerConfig{
+		Durable:   name,
+		AckPolicy: jetstream.AckExplicitPolicy,
+		AckWait:   100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create consumer: %v", err)
+	}
+	return c
+}
+
+// drain runs a bridge until the consumer has nothing left to deliver or acknowledge
+func drain(t *testing.T, c jetstream.Consumer, catalog *hocdb.Catalog, config nats.Config) {
+	t.Helper()
+	config.FlushInterval = 20 * time.Millisecond
+	bridge, err := nats.NewBridge(c, catalog, config)
+	if err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- bridge.Run(ctx) }()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		info, err := c.Info(context.Background())
+		if err == nil && info.NumPending == 0 && info.NumAckPending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the consumer to be drained, got %+v, %v", info, err)
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("Bridge stopped: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Expected Run to stop with the context, got %v", err)
+	}
+}
+
+func timestamps(t *testing.T, catalog *hocdb.Catalog, ticker string, schema []hocdb.Field) []int64 {
+	t.Helper()
+	data, err := catalog.Query(ticker, 0, 1<<62, nil)
+	if err != nil {
+		t.Fatalf("Failed to query %s: %v", ticker, err)
+	}
+	records, _ := hocdb.DecodeRecords(schema, data)
+	var got []int64
+	for _, record := range records {
+		got = append(got, record.Timestamp())
+	}
+	return got
+}
+
+func TestBridge(t *testing.T) {
+	testDir := "../../../../../b_go_test_data_nats"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	catalog, err := hocdb.OpenCatalog(testDir, hocdb.Options{}, 4)
+	if err != nil {
+		t.Fatalf("Failed to open catalog: %v", err)
+	}
+	defer catalog.Close()
+
+	js := jetStream(t)
+	trade := func(ts int64) string { return fmt.Sprintf(`{"timestamp":%d,"price":%d.5}`, ts, ts) }
+	for ts := int64(1); ts <= 3; ts++ {
+		publish(t, js, "trades.BTC", trade(ts))
+		publish(t, js, "trades.ETH", trade(ts*10))
+	}
+	c := consumer(t, js, "hocdb")
+	drain(t, c, catalog, nats.Config{Schema: schema, BatchSize: 4})
+	if got := timestamps(t, catalog, "trades.BTC", schema); !reflect.DeepEqual(got, []int64{1, 2, 3}) {
+		t.Errorf("Expected BTC timestamps 1 to 3, got %v", got)
+	}
+	if got := timestamps(t, catalog, "trades.ETH", schema); !reflect.DeepEqual(got, []int64{10, 20, 30}) {
+		t.Errorf("Expected ETH timestamps 10 to 30, got %v", got)
+	}
+
+	// A crash after the flush of 4 but before its acknowledgement: both messages
+	// are delivered again and 4 is recognized by its timestamp
+	publish(t, js, "trades.BTC", trade(4))
+	publish(t, js, "trades.BTC", trade(5))
+	if err := catalog.AppendValues("trades.BTC", int64(4), 4.5); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	batch, err := c.Fetch(2, jetstream.FetchMaxWait(time.Second))
+	if err != nil {
+		t.Fatalf("Failed to fetch: %v", err)
+	}
+	for range batch.Messages() {
+		// Not acknowledged
+	}
+	time.Sleep(150 * time.Millisecond) // AckWait
+	drain(t, c, catalog, nats.Config{Schema: schema})
+	if got := timestamps(t, catalog, "trades.BTC", schema); !reflect.DeepEqual(got, []int64{1, 2, 3, 4, 5}) {
+		t.Errorf("Expected BTC timestamps 1 to 5, got %v", got)
+	}
+
+	// Bad messages are terminated
+	publish(t, js, "trades.BTC", "{")
+	publish(t, js, "trades.BTC", trade(2))
+	var failed []string
+	drain(t, c, catalog, nats.Config{Schema: schema, OnError: func(msg jetstream.Msg, err error) {
+		failed = append(failed, string(msg.Data()))
+	}})
+	if !reflect.DeepEqual(failed, []string{"{", trade(2)}) {
+		t.Errorf("Expected the bad and the out of order message to fail, got %q", failed)
+	}
+}
+
+func TestBridgeSequence(t *testing.T) {
+	testDir := "../../../../../b_go_test_data_nats_sequence"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "seq", Type: hocdb.TypeU64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	catalog, err := hocdb.OpenCatalog(testDir, hocdb.Options{}, 4)
+	if err != nil {
+		t.Fatalf("Failed to open catalog: %v", err)
+	}
+	defer catalog.Close()
+
+	js := jetStream(t)
+	if _, err := nats.NewBridge(consumer(t, js, "bad"), catalog, nats.Config{Schema: schema, SequenceField: "price"}); err == nil {
+		t.Errorf("Expected a sequence field that isn't u64 to fail")
+	}
+
+	// Payloads without timestamps, stamped with the time they were stored
+	start := time.Now()
+	for i := 1; i <= 3; i++ {
+		publish(t, js, "trades.BTC", fmt.Sprintf(`{"price":%d}`, i))
+	}
+	config := nats.Config{Schema: schema, StreamTime: true, SequenceField: "seq"}
+	drain(t, consumer(t, js, "first"), catalog, config)
+
+	// A new consumer replaying the stream stores nothing again
+	drain(t, consumer(t, js, "second"), catalog, config)
+	data, err := catalog.Query("trades.BTC", 0, 1<<62, nil)
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	records, _ := hocdb.DecodeRecords(schema, data)
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+	for i, record := range records {
+		if seq := record.Values[1]; seq != uint64(i+1) {
+			t.Errorf("Expected sequence %d, got %v", i+1, seq)
+		}
+		if ts := time.Unix(0, record.Timestamp()); ts.Before(start.Add(-time.Second)) || ts.After(time.Now()) {
+			t.Errorf("Expected the stream's timestamp, got %v", ts)
+		}
+	}
+}
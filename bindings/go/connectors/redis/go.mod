@@ -0,0 +1,18 @@
+module hocdb/connectors/redis
+
+go 1.23.0
+
+require (
+	github.com/alicebob/miniredis/v2 v2.39.0
+	github.com/redis/go-redis/v9 v9.7.0
+	hocdb v0.0.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/ebitengine/purego v0.10.0 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+)
+
+replace hocdb => ../../
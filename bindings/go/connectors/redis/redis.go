@@ -0,0 +1,349 @@
+/*
+Package redis connects HOCDB databases to Redis Streams, both ways.
+
+A Bridge tails streams with XREAD and appends their entries to the database of the
+ticker of each stream in a hocdb.Catalog. The fields of an entry are the fields
+of the record, in the text form of hocdb.ParseValue; an entry without a timestamp
+field is stamped with the time of its ID. Publish does the reverse, adding the
+records appended to a database to a stream in the same form, so that a Bridge
+reads them back.
+
+It lives in its own module so that the core hocdb bindings stay free of third-party
+dependencies.
+
+Example usage:
+
+	client := goredis.NewClient(&goredis.Options{Addr: "localhost:6379"})
+	catalog, err := hocdb.OpenCatalog("./data", hocdb.Options{}, 64)
+	bridge, err := redis.NewBridge(client, catalog, redis.Config{
+		Schema:  schema,
+		Streams: []string{"fills:BTC", "fills:ETH"},
+	})
+	err = bridge.Run(ctx)
+*/
+package redis
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hocdb"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Config configures a Bridge
+type Config struct {
+	// Schema of the tickers, created on their first entry
+	Schema []hocdb.Field
+	// Streams are the keys of the streams to tail
+	Streams []string
+	// StartID is the ID the streams are read after, defaults to $, the entries
+	// added after Run starts. With 0, the streams are read from their start;
+	// entries whose records are already stored are skipped, so a bridge restarted
+	// that way resumes where it stopped.
+	StartID string
+	// Ticker returns the ticker of a stream, by default its key with colons and
+	// slashes replaced by underscores, fills_BTC for fills:BTC
+	Ticker func(stream string) string
+	// BatchSize is the number of entries read from a stream at a time, defaults
+	// to 100
+	BatchSize int64
+	// FlushInterval bounds the time a read waits for entries; the tickers are
+	// flushed after every read. Defaults to one second.
+	FlushInterval time.Duration
+	// OnError is called with the entries that fail to convert or append, which are
+	// then skipped. When nil, such an entry stops Run, which returns the error.
+	OnError func(stream string, msg goredis.XMessage, err error)
+}
+
+// Bridge appends the entries of Redis streams to the tickers of a catalog. It is
+// not safe for concurrent use.
+type Bridge struct {
+	client  goredis.Cmdable
+	catalog *hocdb.Catalog
+	config  Config
+	tsIndex int
+
+	ids     map[string]string // ID of the last entry read of each stream
+	tickers map[string]*ticker
+}
+
+// ticker is what a bridge knows of the database of a ticker
+type ticker struct {
+	resume int64 // Newest timestamp when first used, math.MinInt64 when empty
+	dirty  bool  // Appended to since the last flush
+}
+
+// NewBridge returns a bridge of the streams read with client into the tickers of
+// catalog
+func NewBridge(client goredis.Cmdable, catalog *hocdb.Catalog, config Config) (*Bridge, error) {
+	if hocdb.RecordSize(config.Schema) == 0 {
+		return nil, errors.New("bridge needs a schema")
+	}
+	if len(config.Streams) == 0 {
+		return nil, errors.New("bridge needs streams to read")
+	}
+	b := &Bridge{
+		client:  client,
+		catalog: catalog,
+		tsIndex: -1,
+		ids:     make(map[string]string, len(config.Streams)),
+		tickers: make(map[string]*ticker),
+	}
+	for i, field := range config.Schema {
+		if field.Name == "timestamp" {
+			b.tsIndex = i
+		}
+	}
+	if b.tsIndex < 0 {
+		return nil, errors.New("schema has no timestamp field")
+	}
+
+	if config.StartID == "" {
+		config.StartID = "$"
+	}
+	if config.Ticker == nil {
+		config.Ticker = strings.NewReplacer(":", "_", "/", "_").Replace
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	for _, stream := range config.Streams {
+		b.ids[stream] = config.StartID
+	}
+	b.config = config
+	return b, nil
+}
+
+// Run appends entries until ctx is done or an error stops it. The entries appended
+// before it returns are flushed. Another Run continues after the last entry read.
+func (b *Bridge) Run(ctx context.Context) error {
+	if err := b.resolveIDs(ctx); err != nil {
+		return err
+	}
+	for ctx.Err() == nil {
+		args := &goredis.XReadArgs{
+			Streams: make([]string, 0, 2*len(b.config.Streams)),
+			Count:   b.config.BatchSize,
+			Block:   b.config.FlushInterval,
+		}
+		args.Streams = append(args.Streams, b.config.Streams...)
+		for _, stream := range b.config.Streams {
+			args.Streams = append(args.Streams, b.ids[stream])
+		}
+		streams, err := b.client.XRead(ctx, args).Result()
+		if err != nil && !errors.Is(err, goredis.Nil) {
+			if ctx.Err() != nil {
+				break
+			}
+			return fmt.Errorf("failed to read: %w", err)
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				if err := b.handle(stream.Stream, msg); err != nil {
+					return errors.Join(err, b.flush())
+				}
+				b.ids[stream.Stream] = msg.ID
+			}
+		}
+		if err := b.flush(); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// resolveIDs replaces the $ start IDs with the IDs of the last entries, as reading
+// after $ again on every read would miss the entries added between reads
+func (b *Bridge) resolveIDs(ctx context.Context) error {
+	for stream, id := range b.ids {
+		if id != "$" {
+			continue
+		}
+		last, err := b.client.XRevRangeN(ctx, stream, "+", "-", 1).Result()
+		if err != nil {
+			return fmt.Errorf("failed to read the last entry of %s: %w", stream, err)
+		}
+		b.ids[stream] = "0-0"
+		if len(last) > 0 {
+			b.ids[stream] = last[0].ID
+		}
+	}
+	return nil
+}
+
+// handle appends the record of an entry, or hands its error to OnError
+func (b *Bridge) handle(stream string, msg goredis.XMessage) error {
+	values, err := b.values(msg)
+	if err == nil {
+		err = b.append(b.config.Ticker(stream), values)
+	}
+	if err != nil {
+		if b.config.OnError == nil {
+			return fmt.Errorf("entry %s of %s: %w", msg.ID, stream, err)
+		}
+		b.config.OnError(stream, msg, err)
+	}
+	return nil
+}
+
+// values converts the fields of an entry into values for the schema
+func (b *Bridge) values(msg goredis.XMessage) ([]interface{}, error) {
+	values := make([]interface{}, len(b.config.Schema))
+	for i, field := range b.config.Schema {
+		v, ok := msg.Values[field.Name]
+		if !ok {
+			switch {
+			case i == b.tsIndex:
+				ms, err := strconv.ParseInt(strings.SplitN(msg.ID, "-", 2)[0], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid entry ID %s", msg.ID)
+				}
+				values[i] = time.UnixMilli(ms)
+			case field.Nullable:
+			default:
+				return nil, fmt.Errorf("missing field %s", field.Name)
+			}
+			continue
+		}
+		text, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("field %s: unexpected value of type %T", field.Name, v)
+		}
+		value, err := hocdb.ParseValue(field.Type, text)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// append appends a record to a ticker, skipping the records it held before the
+// bridge first used it
+func (b *Bridge) append(name string, values []interface{}) error {
+	t, ok := b.tickers[name]
+	if !ok {
+		if err := b.catalog.Create(name, b.config.Schema); err != nil {
+			return err
+		}
+		t = &ticker{resume: math.MinInt64}
+		err := b.catalog.Do(name, func(db *hocdb.DB) error {
+			info, err := db.Info()
+			if err == nil && info.Records > 0 {
+				t.resume = info.Newest
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		b.tickers[name] = t
+	}
+
+	err := b.catalog.AppendValues(name, values...)
+	var order *hocdb.TimestampOrderError
+	if errors.As(err, &order) && order.Timestamp <= t.resume {
+		// Read again from an earlier ID
+		return nil
+	}
+	if err == nil {
+		t.dirty = true
+	}
+	return err
+}
+
+// flush flushes the tickers appended to since the last flush
+func (b *Bridge) flush() error {
+	for name, t := range b.tickers {
+		if !t.dirty {
+			continue
+		}
+		err := b.catalog.Do(name, func(db *hocdb.DB) error {
+			return db.Flush()
+		})
+		if err != nil {
+			return fmt.Errorf("failed to flush %s: %w", name, err)
+		}
+		t.dirty = false
+	}
+	return nil
+}
+
+// Publish adds every record appended to db after the call to a stream, until ctx
+// is done or db is closed, with a field per non-null value in the text form of
+// hocdb.ParseValue. With maxLen, the stream is trimmed to about that many entries.
+// Records appended while an add is in flight are added together in a pipeline.
+func Publish(ctx context.Context, client goredis.Cmdable, db *hocdb.DB, stream string, maxLen int64) error {
+	records, err := db.Subscribe(ctx)
+	if err != nil {
+		return err
+	}
+	for rec := range records {
+		pipe := client.Pipeline()
+		pipe.XAdd(ctx, addArgs(stream, maxLen, rec))
+		for drained := false; !drained && pipe.Len() < publishBatch; {
+			select {
+			case next, ok := <-records:
+				if ok {
+					pipe.XAdd(ctx, addArgs(stream, maxLen, next))
+				}
+				drained = !ok
+			default:
+				drained = true
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to add to %s: %w", stream, err)
+		}
+	}
+	return ctx.Err()
+}
+
+// publishBatch is the most entries Publish adds in one pipeline
+const publishBatch = 256
+
+// addArgs returns the XADD of a record
+func addArgs(stream string, maxLen int64, rec hocdb.Record) *goredis.XAddArgs {
+	return &goredis.XAddArgs{
+		Stream: stream,
+		MaxLen: maxLen,
+		Approx: maxLen > 0,
+		Values: entryValues(rec),
+	}
+}
+
+// entryValues returns the fields of the stream entry of a record
+func entryValues(rec hocdb.Record) []interface{} {
+	values := make([]interface{}, 0, 2*len(rec.Schema))
+	for i, field := range rec.Schema {
+		var text string
+		switch v := rec.Values[i].(type) {
+		case nil:
+			continue
+		case []byte:
+			text = base64.StdEncoding.EncodeToString(v)
+		case float64:
+			text = strconv.FormatFloat(v, 'g', -1, 64)
+		case float32:
+			text = strconv.FormatFloat(float64(v), 'g', -1, 32)
+		default:
+			text = fmt.Sprint(v)
+		}
+		values = append(values, field.Name, text)
+	}
+	return values
+}
@@ -0,0 +1,214 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"hocdb"
+	"hocdb/connectors/redis"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+var schema = []hocdb.Field{
+	{Name: "timestamp", Type: hocdb.TypeI64},
+	{Name: "price", Type: hocdb.TypeF64},
+	{Name: "side", Type: hocdb.StringType(4)},
+	{Name: "fee", Type: hocdb.TypeF64, Nullable: true},
+}
+
+func client(t *testing.T) *goredis.Client {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	c := goredis.NewClient(&goredis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func add(t *testing.T, c *goredis.Client, stream, id string, values ...interface{}) {
+	t.Helper()
+	if err := c.XAdd(context.Background(), &goredis.XAddArgs{Stream: stream, ID: id, Values: values}).Err(); err != nil {
+		t.Fatalf("Failed to add to %s: %v", stream, err)
+	}
+}
+
+// drain runs a bridge until the catalog holds the given number of records per ticker
+func drain(t *testing.T, c *goredis.Client, catalog *hocdb.Catalog, config redis.Config, want map[string]int) {
+	t.Helper()
+	config.FlushInterval = 20 * time.Millisecond
+	bridge, err := redis.NewBridge(c, catalog, config)
+	if err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- bridge.Run(ctx) }()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		got := make(map[string]int)
+		for ticker := range want {
+			data, _ := catalog.Query(ticker, 0, 1<<62, nil)
+			got[ticker] = len(data) / hocdb.RecordSize(config.Schema)
+		}
+		if reflect.DeepEqual(got, want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected records %v, got %v", want, got)
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("Bridge stopped: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	// Nothing more arrives within another read
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Expected Run to stop with the context, got %v", err)
+	}
+}
+
+func records(t *testing.T, catalog *hocdb.Catalog, ticker string) [][]interface{} {
+	t.Helper()
+	data, err := catalog.Query(ticker, 0, 1<<62, nil)
+	if err != nil {
+		t.Fatalf("Failed to query %s: %v", ticker, err)
+	}
+	decoded, _ := hocdb.DecodeRecords(schema, data)
+	var values [][]interface{}
+	for _, record := range decoded {
+		values = append(values, record.Values)
+	}
+	return values
+}
+
+func TestBridge(t *testing.T) {
+	testDir := "../../../../../b_go_test_data_redis"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	catalog, err := hocdb.OpenCatalog(testDir, hocdb.Options{}, 4)
+	if err != nil {
+		t.Fatalf("Failed to open catalog: %v", err)
+	}
+	defer catalog.Close()
+	c := client(t)
+
+	add(t, c, "fills:BTC", "1000-0", "timestamp", "1", "price", "100.5", "side", "buy", "fee", "0.1")
+	add(t, c, "fills:BTC", "1000-1", "timestamp", "2", "price", "101", "side", "sell")
+	add(t, c, "fills:ETH", "1000-0", "timestamp", "1", "price", "10", "side", "buy")
+	// Stamped with the time of its ID
+	add(t, c, "fills:BTC", "5000-0", "price", "102", "side", "buy")
+	add(t, c, "fills:BTC", "5000-1", "timestamp", "6000000000", "price", "cheap", "side", "buy")
+
+	var failed []string
+	config := redis.Config{
+		Schema:  schema,
+		Streams: []string{"fills:BTC", "fills:ETH"},
+		StartID: "0",
+		OnError: func(stream string, msg goredis.XMessage, err error) {
+			failed = append(failed, stream+" "+msg.ID)
+		},
+	}
+	drain(t, c, catalog, config, map[string]int{"fills_BTC": 3, "fills_ETH": 1})
+	want := [][]interface{}{
+		{int64(1), 100.5, "buy", 0.1},
+		{int64(2), 101.0, "sell", nil},
+		{int64(5 * time.Second), 102.0, "buy", nil},
+	}
+	if got := records(t, catalog, "fills_BTC"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if !reflect.DeepEqual(failed, []string{"fills:BTC 5000-1"}) {
+		t.Errorf("Expected the entry with a bad price to fail, got %v", failed)
+	}
+
+	// Read again from the start, the stored entries are skipped
+	add(t, c, "fills:ETH", "7000-0", "timestamp", "7", "price", "11", "side", "sell")
+	config.OnError = nil
+	config.Streams = []string{"fills:ETH"}
+	drain(t, c, catalog, config, map[string]int{"fills_ETH": 2})
+}
+
+func TestPublish(t *testing.T) {
+	testDir := "../../../../../b_go_test_data_redis_publish"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New("FILLS", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+	c := client(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- redis.Publish(ctx, c, db, "fills:out", 0) }()
+	// Records appended before Publish subscribes aren't added, so append until one is
+	deadline := time.Now().Add(10 * time.Second)
+	ts := int64(0)
+	for {
+		ts++
+		if err := db.AppendValues(ts, 1.0, "buy", nil); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+		if l, _ := c.XLen(ctx, "fills:out").Result(); l > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected records to be published")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	want := [][]interface{}{
+		{ts + 1, 100.5, "buy", 0.1},
+		{ts + 2, 101.0, "sell", nil},
+		{ts + 3, 99.0, "buy", 0.25},
+	}
+	for _, values := range want {
+		if err := db.AppendValues(values...); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	last := fmt.Sprint(ts + 3)
+	for {
+		entries, _ := c.XRevRangeN(ctx, "fills:out", "+", "-", 1).Result()
+		if len(entries) == 1 && entries[0].Values["timestamp"] == last {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the record at %s to be published, got %v", last, entries)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected Publish to stop with the context, got %v", err)
+	}
+
+	// A bridge reads the records back
+	catalogDir := testDir + "_catalog"
+	os.RemoveAll(catalogDir)
+	defer os.RemoveAll(catalogDir)
+	catalog, err := hocdb.OpenCatalog(catalogDir, hocdb.Options{}, 4)
+	if err != nil {
+		t.Fatalf("Failed to open catalog: %v", err)
+	}
+	defer catalog.Close()
+	n, err := c.XLen(context.Background(), "fills:out").Result()
+	if err != nil {
+		t.Fatalf("Failed to read the stream length: %v", err)
+	}
+	drain(t, c, catalog, redis.Config{Schema: schema, Streams: []string{"fills:out"}, StartID: "0"}, map[string]int{"fills_out": int(n)})
+	if got := records(t, catalog, "fills_out"); !reflect.DeepEqual(got[len(got)-3:], want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,331 @@
+package hocdb
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// CSVOptions controls how records are rendered by ExportCSV
+type CSVOptions struct {
+	Comma            rune          // Field delimiter, defaults to ','
+	NoHeader         bool          // Skip the header row with the field names
+	TimestampRFC3339 bool          // Render the timestamp column as RFC3339 instead of an integer
+	TimestampUnit    time.Duration // Unit of stored timestamps for RFC3339 rendering, defaults to the database's TimestampPrecision, or time.Second for WriteCSV
+}
+
+// ExportCSV writes all records in [startTs, endTs) to w as CSV. The header row is
+// derived from the schema and every column is formatted according to its field type.
+// Nulls are written as empty values. With MaxResultMemory, the range is read in
+// chunks, see QueryFunc.
+func (db *DB) ExportCSV(w io.Writer, startTs, endTs int64, opts CSVOptions) error {
+	if !db.isOpen() {
+		return errors.New("database not initialized")
+	}
+
+	if opts.TimestampUnit == 0 {
+		opts.TimestampUnit = db.TimestampPrecision()
+	}
+	schema, _ := db.layout()
+	header := !opts.NoHeader
+	err := db.queryEach(startTs, endTs, nil, func(data []byte) error {
+		// The header goes before the first chunk only
+		opts.NoHeader = !header
+		header = false
+		return WriteCSV(w, schema, data, opts)
+	})
+	if err != nil || !header {
+		return err
+	}
+	return WriteCSV(w, schema, nil, opts)
+}
+
+// WriteCSV writes raw Load/Query output to w as CSV, formatted like ExportCSV
+func WriteCSV(w io.Writer, schema []Field, data []byte, opts CSVOptions) error {
+	cw := csv.NewWriter(w)
+	if opts.Comma != 0 {
+		cw.Comma = opts.Comma
+	}
+
+	if !opts.NoHeader {
+		header := make([]string, len(schema))
+		for i, field := range schema {
+			header[i] = field.Name
+		}
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+	}
+
+	recordSize := RecordSize(schema)
+	row := make([]string, len(schema))
+	for offset := 0; offset+recordSize <= len(data); offset += recordSize {
+		values, err := DecodeRecord(schema, data[offset:offset+recordSize])
+		if err != nil {
+			return err
+		}
+		for i, field := range schema {
+			if field.Name == "timestamp" && opts.TimestampRFC3339 {
+				row[i] = formatTimestamp(values[i].(int64), opts.TimestampUnit)
+				continue
+			}
+			row[i] = formatValue(values[i])
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// CSVMapping describes how the columns of a CSV file map onto schema fields for ImportCSV
+type CSVMapping struct {
+	Columns          map[string]string // Schema field name -> CSV header name; unlisted fields use the column with the same name
+	Comma            rune              // Field delimiter, defaults to ','
+	NoHeader         bool              // Input has no header row; columns are taken in schema order
+	TimestampRFC3339 bool              // Parse the timestamp column as RFC3339 instead of an integer
+	TimestampUnit    time.Duration     // Unit of stored timestamps for RFC3339 parsing, defaults to the database's TimestampPrecision
+	BatchSize        int               // Number of records appended between flushes, defaults to 1000
+	MaxErrors        int               // Abort after this many bad lines (0 for no limit)
+}
+
+// LineError reports a line of an import that could not be converted or appended
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// ImportResult summarizes a bulk import
+type ImportResult struct {
+	Imported int
+	Errors   []*LineError
+}
+
+// ImportCSV streams rows from r, converts them according to the schema and appends
+// them in batches. Rows that fail to convert or append are recorded in the result and
+// skipped; the returned error is only set when the import cannot continue. Empty
+// values of nullable fields are imported as nulls.
+func (db *DB) ImportCSV(r io.Reader, mapping CSVMapping) (*ImportResult, error) {
+	if !db.isOpen() {
+		return nil, errors.New("database not initialized")
+	}
+
+	if mapping.TimestampUnit == 0 {
+		mapping.TimestampUnit = db.TimestampPrecision()
+	}
+	cr := csv.NewReader(r)
+	if mapping.Comma != 0 {
+		cr.Comma = mapping.Comma
+	}
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	// Resolve the CSV column feeding each schema field
+	schema, _ := db.layout()
+	columns := make([]int, len(schema))
+	if mapping.NoHeader {
+		for i := range columns {
+			columns[i] = i
+		}
+	} else {
+		header, err := cr.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		index := make(map[string]int, len(header))
+		for i, name := range header {
+			index[name] = i
+		}
+		for i, field := range schema {
+			name := field.Name
+			if mapped, ok := mapping.Columns[name]; ok {
+				name = mapped
+			}
+			col, ok := index[name]
+			if !ok {
+				return nil, fmt.Errorf("CSV header has no column for field %s", field.Name)
+			}
+			columns[i] = col
+		}
+	}
+
+	batch := newImportBatch(db, schema, mapping.BatchSize)
+	result := batch.result
+	values := make([]interface{}, len(schema))
+
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return result, err
+			}
+			result.Errors = append(result.Errors, &LineError{Line: parseErr.Line, Err: parseErr.Err})
+		} else {
+			line, _ := cr.FieldPos(0)
+			if err := csvRowValues(schema, row, columns, mapping, values); err != nil {
+				result.Errors = append(result.Errors, &LineError{Line: line, Err: err})
+			} else if err := batch.add(line, values); err != nil {
+				return result, err
+			}
+		}
+
+		if mapping.MaxErrors > 0 && len(result.Errors) >= mapping.MaxErrors {
+			batch.commit()
+			return result, fmt.Errorf("import aborted after %d errors", len(result.Errors))
+		}
+	}
+
+	if err := batch.commit(); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// csvRowValues converts the columns of a CSV row into values for CreateRecordBytes
+func csvRowValues(schema []Field, row []string, columns []int, mapping CSVMapping, values []interface{}) error {
+	for i, field := range schema {
+		if columns[i] >= len(row) {
+			return fmt.Errorf("missing column for field %s", field.Name)
+		}
+		text := row[columns[i]]
+		if text == "" && field.Nullable {
+			values[i] = nil
+			continue
+		}
+
+		if field.Name == "timestamp" && mapping.TimestampRFC3339 {
+			ts, err := parseTimestamp(text, mapping.TimestampUnit)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			values[i] = ts
+			continue
+		}
+
+		v, err := ParseValue(field.Type, text)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		values[i] = v
+	}
+	return nil
+}
+
+// importBatch accumulates encoded records and appends them together so the
+// database is flushed once per batch rather than once per row
+type importBatch struct {
+	db      *DB
+	schema  []Field
+	size    int
+	records [][]byte
+	lines   []int
+	result  *ImportResult
+}
+
+func newImportBatch(db *DB, schema []Field, size int) *importBatch {
+	if size <= 0 {
+		size = 1000
+	}
+	return &importBatch{db: db, schema: schema, size: size, result: &ImportResult{}}
+}
+
+// add encodes values and queues them, committing the batch once it is full
+func (b *importBatch) add(line int, values []interface{}) error {
+	record, err := encodeRecord(nil, b.schema, b.db.TimestampPrecision(), values)
+	if err != nil {
+		b.result.Errors = append(b.result.Errors, &LineError{Line: line, Err: err})
+		return nil
+	}
+	b.records = append(b.records, record)
+	b.lines = append(b.lines, line)
+
+	if len(b.records) >= b.size {
+		return b.commit()
+	}
+	return nil
+}
+
+// commit appends every queued record and flushes the database
+func (b *importBatch) commit() error {
+	if len(b.records) == 0 {
+		return nil
+	}
+	for i, record := range b.records {
+		if err := b.db.Append(record); err != nil {
+			b.result.Errors = append(b.result.Errors, &LineError{Line: b.lines[i], Err: err})
+			continue
+		}
+		b.result.Imported++
+	}
+	b.records = b.records[:0]
+	b.lines = b.lines[:0]
+	return b.db.Flush()
+}
+
+// formatValue renders a decoded field value as text without losing precision
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case uint64:
+		return strconv.FormatUint(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	case string:
+		return val
+	case []byte:
+		return base64.StdEncoding.EncodeToString(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// formatTimestamp renders a stored timestamp expressed in unit as RFC3339 in UTC
+func formatTimestamp(ts int64, unit time.Duration) string {
+	if unit <= 0 {
+		unit = time.Second
+	}
+	if unit >= time.Second {
+		return time.Unix(ts*int64(unit/time.Second), 0).UTC().Format(time.RFC3339Nano)
+	}
+	perSecond := int64(time.Second / unit)
+	return time.Unix(ts/perSecond, (ts%perSecond)*int64(unit)).UTC().Format(time.RFC3339Nano)
+}
+
+// parseTimestamp is the inverse of formatTimestamp
+func parseTimestamp(text string, unit time.Duration) (int64, error) {
+	if unit <= 0 {
+		unit = time.Second
+	}
+	t, err := time.Parse(time.RFC3339Nano, text)
+	if err != nil {
+		return 0, err
+	}
+	if unit >= time.Second {
+		return t.Unix() / int64(unit/time.Second), nil
+	}
+	return t.Unix()*int64(time.Second/unit) + int64(t.Nanosecond())/int64(unit), nil
+}
@@ -0,0 +1,172 @@
+package hocdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+const (
+	// fileHeaderSize is the size of the magic and schema hash at the start of a data file
+	fileHeaderSize = 12
+
+	// defaultMaxFileSize is the engine's data file size limit when MaxFileSize is 0
+	defaultMaxFileSize = 2 * 1024 * 1024 * 1024
+)
+
+// timestampOffset returns the byte offset of the i64 timestamp field within a record
+func timestampOffset(schema []Field) (int, bool) {
+	offset := 0
+	for _, field := range schema {
+		if field.Name == "timestamp" {
+			return offset, field.Type == TypeI64
+		}
+		offset += field.Type.Size()
+	}
+	return 0, false
+}
+
+// maxFileSize returns the size at which the engine stops or wraps around, aligned
+// to whole records like the engine does
+func (db *DB) maxFileSize() int64 {
+	max := db.options.MaxFileSize
+	if max <= 0 {
+		max = defaultMaxFileSize
+	}
+	size := int64(RecordSize(db.schema))
+	return fileHeaderSize + (max-fileHeaderSize)/size*size
+}
+
+// writeCursor returns the offset the next flushed record is written to. Pending
+// writes must have been flushed.
+func (db *DB) writeCursor() (int64, error) {
+	if db.readOnly {
+		return db.readCursor()
+	}
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	size := int64(RecordSize(db.schema))
+	end, err := dataEnd(f, size)
+	if err != nil {
+		return 0, err
+	}
+	if !db.options.OverwriteFull || end < db.maxFileSize() {
+		return end, nil
+	}
+
+	// Once a ring buffer has wrapped, the cursor is where timestamps drop back
+	tsOffset, _ := timestampOffset(db.schema)
+	cursor := end
+	prev := int64(0)
+	err = scanRecords(f, size, tsOffset, fileHeaderSize, end, func(offset, ts int64, rec []byte) bool {
+		if offset > fileHeaderSize && ts < prev {
+			cursor = offset
+			return false
+		}
+		prev = ts
+		return true
+	})
+	return cursor, err
+}
+
+// dataEnd returns the offset just past the last whole record in a data file
+func dataEnd(f *os.File, recordSize int64) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() < fileHeaderSize {
+		return fileHeaderSize, nil
+	}
+	return fileHeaderSize + (info.Size()-fileHeaderSize)/recordSize*recordSize, nil
+}
+
+// dataView returns a view of the records of the data file f in time order, whose
+// oldest record follows the newest once a ring buffer wrapped; db.mu must be held
+func (db *DB) dataView(f *os.File) (*fileView, error) {
+	size := int64(RecordSize(db.schema))
+	end, err := dataEnd(f, size)
+	if err != nil {
+		return nil, err
+	}
+	tsOffset, _ := timestampOffset(db.schema)
+	v := &fileView{f: f, size: size, tsOffset: tsOffset, count: (end - fileHeaderSize) / size, marks: db.tsMarks}
+	if v.count > 0 && db.options.OverwriteFull {
+		if v.start, err = v.oldest(); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// scanRecords calls fn for the records of a data file between two offsets until it
+// returns false. rec is only valid during the call.
+func scanRecords(f *os.File, recordSize int64, tsOffset int, from, to int64, fn func(offset, ts int64, rec []byte) bool) error {
+	chunk := make([]byte, recordSize*256)
+	for from < to {
+		n := int64(len(chunk))
+		if to-from < n {
+			n = to - from
+		}
+		if _, err := f.ReadAt(chunk[:n], from); err != nil && err != io.EOF {
+			return err
+		}
+		for off := int64(0); off+recordSize <= n; off += recordSize {
+			rec := chunk[off : off+recordSize]
+			ts := int64(binary.LittleEndian.Uint64(rec[tsOffset:]))
+			if !fn(from+off, ts, rec) {
+				return nil
+			}
+		}
+		from += n
+	}
+	return nil
+}
+
+// withFileClosed closes the engine's handle, runs fn on the data file and opens the
+// engine on it again, which recovers its state from the file; db.mu must be held
+func (db *DB) withFileClosed(fn func() error) error {
+	if db.handle != nil {
+		engineClose(db.handle)
+		db.handle = nil
+	}
+	if db.syncFile != nil {
+		db.syncFile.Close()
+		db.syncFile = nil
+	}
+	err := fn()
+	db.handle = openHandle(db.ticker, db.dataDir(), withColumns(db.schema, db.columns), db.options)
+	if db.handle == nil && err == nil {
+		err = errors.New("failed to initialize HOCDB")
+	}
+	if csErr := db.updateChecksums(); csErr != nil && err == nil {
+		err = csErr
+	}
+	if colErr := db.updateColumns(); colErr != nil && err == nil {
+		err = colErr
+	}
+	if idxErr := db.updateIndexes(); idxErr != nil && err == nil {
+		err = idxErr
+	}
+	if zoneErr := db.updateZones(); zoneErr != nil && err == nil {
+		err = zoneErr
+	}
+	if tsErr := db.updateTimeIndex(); tsErr != nil && err == nil {
+		err = tsErr
+	}
+	if encErr := db.resealAll(); encErr != nil && err == nil {
+		err = encErr
+	}
+	db.unflushed = 0
+	db.hookMu.Lock()
+	db.hooks.autoTsKnown = false
+	db.hookMu.Unlock()
+	db.locateCursors()
+	db.notifyReaders(true)
+	return err
+}
@@ -0,0 +1,131 @@
+package hocdb
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// maxDecimalScale is the largest scale of a decimal type, as int64 holds 18 digits
+const maxDecimalScale = 18
+
+// DecimalType returns the type of exact decimal fields with scale digits after the
+// decimal point, from 0 to 18. Values are stored as int64 counts of 10^-scale, so
+// DecimalType(2) holds cents up to about ±9.2e16. DecimalType(0) is TypeDecimal.
+func DecimalType(scale int) FieldType {
+	return FieldType(scale<<8) | TypeDecimal
+}
+
+// IsDecimal reports whether the type is TypeDecimal or a type from DecimalType
+func (t FieldType) IsDecimal() bool {
+	return t&0xff == TypeDecimal
+}
+
+// Scale returns the number of digits after the decimal point of a decimal type, 0
+// for other types
+func (t FieldType) Scale() int {
+	if !t.IsDecimal() {
+		return 0
+	}
+	return int(t >> 8)
+}
+
+// Decimal is the exact value of a decimal field, Unscaled / 10^Scale. Values of
+// other decimal libraries convert through big.Rat: CreateRecordBytes accepts any
+// value with a Rat() *big.Rat method, such as shopspring's decimal.Decimal.
+type Decimal struct {
+	Unscaled int64
+	Scale    int
+}
+
+// NewDecimal converts r to a Decimal with the given scale. It fails unless r has at
+// most scale digits after the decimal point and fits in the range of the scale.
+func NewDecimal(r *big.Rat, scale int) (Decimal, error) {
+	if scale < 0 || scale > maxDecimalScale {
+		return Decimal{}, fmt.Errorf("invalid decimal scale %d", scale)
+	}
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(scale)))
+	if !scaled.IsInt() {
+		return Decimal{}, fmt.Errorf("%s has more than %d decimal places", r.RatString(), scale)
+	}
+	if !scaled.Num().IsInt64() {
+		return Decimal{}, fmt.Errorf("%s out of range for scale %d", r.RatString(), scale)
+	}
+	return Decimal{Unscaled: scaled.Num().Int64(), Scale: scale}, nil
+}
+
+// ParseDecimal parses a decimal number such as "-12.50" with the given scale, see
+// NewDecimal
+func ParseDecimal(s string, scale int) (Decimal, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	return NewDecimal(r, scale)
+}
+
+// Rat returns the exact value of the decimal
+func (d Decimal) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(d.Unscaled), pow10(d.Scale))
+}
+
+// Float64 returns the nearest float64 to the decimal
+func (d Decimal) Float64() float64 {
+	f, _ := d.Rat().Float64()
+	return f
+}
+
+// String formats the decimal with all of its Scale digits after the point
+func (d Decimal) String() string {
+	return d.Rat().FloatString(d.Scale)
+}
+
+// MarshalJSON writes the decimal as a JSON number with its exact digits
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// decimalValue converts a Go value to the unscaled value of a decimal field: a
+// Decimal or anything else with a Rat method, *big.Rat, a decimal string, a Go
+// integer, or a float, taken as its shortest decimal representation
+func decimalValue(t FieldType, v interface{}) (int64, error) {
+	scale := t.Scale()
+	var r *big.Rat
+	switch v := v.(type) {
+	case Decimal:
+		if v.Scale == scale {
+			return v.Unscaled, nil
+		}
+		r = v.Rat()
+	case *big.Rat:
+		r = v
+	case interface{ Rat() *big.Rat }:
+		r = v.Rat()
+	case string:
+		d, err := ParseDecimal(v, scale)
+		return d.Unscaled, err
+	case float64:
+		d, err := ParseDecimal(strconv.FormatFloat(v, 'g', -1, 64), scale)
+		return d.Unscaled, err
+	case float32:
+		d, err := ParseDecimal(strconv.FormatFloat(float64(v), 'g', -1, 32), scale)
+		return d.Unscaled, err
+	default:
+		i, ok := integerValue(v)
+		if !ok {
+			return 0, errors.New("invalid type for Decimal field")
+		}
+		r = new(big.Rat).SetInt64(i)
+	}
+	if r == nil {
+		return 0, errors.New("invalid type for Decimal field")
+	}
+	d, err := NewDecimal(r, scale)
+	return d.Unscaled, err
+}
+
+// pow10 returns 10^n
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
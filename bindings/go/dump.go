@@ -0,0 +1,96 @@
+package hocdb
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// DumpRecords writes raw Load/Query output to w as a table for people to read,
+// with a column per field under a header. Timestamps are rendered as RFC3339 in
+// UTC, taken as nanoseconds; DB.Dump uses the database's TimestampPrecision.
+// Strings holding tabs or unprintable characters are quoted, blobs are written in
+// hex and nulls as NULL.
+func DumpRecords(w io.Writer, schema []Field, data []byte) error {
+	d := newDumper(w, schema, time.Nanosecond)
+	if err := d.write(data); err != nil {
+		return err
+	}
+	return d.tw.Flush()
+}
+
+// Dump writes the records in [startTs, endTs) to w like DumpRecords. With
+// MaxResultMemory, the range is read in chunks, see QueryFunc.
+func (db *DB) Dump(w io.Writer, startTs, endTs int64) error {
+	if !db.isOpen() {
+		return errors.New("database not initialized")
+	}
+	schema, _ := db.layout()
+	d := newDumper(w, schema, db.TimestampPrecision())
+	if err := db.queryEach(startTs, endTs, nil, d.write); err != nil {
+		return err
+	}
+	return d.tw.Flush()
+}
+
+// dumper writes the table of DumpRecords, aligned across chunks of records
+type dumper struct {
+	tw     *tabwriter.Writer
+	schema []Field
+	unit   time.Duration
+	row    []string
+}
+
+func newDumper(w io.Writer, schema []Field, unit time.Duration) *dumper {
+	d := &dumper{tw: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0), schema: schema, unit: unit, row: make([]string, len(schema))}
+	for i, field := range schema {
+		d.row[i] = field.Name
+	}
+	d.writeRow()
+	return d
+}
+
+func (d *dumper) writeRow() {
+	d.tw.Write([]byte(strings.Join(d.row, "\t") + "\n"))
+}
+
+// write writes the rows of records
+func (d *dumper) write(data []byte) error {
+	recordSize := RecordSize(d.schema)
+	if len(data)%recordSize != 0 {
+		return errors.New("data length is not a multiple of the record size")
+	}
+	for offset := 0; offset < len(data); offset += recordSize {
+		values, err := DecodeRecord(d.schema, data[offset:offset+recordSize])
+		if err != nil {
+			return err
+		}
+		for i, field := range d.schema {
+			switch v := values[i].(type) {
+			case nil:
+				d.row[i] = "NULL"
+			case int64:
+				if field.Name == "timestamp" {
+					d.row[i] = formatTimestamp(v, d.unit)
+				} else {
+					d.row[i] = strconv.FormatInt(v, 10)
+				}
+			case string:
+				d.row[i] = v
+				if strings.IndexFunc(v, func(r rune) bool { return r == '\t' || !strconv.IsPrint(r) }) >= 0 {
+					d.row[i] = strconv.Quote(v)
+				}
+			case []byte:
+				d.row[i] = "0x" + hex.EncodeToString(v)
+			default:
+				d.row[i] = formatValue(v)
+			}
+		}
+		d.writeRow()
+	}
+	return nil
+}
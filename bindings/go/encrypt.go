@@ -0,0 +1,435 @@
+package hocdb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// encryptedFileExt is the extension of the data file of a database opened with
+	// an EncryptionKey
+	encryptedFileExt = dataFileExt + ".enc"
+
+	// encryptedMagic starts an encrypted data file, followed by a nonce and the tag
+	// sealing the magic, which checks the key
+	encryptedMagic = "HOCE"
+
+	// sealChunkSize is the most bytes of the data file sealed into one chunk. Each
+	// chunk is its length, a nonce and the sealed bytes with their tag.
+	sealChunkSize = 1 << 20
+)
+
+// ErrEncryptionKey is returned when opening an encrypted database without its key
+// or with another one
+var ErrEncryptionKey = errors.New("wrong or missing encryption key")
+
+// encryption holds the state of a database opened with an EncryptionKey. The engine
+// works on a plaintext copy of the data file in workDir; flushes seal the bytes it
+// appended into new chunks of the encrypted file.
+type encryption struct {
+	aead    cipher.AEAD
+	file    *os.File // The encrypted data file
+	size    int64    // Size of the header and the chunks written to file
+	sealed  int64    // Bytes of the plaintext data file the chunks hold
+	workDir string
+}
+
+// newAEAD returns AES-GCM with an AES-128, AES-192 or AES-256 key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptedFile returns the path of the encrypted data file of a ticker
+func encryptedFile(path, ticker string) string {
+	return filepath.Join(path, ticker+encryptedFileExt)
+}
+
+// dataDir returns the directory of the data file the engine works on
+func (db *DB) dataDir() string {
+	if db.enc != nil {
+		return db.enc.workDir
+	}
+	return db.path
+}
+
+// openEncryption decrypts the data file of a ticker into a new working directory,
+// before the engine opens it there. A plaintext data file left by a database opened
+// without a key is encrypted first.
+func openEncryption(ticker, path string, options Options) (*encryption, error) {
+	aead, err := newAEAD(options.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	dir := options.EncryptionDir
+	if dir == "" {
+		dir = path
+	}
+	prefix, err := workDirPrefix(ticker, path)
+	if err != nil {
+		return nil, err
+	}
+	if err := removeStaleWorkDirs(dir, prefix); err != nil {
+		return nil, fmt.Errorf("failed to remove stale plaintext copies: %w", err)
+	}
+	workDir, err := os.MkdirTemp(dir, prefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	enc := &encryption{aead: aead, workDir: workDir}
+	if err := enc.open(ticker, path); err != nil {
+		enc.close()
+		return nil, err
+	}
+	return enc, nil
+}
+
+// workDirPrefix returns the start of the names of the working directories of a
+// database, which tell databases of the same ticker sharing an EncryptionDir apart
+func workDirPrefix(ticker, path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	h := fnv.New64a()
+	h.Write([]byte(abs))
+	return fmt.Sprintf("hocdb-%s-%016x-", ticker, h.Sum64()), nil
+}
+
+// removeStaleWorkDirs removes the working directories a crashed process left in
+// dir with their plaintext. The database's lock is held, so none is in use.
+func removeStaleWorkDirs(dir, prefix string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		// os.MkdirTemp replaces the * with digits
+		rest, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok || !entry.IsDir() || rest == "" || strings.Trim(rest, "0123456789") != "" {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// open decrypts the encrypted file of a ticker into workDir, creating it first
+func (e *encryption) open(ticker, path string) error {
+	encFile := encryptedFile(path, ticker)
+	plain := filepath.Join(e.workDir, ticker+dataFileExt)
+	oldPlain := filepath.Join(path, ticker+dataFileExt)
+	if _, err := os.Stat(encFile); errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(oldPlain); err == nil {
+			if err := copyFile(plain, oldPlain); err != nil {
+				return err
+			}
+		}
+		if err := e.sealAll(encFile, plain); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	// Once the encrypted file exists a plaintext one is left by an interrupted
+	// conversion
+	if err := os.Remove(oldPlain); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if e.file == nil {
+		f, err := os.OpenFile(encFile, os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		e.file = f
+	}
+	return e.decrypt(plain)
+}
+
+// copyFile copies a file that no one writes meanwhile
+func copyFile(dest, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return copyFileAtomic(dest, f, info.Size())
+}
+
+// decrypt checks the key against the header of the encrypted file and writes the
+// plaintext of its chunks to plain. A partial chunk at the end, left by a crash
+// while it was written, is dropped.
+func (e *encryption) decrypt(plain string) error {
+	info, err := e.file.Stat()
+	if err != nil {
+		return err
+	}
+	nonceSize, overhead := e.aead.NonceSize(), e.aead.Overhead()
+	header := make([]byte, len(encryptedMagic)+nonceSize+overhead)
+	if _, err := e.file.ReadAt(header, 0); err != nil {
+		return fmt.Errorf("%s is not an encrypted HOCDB data file", e.file.Name())
+	}
+	if string(header[:len(encryptedMagic)]) != encryptedMagic {
+		return fmt.Errorf("%s is not an encrypted HOCDB data file", e.file.Name())
+	}
+	nonce := header[len(encryptedMagic) : len(encryptedMagic)+nonceSize]
+	if _, err := e.aead.Open(nil, nonce, header[len(encryptedMagic)+nonceSize:], []byte(encryptedMagic)); err != nil {
+		return ErrEncryptionKey
+	}
+
+	// The engine creates the file of a new database itself
+	if info.Size() == int64(len(header)) {
+		e.size, e.sealed = info.Size(), 0
+		return nil
+	}
+	out, err := os.OpenFile(plain, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	e.size, e.sealed = int64(len(header)), 0
+	var buf []byte
+	for e.size < info.Size() {
+		var length [4]byte
+		if _, err := e.file.ReadAt(length[:], e.size); err != nil {
+			break
+		}
+		n := int(binary.LittleEndian.Uint32(length[:]))
+		if n > sealChunkSize {
+			return fmt.Errorf("%w: chunk at offset %d has an invalid length", ErrCorrupt, e.size)
+		}
+		chunk := make([]byte, nonceSize+n+overhead)
+		if _, err := e.file.ReadAt(chunk, e.size+4); err != nil {
+			break
+		}
+		buf, err = e.aead.Open(buf[:0], chunk[:nonceSize], chunk[nonceSize:], e.chunkData(e.sealed))
+		if err != nil {
+			return fmt.Errorf("%w: chunk at offset %d fails authentication", ErrCorrupt, e.size)
+		}
+		if _, err := out.Write(buf); err != nil {
+			return err
+		}
+		e.size += int64(4 + len(chunk))
+		e.sealed += int64(n)
+	}
+	if e.size < info.Size() {
+		if err := e.file.Truncate(e.size); err != nil {
+			return err
+		}
+	}
+	return out.Sync()
+}
+
+// chunkData returns the additional data authenticated with a chunk: its offset in
+// the plaintext, so chunks can't be reordered
+func (e *encryption) chunkData(offset int64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, uint64(offset))
+}
+
+// header returns a new header of the encrypted file
+func (e *encryption) header() ([]byte, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header := append([]byte(encryptedMagic), nonce...)
+	return e.aead.Seal(header, nonce, nil, []byte(encryptedMagic)), nil
+}
+
+// sealChunk seals data, the plaintext at offset, into a chunk written to w
+func (e *encryption) sealChunk(w io.Writer, data []byte, offset int64) (int64, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return 0, err
+	}
+	chunk := binary.LittleEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, nonce...)
+	chunk = e.aead.Seal(chunk, nonce, data, e.chunkData(offset))
+	n, err := w.Write(chunk)
+	return int64(n), err
+}
+
+// sealFrom seals the bytes of f in [from, to) into chunks after w
+func (e *encryption) sealFrom(w io.Writer, f *os.File, from, to int64) (int64, error) {
+	var written int64
+	buf := make([]byte, sealChunkSize)
+	for from < to {
+		n := int64(len(buf))
+		if to-from < n {
+			n = to - from
+		}
+		if _, err := f.ReadAt(buf[:n], from); err != nil {
+			return written, err
+		}
+		chunk, err := e.sealChunk(w, buf[:n], from)
+		written += chunk
+		if err != nil {
+			return written, err
+		}
+		from += n
+	}
+	return written, nil
+}
+
+// sealAll writes the encrypted file anew from the plaintext data file, which may
+// not exist yet, and replaces the one in place atomically
+func (e *encryption) sealAll(encFile, plain string) error {
+	var size int64
+	f, err := os.Open(plain)
+	if err == nil {
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		size = info.Size()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	header, err := e.header()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(encFile), "."+filepath.Base(encFile)+".tmp*")
+	if err != nil {
+		return err
+	}
+	written, err := tmp.Write(header)
+	var chunks int64
+	if err == nil && f != nil {
+		chunks, err = e.sealFrom(tmp, f, 0, size)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), encFile)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := syncFile(filepath.Dir(encFile)); err != nil {
+		return err
+	}
+
+	if e.file != nil {
+		e.file.Close()
+	}
+	if e.file, err = os.OpenFile(encFile, os.O_RDWR, 0); err != nil {
+		return err
+	}
+	e.size, e.sealed = int64(written)+chunks, size
+	return nil
+}
+
+// seal appends the bytes the engine wrote to the data file since the last seal to
+// the encrypted file; db.mu must be held
+func (db *DB) seal() error {
+	e := db.enc
+	if e == nil {
+		return nil
+	}
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < e.sealed {
+		// Truncated, see withFileClosed
+		return e.sealAll(e.file.Name(), db.dataFile())
+	}
+	if info.Size() == e.sealed {
+		return nil
+	}
+
+	n, err := e.sealFrom(io.NewOffsetWriter(e.file, e.size), f, e.sealed, info.Size())
+	if err != nil {
+		// Drop the chunks of this seal, the next one retries
+		e.file.Truncate(e.size)
+		return err
+	}
+	e.size += n
+	e.sealed = info.Size()
+	return nil
+}
+
+// resealAll encrypts the data file anew after the engine's file was replaced or
+// truncated; db.mu must be held
+func (db *DB) resealAll() error {
+	if db.enc == nil {
+		return nil
+	}
+	return db.enc.sealAll(db.enc.file.Name(), db.dataFile())
+}
+
+// close closes the encrypted file and removes the plaintext working copy
+func (e *encryption) close() {
+	if e == nil {
+		return
+	}
+	if e.file != nil {
+		e.file.Close()
+		e.file = nil
+	}
+	os.RemoveAll(e.workDir)
+}
+
+// Rekey encrypts the data file with a new key, which replaces the EncryptionKey the
+// database was opened with. The file is replaced atomically, so a crash leaves it
+// encrypted with either key.
+func (db *DB) Rekey(key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.enc == nil {
+		return errors.New("database is not encrypted, open it with an EncryptionKey")
+	}
+	if err := db.flush(); err != nil {
+		return err
+	}
+	old := db.enc.aead
+	db.enc.aead = aead
+	if err := db.resealAll(); err != nil {
+		db.enc.aead = old
+		db.logError("rekey failed", err)
+		return fmt.Errorf("rekey failed: %w", err)
+	}
+	db.options.EncryptionKey = append([]byte(nil), key...)
+	return nil
+}
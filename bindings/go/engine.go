@@ -0,0 +1,55 @@
+package hocdb
+
+import "unsafe"
+
+// The engine is called through the functions of engine_cgo.go, which links
+// libhocdb_c at build time, or with the hocdb_purego build tag through those of
+// engine_purego.go, which loads it at runtime. Both take and return Go types only.
+//
+// Buffers the engine returns are in C memory, freed with engineFree; cBytes
+// copies Go results there so that both are handled alike.
+
+// LibraryEnv names the environment variable holding the path of the libhocdb_c
+// shared library that builds with the hocdb_purego tag load at runtime, on the
+// first New or OpenReadOnly. Without it the library is looked up by name like the
+// dynamic linker does, in LD_LIBRARY_PATH or DYLD_LIBRARY_PATH and the system
+// directories. Builds without the tag link the library and ignore it.
+const LibraryEnv = "HOCDB_LIBRARY"
+
+// engineHandle is the engine's handle on a data file, HOCDBHandle
+type engineHandle = unsafe.Pointer
+
+// engineFilter is laid out like HOCDBFilter
+type engineFilter struct {
+	fieldIndex uintptr
+	typ        int32
+	i64        int64
+	f64        float64
+	u64        uint64
+	str        [128]byte
+	b          bool
+}
+
+// engineStats is laid out like HOCDBStats
+type engineStats struct {
+	min   float64
+	max   float64
+	sum   float64
+	count uint64
+	mean  float64
+}
+
+// goBytes copies n bytes of C memory to a new slice
+func goBytes(p unsafe.Pointer, n int) []byte {
+	data := make([]byte, n)
+	copy(data, unsafe.Slice((*byte)(p), n))
+	return data
+}
+
+// boolInt converts a flag of hocdb_init
+func boolInt(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
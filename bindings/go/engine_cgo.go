@@ -0,0 +1,129 @@
+//go:build !hocdb_purego
+
+package hocdb
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../c
+#include "hocdb.h"
+#include <stdlib.h>
+
+// hocdb_append_batch appends n records of len bytes stored back to back in one
+// call from Go, storing the result of each append in results and, for records
+// out of timestamp order, the timestamp of the record before them in previous
+static void hocdb_append_batch(HOCDBHandle handle, const char* data, size_t len, size_t n, int* results, size_t ts_index, int64_t* previous) {
+	for (size_t i = 0; i < n; i++) {
+		results[i] = hocdb_append(handle, data + i * len, len);
+		if (results[i] == -3) {
+			double value;
+			if (hocdb_get_latest(handle, ts_index, &value, &previous[i]) != 0) {
+				results[i] = -1;
+			}
+		}
+	}
+}
+*/
+import "C"
+import "unsafe"
+
+// loadLibrary has nothing to do, the library is linked in
+func loadLibrary() error {
+	return nil
+}
+
+// engineVersion returns the version and features of the library
+func engineVersion() (string, uint64) {
+	return C.GoString(C.hocdb_version()), uint64(C.hocdb_features())
+}
+
+func engineInit(ticker, path string, schema []Field, maxFileSize int64, overwriteOnFull, flushOnWrite, autoIncrement bool) engineHandle {
+	tickerC := C.CString(ticker)
+	defer C.free(unsafe.Pointer(tickerC))
+	pathC := C.CString(path)
+	defer C.free(unsafe.Pointer(pathC))
+
+	cSchema := make([]C.CField, len(schema))
+	for i, field := range schema {
+		cSchema[i].name = C.CString(field.Name)
+		cSchema[i]._type = C.int(field.Type)
+	}
+	defer func() {
+		for i := range cSchema {
+			C.free(unsafe.Pointer(cSchema[i].name))
+		}
+	}()
+	var cSchemaPtr *C.CField
+	if len(cSchema) > 0 {
+		cSchemaPtr = &cSchema[0]
+	}
+
+	return engineHandle(C.hocdb_init(tickerC, pathC, cSchemaPtr, C.size_t(len(schema)), C.int64_t(maxFileSize),
+		C.int(boolInt(overwriteOnFull)), C.int(boolInt(flushOnWrite)), C.int(boolInt(autoIncrement))))
+}
+
+func engineSetAutoIncrement(h engineHandle, start, step int64) int {
+	return int(C.hocdb_set_auto_increment(C.HOCDBHandle(h), C.int64_t(start), C.int64_t(step)))
+}
+
+func engineAppend(h engineHandle, data []byte) int {
+	var dataPtr unsafe.Pointer
+	if len(data) > 0 {
+		dataPtr = unsafe.Pointer(&data[0])
+	}
+	return int(C.hocdb_append(C.HOCDBHandle(h), dataPtr, C.size_t(len(data))))
+}
+
+// engineAppendBatch appends the records of size bytes in buf, see
+// hocdb_append_batch
+func engineAppendBatch(h engineHandle, buf []byte, size, tsIndex int, results []int32, previous []int64) {
+	n := len(buf) / size
+	C.hocdb_append_batch(C.HOCDBHandle(h), (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(size), C.size_t(n),
+		(*C.int)(unsafe.Pointer(&results[0])), C.size_t(tsIndex), (*C.int64_t)(unsafe.Pointer(&previous[0])))
+}
+
+func engineFlush(h engineHandle) int {
+	return int(C.hocdb_flush(C.HOCDBHandle(h)))
+}
+
+func engineLoad(h engineHandle) (unsafe.Pointer, int) {
+	var outLen C.size_t
+	dataPtr := C.hocdb_load(C.HOCDBHandle(h), &outLen)
+	return dataPtr, int(outLen)
+}
+
+func engineQuery(h engineHandle, startTs, endTs int64, filters []engineFilter) (unsafe.Pointer, int) {
+	var filtersPtr *C.HOCDBFilter
+	if len(filters) > 0 {
+		filtersPtr = (*C.HOCDBFilter)(unsafe.Pointer(&filters[0]))
+	}
+	var outLen C.size_t
+	dataPtr := C.hocdb_query(C.HOCDBHandle(h), C.int64_t(startTs), C.int64_t(endTs), filtersPtr, C.size_t(len(filters)), &outLen)
+	return dataPtr, int(outLen)
+}
+
+func engineGetStats(h engineHandle, startTs, endTs int64, fieldIndex int, out *engineStats) int {
+	return int(C.hocdb_get_stats(C.HOCDBHandle(h), C.int64_t(startTs), C.int64_t(endTs), C.size_t(fieldIndex), (*C.HOCDBStats)(unsafe.Pointer(out))))
+}
+
+func engineGetLatest(h engineHandle, fieldIndex int) (float64, int64, int) {
+	var outVal C.double
+	var outTs C.int64_t
+	result := C.hocdb_get_latest(C.HOCDBHandle(h), C.size_t(fieldIndex), &outVal, &outTs)
+	return float64(outVal), int64(outTs), int(result)
+}
+
+func engineFree(p unsafe.Pointer) {
+	C.hocdb_free(p)
+}
+
+func engineClose(h engineHandle) {
+	C.hocdb_close(C.HOCDBHandle(h))
+}
+
+func engineDrop(h engineHandle) {
+	C.hocdb_drop(C.HOCDBHandle(h))
+}
+
+// cBytes copies b to C memory that engineFree frees
+func cBytes(b []byte) unsafe.Pointer {
+	return C.CBytes(b)
+}
@@ -0,0 +1,218 @@
+//go:build hocdb_purego && (darwin || linux || windows)
+
+package hocdb
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"unsafe"
+
+	"github.com/ebitengine/purego"
+)
+
+var (
+	loadOnce sync.Once
+	loadErr  error
+
+	// Addresses of the library's functions, called with purego.SyscallN, which
+	// unlike purego.RegisterLibFunc doesn't allocate per call
+	hocdbInit      uintptr
+	hocdbAppend    uintptr
+	hocdbFlush     uintptr
+	hocdbLoad      uintptr
+	hocdbQuery     uintptr
+	hocdbGetStats  uintptr
+	hocdbGetLatest uintptr
+	hocdbFree      uintptr
+	hocdbClose     uintptr
+	hocdbDrop      uintptr
+
+	// Missing from libraries older than hocdb_version, see Version. Those
+	// report no features, so New refuses Options.AutoIncrement with them.
+	hocdbVersion          uintptr
+	hocdbFeatures         uintptr
+	hocdbSetAutoIncrement uintptr
+
+	// goOwned holds the buffers cBytes allocated in Go memory by their address,
+	// which engineFree releases to the garbage collector instead of the engine
+	goOwned sync.Map
+)
+
+// pureField is laid out like CField
+type pureField struct {
+	name *byte
+	typ  int32
+}
+
+// loadLibrary loads libhocdb_c once, see LibraryEnv
+func loadLibrary() error {
+	loadOnce.Do(func() {
+		name := os.Getenv(LibraryEnv)
+		if name == "" {
+			name = libraryName()
+		}
+		if loadErr = loadSymbols(name, map[string]*uintptr{
+			"hocdb_init":       &hocdbInit,
+			"hocdb_append":     &hocdbAppend,
+			"hocdb_flush":      &hocdbFlush,
+			"hocdb_load":       &hocdbLoad,
+			"hocdb_query":      &hocdbQuery,
+			"hocdb_get_stats":  &hocdbGetStats,
+			"hocdb_get_latest": &hocdbGetLatest,
+			"hocdb_free":       &hocdbFree,
+			"hocdb_close":      &hocdbClose,
+			"hocdb_drop":       &hocdbDrop,
+		}); loadErr != nil {
+			loadErr = fmt.Errorf("failed to load HOCDB library: %w", loadErr)
+			return
+		}
+		if loadSymbols(name, map[string]*uintptr{"hocdb_version": &hocdbVersion, "hocdb_features": &hocdbFeatures}) != nil {
+			hocdbVersion, hocdbFeatures = 0, 0
+		}
+		if loadSymbols(name, map[string]*uintptr{"hocdb_set_auto_increment": &hocdbSetAutoIncrement}) != nil {
+			hocdbSetAutoIncrement = 0
+		}
+	})
+	return loadErr
+}
+
+// call calls a function of the library with integer and pointer arguments.
+// Callers convert their pointers to uintptr in the call expression itself:
+// uintptrescapes then moves what they point to off the goroutine stack, which
+// can be copied while the library still uses it, and keeps it alive until the
+// call returns.
+//
+//go:uintptrescapes
+func call(fn uintptr, args ...uintptr) uintptr {
+	r1, _, _ := purego.SyscallN(fn, args...)
+	return r1
+}
+
+// pointer converts a pointer a function returned, without go vet taking it for a
+// Go pointer kept as uintptr
+func pointer(r uintptr) unsafe.Pointer {
+	return *(*unsafe.Pointer)(unsafe.Pointer(&r))
+}
+
+// engineVersion returns the version and features of the library, nothing for
+// libraries without them
+func engineVersion() (string, uint64) {
+	if hocdbVersion == 0 {
+		return "", 0
+	}
+	p := pointer(call(hocdbVersion))
+	n := 0
+	for *(*byte)(unsafe.Add(p, n)) != 0 {
+		n++
+	}
+	return string(unsafe.Slice((*byte)(p), n)), uint64(call(hocdbFeatures))
+}
+
+func engineInit(ticker, path string, schema []Field, maxFileSize int64, overwriteOnFull, flushOnWrite, autoIncrement bool) engineHandle {
+	tickerC := append([]byte(ticker), 0)
+	pathC := append([]byte(path), 0)
+	fields := make([]pureField, len(schema))
+	names := make([][]byte, len(schema))
+	for i, field := range schema {
+		names[i] = append([]byte(field.Name), 0)
+		fields[i] = pureField{name: &names[i][0], typ: int32(field.Type)}
+	}
+	var fieldsPtr *pureField
+	if len(fields) > 0 {
+		fieldsPtr = &fields[0]
+	}
+	h := call(hocdbInit, uintptr(unsafe.Pointer(&tickerC[0])), uintptr(unsafe.Pointer(&pathC[0])),
+		uintptr(unsafe.Pointer(fieldsPtr)), uintptr(len(fields)), uintptr(maxFileSize),
+		uintptr(boolInt(overwriteOnFull)), uintptr(boolInt(flushOnWrite)), uintptr(boolInt(autoIncrement)))
+	return pointer(h)
+}
+
+func engineSetAutoIncrement(h engineHandle, start, step int64) int {
+	if hocdbSetAutoIncrement == 0 {
+		return -1
+	}
+	return int(int32(call(hocdbSetAutoIncrement, uintptr(h), uintptr(start), uintptr(step))))
+}
+
+func engineAppend(h engineHandle, data []byte) int {
+	var dataPtr *byte
+	if len(data) > 0 {
+		dataPtr = &data[0]
+	}
+	result := call(hocdbAppend, uintptr(h), uintptr(unsafe.Pointer(dataPtr)), uintptr(len(data)))
+	return int(int32(result))
+}
+
+// engineAppendBatch appends the records of size bytes in buf, storing the result
+// of each append in results and, for records out of timestamp order, the
+// timestamp of the record before them in previous
+func engineAppendBatch(h engineHandle, buf []byte, size, tsIndex int, results []int32, previous []int64) {
+	for i := range results {
+		results[i] = int32(engineAppend(h, buf[i*size:(i+1)*size]))
+		if results[i] == -3 {
+			if _, ts, result := engineGetLatest(h, tsIndex); result != 0 {
+				results[i] = -1
+			} else {
+				previous[i] = ts
+			}
+		}
+	}
+}
+
+func engineFlush(h engineHandle) int {
+	return int(int32(call(hocdbFlush, uintptr(h))))
+}
+
+func engineLoad(h engineHandle) (unsafe.Pointer, int) {
+	var outLen uintptr
+	dataPtr := call(hocdbLoad, uintptr(h), uintptr(unsafe.Pointer(&outLen)))
+	return pointer(dataPtr), int(outLen)
+}
+
+func engineQuery(h engineHandle, startTs, endTs int64, filters []engineFilter) (unsafe.Pointer, int) {
+	var filtersPtr *engineFilter
+	if len(filters) > 0 {
+		filtersPtr = &filters[0]
+	}
+	var outLen uintptr
+	dataPtr := call(hocdbQuery, uintptr(h), uintptr(startTs), uintptr(endTs), uintptr(unsafe.Pointer(filtersPtr)),
+		uintptr(len(filters)), uintptr(unsafe.Pointer(&outLen)))
+	return pointer(dataPtr), int(outLen)
+}
+
+func engineGetStats(h engineHandle, startTs, endTs int64, fieldIndex int, out *engineStats) int {
+	return int(int32(call(hocdbGetStats, uintptr(h), uintptr(startTs), uintptr(endTs), uintptr(fieldIndex), uintptr(unsafe.Pointer(out)))))
+}
+
+func engineGetLatest(h engineHandle, fieldIndex int) (float64, int64, int) {
+	var val float64
+	var ts int64
+	result := call(hocdbGetLatest, uintptr(h), uintptr(fieldIndex), uintptr(unsafe.Pointer(&val)), uintptr(unsafe.Pointer(&ts)))
+	return val, ts, int(int32(result))
+}
+
+func engineFree(p unsafe.Pointer) {
+	if _, ok := goOwned.LoadAndDelete(p); ok {
+		return
+	}
+	call(hocdbFree, uintptr(p))
+}
+
+func engineClose(h engineHandle) {
+	call(hocdbClose, uintptr(h))
+}
+
+func engineDrop(h engineHandle) {
+	call(hocdbDrop, uintptr(h))
+}
+
+// cBytes copies b to memory that engineFree frees, Go memory kept in goOwned,
+// so that no C allocator needs loading
+func cBytes(b []byte) unsafe.Pointer {
+	buf := make([]byte, max(len(b), 1))
+	copy(buf, b)
+	p := unsafe.Pointer(&buf[0])
+	goOwned.Store(p, buf)
+	return p
+}
@@ -0,0 +1,31 @@
+//go:build hocdb_purego && (darwin || linux)
+
+package hocdb
+
+import (
+	"runtime"
+
+	"github.com/ebitengine/purego"
+)
+
+// libraryName returns the file name of the library on this system
+func libraryName() string {
+	if runtime.GOOS == "darwin" {
+		return "libhocdb_c.dylib"
+	}
+	return "libhocdb_c.so"
+}
+
+// loadSymbols opens a library and looks up the addresses of functions
+func loadSymbols(name string, syms map[string]*uintptr) error {
+	lib, err := purego.Dlopen(name, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	if err != nil {
+		return err
+	}
+	for sym, addr := range syms {
+		if *addr, err = purego.Dlsym(lib, sym); err != nil {
+			return err
+		}
+	}
+	return nil
+}
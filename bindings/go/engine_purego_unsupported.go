@@ -0,0 +1,9 @@
+//go:build hocdb_purego && !(darwin || linux || windows)
+
+package hocdb
+
+// The hocdb_purego engine loads libhocdb_c on Linux, macOS and Windows only.
+// Elsewhere, FreeBSD included, the build stops on the name below rather than on
+// the engine functions missing; build without the tag to link the library.
+
+var _ = hocdb_purego_needs_linux_darwin_or_windows
@@ -0,0 +1,24 @@
+//go:build hocdb_purego && windows
+
+package hocdb
+
+import "syscall"
+
+// libraryName returns the file name of the library on this system
+func libraryName() string {
+	return "hocdb_c.dll"
+}
+
+// loadSymbols opens a library and looks up the addresses of functions
+func loadSymbols(name string, syms map[string]*uintptr) error {
+	lib, err := syscall.LoadLibrary(name)
+	if err != nil {
+		return err
+	}
+	for sym, addr := range syms {
+		if *addr, err = syscall.GetProcAddress(lib, sym); err != nil {
+			return err
+		}
+	}
+	return nil
+}
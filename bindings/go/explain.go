@@ -0,0 +1,206 @@
+package hocdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Access paths of a query, see Plan
+const (
+	PathEngine    = "engine"     // The engine searches the data file
+	PathScan      = "scan"       // A read-only database searches the data file itself
+	PathIndex     = "index"      // The records of an index's postings are read, see CreateIndex
+	PathZoneMap   = "zone map"   // The blocks zones don't rule out are read, see Options.ZoneMaps
+	PathTimeIndex = "time index" // The range is read from the data file, see Options.TimeIndex
+)
+
+// Reasons a file is skipped, see PlanFile
+const (
+	PrunedTimeRange   = "time range"
+	PrunedZoneMap     = "zone map"
+	PrunedBloomFilter = "bloom filter"
+)
+
+// Plan describes how a query would run, see Explain
+type Plan struct {
+	Start, End    int64
+	Path          string     // How the data file is read, one of the Path constants
+	Index         string     // Field of the index PathIndex reads, empty otherwise
+	Files         []PlanFile // Segments in time order, then the data file
+	EstimatedRows int64      // Records the query would read
+}
+
+// PlanFile describes the part of a query in one file
+type PlanFile struct {
+	File          string // Base name of the file
+	Segment       bool   // A compressed segment, else the data file
+	Records       int64
+	First, Last   int64  // Timestamps of the first and last records, 0 when empty
+	Blocks        int    // Blocks considered: the zones of the data file, 1 for a segment
+	BlocksPruned  int    // Blocks skipped
+	Pruned        string // Why the whole file is skipped, empty when it is read
+	EstimatedRows int64  // Records the query would read in the file
+}
+
+// Explain returns how Query would run over [startTs, endTs) with filters, without
+// running it: the access path, the files and blocks it would consider and skip,
+// and how many records it would read. Estimates for the records of segments assume
+// timestamps spread evenly. Like Query, it flushes first.
+func (db *DB) Explain(startTs, endTs int64, filters interface{}) (*Plan, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.handle == nil && db.roFile == nil {
+		return nil, errors.New("database not initialized")
+	}
+	parsed, err := db.parseFilters(filters)
+	if err != nil {
+		return nil, err
+	}
+	matchers, err := db.matchers(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Start: startTs, End: endTs, Path: PathEngine}
+	var v *fileView
+	var idx *fieldIndex
+	var postings []int64
+	dataStart := startTs
+	if db.readOnly {
+		plan.Path = PathScan
+		if v, err = db.view(); err != nil {
+			return nil, err
+		}
+		dataStart = db.tailStart(startTs)
+	} else {
+		if err := db.flush(); err != nil {
+			return nil, err
+		}
+		f, err := os.Open(db.dataFile())
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if v, err = db.dataView(f); err != nil {
+			return nil, err
+		}
+		if len(db.indexes) > 0 && len(parsed) > 0 {
+			idx, postings = db.pickIndex(parsed, matchers)
+		}
+		switch {
+		case idx != nil:
+			plan.Path, plan.Index = PathIndex, db.schema[idx.field].Name
+		case db.zoneMap != nil:
+			plan.Path = PathZoneMap
+		case db.tsIndex != nil:
+			plan.Path = PathTimeIndex
+		}
+	}
+
+	keys := zoneFilters(parsed, matchers)
+	for _, s := range db.segments {
+		pf := PlanFile{File: filepath.Base(s.file), Segment: true, Records: s.count, First: s.first, Last: s.last, Blocks: 1}
+		z := db.segZones[s.seq]
+		switch {
+		case s.first >= endTs || s.last < startTs:
+			pf.Pruned = PrunedTimeRange
+		case plan.Path == PathZoneMap && z != nil && z.excludes(startTs, endTs, keys):
+			pf.Pruned = PrunedZoneMap
+		case db.bloomExcludes(s, parsed, matchers):
+			pf.Pruned = PrunedBloomFilter
+		default:
+			pf.EstimatedRows = estimateRows(s.count, s.first, s.last, startTs, endTs)
+		}
+		if pf.Pruned != "" {
+			pf.BlocksPruned = 1
+		}
+		plan.Files = append(plan.Files, pf)
+		plan.EstimatedRows += pf.EstimatedRows
+	}
+
+	pf := PlanFile{File: filepath.Base(db.dataFile()), Records: v.count}
+	if v.count > 0 {
+		if pf.First, err = v.timestampAt(v.start); err != nil {
+			return nil, err
+		}
+		if pf.Last, err = v.timestampAt((v.start + v.count - 1) % v.count); err != nil {
+			return nil, err
+		}
+	}
+	first, err := v.search(dataStart)
+	if err != nil {
+		return nil, err
+	}
+	last, err := v.search(endTs)
+	if err != nil {
+		return nil, err
+	}
+	last = max(first, last)
+	switch plan.Path {
+	case PathIndex:
+		lo := sort.Search(len(postings), func(i int) bool { return postings[i] >= first })
+		hi := sort.Search(len(postings), func(i int) bool { return postings[i] >= last })
+		pf.EstimatedRows = int64(hi - lo)
+	case PathZoneMap:
+		pf.Blocks = len(db.zones)
+		for i, z := range db.zones {
+			if z.excludes(startTs, endTs, keys) {
+				pf.BlocksPruned++
+				continue
+			}
+			from := int64(i) * zoneBlockRecords
+			pf.EstimatedRows += max(0, min64(last, from+z.rows)-max(first, from))
+		}
+	default:
+		pf.EstimatedRows = last - first
+	}
+	if pf.EstimatedRows == 0 && (v.count == 0 || pf.First >= endTs || pf.Last < startTs) {
+		pf.Pruned = PrunedTimeRange
+	}
+	plan.Files = append(plan.Files, pf)
+	plan.EstimatedRows += pf.EstimatedRows
+	return plan, nil
+}
+
+// estimateRows estimates how many of count records with timestamps from first to
+// last are in [startTs, endTs), assuming they are spread evenly
+func estimateRows(count, first, last, startTs, endTs int64) int64 {
+	lo, hi := max(first, startTs), min64(last, endTs-1)
+	if hi < lo {
+		return 0
+	}
+	if last == first {
+		return count
+	}
+	return max(1, int64(float64(count)*(float64(hi)-float64(lo)+1)/(float64(last)-float64(first)+1)))
+}
+
+// String formats the plan one file per line, for logs and terminals
+func (p *Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "query [%d, %d) via %s", p.Start, p.End, p.Path)
+	if p.Index != "" {
+		fmt.Fprintf(&b, " on %s", p.Index)
+	}
+	fmt.Fprintf(&b, ", ~%d rows\n", p.EstimatedRows)
+	for _, f := range p.Files {
+		kind := "data file"
+		if f.Segment {
+			kind = "segment"
+		}
+		fmt.Fprintf(&b, "  %s %s: %d records [%d, %d]", kind, f.File, f.Records, f.First, f.Last)
+		switch {
+		case f.Pruned != "":
+			fmt.Fprintf(&b, ", pruned by %s\n", f.Pruned)
+		case f.Blocks > 1 || f.BlocksPruned > 0:
+			fmt.Fprintf(&b, ", %d of %d blocks pruned, ~%d rows\n", f.BlocksPruned, f.Blocks, f.EstimatedRows)
+		default:
+			fmt.Fprintf(&b, ", ~%d rows\n", f.EstimatedRows)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,137 @@
+package hocdb
+
+import (
+	"os"
+	"time"
+)
+
+// SyncMode selects what the flush policy does with pending writes
+type SyncMode int
+
+const (
+	// SyncNone leaves pending writes in the engine's buffer until it fills up or
+	// Flush is called, unless FlushEveryN or FlushInterval is set, which then flush
+	SyncNone SyncMode = iota
+	// SyncFlush hands pending writes to the operating system, so they survive a
+	// crash of the process
+	SyncFlush
+	// SyncFsync also fsyncs the data file, so writes survive a power loss. Explicit
+	// calls to Flush fsync too.
+	SyncFsync
+)
+
+func (m SyncMode) String() string {
+	switch m {
+	case SyncNone:
+		return "none"
+	case SyncFlush:
+		return "flush"
+	case SyncFsync:
+		return "fsync"
+	}
+	return "unknown"
+}
+
+// syncPolicy returns the effective mode and how many appends trigger a flush
+func (db *DB) syncPolicy() (SyncMode, int) {
+	mode, n := db.options.SyncMode, db.options.FlushEveryN
+	if mode == SyncNone && (n > 0 || db.options.FlushInterval > 0) {
+		mode = SyncFlush
+	}
+	if mode != SyncNone && n <= 0 && db.options.FlushInterval <= 0 {
+		// A mode without a schedule syncs every append
+		n = 1
+	}
+	return mode, n
+}
+
+// sync flushes pending writes and fsyncs the data file in SyncFsync mode; db.mu
+// must be held
+func (db *DB) sync() error {
+	if err := db.flush(); err != nil {
+		return err
+	}
+	if db.options.SyncMode != SyncFsync {
+		return nil
+	}
+	if err := db.wal.sync(); err != nil {
+		db.logError("fsync failed", err)
+		return err
+	}
+
+	if db.syncFile == nil {
+		f, err := os.OpenFile(db.dataFile(), os.O_RDWR, 0)
+		if err != nil {
+			db.logError("fsync failed", err)
+			return err
+		}
+		db.syncFile = f
+	}
+	if err := db.syncFile.Sync(); err != nil {
+		db.logError("fsync failed", err)
+		return err
+	}
+	if db.enc != nil {
+		if err := db.enc.file.Sync(); err != nil {
+			db.logError("fsync failed", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// countAppends applies FlushEveryN after appends and reports whether it flushed;
+// db.mu must be held
+func (db *DB) countAppends(appended int) (bool, error) {
+	mode, n := db.syncPolicy()
+	if mode == SyncNone || appended == 0 {
+		return false, nil
+	}
+	db.unflushed += appended
+	if n <= 0 || db.unflushed < n {
+		return false, nil
+	}
+	return true, db.sync()
+}
+
+// startFlusher starts the goroutine applying FlushInterval
+func (db *DB) startFlusher() {
+	if db.options.FlushInterval <= 0 {
+		return
+	}
+	db.flusherStop = make(chan struct{})
+	db.flusherDone = make(chan struct{})
+
+	go func() {
+		defer close(db.flusherDone)
+		ticker := time.NewTicker(db.options.FlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-db.flusherStop:
+				return
+			case <-ticker.C:
+			}
+
+			db.mu.Lock()
+			flushed := false
+			if db.handle != nil && db.unflushed > 0 {
+				flushed = db.sync() == nil
+			}
+			db.mu.Unlock()
+			if flushed {
+				db.afterFlush()
+			}
+		}
+	}()
+}
+
+// stopFlusher stops the FlushInterval goroutine
+func (db *DB) stopFlusher() {
+	if db.flusherStop == nil {
+		return
+	}
+	db.flusherOnce.Do(func() { close(db.flusherStop) })
+	<-db.flusherDone
+}
@@ -1,3 +1,5 @@
 module hocdb
 
-go 1.19
+go 1.21
+
+require github.com/ebitengine/purego v0.10.0
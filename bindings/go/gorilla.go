@@ -0,0 +1,287 @@
+package hocdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// EncodingGorilla stores the records of a segment column by column, timestamps as
+// delta-of-delta and F64 fields XORed with the previous value, as in Facebook's
+// Gorilla, see Compression.Encoding
+const EncodingGorilla = "gorilla"
+
+// encodeColumns encodes records of schema column by column: the timestamp field as
+// delta-of-delta, F64 fields as Gorilla XORs and the rest as their raw bytes. Each
+// column is preceded by its length.
+func encodeColumns(records []byte, schema []Field) []byte {
+	recordSize := RecordSize(schema)
+	count := len(records) / recordSize
+	tsOffset, _ := timestampOffset(schema)
+	var out []byte
+	offset := 0
+	for _, field := range schema {
+		size := field.Type.Size()
+		var column []byte
+		switch {
+		case offset == tsOffset:
+			column = encodeTimestamps(records, recordSize, offset, count)
+		case field.Type == TypeF64:
+			column = encodeFloats(records, recordSize, offset, count)
+		default:
+			column = make([]byte, 0, count*size)
+			for i := 0; i < count; i++ {
+				column = append(column, records[i*recordSize+offset:i*recordSize+offset+size]...)
+			}
+		}
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(column)))
+		out = append(out, column...)
+		offset += size
+	}
+	return out
+}
+
+// decodeColumns decodes the columns encodeColumns wrote into records in dst, which
+// holds count records of schema
+func decodeColumns(dst, data []byte, schema []Field, count int) error {
+	recordSize := RecordSize(schema)
+	tsOffset, _ := timestampOffset(schema)
+	offset := 0
+	for _, field := range schema {
+		size := field.Type.Size()
+		if len(data) < 4 || int(binary.LittleEndian.Uint32(data)) > len(data)-4 {
+			return errors.New("truncated column")
+		}
+		n := int(binary.LittleEndian.Uint32(data))
+		column := data[4 : 4+n]
+		data = data[4+n:]
+		var err error
+		switch {
+		case offset == tsOffset:
+			err = decodeTimestamps(dst, column, recordSize, offset, count)
+		case field.Type == TypeF64:
+			err = decodeFloats(dst, column, recordSize, offset, count)
+		default:
+			if len(column) != count*size {
+				return errors.New("truncated column")
+			}
+			for i := 0; i < count; i++ {
+				copy(dst[i*recordSize+offset:], column[i*size:(i+1)*size])
+			}
+		}
+		if err != nil {
+			return err
+		}
+		offset += size
+	}
+	return nil
+}
+
+// encodeTimestamps writes the first timestamp and delta in full, then the change
+// of each delta in the fewest of a few bucket sizes, a single bit for a regular
+// interval
+func encodeTimestamps(records []byte, recordSize, offset, count int) []byte {
+	var w bitWriter
+	var prev, delta int64
+	for i := 0; i < count; i++ {
+		ts := int64(binary.LittleEndian.Uint64(records[i*recordSize+offset:]))
+		switch i {
+		case 0:
+			w.write(uint64(ts), 64)
+		case 1:
+			delta = ts - prev
+			w.write(uint64(delta), 64)
+		default:
+			d := ts - prev
+			dod := d - delta
+			delta = d
+			switch {
+			case dod == 0:
+				w.write(0, 1)
+			case dod >= -64 && dod <= 63:
+				w.write(0b10, 2)
+				w.write(uint64(dod), 7)
+			case dod >= -256 && dod <= 255:
+				w.write(0b110, 3)
+				w.write(uint64(dod), 9)
+			case dod >= -2048 && dod <= 2047:
+				w.write(0b1110, 4)
+				w.write(uint64(dod), 12)
+			default:
+				w.write(0b1111, 4)
+				w.write(uint64(dod), 64)
+			}
+		}
+		prev = ts
+	}
+	return w.bytes()
+}
+
+func decodeTimestamps(dst, column []byte, recordSize, offset, count int) error {
+	r := bitReader{data: column}
+	var prev, delta int64
+	for i := 0; i < count; i++ {
+		var ts int64
+		switch i {
+		case 0:
+			ts = int64(r.read(64))
+		case 1:
+			delta = int64(r.read(64))
+			ts = prev + delta
+		default:
+			var dod int64
+			switch {
+			case r.read(1) == 0:
+			case r.read(1) == 0:
+				dod = r.readSigned(7)
+			case r.read(1) == 0:
+				dod = r.readSigned(9)
+			case r.read(1) == 0:
+				dod = r.readSigned(12)
+			default:
+				dod = int64(r.read(64))
+			}
+			delta += dod
+			ts = prev + delta
+		}
+		if r.overrun {
+			return errors.New("truncated timestamp column")
+		}
+		binary.LittleEndian.PutUint64(dst[i*recordSize+offset:], uint64(ts))
+		prev = ts
+	}
+	return nil
+}
+
+// encodeFloats writes the first value in full, then the XOR of each value with the
+// previous one: a single bit when they are equal, else its meaningful bits, within
+// the leading and trailing zeros of the previous XOR when they fit
+func encodeFloats(records []byte, recordSize, offset, count int) []byte {
+	var w bitWriter
+	var prev uint64
+	leading, trailing := -1, 0
+	for i := 0; i < count; i++ {
+		v := binary.LittleEndian.Uint64(records[i*recordSize+offset:])
+		if i == 0 {
+			w.write(v, 64)
+			prev = v
+			continue
+		}
+		xor := v ^ prev
+		prev = v
+		if xor == 0 {
+			w.write(0, 1)
+			continue
+		}
+		lz, tz := bits.LeadingZeros64(xor), bits.TrailingZeros64(xor)
+		if lz > 31 {
+			lz = 31
+		}
+		if leading >= 0 && lz >= leading && tz >= trailing {
+			w.write(0b10, 2)
+			w.write(xor>>trailing, 64-leading-trailing)
+			continue
+		}
+		leading, trailing = lz, tz
+		meaningful := 64 - lz - tz
+		w.write(0b11, 2)
+		w.write(uint64(lz), 5)
+		w.write(uint64(meaningful&63), 6) // 64 meaningful bits are written as 0
+		w.write(xor>>tz, meaningful)
+	}
+	return w.bytes()
+}
+
+func decodeFloats(dst, column []byte, recordSize, offset, count int) error {
+	r := bitReader{data: column}
+	var prev uint64
+	leading, trailing := 0, 0
+	for i := 0; i < count; i++ {
+		v := prev
+		switch {
+		case i == 0:
+			v = r.read(64)
+		case r.read(1) == 0:
+		case r.read(1) == 0:
+			v ^= r.read(64-leading-trailing) << trailing
+		default:
+			leading = int(r.read(5))
+			meaningful := int(r.read(6))
+			if meaningful == 0 {
+				meaningful = 64
+			}
+			trailing = 64 - leading - meaningful
+			if trailing < 0 {
+				return errors.New("invalid float column")
+			}
+			v ^= r.read(meaningful) << trailing
+		}
+		if r.overrun {
+			return errors.New("truncated float column")
+		}
+		binary.LittleEndian.PutUint64(dst[i*recordSize+offset:], v)
+		prev = v
+	}
+	return nil
+}
+
+// bitWriter appends values of up to 64 bits, most significant bit first
+type bitWriter struct {
+	buf  []byte
+	free int // Bits left in the last byte
+}
+
+func (w *bitWriter) write(v uint64, n int) {
+	if n < 64 {
+		v &= 1<<n - 1
+	}
+	for n > 0 {
+		if w.free == 0 {
+			w.buf = append(w.buf, 0)
+			w.free = 8
+		}
+		take := min(n, w.free)
+		w.buf[len(w.buf)-1] |= byte(v>>(n-take)) & (1<<take - 1) << (w.free - take)
+		w.free -= take
+		n -= take
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	return w.buf
+}
+
+// bitReader reads what a bitWriter wrote, reading zeros and setting overrun past
+// the end
+type bitReader struct {
+	data    []byte
+	pos     int // Bit position
+	overrun bool
+}
+
+func (r *bitReader) read(n int) uint64 {
+	var v uint64
+	for n > 0 {
+		if r.pos >= len(r.data)*8 {
+			r.overrun = true
+			return v << n
+		}
+		avail := 8 - r.pos%8
+		take := min(n, avail)
+		b := r.data[r.pos/8] >> (avail - take) & (1<<take - 1)
+		v = v<<take | uint64(b)
+		r.pos += take
+		n -= take
+	}
+	return v
+}
+
+// readSigned reads an n-bit two's complement value
+func (r *bitReader) readSigned(n int) int64 {
+	v := r.read(n)
+	if v&(1<<(n-1)) != 0 {
+		v |= math.MaxUint64 << n
+	}
+	return int64(v)
+}
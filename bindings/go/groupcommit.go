@@ -0,0 +1,116 @@
+package hocdb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// commitRequest is a record waiting for a group commit
+type commitRequest struct {
+	data []byte
+	err  error
+	ev   appendEvent
+	done chan struct{}
+}
+
+// appendGroup appends a record through group commit, used while a flush policy
+// syncs appends. The first goroutine to queue a record becomes the leader: it waits
+// for the database lock, and meanwhile other goroutines queue their records behind
+// it. The leader then appends the whole group in a single call into the engine and
+// syncs once, so concurrent writers share the cost of a sync. Every caller still
+// returns only after its own record went through the policy.
+func (db *DB) appendGroup(data []byte) error {
+	req := &commitRequest{data: data, done: make(chan struct{})}
+
+	db.groupMu.Lock()
+	db.group = append(db.group, req)
+	leader := len(db.group) == 1
+	db.groupMu.Unlock()
+
+	if leader {
+		db.mu.Lock()
+		db.groupMu.Lock()
+		group := db.group
+		db.group = nil
+		db.groupMu.Unlock()
+
+		onFlush := db.commitGroup(group)
+		db.mu.Unlock()
+
+		for _, r := range group {
+			close(r.done)
+		}
+		for _, fn := range onFlush {
+			fn()
+		}
+	}
+
+	<-req.done
+	req.ev.run()
+	return req.err
+}
+
+// commitGroup appends a group of records, applies the flush policy once and returns
+// the OnFlush callbacks to run if it synced; db.mu must be held
+func (db *DB) commitGroup(group []*commitRequest) []func() {
+	if db.handle == nil {
+		for _, r := range group {
+			r.err = errors.New("database not initialized")
+		}
+		return nil
+	}
+
+	// Records of the wrong size are rejected here, so the rest can be passed to the
+	// engine back to back
+	size := RecordSize(db.schema)
+	batch := make([]*commitRequest, 0, len(group))
+	buf := make([]byte, 0, len(group)*size)
+	for _, r := range group {
+		if len(r.data) != size {
+			r.err = errors.New("append failed: invalid record size")
+			continue
+		}
+		batch = append(batch, r)
+		buf = append(buf, r.data...)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	results := make([]int32, len(batch))
+	previous := make([]int64, len(batch))
+	e := db.readEvictions(buf)
+	engineAppendBatch(db.handle, buf, size, db.fieldMap["timestamp"], results, previous)
+	succeeded := 0
+	for _, result := range results {
+		if result == 0 {
+			succeeded++
+		}
+	}
+	db.commitEvictions(e, succeeded)
+
+	var appended []*commitRequest
+	for i, r := range batch {
+		if results[i] == -3 {
+			prev := previous[i]
+			r.err = db.orderError(r.data, &prev)
+			continue
+		}
+		if r.err = appendError(int(results[i])); r.err == nil {
+			r.ev = db.noteAppend(r.data)
+			appended = append(appended, r)
+		}
+	}
+
+	flushed, err := db.countAppends(len(appended))
+	if err != nil {
+		for _, r := range appended {
+			r.err = fmt.Errorf("record appended but not flushed: %w", err)
+		}
+		return nil
+	}
+	if flushed {
+		return db.flushHooks()
+	}
+	return nil
+}
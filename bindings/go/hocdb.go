@@ -55,18 +55,17 @@ Example usage:
 */
 package hocdb
 
-/*
-#cgo CFLAGS: -I../../bindings/c
-#cgo LDFLAGS: -L../../zig-out/lib -lhocdb_c
-#include "hocdb.h"
-#include <stdlib.h>
-*/
-import "C"
 import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hocdb/store"
+	"log/slog"
 	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
 	"unsafe"
 )
 
@@ -77,108 +76,451 @@ const (
 	TypeI64    FieldType = 1 // Signed 64-bit integer
 	TypeF64    FieldType = 2 // 64-bit floating point
 	TypeU64    FieldType = 3 // Unsigned 64-bit integer
-	TypeString FieldType = 5 // Fixed 128-byte string
+	TypeString FieldType = 5 // Fixed 128-byte string, see StringType for narrower ones
 	TypeBool   FieldType = 6 // Boolean (1 byte)
+
+	// Narrow numeric types, for values that don't need 64 bits
+	TypeU8  FieldType = 4  // Unsigned 8-bit integer
+	TypeI32 FieldType = 7  // Signed 32-bit integer
+	TypeU32 FieldType = 8  // Unsigned 32-bit integer
+	TypeF32 FieldType = 9  // 32-bit floating point
+	TypeI16 FieldType = 10 // Signed 16-bit integer
+
+	TypeBytes   FieldType = 11 // Blob of up to 256 bytes, see BytesType for other sizes
+	TypeDecimal FieldType = 12 // Exact decimal stored as a scaled int64, see DecimalType
 )
 
 // Field defines a field in the database schema
 type Field struct {
-	Name string
-	Type FieldType
+	Name     string
+	Type     FieldType
+	Nullable bool // Records may hold no value for the field, see CreateRecordBytes
 }
 
 // Stats represents statistics for a field in a time range
-type Stats struct {
-	Min   float64
-	Max   float64
-	Sum   float64
-	Count uint64
-	Mean  float64
-}
+type Stats = store.Stats
 
 // Latest represents the latest value and timestamp for a field
-type Latest struct {
-	Value     float64
-	Timestamp int64
-}
+type Latest = store.Latest
 
 // Filter represents a filter condition for queries
-type Filter struct {
-	FieldIndex int
-	Value      interface{}
-}
+type Filter = store.Filter
+
+// Store is the interface of the operations services commonly use on a database,
+// implemented by *DB and by the in-memory fake of package store, which can be used
+// without the C library
+type Store = store.Store
+
+var _ Store = (*DB)(nil)
 
 // Options contains configuration options for the database
 type Options struct {
 	MaxFileSize   int64
 	OverwriteFull bool
 	FlushOnWrite  bool
-	AutoIncrement bool
+
+	// AutoIncrement makes the database assign the timestamps of appended records
+	// itself when set, see AutoIncrement
+	AutoIncrement *AutoIncrement
+
+	// TimestampPrecision is the unit of timestamps: time.Second, time.Millisecond,
+	// time.Microsecond or time.Nanosecond, the default. time.Time values of i64
+	// fields and filters are converted to it, and DB.Time converts back. New
+	// records it, and reopening the database without one keeps the recorded one.
+	TimestampPrecision time.Duration
+
+	// Flush policy, see SyncMode. With a mode but neither FlushEveryN nor
+	// FlushInterval, every append is synced. While a policy is active, concurrent
+	// appends are group-committed and share syncs.
+	FlushEveryN   int           // Sync after this many appends
+	FlushInterval time.Duration // Sync pending appends this often
+	SyncMode      SyncMode
+
+	// AppendAsync settings, defaults are used for zero values
+	AsyncBufferSize    int           // Records queued before AppendAsync returns ErrBufferFull, 65536 by default
+	AsyncBatchSize     int           // Records appended per batch, 1024 by default
+	AsyncFlushInterval time.Duration // Longest time a queued record waits, 100ms by default
+
+	// Metrics receives measurements of appends, flushes and queries when set
+	Metrics Metrics
+
+	// Logger receives structured events when set: opens and recoveries of the data
+	// file, rotations, flush and background append failures, and slow queries
+	Logger *slog.Logger
+
+	// VerifyChecksums keeps a CRC-32C checksum of every block of 1024 records in a
+	// file next to the data file, and checks the blocks a query reads against it,
+	// so that bit rot fails the query with a *CorruptError instead of returning
+	// garbage. Records in the last, incomplete block aren't covered. Databases with
+	// OverwriteFull don't support it.
+	VerifyChecksums bool
+
+	// EncryptionKey encrypts the data file with AES-GCM when set, with a 16, 24 or
+	// 32 byte key for AES-128, AES-192 or AES-256. The engine works on a decrypted
+	// copy of the data file in a private directory under EncryptionDir, or the
+	// database's directory, which Close removes; flushes seal the records appended
+	// since the last one into the encrypted file. The plaintext copy stays on disk
+	// while the database is open, and after a crash until the database is opened
+	// again, which removes it. Opening an encrypted database without its key fails
+	// with ErrEncryptionKey, and a database that wasn't encrypted is encrypted when
+	// opened with a key. See DB.Rekey. Databases with OverwriteFull don't support
+	// it.
+	EncryptionKey []byte
+	EncryptionDir string
+
+	// Columnar keeps each field in a column file next to the data file, updated on
+	// flush, so that GetStats reads only the timestamps and the field instead of
+	// whole records. The engine still appends to its row-major data file, which
+	// the column files copy. Databases with OverwriteFull or EncryptionKey don't
+	// support it.
+	Columnar bool
+
+	// ZoneMaps keeps the range of the timestamps and of the values of each field of
+	// every block of 4096 records in a file next to the data file, updated on
+	// flush, and of every segment. Queries then skip the blocks and segments that
+	// can't hold a record in their range matching their filters, reporting how
+	// many they read and skipped to the Metrics when it implements PruningMetrics,
+	// and in SlowQuery. Zones don't track strings and bytes. Databases with
+	// OverwriteFull or EncryptionKey don't support it.
+	ZoneMaps bool
+
+	// TimeIndex keeps the timestamp of every 1024th record in a file next to the
+	// data file, updated on flush, so that queries find the start and end of their
+	// range within a stride of records instead of searching the whole data file.
+	// Databases with OverwriteFull or EncryptionKey don't support it.
+	TimeIndex bool
+
+	// Compression moves the oldest records into compressed segment files when
+	// set, see Compression. Databases with OverwriteFull or EncryptionKey don't
+	// support it.
+	Compression *Compression
+
+	// PartitionBy rolls the data file on calendar boundaries in PartitionLocation,
+	// UTC when nil, instead of by size: once an append starts a new day or month,
+	// the records of the earlier ones move into a segment file per partition,
+	// compressed when Compression is set and stored as they are otherwise, which
+	// Compression.SegmentRecords then doesn't split. Queries skip the partitions
+	// outside their range, Segments lists them for archival and DropPartition
+	// deletes them. Databases with OverwriteFull or EncryptionKey don't support it.
+	PartitionBy       Partition
+	PartitionLocation *time.Location
+
+	// MaxResultMemory bounds the bytes of a single query result when set. Query,
+	// Load and the other calls returning a whole result then read the data file
+	// in Go rather than through the engine, failing with a *QueryLimitError once
+	// the result outgrows the bound instead of materializing it, and the exports
+	// read their range in chunks of at most this size, see QueryFunc.
+	MaxResultMemory int64
+
+	// QueryParallelism is how many segments a query decompresses at once when it
+	// spans several, GOMAXPROCS by default; 1 reads them one after another.
+	// Results are merged in timestamp order either way.
+	QueryParallelism int
+
+	// ColdStorage moves the older segments to object storage when set, see
+	// ColdStorage. Databases without segments of their own, by Compression or
+	// PartitionBy, don't support it.
+	ColdStorage *ColdStorage
+
+	// Tiering moves records from the data file to segments and on to ColdStorage
+	// by age, and segments to another directory, see Tiering. It needs Compression
+	// or PartitionBy.
+	Tiering *Tiering
+
+	// WAL logs appends next to checkpoints of the database for RecoverTo, see WAL.
+	// Databases with OverwriteFull or EncryptionKey don't support it.
+	WAL *WAL
+
+	// NotifyReaders keeps a hidden file next to the data file up to date after
+	// every flush that wrote records and every rewrite of the data file, so that
+	// handles other processes opened with OpenReadOnly learn of new records
+	// without polling the data file, see DB.Wait
+	NotifyReaders bool
+
+	// SlowQueryThreshold is how long a query runs before it is logged and reported
+	// to OnSlowQuery, one second by default. A negative value disables it.
+	SlowQueryThreshold time.Duration
 }
 
-// DB represents a connection to an HOCDB database
+// AutoIncrement numbers records instead of taking their timestamps. A database
+// with records resumes after the last one, or at Start when that is later, so a
+// sequence carried over from elsewhere continues by setting Start past its end.
+type AutoIncrement struct {
+	Start int64 // First timestamp of an empty database, 1 when 0
+	Step  int64 // Distance between timestamps, 1 when 0, must not be negative
+}
+
+func (a *AutoIncrement) start() int64 {
+	if a.Start == 0 {
+		return 1
+	}
+	return a.Start
+}
+
+func (a *AutoIncrement) step() int64 {
+	if a.Step == 0 {
+		return 1
+	}
+	return a.Step
+}
+
+// DB represents a connection to an HOCDB database. It is safe for concurrent use by
+// multiple goroutines: calls into the engine are serialized by an internal mutex.
 type DB struct {
-	handle   C.HOCDBHandle
+	mu       sync.Mutex // Guards handle and every call into the engine
+	handle   engineHandle
 	fieldMap map[string]int
+	structs  sync.Map // reflect.Type to *structCodec, see AppendStruct
+	ticker   string
+	path     string
+	schema   []Field
+	options  Options
+	logger   *slog.Logger // Options.Logger with the ticker attached, if set
+
+	// Schema changes replace schema and fieldMap with both mu and schemaMu held, so
+	// code that doesn't hold mu reads them through layout
+	schemaMu sync.RWMutex
+
+	// Schema changes, see RenameField and Migrate
+	columns       []string // Names of the fields in the data file, nil unless renamed
+	schemaVersion int      // Version of the last migration applied
+
+	// Databases opened with OpenReadOnly read roFile instead of having a handle
+	readOnly bool
+	roFile   *os.File
+	tsOffset int
+	seen     changeMark // Of the database when last read, see Wait
+
+	lock *os.File  // Locked while a writable handle is open, see ErrLocked
+	head *headFile // Set with Options.NotifyReaders
+
+	subMu sync.Mutex
+	subs  map[*subscription]struct{}
+
+	hookMu sync.Mutex
+	hooks  hooks
+
+	asyncMu      sync.RWMutex
+	async        *asyncWriter
+	asyncStopped bool
+
+	groupMu sync.Mutex
+	group   []*commitRequest // Records queued for the next group commit
+
+	enc *encryption // Set with Options.EncryptionKey
+
+	checksums   []blockChecksum // Of the complete blocks of the data file, see VerifyChecksums
+	checksumsOn bool            // Whether checksums are kept
+
+	colFiles []*os.File // Column files, see Columnar
+	colRows  int64      // Number of records in the column files
+
+	indexes []*fieldIndex // See CreateIndex
+
+	zoneMap  *os.File      // Zone map of the data file, see ZoneMaps
+	zones    []*zone       // Of the blocks of the data file, the last may be incomplete
+	segZones map[int]*zone // Of the segments by sequence number, when known
+
+	blooms map[int]map[int]*bloomFilter // Of the segments by sequence number and field, once loaded
+
+	cold *coldCache // Of the segments in cold storage, set with Options.ColdStorage
+
+	warm   string    // Absolute Tiering.WarmPath, if any
+	wal    *walLog   // Write-ahead log of Options.WAL
+	tiered time.Time // When maybeCompact last applied the age policies of Tiering
+
+	tsIndex *os.File // Sparse time index, see TimeIndex
+	tsMarks []int64  // Timestamps of every timeIndexStride-th record of the data file
+	tsRows  int64    // Number of records in the data file when tsMarks was updated
+
+	// Compressed segments holding the oldest records, see Compression
+	segments     []segment
+	segCache     []byte // Records of the segment read last
+	segCacheFile string
+	segRefs      map[int]int // Snapshots of QueryFunc holding a segment, by sequence number
+	retired      []segment   // Segments dropped while a snapshot held them, deleted once released
+	compacting   bool        // Whether a background compaction is running
+	partEnd      int64       // End of the partition of the oldest record of the data file, 0 until known
+	compactWG    sync.WaitGroup
+
+	unflushed   int      // Appends since the last flush
+	syncFile    *os.File // Opened on first fsync
+	flusherStop chan struct{}
+	flusherDone chan struct{}
+	flusherOnce sync.Once
 }
 
-// New creates a new HOCDB instance with the specified schema
+// New creates a new HOCDB instance with the specified schema. Opening an existing
+// database with a schema other than the one recorded for it fails with a
+// *SchemaMismatchError.
 func New(ticker, path string, schema []Field, options Options) (*DB, error) {
-	// Convert Go strings to C strings
-	tickerC := C.CString(ticker)
-	defer C.free(unsafe.Pointer(tickerC))
+	if err := checkFeatures(schema, options.AutoIncrement != nil); err != nil {
+		return nil, err
+	}
+	file, info := statDataFile(ticker, path)
+	var logger *slog.Logger
+	if options.Logger != nil {
+		logger = options.Logger.With("ticker", ticker)
+	}
+	if err := checkNullable(schema); err != nil {
+		return nil, err
+	}
+	if err := checkPrecision(options.TimestampPrecision); err != nil {
+		return nil, err
+	}
+	if a := options.AutoIncrement; a != nil && a.Step < 0 {
+		return nil, fmt.Errorf("invalid auto-increment step %d", a.Step)
+	}
+	if options.VerifyChecksums && options.OverwriteFull {
+		return nil, errors.New("checksums need a database without OverwriteFull")
+	}
+	if options.EncryptionKey != nil && options.OverwriteFull {
+		return nil, errors.New("encryption needs a database without OverwriteFull")
+	}
+	if options.Columnar && (options.OverwriteFull || options.EncryptionKey != nil) {
+		return nil, errors.New("columnar layout needs a database without OverwriteFull or EncryptionKey")
+	}
+	if options.ZoneMaps && (options.OverwriteFull || options.EncryptionKey != nil) {
+		return nil, errors.New("zone maps need a database without OverwriteFull or EncryptionKey")
+	}
+	if options.TimeIndex && (options.OverwriteFull || options.EncryptionKey != nil) {
+		return nil, errors.New("time index needs a database without OverwriteFull or EncryptionKey")
+	}
+	if c := options.Compression; c != nil {
+		if options.OverwriteFull || options.EncryptionKey != nil {
+			return nil, errors.New("compression needs a database without OverwriteFull or EncryptionKey")
+		}
+		if err := c.check(); err != nil {
+			return nil, err
+		}
+		if err := checkBloomFilters(c.BloomFilters, schema); err != nil {
+			return nil, err
+		}
+	}
+	if p := options.PartitionBy; p != PartitionNone {
+		if p != PartitionDay && p != PartitionMonth {
+			return nil, fmt.Errorf("unknown partitioning %v", p)
+		}
+		if options.OverwriteFull || options.EncryptionKey != nil {
+			return nil, errors.New("partitioning needs a database without OverwriteFull or EncryptionKey")
+		}
+	}
+	if options.ColdStorage != nil && options.Compression == nil && options.PartitionBy == PartitionNone {
+		return nil, errors.New("cold storage needs a database with Compression or PartitionBy")
+	}
+	if options.Tiering != nil {
+		if err := options.Tiering.check(options); err != nil {
+			return nil, err
+		}
+	}
+	if w := options.WAL; w != nil {
+		if w.Dir == "" {
+			return nil, errors.New("WAL needs a directory")
+		}
+		if options.OverwriteFull || options.EncryptionKey != nil {
+			return nil, errors.New("WAL needs a database without OverwriteFull or EncryptionKey")
+		}
+	}
+	if encInfo, err := os.Stat(encryptedFile(path, ticker)); err == nil {
+		if options.EncryptionKey == nil {
+			return nil, fmt.Errorf("%w: %s is encrypted", ErrEncryptionKey, ticker)
+		}
+		file, info = encryptedFile(path, ticker), encInfo
+	}
+	var meta *metadata
+	if info != nil {
+		var err error
+		if meta, err = checkSchema(ticker, path, schema); err != nil {
+			logOpenFailure(logger, file, info, schema, err)
+			return nil, err
+		}
+		if options.TimestampPrecision, err = checkPrecisionMatch(ticker, meta, options.TimestampPrecision); err != nil {
+			logOpenFailure(logger, file, info, schema, err)
+			return nil, err
+		}
+	}
 
-	pathC := C.CString(path)
-	defer C.free(unsafe.Pointer(pathC))
+	// Taken before anything is written, so that a second writer changes nothing
+	lock, err := lockDatabase(path, ticker)
+	if err != nil {
+		logOpenFailure(logger, file, info, schema, err)
+		return nil, err
+	}
+	unlock := true // Until the handle is open, then Close releases it
+	defer func() {
+		if unlock {
+			lock.Close()
+		}
+	}()
+	head, err := openHeadFile(path, ticker, options.NotifyReaders)
+	if err != nil {
+		err = fmt.Errorf("failed to open the head file: %w", err)
+		logOpenFailure(logger, file, info, schema, err)
+		return nil, err
+	}
+	defer func() {
+		if unlock {
+			head.close(false)
+		}
+	}()
+
+	// The engine of an encrypted database works on a decrypted copy
+	dataDir := path
+	var enc *encryption
+	if options.EncryptionKey != nil {
+		if enc, err = openEncryption(ticker, path, options); err != nil {
+			logOpenFailure(logger, file, info, schema, err)
+			return nil, err
+		}
+		dataDir = enc.workDir
+		file, info = statDataFile(ticker, dataDir)
+	}
 
-	// Convert Go schema to C schema
-	cSchema := make([]C.CField, len(schema))
-	for i, field := range schema {
-		cSchema[i].name = C.CString(field.Name)
-		cSchema[i]._type = C.int(field.Type)
-		// Note: We free these C strings after the hocdb_init call
-	}
-
-	// Create C array of CField
-	var cSchemaPtr *C.CField
-	if len(cSchema) > 0 {
-		cSchemaPtr = &cSchema[0]
-	}
-
-	// Convert options
-	maxFileSize := C.int64_t(options.MaxFileSize)
-	overwriteOnFull := C.int(0)
-	if options.OverwriteFull {
-		overwriteOnFull = 1
-	}
-	flushOnWrite := C.int(0)
-	if options.FlushOnWrite {
-		flushOnWrite = 1
-	}
-	autoIncrement := C.int(0)
-	if options.AutoIncrement {
-		autoIncrement = 1
-	}
-
-	// Call C API
-	handle := C.hocdb_init(
-		tickerC,
-		pathC,
-		cSchemaPtr,
-		C.size_t(len(schema)),
-		maxFileSize,
-		overwriteOnFull,
-		flushOnWrite,
-		autoIncrement,
-	)
+	rolledBack, err := recoverBatch(ticker, path, dataDir, false)
+	if err != nil {
+		enc.close()
+		err = fmt.Errorf("failed to recover an interrupted batch commit: %w", err)
+		logOpenFailure(logger, file, info, schema, err)
+		return nil, err
+	} else if rolledBack && logger != nil {
+		logger.Warn("rolled back an interrupted batch commit", "file", file)
+	}
+	removeBatchMarkers(path)
 
-	// Free the C strings we created for schema names
-	for i := range cSchema {
-		C.free(unsafe.Pointer(cSchema[i].name))
+	segments, dropped, err := openSegments(ticker, path, schema)
+	if err == nil && len(segments) > 0 && (options.OverwriteFull || options.EncryptionKey != nil) {
+		err = errors.New("database has compressed segments, which OverwriteFull and EncryptionKey don't support")
+	}
+	if err != nil {
+		enc.close()
+		logOpenFailure(logger, file, info, schema, err)
+		return nil, err
+	} else if dropped && logger != nil {
+		logger.Warn("dropped records of an interrupted compaction", "file", file)
 	}
 
+	cold, err := openColdCache(ticker, path, options.ColdStorage)
+	if err != nil {
+		enc.close()
+		err = fmt.Errorf("failed to open the cold storage cache: %w", err)
+		logOpenFailure(logger, file, info, schema, err)
+		return nil, err
+	}
+	warm, err := openWarmPath(options.Tiering)
+	if err != nil {
+		enc.close()
+		err = fmt.Errorf("failed to open the warm tier: %w", err)
+		logOpenFailure(logger, file, info, schema, err)
+		return nil, err
+	}
+
+	columns := meta.columns()
+	handle := openHandle(ticker, dataDir, withColumns(schema, columns), options)
 	if handle == nil {
-		return nil, errors.New("failed to initialize HOCDB")
+		enc.close()
+		err := errors.New("failed to initialize HOCDB")
+		logOpenFailure(logger, file, info, schema, err)
+		return nil, err
 	}
 
 	fieldMap := make(map[string]int)
@@ -186,32 +528,189 @@ func New(ticker, path string, schema []Field, options Options) (*DB, error) {
 		fieldMap[field.Name] = i
 	}
 
-	return &DB{handle: handle, fieldMap: fieldMap}, nil
+	db := &DB{
+		handle:   handle,
+		fieldMap: fieldMap,
+		ticker:   ticker,
+		path:     path,
+		schema:   append([]Field(nil), schema...),
+		columns:  columns,
+		options:  options,
+		logger:   logger,
+		enc:      enc,
+		lock:     lock,
+		head:     head,
+		segments: segments,
+		cold:     cold,
+		warm:     warm,
+	}
+	if meta != nil {
+		db.schemaVersion = meta.SchemaVersion
+	}
+	if err := db.writeMetadata(); err != nil {
+		engineClose(handle)
+		enc.close()
+		err = fmt.Errorf("failed to write schema metadata: %w", err)
+		logOpenFailure(logger, file, info, schema, err)
+		return nil, err
+	}
+	if err := db.openChecksums(); err != nil {
+		engineClose(handle)
+		enc.close()
+		err = fmt.Errorf("failed to update checksums: %w", err)
+		logOpenFailure(logger, file, info, schema, err)
+		return nil, err
+	}
+	if err := db.openColumns(options.Columnar); err != nil {
+		engineClose(handle)
+		enc.close()
+		err = fmt.Errorf("failed to update column files: %w", err)
+		logOpenFailure(logger, file, info, schema, err)
+		return nil, err
+	}
+	if err := db.openIndexes(); err != nil {
+		engineClose(handle)
+		enc.close()
+		db.closeColumns()
+		err = fmt.Errorf("failed to update indexes: %w", err)
+		logOpenFailure(logger, file, info, schema, err)
+		return nil, err
+	}
+	if err := db.openZones(options.ZoneMaps); err != nil {
+		engineClose(handle)
+		enc.close()
+		db.closeColumns()
+		db.closeIndexes()
+		err = fmt.Errorf("failed to update zone maps: %w", err)
+		logOpenFailure(logger, file, info, schema, err)
+		return nil, err
+	}
+	if err := db.openTimeIndex(options.TimeIndex); err != nil {
+		engineClose(handle)
+		enc.close()
+		db.closeColumns()
+		db.closeIndexes()
+		db.closeZones()
+		err = fmt.Errorf("failed to update time index: %w", err)
+		logOpenFailure(logger, file, info, schema, err)
+		return nil, err
+	}
+	if rolledBack {
+		if err := db.resealAll(); err != nil {
+			engineClose(handle)
+			enc.close()
+			err = fmt.Errorf("failed to encrypt the data file: %w", err)
+			logOpenFailure(logger, file, info, schema, err)
+			return nil, err
+		}
+	}
+	db.logOpen(file, info)
+	if logger != nil && options.OverwriteFull {
+		// Mirror the write position to log rotations, nothing is pending yet
+		if cursor, err := db.writeCursor(); err == nil {
+			db.hooks.cursor = cursor
+		}
+	}
+	db.notifyReaders(true)
+	db.startFlusher()
+	unlock = false
+	if err := db.openWAL(); err != nil {
+		db.Close()
+		logOpenFailure(logger, file, info, schema, err)
+		return nil, err
+	}
+	return db, nil
+}
+
+// openHandle opens the engine's handle on a data file, nil when the engine refuses
+func openHandle(ticker, path string, schema []Field, options Options) engineHandle {
+	schema = engineSchema(schema)
+
+	handle := engineInit(ticker, path, schema, options.MaxFileSize, options.OverwriteFull, options.FlushOnWrite, options.AutoIncrement != nil)
+	if a := options.AutoIncrement; a != nil && handle != nil {
+		if engineSetAutoIncrement(handle, a.start(), a.step()) != 0 {
+			engineClose(handle)
+			return nil
+		}
+	}
+	return handle
 }
 
 // Append adds a raw record to the database
 func (db *DB) Append(data []byte) error {
+	if mode, _ := db.syncPolicy(); mode != SyncNone {
+		return db.appendGroup(data)
+	}
+
+	db.mu.Lock()
+	err := db.append(data)
+	var ev appendEvent
+	if err == nil {
+		ev = db.noteAppend(data)
+		// The record is in even when the flush policy fails to sync it
+		if flushed, syncErr := db.countAppends(1); syncErr != nil {
+			err = fmt.Errorf("record appended but not flushed: %w", syncErr)
+		} else if flushed {
+			ev.onFlush = db.flushHooks()
+		}
+	}
+	db.mu.Unlock()
+
+	ev.run()
+	return err
+}
+
+// recordBuffers holds encoding buffers for AppendValues
+var recordBuffers = sync.Pool{
+	New: func() interface{} { return new([]byte) },
+}
+
+// AppendValues encodes a record from values in schema order, like CreateRecordBytes
+// but with time.Time values in the database's TimestampPrecision, and appends it.
+// The encoding buffer is reused across calls, so appending doesn't allocate a
+// record per call.
+func (db *DB) AppendValues(values ...interface{}) error {
+	buf := recordBuffers.Get().(*[]byte)
+	defer recordBuffers.Put(buf)
+
+	schema, _ := db.layout()
+	record, err := encodeRecord(*buf, schema, db.TimestampPrecision(), values)
+	if err != nil {
+		return err
+	}
+	*buf = record
+	return db.Append(record)
+}
+
+// append calls into the engine; db.mu must be held
+func (db *DB) append(data []byte) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
 	if db.handle == nil {
 		return errors.New("database not initialized")
 	}
 
-	var dataPtr unsafe.Pointer
-	if len(data) > 0 {
-		dataPtr = unsafe.Pointer(&data[0])
+	e := db.readEvictions(data)
+	result := engineAppend(db.handle, data)
+	if result == -3 {
+		return db.orderError(data, nil)
+	}
+	if result == 0 {
+		db.commitEvictions(e, 1)
 	}
 
-	result := C.hocdb_append(
-		db.handle,
-		dataPtr,
-		C.size_t(len(data)),
-	)
+	return appendError(result)
+}
 
+// appendError converts the result of hocdb_append into an error
+func appendError(result int) error {
 	if result != 0 {
 		if result == -2 {
 			return errors.New("append failed: invalid record size")
 		}
 		if result == -3 {
-			return errors.New("append failed: timestamp not monotonic - timestamps must be strictly increasing")
+			return ErrTimestampNotMonotonic
 		}
 		return errors.New("failed to append data to HOCDB")
 	}
@@ -219,49 +718,314 @@ func (db *DB) Append(data []byte) error {
 	return nil
 }
 
+// ErrTimestampNotMonotonic is matched by the errors of appends rejected because
+// their timestamp isn't after the previous record's, see TimestampOrderError
+var ErrTimestampNotMonotonic = store.ErrTimestampNotMonotonic
+
+// TimestampOrderError reports a record that wasn't appended because its timestamp
+// is less than or equal to the one of the previous record. The engine checks every
+// append without AutoIncrement, so feed bugs surface at write time.
+type TimestampOrderError struct {
+	Timestamp int64 // Timestamp of the rejected record
+	Previous  int64 // Timestamp of the previous record
+}
+
+func (e *TimestampOrderError) Error() string {
+	return fmt.Sprintf("append failed: timestamp not monotonic - %d is not after the previous timestamp %d", e.Timestamp, e.Previous)
+}
+
+func (e *TimestampOrderError) Unwrap() error {
+	return ErrTimestampNotMonotonic
+}
+
+// orderError returns the TimestampOrderError of a record the engine rejected.
+// previous is the timestamp of the record appended before it, the engine's latest
+// one when nil. db.mu must be held.
+func (db *DB) orderError(data []byte, previous *int64) error {
+	offset, _ := timestampOffset(db.schema)
+	e := &TimestampOrderError{Timestamp: int64(binary.LittleEndian.Uint64(data[offset:]))}
+	if previous != nil {
+		e.Previous = *previous
+	} else if latest, err := db.getLatest(db.fieldMap["timestamp"]); err == nil {
+		e.Previous = latest.Timestamp
+	} else {
+		return ErrTimestampNotMonotonic
+	}
+	return e
+}
+
 // Flush forces a write of all pending data to disk
 func (db *DB) Flush() error {
+	if ok, err := db.flushAsync(); ok {
+		return err
+	}
+
+	db.mu.Lock()
+	err := db.sync()
+	db.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	db.afterFlush()
+	return nil
+}
+
+// flush is Flush without running the OnFlush callbacks; db.mu must be held
+func (db *DB) flush() error {
+	if db.readOnly && db.roFile != nil {
+		return nil
+	}
 	if db.handle == nil {
 		return errors.New("database not initialized")
 	}
 
-	result := C.hocdb_flush(db.handle)
+	if err := db.wal.write(); err != nil {
+		err = fmt.Errorf("failed to write the WAL: %w", err)
+		db.logError("flush failed", err)
+		return err
+	}
+	start := time.Now()
+	result := engineFlush(db.handle)
 
+	var err error
 	if result != 0 {
-		return errors.New("failed to flush HOCDB")
+		err = errors.New("failed to flush HOCDB")
+		db.logError("flush failed", err)
+	} else {
+		db.unflushed = 0
+		if err = db.updateChecksums(); err != nil {
+			err = fmt.Errorf("failed to update checksums: %w", err)
+			db.logError("flush failed", err)
+		} else if err = db.updateColumns(); err != nil {
+			err = fmt.Errorf("failed to update column files: %w", err)
+			db.logError("flush failed", err)
+		} else if err = db.updateIndexes(); err != nil {
+			err = fmt.Errorf("failed to update indexes: %w", err)
+			db.logError("flush failed", err)
+		} else if err = db.updateZones(); err != nil {
+			err = fmt.Errorf("failed to update zone maps: %w", err)
+			db.logError("flush failed", err)
+		} else if err = db.updateTimeIndex(); err != nil {
+			err = fmt.Errorf("failed to update time index: %w", err)
+			db.logError("flush failed", err)
+		} else if err = db.seal(); err != nil {
+			err = fmt.Errorf("failed to encrypt the data file: %w", err)
+			db.logError("flush failed", err)
+		} else {
+			db.notifyReaders(false)
+			db.maybeCompact()
+		}
+	}
+	if m := db.options.Metrics; m != nil {
+		m.ObserveFlush(time.Since(start), err)
 	}
 
-	return nil
+	return err
 }
 
 // Load retrieves all records from the database
 func (db *DB) Load() ([]byte, error) {
+	dataPtr, outLen, err := db.load()
+	if err != nil {
+		return nil, err
+	}
+
+	defer engineFree(dataPtr)
+
+	// Copy data from C memory to Go slice
+	data := goBytes(dataPtr, outLen)
+
+	return data, nil
+}
+
+// load loads all records in the engine and returns the C buffer holding them
+func (db *DB) load() (unsafe.Pointer, int, error) {
+	if db.options.MaxResultMemory > 0 {
+		// The query path stops once the result outgrows the bound
+		return db.query(math.MinInt64, math.MaxInt64, nil, nil, nil)
+	}
+	q := queryInfo{op: "Load", start: time.Now(), startTs: math.MinInt64, endTs: math.MaxInt64}
+	defer db.observeQuery(&q) // Once unlocked, see observeQuery
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.checkChecksums(math.MinInt64, math.MaxInt64); err != nil {
+		return nil, 0, err
+	}
+	if db.readOnly && db.roFile != nil {
+		dataPtr, outLen, scanned, err := db.readQuery(math.MinInt64, math.MaxInt64, nil, nil)
+		if err == nil {
+			q.scanned, q.returned, q.ok = scanned, scanned, true
+		}
+		return dataPtr, outLen, err
+	}
 	if db.handle == nil {
-		return nil, errors.New("database not initialized")
+		return nil, 0, errors.New("database not initialized")
 	}
 
-	var outLen C.size_t
-	dataPtr := C.hocdb_load(db.handle, &outLen)
+	dataPtr, outLen := engineLoad(db.handle)
 
 	if dataPtr == nil {
-		return nil, errors.New("failed to load data from HOCDB")
+		return nil, 0, errors.New("failed to load data from HOCDB")
+	}
+	dataPtr, outLen, _, err := db.withSegments(dataPtr, outLen, math.MinInt64, math.MaxInt64, nil, nil)
+	if err != nil {
+		engineFree(dataPtr)
+		return nil, 0, err
 	}
 
-	defer C.hocdb_free(dataPtr)
+	rows := outLen / RecordSize(db.schema)
+	q.scanned, q.returned, q.ok = rows, rows, true
+	return dataPtr, outLen, nil
+}
+
+// Query retrieves records within the specified time range [startTs, endTs) with optional filters
+// Filters can be passed as []Filter or map[string]interface{}
+func (db *DB) Query(startTs, endTs int64, filters interface{}) ([]byte, error) {
+	dataPtr, outLen, err := db.query(startTs, endTs, filters, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if dataPtr == nil {
+		// Query returning nil could mean error or empty result
+		// We'll treat it as empty for now (could be changed to return an error)
+		return []byte{}, nil
+	}
+
+	defer engineFree(dataPtr)
 
 	// Copy data from C memory to Go slice
-	data := C.GoBytes(dataPtr, C.int(outLen))
+	data := goBytes(dataPtr, outLen)
 
 	return data, nil
 }
 
-// Query retrieves records within the specified time range [startTs, endTs) with optional filters
-// Filters can be passed as []Filter or map[string]interface{}
-func (db *DB) Query(startTs, endTs int64, filters interface{}) ([]byte, error) {
-	if db.handle == nil {
-		return nil, errors.New("database not initialized")
+// QueryWithResult is Query, also returning how the query ran: the records and
+// bytes it read, the records it returned, the blocks and segments it read and
+// skipped, and its wall time
+func (db *DB) QueryWithResult(startTs, endTs int64, filters interface{}) ([]byte, *QueryResult, error) {
+	result := &QueryResult{}
+	dataPtr, outLen, err := db.query(startTs, endTs, filters, nil, result)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dataPtr == nil {
+		return []byte{}, result, nil
+	}
+	defer engineFree(dataPtr)
+	return goBytes(dataPtr, outLen), result, nil
+}
+
+// query runs a query in the engine and returns the C buffer holding the result,
+// nil when the engine returned none, bounded by opts and filling result unless
+// they're nil
+func (db *DB) query(startTs, endTs int64, filters interface{}, opts *QueryOpts, result *QueryResult) (unsafe.Pointer, int, error) {
+	q := queryInfo{op: "Query", start: time.Now(), startTs: startTs, endTs: endTs, filters: filters}
+	q.limit = db.newQueryLimit(opts, q.start)
+	defer func() {
+		db.observeQuery(&q) // Once unlocked, see observeQuery
+		q.result(result)
+	}()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.handle == nil && db.roFile == nil {
+		return nil, 0, errors.New("database not initialized")
+	}
+
+	parsedFilters, err := db.parseFilters(filters)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := db.checkChecksums(startTs, endTs); err != nil {
+		return nil, 0, err
+	}
+
+	if db.readOnly {
+		dataPtr, outLen, scanned, err := db.readQuery(startTs, endTs, parsedFilters, &q)
+		if err == nil {
+			q.scanned, q.returned, q.ok = scanned, outLen/RecordSize(db.schema), true
+		}
+		return dataPtr, outLen, err
+	}
+	if dataPtr, outLen, scanned, ok, err := db.indexQuery(startTs, endTs, parsedFilters, &q); ok || err != nil {
+		if err == nil {
+			q.scanned, q.returned, q.ok = scanned, outLen/RecordSize(db.schema), true
+		}
+		return dataPtr, outLen, err
+	}
+	if dataPtr, outLen, ok, err := db.zoneQuery(startTs, endTs, parsedFilters, &q); ok || err != nil {
+		if err == nil {
+			q.returned, q.ok = outLen/RecordSize(db.schema), true
+		}
+		return dataPtr, outLen, err
+	}
+	if dataPtr, outLen, ok, err := db.timeIndexQuery(startTs, endTs, parsedFilters, &q); ok || err != nil {
+		if err == nil {
+			q.returned, q.ok = outLen/RecordSize(db.schema), true
+		}
+		return dataPtr, outLen, err
+	}
+	allFilters := parsedFilters
+	parsedFilters, nullFilters := db.nullFilters(parsedFilters)
+
+	// Convert Go filters to the engine's
+	cFilters := make([]engineFilter, len(parsedFilters))
+	for i, f := range parsedFilters {
+		cFilters[i].fieldIndex = uintptr(f.FieldIndex)
+		switch v := widenFilterValue(f.Value).(type) {
+		case int64:
+			cFilters[i].typ = int32(TypeI64)
+			cFilters[i].i64 = v
+		case int:
+			cFilters[i].typ = int32(TypeI64)
+			cFilters[i].i64 = int64(v)
+		case float64:
+			cFilters[i].typ = int32(TypeF64)
+			cFilters[i].f64 = v
+		case uint64:
+			cFilters[i].typ = int32(TypeU64)
+			cFilters[i].u64 = v
+		case string:
+			cFilters[i].typ = int32(TypeString)
+			// Null-terminated within the fixed buffer
+			copy(cFilters[i].str[:127], v)
+		case bool:
+			cFilters[i].typ = int32(TypeBool)
+			cFilters[i].b = v
+		case nil:
+			return nil, 0, errors.New("nil filter value for a field that isn't nullable")
+		default:
+			return nil, 0, errors.New("unsupported filter value type")
+		}
+	}
+
+	dataPtr, outLen := engineQuery(db.handle, startTs, endTs, cFilters)
+
+	rows := outLen / RecordSize(db.schema)
+	q.bytesRead += int64(outLen) // The engine only reports the records it returned
+	if nullFilters != nil {
+		if outLen, err = db.filterResult(dataPtr, outLen, nullFilters); err != nil {
+			engineFree(dataPtr)
+			return nil, 0, err
+		}
 	}
+	dataPtr, outLen, scanned, err := db.withSegments(dataPtr, outLen, startTs, endTs, allFilters, &q)
+	if err != nil {
+		if dataPtr != nil {
+			engineFree(dataPtr)
+		}
+		return nil, 0, err
+	}
+	q.scanned, q.returned, q.ok = rows+scanned, outLen/RecordSize(db.schema), true
+	return dataPtr, outLen, nil
+}
 
+// parseFilters accepts the filters of Query as []Filter or map[string]interface{}
+func (db *DB) parseFilters(filters interface{}) ([]Filter, error) {
+	schema, fieldMap := db.layout()
 	var parsedFilters []Filter
 
 	if filters != nil {
@@ -270,7 +1034,7 @@ func (db *DB) Query(startTs, endTs int64, filters interface{}) ([]byte, error) {
 			parsedFilters = v
 		case map[string]interface{}:
 			for key, val := range v {
-				idx, ok := db.fieldMap[key]
+				idx, ok := fieldMap[key]
 				if !ok {
 					return nil, fmt.Errorf("unknown field in filter: %s", key)
 				}
@@ -284,75 +1048,36 @@ func (db *DB) Query(startTs, endTs int64, filters interface{}) ([]byte, error) {
 		}
 	}
 
-	// Convert Go filters to C filters
-	var cFiltersPtr *C.HOCDBFilter
-	if len(parsedFilters) > 0 {
-		cFilters := make([]C.HOCDBFilter, len(parsedFilters))
-		for i, f := range parsedFilters {
-			cFilters[i].field_index = C.size_t(f.FieldIndex)
-			switch v := f.Value.(type) {
-			case int64:
-				cFilters[i]._type = C.int(TypeI64)
-				cFilters[i].val_i64 = C.int64_t(v)
-			case int:
-				cFilters[i]._type = C.int(TypeI64)
-				cFilters[i].val_i64 = C.int64_t(v)
-			case float64:
-				cFilters[i]._type = C.int(TypeF64)
-				cFilters[i].val_f64 = C.double(v)
-			case uint64:
-				cFilters[i]._type = C.int(TypeU64)
-				cFilters[i].val_u64 = C.uint64_t(v)
-			case string:
-				cFilters[i]._type = C.int(TypeString)
-				// Copy string to fixed buffer
-				cStr := C.CString(v)
-				// We need to copy manually because val_string is a fixed array
-				// This is tricky in CGO directly to a struct field array.
-				// Let's use a helper or unsafe copy.
-				// Safe way:
-				var buf [128]byte
-				copy(buf[:], v)
-				// We can't assign Go array to C array directly easily.
-				// We have to cast.
-				// Actually, CGO maps char[128] to [128]C.char
-				for j := 0; j < 128 && j < len(v); j++ {
-					cFilters[i].val_string[j] = C.char(v[j])
-				}
-				cFilters[i].val_string[min(127, len(v))] = 0 // Null terminate just in case
-				C.free(unsafe.Pointer(cStr))                 // Not used actually
-			case bool:
-				cFilters[i]._type = C.int(TypeBool)
-				cFilters[i].val_bool = C.bool(v)
-			default:
-				return nil, errors.New("unsupported filter value type")
+	// Decimal fields are matched by their unscaled value, times by their timestamp
+	copied := false
+	for i, f := range parsedFilters {
+		if f.FieldIndex < 0 || f.FieldIndex >= len(schema) || f.Value == nil {
+			continue
+		}
+		field := schema[f.FieldIndex]
+		var val interface{}
+		if t, ok := f.Value.(time.Time); ok {
+			if field.Type != TypeI64 {
+				return nil, fmt.Errorf("filter on %s: time value for a %s field", field.Name, field.Type)
 			}
+			val = db.Timestamp(t)
+		} else if field.Type.IsDecimal() {
+			d, err := decimalValue(field.Type, f.Value)
+			if err != nil {
+				return nil, fmt.Errorf("filter on %s: %w", field.Name, err)
+			}
+			val = d
+		} else {
+			continue
 		}
-		cFiltersPtr = &cFilters[0]
-	}
-
-	var outLen C.size_t
-	dataPtr := C.hocdb_query(
-		db.handle,
-		C.int64_t(startTs),
-		C.int64_t(endTs),
-		cFiltersPtr,
-		C.size_t(len(parsedFilters)),
-		&outLen,
-	)
-
-	if dataPtr == nil {
-		// Query returning nil could mean error or empty result
-		// We'll treat it as empty for now (could be changed to return an error)
-		return []byte{}, nil
+		if _, ok := filters.([]Filter); ok && !copied {
+			// Leave the caller's filters alone
+			parsedFilters, copied = append([]Filter(nil), parsedFilters...), true
+		}
+		parsedFilters[i].Value = val
 	}
 
-	defer C.hocdb_free(dataPtr)
-
-	// Copy data from C memory to Go slice
-	data := C.GoBytes(dataPtr, C.int(outLen))
-
-	return data, nil
+	return parsedFilters, nil
 }
 
 func min(a, b int) int {
@@ -364,57 +1089,99 @@ func min(a, b int) int {
 
 // GetStats returns statistics for a specific field within a time range
 func (db *DB) GetStats(startTs, endTs int64, fieldIndex int) (*Stats, error) {
+	q := queryInfo{op: "GetStats", start: time.Now(), startTs: startTs, endTs: endTs}
+	defer db.observeQuery(&q) // Once unlocked, see observeQuery
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.checkChecksums(startTs, endTs); err != nil {
+		return nil, err
+	}
+	if db.readOnly && db.roFile != nil {
+		stats, err := db.readStats(startTs, endTs, fieldIndex)
+		if err == nil {
+			q.scanned, q.ok = int(stats.Count), true
+		}
+		return stats, err
+	}
 	if db.handle == nil {
 		return nil, errors.New("database not initialized")
 	}
+	if db.colFiles != nil {
+		// Records still in the engine's buffer aren't in the columns yet
+		stats, err := db.flushedStats(startTs, endTs, fieldIndex)
+		if err == nil {
+			q.scanned, q.ok = int(stats.Count), true
+		}
+		return stats, err
+	}
+	if fieldIndex >= 0 && fieldIndex < len(db.schema) && db.schema[fieldIndex].Nullable {
+		stats, err := db.nullableStats(startTs, endTs, fieldIndex)
+		if err == nil {
+			stats, err = db.segmentStats(stats, startTs, endTs, fieldIndex)
+		}
+		if err == nil {
+			q.scanned, q.ok = int(stats.Count), true
+		}
+		return stats, err
+	}
 
-	var outStats C.HOCDBStats
-	result := C.hocdb_get_stats(
-		db.handle,
-		C.int64_t(startTs),
-		C.int64_t(endTs),
-		C.size_t(fieldIndex),
-		&outStats,
-	)
+	var outStats engineStats
+	result := engineGetStats(db.handle, startTs, endTs, fieldIndex, &outStats)
 
 	if result != 0 {
 		return nil, errors.New("failed to get stats from HOCDB")
 	}
 
 	stats := &Stats{
-		Min:   float64(outStats.min),
-		Max:   float64(outStats.max),
-		Sum:   float64(outStats.sum),
-		Count: uint64(outStats.count),
-		Mean:  float64(outStats.mean),
+		Min:   outStats.min,
+		Max:   outStats.max,
+		Sum:   outStats.sum,
+		Count: outStats.count,
+		Mean:  outStats.mean,
+	}
+	stats, err := db.segmentStats(stats, startTs, endTs, fieldIndex)
+	if err != nil {
+		return nil, err
 	}
+	q.scanned, q.ok = int(stats.Count), true
 
 	return stats, nil
 }
 
 // GetLatest returns the latest value and timestamp for a specific field
 func (db *DB) GetLatest(fieldIndex int) (*Latest, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.getLatest(fieldIndex)
+}
+
+// getLatest is GetLatest for callers holding db.mu
+func (db *DB) getLatest(fieldIndex int) (*Latest, error) {
+	if db.readOnly && db.roFile != nil {
+		return db.readLatest(fieldIndex)
+	}
 	if db.handle == nil {
 		return nil, errors.New("database not initialized")
 	}
 
-	var outVal C.double
-	var outTs C.int64_t
-
-	result := C.hocdb_get_latest(
-		db.handle,
-		C.size_t(fieldIndex),
-		&outVal,
-		&outTs,
-	)
+	outVal, outTs, result := engineGetLatest(db.handle, fieldIndex)
 
 	if result != 0 {
 		return nil, errors.New("failed to get latest value from HOCDB")
 	}
 
 	latest := &Latest{
-		Value:     float64(outVal),
-		Timestamp: int64(outTs),
+		Value:     outVal,
+		Timestamp: outTs,
+	}
+	if db.schema[fieldIndex].Nullable {
+		if null, err := db.latestIsNull(fieldIndex, latest.Timestamp); err != nil || null {
+			if err == nil {
+				err = fmt.Errorf("latest %s: %w", db.schema[fieldIndex].Name, ErrNull)
+			}
+			return nil, err
+		}
 	}
 
 	return latest, nil
@@ -422,7 +1189,7 @@ func (db *DB) GetLatest(fieldIndex int) (*Latest, error) {
 
 // GetStatsByName returns statistics for a specific field by name within a time range
 func (db *DB) GetStatsByName(startTs, endTs int64, fieldName string) (*Stats, error) {
-	idx, ok := db.fieldMap[fieldName]
+	idx, ok := db.FieldIndex(fieldName)
 	if !ok {
 		return nil, fmt.Errorf("unknown field: %s", fieldName)
 	}
@@ -431,42 +1198,208 @@ func (db *DB) GetStatsByName(startTs, endTs int64, fieldName string) (*Stats, er
 
 // GetLatestByName returns the latest value and timestamp for a specific field by name
 func (db *DB) GetLatestByName(fieldName string) (*Latest, error) {
-	idx, ok := db.fieldMap[fieldName]
+	idx, ok := db.FieldIndex(fieldName)
 	if !ok {
 		return nil, fmt.Errorf("unknown field: %s", fieldName)
 	}
 	return db.GetLatest(idx)
 }
 
+// isOpen reports whether the database hasn't been closed
+func (db *DB) isOpen() bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.opened()
+}
+
+// opened is isOpen for callers holding db.mu
+func (db *DB) opened() bool {
+	return db.handle != nil || db.roFile != nil
+}
+
+// Ticker returns the ticker the database was opened with
+func (db *DB) Ticker() string {
+	return db.ticker
+}
+
+// Schema returns a copy of the schema of the database
+func (db *DB) Schema() []Field {
+	schema, _ := db.layout()
+	return append([]Field(nil), schema...)
+}
+
+// RecordSize returns the size in bytes of a record of the database
+func (db *DB) RecordSize() int {
+	schema, _ := db.layout()
+	return RecordSize(schema)
+}
+
+// FieldIndex returns the index of the named field in the schema
+func (db *DB) FieldIndex(name string) (int, bool) {
+	_, fieldMap := db.layout()
+	idx, ok := fieldMap[name]
+	return idx, ok
+}
+
+// layout returns the schema and field map of the database. Schema changes replace
+// them instead of modifying them, so callers may keep using them without db.mu.
+func (db *DB) layout() ([]Field, map[string]int) {
+	db.schemaMu.RLock()
+	defer db.schemaMu.RUnlock()
+	return db.schema, db.fieldMap
+}
+
 // Close closes the database connection and frees resources
 func (db *DB) Close() {
+	db.stopAsync()
+	db.stopFlusher()
+	db.compactWG.Wait()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.syncFile != nil {
+		db.syncFile.Close()
+		db.syncFile = nil
+	}
+	db.closeSubscriptions()
+	if db.roFile != nil {
+		db.roFile.Close()
+		db.roFile = nil
+	}
+	for _, s := range db.retired {
+		db.removeSegment(s)
+	}
+	db.retired = nil
+	db.closeColumns()
+	db.closeIndexes()
+	db.closeZones()
+	db.closeTimeIndex()
+	if err := db.wal.close(); err != nil {
+		db.logError("failed to close the WAL", err)
+	}
 	if db.handle != nil {
-		C.hocdb_close(db.handle)
+		if db.enc != nil {
+			// Seal what the engine still buffers before the plaintext goes
+			db.flush()
+		}
+		engineClose(db.handle)
 		db.handle = nil
 	}
+	if db.enc != nil {
+		db.enc.close()
+		db.enc = nil
+	}
+	db.head.close(false)
+	db.head = nil
+	if db.lock != nil {
+		db.lock.Close()
+		db.lock = nil
+	}
 }
 
-// Drop closes the database and deletes the data file
+// Drop closes the database and deletes the data file and its metadata. A read-only
+// database is only closed.
 func (db *DB) Drop() {
+	if db.readOnly {
+		db.Close()
+		return
+	}
+	db.stopAsync()
+	db.stopFlusher()
+	db.compactWG.Wait()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.syncFile != nil {
+		db.syncFile.Close()
+		db.syncFile = nil
+	}
+	db.closeSubscriptions()
+	if err := db.wal.close(); err != nil {
+		db.logError("failed to close the WAL", err)
+	}
 	if db.handle != nil {
-		C.hocdb_drop(db.handle)
+		engineDrop(db.handle)
 		db.handle = nil
+		os.Remove(db.metaFile())
+		os.Remove(db.checksumFile())
+		db.removeColumns()
+		db.removeIndexes()
+		db.removeZones()
+		db.removeTimeIndex()
+		for _, s := range append(db.segments, db.retired...) {
+			db.removeSegment(s)
+		}
+		db.segments, db.retired = nil, nil
+		if db.cold != nil {
+			os.Remove(db.cold.dir) // Unless other databases cache segments in it
+		}
+	}
+	if db.enc != nil {
+		os.Remove(db.enc.file.Name())
+		db.enc.close()
+		db.enc = nil
+	}
+	db.head.close(true)
+	db.head = nil
+	if db.lock != nil {
+		os.Remove(db.lock.Name())
+		db.lock.Close()
+		db.lock = nil
 	}
 }
 
 // CreateRecordBytes creates raw bytes for a record based on the schema and values
-// This function helps convert Go values to the required binary format
+// This function helps convert Go values to the required binary format. A nil value
+// stores a null in a nullable field, and a time.Time in an i64 field is stored in
+// nanoseconds; DB.AppendValues uses the database's TimestampPrecision instead.
 func CreateRecordBytes(schema []Field, values ...interface{}) ([]byte, error) {
+	return EncodeRecordTo(nil, schema, values...)
+}
+
+// EncodeRecordTo is CreateRecordBytes writing into dst, which is grown only when
+// the record doesn't fit. It returns the slice of dst, or of its replacement,
+// holding the record, so a loop encoding many records can reuse one buffer.
+func EncodeRecordTo(dst []byte, schema []Field, values ...interface{}) ([]byte, error) {
+	return encodeRecord(dst, schema, time.Nanosecond, values)
+}
+
+// encodeRecord is EncodeRecordTo converting time.Time values at precision
+func encodeRecord(dst []byte, schema []Field, precision time.Duration, values []interface{}) ([]byte, error) {
 	if len(values) != len(schema) {
 		return nil, errors.New("number of values doesn't match schema length")
 	}
 
-	var record []byte
+	size := RecordSize(schema)
+	if cap(dst) < size {
+		dst = make([]byte, size)
+	}
+	record := dst[:size]
+	offset, bit := 0, 0
+	nulls := record[size-nullBitmapSize(schema):]
+	for j := range nulls {
+		nulls[j] = 0
+	}
 
 	for i, field := range schema {
 		value := values[i]
+		out := record[offset : offset+field.Type.Size()]
+
+		if field.Nullable {
+			idx, mask := bit/8, byte(1)<<(bit%8)
+			bit++
+			if value == nil {
+				// Zeroed, as the engine sees the field without the bitmap
+				nulls[idx] |= mask
+				for j := range out {
+					out[j] = 0
+				}
+				offset += len(out)
+				continue
+			}
+		} else if value == nil {
+			return nil, fmt.Errorf("nil value for field %s, which isn't nullable", field.Name)
+		}
 
-		switch field.Type {
+		switch field.Type.kind() {
 		case TypeI64:
 			var val int64
 			switch v := value.(type) {
@@ -476,14 +1409,14 @@ func CreateRecordBytes(schema []Field, values ...interface{}) ([]byte, error) {
 				val = int64(v)
 			case int32:
 				val = int64(v)
+			case time.Time:
+				val = timestampOf(v, precision)
 			default:
 				return nil, errors.New("invalid type for I64 field")
 			}
 
 			// Convert to little-endian bytes
-			bytes := make([]byte, 8)
-			binary.LittleEndian.PutUint64(bytes, uint64(val))
-			record = append(record, bytes...)
+			binary.LittleEndian.PutUint64(out, uint64(val))
 
 		case TypeF64:
 			var val float64
@@ -499,9 +1432,7 @@ func CreateRecordBytes(schema []Field, values ...interface{}) ([]byte, error) {
 			}
 
 			// Convert float64 to little-endian bytes
-			bytes := make([]byte, 8)
-			binary.LittleEndian.PutUint64(bytes, math.Float64bits(val))
-			record = append(record, bytes...)
+			binary.LittleEndian.PutUint64(out, math.Float64bits(val))
 
 		case TypeU64:
 			var val uint64
@@ -520,9 +1451,7 @@ func CreateRecordBytes(schema []Field, values ...interface{}) ([]byte, error) {
 			}
 
 			// Convert to little-endian bytes
-			bytes := make([]byte, 8)
-			binary.LittleEndian.PutUint64(bytes, val)
-			record = append(record, bytes...)
+			binary.LittleEndian.PutUint64(out, val)
 
 		case TypeString:
 			var val string
@@ -533,10 +1462,34 @@ func CreateRecordBytes(schema []Field, values ...interface{}) ([]byte, error) {
 				return nil, errors.New("invalid type for String field")
 			}
 
-			// Pad with zeros to 128 bytes
-			bytes := make([]byte, 128)
-			copy(bytes, val)
-			record = append(record, bytes...)
+			// Pad with zeros to the field's width, clearing what a reused buffer held
+			n := copy(out, val)
+			for j := n; j < len(out); j++ {
+				out[j] = 0
+			}
+
+		case TypeDecimal:
+			val, err := decimalValue(field.Type, value)
+			if err != nil {
+				return nil, err
+			}
+			binary.LittleEndian.PutUint64(out, uint64(val))
+
+		case TypeBytes:
+			val, ok := value.([]byte)
+			if !ok {
+				return nil, errors.New("invalid type for Bytes field")
+			}
+			if len(val) > len(out)-2 {
+				return nil, fmt.Errorf("value of %d bytes longer than the %d bytes of the field", len(val), len(out)-2)
+			}
+
+			// Length prefix, then the payload padded with zeros
+			binary.LittleEndian.PutUint16(out, uint16(len(val)))
+			n := copy(out[2:], val)
+			for j := 2 + n; j < len(out); j++ {
+				out[j] = 0
+			}
 
 		case TypeBool:
 			var val bool
@@ -548,15 +1501,49 @@ func CreateRecordBytes(schema []Field, values ...interface{}) ([]byte, error) {
 			}
 
 			// Convert to 1 byte
-			var b byte
+			out[0] = 0
 			if val {
-				b = 1
+				out[0] = 1
+			}
+
+		case TypeI32, TypeU32, TypeI16, TypeU8:
+			val, ok := integerValue(value)
+			if !ok {
+				return nil, fmt.Errorf("invalid type for %s field", strings.ToUpper(field.Type.String()))
+			}
+			if lo, hi := field.Type.intRange(); val < lo || val > hi {
+				return nil, fmt.Errorf("value %d out of range for %s field", val, strings.ToUpper(field.Type.String()))
+			}
+
+			switch len(out) {
+			case 4:
+				binary.LittleEndian.PutUint32(out, uint32(val))
+			case 2:
+				binary.LittleEndian.PutUint16(out, uint16(val))
+			default:
+				out[0] = byte(val)
+			}
+
+		case TypeF32:
+			var val float32
+			switch v := value.(type) {
+			case float32:
+				val = v
+			case float64:
+				val = float32(v)
+			case int:
+				val = float32(v)
+			default:
+				return nil, errors.New("invalid type for F32 field")
 			}
-			record = append(record, b)
+
+			binary.LittleEndian.PutUint32(out, math.Float32bits(val))
 
 		default:
 			return nil, errors.New("unsupported field type")
 		}
+
+		offset += field.Type.Size()
 	}
 
 	return record, nil
@@ -0,0 +1,269 @@
+/*
+Package hocdbarrow converts HOCDB query results into Apache Arrow record batches.
+
+HOCDB returns records in row-major binary form. Columnar consumers (Arrow compute,
+DuckDB, Polars, Flight clients) need the data transposed into one buffer per field,
+which this package does in a single pass without decoding values into Go types.
+
+It lives in its own module so that the core hocdb bindings stay free of third-party
+dependencies.
+
+Example usage:
+
+	records, err := hocdbarrow.QueryArrow(db, start, end, nil)
+	if err != nil {
+	    panic(err)
+	}
+	for _, rec := range records {
+	    defer rec.Release()
+	    fmt.Println(rec.NumRows())
+	}
+*/
+package hocdbarrow
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hocdb"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/bitutil"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// DefaultBatchSize is the maximum number of rows per record batch returned by QueryArrow
+const DefaultBatchSize = 64 * 1024
+
+// QueryArrow runs db.Query and returns the matching records as Arrow record batches
+// of at most DefaultBatchSize rows. The caller must Release every returned record.
+func QueryArrow(db *hocdb.DB, startTs, endTs int64, filters interface{}) ([]arrow.Record, error) {
+	data, err := db.Query(startTs, endTs, filters)
+	if err != nil {
+		return nil, err
+	}
+	return Records(db.Schema(), data, DefaultBatchSize)
+}
+
+// Schema returns the Arrow schema corresponding to a HOCDB schema
+func Schema(schema []hocdb.Field) (*arrow.Schema, error) {
+	fields := make([]arrow.Field, len(schema))
+	for i, field := range schema {
+		typ, err := dataType(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		fields[i] = arrow.Field{Name: field.Name, Type: typ, Nullable: field.Nullable}
+	}
+	return arrow.NewSchema(fields, nil), nil
+}
+
+// Records transposes raw Load/Query output into record batches of at most batchSize rows
+func Records(schema []hocdb.Field, data []byte, batchSize int) ([]arrow.Record, error) {
+	arrowSchema, err := Schema(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	recordSize := hocdb.RecordSize(schema)
+	if len(data)%recordSize != 0 {
+		return nil, errors.New("data length is not a multiple of the record size")
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	numRows := len(data) / recordSize
+	var records []arrow.Record
+	for first := 0; first < numRows; first += batchSize {
+		rows := numRows - first
+		if rows > batchSize {
+			rows = batchSize
+		}
+		batch := data[first*recordSize : (first+rows)*recordSize]
+		records = append(records, newRecord(arrowSchema, schema, batch, rows))
+	}
+
+	return records, nil
+}
+
+// newRecord builds one record batch by copying each field into its own column buffer
+func newRecord(arrowSchema *arrow.Schema, schema []hocdb.Field, data []byte, rows int) arrow.Record {
+	recordSize := hocdb.RecordSize(schema)
+	columns := make([]arrow.Array, len(schema))
+	nulls := nullBitmaps(schema, data, rows)
+
+	offset := 0
+	for i, field := range schema {
+		size := field.Type.Size()
+		typ := arrowSchema.Field(i).Type
+		valid, nullCount := nulls[i].valid, nulls[i].count
+
+		switch kind(field.Type) {
+		case hocdb.TypeI64, hocdb.TypeF64, hocdb.TypeU64,
+			hocdb.TypeI32, hocdb.TypeU32, hocdb.TypeF32, hocdb.TypeI16, hocdb.TypeU8:
+			// Values are little-endian on disk, which is the Arrow buffer layout
+			values := make([]byte, rows*size)
+			for r := 0; r < rows; r++ {
+				copy(values[r*size:], data[r*recordSize+offset:r*recordSize+offset+size])
+			}
+			buffers := []*memory.Buffer{valid, memory.NewBufferBytes(values)}
+			columns[i] = array.MakeFromData(array.NewData(typ, rows, buffers, nil, nullCount, 0))
+		case hocdb.TypeBool:
+			values := make([]byte, bitutil.BytesForBits(int64(rows)))
+			for r := 0; r < rows; r++ {
+				if data[r*recordSize+offset] != 0 {
+					bitutil.SetBit(values, r)
+				}
+			}
+			buffers := []*memory.Buffer{valid, memory.NewBufferBytes(values)}
+			columns[i] = array.MakeFromData(array.NewData(typ, rows, buffers, nil, nullCount, 0))
+		case hocdb.TypeString:
+			builder := array.NewStringBuilder(memory.DefaultAllocator)
+			builder.Reserve(rows)
+			for r := 0; r < rows; r++ {
+				if !nulls[i].isValid(r) {
+					builder.AppendNull()
+					continue
+				}
+				raw := data[r*recordSize+offset : r*recordSize+offset+size]
+				builder.Append(string(trimPadding(raw)))
+			}
+			columns[i] = builder.NewArray()
+			builder.Release()
+		case hocdb.TypeDecimal:
+			// Decimal128 values are 16-byte little-endian two's complement
+			values := make([]byte, rows*16)
+			for r := 0; r < rows; r++ {
+				v := int64(binary.LittleEndian.Uint64(data[r*recordSize+offset:]))
+				binary.LittleEndian.PutUint64(values[r*16:], uint64(v))
+				binary.LittleEndian.PutUint64(values[r*16+8:], uint64(v>>63))
+			}
+			buffers := []*memory.Buffer{valid, memory.NewBufferBytes(values)}
+			columns[i] = array.MakeFromData(array.NewData(typ, rows, buffers, nil, nullCount, 0))
+		case hocdb.TypeBytes:
+			builder := array.NewBinaryBuilder(memory.DefaultAllocator, arrow.BinaryTypes.Binary)
+			builder.Reserve(rows)
+			for r := 0; r < rows; r++ {
+				if !nulls[i].isValid(r) {
+					builder.AppendNull()
+					continue
+				}
+				raw := data[r*recordSize+offset : r*recordSize+offset+size]
+				n := min(int(binary.LittleEndian.Uint16(raw)), size-2)
+				builder.Append(raw[2 : 2+n])
+			}
+			columns[i] = builder.NewArray()
+			builder.Release()
+		}
+
+		offset += size
+	}
+
+	record := array.NewRecord(arrowSchema, columns, int64(rows))
+	for _, column := range columns {
+		column.Release()
+	}
+	return record
+}
+
+// nullBitmap is the validity bitmap of a nullable column, nil for other columns
+type nullBitmap struct {
+	valid *memory.Buffer
+	count int
+}
+
+func (n nullBitmap) isValid(row int) bool {
+	return n.valid == nil || bitutil.BitIsSet(n.valid.Bytes(), row)
+}
+
+// nullBitmaps reads the null bitmaps ending the records into Arrow validity
+// bitmaps, one per field. The records hold one bit per nullable field in schema
+// order, set for nulls.
+func nullBitmaps(schema []hocdb.Field, data []byte, rows int) []nullBitmap {
+	recordSize := hocdb.RecordSize(schema)
+	nullable := 0
+	for _, field := range schema {
+		if field.Nullable {
+			nullable++
+		}
+	}
+	start := recordSize - (nullable+7)/8
+
+	bitmaps := make([]nullBitmap, len(schema))
+	bit := 0
+	for i, field := range schema {
+		if !field.Nullable {
+			continue
+		}
+		valid := make([]byte, bitutil.BytesForBits(int64(rows)))
+		count := 0
+		for r := 0; r < rows; r++ {
+			if data[r*recordSize+start+bit/8]&(1<<(bit%8)) != 0 {
+				count++
+				continue
+			}
+			bitutil.SetBit(valid, r)
+		}
+		bitmaps[i] = nullBitmap{valid: memory.NewBufferBytes(valid), count: count}
+		bit++
+	}
+	return bitmaps
+}
+
+// dataType maps a HOCDB field type onto an Arrow data type
+func dataType(t hocdb.FieldType) (arrow.DataType, error) {
+	switch kind(t) {
+	case hocdb.TypeI64:
+		return arrow.PrimitiveTypes.Int64, nil
+	case hocdb.TypeF64:
+		return arrow.PrimitiveTypes.Float64, nil
+	case hocdb.TypeU64:
+		return arrow.PrimitiveTypes.Uint64, nil
+	case hocdb.TypeString:
+		return arrow.BinaryTypes.String, nil
+	case hocdb.TypeBytes:
+		return arrow.BinaryTypes.Binary, nil
+	case hocdb.TypeDecimal:
+		return &arrow.Decimal128Type{Precision: 18, Scale: int32(t.Scale())}, nil
+	case hocdb.TypeBool:
+		return arrow.FixedWidthTypes.Boolean, nil
+	case hocdb.TypeI32:
+		return arrow.PrimitiveTypes.Int32, nil
+	case hocdb.TypeU32:
+		return arrow.PrimitiveTypes.Uint32, nil
+	case hocdb.TypeF32:
+		return arrow.PrimitiveTypes.Float32, nil
+	case hocdb.TypeI16:
+		return arrow.PrimitiveTypes.Int16, nil
+	case hocdb.TypeU8:
+		return arrow.PrimitiveTypes.Uint8, nil
+	default:
+		return nil, errors.New("unsupported field type")
+	}
+}
+
+// kind returns the type with string, blob and decimal types of any width or scale
+// as TypeString, TypeBytes and TypeDecimal
+func kind(t hocdb.FieldType) hocdb.FieldType {
+	switch {
+	case t.IsString():
+		return hocdb.TypeString
+	case t.IsBytes():
+		return hocdb.TypeBytes
+	case t.IsDecimal():
+		return hocdb.TypeDecimal
+	}
+	return t
+}
+
+// trimPadding strips the zero padding from a fixed-size string field
+func trimPadding(raw []byte) []byte {
+	for i, b := range raw {
+		if b == 0 {
+			return raw[:i]
+		}
+	}
+	return raw
+}
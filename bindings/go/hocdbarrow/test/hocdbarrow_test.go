@@ -0,0 +1,86 @@
+package hocdbarrow_test
+
+import (
+	"hocdb"
+	"hocdb/hocdbarrow"
+	"os"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+)
+
+func TestQueryArrow(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "volume", Type: hocdb.TypeU64},
+		{Name: "event", Type: hocdb.TypeString},
+		{Name: "active", Type: hocdb.TypeBool},
+	}
+
+	testDir := "../../../../b_go_test_data_arrow"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New("ARROW_TEST", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	for i := 1; i <= 5; i++ {
+		record, _ := hocdb.CreateRecordBytes(schema, int64(i), float64(i)*1.5, uint64(i*10), "fill", i%2 == 0)
+		db.Append(record)
+	}
+
+	records, err := hocdbarrow.QueryArrow(db, 2, 6, nil)
+	if err != nil {
+		t.Fatalf("QueryArrow failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record batch, got %d", len(records))
+	}
+	rec := records[0]
+	defer rec.Release()
+
+	if rec.NumRows() != 4 || rec.NumCols() != 5 {
+		t.Fatalf("Expected 4x5 batch, got %dx%d", rec.NumRows(), rec.NumCols())
+	}
+
+	ts := rec.Column(0).(*array.Int64)
+	price := rec.Column(1).(*array.Float64)
+	volume := rec.Column(2).(*array.Uint64)
+	event := rec.Column(3).(*array.String)
+	active := rec.Column(4).(*array.Boolean)
+
+	if ts.Value(0) != 2 || price.Value(0) != 3.0 || volume.Value(0) != 20 || event.Value(0) != "fill" || !active.Value(0) {
+		t.Errorf("Unexpected first row: %d %f %d %q %v", ts.Value(0), price.Value(0), volume.Value(0), event.Value(0), active.Value(0))
+	}
+	if ts.Value(3) != 5 || active.Value(3) {
+		t.Errorf("Unexpected last row: %d %v", ts.Value(3), active.Value(3))
+	}
+}
+
+func TestRecordsBatching(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "value", Type: hocdb.TypeF64},
+	}
+
+	var data []byte
+	for i := 0; i < 10; i++ {
+		record, _ := hocdb.CreateRecordBytes(schema, int64(i), float64(i))
+		data = append(data, record...)
+	}
+
+	records, err := hocdbarrow.Records(schema, data, 4)
+	if err != nil {
+		t.Fatalf("Records failed: %v", err)
+	}
+	if len(records) != 3 || records[2].NumRows() != 2 {
+		t.Fatalf("Expected batches of 4, 4 and 2 rows, got %d batches", len(records))
+	}
+	for _, rec := range records {
+		rec.Release()
+	}
+}
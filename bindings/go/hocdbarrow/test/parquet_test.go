@@ -0,0 +1,145 @@
+package hocdbarrow_test
+
+import (
+	"bytes"
+	"context"
+	"hocdb"
+	"os"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// readParquet decodes an exported file with the arrow-go Parquet reader
+func readParquet(t *testing.T, file []byte) arrow.Table {
+	t.Helper()
+	table, err := pqarrow.ReadTable(context.Background(), bytes.NewReader(file), nil, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		t.Fatalf("Failed to read Parquet file: %v", err)
+	}
+	return table
+}
+
+func TestExportParquet(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "event", Type: hocdb.TypeString},
+		{Name: "active", Type: hocdb.TypeBool},
+	}
+
+	testDir := "../../../../b_go_test_data_parquet"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New("PARQUET_TEST", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	for i := 1; i <= 10; i++ {
+		record, _ := hocdb.CreateRecordBytes(schema, int64(i), float64(i)*1.5, "trade", i%2 == 0)
+		db.Append(record)
+	}
+
+	var buf bytes.Buffer
+	if err := db.ExportParquet(&buf, 0, 100); err != nil {
+		t.Fatalf("ExportParquet failed: %v", err)
+	}
+
+	table := readParquet(t, buf.Bytes())
+	defer table.Release()
+
+	if table.NumRows() != 10 || table.NumCols() != int64(len(schema)) {
+		t.Fatalf("Expected 10x%d table, got %dx%d", len(schema), table.NumRows(), table.NumCols())
+	}
+
+	wantTypes := []arrow.DataType{arrow.PrimitiveTypes.Int64, arrow.PrimitiveTypes.Float64, arrow.BinaryTypes.String, arrow.FixedWidthTypes.Boolean}
+	for i, field := range schema {
+		col := table.Schema().Field(i)
+		if col.Name != field.Name || !arrow.TypeEqual(col.Type, wantTypes[i]) {
+			t.Errorf("Column %d: expected %s %s, got %s %s", i, field.Name, wantTypes[i], col.Name, col.Type)
+		}
+		if col.Nullable {
+			t.Errorf("Column %s should be required", col.Name)
+		}
+	}
+
+	ts := table.Column(0).Data().Chunk(0).(*array.Int64)
+	price := table.Column(1).Data().Chunk(0).(*array.Float64)
+	event := table.Column(2).Data().Chunk(0).(*array.String)
+	active := table.Column(3).Data().Chunk(0).(*array.Boolean)
+	for r := 0; r < 10; r++ {
+		i := r + 1
+		if ts.Value(r) != int64(i) || price.Value(r) != float64(i)*1.5 || event.Value(r) != "trade" || active.Value(r) != (i%2 == 0) {
+			t.Errorf("Unexpected row %d: %d %f %q %v", r, ts.Value(r), price.Value(r), event.Value(r), active.Value(r))
+		}
+	}
+}
+
+func TestExportParquetNullable(t *testing.T) {
+	schema, err := hocdb.ParseSchema("timestamp:i64,price:f64?,qty:i32?,note:string(8)?,active:bool?")
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+
+	testDir := "../../../../b_go_test_data_parquet_nullable"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New("PARQUET_NULLS", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	// Every third record is null in all the nullable fields
+	for i := 1; i <= 9; i++ {
+		if i%3 == 0 {
+			err = db.AppendValues(int64(i), nil, nil, nil, nil)
+		} else {
+			err = db.AppendValues(int64(i), float64(i)*1.5, int32(-i), "fill", i%2 == 0)
+		}
+		if err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := db.ExportParquet(&buf, 0, 100); err != nil {
+		t.Fatalf("ExportParquet failed: %v", err)
+	}
+
+	table := readParquet(t, buf.Bytes())
+	defer table.Release()
+
+	if table.NumRows() != 9 {
+		t.Fatalf("Expected 9 rows, got %d", table.NumRows())
+	}
+	for i, field := range schema {
+		if col := table.Schema().Field(i); col.Nullable != field.Nullable {
+			t.Errorf("Column %s: expected nullable %v, got %v", col.Name, field.Nullable, col.Nullable)
+		}
+	}
+
+	price := table.Column(1).Data().Chunk(0).(*array.Float64)
+	qty := table.Column(2).Data().Chunk(0).(*array.Int32)
+	note := table.Column(3).Data().Chunk(0).(*array.String)
+	active := table.Column(4).Data().Chunk(0).(*array.Boolean)
+	for r := 0; r < 9; r++ {
+		i := r + 1
+		if i%3 == 0 {
+			if !price.IsNull(r) || !qty.IsNull(r) || !note.IsNull(r) || !active.IsNull(r) {
+				t.Errorf("Expected nulls in row %d", r)
+			}
+			continue
+		}
+		if price.IsNull(r) || price.Value(r) != float64(i)*1.5 || qty.Value(r) != int32(-i) || note.Value(r) != "fill" || active.Value(r) != (i%2 == 0) {
+			t.Errorf("Unexpected row %d: %f %d %q %v", r, price.Value(r), qty.Value(r), note.Value(r), active.Value(r))
+		}
+	}
+}
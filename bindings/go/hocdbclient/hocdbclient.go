@@ -0,0 +1,321 @@
+/*
+Package hocdbclient is a pure-Go client for hocdbserver. It mirrors the DB interface
+of the hocdb bindings without CGO, so programs can use a central HOCDB node from any
+machine and build with CGO_ENABLED=0.
+
+Because the hocdb package itself requires CGO, the types shared with it (Field,
+FieldType, Filter, Stats, Latest) and CreateRecordBytes are duplicated here with the
+same names and semantics.
+
+Example usage:
+
+	client, err := hocdbclient.Dial("localhost:50051", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+	    panic(err)
+	}
+	defer client.Close()
+
+	db, err := client.Open("BTC_USD")
+	if err != nil {
+	    panic(err)
+	}
+
+	record, err := hocdbclient.CreateRecordBytes(db.Schema(), int64(1620000000), 50000.0, 1.5)
+	if err != nil {
+	    panic(err)
+	}
+	err = db.Append(record)
+*/
+package hocdbclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"hocdb/hocdbserver/hocdbpb"
+
+	"google.golang.org/grpc"
+)
+
+// FieldType represents the type of data stored in each field
+type FieldType int
+
+const (
+	TypeI64    FieldType = 1 // Signed 64-bit integer
+	TypeF64    FieldType = 2 // 64-bit floating point
+	TypeU64    FieldType = 3 // Unsigned 64-bit integer
+	TypeString FieldType = 5 // Fixed 128-byte string, see StringType for narrower ones
+	TypeBool   FieldType = 6 // Boolean (1 byte)
+
+	// Narrow numeric types, for values that don't need 64 bits
+	TypeU8  FieldType = 4  // Unsigned 8-bit integer
+	TypeI32 FieldType = 7  // Signed 32-bit integer
+	TypeU32 FieldType = 8  // Unsigned 32-bit integer
+	TypeF32 FieldType = 9  // 32-bit floating point
+	TypeI16 FieldType = 10 // Signed 16-bit integer
+
+	TypeBytes   FieldType = 11 // Blob of up to 256 bytes, see BytesType for other sizes
+	TypeDecimal FieldType = 12 // Exact decimal stored as a scaled int64, see DecimalType
+)
+
+// Field defines a field in the database schema
+type Field struct {
+	Name     string
+	Type     FieldType
+	Nullable bool // Records may hold no value for the field, see CreateRecordBytes
+}
+
+// Stats represents statistics for a field in a time range
+type Stats struct {
+	Min   float64
+	Max   float64
+	Sum   float64
+	Count uint64
+	Mean  float64
+}
+
+// Latest represents the latest value and timestamp for a field
+type Latest struct {
+	Value     float64
+	Timestamp int64
+}
+
+// Filter represents a filter condition for queries
+type Filter struct {
+	FieldIndex int
+	Value      interface{}
+}
+
+// Client is a connection to a hocdbserver
+type Client struct {
+	conn   *grpc.ClientConn
+	client hocdbpb.HOCDBServiceClient
+}
+
+// Dial connects to a hocdbserver at target
+func Dial(target string, opts ...grpc.DialOption) (*Client, error) {
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, client: hocdbpb.NewHOCDBServiceClient(conn)}, nil
+}
+
+// NewClient wraps an existing gRPC connection. Close doesn't close it.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{client: hocdbpb.NewHOCDBServiceClient(cc)}
+}
+
+// Close closes the connection opened by Dial
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// Tickers returns the names of the tickers served by the server
+func (c *Client) Tickers(ctx context.Context) ([]string, error) {
+	resp, err := c.client.ListTickers(ctx, &hocdbpb.ListTickersRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Tickers, nil
+}
+
+// Open returns a handle to a ticker served by the server
+func (c *Client) Open(ticker string) (*DB, error) {
+	resp, err := c.client.Schema(context.Background(), &hocdbpb.SchemaRequest{Ticker: ticker})
+	if err != nil {
+		return nil, err
+	}
+
+	db := &DB{
+		client:   c.client,
+		ctx:      context.Background(),
+		ticker:   ticker,
+		fieldMap: make(map[string]int, len(resp.Fields)),
+	}
+	for i, f := range resp.Fields {
+		db.schema = append(db.schema, Field{Name: f.Name, Type: FieldType(f.Type), Nullable: f.Nullable})
+		db.fieldMap[f.Name] = i
+	}
+	return db, nil
+}
+
+// DB is a remote ticker with the same methods as hocdb.DB
+type DB struct {
+	client   hocdbpb.HOCDBServiceClient
+	ctx      context.Context
+	ticker   string
+	schema   []Field
+	fieldMap map[string]int
+}
+
+// WithContext returns a copy of db whose calls use ctx for deadlines and cancellation
+func (db *DB) WithContext(ctx context.Context) *DB {
+	c := *db
+	c.ctx = ctx
+	return &c
+}
+
+// Schema returns a copy of the ticker's schema
+func (db *DB) Schema() []Field {
+	return append([]Field(nil), db.schema...)
+}
+
+// RecordSize returns the size in bytes of a record of the ticker
+func (db *DB) RecordSize() int {
+	return RecordSize(db.schema)
+}
+
+// FieldIndex returns the index of the named field in the schema
+func (db *DB) FieldIndex(name string) (int, bool) {
+	idx, ok := db.fieldMap[name]
+	return idx, ok
+}
+
+// Append adds one or more raw records to the database
+func (db *DB) Append(data []byte) error {
+	_, err := db.client.Append(db.ctx, &hocdbpb.AppendRequest{Ticker: db.ticker, Records: data})
+	return err
+}
+
+// Flush forces a write of all pending data to disk
+func (db *DB) Flush() error {
+	_, err := db.client.Flush(db.ctx, &hocdbpb.FlushRequest{Ticker: db.ticker})
+	return err
+}
+
+// Load retrieves all records from the database
+func (db *DB) Load() ([]byte, error) {
+	return db.Query(math.MinInt64, math.MaxInt64, nil)
+}
+
+// Query retrieves records within the specified time range [startTs, endTs) with optional filters
+// Filters can be passed as []Filter or map[string]interface{}
+func (db *DB) Query(startTs, endTs int64, filters interface{}) ([]byte, error) {
+	req := &hocdbpb.QueryRequest{Ticker: db.ticker, StartTs: startTs, EndTs: endTs}
+
+	switch v := filters.(type) {
+	case nil:
+	case []Filter:
+		for _, f := range v {
+			if f.FieldIndex < 0 || f.FieldIndex >= len(db.schema) {
+				return nil, fmt.Errorf("invalid field index in filter: %d", f.FieldIndex)
+			}
+			pf, err := queryFilter(db.schema[f.FieldIndex].Name, f.Value)
+			if err != nil {
+				return nil, err
+			}
+			req.Filters = append(req.Filters, pf)
+		}
+	case map[string]interface{}:
+		for name, val := range v {
+			if _, ok := db.fieldMap[name]; !ok {
+				return nil, fmt.Errorf("unknown field in filter: %s", name)
+			}
+			pf, err := queryFilter(name, val)
+			if err != nil {
+				return nil, err
+			}
+			req.Filters = append(req.Filters, pf)
+		}
+	default:
+		return nil, errors.New("invalid filters type: expected []Filter or map[string]interface{}")
+	}
+
+	stream, err := db.client.Query(db.ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	data := []byte{}
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, resp.Records...)
+	}
+}
+
+// queryFilter converts a filter value into its protobuf form
+func queryFilter(field string, value interface{}) (*hocdbpb.Filter, error) {
+	f := &hocdbpb.Filter{Field: field}
+	switch v := value.(type) {
+	case int64:
+		f.Value = &hocdbpb.Filter_I64{I64: v}
+	case int:
+		f.Value = &hocdbpb.Filter_I64{I64: int64(v)}
+	case int32:
+		f.Value = &hocdbpb.Filter_I64{I64: int64(v)}
+	case int16:
+		f.Value = &hocdbpb.Filter_I64{I64: int64(v)}
+	case float64:
+		f.Value = &hocdbpb.Filter_F64{F64: v}
+	case float32:
+		f.Value = &hocdbpb.Filter_F64{F64: float64(v)}
+	case uint64:
+		f.Value = &hocdbpb.Filter_U64{U64: v}
+	case uint32:
+		f.Value = &hocdbpb.Filter_U64{U64: uint64(v)}
+	case uint8:
+		f.Value = &hocdbpb.Filter_U64{U64: uint64(v)}
+	case string:
+		f.Value = &hocdbpb.Filter_Str{Str: v}
+	case bool:
+		f.Value = &hocdbpb.Filter_Bool{Bool: v}
+	default:
+		return nil, errors.New("unsupported filter value type")
+	}
+	return f, nil
+}
+
+// GetStats returns statistics for a specific field within a time range
+func (db *DB) GetStats(startTs, endTs int64, fieldIndex int) (*Stats, error) {
+	if fieldIndex < 0 || fieldIndex >= len(db.schema) {
+		return nil, fmt.Errorf("invalid field index: %d", fieldIndex)
+	}
+	return db.GetStatsByName(startTs, endTs, db.schema[fieldIndex].Name)
+}
+
+// GetStatsByName returns statistics for a specific field by name within a time range
+func (db *DB) GetStatsByName(startTs, endTs int64, fieldName string) (*Stats, error) {
+	resp, err := db.client.Stats(db.ctx, &hocdbpb.StatsRequest{
+		Ticker:  db.ticker,
+		StartTs: startTs,
+		EndTs:   endTs,
+		Field:   fieldName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Stats{Min: resp.Min, Max: resp.Max, Sum: resp.Sum, Count: resp.Count, Mean: resp.Mean}, nil
+}
+
+// GetLatest returns the latest value and timestamp for a specific field
+func (db *DB) GetLatest(fieldIndex int) (*Latest, error) {
+	if fieldIndex < 0 || fieldIndex >= len(db.schema) {
+		return nil, fmt.Errorf("invalid field index: %d", fieldIndex)
+	}
+	return db.GetLatestByName(db.schema[fieldIndex].Name)
+}
+
+// GetLatestByName returns the latest value and timestamp for a specific field by name
+func (db *DB) GetLatestByName(fieldName string) (*Latest, error) {
+	resp, err := db.client.Latest(db.ctx, &hocdbpb.LatestRequest{Ticker: db.ticker, Field: fieldName})
+	if err != nil {
+		return nil, err
+	}
+	return &Latest{Value: resp.Value, Timestamp: resp.Timestamp}, nil
+}
+
+// Close releases the handle. The ticker stays open on the server.
+func (db *DB) Close() {}
@@ -0,0 +1,338 @@
+package hocdbclient
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// stringFieldSize is the fixed on-disk width of a TypeString field
+const stringFieldSize = 128
+
+// StringType returns the type of string fields width bytes wide, from 1 to 128,
+// like hocdb.StringType
+func StringType(width int) FieldType {
+	if width == stringFieldSize {
+		return TypeString
+	}
+	return FieldType(width<<8) | TypeString
+}
+
+// bytesFieldSize is the capacity of a TypeBytes field
+const bytesFieldSize = 256
+
+// BytesType returns the type of blob fields holding up to capacity bytes, from 1 to
+// 65535, like hocdb.BytesType
+func BytesType(capacity int) FieldType {
+	if capacity == bytesFieldSize {
+		return TypeBytes
+	}
+	return FieldType(capacity<<8) | TypeBytes
+}
+
+// bytesCapacity returns the capacity of a blob type, 0 for other types
+func bytesCapacity(t FieldType) int {
+	switch {
+	case t == TypeBytes:
+		return bytesFieldSize
+	case t&0xff == TypeBytes && t>>8 > 0 && t>>8 <= math.MaxUint16:
+		return int(t >> 8)
+	default:
+		return 0
+	}
+}
+
+// DecimalType returns the type of exact decimal fields with scale digits after the
+// decimal point, from 0 to 18, like hocdb.DecimalType
+func DecimalType(scale int) FieldType {
+	return FieldType(scale<<8) | TypeDecimal
+}
+
+// stringWidth returns the width of a string type, 0 for other types
+func stringWidth(t FieldType) int {
+	switch {
+	case t == TypeString:
+		return stringFieldSize
+	case t&0xff == TypeString && t>>8 > 0 && t>>8 < stringFieldSize:
+		return int(t >> 8)
+	default:
+		return 0
+	}
+}
+
+// RecordSize returns the size in bytes of a single record for the given schema
+func RecordSize(schema []Field) int {
+	size := 0
+	for _, field := range schema {
+		if width := stringWidth(field.Type); width > 0 {
+			size += width
+			continue
+		}
+		if capacity := bytesCapacity(field.Type); capacity > 0 {
+			size += 2 + capacity
+			continue
+		}
+		if field.Type&0xff == TypeDecimal {
+			size += 8
+			continue
+		}
+		switch field.Type {
+		case TypeI64, TypeF64, TypeU64:
+			size += 8
+		case TypeI32, TypeU32, TypeF32:
+			size += 4
+		case TypeI16:
+			size += 2
+		case TypeBool, TypeU8:
+			size++
+		}
+	}
+	return size + nullBitmapSize(schema)
+}
+
+// CreateRecordBytes creates raw bytes for a record based on the schema and values,
+// accepting the same Go types as hocdb.CreateRecordBytes
+func CreateRecordBytes(schema []Field, values ...interface{}) ([]byte, error) {
+	if len(values) != len(schema) {
+		return nil, errors.New("number of values doesn't match schema length")
+	}
+
+	record := make([]byte, 0, RecordSize(schema))
+	nulls, bit := make([]byte, nullBitmapSize(schema)), 0
+	for i, field := range schema {
+		if field.Nullable {
+			if values[i] == nil {
+				nulls[bit/8] |= 1 << (bit % 8)
+				bit++
+				record = append(record, make([]byte, RecordSize([]Field{{Type: field.Type}}))...)
+				continue
+			}
+			bit++
+		} else if values[i] == nil {
+			return nil, fmt.Errorf("nil value for field %s, which isn't nullable", field.Name)
+		}
+		typ := field.Type
+		if stringWidth(typ) > 0 {
+			typ = TypeString
+		} else if bytesCapacity(typ) > 0 {
+			typ = TypeBytes
+		} else if typ&0xff == TypeDecimal {
+			typ = TypeDecimal
+		}
+		switch typ {
+		case TypeI64:
+			var val int64
+			switch v := values[i].(type) {
+			case int64:
+				val = v
+			case int:
+				val = int64(v)
+			case int32:
+				val = int64(v)
+			default:
+				return nil, errors.New("invalid type for I64 field")
+			}
+			record = binary.LittleEndian.AppendUint64(record, uint64(val))
+
+		case TypeF64:
+			var val float64
+			switch v := values[i].(type) {
+			case float64:
+				val = v
+			case float32:
+				val = float64(v)
+			case int:
+				val = float64(v)
+			default:
+				return nil, errors.New("invalid type for F64 field")
+			}
+			record = binary.LittleEndian.AppendUint64(record, math.Float64bits(val))
+
+		case TypeU64:
+			var val uint64
+			switch v := values[i].(type) {
+			case uint64:
+				val = v
+			case uint:
+				val = uint64(v)
+			case int:
+				if v < 0 {
+					return nil, errors.New("negative value for U64 field")
+				}
+				val = uint64(v)
+			default:
+				return nil, errors.New("invalid type for U64 field")
+			}
+			record = binary.LittleEndian.AppendUint64(record, val)
+
+		case TypeString:
+			v, ok := values[i].(string)
+			if !ok {
+				return nil, errors.New("invalid type for String field")
+			}
+			padded := make([]byte, stringWidth(field.Type))
+			copy(padded, v)
+			record = append(record, padded...)
+
+		case TypeDecimal:
+			val, err := decimalValue(int(field.Type>>8), values[i])
+			if err != nil {
+				return nil, err
+			}
+			record = binary.LittleEndian.AppendUint64(record, uint64(val))
+
+		case TypeBytes:
+			v, ok := values[i].([]byte)
+			if !ok {
+				return nil, errors.New("invalid type for Bytes field")
+			}
+			capacity := bytesCapacity(field.Type)
+			if len(v) > capacity {
+				return nil, fmt.Errorf("value of %d bytes longer than the %d bytes of the field", len(v), capacity)
+			}
+			record = binary.LittleEndian.AppendUint16(record, uint16(len(v)))
+			record = append(record, v...)
+			record = append(record, make([]byte, capacity-len(v))...)
+
+		case TypeBool:
+			v, ok := values[i].(bool)
+			if !ok {
+				return nil, errors.New("invalid type for Bool field")
+			}
+			if v {
+				record = append(record, 1)
+			} else {
+				record = append(record, 0)
+			}
+
+		case TypeI32, TypeU32, TypeI16, TypeU8:
+			val, ok := integerValue(values[i])
+			if !ok {
+				return nil, fmt.Errorf("invalid type for %s field", narrowNames[field.Type])
+			}
+			lo, hi := intRange(field.Type)
+			if val < lo || val > hi {
+				return nil, fmt.Errorf("value %d out of range for %s field", val, narrowNames[field.Type])
+			}
+			switch field.Type {
+			case TypeI32, TypeU32:
+				record = binary.LittleEndian.AppendUint32(record, uint32(val))
+			case TypeI16:
+				record = binary.LittleEndian.AppendUint16(record, uint16(val))
+			default:
+				record = append(record, byte(val))
+			}
+
+		case TypeF32:
+			var val float32
+			switch v := values[i].(type) {
+			case float32:
+				val = v
+			case float64:
+				val = float32(v)
+			case int:
+				val = float32(v)
+			default:
+				return nil, errors.New("invalid type for F32 field")
+			}
+			record = binary.LittleEndian.AppendUint32(record, math.Float32bits(val))
+
+		default:
+			return nil, errors.New("unsupported field type")
+		}
+	}
+
+	return append(record, nulls...), nil
+}
+
+// nullBitmapSize returns the size of the bitmap of nulls ending the records of a
+// schema, one bit per nullable field, like hocdb's
+func nullBitmapSize(schema []Field) int {
+	n := 0
+	for _, field := range schema {
+		if field.Nullable {
+			n++
+		}
+	}
+	return (n + 7) / 8
+}
+
+// narrowNames names the narrow integer types in errors
+var narrowNames = map[FieldType]string{TypeI32: "I32", TypeU32: "U32", TypeI16: "I16", TypeU8: "U8"}
+
+// intRange returns the range of values of a narrow integer type
+func intRange(t FieldType) (int64, int64) {
+	switch t {
+	case TypeI32:
+		return math.MinInt32, math.MaxInt32
+	case TypeU32:
+		return 0, math.MaxUint32
+	case TypeI16:
+		return math.MinInt16, math.MaxInt16
+	default:
+		return 0, math.MaxUint8
+	}
+}
+
+// integerValue converts any Go integer to int64, for the narrow integer types
+func integerValue(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case uint32:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// decimalValue converts a Go value to the unscaled value of a decimal field with
+// the given scale, accepting the same values as hocdb.CreateRecordBytes
+func decimalValue(scale int, v interface{}) (int64, error) {
+	var r *big.Rat
+	switch v := v.(type) {
+	case *big.Rat:
+		r = v
+	case interface{ Rat() *big.Rat }:
+		r = v.Rat()
+	case string:
+		r, _ = new(big.Rat).SetString(v)
+	case float64:
+		r, _ = new(big.Rat).SetString(strconv.FormatFloat(v, 'g', -1, 64))
+	case float32:
+		r, _ = new(big.Rat).SetString(strconv.FormatFloat(float64(v), 'g', -1, 32))
+	default:
+		i, ok := integerValue(v)
+		if !ok {
+			return 0, errors.New("invalid type for Decimal field")
+		}
+		r = new(big.Rat).SetInt64(i)
+	}
+	if r == nil || scale > 18 {
+		return 0, fmt.Errorf("invalid value %v for decimal(%d) field", v, scale)
+	}
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+	if !scaled.IsInt() || !scaled.Num().IsInt64() {
+		return 0, fmt.Errorf("%s doesn't fit a decimal(%d) field", r.RatString(), scale)
+	}
+	return scaled.Num().Int64(), nil
+}
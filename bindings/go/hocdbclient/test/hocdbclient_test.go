@@ -0,0 +1,145 @@
+package hocdbclient_test
+
+import (
+	"context"
+	"hocdb"
+	"hocdb/hocdbclient"
+	"hocdb/hocdbserver"
+	"net"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestClient(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "volume", Type: hocdb.TypeU64},
+		{Name: "side", Type: hocdb.TypeString},
+		{Name: "maker", Type: hocdb.TypeBool},
+	}
+
+	testDir := "../../../../b_go_test_data_client"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	srv := hocdbserver.New()
+	srv.Add("BTC_USD", db)
+
+	lis := bufconn.Listen(1 << 20)
+	g := grpc.NewServer()
+	srv.Register(g)
+	go g.Serve(lis)
+	defer g.Stop()
+
+	client, err := hocdbclient.Dial("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Open("ETH_USD"); err == nil {
+		t.Error("Expected error opening an unknown ticker")
+	}
+
+	remote, err := client.Open("BTC_USD")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer remote.Close()
+
+	remoteSchema := remote.Schema()
+	if len(remoteSchema) != 5 || remoteSchema[3].Type != hocdbclient.TypeString {
+		t.Fatalf("Unexpected schema: %v", remoteSchema)
+	}
+	if hocdbclient.RecordSize(remoteSchema) != hocdb.RecordSize(schema) {
+		t.Errorf("Record sizes differ")
+	}
+	if remote.RecordSize() != hocdb.RecordSize(schema) {
+		t.Errorf("Expected a record size of %d, got %d", hocdb.RecordSize(schema), remote.RecordSize())
+	}
+	if idx, ok := remote.FieldIndex("side"); !ok || idx != 3 {
+		t.Errorf("Expected field side at 3, got %d, %v", idx, ok)
+	}
+
+	for i := 1; i <= 4; i++ {
+		record, err := hocdbclient.CreateRecordBytes(remoteSchema, int64(i*100), float64(i), uint64(i), "buy", i%2 == 0)
+		if err != nil {
+			t.Fatalf("CreateRecordBytes failed: %v", err)
+		}
+		local, _ := hocdb.CreateRecordBytes(schema, int64(i*100), float64(i), uint64(i), "buy", i%2 == 0)
+		if string(record) != string(local) {
+			t.Fatalf("Record encoding differs from hocdb.CreateRecordBytes")
+		}
+		if err := remote.Append(record); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	if err := remote.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	data, err := remote.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(data) != 4*hocdb.RecordSize(schema) {
+		t.Errorf("Expected 4 records, got %d bytes", len(data))
+	}
+
+	data, err = remote.Query(0, 1000, map[string]interface{}{"maker": true})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	records, _ := hocdb.DecodeRecords(schema, data)
+	if len(records) != 2 || records[0].Timestamp() != 200 || records[1].Timestamp() != 400 {
+		t.Errorf("Unexpected query result: %v", records)
+	}
+
+	data, err = remote.Query(150, 350, []hocdbclient.Filter{{FieldIndex: 2, Value: uint64(3)}})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(data) != hocdb.RecordSize(schema) {
+		t.Errorf("Expected 1 record, got %d bytes", len(data))
+	}
+
+	stats, err := remote.GetStatsByName(0, 1000, "price")
+	if err != nil {
+		t.Fatalf("GetStatsByName failed: %v", err)
+	}
+	if stats.Count != 4 || stats.Sum != 10 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	latest, err := remote.WithContext(context.Background()).GetLatest(1)
+	if err != nil {
+		t.Fatalf("GetLatest failed: %v", err)
+	}
+	if latest.Value != 4 || latest.Timestamp != 400 {
+		t.Errorf("Unexpected latest: %+v", latest)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := remote.WithContext(ctx).Load(); err == nil {
+		t.Error("Expected error with a cancelled context")
+	}
+
+	tickers, err := client.Tickers(context.Background())
+	if err != nil || len(tickers) != 1 {
+		t.Errorf("Unexpected tickers: %v, %v", tickers, err)
+	}
+}
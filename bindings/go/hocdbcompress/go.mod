@@ -0,0 +1,11 @@
+module hocdb/hocdbcompress
+
+go 1.23.0
+
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/pierrec/lz4/v4 v4.1.22
+	hocdb v0.0.0
+)
+
+replace hocdb => ../
@@ -0,0 +1,64 @@
+/*
+Package hocdbcompress registers the "zstd" and "lz4" codecs for hocdb.Compression.
+
+It lives in its own module so that the core hocdb bindings stay free of third-party
+dependencies. Import it for its side effect in every program that opens databases
+compressed with these codecs:
+
+	import _ "hocdb/hocdbcompress"
+
+	db, err := hocdb.New(ticker, path, schema, hocdb.Options{
+		Compression: &hocdb.Compression{Codec: "zstd", Level: 3},
+	})
+*/
+package hocdbcompress
+
+import (
+	"hocdb"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+func init() {
+	hocdb.RegisterCodec("zstd", zstdCodec{})
+	hocdb.RegisterCodec("lz4", lz4Codec{})
+}
+
+// zstdCodec compresses with Zstandard; levels are those of zstd, 3 by default
+type zstdCodec struct{}
+
+func (zstdCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	opts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+	if level != 0 {
+		opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	}
+	return zstd.NewWriter(w, opts...)
+}
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+// lz4Codec compresses with LZ4 frames; levels 1 to 9 select the slower high
+// compression mode, 0 the fast one
+type lz4Codec struct{}
+
+func (lz4Codec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	zw := lz4.NewWriter(w)
+	if level > 0 {
+		if err := zw.Apply(lz4.CompressionLevelOption(lz4.CompressionLevel(1 << (7 + level)))); err != nil {
+			return nil, err
+		}
+	}
+	return zw, nil
+}
+
+func (lz4Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(lz4.NewReader(r)), nil
+}
@@ -0,0 +1,50 @@
+package hocdbcompress_test
+
+import (
+	"hocdb"
+	_ "hocdb/hocdbcompress"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+
+	testDir := "../../../../b_go_test_data_hocdbcompress"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	for _, codec := range []string{"zstd", "lz4"} {
+		for _, level := range []int{0, 3} {
+			options := hocdb.Options{Compression: &hocdb.Compression{Codec: codec, Level: level, SegmentRecords: 1000}}
+			db, err := hocdb.New("TICKS", testDir, schema, options)
+			if err != nil {
+				t.Fatalf("Failed to create DB: %v", err)
+			}
+			for i := 1; i <= 3000; i++ {
+				if err := db.AppendValues(int64(i), 100+float64(i%10)/100); err != nil {
+					t.Fatalf("Failed to append: %v", err)
+				}
+			}
+			if err := db.Compact(); err != nil {
+				t.Fatalf("%s level %d: failed to compact: %v", codec, level, err)
+			}
+			segments, _ := filepath.Glob(filepath.Join(testDir, "TICKS.*.seg"))
+			if len(segments) != 2 {
+				t.Fatalf("%s level %d: expected 2 segments, got %v", codec, level, segments)
+			}
+			if info, err := os.Stat(segments[0]); err != nil || info.Size() >= 1000*16/2 {
+				t.Errorf("%s level %d: expected a segment under half the raw size, got %v, %v", codec, level, info.Size(), err)
+			}
+			data, err := db.Load()
+			if err != nil || len(data) != 3000*16 {
+				t.Errorf("%s level %d: expected 3000 records, got %d bytes, %v", codec, level, len(data), err)
+			}
+			db.Drop()
+		}
+	}
+}
@@ -0,0 +1,339 @@
+/*
+Package hocdbflight serves HOCDB query results over Apache Arrow Flight, so analytical
+clients (pyarrow, Java, DuckDB, ...) can pull columnar data without per-row
+serialization.
+
+A flight is either a whole ticker, described by the path [ticker], or a query,
+described by a JSON command:
+
+	{"ticker": "BTC_USD", "start": 1620000000, "end": 1620086400, "filters": {"side": "buy"}}
+
+start and end default to the whole time range and filters are equality filters
+on fields. GetFlightInfo returns a single endpoint whose ticket DoGet streams as
+record batches; ListFlights lists every ticker.
+
+It lives in its own module so that the core hocdb bindings and hocdbarrow stay
+free of gRPC.
+
+Example usage:
+
+	srv := hocdbflight.New()
+	srv.Add("BTC_USD", db)
+
+	lis, err := net.Listen("tcp", ":8815")
+	if err != nil {
+	    panic(err)
+	}
+	g := grpc.NewServer()
+	srv.Register(g)
+	g.Serve(lis)
+
+and from Python:
+
+	client = pyarrow.flight.connect("grpc://localhost:8815")
+	info = client.get_flight_info(pyarrow.flight.FlightDescriptor.for_path("BTC_USD"))
+	table = client.do_get(info.endpoints[0].ticket).read_all()
+*/
+package hocdbflight
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hocdb"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+
+	"hocdb/hocdbarrow"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Query selects records of a ticker. It is the command of CMD flight descriptors
+// and the content of tickets, encoded as JSON.
+type Query struct {
+	Ticker  string                 `json:"ticker"`
+	Start   *int64                 `json:"start,omitempty"` // Inclusive, defaults to the first record
+	End     *int64                 `json:"end,omitempty"`   // Exclusive, defaults to after the last record
+	Filters map[string]interface{} `json:"filters,omitempty"`
+}
+
+// Server implements the Flight service on top of registered databases. Calls on the
+// same ticker are serialized.
+type Server struct {
+	flight.BaseFlightServer
+
+	mu      sync.RWMutex
+	tickers map[string]*ticker
+}
+
+type ticker struct {
+	mu     sync.Mutex
+	db     *hocdb.DB
+	schema []hocdb.Field
+	arrow  *arrow.Schema
+}
+
+// New creates a server with no tickers
+func New() *Server {
+	return &Server{tickers: make(map[string]*ticker)}
+}
+
+// Add makes an open database available under the given ticker name. The server
+// doesn't take ownership; the caller still closes the database after stopping the
+// gRPC server.
+func (s *Server) Add(name string, db *hocdb.DB) error {
+	schema := db.Schema()
+	arrowSchema, err := hocdbarrow.Schema(schema)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tickers[name] = &ticker{db: db, schema: schema, arrow: arrowSchema}
+	return nil
+}
+
+// Remove stops serving a ticker
+func (s *Server) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tickers, name)
+}
+
+// Register registers the Flight service on a gRPC server
+func (s *Server) Register(g *grpc.Server) {
+	flight.RegisterFlightServiceServer(g, s)
+}
+
+func (s *Server) lookup(name string) (*ticker, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tickers[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown ticker: %s", name)
+	}
+	return t, nil
+}
+
+func (s *Server) ListFlights(criteria *flight.Criteria, stream flight.FlightService_ListFlightsServer) error {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.tickers))
+	for name := range s.tickers {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		desc := &flight.FlightDescriptor{Type: flight.DescriptorPATH, Path: []string{name}}
+		info, err := s.GetFlightInfo(stream.Context(), desc)
+		if status.Code(err) == codes.NotFound {
+			// Removed meanwhile
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) GetFlightInfo(ctx context.Context, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	q, t, err := s.describe(desc)
+	if err != nil {
+		return nil, err
+	}
+	ticket, err := json.Marshal(q)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &flight.FlightInfo{
+		Schema:           flight.SerializeSchema(t.arrow, memory.DefaultAllocator),
+		FlightDescriptor: desc,
+		Endpoint:         []*flight.FlightEndpoint{{Ticket: &flight.Ticket{Ticket: ticket}}},
+		// Counting would mean running the query twice
+		TotalRecords: -1,
+		TotalBytes:   -1,
+	}, nil
+}
+
+func (s *Server) GetSchema(ctx context.Context, desc *flight.FlightDescriptor) (*flight.SchemaResult, error) {
+	_, t, err := s.describe(desc)
+	if err != nil {
+		return nil, err
+	}
+	return &flight.SchemaResult{Schema: flight.SerializeSchema(t.arrow, memory.DefaultAllocator)}, nil
+}
+
+func (s *Server) DoGet(tkt *flight.Ticket, stream flight.FlightService_DoGetServer) error {
+	q, err := parseQuery(tkt.Ticket)
+	if err != nil {
+		return err
+	}
+	t, err := s.lookup(q.Ticker)
+	if err != nil {
+		return err
+	}
+	filters, err := queryFilters(t.schema, q.Filters)
+	if err != nil {
+		return err
+	}
+
+	startTs, endTs := int64(math.MinInt64), int64(math.MaxInt64)
+	if q.Start != nil {
+		startTs = *q.Start
+	}
+	if q.End != nil {
+		endTs = *q.End
+	}
+
+	t.mu.Lock()
+	var data []byte
+	if len(filters) > 0 {
+		data, err = t.db.Query(startTs, endTs, filters)
+	} else {
+		data, err = t.db.Query(startTs, endTs, nil)
+	}
+	t.mu.Unlock()
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	records, err := hocdbarrow.Records(t.schema, data, hocdbarrow.DefaultBatchSize)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer func() {
+		for _, rec := range records {
+			rec.Release()
+		}
+	}()
+
+	w := flight.NewRecordWriter(stream, ipc.WithSchema(t.arrow))
+	for _, rec := range records {
+		if err := w.Write(rec); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// describe resolves a flight descriptor into a query on a registered ticker
+func (s *Server) describe(desc *flight.FlightDescriptor) (*Query, *ticker, error) {
+	var q *Query
+	switch desc.GetType() {
+	case flight.DescriptorPATH:
+		if len(desc.Path) != 1 {
+			return nil, nil, status.Error(codes.InvalidArgument, "path descriptors must name a single ticker")
+		}
+		q = &Query{Ticker: desc.Path[0]}
+	case flight.DescriptorCMD:
+		var err error
+		if q, err = parseQuery(desc.Cmd); err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, status.Error(codes.InvalidArgument, "unsupported descriptor type")
+	}
+
+	t, err := s.lookup(q.Ticker)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := queryFilters(t.schema, q.Filters); err != nil {
+		return nil, nil, err
+	}
+	return q, t, nil
+}
+
+// parseQuery decodes a JSON query, keeping filter numbers exact until they are
+// converted to their field types
+func parseQuery(data []byte) (*Query, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var q Query
+	if err := dec.Decode(&q); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid query: %v", err)
+	}
+	if q.Ticker == "" {
+		return nil, status.Error(codes.InvalidArgument, "query without a ticker")
+	}
+	return &q, nil
+}
+
+// queryFilters converts JSON filter values into engine filters, checking them
+// against the schema
+func queryFilters(schema []hocdb.Field, filters map[string]interface{}) ([]hocdb.Filter, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+
+	result := make([]hocdb.Filter, 0, len(filters))
+	for name, raw := range filters {
+		i := fieldIndex(schema, name)
+		if i < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown field in filter: %s", name)
+		}
+		value, err := filterValue(schema[i].Type, raw)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "filter on %s: %v", name, err)
+		}
+		result = append(result, hocdb.Filter{FieldIndex: i, Value: value})
+	}
+	return result, nil
+}
+
+func filterValue(t hocdb.FieldType, raw interface{}) (interface{}, error) {
+	switch v := raw.(type) {
+	case json.Number:
+		switch t {
+		case hocdb.TypeI64:
+			return v.Int64()
+		case hocdb.TypeU64:
+			return strconv.ParseUint(v.String(), 10, 64)
+		case hocdb.TypeF64:
+			return v.Float64()
+		case hocdb.TypeI32, hocdb.TypeU32, hocdb.TypeF32, hocdb.TypeI16, hocdb.TypeU8:
+			return hocdb.ParseValue(t, v.String())
+		}
+		if t.IsDecimal() {
+			return hocdb.ParseValue(t, v.String())
+		}
+	case string:
+		if t.IsString() {
+			return v, nil
+		}
+		if t.IsDecimal() {
+			return hocdb.ParseValue(t, v)
+		}
+	case bool:
+		if t == hocdb.TypeBool {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a value of type %s", t)
+}
+
+func fieldIndex(schema []hocdb.Field, name string) int {
+	for i, field := range schema {
+		if field.Name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,163 @@
+package hocdbflight_test
+
+import (
+	"context"
+	"fmt"
+	"hocdb"
+	"hocdb/hocdbflight"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestFlight(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "side", Type: hocdb.TypeString},
+	}
+
+	testDir := "../../../../b_go_test_data_flight"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	for i, side := range []string{"buy", "sell", "buy", "sell"} {
+		record, _ := hocdb.CreateRecordBytes(schema, int64(100*(i+1)), float64(10+i), side)
+		if err := db.Append(record); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+
+	srv := hocdbflight.New()
+	if err := srv.Add("BTC_USD", db); err != nil {
+		t.Fatalf("Failed to add ticker: %v", err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	g := grpc.NewServer()
+	srv.Register(g)
+	go g.Serve(lis)
+	defer g.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	client := flight.NewClientFromConn(conn, nil)
+	ctx := context.Background()
+
+	// A whole ticker by path
+	info, err := client.GetFlightInfo(ctx, &flight.FlightDescriptor{Type: flight.DescriptorPATH, Path: []string{"BTC_USD"}})
+	if err != nil {
+		t.Fatalf("GetFlightInfo failed: %v", err)
+	}
+	arrowSchema, err := flight.DeserializeSchema(info.Schema, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode schema: %v", err)
+	}
+	if arrowSchema.NumFields() != 3 || arrowSchema.Field(2).Name != "side" {
+		t.Errorf("Unexpected schema: %v", arrowSchema)
+	}
+
+	rows := doGet(t, client, info.Endpoint[0].Ticket)
+	if len(rows) != 4 || rows[0] != "100 10 buy" || rows[3] != "400 13 sell" {
+		t.Errorf("Unexpected rows: %v", rows)
+	}
+
+	// A query by command
+	cmd := []byte(`{"ticker": "BTC_USD", "start": 150, "end": 400, "filters": {"side": "buy"}}`)
+	info, err = client.GetFlightInfo(ctx, &flight.FlightDescriptor{Type: flight.DescriptorCMD, Cmd: cmd})
+	if err != nil {
+		t.Fatalf("GetFlightInfo failed: %v", err)
+	}
+	rows = doGet(t, client, info.Endpoint[0].Ticket)
+	if len(rows) != 1 || rows[0] != "300 12 buy" {
+		t.Errorf("Unexpected rows: %v", rows)
+	}
+
+	// Empty results still carry the schema
+	cmd = []byte(`{"ticker": "BTC_USD", "start": 1000}`)
+	info, err = client.GetFlightInfo(ctx, &flight.FlightDescriptor{Type: flight.DescriptorCMD, Cmd: cmd})
+	if err != nil {
+		t.Fatalf("GetFlightInfo failed: %v", err)
+	}
+	if rows = doGet(t, client, info.Endpoint[0].Ticket); len(rows) != 0 {
+		t.Errorf("Expected no rows, got %v", rows)
+	}
+
+	listing, err := client.ListFlights(ctx, &flight.Criteria{})
+	if err != nil {
+		t.Fatalf("ListFlights failed: %v", err)
+	}
+	var flights []string
+	for {
+		info, err := listing.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ListFlights failed: %v", err)
+		}
+		flights = append(flights, info.FlightDescriptor.Path[0])
+	}
+	if len(flights) != 1 || flights[0] != "BTC_USD" {
+		t.Errorf("Unexpected flights: %v", flights)
+	}
+
+	// Errors
+	_, err = client.GetFlightInfo(ctx, &flight.FlightDescriptor{Type: flight.DescriptorPATH, Path: []string{"ETH_USD"}})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for an unknown ticker, got %v", err)
+	}
+	cmd = []byte(`{"ticker": "BTC_USD", "filters": {"side": 1}}`)
+	_, err = client.GetSchema(ctx, &flight.FlightDescriptor{Type: flight.DescriptorCMD, Cmd: cmd})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for a mistyped filter, got %v", err)
+	}
+}
+
+// doGet fetches a ticket and formats every row as space-separated values
+func doGet(t *testing.T, client flight.Client, ticket *flight.Ticket) []string {
+	stream, err := client.DoGet(context.Background(), ticket)
+	if err != nil {
+		t.Fatalf("DoGet failed: %v", err)
+	}
+	reader, err := flight.NewRecordReader(stream)
+	if err != nil {
+		t.Fatalf("Failed to read stream: %v", err)
+	}
+	defer reader.Release()
+
+	var rows []string
+	for reader.Next() {
+		rec := reader.Record()
+		ts := rec.Column(0).(*array.Int64)
+		price := rec.Column(1).(*array.Float64)
+		side := rec.Column(2).(*array.String)
+		for i := 0; i < int(rec.NumRows()); i++ {
+			rows = append(rows, fmt.Sprintf("%d %g %s", ts.Value(i), price.Value(i), side.Value(i)))
+		}
+	}
+	if err := reader.Err(); err != nil {
+		t.Fatalf("Failed to read stream: %v", err)
+	}
+	return rows
+}
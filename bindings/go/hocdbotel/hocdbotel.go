@@ -0,0 +1,158 @@
+/*
+Package hocdbotel traces HOCDB calls with OpenTelemetry.
+
+DB wraps a *hocdb.DB and records a span for every Append, Load, Query and
+GetStats call, carrying the ticker and the records and bytes moved, so hocdb
+calls show up in distributed traces next to other datastores. Spans are children
+of the span in the context given to WithContext.
+
+It lives in its own module so that the core hocdb bindings stay free of third-party
+dependencies.
+
+Example usage:
+
+	db := hocdbotel.Wrap(raw)
+	data, err := db.WithContext(ctx).Query(start, end, nil)
+*/
+package hocdbotel
+
+import (
+	"context"
+	"hocdb"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the tracer
+const ScopeName = "hocdb/hocdbotel"
+
+// Attribute keys set on spans
+const (
+	TickerKey     = attribute.Key("hocdb.ticker")
+	RecordsKey    = attribute.Key("hocdb.records")
+	BytesKey      = attribute.Key("hocdb.bytes")
+	StartKey      = attribute.Key("hocdb.start")
+	EndKey        = attribute.Key("hocdb.end")
+	FilteredKey   = attribute.Key("hocdb.filtered")
+	FieldIndexKey = attribute.Key("hocdb.field_index")
+)
+
+// Option configures Wrap
+type Option func(*DB)
+
+// WithTracerProvider sets the provider of the tracer, the global one by default
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(db *DB) {
+		db.tracer = tp.Tracer(ScopeName)
+	}
+}
+
+// DB is a *hocdb.DB whose Append, Load, Query and GetStats calls are traced. Other
+// methods are those of the wrapped database and aren't traced.
+type DB struct {
+	*hocdb.DB
+	tracer trace.Tracer
+	ctx    context.Context
+	size   int // Record size
+}
+
+// Wrap returns db with tracing
+func Wrap(db *hocdb.DB, opts ...Option) *DB {
+	t := &DB{DB: db, ctx: context.Background(), size: hocdb.RecordSize(db.Schema())}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.tracer == nil {
+		t.tracer = otel.GetTracerProvider().Tracer(ScopeName)
+	}
+	return t
+}
+
+// WithContext returns a copy of db whose spans are children of the span in ctx
+func (db *DB) WithContext(ctx context.Context) *DB {
+	c := *db
+	c.ctx = ctx
+	return &c
+}
+
+// start starts the span of an operation
+func (db *DB) start(op string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := db.tracer.Start(db.ctx, "hocdb."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "hocdb"),
+			attribute.String("db.operation.name", op),
+			TickerKey.String(db.Ticker()),
+		),
+		trace.WithAttributes(attrs...),
+	)
+	return span
+}
+
+// end ends a span, recording the records and bytes of a result or the error
+func (db *DB) end(span trace.Span, data []byte, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if data != nil {
+		span.SetAttributes(
+			RecordsKey.Int(len(data)/db.size),
+			BytesKey.Int(len(data)),
+		)
+	}
+	span.End()
+}
+
+// Append adds a raw record to the database
+func (db *DB) Append(data []byte) error {
+	span := db.start("Append")
+	err := db.DB.Append(data)
+	db.end(span, data, err)
+	return err
+}
+
+// Load retrieves all records from the database
+func (db *DB) Load() ([]byte, error) {
+	span := db.start("Load")
+	data, err := db.DB.Load()
+	db.end(span, data, err)
+	return data, err
+}
+
+// Query retrieves records within [startTs, endTs) with optional filters
+func (db *DB) Query(startTs, endTs int64, filters interface{}) ([]byte, error) {
+	span := db.start("Query", StartKey.Int64(startTs), EndKey.Int64(endTs), FilteredKey.Bool(filters != nil))
+	data, err := db.DB.Query(startTs, endTs, filters)
+	db.end(span, data, err)
+	return data, err
+}
+
+// GetStats returns statistics for a specific field within a time range
+func (db *DB) GetStats(startTs, endTs int64, fieldIndex int) (*hocdb.Stats, error) {
+	span := db.start("GetStats", StartKey.Int64(startTs), EndKey.Int64(endTs), FieldIndexKey.Int(fieldIndex))
+	stats, err := db.DB.GetStats(startTs, endTs, fieldIndex)
+	if err == nil {
+		span.SetAttributes(RecordsKey.Int64(int64(stats.Count)))
+	}
+	db.end(span, nil, err)
+	return stats, err
+}
+
+// GetStatsByName is GetStats by field name
+func (db *DB) GetStatsByName(startTs, endTs int64, fieldName string) (*hocdb.Stats, error) {
+	idx := -1
+	for i, field := range db.Schema() {
+		if field.Name == fieldName {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		// Let the wrapped database report the unknown field
+		return db.DB.GetStatsByName(startTs, endTs, fieldName)
+	}
+	return db.GetStats(startTs, endTs, idx)
+}
@@ -0,0 +1,88 @@
+package hocdbotel_test
+
+import (
+	"context"
+	"hocdb"
+	"hocdb/hocdbotel"
+	"os"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+
+	testDir := "../../../../b_go_test_data_otel"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	raw, err := hocdb.New("OTEL_TEST", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer raw.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+
+	db := hocdbotel.Wrap(raw, hocdbotel.WithTracerProvider(tp)).WithContext(ctx)
+	for i := 1; i <= 3; i++ {
+		record, _ := hocdb.CreateRecordBytes(schema, int64(i), float64(i))
+		if err := db.Append(record); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if _, err := db.Query(2, 10, nil); err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if _, err := db.GetStatsByName(0, 10, "price"); err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	record, _ := hocdb.CreateRecordBytes(schema, int64(1), 1.0)
+	if err := db.Append(record); err == nil {
+		t.Fatalf("Expected a non-monotonic append to fail")
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 7 {
+		t.Fatalf("Expected 7 spans, got %d", len(spans))
+	}
+	attrs := func(i int) map[attribute.Key]attribute.Value {
+		m := make(map[attribute.Key]attribute.Value)
+		for _, kv := range spans[i].Attributes() {
+			m[kv.Key] = kv.Value
+		}
+		return m
+	}
+
+	for i, span := range spans[:6] {
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("Span %d (%s) is not a child of the request span", i, span.Name())
+		}
+		if attrs(i)[hocdbotel.TickerKey].AsString() != "OTEL_TEST" {
+			t.Errorf("Span %d (%s) lacks the ticker", i, span.Name())
+		}
+	}
+
+	if spans[0].Name() != "hocdb.Append" || attrs(0)[hocdbotel.BytesKey].AsInt64() != 16 {
+		t.Errorf("Unexpected append span: %s %v", spans[0].Name(), spans[0].Attributes())
+	}
+	if spans[3].Name() != "hocdb.Query" || attrs(3)[hocdbotel.RecordsKey].AsInt64() != 2 || attrs(3)[hocdbotel.StartKey].AsInt64() != 2 {
+		t.Errorf("Unexpected query span: %s %v", spans[3].Name(), spans[3].Attributes())
+	}
+	if spans[4].Name() != "hocdb.GetStats" || attrs(4)[hocdbotel.RecordsKey].AsInt64() != 3 || attrs(4)[hocdbotel.FieldIndexKey].AsInt64() != 1 {
+		t.Errorf("Unexpected stats span: %s %v", spans[4].Name(), spans[4].Attributes())
+	}
+	if spans[5].Status().Code != codes.Error || len(spans[5].Events()) == 0 {
+		t.Errorf("Expected the failed append to record an error, got %v", spans[5].Status())
+	}
+}
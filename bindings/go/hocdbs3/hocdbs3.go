@@ -0,0 +1,75 @@
+/*
+Package hocdbs3 keeps the cold segments of HOCDB databases in S3-compatible object
+storage: AWS S3, MinIO, Ceph, or Google Cloud Storage through its XML API with HMAC
+keys.
+
+Store implements hocdb.ObjectStore on a bucket, for hocdb.ColdStorage.
+
+It lives in its own module so that the core hocdb bindings stay free of third-party
+dependencies.
+
+Example usage:
+
+	client, err := minio.New("s3.amazonaws.com", &minio.Options{
+		Creds:  credentials.NewEnvAWS(),
+		Secure: true,
+	})
+	db, err := hocdb.New("BTC_USD", "./data", schema, hocdb.Options{
+		PartitionBy: hocdb.PartitionDay,
+		ColdStorage: &hocdb.ColdStorage{Store: hocdbs3.New(client, "ticks"), KeepLocal: 7},
+	})
+*/
+package hocdbs3
+
+import (
+	"context"
+	"fmt"
+	"hocdb"
+	"io"
+	"os"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Store is a bucket holding the objects of cold segments
+type Store struct {
+	client *minio.Client
+	bucket string
+}
+
+var _ hocdb.ObjectStore = (*Store)(nil)
+
+// New returns the store of a bucket, which must exist
+func New(client *minio.Client, bucket string) *Store {
+	return &Store{client: client, bucket: bucket}
+}
+
+// Put uploads an object of the given size
+func (s *Store) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	return err
+}
+
+// Get downloads an object. A missing one yields an error wrapping os.ErrNotExist.
+func (s *Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy, so the first read surfaces errors such as a missing key
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("%s/%s: %w", s.bucket, key, os.ErrNotExist)
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+// Delete removes an object; a missing one isn't an error
+func (s *Store) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,126 @@
+package hocdbs3_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hocdb"
+	"hocdb/hocdbs3"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// fakeS3 serves the object calls of the S3 API from memory, path-style
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = data
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodGet, http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			}
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestStore(t *testing.T) {
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4("", "", ""),
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	store := hocdbs3.New(client, "ticks")
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "a/b.seg", strings.NewReader("segment"), 7); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if string(fake.objects["ticks/a/b.seg"]) != "segment" {
+		t.Errorf("Expected the object in the bucket, got %q", fake.objects["ticks/a/b.seg"])
+	}
+	r, err := store.Get(ctx, "a/b.seg")
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != "segment" {
+		t.Errorf("Expected segment, got %q, %v", data, err)
+	}
+	if err := store.Delete(ctx, "a/b.seg"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if _, err := store.Get(ctx, "a/b.seg"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist, got %v", err)
+	}
+
+	// Cold segments of a database round-trip through the bucket
+	testDir := "../../../../b_go_test_data_s3"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	db, err := hocdb.New("S3_TEST", testDir, schema, hocdb.Options{
+		Compression: &hocdb.Compression{Codec: "deflate", SegmentRecords: 10},
+		ColdStorage: &hocdb.ColdStorage{Store: store, Prefix: "db/", CacheSize: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+	for i := 1; i <= 30; i++ {
+		if err := db.AppendValues(int64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if len(fake.objects) != 2 {
+		t.Errorf("Expected 2 objects, got %d", len(fake.objects))
+	}
+	if data, err := db.Load(); err != nil || len(data) != 30*16 {
+		t.Errorf("Expected 30 records, got %d bytes, %v", len(data), err)
+	}
+}
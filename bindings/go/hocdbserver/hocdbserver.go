@@ -0,0 +1,309 @@
+/*
+Package hocdbserver exposes HOCDB tickers over gRPC, so non-Go and remote clients
+can use a database without linking the C library.
+
+The service and its messages are defined in proto/hocdb/v1/hocdb.proto; generated
+Go code lives in the hocdbpb package. Records travel in the engine's binary layout,
+so Append and Query payloads are exactly what DB.Append takes and DB.Query returns.
+
+It lives in its own module so that the core hocdb bindings stay free of third-party
+dependencies.
+
+Example usage:
+
+	db, err := hocdb.New("BTC_USD", "./data", schema, hocdb.Options{})
+	if err != nil {
+	    panic(err)
+	}
+	defer db.Close()
+
+	srv := hocdbserver.New()
+	srv.Add("BTC_USD", db)
+
+	lis, err := net.Listen("tcp", ":50051")
+	if err != nil {
+	    panic(err)
+	}
+	g := grpc.NewServer()
+	srv.Register(g)
+	g.Serve(lis)
+*/
+package hocdbserver
+
+//go:generate buf generate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hocdb"
+	"sort"
+	"strings"
+	"sync"
+
+	"hocdb/hocdbserver/hocdbpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxChunkSize bounds the records carried by a single QueryResponse, well below
+// gRPC's default 4 MiB message limit
+const maxChunkSize = 1 << 20
+
+// Server implements hocdbpb.HOCDBServiceServer on top of registered databases. Calls on the
+// same ticker are serialized.
+type Server struct {
+	hocdbpb.UnimplementedHOCDBServiceServer
+
+	mu      sync.RWMutex
+	tickers map[string]*ticker
+}
+
+type ticker struct {
+	mu     sync.Mutex
+	db     *hocdb.DB
+	schema []hocdb.Field
+}
+
+// New creates a server with no tickers
+func New() *Server {
+	return &Server{tickers: make(map[string]*ticker)}
+}
+
+// Add makes an open database available under the given ticker name. The server
+// doesn't take ownership; the caller still closes the database after stopping the
+// gRPC server.
+func (s *Server) Add(name string, db *hocdb.DB) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tickers[name] = &ticker{db: db, schema: db.Schema()}
+}
+
+// Remove stops serving a ticker
+func (s *Server) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tickers, name)
+}
+
+// Register registers the HOCDBService on a gRPC server
+func (s *Server) Register(g *grpc.Server) {
+	hocdbpb.RegisterHOCDBServiceServer(g, s)
+}
+
+// lookup returns the named ticker locked; the caller must unlock it
+func (s *Server) lookup(name string) (*ticker, error) {
+	s.mu.RLock()
+	t, ok := s.tickers[name]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown ticker: %s", name)
+	}
+	t.mu.Lock()
+	return t, nil
+}
+
+func (s *Server) Schema(ctx context.Context, req *hocdbpb.SchemaRequest) (*hocdbpb.SchemaResponse, error) {
+	t, err := s.lookup(req.Ticker)
+	if err != nil {
+		return nil, err
+	}
+	defer t.mu.Unlock()
+
+	resp := &hocdbpb.SchemaResponse{RecordSize: uint32(hocdb.RecordSize(t.schema))}
+	for _, field := range t.schema {
+		resp.Fields = append(resp.Fields, &hocdbpb.Field{
+			Name:     field.Name,
+			Type:     hocdbpb.FieldType(field.Type),
+			Nullable: field.Nullable,
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) Append(ctx context.Context, req *hocdbpb.AppendRequest) (*hocdbpb.AppendResponse, error) {
+	t, err := s.lookup(req.Ticker)
+	if err != nil {
+		return nil, err
+	}
+	defer t.mu.Unlock()
+
+	recordSize := hocdb.RecordSize(t.schema)
+	if len(req.Records)%recordSize != 0 {
+		return nil, status.Error(codes.InvalidArgument, "records length is not a multiple of the record size")
+	}
+
+	resp := &hocdbpb.AppendResponse{}
+	for offset := 0; offset < len(req.Records); offset += recordSize {
+		if err := t.db.Append(req.Records[offset : offset+recordSize]); err != nil {
+			// Records before the failing one stay appended
+			return nil, appendError(fmt.Errorf("record %d: %w", resp.Appended, err))
+		}
+		resp.Appended++
+	}
+	return resp, nil
+}
+
+func (s *Server) Flush(ctx context.Context, req *hocdbpb.FlushRequest) (*hocdbpb.FlushResponse, error) {
+	t, err := s.lookup(req.Ticker)
+	if err != nil {
+		return nil, err
+	}
+	defer t.mu.Unlock()
+
+	if err := t.db.Flush(); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &hocdbpb.FlushResponse{}, nil
+}
+
+func (s *Server) Query(req *hocdbpb.QueryRequest, stream hocdbpb.HOCDBService_QueryServer) error {
+	t, err := s.lookup(req.Ticker)
+	if err != nil {
+		return err
+	}
+
+	filters, err := queryFilters(t.schema, req.Filters)
+	if err != nil {
+		t.mu.Unlock()
+		return err
+	}
+	data, err := t.db.Query(req.StartTs, req.EndTs, filters)
+	recordSize := hocdb.RecordSize(t.schema)
+	t.mu.Unlock()
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	// Send whole records only, so every chunk can be decoded on its own
+	chunk := maxChunkSize / recordSize * recordSize
+	if chunk == 0 {
+		chunk = recordSize
+	}
+	for offset := 0; offset < len(data); offset += chunk {
+		end := offset + chunk
+		if end > len(data) {
+			end = len(data)
+		}
+		if err := stream.Send(&hocdbpb.QueryResponse{Records: data[offset:end]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) Stats(ctx context.Context, req *hocdbpb.StatsRequest) (*hocdbpb.StatsResponse, error) {
+	t, err := s.lookup(req.Ticker)
+	if err != nil {
+		return nil, err
+	}
+	defer t.mu.Unlock()
+
+	if fieldIndex(t.schema, req.Field) < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown field: %s", req.Field)
+	}
+	stats, err := t.db.GetStatsByName(req.StartTs, req.EndTs, req.Field)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &hocdbpb.StatsResponse{
+		Min:   stats.Min,
+		Max:   stats.Max,
+		Sum:   stats.Sum,
+		Count: stats.Count,
+		Mean:  stats.Mean,
+	}, nil
+}
+
+func (s *Server) Latest(ctx context.Context, req *hocdbpb.LatestRequest) (*hocdbpb.LatestResponse, error) {
+	t, err := s.lookup(req.Ticker)
+	if err != nil {
+		return nil, err
+	}
+	defer t.mu.Unlock()
+
+	if fieldIndex(t.schema, req.Field) < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown field: %s", req.Field)
+	}
+	latest, err := t.db.GetLatestByName(req.Field)
+	if err != nil {
+		// The engine fails on empty databases
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &hocdbpb.LatestResponse{Value: latest.Value, Timestamp: latest.Timestamp}, nil
+}
+
+func (s *Server) ListTickers(ctx context.Context, req *hocdbpb.ListTickersRequest) (*hocdbpb.ListTickersResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	resp := &hocdbpb.ListTickersResponse{}
+	for name := range s.tickers {
+		resp.Tickers = append(resp.Tickers, name)
+	}
+	sort.Strings(resp.Tickers)
+	return resp, nil
+}
+
+// queryFilters converts protobuf filters into engine filters, checking value types
+// against the schema
+func queryFilters(schema []hocdb.Field, filters []*hocdbpb.Filter) ([]hocdb.Filter, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+
+	result := make([]hocdb.Filter, 0, len(filters))
+	for _, f := range filters {
+		i := fieldIndex(schema, f.Field)
+		if i < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown field in filter: %s", f.Field)
+		}
+
+		var value interface{}
+		var typ hocdb.FieldType
+		switch v := f.Value.(type) {
+		case *hocdbpb.Filter_I64:
+			value, typ = v.I64, hocdb.TypeI64
+		case *hocdbpb.Filter_F64:
+			value, typ = v.F64, hocdb.TypeF64
+		case *hocdbpb.Filter_U64:
+			value, typ = v.U64, hocdb.TypeU64
+		case *hocdbpb.Filter_Str:
+			value, typ = v.Str, hocdb.TypeString
+		case *hocdbpb.Filter_Bool:
+			value, typ = v.Bool, hocdb.TypeBool
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "filter on %s has no value", f.Field)
+		}
+		if typ != schema[i].Type {
+			return nil, status.Errorf(codes.InvalidArgument, "filter on %s must be of type %s", f.Field, schema[i].Type)
+		}
+
+		result = append(result, hocdb.Filter{FieldIndex: i, Value: value})
+	}
+	return result, nil
+}
+
+func fieldIndex(schema []hocdb.Field, name string) int {
+	for i, field := range schema {
+		if field.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// appendError maps engine append failures onto gRPC codes
+func appendError(err error) error {
+	msg := err.Error()
+	switch {
+	case errors.Is(err, hocdb.ErrTimestampNotMonotonic):
+		return status.Error(codes.FailedPrecondition, msg)
+	case strings.Contains(msg, "invalid record size"):
+		return status.Error(codes.InvalidArgument, msg)
+	default:
+		return status.Error(codes.Internal, msg)
+	}
+}
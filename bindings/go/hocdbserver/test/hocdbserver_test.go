@@ -0,0 +1,150 @@
+package hocdbserver_test
+
+import (
+	"context"
+	"hocdb"
+	"hocdb/hocdbserver"
+	"hocdb/hocdbserver/hocdbpb"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestServer(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "side", Type: hocdb.TypeString},
+	}
+
+	testDir := "../../../../b_go_test_data_server"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	srv := hocdbserver.New()
+	srv.Add("BTC_USD", db)
+
+	lis := bufconn.Listen(1 << 20)
+	g := grpc.NewServer()
+	srv.Register(g)
+	go g.Serve(lis)
+	defer g.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	client := hocdbpb.NewHOCDBServiceClient(conn)
+	ctx := context.Background()
+
+	schemaResp, err := client.Schema(ctx, &hocdbpb.SchemaRequest{Ticker: "BTC_USD"})
+	if err != nil {
+		t.Fatalf("Schema failed: %v", err)
+	}
+	if len(schemaResp.Fields) != 3 || schemaResp.Fields[2].Type != hocdbpb.FieldType_FIELD_TYPE_STRING || schemaResp.RecordSize != 144 {
+		t.Fatalf("Unexpected schema: %v", schemaResp)
+	}
+
+	var records []byte
+	for i, side := range []string{"buy", "sell", "buy"} {
+		record, _ := hocdb.CreateRecordBytes(schema, int64(100*(i+1)), float64(10+i), side)
+		records = append(records, record...)
+	}
+	appendResp, err := client.Append(ctx, &hocdbpb.AppendRequest{Ticker: "BTC_USD", Records: records})
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if appendResp.Appended != 3 {
+		t.Errorf("Expected 3 appended, got %d", appendResp.Appended)
+	}
+
+	_, err = client.Append(ctx, &hocdbpb.AppendRequest{Ticker: "BTC_USD", Records: records[:144]})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition for a stale timestamp, got %v", err)
+	}
+	_, err = client.Append(ctx, &hocdbpb.AppendRequest{Ticker: "BTC_USD", Records: records[:10]})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for a partial record, got %v", err)
+	}
+	if _, err := client.Flush(ctx, &hocdbpb.FlushRequest{Ticker: "BTC_USD"}); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	stream, err := client.Query(ctx, &hocdbpb.QueryRequest{
+		Ticker:  "BTC_USD",
+		StartTs: 0,
+		EndTs:   1000,
+		Filters: []*hocdbpb.Filter{{Field: "side", Value: &hocdbpb.Filter_Str{Str: "buy"}}},
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	var data []byte
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Query stream failed: %v", err)
+		}
+		data = append(data, resp.Records...)
+	}
+	decoded, err := hocdb.DecodeRecords(schema, data)
+	if err != nil {
+		t.Fatalf("DecodeRecords failed: %v", err)
+	}
+	if len(decoded) != 2 || decoded[0].Timestamp() != 100 || decoded[1].Timestamp() != 300 {
+		t.Errorf("Unexpected query result: %v", decoded)
+	}
+
+	stats, err := client.Stats(ctx, &hocdbpb.StatsRequest{Ticker: "BTC_USD", StartTs: 0, EndTs: 1000, Field: "price"})
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.Count != 3 || stats.Min != 10 || stats.Max != 12 {
+		t.Errorf("Unexpected stats: %v", stats)
+	}
+
+	latest, err := client.Latest(ctx, &hocdbpb.LatestRequest{Ticker: "BTC_USD", Field: "price"})
+	if err != nil {
+		t.Fatalf("Latest failed: %v", err)
+	}
+	if latest.Value != 12 || latest.Timestamp != 300 {
+		t.Errorf("Unexpected latest: %v", latest)
+	}
+
+	tickers, err := client.ListTickers(ctx, &hocdbpb.ListTickersRequest{})
+	if err != nil || len(tickers.Tickers) != 1 || tickers.Tickers[0] != "BTC_USD" {
+		t.Errorf("Unexpected tickers: %v, %v", tickers, err)
+	}
+
+	_, err = client.Schema(ctx, &hocdbpb.SchemaRequest{Ticker: "ETH_USD"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for an unknown ticker, got %v", err)
+	}
+	stream, _ = client.Query(ctx, &hocdbpb.QueryRequest{
+		Ticker:  "BTC_USD",
+		EndTs:   1000,
+		Filters: []*hocdbpb.Filter{{Field: "side", Value: &hocdbpb.Filter_I64{I64: 1}}},
+	})
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for a mistyped filter, got %v", err)
+	}
+}
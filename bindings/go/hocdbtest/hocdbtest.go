@@ -0,0 +1,132 @@
+/*
+Package hocdbtest provides helpers for tests of code using HOCDB: databases in
+temporary directories that are closed and removed with the test, and generated
+records for any schema.
+
+Example usage:
+
+	func TestIngest(t *testing.T) {
+	    db := hocdbtest.NewTempDB(t, hocdbtest.TickSchema, hocdb.Options{})
+	    hocdbtest.Fill(t, db, 1000, 1, 1)
+
+	    data, err := db.Query(100, 200, nil)
+	    ...
+	}
+*/
+package hocdbtest
+
+import (
+	"hocdb"
+	"strconv"
+	"testing"
+)
+
+// Ticker is the ticker of the databases NewTempDB creates
+const Ticker = "TEST"
+
+// TickSchema is a schema of price ticks for tests that don't need their own
+var TickSchema = []hocdb.Field{
+	{Name: "timestamp", Type: hocdb.TypeI64},
+	{Name: "price", Type: hocdb.TypeF64},
+	{Name: "volume", Type: hocdb.TypeF64},
+}
+
+// NewTempDB creates a database with schema and options in a directory of its own,
+// which is removed once the test and its subtests finished. The database is closed
+// then too, so tests may but needn't close it themselves. Failures end the test.
+func NewTempDB(t testing.TB, schema []hocdb.Field, opts hocdb.Options) *hocdb.DB {
+	t.Helper()
+	db, err := hocdb.New(Ticker, t.TempDir(), schema, opts)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+// Value returns the value generated for a field of type t in the i-th record: i
+// converted to the type, truncated to the width of narrow types, "i" for strings
+// and blobs, and whether i is even for booleans
+func Value(t hocdb.FieldType, i int) interface{} {
+	switch {
+	case t.IsString():
+		s := strconv.Itoa(i)
+		if len(s) > t.Size() {
+			s = s[len(s)-t.Size():]
+		}
+		return s
+	case t.IsBytes():
+		b := []byte(strconv.Itoa(i))
+		if len(b) > t.Size()-2 {
+			b = b[len(b)-(t.Size()-2):]
+		}
+		return b
+	case t.IsDecimal():
+		return hocdb.Decimal{Unscaled: int64(i), Scale: t.Scale()}
+	}
+	switch t {
+	case hocdb.TypeI64:
+		return int64(i)
+	case hocdb.TypeF64:
+		return float64(i)
+	case hocdb.TypeU64:
+		return uint64(i)
+	case hocdb.TypeBool:
+		return i%2 == 0
+	case hocdb.TypeI32:
+		return int32(i)
+	case hocdb.TypeU32:
+		return uint32(i)
+	case hocdb.TypeF32:
+		return float32(i)
+	case hocdb.TypeI16:
+		return int16(i)
+	case hocdb.TypeU8:
+		return uint8(i)
+	}
+	return nil
+}
+
+// Record returns the i-th generated record of schema with timestamp ts, its other
+// fields set by Value. Failures end the test.
+func Record(t testing.TB, schema []hocdb.Field, i int, ts int64) []byte {
+	t.Helper()
+	values := make([]interface{}, len(schema))
+	for k, field := range schema {
+		if field.Name == "timestamp" {
+			values[k] = ts
+		} else {
+			values[k] = Value(field.Type, i)
+		}
+	}
+	rec, err := hocdb.CreateRecordBytes(schema, values...)
+	if err != nil {
+		t.Fatalf("Failed to create record: %v", err)
+	}
+	return rec
+}
+
+// Records returns n generated records of schema, the i-th with timestamp
+// start+i*step, see Record
+func Records(t testing.TB, schema []hocdb.Field, n int, start, step int64) []byte {
+	t.Helper()
+	data := make([]byte, 0, n*hocdb.RecordSize(schema))
+	for i := 0; i < n; i++ {
+		data = append(data, Record(t, schema, i, start+int64(i)*step)...)
+	}
+	return data
+}
+
+// Fill appends n generated records to db, see Records, and returns them. Failures
+// end the test.
+func Fill(t testing.TB, db *hocdb.DB, n int, start, step int64) []byte {
+	t.Helper()
+	data := Records(t, db.Schema(), n, start, step)
+	size := db.RecordSize()
+	for off := 0; off < len(data); off += size {
+		if err := db.Append(data[off : off+size]); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	return data
+}
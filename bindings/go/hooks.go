@@ -0,0 +1,239 @@
+package hocdb
+
+// hooks holds the callbacks registered on a DB
+type hooks struct {
+	onAppend []func(Record)
+	onFlush  []func()
+	onRotate []func()
+	onEvict  []func(Record)
+	onSlow   []func(SlowQuery)
+	onSeg    []func(SegmentInfo)
+
+	// cursor mirrors the engine's write cursor once OnRotate needs it, 0 until then
+	cursor int64
+
+	// evictAt mirrors the engine's write cursor once OnEvict needs it, 0 until then,
+	// ahead of cursor by the appends noteAppend hasn't seen yet, and evictFull
+	// whether the data file is full. evicted holds what each of those appends
+	// overwrote, nil when nothing, see readEvictions.
+	evictAt   int64
+	evictFull bool
+	evicted   [][]byte
+
+	// autoTs mirrors the last timestamp assigned by AutoIncrement once it is known
+	autoTs      int64
+	autoTsKnown bool
+}
+
+// OnAppend registers a callback that runs after every successful Append with the
+// appended record, including the timestamp assigned by AutoIncrement. Callbacks run
+// synchronously on the appending goroutine in registration order, outside the
+// database's lock so they may call back into it. Callbacks of concurrent appends may
+// run concurrently. Keep them short and don't modify the record.
+func (db *DB) OnAppend(fn func(Record)) {
+	db.hookMu.Lock()
+	defer db.hookMu.Unlock()
+	db.hooks.onAppend = append(db.hooks.onAppend, fn)
+}
+
+// OnFlush registers a callback that runs after pending writes reached the data file,
+// that is after every successful Flush, after every Append with FlushOnWrite, and
+// whenever the flush policy of Options syncs
+func (db *DB) OnFlush(fn func()) {
+	db.hookMu.Lock()
+	defer db.hookMu.Unlock()
+	db.hooks.onFlush = append(db.hooks.onFlush, fn)
+}
+
+// OnRotate registers a callback that runs when a full database opened with
+// OverwriteFull wraps around and starts overwriting its oldest records. It runs
+// before the OnAppend callbacks of the append that caused the wrap. Registering it
+// flushes pending writes to locate the engine's write position.
+func (db *DB) OnRotate(fn func()) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.hookMu.Lock()
+	defer db.hookMu.Unlock()
+	db.hooks.onRotate = append(db.hooks.onRotate, fn)
+
+	if db.handle == nil || !db.options.OverwriteFull || db.hooks.cursor != 0 {
+		return
+	}
+	if err := db.flush(); err != nil {
+		return
+	}
+	if cursor, err := db.writeCursor(); err == nil {
+		db.hooks.cursor = cursor
+	}
+}
+
+// OnSlowQuery registers a callback that runs after every Query, Load and GetStats
+// call, and every query of a Pool, that took at least Options.SlowQueryThreshold.
+// Callbacks run synchronously on the querying goroutine, outside the database's
+// lock.
+func (db *DB) OnSlowQuery(fn func(SlowQuery)) {
+	db.hookMu.Lock()
+	defer db.hookMu.Unlock()
+	db.hooks.onSlow = append(db.hooks.onSlow, fn)
+}
+
+// OnSegment registers a callback that runs with every compressed segment Compact
+// or a background compaction writes, after it was synced, so that archival jobs
+// can pick up the file right away instead of polling Segments.
+// MaxFileSize doesn't start new files: without OverwriteFull, appends to a full
+// data file fail, so segments are the files a database completes. Callbacks run
+// synchronously on the compacting goroutine, outside the database's lock.
+func (db *DB) OnSegment(fn func(SegmentInfo)) {
+	db.hookMu.Lock()
+	defer db.hookMu.Unlock()
+	db.hooks.onSeg = append(db.hooks.onSeg, fn)
+}
+
+// segmentHooks returns the OnSegment callbacks
+func (db *DB) segmentHooks() []func(SegmentInfo) {
+	db.hookMu.Lock()
+	defer db.hookMu.Unlock()
+	return db.hooks.onSeg
+}
+
+// slowQueryHooks returns the OnSlowQuery callbacks
+func (db *DB) slowQueryHooks() []func(SlowQuery) {
+	db.hookMu.Lock()
+	defer db.hookMu.Unlock()
+	return db.hooks.onSlow
+}
+
+// appendEvent carries what the callbacks of one append need out of the lock
+type appendEvent struct {
+	rec      *Record
+	rotated  bool
+	evicted  *Record
+	onAppend []func(Record)
+	onFlush  []func()
+	onRotate []func()
+	onEvict  []func(Record)
+}
+
+// noteAppend mirrors the engine's state after a successful append and feeds the
+// log, metrics and subscriptions; db.mu must be held, so records reach them in append order
+func (db *DB) noteAppend(data []byte) appendEvent {
+	db.hookMu.Lock()
+	ev := appendEvent{onAppend: db.hooks.onAppend, onRotate: db.hooks.onRotate}
+	if db.options.FlushOnWrite {
+		ev.onFlush = db.hooks.onFlush
+	}
+	if h := &db.hooks; h.cursor != 0 {
+		size := int64(len(data))
+		if h.cursor+size > db.maxFileSize() {
+			h.cursor = fileHeaderSize
+			ev.rotated = true
+		}
+		h.cursor += size
+	}
+	var evicted []byte
+	if h := &db.hooks; len(h.evicted) > 0 {
+		evicted, h.evicted[0] = h.evicted[0], nil
+		h.evicted = h.evicted[1:]
+		ev.onEvict = h.onEvict
+	}
+	if db.hooks.autoTsKnown {
+		db.hooks.autoTs += db.options.AutoIncrement.step()
+	}
+	db.hookMu.Unlock()
+	if err := db.wal.append(data); err != nil {
+		db.logError("failed to write the WAL", err)
+	} else if db.options.FlushOnWrite {
+		if err := db.wal.write(); err != nil {
+			db.logError("failed to write the WAL", err)
+		}
+	}
+	if db.head != nil {
+		// The engine wrote the record out already with FlushOnWrite
+		db.head.dirty = true
+		if db.options.FlushOnWrite {
+			db.notifyReaders(false)
+		}
+	}
+
+	if ev.rotated {
+		db.logRotate()
+	}
+	if m := db.options.Metrics; m != nil {
+		m.ObserveAppend(1, len(data))
+	}
+	if evicted != nil && len(ev.onEvict) > 0 {
+		if values, err := DecodeRecord(db.schema, evicted); err == nil {
+			ev.evicted = &Record{Schema: db.schema, Values: values}
+		}
+	}
+	if len(ev.onAppend) == 0 && !db.subscribed() {
+		return ev
+	}
+	values, err := DecodeRecord(db.schema, data)
+	if err != nil {
+		return ev
+	}
+	if db.options.AutoIncrement != nil {
+		ts, err := db.assignedTimestamp()
+		if err != nil {
+			return ev
+		}
+		values[db.fieldMap["timestamp"]] = ts
+	}
+	ev.rec = &Record{Schema: db.schema, Values: values}
+	db.publish(*ev.rec)
+	return ev
+}
+
+// run runs the callbacks of an append
+func (ev appendEvent) run() {
+	if ev.rotated {
+		for _, fn := range ev.onRotate {
+			fn()
+		}
+	}
+	if ev.evicted != nil {
+		for _, fn := range ev.onEvict {
+			fn(*ev.evicted)
+		}
+	}
+	for _, fn := range ev.onFlush {
+		fn()
+	}
+	if ev.rec != nil {
+		for _, fn := range ev.onAppend {
+			fn(*ev.rec)
+		}
+	}
+}
+
+// flushHooks returns the OnFlush callbacks
+func (db *DB) flushHooks() []func() {
+	db.hookMu.Lock()
+	defer db.hookMu.Unlock()
+	return db.hooks.onFlush
+}
+
+// afterFlush runs the OnFlush callbacks
+func (db *DB) afterFlush() {
+	for _, fn := range db.flushHooks() {
+		fn()
+	}
+}
+
+// assignedTimestamp returns the timestamp AutoIncrement gave the latest record. The
+// first call asks the engine; later appends are counted in noteAppend. db.mu must
+// be held.
+func (db *DB) assignedTimestamp() (int64, error) {
+	db.hookMu.Lock()
+	defer db.hookMu.Unlock()
+	if !db.hooks.autoTsKnown {
+		latest, err := db.getLatest(db.fieldMap["timestamp"])
+		if err != nil {
+			return 0, err
+		}
+		db.hooks.autoTs = latest.Timestamp
+		db.hooks.autoTsKnown = true
+	}
+	return db.hooks.autoTs, nil
+}
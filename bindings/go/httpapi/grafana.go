@@ -0,0 +1,382 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"hocdb"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GrafanaOptions configures GrafanaHandler
+type GrafanaOptions struct {
+	TimestampUnit time.Duration // Unit of stored timestamps, defaults to time.Second
+}
+
+// GrafanaHandler returns an http.Handler implementing the Grafana JSON datasource
+// API on top of the server's tickers:
+//
+//	GET  /             connection test
+//	POST /search       targets of the form ticker.field, for every numeric field
+//	POST /query        time series or tables for the requested targets
+//	POST /annotations  one annotation per record of ticker.field, or of ticker.field=value
+//
+// Time series are averaged into buckets when they have more points than the panel's
+// maxDataPoints. Bool fields are charted as 0 and 1. Mount it on its own prefix and
+// point the datasource URL at it:
+//
+//	http.Handle("/grafana/", http.StripPrefix("/grafana", httpapi.GrafanaHandler(srv, httpapi.GrafanaOptions{})))
+func GrafanaHandler(s *Server, opts GrafanaOptions) http.Handler {
+	if opts.TimestampUnit <= 0 {
+		opts.TimestampUnit = time.Second
+	}
+	g := &grafana{server: s, unit: opts.TimestampUnit}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var err error
+		switch strings.Trim(req.URL.Path, "/") {
+		case "":
+			rw.WriteHeader(http.StatusOK)
+			return
+		case "search":
+			err = g.serve(rw, req, g.search)
+		case "query":
+			err = g.serve(rw, req, g.query)
+		case "annotations":
+			err = g.serve(rw, req, g.annotations)
+		default:
+			err = errorf(http.StatusNotFound, "not found")
+		}
+		if err != nil {
+			writeError(rw, err)
+		}
+	})
+}
+
+type grafana struct {
+	server *Server
+	unit   time.Duration
+}
+
+// grafanaRange is the dashboard time range of a query or annotation request
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// point is a time series value at a time in milliseconds
+type point struct {
+	ms    int64
+	value float64
+}
+
+// serve decodes a JSON request body for an endpoint and encodes its response
+func (g *grafana) serve(rw http.ResponseWriter, req *http.Request, endpoint func(body []byte) (interface{}, error)) error {
+	if req.Method != http.MethodPost {
+		return errorf(http.StatusMethodNotAllowed, "method not allowed")
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxBodySize))
+	if err != nil {
+		return errorf(http.StatusBadRequest, "%v", err)
+	}
+	resp, err := endpoint(body)
+	if err != nil {
+		return err
+	}
+	return writeJSON(rw, http.StatusOK, resp)
+}
+
+func (g *grafana) search(body []byte) (interface{}, error) {
+	var req struct {
+		Target string `json:"target"`
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, errorf(http.StatusBadRequest, "invalid JSON: %v", err)
+		}
+	}
+	filter := strings.ToLower(req.Target)
+
+	g.server.mu.RLock()
+	targets := []string{}
+	for name, t := range g.server.tickers {
+		for _, field := range t.schema {
+			if field.Name == "timestamp" || !isNumeric(field.Type) {
+				continue
+			}
+			target := name + "." + field.Name
+			if strings.Contains(strings.ToLower(target), filter) {
+				targets = append(targets, target)
+			}
+		}
+	}
+	g.server.mu.RUnlock()
+
+	sort.Strings(targets)
+	return targets, nil
+}
+
+func (g *grafana) query(body []byte) (interface{}, error) {
+	var req struct {
+		Range         grafanaRange `json:"range"`
+		MaxDataPoints int          `json:"maxDataPoints"`
+		Targets       []struct {
+			Target string `json:"target"`
+			Type   string `json:"type"`
+			Hide   bool   `json:"hide"`
+		} `json:"targets"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid JSON: %v", err)
+	}
+
+	results := []interface{}{}
+	for _, target := range req.Targets {
+		if target.Hide || target.Target == "" {
+			continue
+		}
+		var result interface{}
+		var err error
+		if target.Type == "table" {
+			result, err = g.table(target.Target, req.Range)
+		} else {
+			result, err = g.timeSeries(target.Target, req.Range, req.MaxDataPoints)
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (g *grafana) timeSeries(target string, r grafanaRange, maxDataPoints int) (interface{}, error) {
+	name, field, _ := strings.Cut(target, ".")
+	t, err := g.server.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	i := fieldIndex(t.schema, field)
+	if i < 0 || !isNumeric(t.schema[i].Type) {
+		return nil, errorf(http.StatusBadRequest, "target must be ticker.field with a numeric field: %s", target)
+	}
+
+	records, err := g.records(t, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]point, 0, len(records))
+	for _, rec := range records {
+		if rec.Values[i] == nil {
+			// Nulls leave a gap rather than a zero
+			continue
+		}
+		v, _ := numericValue(rec.Values[i])
+		points = append(points, point{ms: g.millis(rec.Timestamp()), value: v})
+	}
+	points = downsample(points, maxDataPoints)
+
+	datapoints := make([][2]interface{}, len(points))
+	for j, p := range points {
+		datapoints[j] = [2]interface{}{jsonFloat(p.value), p.ms}
+	}
+	return map[string]interface{}{"target": target, "datapoints": datapoints}, nil
+}
+
+func (g *grafana) table(target string, r grafanaRange) (interface{}, error) {
+	// A table shows one field, or every field for a bare ticker name
+	name, field, _ := strings.Cut(target, ".")
+	t, err := g.server.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []int
+	for i, f := range t.schema {
+		if f.Name != "timestamp" && (field == "" || f.Name == field) {
+			indexes = append(indexes, i)
+		}
+	}
+	if field != "" && len(indexes) == 0 {
+		return nil, errorf(http.StatusBadRequest, "unknown field: %s", field)
+	}
+
+	columns := []map[string]string{{"text": "Time", "type": "time"}}
+	for _, i := range indexes {
+		typ := "number"
+		if t.schema[i].Type.IsString() {
+			typ = "string"
+		}
+		columns = append(columns, map[string]string{"text": t.schema[i].Name, "type": typ})
+	}
+
+	records, err := g.records(t, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([][]interface{}, len(records))
+	for j, rec := range records {
+		row := []interface{}{g.millis(rec.Timestamp())}
+		for _, i := range indexes {
+			if v, ok := numericValue(rec.Values[i]); ok {
+				row = append(row, jsonFloat(v))
+			} else {
+				row = append(row, rec.Values[i])
+			}
+		}
+		rows[j] = row
+	}
+	return map[string]interface{}{"type": "table", "columns": columns, "rows": rows}, nil
+}
+
+func (g *grafana) annotations(body []byte) (interface{}, error) {
+	var req struct {
+		Range      grafanaRange    `json:"range"`
+		Annotation json.RawMessage `json:"annotation"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid JSON: %v", err)
+	}
+	var annotation struct {
+		Query string `json:"query"`
+	}
+	if len(req.Annotation) > 0 {
+		if err := json.Unmarshal(req.Annotation, &annotation); err != nil {
+			return nil, errorf(http.StatusBadRequest, "invalid annotation: %v", err)
+		}
+	}
+
+	// ticker.field annotates every record, ticker.field=value only matching ones
+	target, value, hasValue := strings.Cut(annotation.Query, "=")
+	name, field, _ := strings.Cut(target, ".")
+	t, err := g.server.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	i := fieldIndex(t.schema, field)
+	if i < 0 {
+		return nil, errorf(http.StatusBadRequest, "annotation query must be ticker.field or ticker.field=value: %s", annotation.Query)
+	}
+	var filters []hocdb.Filter
+	if hasValue {
+		v, err := hocdb.ParseValue(t.schema[i].Type, value)
+		if err != nil {
+			return nil, errorf(http.StatusBadRequest, "annotation filter on %s: %v", field, err)
+		}
+		filters = []hocdb.Filter{{FieldIndex: i, Value: v}}
+	}
+
+	records, err := g.records(t, req.Range, filters)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]map[string]interface{}, len(records))
+	for j, rec := range records {
+		results[j] = map[string]interface{}{
+			"annotation": req.Annotation,
+			"time":       g.millis(rec.Timestamp()),
+			"title":      field,
+			"text":       fmt.Sprint(rec.Values[i]),
+			"tags":       []string{name},
+		}
+	}
+	return results, nil
+}
+
+// records queries the ticker over a dashboard time range, end included
+func (g *grafana) records(t *ticker, r grafanaRange, filters []hocdb.Filter) ([]hocdb.Record, error) {
+	startTs := r.From.UnixNano() / int64(g.unit)
+	endTs := r.To.UnixNano() / int64(g.unit)
+	if r.To.IsZero() {
+		endTs = math.MaxInt64
+	} else if endTs < math.MaxInt64 {
+		endTs++
+	}
+	if r.From.IsZero() {
+		startTs = math.MinInt64
+	}
+
+	t.mu.Lock()
+	var data []byte
+	var err error
+	if len(filters) > 0 {
+		data, err = t.db.Query(startTs, endTs, filters)
+	} else {
+		data, err = t.db.Query(startTs, endTs, nil)
+	}
+	t.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return hocdb.DecodeRecords(t.schema, data)
+}
+
+// millis converts a stored timestamp into milliseconds since the epoch
+func (g *grafana) millis(ts int64) int64 {
+	if g.unit >= time.Millisecond {
+		return ts * int64(g.unit/time.Millisecond)
+	}
+	return ts / int64(time.Millisecond/g.unit)
+}
+
+// downsample averages points into at most maxPoints buckets of equal width
+func downsample(points []point, maxPoints int) []point {
+	if maxPoints <= 0 || len(points) <= maxPoints {
+		return points
+	}
+
+	first, last := points[0].ms, points[len(points)-1].ms
+	width := (last-first)/int64(maxPoints) + 1
+
+	var result []point
+	var sum float64
+	var count int
+	bucket := first
+	for _, p := range points {
+		if p.ms >= bucket+width {
+			result = append(result, point{ms: bucket, value: sum / float64(count)})
+			bucket += (p.ms - bucket) / width * width
+			sum, count = 0, 0
+		}
+		sum += p.value
+		count++
+	}
+	return append(result, point{ms: bucket, value: sum / float64(count)})
+}
+
+func isNumeric(t hocdb.FieldType) bool {
+	return !t.IsString() && !t.IsBytes() && t.Size() > 0
+}
+
+// numericValue converts a decoded value to float64 for charting
+func numericValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case uint64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case hocdb.Decimal:
+		return v.Float64(), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,530 @@
+/*
+Package httpapi serves HOCDB databases over a plain HTTP/JSON API for tools that
+don't speak gRPC.
+
+Endpoints, relative to where the handler is mounted:
+
+	GET  /tickers                      list tickers
+	GET  /tickers/{ticker}/schema      fields and record size
+	GET  /tickers/{ticker}/records     records in [start, end), other parameters filter by field value
+	POST /tickers/{ticker}/records     append a JSON object, a JSON array of objects, NDJSON or CSV
+	GET  /tickers/{ticker}/stats       statistics of ?field= in [start, end)
+	GET  /tickers/{ticker}/latest      newest value of ?field=
+	GET  /tickers/{ticker}/tail        WebSocket pushing appended records as they arrive
+
+Responses are JSON unless the Accept header (or a format=csv|ndjson|json query
+parameter) asks for CSV or newline-delimited JSON. start and end default to the
+whole time range. Errors are returned as {"error": "..."}.
+
+The tail endpoint sends every new record as a JSON text message; ?since=<timestamp>
+replays stored records from that timestamp first. Records appended through the
+server are pushed right away, others at the next TailInterval or after Notify.
+Browser pages of other origins are refused unless CheckOrigin accepts them, and
+fragmented client messages close the connection.
+
+GrafanaHandler serves the same tickers to Grafana's JSON datasource plugin.
+
+Example usage:
+
+	srv := httpapi.New()
+	srv.Add("BTC_USD", db)
+
+	http.Handle("/api/", http.StripPrefix("/api", srv))
+	http.ListenAndServe(":8080", nil)
+*/
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hocdb"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBodySize bounds the size of an append request
+const maxBodySize = 64 << 20
+
+// Server is an http.Handler serving registered databases. Requests on the same
+// ticker are serialized.
+type Server struct {
+	// TailInterval is how often tickers with live-tail subscribers are checked for
+	// records appended directly to the database. Defaults to one second; set it
+	// before serving.
+	TailInterval time.Duration
+
+	// CheckOrigin decides whether to accept a live-tail WebSocket from the page of
+	// the request's Origin. By default only requests without an Origin, which don't
+	// come from a browser page, and from pages of the requested host are, so that
+	// other sites can't open the tail with their visitors' credentials. Set it
+	// before serving.
+	CheckOrigin func(req *http.Request) bool
+
+	mu      sync.RWMutex
+	tickers map[string]*ticker
+}
+
+type ticker struct {
+	mu     sync.Mutex
+	db     *hocdb.DB
+	schema []hocdb.Field
+
+	// Live tail, running while there are subscribers
+	tailing bool
+	subs    map[*subscriber]struct{}
+	wake    chan struct{}
+	last    int64 // Timestamp of the newest record pushed
+}
+
+// New creates a server with no tickers
+func New() *Server {
+	return &Server{tickers: make(map[string]*ticker)}
+}
+
+// Add makes an open database available under the given ticker name. The server
+// doesn't take ownership of the database.
+func (s *Server) Add(name string, db *hocdb.DB) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tickers[name] = &ticker{db: db, schema: db.Schema()}
+}
+
+// Remove stops serving a ticker and disconnects its live-tail subscribers
+func (s *Server) Remove(name string) {
+	s.mu.Lock()
+	t, ok := s.tickers[name]
+	delete(s.tickers, name)
+	s.mu.Unlock()
+
+	if ok {
+		t.closeSubscribers()
+	}
+}
+
+// Notify pushes records appended to a ticker outside the server to its live-tail
+// subscribers without waiting for the next TailInterval
+func (s *Server) Notify(name string) {
+	t, err := s.lookup(name)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.notify()
+}
+
+// Close disconnects every live-tail subscriber. http.Server.Shutdown doesn't, since
+// their connections are no longer managed by net/http.
+func (s *Server) Close() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.tickers {
+		t.closeSubscribers()
+	}
+	return nil
+}
+
+// httpError is an error carrying the status code to respond with
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+func errorf(status int, format string, args ...interface{}) error {
+	return &httpError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+// ServeHTTP routes a request to its endpoint
+func (s *Server) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+
+	var err error
+	switch {
+	case len(parts) == 1 && parts[0] == "tickers":
+		err = s.allow(req, http.MethodGet)
+		if err == nil {
+			err = s.listTickers(rw, req)
+		}
+	case len(parts) == 3 && parts[0] == "tickers":
+		err = s.serveTicker(rw, req, parts[1], parts[2])
+	default:
+		err = errorf(http.StatusNotFound, "not found")
+	}
+
+	if err != nil && err != errHijacked {
+		writeError(rw, err)
+	}
+}
+
+func (s *Server) serveTicker(rw http.ResponseWriter, req *http.Request, name, endpoint string) error {
+	var methods []string
+	switch endpoint {
+	case "schema", "stats", "latest", "tail":
+		methods = []string{http.MethodGet}
+	case "records":
+		methods = []string{http.MethodGet, http.MethodPost}
+	default:
+		return errorf(http.StatusNotFound, "not found")
+	}
+	if err := s.allow(req, methods...); err != nil {
+		return err
+	}
+
+	t, err := s.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	if endpoint == "tail" {
+		// Holds the connection open, taking the ticker lock only as needed
+		return s.serveTail(rw, req, t)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case endpoint == "schema":
+		return t.schemaInfo(rw, req)
+	case endpoint == "stats":
+		return t.stats(rw, req)
+	case endpoint == "latest":
+		return t.latest(rw, req)
+	case req.Method == http.MethodPost:
+		return t.appendRecords(rw, req)
+	default:
+		return t.queryRecords(rw, req)
+	}
+}
+
+// lookup returns a registered ticker, which the caller locks while using its database
+func (s *Server) lookup(name string) (*ticker, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tickers[name]
+	if !ok {
+		return nil, errorf(http.StatusNotFound, "unknown ticker: %s", name)
+	}
+	return t, nil
+}
+
+func (s *Server) allow(req *http.Request, methods ...string) error {
+	for _, m := range methods {
+		if req.Method == m {
+			return nil
+		}
+	}
+	return errorf(http.StatusMethodNotAllowed, "method not allowed")
+}
+
+func (s *Server) listTickers(rw http.ResponseWriter, req *http.Request) error {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.tickers))
+	for name := range s.tickers {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+	sort.Strings(names)
+
+	rows := make([][]string, len(names))
+	for i, name := range names {
+		rows[i] = []string{name}
+	}
+	return writeResult(rw, req, map[string]interface{}{"tickers": names}, []string{"ticker"}, rows)
+}
+
+func (t *ticker) schemaInfo(rw http.ResponseWriter, req *http.Request) error {
+	fields := make([]map[string]string, len(t.schema))
+	rows := make([][]string, len(t.schema))
+	for i, field := range t.schema {
+		// Nullable fields as in ParseSchema
+		typ := field.Type.String()
+		if field.Nullable {
+			typ += "?"
+		}
+		fields[i] = map[string]string{"name": field.Name, "type": typ}
+		rows[i] = []string{field.Name, typ}
+	}
+	body := map[string]interface{}{"fields": fields, "record_size": hocdb.RecordSize(t.schema)}
+	return writeResult(rw, req, body, []string{"name", "type"}, rows)
+}
+
+func (t *ticker) queryRecords(rw http.ResponseWriter, req *http.Request) error {
+	params := req.URL.Query()
+	startTs, endTs, err := timeRange(params)
+	if err != nil {
+		return err
+	}
+
+	// Every parameter other than the reserved ones filters on a field
+	var filters []hocdb.Filter
+	for key, values := range params {
+		if key == "start" || key == "end" || key == "format" {
+			continue
+		}
+		i := fieldIndex(t.schema, key)
+		if i < 0 {
+			return errorf(http.StatusBadRequest, "unknown field in filter: %s", key)
+		}
+		v, err := hocdb.ParseValue(t.schema[i].Type, values[len(values)-1])
+		if err != nil {
+			return errorf(http.StatusBadRequest, "filter on %s: %v", key, err)
+		}
+		filters = append(filters, hocdb.Filter{FieldIndex: i, Value: v})
+	}
+
+	var data []byte
+	if len(filters) > 0 {
+		data, err = t.db.Query(startTs, endTs, filters)
+	} else {
+		data, err = t.db.Query(startTs, endTs, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch negotiate(req) {
+	case "csv":
+		rw.Header().Set("Content-Type", "text/csv")
+		return hocdb.WriteCSV(rw, t.schema, data, hocdb.CSVOptions{})
+	case "ndjson":
+		rw.Header().Set("Content-Type", "application/x-ndjson")
+		return hocdb.WriteJSON(rw, t.schema, data)
+	default:
+		// Turn the NDJSON rendering into an array
+		var buf bytes.Buffer
+		if err := hocdb.WriteJSON(&buf, t.schema, data); err != nil {
+			return err
+		}
+		lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+		if buf.Len() == 0 {
+			lines = nil
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte("["))
+		rw.Write(bytes.Join(lines, []byte(",")))
+		_, err := rw.Write([]byte("]\n"))
+		return err
+	}
+}
+
+func (t *ticker) appendRecords(rw http.ResponseWriter, req *http.Request) error {
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxBodySize+1))
+	if err != nil {
+		return errorf(http.StatusBadRequest, "%v", err)
+	}
+	if len(body) > maxBodySize {
+		return errorf(http.StatusRequestEntityTooLarge, "request body too large")
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	var result *hocdb.ImportResult
+	switch mediaType {
+	case "text/csv":
+		result, err = t.db.ImportCSV(bytes.NewReader(body), hocdb.CSVMapping{})
+	case "application/x-ndjson":
+		result, err = t.db.ImportJSON(bytes.NewReader(body))
+	default:
+		// A single object or an array of objects, appended as one NDJSON line each
+		trimmed := bytes.TrimSpace(body)
+		lines := [][]byte{trimmed}
+		if len(trimmed) > 0 && trimmed[0] == '[' {
+			var objects []json.RawMessage
+			if err := json.Unmarshal(trimmed, &objects); err != nil {
+				return errorf(http.StatusBadRequest, "invalid JSON: %v", err)
+			}
+			lines = lines[:0]
+			for _, obj := range objects {
+				var compact bytes.Buffer
+				if err := json.Compact(&compact, obj); err != nil {
+					return errorf(http.StatusBadRequest, "invalid JSON: %v", err)
+				}
+				lines = append(lines, compact.Bytes())
+			}
+		} else {
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, trimmed); err != nil {
+				return errorf(http.StatusBadRequest, "invalid JSON: %v", err)
+			}
+			lines[0] = compact.Bytes()
+		}
+		result, err = t.db.ImportJSON(bytes.NewReader(bytes.Join(lines, []byte("\n"))))
+	}
+	if err != nil {
+		return err
+	}
+	if result.Imported > 0 {
+		t.notify()
+	}
+
+	// Lines are records for JSON arrays and NDJSON, and rows including the header for CSV
+	resp := map[string]interface{}{"appended": result.Imported}
+	status := http.StatusOK
+	if len(result.Errors) > 0 {
+		errs := make([]map[string]interface{}, len(result.Errors))
+		for i, e := range result.Errors {
+			errs[i] = map[string]interface{}{"line": e.Line, "error": e.Err.Error()}
+		}
+		resp["errors"] = errs
+		status = http.StatusUnprocessableEntity
+	}
+	return writeJSON(rw, status, resp)
+}
+
+func (t *ticker) stats(rw http.ResponseWriter, req *http.Request) error {
+	params := req.URL.Query()
+	startTs, endTs, err := timeRange(params)
+	if err != nil {
+		return err
+	}
+	field := params.Get("field")
+	if fieldIndex(t.schema, field) < 0 {
+		return errorf(http.StatusBadRequest, "unknown field: %s", field)
+	}
+
+	stats, err := t.db.GetStatsByName(startTs, endTs, field)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{
+		"min":   jsonFloat(stats.Min),
+		"max":   jsonFloat(stats.Max),
+		"sum":   jsonFloat(stats.Sum),
+		"count": stats.Count,
+		"mean":  jsonFloat(stats.Mean),
+	}
+	row := []string{
+		formatFloat(stats.Min), formatFloat(stats.Max), formatFloat(stats.Sum),
+		strconv.FormatUint(stats.Count, 10), formatFloat(stats.Mean),
+	}
+	return writeResult(rw, req, body, []string{"min", "max", "sum", "count", "mean"}, [][]string{row})
+}
+
+func (t *ticker) latest(rw http.ResponseWriter, req *http.Request) error {
+	field := req.URL.Query().Get("field")
+	if fieldIndex(t.schema, field) < 0 {
+		return errorf(http.StatusBadRequest, "unknown field: %s", field)
+	}
+
+	latest, err := t.db.GetLatestByName(field)
+	if err != nil {
+		// The engine fails on empty databases
+		return errorf(http.StatusNotFound, "%v", err)
+	}
+
+	body := map[string]interface{}{"value": jsonFloat(latest.Value), "timestamp": latest.Timestamp}
+	row := []string{formatFloat(latest.Value), strconv.FormatInt(latest.Timestamp, 10)}
+	return writeResult(rw, req, body, []string{"value", "timestamp"}, [][]string{row})
+}
+
+// timeRange reads the start and end parameters, defaulting to the whole range
+func timeRange(params map[string][]string) (int64, int64, error) {
+	startTs, endTs := int64(math.MinInt64), int64(math.MaxInt64)
+	for key, dst := range map[string]*int64{"start": &startTs, "end": &endTs} {
+		values := params[key]
+		if len(values) == 0 {
+			continue
+		}
+		v, err := strconv.ParseInt(values[len(values)-1], 10, 64)
+		if err != nil {
+			return 0, 0, errorf(http.StatusBadRequest, "invalid %s: %s", key, values[len(values)-1])
+		}
+		*dst = v
+	}
+	return startTs, endTs, nil
+}
+
+func fieldIndex(schema []hocdb.Field, name string) int {
+	for i, field := range schema {
+		if field.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// negotiate picks the response format from the format parameter or the Accept header
+func negotiate(req *http.Request) string {
+	switch req.URL.Query().Get("format") {
+	case "csv":
+		return "csv"
+	case "ndjson":
+		return "ndjson"
+	case "json":
+		return "json"
+	}
+
+	for _, part := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(part))
+		switch mediaType {
+		case "text/csv":
+			return "csv"
+		case "application/x-ndjson":
+			return "ndjson"
+		case "application/json":
+			return "json"
+		}
+	}
+	return "json"
+}
+
+// writeResult writes body as JSON, or header and rows as CSV
+func writeResult(rw http.ResponseWriter, req *http.Request, body interface{}, header []string, rows [][]string) error {
+	if negotiate(req) != "csv" {
+		return writeJSON(rw, http.StatusOK, body)
+	}
+
+	rw.Header().Set("Content-Type", "text/csv")
+	cw := csv.NewWriter(rw)
+	cw.Write(header)
+	cw.WriteAll(rows)
+	return cw.Error()
+}
+
+func writeJSON(rw http.ResponseWriter, status int, body interface{}) error {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	bw := bufio.NewWriter(rw)
+	if err := json.NewEncoder(bw).Encode(body); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func writeError(rw http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var he *httpError
+	if errors.As(err, &he) {
+		status = he.status
+	}
+	writeJSON(rw, status, map[string]string{"error": err.Error()})
+}
+
+// jsonFloat maps non-finite floats to null, which JSON can represent
+func jsonFloat(f float64) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil
+	}
+	return f
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,265 @@
+package httpapi
+
+import (
+	"bytes"
+	"errors"
+	"hocdb"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultTailInterval is how often tails look for records appended behind the server's back
+const defaultTailInterval = time.Second
+
+// tailBuffer is the number of records queued for a subscriber before it is
+// disconnected as too slow
+const tailBuffer = 1024
+
+// subscriber is a live-tail WebSocket connection
+type subscriber struct {
+	conn *wsConn
+	send chan []byte
+	done chan struct{}
+
+	once   sync.Once
+	code   uint16
+	reason string
+}
+
+// closeWith asks the subscriber to close with a status code; the first call wins
+func (sub *subscriber) closeWith(code uint16, reason string) {
+	sub.once.Do(func() {
+		sub.code, sub.reason = code, reason
+		close(sub.done)
+	})
+}
+
+// offer queues a message without blocking, reporting whether there was room
+func (sub *subscriber) offer(msg []byte) bool {
+	select {
+	case sub.send <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// run writes the replayed and then the live records until the subscriber is closed
+func (sub *subscriber) run(replay [][]byte) {
+	go sub.readLoop()
+
+	for _, msg := range replay {
+		if err := sub.conn.writeFrame(opText, msg); err != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case msg := <-sub.send:
+			if err := sub.conn.writeFrame(opText, msg); err != nil {
+				return
+			}
+		case <-sub.done:
+			sub.conn.writeClose(sub.code, sub.reason)
+			return
+		}
+	}
+}
+
+// readLoop answers pings and notices the client going away
+func (sub *subscriber) readLoop() {
+	for {
+		opcode, payload, err := sub.conn.readFrame()
+		if err != nil {
+			var fe *frameError
+			if errors.As(err, &fe) {
+				sub.closeWith(fe.code, fe.reason)
+			} else {
+				sub.closeWith(closeProtocolError, "")
+			}
+			return
+		}
+		switch opcode {
+		case opClose:
+			sub.closeWith(closeNormal, "")
+			return
+		case opPing:
+			sub.conn.writeFrame(opPong, payload)
+		}
+	}
+}
+
+// serveTail upgrades the request to a WebSocket and streams records appended to the
+// ticker, each as a JSON text message. With ?since=<timestamp>, stored records from
+// that timestamp on are sent first.
+func (s *Server) serveTail(rw http.ResponseWriter, req *http.Request, t *ticker) error {
+	since, replay := int64(0), false
+	if text := req.URL.Query().Get("since"); text != "" {
+		v, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return errorf(http.StatusBadRequest, "invalid since: %s", text)
+		}
+		since, replay = v, true
+	}
+
+	checkOrigin := s.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	conn, err := upgrade(rw, req, checkOrigin)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	sub := &subscriber{
+		conn: conn,
+		send: make(chan []byte, tailBuffer),
+		done: make(chan struct{}),
+	}
+	msgs, err := t.subscribe(sub, since, replay, s.tailInterval())
+	if err != nil {
+		conn.writeClose(closeInternalError, err.Error())
+		return nil
+	}
+	defer t.unsubscribe(sub)
+
+	sub.run(msgs)
+	return nil
+}
+
+func (s *Server) tailInterval() time.Duration {
+	if s.TailInterval > 0 {
+		return s.TailInterval
+	}
+	return defaultTailInterval
+}
+
+// subscribe registers a subscriber, starting the ticker's tail if it is the first
+// one, and returns the stored records to replay from since
+func (t *ticker) subscribe(sub *subscriber, since int64, replay bool, interval time.Duration) ([][]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.tailing {
+		t.last = math.MinInt64
+		if latest, err := t.db.GetLatest(0); err == nil {
+			t.last = latest.Timestamp
+		}
+		t.subs = make(map[*subscriber]struct{})
+		t.wake = make(chan struct{}, 1)
+		t.tailing = true
+		go t.tail(t.wake, interval)
+	}
+
+	var msgs [][]byte
+	if replay && since <= t.last && t.last < math.MaxInt64 {
+		data, err := t.db.Query(since, t.last+1, nil)
+		if err != nil {
+			return nil, err
+		}
+		if msgs, err = t.messages(data); err != nil {
+			return nil, err
+		}
+	}
+
+	t.subs[sub] = struct{}{}
+	return msgs, nil
+}
+
+func (t *ticker) unsubscribe(sub *subscriber) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.subs, sub)
+}
+
+// closeSubscribers disconnects every subscriber of the ticker
+func (t *ticker) closeSubscribers() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for sub := range t.subs {
+		sub.closeWith(closeGoingAway, "ticker removed")
+		delete(t.subs, sub)
+	}
+}
+
+// notify wakes the tail, if any, so it pushes new records right away
+func (t *ticker) notify() {
+	if !t.tailing {
+		return
+	}
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// tail pushes new records to the subscribers whenever it is notified and at every
+// interval, until none are left
+func (t *ticker) tail(wake <-chan struct{}, interval time.Duration) {
+	timer := time.NewTicker(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-wake:
+		case <-timer.C:
+		}
+
+		t.mu.Lock()
+		if len(t.subs) == 0 {
+			t.tailing = false
+			t.mu.Unlock()
+			return
+		}
+		t.push()
+		t.mu.Unlock()
+	}
+}
+
+// push sends records newer than the last pushed one to every subscriber. The
+// caller holds the ticker lock.
+func (t *ticker) push() {
+	if t.last == math.MaxInt64 {
+		return
+	}
+	data, err := t.db.Query(t.last+1, math.MaxInt64, nil)
+	if err != nil || len(data) == 0 {
+		// Retried at the next wake-up
+		return
+	}
+	msgs, err := t.messages(data)
+	if err != nil {
+		return
+	}
+	records, err := hocdb.DecodeRecords(t.schema, data[len(data)-hocdb.RecordSize(t.schema):])
+	if err != nil {
+		return
+	}
+	t.last = records[0].Timestamp()
+
+	for sub := range t.subs {
+		for _, msg := range msgs {
+			if !sub.offer(msg) {
+				sub.closeWith(closePolicyViolation, "subscriber too slow")
+				delete(t.subs, sub)
+				break
+			}
+		}
+	}
+}
+
+// messages renders query output as one JSON object per record
+func (t *ticker) messages(data []byte) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	if err := hocdb.WriteJSON(&buf, t.schema, data); err != nil {
+		return nil, err
+	}
+	return bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n")), nil
+}
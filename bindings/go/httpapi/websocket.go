@@ -0,0 +1,224 @@
+package httpapi
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A minimal server side of the WebSocket protocol (RFC 6455), enough to push text
+// messages and answer control frames. Messages from clients are read and dropped;
+// fragmented ones are refused.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xa
+)
+
+const (
+	closeNormal          = 1000
+	closeGoingAway       = 1001
+	closeProtocolError   = 1002
+	closeUnsupported     = 1003
+	closePolicyViolation = 1008
+	closeInternalError   = 1011
+)
+
+// maxFrameSize bounds frames read from clients, which have nothing to send but
+// control frames
+const maxFrameSize = 64 << 10
+
+// writeTimeout bounds a single frame write, so a stalled client can't block a tail
+const writeTimeout = 10 * time.Second
+
+// errHijacked reports a failure after the connection was taken over from net/http,
+// when no HTTP error response can be written any more
+var errHijacked = errors.New("websocket handshake failed")
+
+// frameError is a frame the client shouldn't have sent, answered with a close
+// frame of its status code
+type frameError struct {
+	code   uint16
+	reason string
+}
+
+func (e *frameError) Error() string {
+	return e.reason
+}
+
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	mu   sync.Mutex // Serializes writes
+}
+
+// sameOrigin reports whether a request comes from a page of the host it was sent
+// to, or not from a browser page at all
+func sameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, req.Host)
+}
+
+// upgrade performs the WebSocket handshake and takes over the connection, for
+// requests whose Origin checkOrigin accepts
+func upgrade(rw http.ResponseWriter, req *http.Request, checkOrigin func(*http.Request) bool) (*wsConn, error) {
+	if !headerContains(req.Header, "Connection", "upgrade") || !headerContains(req.Header, "Upgrade", "websocket") {
+		rw.Header().Set("Upgrade", "websocket")
+		return nil, errorf(http.StatusUpgradeRequired, "expected a WebSocket upgrade")
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		rw.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, errorf(http.StatusBadRequest, "unsupported WebSocket version")
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, errorf(http.StatusBadRequest, "missing Sec-WebSocket-Key")
+	}
+	if !checkOrigin(req) {
+		return nil, errorf(http.StatusForbidden, "origin not allowed: %s", req.Header.Get("Origin"))
+	}
+
+	hj, ok := rw.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("connection does not support WebSocket upgrades")
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	accept := sha1.Sum([]byte(key + websocketGUID))
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(accept[:]) + "\r\n\r\n"
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, errHijacked
+	}
+	return &wsConn{conn: conn, br: brw.Reader}, nil
+}
+
+// headerContains reports whether a comma-separated header holds a token
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readFrame reads one frame from the client and unmasks its payload. Fragmented
+// messages fail with a *frameError.
+func (c *wsConn) readFrame() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return 0, nil, err
+	}
+	fin := head[0]&0x80 != 0
+	opcode := head[0] & 0x0f
+	if head[0]&0x70 != 0 {
+		return 0, nil, &frameError{closeProtocolError, "reserved bits set"}
+	}
+	if !fin || opcode == 0 {
+		return 0, nil, &frameError{closeUnsupported, "fragmented messages are not supported"}
+	}
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7f)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if !masked {
+		return 0, nil, errors.New("unmasked client frame")
+	}
+	if length > maxFrameSize {
+		return 0, nil, errors.New("frame too large")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+// writeFrame writes an unfragmented, unmasked frame
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	buf := make([]byte, 0, 10+len(payload))
+	buf = append(buf, 0x80|opcode)
+	switch n := len(payload); {
+	case n < 126:
+		buf = append(buf, byte(n))
+	case n <= 0xffff:
+		buf = append(buf, 126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, 127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+	buf = append(buf, payload...)
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// writeClose sends a close frame with a status code and reason
+func (c *wsConn) writeClose(code uint16, reason string) error {
+	// Control frame payloads are limited to 125 bytes
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload := binary.BigEndian.AppendUint16(nil, code)
+	return c.writeFrame(opClose, append(payload, reason...))
+}
+
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,387 @@
+package hocdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// indexFileExt is the extension of the index files CreateIndex writes next to the
+// data file, named <ticker>.<field index>.idx. Each holds the timestamp and the
+// value of the field of every record in the data file.
+const indexFileExt = ".idx"
+
+// fieldIndex is a secondary index on a field, mapping its values to the records
+// holding them
+type fieldIndex struct {
+	field    int
+	file     *os.File
+	rows     int64              // Number of records indexed
+	postings map[string][]int64 // Record numbers in the data file by raw value
+}
+
+// indexFile returns the path of the index file of a field
+func (db *DB) indexFile(field int) string {
+	return filepath.Join(db.dataDir(), fmt.Sprintf("%s.%d%s", db.ticker, field, indexFileExt))
+}
+
+// CreateIndex indexes the values of a field, so that queries with an equality
+// filter on it read only the matching records instead of scanning their whole
+// time range. The index is kept in a file next to the data file, updated on every
+// flush, and used by later opens of the database. F32 and F64 fields can't be
+// indexed, and neither can databases with OverwriteFull or EncryptionKey.
+func (db *DB) CreateIndex(field string) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.handle == nil {
+		return errors.New("database not initialized")
+	}
+	i, ok := db.fieldMap[field]
+	if !ok {
+		return fmt.Errorf("unknown field: %s", field)
+	}
+	if t := db.schema[i].Type; t == TypeF64 || t == TypeF32 {
+		return fmt.Errorf("field %s: %s fields can't be indexed", field, t)
+	}
+	if db.options.OverwriteFull || db.enc != nil {
+		return errors.New("indexes need a database without OverwriteFull or EncryptionKey")
+	}
+	for _, idx := range db.indexes {
+		if idx.field == i {
+			return nil
+		}
+	}
+	if err := db.flush(); err != nil {
+		return err
+	}
+	if err := db.openIndex(i); err != nil {
+		return fmt.Errorf("failed to create index on %s: %w", field, err)
+	}
+	return nil
+}
+
+// DropIndex removes the index on a field
+func (db *DB) DropIndex(field string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	i, ok := db.fieldMap[field]
+	if !ok {
+		return fmt.Errorf("unknown field: %s", field)
+	}
+	for k, idx := range db.indexes {
+		if idx.field == i {
+			idx.file.Close()
+			db.indexes = append(db.indexes[:k], db.indexes[k+1:]...)
+			return os.Remove(db.indexFile(i))
+		}
+	}
+	return fmt.Errorf("field %s has no index", field)
+}
+
+// Indexes returns the names of the indexed fields
+func (db *DB) Indexes() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var names []string
+	for _, idx := range db.indexes {
+		names = append(names, db.schema[idx.field].Name)
+	}
+	return names
+}
+
+// openIndexes opens the index files left by CreateIndex; db.mu must be held unless
+// db isn't shared yet
+func (db *DB) openIndexes() error {
+	entries, err := os.ReadDir(db.dataDir())
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		rest, ok := strings.CutPrefix(entry.Name(), db.ticker+".")
+		if !ok || !strings.HasSuffix(rest, indexFileExt) {
+			continue
+		}
+		i, err := strconv.Atoi(strings.TrimSuffix(rest, indexFileExt))
+		if err != nil || i < 0 || i >= len(db.schema) || db.indexFile(i) != filepath.Join(db.dataDir(), entry.Name()) {
+			continue
+		}
+		if err := db.openIndex(i); err != nil {
+			db.closeIndexes()
+			return fmt.Errorf("index on %s: %w", db.schema[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// openIndex opens or creates the index file of a field, loads it and brings it up
+// to date; db.mu must be held
+func (db *DB) openIndex(field int) error {
+	f, err := os.OpenFile(db.indexFile(field), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	idx := &fieldIndex{field: field, file: f, postings: make(map[string][]int64)}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		f.Close()
+		return err
+	}
+	entrySize := 8 + db.schema[field].Type.Size()
+	for off := 0; off+entrySize <= len(data); off += entrySize {
+		key := string(data[off+8 : off+entrySize])
+		idx.postings[key] = append(idx.postings[key], idx.rows)
+		idx.rows++
+	}
+	if err := db.updateIndex(idx); err != nil {
+		f.Close()
+		return err
+	}
+	db.indexes = append(db.indexes, idx)
+	return nil
+}
+
+// closeIndexes closes the index files
+func (db *DB) closeIndexes() {
+	for _, idx := range db.indexes {
+		idx.file.Close()
+	}
+	db.indexes = nil
+}
+
+// removeIndexes deletes the index files; db.mu must be held
+func (db *DB) removeIndexes() {
+	for _, idx := range db.indexes {
+		idx.file.Close()
+		os.Remove(db.indexFile(idx.field))
+	}
+	db.indexes = nil
+}
+
+// updateIndexes brings the indexes up to date with the data file; db.mu must be held
+func (db *DB) updateIndexes() error {
+	if db.readOnly {
+		return nil
+	}
+	for _, idx := range db.indexes {
+		if err := db.updateIndex(idx); err != nil {
+			return fmt.Errorf("index on %s: %w", db.schema[idx.field].Name, err)
+		}
+	}
+	return nil
+}
+
+// updateIndex adds the records flushed since the last update to an index. Like the
+// column files, an index cut back or rebuilt when the data file was truncated or
+// rewritten; db.mu must be held.
+func (db *DB) updateIndex(idx *fieldIndex) error {
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	recordSize := int64(RecordSize(db.schema))
+	end, err := dataEnd(f, recordSize)
+	if err != nil {
+		return err
+	}
+	rows := (end - fileHeaderSize) / recordSize
+	size := db.schema[idx.field].Type.Size()
+	entrySize := int64(8 + size)
+	tsOffset, _ := timestampOffset(db.schema)
+
+	same, err := sameTimestamps(f, recordSize, tsOffset, min64(rows, idx.rows), func(row int64) (int64, error) {
+		return readInt64At(idx.file, row*entrySize)
+	})
+	if err != nil {
+		return err
+	}
+	if !same {
+		idx.rows, idx.postings = 0, make(map[string][]int64)
+	}
+	if idx.rows > rows {
+		for key, list := range idx.postings {
+			n := sort.Search(len(list), func(i int) bool { return list[i] >= rows })
+			if n == 0 {
+				delete(idx.postings, key)
+			} else {
+				idx.postings[key] = list[:n]
+			}
+		}
+		idx.rows = rows
+	}
+	if err := idx.file.Truncate(idx.rows * entrySize); err != nil {
+		return err
+	}
+	if idx.rows == rows {
+		return nil
+	}
+
+	offset := db.fieldOffset(idx.field)
+	var entries []byte
+	row := idx.rows
+	err = scanRecords(f, recordSize, tsOffset, fileHeaderSize+idx.rows*recordSize, end, func(_, ts int64, rec []byte) bool {
+		entries = binary.LittleEndian.AppendUint64(entries, uint64(ts))
+		entries = append(entries, rec[offset:offset+size]...)
+		key := string(rec[offset : offset+size])
+		idx.postings[key] = append(idx.postings[key], row)
+		row++
+		return true
+	})
+	if err == nil {
+		_, err = idx.file.WriteAt(entries, idx.rows*entrySize)
+	}
+	if err != nil {
+		// Start over on the next update rather than trust postings the file lacks
+		idx.rows, idx.postings = 0, make(map[string][]int64)
+		return err
+	}
+	idx.rows = rows
+	return nil
+}
+
+// remapIndexes recreates the indexes of the fields still in a new schema after a
+// rewrite of the data file, given the indexed field names before; db.mu must be held
+func (db *DB) remapIndexes(names []string, oldFiles []string) error {
+	db.closeIndexes()
+	for _, name := range oldFiles {
+		os.Remove(name)
+	}
+	for _, name := range names {
+		for i, field := range db.schema {
+			if field.Name == name {
+				if err := db.openIndex(i); err != nil {
+					return fmt.Errorf("index on %s: %w", name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// indexKey returns the raw value a record holds in a field when it matches m, and
+// whether m can be looked up in an index at all
+func indexKey(m *matcher, t FieldType) (string, bool) {
+	if m.never || m.isNull {
+		return "", false
+	}
+	switch m.narrow {
+	case TypeI32, TypeU32:
+		return string(binary.LittleEndian.AppendUint32(nil, uint32(m.i64))), true
+	case TypeI16:
+		return string(binary.LittleEndian.AppendUint16(nil, uint16(m.i64))), true
+	case TypeU8:
+		return string([]byte{byte(m.i64)}), true
+	case TypeF32:
+		return "", false
+	}
+	switch m.typ {
+	case TypeF64:
+		return "", false
+	case TypeBool:
+		if m.b {
+			return "\x01", true
+		}
+		return "\x00", true
+	}
+	return string(m.raw), len(m.raw) == t.Size()
+}
+
+// pickIndex returns the index with the fewest records matching the filters, nil
+// when no filter is on an indexed field; db.mu must be held
+func (db *DB) pickIndex(filters []Filter, matchers []matcher) (*fieldIndex, []int64) {
+	var best *fieldIndex
+	var bestRows []int64
+	for _, idx := range db.indexes {
+		for k, filter := range filters {
+			if filter.FieldIndex != idx.field || filter.Value == nil {
+				continue
+			}
+			key, ok := indexKey(&matchers[k], db.schema[idx.field].Type)
+			if !ok {
+				continue
+			}
+			if rows := idx.postings[key]; best == nil || len(rows) < len(bestRows) {
+				best, bestRows = idx, rows
+			}
+		}
+	}
+	return best, bestRows
+}
+
+// indexQuery runs a query through the most selective index its filters allow,
+// returning the result in C memory like the engine, the number of records read and
+// whether an index was used, see withSegments for q; db.mu must be held
+func (db *DB) indexQuery(startTs, endTs int64, filters []Filter, q *queryInfo) (unsafe.Pointer, int, int, bool, error) {
+	if len(db.indexes) == 0 || len(filters) == 0 {
+		return nil, 0, 0, false, nil
+	}
+	matchers, err := db.matchers(filters)
+	if err != nil {
+		return nil, 0, 0, false, err
+	}
+	idx, _ := db.pickIndex(filters, matchers)
+	if idx == nil {
+		return nil, 0, 0, false, nil
+	}
+	// The index covers flushed records only
+	if err := db.flush(); err != nil {
+		return nil, 0, 0, true, err
+	}
+	_, rows := db.pickIndex(filters, matchers)
+
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		return nil, 0, 0, true, err
+	}
+	defer f.Close()
+	recordSize := int64(RecordSize(db.schema))
+	tsOffset, _ := timestampOffset(db.schema)
+	v := &fileView{f: f, size: recordSize, tsOffset: tsOffset, count: idx.rows, marks: db.tsMarks}
+	first, err := v.search(startTs)
+	if err != nil {
+		return nil, 0, 0, true, err
+	}
+	last, err := v.search(endTs)
+	if err != nil {
+		return nil, 0, 0, true, err
+	}
+	lo := sort.Search(len(rows), func(i int) bool { return rows[i] >= first })
+	hi := sort.Search(len(rows), func(i int) bool { return rows[i] >= last })
+
+	var result []byte
+	rec := make([]byte, recordSize)
+	for _, row := range rows[lo:hi] {
+		if _, err := f.ReadAt(rec, v.offset(row)); err != nil {
+			return nil, 0, 0, true, err
+		}
+		if matchAll(matchers, rec) {
+			result = append(result, rec...)
+			q.limit.match()
+		}
+		if err := q.limit.check(recordSize); err != nil {
+			return nil, 0, 0, true, err
+		}
+	}
+	var dataPtr unsafe.Pointer
+	if len(result) > 0 {
+		dataPtr = cBytes(result)
+	}
+	q.bytesRead += int64(hi-lo) * recordSize
+	dataPtr, outLen, scanned, err := db.withSegments(dataPtr, len(result), startTs, endTs, filters, q)
+	if err != nil {
+		if dataPtr != nil {
+			engineFree(dataPtr)
+		}
+		return nil, 0, 0, true, err
+	}
+	return dataPtr, outLen, hi - lo + scanned, true, nil
+}
@@ -0,0 +1,305 @@
+package hocdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InfluxMapping describes how the points of an InfluxDB measurement map onto the
+// databases ImportInflux backfills
+type InfluxMapping struct {
+	Dir        string            // Data directory of the databases, created if needed
+	Schema     []Field           // Schema of the databases; the timestamp field holds the time of the points
+	Options    Options           // Options the databases are opened with
+	Columns    map[string]string // Schema field name -> InfluxDB field or tag; unlisted fields use the column with the same name
+	TickerTags []string          // Tags whose values are appended to the measurement to form the ticker, like lineproto.Mapping
+	Separator  string            // Joins the measurement and tag values, defaults to "_"
+	Token      string            // API token, for InfluxDB 2.x and 3.x
+	Start, End time.Time         // Range of the points to import, [Start, End); zero values leave it open
+	PageSize   int               // Points read per request, defaults to 10000
+	BatchSize  int               // Number of records appended between flushes, defaults to 1000
+	Client     *http.Client      // Client of the requests, defaults to http.DefaultClient
+}
+
+// ImportInflux backfills databases with the points of a measurement, to migrate
+// off InfluxDB. It pages through the points in time order with InfluxQL queries
+// to the /query endpoint of sourceURL, which InfluxDB 1.x serves and 2.x and 3.x
+// serve for buckets with a database mapping. bucket is the database of 1.x;
+// credentials of 1.x go in the user info of sourceURL. Each point goes to the
+// ticker of its measurement and TickerTags, whose database is created with the
+// schema if needed.
+//
+// Points that fail to convert or append are recorded in the result with their
+// position in the import as the line, and skipped; the returned error is only set
+// when the import cannot continue. Null values of nullable fields are imported as
+// nulls.
+func ImportInflux(sourceURL, bucket, measurement string, mapping InfluxMapping) (*ImportResult, error) {
+	if RecordSize(mapping.Schema) == 0 {
+		return nil, errors.New("import needs a schema")
+	}
+	tsIndex := -1
+	for i, field := range mapping.Schema {
+		if field.Name == "timestamp" {
+			tsIndex = i
+		}
+	}
+	if tsIndex < 0 {
+		return nil, errors.New("schema has no timestamp field")
+	}
+	if mapping.Separator == "" {
+		mapping.Separator = "_"
+	}
+	if mapping.PageSize <= 0 {
+		mapping.PageSize = 10000
+	}
+	if mapping.Client == nil {
+		mapping.Client = http.DefaultClient
+	}
+	source, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source URL: %w", err)
+	}
+	user := source.User
+	source.User = nil
+	source.Path = strings.TrimSuffix(source.Path, "/") + "/query"
+
+	imp := &influxImport{
+		mapping:     mapping,
+		measurement: measurement,
+		tsIndex:     tsIndex,
+		batches:     make(map[string]*importBatch),
+		result:      &ImportResult{},
+	}
+	defer imp.close()
+
+	// Pages start at the time of the last point read, after the points read at it
+	from, seen := int64(math.MinInt64), 0
+	if !mapping.Start.IsZero() {
+		from = mapping.Start.UnixNano()
+	}
+	for {
+		query := source.Query()
+		query.Set("db", bucket)
+		query.Set("epoch", "ns")
+		query.Set("q", influxSelect(measurement, from, mapping.End, mapping.PageSize, seen))
+		req, err := http.NewRequest(http.MethodGet, source.String()+"?"+query.Encode(), nil)
+		if err != nil {
+			return imp.finish(err)
+		}
+		if user != nil {
+			password, _ := user.Password()
+			req.SetBasicAuth(user.Username(), password)
+		}
+		if mapping.Token != "" {
+			req.Header.Set("Authorization", "Token "+mapping.Token)
+		}
+
+		series, err := influxQuery(mapping.Client, req)
+		if err != nil {
+			return imp.finish(err)
+		}
+		rows := 0
+		for _, s := range series {
+			for _, row := range s.Values {
+				rows++
+				ts, err := imp.add(s.Columns, row)
+				if err != nil {
+					return imp.finish(err)
+				}
+				if ts == from {
+					seen++
+				} else {
+					from, seen = ts, 1
+				}
+			}
+		}
+		if rows < mapping.PageSize {
+			return imp.finish(nil)
+		}
+	}
+}
+
+// influxSelect returns the query of a page of points
+func influxSelect(measurement string, from int64, end time.Time, limit, offset int) string {
+	var b strings.Builder
+	b.WriteString(`SELECT * FROM "`)
+	b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(measurement))
+	b.WriteByte('"')
+	var conds []string
+	if from != math.MinInt64 {
+		conds = append(conds, fmt.Sprintf("time >= %d", from))
+	}
+	if !end.IsZero() {
+		conds = append(conds, fmt.Sprintf("time < %d", end.UnixNano()))
+	}
+	if len(conds) > 0 {
+		b.WriteString(" WHERE ")
+		b.WriteString(strings.Join(conds, " AND "))
+	}
+	fmt.Fprintf(&b, " ORDER BY time ASC LIMIT %d OFFSET %d", limit, offset)
+	return b.String()
+}
+
+// influxSeries is a series of the response of /query
+type influxSeries struct {
+	Columns []string        `json:"columns"`
+	Values  [][]interface{} `json:"values"`
+}
+
+// influxQuery runs a query and returns the series of its single statement
+func influxQuery(client *http.Client, req *http.Request) ([]influxSeries, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("influx query failed: %w", err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Results []struct {
+			Series []influxSeries `json:"series"`
+			Error  string         `json:"error"`
+		} `json:"results"`
+		Error string `json:"error"`
+	}
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return nil, fmt.Errorf("influx query failed: %s %s", resp.Status, text)
+		}
+		return nil, fmt.Errorf("influx query failed: %w", err)
+	}
+	switch {
+	case body.Error != "":
+		return nil, fmt.Errorf("influx query failed: %s", body.Error)
+	case len(body.Results) == 0:
+		return nil, nil
+	case body.Results[0].Error != "":
+		return nil, fmt.Errorf("influx query failed: %s", body.Results[0].Error)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("influx query failed: %s", resp.Status)
+	}
+	return body.Results[0].Series, nil
+}
+
+// influxImport is the state of an ImportInflux
+type influxImport struct {
+	mapping     InfluxMapping
+	measurement string
+	tsIndex     int
+	batches     map[string]*importBatch // By ticker
+	result      *ImportResult
+	points      int
+}
+
+// add converts a row of a series and queues it in the batch of its ticker,
+// returning its timestamp in nanoseconds
+func (imp *influxImport) add(columns []string, row []interface{}) (int64, error) {
+	imp.points++
+	index := make(map[string]int, len(columns))
+	for i, name := range columns {
+		index[name] = i
+	}
+	column := func(name string) interface{} {
+		if i, ok := index[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return nil
+	}
+
+	t, ok := column("time").(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("point %d has no time", imp.points)
+	}
+	ts, err := t.Int64()
+	if err != nil {
+		return 0, fmt.Errorf("point %d: invalid time %s", imp.points, t)
+	}
+
+	values := make([]interface{}, len(imp.mapping.Schema))
+	err = func() error {
+		for i, field := range imp.mapping.Schema {
+			if i == imp.tsIndex {
+				values[i] = time.Unix(0, ts)
+				continue
+			}
+			name := field.Name
+			if mapped, ok := imp.mapping.Columns[name]; ok {
+				name = mapped
+			}
+			var text string
+			switch v := column(name).(type) {
+			case nil:
+				if !field.Nullable {
+					return fmt.Errorf("missing field %s", field.Name)
+				}
+				values[i] = nil
+				continue
+			case json.Number:
+				text = v.String()
+			case string:
+				text = v
+			case bool:
+				text = strconv.FormatBool(v)
+			default:
+				return fmt.Errorf("field %s: unexpected value %v", field.Name, v)
+			}
+			v, err := ParseValue(field.Type, text)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			values[i] = v
+		}
+		return nil
+	}()
+	if err != nil {
+		imp.result.Errors = append(imp.result.Errors, &LineError{Line: imp.points, Err: err})
+		return ts, nil
+	}
+
+	parts := []string{imp.measurement}
+	for _, tag := range imp.mapping.TickerTags {
+		if v, ok := column(tag).(string); ok && v != "" {
+			parts = append(parts, v)
+		}
+	}
+	// Tickers become file names
+	ticker := strings.NewReplacer("/", "_", "\\", "_").Replace(strings.Join(parts, imp.mapping.Separator))
+	batch, ok := imp.batches[ticker]
+	if !ok {
+		db, err := New(ticker, imp.mapping.Dir, imp.mapping.Schema, imp.mapping.Options)
+		if err != nil {
+			return ts, fmt.Errorf("failed to open ticker %s: %w", ticker, err)
+		}
+		batch = newImportBatch(db, db.schema, imp.mapping.BatchSize)
+		batch.result = imp.result
+		imp.batches[ticker] = batch
+	}
+	return ts, batch.add(imp.points, values)
+}
+
+// finish commits the queued records, returning the result with err or the first
+// commit error
+func (imp *influxImport) finish(err error) (*ImportResult, error) {
+	for _, batch := range imp.batches {
+		if cerr := batch.commit(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return imp.result, err
+}
+
+// close closes the databases
+func (imp *influxImport) close() {
+	for _, batch := range imp.batches {
+		batch.db.Close()
+	}
+}
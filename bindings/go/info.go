@@ -0,0 +1,124 @@
+package hocdb
+
+import (
+	"errors"
+	"math"
+	"os"
+	"strings"
+)
+
+// Info describes the records and files of a database, see DB.Info
+type Info struct {
+	Ticker     string
+	Records    int64  // Records in the compressed segments and the data file
+	DiskBytes  int64  // Total size of the files
+	Files      int    // Data file, metadata, segments, indexes and other files of the ticker
+	ActiveFile string // Path of the data file appends go to, the encrypted one when encrypted
+	Oldest     int64  // Timestamp of the oldest record, 0 when empty
+	Newest     int64  // Timestamp of the newest record, 0 when empty
+	Schema     []Field
+}
+
+// Info returns the number of records, the files and disk usage and the time range
+// of the database, for monitoring its growth. Files are those named after the
+// ticker in its directory, so a database opened with OpenReadOnly counts the files
+// of its writer. Like Query, it flushes first.
+func (db *DB) Info() (*Info, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if !db.opened() {
+		return nil, errors.New("database not initialized")
+	}
+	var v *fileView
+	var err error
+	if db.readOnly {
+		if v, err = db.view(); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := db.flush(); err != nil {
+			return nil, err
+		}
+		f, err := os.Open(db.dataFile())
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if v, err = db.dataView(f); err != nil {
+			return nil, err
+		}
+	}
+
+	info := &Info{Ticker: db.ticker, ActiveFile: db.dataFile(), Schema: db.Schema()}
+	if db.enc != nil {
+		info.ActiveFile = encryptedFile(db.path, db.ticker)
+	}
+	for _, s := range db.segments {
+		info.Records += s.count
+	}
+	if len(db.segments) > 0 {
+		info.Oldest, info.Newest = db.segments[0].first, db.segments[len(db.segments)-1].last
+	}
+	// Records a writer is compacting are in the data file and the last segment
+	first, err := v.search(db.tailStart(math.MinInt64))
+	if err != nil {
+		return nil, err
+	}
+	if first < v.count {
+		info.Records += v.count - first
+		if len(db.segments) == 0 {
+			if info.Oldest, err = v.timestampAt((v.start + first) % v.count); err != nil {
+				return nil, err
+			}
+		}
+		if info.Newest, err = v.timestampAt((v.start + v.count - 1) % v.count); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := os.ReadDir(db.path)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !isTickerFile(db.ticker, entry.Name()) {
+			continue
+		}
+		fi, err := entry.Info()
+		if err != nil {
+			continue // Removed meanwhile, by a compaction for instance
+		}
+		info.Files++
+		info.DiskBytes += fi.Size()
+	}
+	return info, nil
+}
+
+// isTickerFile reports whether a file in the directory of a database belongs to
+// ticker, rather than to another ticker whose name starts like it
+func isTickerFile(ticker, name string) bool {
+	rest, ok := strings.CutPrefix(name, ticker)
+	if !ok {
+		return false
+	}
+	switch rest {
+	case dataFileExt, encryptedFileExt, metaFileExt, checksumFileExt, timeIndexExt, zoneFileExt,
+		".nulls" + columnFileExt:
+		return true
+	}
+	// <ticker>.<number><ext> of segments and their zones and bloom filters, indexes
+	// and column files
+	rest, ok = strings.CutPrefix(rest, ".")
+	if !ok {
+		return false
+	}
+	num, ext, ok := strings.Cut(rest, ".")
+	if !ok || num == "" || strings.Trim(num, "0123456789") != "" {
+		return false
+	}
+	switch "." + ext {
+	case segmentExt, segmentZoneExt, bloomFileExt, indexFileExt, columnFileExt:
+		return true
+	}
+	return false
+}
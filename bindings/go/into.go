@@ -0,0 +1,39 @@
+package hocdb
+
+import "unsafe"
+
+// LoadInto is Load writing into buf, which is grown only when the records don't fit.
+// It returns the slice of buf, or of its replacement, holding the records, so tight
+// loops can pass the previous result back in and avoid an allocation per call.
+func (db *DB) LoadInto(buf []byte) ([]byte, error) {
+	dataPtr, outLen, err := db.load()
+	if err != nil {
+		return nil, err
+	}
+	return copyResult(buf, dataPtr, outLen), nil
+}
+
+// QueryInto is Query writing into buf like LoadInto
+func (db *DB) QueryInto(buf []byte, startTs, endTs int64, filters interface{}) ([]byte, error) {
+	dataPtr, outLen, err := db.query(startTs, endTs, filters, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return copyResult(buf, dataPtr, outLen), nil
+}
+
+// copyResult copies a result out of C memory into buf and frees it
+func copyResult(buf []byte, dataPtr unsafe.Pointer, n int) []byte {
+	if dataPtr == nil {
+		n = 0
+	}
+	if cap(buf) < n {
+		buf = make([]byte, n)
+	}
+	buf = buf[:n]
+	if dataPtr != nil {
+		copy(buf, unsafe.Slice((*byte)(dataPtr), n))
+		engineFree(dataPtr)
+	}
+	return buf
+}
@@ -0,0 +1,67 @@
+package hocdb
+
+import (
+	"errors"
+	"math"
+)
+
+// JoinedRecord is a record of the left database of JoinAsOf with the record of the
+// right one that was current at its timestamp
+type JoinedRecord struct {
+	Left  Record
+	Right *Record // nil when the right database had no record within the tolerance
+}
+
+// JoinAsOf aligns the records of two databases by timestamp, such as trades with
+// the quotes in force when they happened. Every record of left in [startTs, endTs)
+// is joined with the latest record of right at or before its timestamp, and no
+// older than tolerance; a negative tolerance accepts records of any age. Both
+// databases must have the same TimestampPrecision.
+func JoinAsOf(left, right *DB, startTs, endTs, tolerance int64) ([]JoinedRecord, error) {
+	if left.TimestampPrecision() != right.TimestampPrecision() {
+		return nil, errors.New("databases have different timestamp precisions")
+	}
+
+	leftData, err := left.Query(startTs, endTs, nil)
+	if err != nil {
+		return nil, err
+	}
+	leftRecords, err := DecodeRecords(left.Schema(), leftData)
+	if err != nil {
+		return nil, err
+	}
+	if len(leftRecords) == 0 {
+		return nil, nil
+	}
+
+	// Right records older than the first left record by more than the tolerance
+	// can't be joined
+	from := int64(math.MinInt64)
+	if first := leftRecords[0].Timestamp(); tolerance >= 0 && first >= math.MinInt64+tolerance {
+		from = first - tolerance
+	}
+	rightData, err := right.Query(from, leftRecords[len(leftRecords)-1].Timestamp()+1, nil)
+	if err != nil {
+		return nil, err
+	}
+	rightRecords, err := DecodeRecords(right.Schema(), rightData)
+	if err != nil {
+		return nil, err
+	}
+
+	joined := make([]JoinedRecord, len(leftRecords))
+	next := 0 // First right record after the current left one
+	for i, rec := range leftRecords {
+		ts := rec.Timestamp()
+		for next < len(rightRecords) && rightRecords[next].Timestamp() <= ts {
+			next++
+		}
+		joined[i].Left = rec
+		if next > 0 {
+			if r := &rightRecords[next-1]; tolerance < 0 || ts-r.Timestamp() <= tolerance {
+				joined[i].Right = r
+			}
+		}
+	}
+	return joined, nil
+}
@@ -0,0 +1,227 @@
+package hocdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ExportJSON writes all records in [startTs, endTs) to w as newline-delimited JSON,
+// one object per record keyed by field name in schema order. Non-finite floats are
+// written as null since JSON cannot represent them. With MaxResultMemory, the
+// range is read in chunks, see QueryFunc.
+func (db *DB) ExportJSON(w io.Writer, startTs, endTs int64) error {
+	if !db.isOpen() {
+		return errors.New("database not initialized")
+	}
+
+	schema, _ := db.layout()
+	return db.queryEach(startTs, endTs, nil, func(data []byte) error {
+		return WriteJSON(w, schema, data)
+	})
+}
+
+// WriteJSON writes raw Load/Query output to w as newline-delimited JSON, formatted
+// like ExportJSON
+func WriteJSON(w io.Writer, schema []Field, data []byte) error {
+	bw := bufio.NewWriter(w)
+	recordSize := RecordSize(schema)
+	var line []byte
+	for offset := 0; offset+recordSize <= len(data); offset += recordSize {
+		values, err := DecodeRecord(schema, data[offset:offset+recordSize])
+		if err != nil {
+			return err
+		}
+		line = appendJSONObject(line[:0], schema, values)
+		line = append(line, '\n')
+		if _, err := bw.Write(line); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// ImportJSON reads newline-delimited JSON objects produced by ExportJSON (or any
+// producer using the same field names) and appends them in batches. Unknown keys
+// are ignored, lines that fail to convert or append are reported in the result.
+// Nullable fields that are null or missing are imported as nulls.
+func (db *DB) ImportJSON(r io.Reader) (*ImportResult, error) {
+	if !db.isOpen() {
+		return nil, errors.New("database not initialized")
+	}
+
+	br := bufio.NewReader(r)
+	schema, _ := db.layout()
+	batch := newImportBatch(db, schema, 0)
+	values := make([]interface{}, len(schema))
+
+	for line := 1; ; line++ {
+		text, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(text)) > 0 {
+			if convErr := jsonValues(schema, text, values); convErr != nil {
+				batch.result.Errors = append(batch.result.Errors, &LineError{Line: line, Err: convErr})
+			} else if addErr := batch.add(line, values); addErr != nil {
+				return batch.result, addErr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return batch.result, err
+		}
+	}
+
+	if err := batch.commit(); err != nil {
+		return batch.result, err
+	}
+
+	return batch.result, nil
+}
+
+// ParseJSONRecord converts a JSON object, such as a line of ExportJSON output or a
+// message of a queue, into values for CreateRecordBytes in schema order, the way
+// ImportJSON does
+func ParseJSONRecord(schema []Field, data []byte) ([]interface{}, error) {
+	values := make([]interface{}, len(schema))
+	if err := jsonValues(schema, data, values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// jsonValues converts a JSON object into values for the fields of schema
+func jsonValues(schema []Field, text []byte, values []interface{}) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(text, &obj); err != nil {
+		return err
+	}
+
+	for i, field := range schema {
+		raw, ok := obj[field.Name]
+		if field.Nullable && (!ok || string(raw) == "null") {
+			values[i] = nil
+			continue
+		}
+		if !ok {
+			return fmt.Errorf("missing field %s", field.Name)
+		}
+		v, err := parseJSONValue(field.Type, raw)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		values[i] = v
+	}
+	return nil
+}
+
+// parseJSONValue decodes a JSON value into the Go value CreateRecordBytes expects
+func parseJSONValue(t FieldType, raw json.RawMessage) (interface{}, error) {
+	switch t.kind() {
+	case TypeI64:
+		return strconv.ParseInt(string(raw), 10, 64)
+	case TypeU64:
+		return strconv.ParseUint(string(raw), 10, 64)
+	case TypeF64:
+		if string(raw) == "null" {
+			return math.NaN(), nil
+		}
+		return strconv.ParseFloat(string(raw), 64)
+	case TypeString:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		return ParseValue(t, s)
+	case TypeDecimal:
+		// A number, or a string for readers that would round it
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			s = string(raw)
+		}
+		return ParseDecimal(s, t.Scale())
+	case TypeBytes:
+		// Base64, as encoding/json writes []byte
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		return ParseValue(t, s)
+	case TypeBool:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	case TypeI32, TypeU32, TypeF32, TypeI16, TypeU8:
+		return ParseValue(t, string(raw))
+	default:
+		return nil, errors.New("unsupported field type")
+	}
+}
+
+// MarshalJSON encodes the record as a JSON object keyed by field name in schema
+// order, formatted like ExportJSON, so that records can be handed to encoding/json
+// directly. Strings are cut at their first NUL, for records holding raw padded
+// field values.
+func (r Record) MarshalJSON() ([]byte, error) {
+	if len(r.Values) != len(r.Schema) {
+		return nil, errors.New("number of values doesn't match schema length")
+	}
+	values := r.Values
+	for i, v := range r.Values {
+		if s, ok := v.(string); ok && strings.IndexByte(s, 0) >= 0 {
+			if &values[0] == &r.Values[0] {
+				values = append([]interface{}(nil), r.Values...)
+			}
+			values[i] = s[:strings.IndexByte(s, 0)]
+		}
+	}
+	return appendJSONObject(nil, r.Schema, values), nil
+}
+
+// appendJSONObject appends values as a JSON object keyed by field name in schema order
+func appendJSONObject(buf []byte, schema []Field, values []interface{}) []byte {
+	buf = append(buf, '{')
+	for i, field := range schema {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = appendJSONValue(buf, field.Name)
+		buf = append(buf, ':')
+		buf = appendJSONValue(buf, values[i])
+	}
+	return append(buf, '}')
+}
+
+// appendJSONValue appends a single decoded value in JSON form
+func appendJSONValue(buf []byte, v interface{}) []byte {
+	switch val := v.(type) {
+	case int64:
+		return strconv.AppendInt(buf, val, 10)
+	case uint64:
+		return strconv.AppendUint(buf, val, 10)
+	case float64:
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return append(buf, "null"...)
+		}
+		return strconv.AppendFloat(buf, val, 'g', -1, 64)
+	case float32:
+		if math.IsNaN(float64(val)) || math.IsInf(float64(val), 0) {
+			return append(buf, "null"...)
+		}
+		return strconv.AppendFloat(buf, float64(val), 'g', -1, 32)
+	case bool:
+		return strconv.AppendBool(buf, val)
+	default:
+		encoded, _ := json.Marshal(val)
+		return append(buf, encoded...)
+	}
+}
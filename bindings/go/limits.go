@@ -0,0 +1,117 @@
+package hocdb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// QueryOpts bounds the work of a single query, see QueryWithOpts. Zero fields
+// don't limit.
+type QueryOpts struct {
+	MaxRows     int64         // Most records the query may return
+	MaxBytes    int64         // Most bytes of records it may read, segments counting uncompressed
+	MaxDuration time.Duration // Longest it may run
+}
+
+// QueryWithOpts is Query bounded by opts: once the query returns more than
+// MaxRows records, reads more than MaxBytes bytes or runs longer than MaxDuration,
+// it is aborted with a QueryLimitError. Such a query reads the data file itself
+// rather than through the engine, so that it can stop part way; the scans check
+// the limits after every few thousand records.
+func (db *DB) QueryWithOpts(startTs, endTs int64, filters interface{}, opts QueryOpts) ([]byte, error) {
+	dataPtr, outLen, err := db.query(startTs, endTs, filters, &opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	if dataPtr == nil {
+		return []byte{}, nil
+	}
+	defer engineFree(dataPtr)
+	return goBytes(dataPtr, outLen), nil
+}
+
+// limited reports whether any of the bounds is set
+func (o *QueryOpts) limited() bool {
+	return o != nil && (o.MaxRows > 0 || o.MaxBytes > 0 || o.MaxDuration > 0)
+}
+
+// ErrQueryLimit is matched by the errors of queries aborted for exceeding one of
+// their QueryOpts, see QueryLimitError
+var ErrQueryLimit = errors.New("query limit exceeded")
+
+// QueryLimitError reports a query that was aborted because it exceeded one of its
+// QueryOpts. Nothing of its result is returned.
+type QueryLimitError struct {
+	Limit string // The exceeded field of QueryOpts, "MaxRows", "MaxBytes" or "MaxDuration", or "MaxResultMemory" of Options
+	Max   int64  // Its value, in nanoseconds for MaxDuration
+}
+
+func (e *QueryLimitError) Error() string {
+	switch e.Limit {
+	case "MaxRows":
+		return fmt.Sprintf("query limit exceeded: more than %d rows", e.Max)
+	case "MaxBytes":
+		return fmt.Sprintf("query limit exceeded: more than %d bytes read", e.Max)
+	case "MaxResultMemory":
+		return fmt.Sprintf("query limit exceeded: result larger than %d bytes, see QueryFunc", e.Max)
+	default:
+		return fmt.Sprintf("query limit exceeded: running longer than %v", time.Duration(e.Max))
+	}
+}
+
+func (e *QueryLimitError) Unwrap() error {
+	return ErrQueryLimit
+}
+
+// queryLimit tracks a query against its QueryOpts and the MaxResultMemory of the
+// database. Its methods do nothing on nil, the limit of unbounded queries.
+type queryLimit struct {
+	opts       QueryOpts
+	deadline   time.Time
+	maxResult  int64 // Options.MaxResultMemory
+	recordSize int64
+	rows       int64 // Records matched so far
+	bytes      int64 // Bytes of records read so far
+}
+
+// newQueryLimit returns the limit of a query of db starting at start, nil when
+// neither opts nor the database bound it
+func (db *DB) newQueryLimit(opts *QueryOpts, start time.Time) *queryLimit {
+	if !opts.limited() && db.options.MaxResultMemory <= 0 {
+		return nil
+	}
+	l := &queryLimit{maxResult: db.options.MaxResultMemory, recordSize: int64(RecordSize(db.schema))}
+	if opts != nil {
+		l.opts, l.deadline = *opts, start.Add(opts.MaxDuration)
+	}
+	return l
+}
+
+// match counts a record the query returns
+func (l *queryLimit) match() {
+	if l != nil {
+		l.rows++
+	}
+}
+
+// check counts bytes the query read and returns a QueryLimitError once it went
+// past one of its bounds. The scans call it after each chunk, so they stop within
+// a chunk of the limit.
+func (l *queryLimit) check(bytes int64) error {
+	if l == nil {
+		return nil
+	}
+	l.bytes += bytes
+	switch {
+	case l.maxResult > 0 && l.rows*l.recordSize > l.maxResult:
+		return &QueryLimitError{Limit: "MaxResultMemory", Max: l.maxResult}
+	case l.opts.MaxRows > 0 && l.rows > l.opts.MaxRows:
+		return &QueryLimitError{Limit: "MaxRows", Max: l.opts.MaxRows}
+	case l.opts.MaxBytes > 0 && l.bytes > l.opts.MaxBytes:
+		return &QueryLimitError{Limit: "MaxBytes", Max: l.opts.MaxBytes}
+	case l.opts.MaxDuration > 0 && time.Now().After(l.deadline):
+		return &QueryLimitError{Limit: "MaxDuration", Max: int64(l.opts.MaxDuration)}
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+/*
+Package lineproto ingests InfluxDB line protocol into HOCDB.
+
+Each measurement (optionally combined with selected tag values) becomes a HOCDB
+ticker and each field becomes a column of that ticker's schema. The package can
+parse line protocol directly or serve the Influx /write HTTP endpoint, which lets
+Telegraf and existing Influx client libraries write into HOCDB unchanged.
+
+Example usage:
+
+	w := lineproto.NewWriter("./metrics", hocdb.Options{}, lineproto.Mapping{
+	    TickerTags: []string{"host"},
+	})
+	defer w.Close()
+
+	http.Handle("/write", lineproto.Handler(w))
+*/
+package lineproto
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FieldKind identifies the line protocol type of a field value
+type FieldKind int
+
+const (
+	Float FieldKind = iota
+	Integer
+	Unsigned
+	String
+	Boolean
+)
+
+// Value is a single field value of a point
+type Value struct {
+	Kind FieldKind
+	F    float64
+	I    int64
+	U    uint64
+	S    string
+	B    bool
+}
+
+// Tag is a key/value pair from the tag set of a point
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// Point is one parsed line of line protocol
+type Point struct {
+	Measurement  string
+	Tags         []Tag
+	Fields       map[string]Value
+	Timestamp    int64 // In the precision the line was written with
+	HasTimestamp bool
+}
+
+// Tag returns the value of the named tag
+func (p *Point) Tag(key string) (string, bool) {
+	for _, tag := range p.Tags {
+		if tag.Key == key {
+			return tag.Value, true
+		}
+	}
+	return "", false
+}
+
+// ParseLine parses a single line of line protocol. The line must not contain the
+// trailing newline.
+func ParseLine(line string) (Point, error) {
+	var p Point
+	s := &scanner{line: line}
+
+	measurement, delim := s.until(", ")
+	if measurement == "" {
+		return p, errors.New("missing measurement")
+	}
+	p.Measurement = measurement
+
+	for delim == ',' {
+		key, d := s.until("=")
+		if d != '=' || key == "" {
+			return p, errors.New("invalid tag set")
+		}
+		value, d := s.until(", ")
+		if value == "" {
+			return p, fmt.Errorf("missing value for tag %s", key)
+		}
+		p.Tags = append(p.Tags, Tag{Key: key, Value: value})
+		delim = d
+	}
+	if delim != ' ' {
+		return p, errors.New("missing field set")
+	}
+
+	p.Fields = make(map[string]Value)
+	for {
+		key, d := s.until("=")
+		if d != '=' || key == "" {
+			return p, errors.New("invalid field set")
+		}
+		value, d, err := s.fieldValue()
+		if err != nil {
+			return p, fmt.Errorf("field %s: %w", key, err)
+		}
+		p.Fields[key] = value
+		if d != ',' {
+			delim = d
+			break
+		}
+	}
+
+	if delim == ' ' {
+		text := strings.TrimSpace(s.rest())
+		if text != "" {
+			ts, err := strconv.ParseInt(text, 10, 64)
+			if err != nil {
+				return p, fmt.Errorf("invalid timestamp: %s", text)
+			}
+			p.Timestamp = ts
+			p.HasTimestamp = true
+		}
+	}
+
+	return p, nil
+}
+
+// scanner walks a line of line protocol, handling backslash escapes
+type scanner struct {
+	line string
+	pos  int
+}
+
+// until returns the unescaped text up to the first unescaped byte from delims and
+// the delimiter found (0 at end of line). Consecutive spaces after a space delimiter
+// are skipped.
+func (s *scanner) until(delims string) (string, byte) {
+	var b strings.Builder
+	for s.pos < len(s.line) {
+		c := s.line[s.pos]
+		if c == '\\' && s.pos+1 < len(s.line) && isEscapable(s.line[s.pos+1]) {
+			b.WriteByte(s.line[s.pos+1])
+			s.pos += 2
+			continue
+		}
+		if strings.IndexByte(delims, c) >= 0 {
+			s.pos++
+			if c == ' ' {
+				for s.pos < len(s.line) && s.line[s.pos] == ' ' {
+					s.pos++
+				}
+			}
+			return b.String(), c
+		}
+		b.WriteByte(c)
+		s.pos++
+	}
+	return b.String(), 0
+}
+
+// fieldValue parses a typed field value and returns the delimiter that ends it
+func (s *scanner) fieldValue() (Value, byte, error) {
+	if s.pos < len(s.line) && s.line[s.pos] == '"' {
+		var b strings.Builder
+		s.pos++
+		for s.pos < len(s.line) {
+			c := s.line[s.pos]
+			if c == '\\' && s.pos+1 < len(s.line) && (s.line[s.pos+1] == '"' || s.line[s.pos+1] == '\\') {
+				b.WriteByte(s.line[s.pos+1])
+				s.pos += 2
+				continue
+			}
+			if c == '"' {
+				s.pos++
+				trailing, d := s.until(", ")
+				if trailing != "" {
+					return Value{}, d, errors.New("unexpected data after string")
+				}
+				return Value{Kind: String, S: b.String()}, d, nil
+			}
+			b.WriteByte(c)
+			s.pos++
+		}
+		return Value{}, 0, errors.New("unterminated string")
+	}
+
+	text, d := s.until(", ")
+	if text == "" {
+		return Value{}, d, errors.New("missing value")
+	}
+
+	switch last := text[len(text)-1]; {
+	case last == 'i':
+		v, err := strconv.ParseInt(text[:len(text)-1], 10, 64)
+		return Value{Kind: Integer, I: v}, d, err
+	case last == 'u':
+		v, err := strconv.ParseUint(text[:len(text)-1], 10, 64)
+		return Value{Kind: Unsigned, U: v}, d, err
+	}
+
+	switch text {
+	case "t", "T", "true", "True", "TRUE":
+		return Value{Kind: Boolean, B: true}, d, nil
+	case "f", "F", "false", "False", "FALSE":
+		return Value{Kind: Boolean, B: false}, d, nil
+	}
+
+	v, err := strconv.ParseFloat(text, 64)
+	return Value{Kind: Float, F: v}, d, err
+}
+
+func (s *scanner) rest() string {
+	return s.line[s.pos:]
+}
+
+func isEscapable(c byte) bool {
+	return c == ',' || c == ' ' || c == '=' || c == '\\'
+}
@@ -0,0 +1,428 @@
+package lineproto
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hocdb"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mapping controls how points are routed to tickers and how their fields become schemas
+type Mapping struct {
+	// TickerTags lists tags whose values are appended to the measurement name to
+	// form the ticker, e.g. "cpu,host=a" with TickerTags ["host"] goes to "cpu_a"
+	TickerTags []string
+	// Separator joins the measurement and tag values, defaults to "_"
+	Separator string
+	// Schemas pins the schema of a measurement. Measurements without an entry get a
+	// schema inferred from their first point: timestamp followed by its fields sorted
+	// by name, so that first point must carry every field the measurement will use.
+	// Fields a point leaves out are null when nullable in the schema, zero otherwise.
+	Schemas map[string][]hocdb.Field
+	// TimestampUnit is the unit timestamps are stored in, defaults to time.Nanosecond
+	TimestampUnit time.Duration
+}
+
+// Writer appends points to per-ticker databases under a common directory. It is
+// safe for concurrent use.
+type Writer struct {
+	mu      sync.Mutex
+	path    string
+	options hocdb.Options
+	mapping Mapping
+	tickers map[string]*tickerDB
+}
+
+type tickerDB struct {
+	db     *hocdb.DB
+	schema []hocdb.Field
+	values []interface{}
+	index  map[string]int
+}
+
+// NewWriter creates a Writer storing tickers under path with the given options
+func NewWriter(path string, options hocdb.Options, mapping Mapping) *Writer {
+	if mapping.Separator == "" {
+		mapping.Separator = "_"
+	}
+	if mapping.TimestampUnit <= 0 {
+		mapping.TimestampUnit = time.Nanosecond
+	}
+	return &Writer{
+		path:    path,
+		options: options,
+		mapping: mapping,
+		tickers: make(map[string]*tickerDB),
+	}
+}
+
+// WritePoint stores a point whose timestamp is expressed in precision. Points
+// without a timestamp are stamped with the current time.
+func (w *Writer) WritePoint(p Point, precision time.Duration) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.writePoint(p, precision)
+}
+
+// WriteLines parses line protocol from r and stores every point. Lines that fail to
+// parse or append are reported in the result; the returned error is only set when
+// reading r fails.
+func (w *Writer) WriteLines(r io.Reader, precision time.Duration) (*hocdb.ImportResult, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	result := &hocdb.ImportResult{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		p, err := ParseLine(text)
+		if err == nil {
+			err = w.writePoint(p, precision)
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, &hocdb.LineError{Line: line, Err: err})
+			continue
+		}
+		result.Imported++
+	}
+
+	return result, scanner.Err()
+}
+
+// Flush flushes every open ticker
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, t := range w.tickers {
+		if err := t.db.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every open ticker
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for name, t := range w.tickers {
+		t.db.Close()
+		delete(w.tickers, name)
+	}
+	return nil
+}
+
+func (w *Writer) writePoint(p Point, precision time.Duration) error {
+	t, err := w.ticker(p)
+	if err != nil {
+		return err
+	}
+
+	for i, field := range t.schema {
+		if field.Nullable {
+			t.values[i] = nil
+			continue
+		}
+		t.values[i] = zeroValue(field.Type)
+	}
+
+	ts := time.Now().UnixNano() / int64(w.mapping.TimestampUnit)
+	if p.HasTimestamp {
+		if precision <= 0 {
+			precision = time.Nanosecond
+		}
+		ts = convertTimestamp(p.Timestamp, precision, w.mapping.TimestampUnit)
+	}
+	t.values[t.index["timestamp"]] = ts
+
+	for key, value := range p.Fields {
+		i, ok := t.index[key]
+		if !ok || key == "timestamp" {
+			return fmt.Errorf("field %s is not part of the schema for %s", key, p.Measurement)
+		}
+		v, err := convertValue(value, t.schema[i].Type)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", key, err)
+		}
+		t.values[i] = v
+	}
+
+	record, err := hocdb.CreateRecordBytes(t.schema, t.values...)
+	if err != nil {
+		return err
+	}
+	return t.db.Append(record)
+}
+
+// ticker returns the open database for a point, creating it on first use
+func (w *Writer) ticker(p Point) (*tickerDB, error) {
+	name := w.tickerName(p)
+	if t, ok := w.tickers[name]; ok {
+		return t, nil
+	}
+
+	schema, ok := w.mapping.Schemas[p.Measurement]
+	if !ok {
+		schema = inferSchema(p)
+	}
+
+	db, err := hocdb.New(name, w.path, schema, w.options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ticker %s: %w", name, err)
+	}
+
+	t := &tickerDB{
+		db:     db,
+		schema: schema,
+		values: make([]interface{}, len(schema)),
+		index:  make(map[string]int, len(schema)),
+	}
+	for i, field := range schema {
+		t.index[field.Name] = i
+	}
+	if _, ok := t.index["timestamp"]; !ok {
+		db.Close()
+		return nil, fmt.Errorf("schema for %s has no timestamp field", p.Measurement)
+	}
+
+	w.tickers[name] = t
+	return t, nil
+}
+
+// tickerName builds the ticker for a point from its measurement and ticker tags
+func (w *Writer) tickerName(p Point) string {
+	parts := []string{p.Measurement}
+	for _, key := range w.mapping.TickerTags {
+		if value, ok := p.Tag(key); ok {
+			parts = append(parts, value)
+		}
+	}
+	name := strings.Join(parts, w.mapping.Separator)
+	// Tickers become file names
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+}
+
+// inferSchema derives a schema from the fields of a point
+func inferSchema(p Point) []hocdb.Field {
+	names := make([]string, 0, len(p.Fields))
+	for name := range p.Fields {
+		if name != "timestamp" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	schema := []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}}
+	for _, name := range names {
+		var typ hocdb.FieldType
+		switch p.Fields[name].Kind {
+		case Integer:
+			typ = hocdb.TypeI64
+		case Unsigned:
+			typ = hocdb.TypeU64
+		case String:
+			typ = hocdb.TypeString
+		case Boolean:
+			typ = hocdb.TypeBool
+		default:
+			typ = hocdb.TypeF64
+		}
+		schema = append(schema, hocdb.Field{Name: name, Type: typ})
+	}
+	return schema
+}
+
+// convertValue converts a field value into the Go value expected for a field type
+func convertValue(v Value, t hocdb.FieldType) (interface{}, error) {
+	if t.IsString() {
+		t = hocdb.TypeString
+	}
+	if t.IsDecimal() {
+		// The record encoder checks that the value fits the scale
+		switch v.Kind {
+		case Float:
+			return v.F, nil
+		case Integer:
+			return v.I, nil
+		case Unsigned:
+			return v.U, nil
+		}
+		return nil, errors.New("value type doesn't match the schema")
+	}
+	switch t {
+	case hocdb.TypeF64:
+		switch v.Kind {
+		case Float:
+			return v.F, nil
+		case Integer:
+			return float64(v.I), nil
+		case Unsigned:
+			return float64(v.U), nil
+		}
+	case hocdb.TypeI64:
+		switch v.Kind {
+		case Integer:
+			return v.I, nil
+		case Unsigned:
+			if v.U <= 1<<63-1 {
+				return int64(v.U), nil
+			}
+		}
+	case hocdb.TypeU64:
+		switch v.Kind {
+		case Unsigned:
+			return v.U, nil
+		case Integer:
+			if v.I >= 0 {
+				return uint64(v.I), nil
+			}
+		}
+	case hocdb.TypeString:
+		if v.Kind == String {
+			return v.S, nil
+		}
+	case hocdb.TypeBool:
+		if v.Kind == Boolean {
+			return v.B, nil
+		}
+	case hocdb.TypeI32, hocdb.TypeU32, hocdb.TypeI16, hocdb.TypeU8:
+		// The record encoder checks the range
+		switch v.Kind {
+		case Integer:
+			return v.I, nil
+		case Unsigned:
+			return v.U, nil
+		}
+	case hocdb.TypeF32:
+		switch v.Kind {
+		case Float:
+			return v.F, nil
+		case Integer:
+			return float64(v.I), nil
+		case Unsigned:
+			return float64(v.U), nil
+		}
+	}
+	return nil, errors.New("value type doesn't match the schema")
+}
+
+func zeroValue(t hocdb.FieldType) interface{} {
+	if t.IsString() {
+		return ""
+	}
+	if t.IsBytes() {
+		return []byte{}
+	}
+	if t.IsDecimal() {
+		return int64(0)
+	}
+	switch t {
+	case hocdb.TypeI64, hocdb.TypeI32, hocdb.TypeU32, hocdb.TypeI16, hocdb.TypeU8:
+		return int64(0)
+	case hocdb.TypeU64:
+		return uint64(0)
+	case hocdb.TypeString:
+		return ""
+	case hocdb.TypeBool:
+		return false
+	default:
+		return float64(0)
+	}
+}
+
+// convertTimestamp rescales a timestamp from one unit to another
+func convertTimestamp(ts int64, from, to time.Duration) int64 {
+	if from == to {
+		return ts
+	}
+	if from > to {
+		return ts * int64(from/to)
+	}
+	return ts / int64(to/from)
+}
+
+// Handler returns an http.Handler implementing the InfluxDB 1.x /write and 2.x
+// /api/v2/write endpoints on top of w. The precision query parameter and gzip
+// request bodies are supported; database, bucket and org parameters are ignored.
+func Handler(w *Writer) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			rw.Header().Set("Allow", http.MethodPost)
+			writeError(rw, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		precision, err := parsePrecision(req.URL.Query().Get("precision"))
+		if err != nil {
+			writeError(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		body := io.Reader(req.Body)
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(req.Body)
+			if err != nil {
+				writeError(rw, http.StatusBadRequest, err.Error())
+				return
+			}
+			defer gz.Close()
+			body = gz
+		}
+
+		result, err := w.WriteLines(body, precision)
+		if err != nil {
+			writeError(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := w.Flush(); err != nil {
+			writeError(rw, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if len(result.Errors) > 0 {
+			writeError(rw, http.StatusBadRequest, "partial write: "+result.Errors[0].Error())
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// parsePrecision understands both the 1.x (n, u, ms, s, m, h) and 2.x (ns, us, ms, s) spellings
+func parsePrecision(p string) (time.Duration, error) {
+	switch p {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	default:
+		return 0, fmt.Errorf("invalid precision: %s", p)
+	}
+}
+
+func writeError(rw http.ResponseWriter, status int, message string) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,14 @@
+//go:build !hocdb_purego && !hocdb_static
+
+package hocdb
+
+// Links the shared library that zig build c-bindings builds. The rpath lets
+// binaries built in the repository find it at runtime; on Windows, hocdb_c.dll
+// from zig-out/bin must be on the PATH or next to the executable.
+
+/*
+#cgo LDFLAGS: -L${SRCDIR}/../../zig-out/lib -lhocdb_c
+#cgo linux freebsd LDFLAGS: -Wl,-rpath,${SRCDIR}/../../zig-out/lib
+#cgo darwin LDFLAGS: -Wl,-rpath,${SRCDIR}/../../zig-out/lib
+*/
+import "C"
@@ -0,0 +1,10 @@
+//go:build hocdb_static && !hocdb_purego
+
+package hocdb
+
+// Links the static library that zig build go-static builds into lib/
+
+/*
+#cgo LDFLAGS: ${SRCDIR}/lib/linux_amd64/libhocdb_c.a
+*/
+import "C"
@@ -0,0 +1,9 @@
+//go:build hocdb_static && !hocdb_purego && !((linux || darwin) && (amd64 || arm64))
+
+package hocdb
+
+// zig build go-static builds archives for Linux and macOS on amd64 and arm64
+// only. Elsewhere the build stops on the name below rather than with a linker
+// error about a missing lib/<GOOS>_<GOARCH>/libhocdb_c.a.
+
+var _ = hocdb_static_needs_linux_or_darwin_on_amd64_or_arm64
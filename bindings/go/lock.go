@@ -0,0 +1,38 @@
+package hocdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// lockFileExt is the extension of the file a writable handle keeps locked while
+// the database is open. It is hidden like other files that aren't part of the
+// database.
+const lockFileExt = ".lock"
+
+// ErrLocked is returned by New when another handle, in this process or another
+// one, has the database open for writing. OpenReadOnly doesn't take the lock, so
+// readers can open a database while it is being written. The lock needs Unix or
+// Windows; on other systems New never returns ErrLocked.
+var ErrLocked = errors.New("database is open for writing elsewhere")
+
+// lockDatabase creates the lock file of a ticker and locks it without waiting
+func lockDatabase(path, ticker string) (*os.File, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(path, "."+ticker+lockFileExt), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		if errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("%w: %s in %s", ErrLocked, ticker, path)
+		}
+		return nil, fmt.Errorf("failed to lock database: %w", err)
+	}
+	return f, nil
+}
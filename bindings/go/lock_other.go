@@ -0,0 +1,12 @@
+//go:build !unix && !windows
+
+package hocdb
+
+import "os"
+
+// lockFile is a no-op where neither flock nor LockFileEx is available: New never
+// returns ErrLocked there, and only the engine's own lock on the data file, where
+// the system has one, keeps two processes from writing a database
+func lockFile(f *os.File) error {
+	return nil
+}
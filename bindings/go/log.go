@@ -0,0 +1,105 @@
+package hocdb
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// logOpenFailure logs why a database couldn't be opened. info describes the data
+// file before the engine opened it, nil when there was none.
+func logOpenFailure(logger *slog.Logger, file string, info os.FileInfo, schema []Field, err error) {
+	if logger == nil {
+		return
+	}
+	attrs := []interface{}{"file", file, "error", err}
+	if reason := diagnoseDataFile(file, info, schema); reason != "" {
+		attrs = append(attrs, "reason", reason)
+	}
+	logger.Error("failed to open database", attrs...)
+}
+
+// logOpen logs an opened database. info describes the data file before the engine
+// opened it, nil when there was none.
+func (db *DB) logOpen(file string, info os.FileInfo) {
+	if db.logger == nil {
+		return
+	}
+	if info == nil || info.Size() <= fileHeaderSize {
+		db.logger.Info("created database", "file", file)
+		return
+	}
+	// The engine recovered the write position and last timestamp from the file
+	records := (info.Size() - fileHeaderSize) / int64(RecordSize(db.schema))
+	db.logger.Info("recovered database", "file", file, "records", records,
+		"wrapped", db.options.OverwriteFull && info.Size() >= db.maxFileSize())
+}
+
+// diagnoseDataFile explains why the engine may have refused a data file, as far as
+// the file itself tells
+func diagnoseDataFile(file string, info os.FileInfo, schema []Field) string {
+	if info == nil || info.Size() == 0 {
+		return ""
+	}
+	if info.Size() < fileHeaderSize {
+		return "data file is shorter than its header"
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	var magic [4]byte
+	if _, err := f.ReadAt(magic[:], 0); err == nil && string(magic[:]) != "HOC1" {
+		return "data file has no HOCDB header"
+	}
+	if size := int64(RecordSize(schema)); size > 0 && (info.Size()-fileHeaderSize)%size != 0 {
+		return "data file ends with a partial record, or was written with another schema"
+	}
+	return ""
+}
+
+// statDataFile returns the data file of a ticker and its state before opening
+func statDataFile(ticker, path string) (string, os.FileInfo) {
+	file := filepath.Join(path, ticker+".bin")
+	info, err := os.Stat(file)
+	if err != nil {
+		return file, nil
+	}
+	return file, info
+}
+
+// logRotate logs a wrap of the ring buffer
+func (db *DB) logRotate() {
+	if db.logger != nil {
+		db.logger.Info("data file rotated, overwriting the oldest records", "max_file_size", db.maxFileSize())
+	}
+}
+
+// logRepair logs a data file truncated by Repair
+func (db *DB) logRepair(report *VerifyReport) {
+	if db.logger != nil {
+		db.logger.Warn("repaired data file", "file", db.dataFile(), "problems", report.Problems,
+			"size", report.ValidSize, "dropped_records", report.Dropped)
+	}
+}
+
+// logError logs a failed operation whose error may not reach a caller directly
+func (db *DB) logError(msg string, err error) {
+	if db.logger != nil {
+		db.logger.Error(msg, "error", err)
+	}
+}
+
+// logSlowQuery logs a query that took longer than the slow query threshold
+func (db *DB) logSlowQuery(q SlowQuery) {
+	if db.logger == nil {
+		return
+	}
+	args := []interface{}{"op", q.Op, "start", q.Start, "end", q.End,
+		"filters", q.Filters, "rows_scanned", q.RowsScanned, "rows_returned", q.RowsReturned, "duration", q.Duration}
+	if q.BlocksScanned+q.BlocksPruned > 0 {
+		args = append(args, "blocks_scanned", q.BlocksScanned, "blocks_pruned", q.BlocksPruned)
+	}
+	db.logger.Warn("slow query", args...)
+}
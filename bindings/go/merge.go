@@ -0,0 +1,85 @@
+package hocdb
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Merge adds the records of src to dst in timestamp order and returns how many it
+// added, such as to consolidate per-day capture directories into one history. Both
+// databases must have the same schema and TimestampPrecision, and src is left
+// unchanged.
+//
+// The engine keeps one record per timestamp, so a record of src with the timestamp
+// of a record of dst is a duplicate and skipped, keeping the one of dst. When every
+// record of src is newer than the last of dst, they are appended like Append;
+// otherwise the data file of dst is rewritten with the records interleaved, which
+// runs neither OnAppend callbacks nor subscriptions.
+func Merge(dst, src *DB) (int, error) {
+	if dst == src {
+		return 0, errors.New("can't merge a database into itself")
+	}
+	if dst.options.AutoIncrement != nil {
+		return 0, errors.New("can't merge into a database with AutoIncrement, which would renumber the records")
+	}
+	if dst.TimestampPrecision() != src.TimestampPrecision() {
+		return 0, errors.New("databases have different timestamp precisions")
+	}
+	schema, fieldMap := dst.layout()
+	if diffs := schemaDiff(schema, src.Schema()); len(diffs) > 0 {
+		return 0, &SchemaMismatchError{Ticker: dst.ticker, Stored: dst.Schema(), Given: src.Schema(), Diffs: diffs}
+	}
+
+	data, err := src.Load()
+	if err != nil || len(data) == 0 {
+		return 0, err
+	}
+	size := RecordSize(schema)
+	offset, _ := timestampOffset(schema)
+	timestamp := func(data []byte, off int) int64 {
+		return int64(binary.LittleEndian.Uint64(data[off+offset:]))
+	}
+
+	if latest, err := dst.GetLatest(fieldMap["timestamp"]); err == nil && timestamp(data, 0) > latest.Timestamp {
+		for off := 0; off < len(data); off += size {
+			if err := dst.Append(data[off : off+size]); err != nil {
+				return off / size, err
+			}
+		}
+		return len(data) / size, nil
+	}
+
+	var added int
+	_, err = dst.replaceData(schema, schema, "merge", func(tmp *DB) (int, error) {
+		old, free, err := dst.loadRaw()
+		if err != nil {
+			return 0, err
+		}
+		defer free()
+
+		i, j := 0, 0
+		for i < len(old) || j < len(data) {
+			var rec []byte
+			if j >= len(data) || (i < len(old) && timestamp(old, i) <= timestamp(data, j)) {
+				if j < len(data) && timestamp(old, i) == timestamp(data, j) {
+					j += size // Duplicate
+				}
+				rec, i = old[i:i+size], i+size
+			} else {
+				rec, j = data[j:j+size], j+size
+				added++
+			}
+			if err := tmp.append(rec); err != nil {
+				return 0, err
+			}
+		}
+		return len(old)/size + added, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if dst.logger != nil {
+		dst.logger.Info("merged database", "source", src.ticker, "records", added)
+	}
+	return added, nil
+}
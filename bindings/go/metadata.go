@@ -0,0 +1,275 @@
+package hocdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// metaFileExt is the extension of the metadata file New writes next to a data file
+const metaFileExt = ".schema.json"
+
+// metadataVersion is the newest version of the metadata format. Version 2 added
+// renamed fields and version 3 nullable ones; metadata without them is still
+// written as the version before, so older versions of this library keep reading it.
+const metadataVersion = 3
+
+// metadata describes a data file, so it can be opened without restating its schema.
+// The engine's header only holds a hash of the schema.
+type metadata struct {
+	Version       int         `json:"version"`
+	Fields        []metaField `json:"fields"`
+	MaxFileSize   int64       `json:"max_file_size,omitempty"`
+	OverwriteFull bool        `json:"overwrite_full,omitempty"`
+	AutoIncrement bool        `json:"auto_increment,omitempty"`
+	AutoStart     int64       `json:"auto_increment_start,omitempty"`
+	AutoStep      int64       `json:"auto_increment_step,omitempty"`
+	SchemaVersion int         `json:"schema_version,omitempty"` // See Migrate
+	Precision     string      `json:"timestamp_precision,omitempty"`
+}
+
+type metaField struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Column   string `json:"column,omitempty"` // Name in the data file, when renamed since
+	Nullable bool   `json:"nullable,omitempty"`
+}
+
+// ErrSchemaMismatch is matched by the errors of opening a database with a schema
+// other than the one it was created with, see SchemaMismatchError
+var ErrSchemaMismatch = errors.New("schema mismatch")
+
+// SchemaMismatchError reports how a schema given to open a database differs from
+// the one recorded for its data file
+type SchemaMismatchError struct {
+	Ticker string
+	Stored []Field  // Schema the data file was written with
+	Given  []Field  // Schema the database was opened with
+	Diffs  []string // One line per differing field
+}
+
+func (e *SchemaMismatchError) Error() string {
+	return fmt.Sprintf("schema mismatch for %s: %s", e.Ticker, strings.Join(e.Diffs, "; "))
+}
+
+func (e *SchemaMismatchError) Unwrap() error {
+	return ErrSchemaMismatch
+}
+
+// schemaDiff lists the differences between a stored and a given schema, field by field
+func schemaDiff(stored, given []Field) []string {
+	var diffs []string
+	for i := 0; i < len(stored) || i < len(given); i++ {
+		switch {
+		case i >= len(given):
+			diffs = append(diffs, fmt.Sprintf("field %d %s:%s is missing", i, stored[i].Name, stored[i].Type))
+		case i >= len(stored):
+			diffs = append(diffs, fmt.Sprintf("field %d %s:%s is not in the stored schema", i, given[i].Name, given[i].Type))
+		case stored[i].Name != given[i].Name:
+			diffs = append(diffs, fmt.Sprintf("field %d is %s:%s, not %s:%s", i, stored[i].Name, stored[i].Type, given[i].Name, given[i].Type))
+		case stored[i].Type != given[i].Type:
+			diffs = append(diffs, fmt.Sprintf("field %d %s is %s, not %s", i, stored[i].Name, stored[i].Type, given[i].Type))
+		case stored[i].Nullable != given[i].Nullable:
+			diffs = append(diffs, fmt.Sprintf("field %d %s is %s", i, stored[i].Name, nullability(stored[i].Nullable)))
+		}
+	}
+	return diffs
+}
+
+func nullability(nullable bool) string {
+	if nullable {
+		return "nullable"
+	}
+	return "not nullable"
+}
+
+// checkSchema compares a schema with the one recorded for an existing data file,
+// when there is a record of it, and returns the record; nil when there is none
+func checkSchema(ticker, path string, schema []Field) (*metadata, error) {
+	meta, err := readMetadata(filepath.Join(path, ticker+metaFileExt))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	stored, err := meta.schema()
+	if err != nil {
+		return nil, err
+	}
+	if diffs := schemaDiff(stored, schema); len(diffs) > 0 {
+		return nil, &SchemaMismatchError{Ticker: ticker, Stored: stored, Given: append([]Field(nil), schema...), Diffs: diffs}
+	}
+	return meta, nil
+}
+
+// checkPrecisionMatch returns the TimestampPrecision to open a database with: the
+// recorded one when none is given, and an error when another one is
+func checkPrecisionMatch(ticker string, meta *metadata, precision time.Duration) (time.Duration, error) {
+	if meta == nil || meta.Precision == "" {
+		return precision, nil
+	}
+	recorded, err := parsePrecision(meta.Precision)
+	if err != nil {
+		return 0, err
+	}
+	if precision != 0 && precision != recorded {
+		return 0, fmt.Errorf("timestamp precision mismatch for %s: stored %v, given %v", ticker, recorded, precision)
+	}
+	return recorded, nil
+}
+
+// withColumns returns the schema under the names its fields have in the data file,
+// which the engine checks the file against
+func withColumns(schema []Field, columns []string) []Field {
+	if columns == nil {
+		return schema
+	}
+	renamed := append([]Field(nil), schema...)
+	for i := range renamed {
+		renamed[i].Name = columns[i]
+	}
+	return renamed
+}
+
+// OpenExisting opens the existing database of a ticker with the schema, the file
+// layout options and the TimestampPrecision it was created with, which New records
+// next to the data file. It returns the database together with its schema.
+func OpenExisting(ticker, path string) (*DB, []Field, error) {
+	return openExisting(ticker, path, Options{})
+}
+
+// openExisting is OpenExisting with options for what the metadata doesn't record
+func openExisting(ticker, path string, options Options) (*DB, []Field, error) {
+	meta, err := readMetadata(filepath.Join(path, ticker+metaFileExt))
+	if err != nil {
+		return nil, nil, err
+	}
+	schema, err := meta.schema()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options.MaxFileSize = meta.MaxFileSize
+	options.OverwriteFull = meta.OverwriteFull
+	options.AutoIncrement = nil
+	options.TimestampPrecision = 0 // The recorded one
+	if meta.AutoIncrement {
+		options.AutoIncrement = &AutoIncrement{Start: meta.AutoStart, Step: meta.AutoStep}
+	}
+	db, err := New(ticker, path, schema, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, db.Schema(), nil
+}
+
+// metaFile returns the path of the metadata file of this database
+func (db *DB) metaFile() string {
+	return filepath.Join(db.path, db.ticker+metaFileExt)
+}
+
+// writeMetadata records the schema and options of the database next to its data
+// file, unless the file already says the same
+func (db *DB) writeMetadata() error {
+	meta := metadata{
+		Version:       1,
+		MaxFileSize:   db.options.MaxFileSize,
+		OverwriteFull: db.options.OverwriteFull,
+		SchemaVersion: db.schemaVersion,
+		Precision:     precisionNames[db.options.TimestampPrecision],
+	}
+	if a := db.options.AutoIncrement; a != nil {
+		meta.AutoIncrement = true
+		meta.AutoStart, meta.AutoStep = a.Start, a.Step
+	}
+	for i, field := range db.schema {
+		mf := metaField{Name: field.Name, Type: field.Type.String()}
+		if db.columns != nil && db.columns[i] != field.Name {
+			mf.Column = db.columns[i]
+			meta.Version = max(meta.Version, 2)
+		}
+		if field.Nullable {
+			mf.Nullable = true
+			meta.Version = 3
+		}
+		meta.Fields = append(meta.Fields, mf)
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if old, err := os.ReadFile(db.metaFile()); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+	if err := copyFileAtomic(db.metaFile(), bytes.NewReader(data), int64(len(data))); err != nil {
+		return err
+	}
+	// Appends after a schema change go to a new log file
+	return db.wal.reset(data)
+}
+
+// readMetadata reads a metadata file
+func readMetadata(file string) (*metadata, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no schema metadata at %s, open the database with New once to record it: %w", file, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var meta metadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("invalid schema metadata at %s: %w", file, err)
+	}
+	if meta.Version > metadataVersion {
+		return nil, fmt.Errorf("schema metadata at %s has version %d, newer than this library supports", file, meta.Version)
+	}
+	return &meta, nil
+}
+
+// schema returns the schema the metadata describes
+func (m *metadata) schema() ([]Field, error) {
+	if len(m.Fields) == 0 {
+		return nil, errors.New("schema metadata has no fields")
+	}
+	schema := make([]Field, len(m.Fields))
+	for i, field := range m.Fields {
+		t, err := ParseFieldType(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		schema[i] = Field{Name: field.Name, Type: t, Nullable: field.Nullable}
+	}
+	return schema, nil
+}
+
+// columns returns the names of the fields in the data file, nil unless fields were
+// renamed
+func (m *metadata) columns() []string {
+	if m == nil {
+		return nil
+	}
+	var columns []string
+	for i, field := range m.Fields {
+		if field.Column == "" {
+			continue
+		}
+		if columns == nil {
+			columns = make([]string, len(m.Fields))
+			for j, f := range m.Fields {
+				columns[j] = f.Name
+			}
+		}
+		columns[i] = field.Column
+	}
+	return columns
+}
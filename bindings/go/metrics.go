@@ -0,0 +1,131 @@
+package hocdb
+
+import "time"
+
+// Metrics receives measurements of a database's operations, see Options.Metrics.
+// Package hocdb/metrics has an implementation exporting them to Prometheus and
+// expvar. Methods may be called while the database's lock is held: they must be
+// cheap, safe for concurrent use, and must not call back into the database.
+type Metrics interface {
+	// ObserveAppend reports appended records and their size in bytes
+	ObserveAppend(records, bytes int)
+	// ObserveFlush reports a flush of pending writes to the data file
+	ObserveFlush(d time.Duration, err error)
+	// ObserveQuery reports a Query, Load or GetStats call with the records it read
+	// and the records it returned. The engine doesn't report records skipped by
+	// filters, so DB queries report the records they returned as read; queries of a
+	// Pool report both. GetStats returns no records.
+	ObserveQuery(d time.Duration, scanned, returned int)
+}
+
+// PruningMetrics is implemented by Metrics that also receive the blocks and
+// segments queries read and skipped, see Options.ZoneMaps and
+// Compression.BloomFilters
+type PruningMetrics interface {
+	// ObservePruning reports the blocks and segments a query read and those its
+	// zones or bloom filters ruled out
+	ObservePruning(scanned, pruned int)
+}
+
+// defaultSlowQueryThreshold is the SlowQueryThreshold used when it isn't set
+const defaultSlowQueryThreshold = time.Second
+
+// SlowQuery describes a query that took at least Options.SlowQueryThreshold
+type SlowQuery struct {
+	Op            string        // "Query", "Load" or "GetStats"
+	Start, End    int64         // Queried range [Start, End)
+	Filters       interface{}   // Filters as passed to Query, nil without
+	RowsScanned   int           // Records read, see Metrics.ObserveQuery
+	RowsReturned  int           // Records returned, none for GetStats
+	BlocksScanned int           // Blocks with ZoneMaps and segments read
+	BlocksPruned  int           // Those skipped by zones or bloom filters
+	Duration      time.Duration // Including the wait for the database's lock
+}
+
+// QueryResult describes how a query ran, see QueryWithResult
+type QueryResult struct {
+	RowsScanned    int           // Records read, see Metrics.ObserveQuery
+	RowsReturned   int           // Records returned
+	BytesRead      int64         // Of the records read from the data file, and of the compressed segments read
+	BlocksScanned  int           // Blocks with ZoneMaps and segments read
+	BlocksPruned   int           // Those skipped by their time range, zones or bloom filters
+	SegmentsPruned int           // Segments among BlocksPruned
+	Duration       time.Duration // Including the wait for the database's lock
+}
+
+// queryInfo describes a finished Query, Load or GetStats call
+type queryInfo struct {
+	op             string
+	start          time.Time
+	startTs, endTs int64
+	filters        interface{}
+	scanned        int
+	returned       int
+	blocksScanned  int         // Blocks with ZoneMaps and segments read
+	blocksPruned   int         // Those skipped
+	segmentsPruned int         // Segments skipped, also counted in blocksPruned
+	bytesRead      int64       // Bytes of the data file and compressed segments read
+	limit          *queryLimit // Bounds of the query, see QueryOpts
+	ok             bool        // The query succeeded
+}
+
+// prune counts a segment the query skipped
+func (q *queryInfo) prune() {
+	q.blocksPruned++
+	q.segmentsPruned++
+}
+
+// result fills r with the measurements of the query unless r is nil
+func (q *queryInfo) result(r *QueryResult) {
+	if r == nil {
+		return
+	}
+	*r = QueryResult{
+		RowsScanned:    q.scanned,
+		RowsReturned:   q.returned,
+		BytesRead:      q.bytesRead,
+		BlocksScanned:  q.blocksScanned,
+		BlocksPruned:   q.blocksPruned,
+		SegmentsPruned: q.segmentsPruned,
+		Duration:       time.Since(q.start),
+	}
+}
+
+// observeQuery reports a successful query to the configured Metrics and reports it
+// as slow past the threshold. It runs the OnSlowQuery callbacks, so db.mu must not
+// be held.
+func (db *DB) observeQuery(q *queryInfo) {
+	if !q.ok {
+		return
+	}
+	d := time.Since(q.start)
+	if m := db.options.Metrics; m != nil {
+		m.ObserveQuery(d, q.scanned, q.returned)
+		if pm, ok := m.(PruningMetrics); ok && q.blocksScanned+q.blocksPruned > 0 {
+			pm.ObservePruning(q.blocksScanned, q.blocksPruned)
+		}
+	}
+
+	threshold := db.options.SlowQueryThreshold
+	if threshold == 0 {
+		threshold = defaultSlowQueryThreshold
+	}
+	if threshold < 0 || d < threshold {
+		return
+	}
+	slow := SlowQuery{
+		Op:            q.op,
+		Start:         q.startTs,
+		End:           q.endTs,
+		Filters:       q.filters,
+		RowsScanned:   q.scanned,
+		RowsReturned:  q.returned,
+		BlocksScanned: q.blocksScanned,
+		BlocksPruned:  q.blocksPruned,
+		Duration:      d,
+	}
+	db.logSlowQuery(slow)
+	for _, fn := range db.slowQueryHooks() {
+		fn(slow)
+	}
+}
@@ -0,0 +1,282 @@
+/*
+Package metrics collects the measurements of HOCDB databases and exports them to
+Prometheus and expvar.
+
+A Collector keeps counters and latency histograms per ticker. Each database gets
+its own view of the collector in its options:
+
+	c := metrics.NewCollector()
+	db, err := hocdb.New("BTC_USD", "./data", schema, hocdb.Options{
+	    Metrics: c.For("BTC_USD"),
+	})
+
+	http.Handle("/metrics", c)
+	expvar.Publish("hocdb", c.Expvar())
+*/
+package metrics
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"hocdb"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Buckets are the upper bounds of the latency histograms, in seconds. Don't modify
+// them.
+var Buckets = []float64{
+	0.00005, 0.0001, 0.00025, 0.0005,
+	0.001, 0.0025, 0.005, 0.01, 0.025, 0.05,
+	0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// Collector collects the measurements of any number of databases, by ticker
+type Collector struct {
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// NewCollector creates an empty collector
+func NewCollector() *Collector {
+	return &Collector{series: make(map[string]*series)}
+}
+
+// For returns the hocdb.Metrics of a ticker, to set as Options.Metrics. Databases
+// of the same ticker share its measurements.
+func (c *Collector) For(ticker string) hocdb.Metrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[ticker]
+	if !ok {
+		s = newSeries()
+		c.series[ticker] = s
+	}
+	return s
+}
+
+// Snapshot is the state of the measurements of one ticker
+type Snapshot struct {
+	Appends       uint64    `json:"appends"`
+	AppendBytes   uint64    `json:"append_bytes"`
+	AppendsPerSec uint64    `json:"appends_per_sec"` // Appends during the last whole second
+	Flushes       uint64    `json:"flushes"`
+	FlushErrors   uint64    `json:"flush_errors"`
+	FlushLatency  Histogram `json:"flush_latency"`
+	Queries       uint64    `json:"queries"`
+	RowsScanned   uint64    `json:"rows_scanned"`
+	RowsReturned  uint64    `json:"rows_returned"`
+	QueryLatency  Histogram `json:"query_latency"`
+	BlocksScanned uint64    `json:"blocks_scanned"` // See hocdb.Options.ZoneMaps
+	BlocksPruned  uint64    `json:"blocks_pruned"`
+}
+
+// Histogram is the state of a latency histogram. Counts holds the number of
+// observations up to each of Buckets, cumulatively.
+type Histogram struct {
+	Counts []uint64 `json:"counts"`
+	Count  uint64   `json:"count"`
+	Sum    float64  `json:"sum"` // Seconds
+}
+
+// Snapshot returns the measurements of every ticker
+func (c *Collector) Snapshot() map[string]Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := make(map[string]Snapshot, len(c.series))
+	for ticker, s := range c.series {
+		result[ticker] = s.snapshot()
+	}
+	return result
+}
+
+// Expvar returns an expvar.Var publishing Snapshot as JSON
+func (c *Collector) Expvar() expvar.Var {
+	return expvar.Func(func() interface{} {
+		return c.Snapshot()
+	})
+}
+
+// ServeHTTP serves the measurements in the Prometheus text format
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WritePrometheus(w)
+}
+
+// WritePrometheus writes the measurements in the Prometheus text format, with the
+// ticker as a label
+func (c *Collector) WritePrometheus(w io.Writer) error {
+	snapshots := c.Snapshot()
+	tickers := make([]string, 0, len(snapshots))
+	for ticker := range snapshots {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+
+	bw := bufio.NewWriter(w)
+	scalar := func(name, typ, help string, value func(Snapshot) uint64) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, ticker := range tickers {
+			fmt.Fprintf(bw, "%s{ticker=%s} %d\n", name, quoteLabel(ticker), value(snapshots[ticker]))
+		}
+	}
+	histogram := func(name, help string, value func(Snapshot) Histogram) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+		for _, ticker := range tickers {
+			h, label := value(snapshots[ticker]), quoteLabel(ticker)
+			for i, le := range Buckets {
+				fmt.Fprintf(bw, "%s_bucket{ticker=%s,le=\"%s\"} %d\n", name, label, strconv.FormatFloat(le, 'g', -1, 64), h.Counts[i])
+			}
+			fmt.Fprintf(bw, "%s_bucket{ticker=%s,le=\"+Inf\"} %d\n", name, label, h.Count)
+			fmt.Fprintf(bw, "%s_sum{ticker=%s} %s\n", name, label, strconv.FormatFloat(h.Sum, 'g', -1, 64))
+			fmt.Fprintf(bw, "%s_count{ticker=%s} %d\n", name, label, h.Count)
+		}
+	}
+
+	scalar("hocdb_appends_total", "counter", "Records appended.", func(s Snapshot) uint64 { return s.Appends })
+	scalar("hocdb_append_bytes_total", "counter", "Bytes of records appended.", func(s Snapshot) uint64 { return s.AppendBytes })
+	scalar("hocdb_appends_per_second", "gauge", "Records appended during the last whole second.", func(s Snapshot) uint64 { return s.AppendsPerSec })
+	scalar("hocdb_flushes_total", "counter", "Flushes of pending writes.", func(s Snapshot) uint64 { return s.Flushes })
+	scalar("hocdb_flush_errors_total", "counter", "Flushes that failed.", func(s Snapshot) uint64 { return s.FlushErrors })
+	histogram("hocdb_flush_duration_seconds", "Flush latency.", func(s Snapshot) Histogram { return s.FlushLatency })
+	scalar("hocdb_queries_total", "counter", "Queries, loads and stats.", func(s Snapshot) uint64 { return s.Queries })
+	scalar("hocdb_rows_scanned_total", "counter", "Records read by queries.", func(s Snapshot) uint64 { return s.RowsScanned })
+	scalar("hocdb_rows_returned_total", "counter", "Records returned by queries.", func(s Snapshot) uint64 { return s.RowsReturned })
+	histogram("hocdb_query_duration_seconds", "Query latency.", func(s Snapshot) Histogram { return s.QueryLatency })
+	scalar("hocdb_blocks_scanned_total", "counter", "Blocks and segments read by queries.", func(s Snapshot) uint64 { return s.BlocksScanned })
+	scalar("hocdb_blocks_pruned_total", "counter", "Blocks and segments skipped by queries.", func(s Snapshot) uint64 { return s.BlocksPruned })
+
+	return bw.Flush()
+}
+
+// quoteLabel quotes a label value, escaping as the text format requires
+func quoteLabel(v string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(v) + `"`
+}
+
+// series holds the measurements of one ticker
+type series struct {
+	appends     atomic.Uint64
+	appendBytes atomic.Uint64
+	flushes     atomic.Uint64
+	flushErrors atomic.Uint64
+	queries     atomic.Uint64
+	scanned     atomic.Uint64
+	returned    atomic.Uint64
+	blocks      atomic.Uint64
+	pruned      atomic.Uint64
+
+	flushLatency *histogram
+	queryLatency *histogram
+
+	// Appends counted per second for the rate
+	rateMu   sync.Mutex
+	rateSec  int64
+	rateCur  uint64
+	ratePrev uint64
+}
+
+func newSeries() *series {
+	return &series{flushLatency: newHistogram(), queryLatency: newHistogram()}
+}
+
+func (s *series) ObserveAppend(records, bytes int) {
+	s.appends.Add(uint64(records))
+	s.appendBytes.Add(uint64(bytes))
+
+	s.rateMu.Lock()
+	s.advance(time.Now().Unix())
+	s.rateCur += uint64(records)
+	s.rateMu.Unlock()
+}
+
+func (s *series) ObserveFlush(d time.Duration, err error) {
+	s.flushes.Add(1)
+	if err != nil {
+		s.flushErrors.Add(1)
+	}
+	s.flushLatency.observe(d)
+}
+
+func (s *series) ObserveQuery(d time.Duration, scanned, returned int) {
+	s.queries.Add(1)
+	s.scanned.Add(uint64(scanned))
+	s.returned.Add(uint64(returned))
+	s.queryLatency.observe(d)
+}
+
+func (s *series) ObservePruning(scanned, pruned int) {
+	s.blocks.Add(uint64(scanned))
+	s.pruned.Add(uint64(pruned))
+}
+
+// advance moves the rate window to the second now; rateMu must be held
+func (s *series) advance(now int64) {
+	switch now {
+	case s.rateSec:
+		return
+	case s.rateSec + 1:
+		s.ratePrev = s.rateCur
+	default:
+		s.ratePrev = 0
+	}
+	s.rateSec, s.rateCur = now, 0
+}
+
+func (s *series) snapshot() Snapshot {
+	s.rateMu.Lock()
+	s.advance(time.Now().Unix())
+	rate := s.ratePrev
+	s.rateMu.Unlock()
+
+	return Snapshot{
+		Appends:       s.appends.Load(),
+		AppendBytes:   s.appendBytes.Load(),
+		AppendsPerSec: rate,
+		Flushes:       s.flushes.Load(),
+		FlushErrors:   s.flushErrors.Load(),
+		FlushLatency:  s.flushLatency.snapshot(),
+		Queries:       s.queries.Load(),
+		RowsScanned:   s.scanned.Load(),
+		RowsReturned:  s.returned.Load(),
+		QueryLatency:  s.queryLatency.snapshot(),
+		BlocksScanned: s.blocks.Load(),
+		BlocksPruned:  s.pruned.Load(),
+	}
+}
+
+// histogram counts latencies into Buckets, the last count is for larger ones
+type histogram struct {
+	counts []atomic.Uint64
+	sum    atomic.Int64 // Nanoseconds
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]atomic.Uint64, len(Buckets)+1)}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := sort.SearchFloat64s(Buckets, d.Seconds())
+	h.counts[i].Add(1)
+	h.sum.Add(int64(d))
+}
+
+func (h *histogram) snapshot() Histogram {
+	result := Histogram{Counts: make([]uint64, len(Buckets))}
+	for i := range h.counts {
+		result.Count += h.counts[i].Load()
+		if i < len(Buckets) {
+			result.Counts[i] = result.Count
+		}
+	}
+	result.Sum = time.Duration(h.sum.Load()).Seconds()
+	return result
+}
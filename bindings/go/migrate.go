@@ -0,0 +1,427 @@
+package hocdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+// AddField adds a field to the end of the schema. Existing records get
+// defaultValue, which must suit the field's type like the values of
+// CreateRecordBytes; nil leaves a nullable field null.
+//
+// The engine's records have a fixed layout, so the data file is rewritten: the
+// records are copied into a new file next to it, which then replaces the old one,
+// and the recorded schema is updated. Records queued by AppendAsync are written
+// first. Subscriptions are closed, as their records no longer match the schema.
+// The rewritten records are larger; a database with MaxFileSize that can't hold
+// them fails unless it overwrites its oldest records with OverwriteFull, in which
+// case those are lost.
+//
+// Calls from other goroutines wait for the rewrite, and see the new schema once it
+// returns. Readers in other processes must reopen the database with the new schema.
+func (db *DB) AddField(field Field, defaultValue interface{}) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	old, fieldMap := db.layout()
+	if _, ok := fieldMap[field.Name]; ok {
+		return fmt.Errorf("field %s already exists", field.Name)
+	}
+	value, err := encodeRecord(nil, []Field{field}, db.TimestampPrecision(), []interface{}{defaultValue})
+	if err != nil {
+		return fmt.Errorf("invalid default value for field %s: %w", field.Name, err)
+	}
+
+	schema := append(old[:len(old):len(old)], field)
+	if err := checkNullable(schema); err != nil {
+		return err
+	}
+	end := RecordSize(old) - nullBitmapSize(old)
+	nulls := nullCopier(schema, old, func(i int) int {
+		if i == len(old) {
+			return -1
+		}
+		return i
+	})
+	nullOffset, nullMask := -1, byte(0)
+	if field.Nullable && defaultValue == nil {
+		nullOffset, nullMask = nullBit(schema, len(old))
+	}
+	return db.migrate(old, schema, func(dst, src []byte) {
+		copy(dst, src[:end])
+		copy(dst[end:], value[:field.Type.Size()])
+		nulls(dst, src)
+		if nullOffset >= 0 {
+			dst[nullOffset] |= nullMask
+		}
+	}, fmt.Sprintf("added field %s:%s", field.Name, field.Type))
+}
+
+// DropField removes a field from the schema. Like AddField, it rewrites the data
+// file; the timestamp can't be dropped.
+func (db *DB) DropField(name string) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	old, fieldMap := db.layout()
+	idx, ok := fieldMap[name]
+	if !ok {
+		return fmt.Errorf("unknown field: %s", name)
+	}
+	if name == "timestamp" {
+		return errors.New("the timestamp field can't be dropped")
+	}
+
+	schema := append(old[:idx:idx], old[idx+1:]...)
+	offset, size := 0, old[idx].Type.Size()
+	for _, field := range old[:idx] {
+		offset += field.Type.Size()
+	}
+	end := RecordSize(old) - nullBitmapSize(old)
+	nulls := nullCopier(schema, old, func(i int) int {
+		if i >= idx {
+			return i + 1
+		}
+		return i
+	})
+	return db.migrate(old, schema, func(dst, src []byte) {
+		copy(dst, src[:offset])
+		copy(dst[offset:], src[offset+size:end])
+		nulls(dst, src)
+	}, "dropped field "+name)
+}
+
+// RenameField renames a field. Records don't hold field names, so the data file is
+// left alone: the recorded schema maps the new name to the one in the data file
+// until the next rewrite by AddField or DropField. Subscriptions are closed, as
+// their records carry the old name. The timestamp can't be renamed.
+//
+// Like AddField, other processes must reopen the database with the new schema.
+func (db *DB) RenameField(oldName, newName string) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.handle == nil {
+		return errors.New("database not initialized")
+	}
+	idx, ok := db.fieldMap[oldName]
+	if !ok {
+		return fmt.Errorf("unknown field: %s", oldName)
+	}
+	if _, ok := db.fieldMap[newName]; ok {
+		return fmt.Errorf("field %s already exists", newName)
+	}
+	if oldName == "timestamp" || newName == "timestamp" {
+		return errors.New("the timestamp field can't be renamed")
+	}
+	if newName == "" {
+		return errors.New("field name is empty")
+	}
+
+	old, oldColumns := db.schema, db.columns
+	if db.columns == nil {
+		db.columns = make([]string, len(db.schema))
+		for i, field := range db.schema {
+			db.columns[i] = field.Name
+		}
+	}
+	schema := append([]Field(nil), db.schema...)
+	schema[idx].Name = newName
+	db.setSchema(schema)
+	if err := db.writeMetadata(); err != nil {
+		db.setSchema(old)
+		db.columns = oldColumns
+		return fmt.Errorf("schema change failed: %w", err)
+	}
+
+	db.closeSubscriptions()
+	if db.logger != nil {
+		db.logger.Info("schema changed", "change", "renamed field "+oldName+" to "+newName)
+	}
+	return nil
+}
+
+// Migration is a step of Migrate, bringing a database to a schema version
+type Migration struct {
+	Version     int    // Schema version after the migration, from 1 up
+	Description string // For errors
+	Apply       func(db *DB) error
+}
+
+// Migrate upgrades every database in path by applying, in version order, the
+// migrations with a version above the one the database has reached, and records
+// each version reached. Databases start at version 0. Migrations are applied to
+// databases opened with OpenExisting, so each data file needs its recorded schema,
+// and none may be open elsewhere.
+//
+// Running Migrate again with the same or more migrations continues where it
+// stopped. A failed migration is retried by the next run, so each should make a
+// single change, such as one AddField, or check what is left to do.
+func Migrate(path string, migrations ...Migration) error {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return fmt.Errorf("migration %q: version must be positive", m.Description)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return fmt.Errorf("migration version %d is used twice", m.Version)
+		}
+		if m.Apply == nil {
+			return fmt.Errorf("migration %d has no Apply function", m.Version)
+		}
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, metaFileExt) {
+			continue
+		}
+		ticker := strings.TrimSuffix(name, metaFileExt)
+		if err := migrateTicker(ticker, path, sorted); err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", ticker, err)
+		}
+	}
+	return nil
+}
+
+// migrateTicker applies the pending migrations to the database of a ticker
+func migrateTicker(ticker, path string, migrations []Migration) error {
+	db, _, err := OpenExisting(ticker, path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, m := range migrations {
+		if m.Version <= db.SchemaVersion() {
+			continue
+		}
+		if err := m.Apply(db); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+		}
+
+		db.mu.Lock()
+		prev := db.schemaVersion
+		db.schemaVersion = m.Version
+		err := db.writeMetadata()
+		if err != nil {
+			db.schemaVersion = prev
+		}
+		db.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+		}
+	}
+	return nil
+}
+
+// SchemaVersion returns the version of the last migration Migrate applied to the
+// database, 0 when there was none
+func (db *DB) SchemaVersion() int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.schemaVersion
+}
+
+// migrate rewrites the data file from schema old to a new schema, converting each
+// record with convert, which fills dst from the old record src
+func (db *DB) migrate(old, schema []Field, convert func(dst, src []byte), change string) error {
+	if _, ok := timestampOffset(schema); !ok {
+		return errors.New("schema has no i64 timestamp field")
+	}
+	records, err := db.replaceData(old, schema, "schema change", func(tmp *DB) (int, error) {
+		return db.rewrite(tmp, convert)
+	})
+	if err != nil {
+		return err
+	}
+	if db.logger != nil {
+		db.logger.Info("schema changed", "change", change, "records", records)
+	}
+	return nil
+}
+
+// replaceData replaces the data file, of schema old, with a new one of schema,
+// which fill writes through tmp with db.mu held, and returns the number of records
+// fill reports. It fails if another schema change replaced old first. Errors are
+// prefixed with what failed.
+func (db *DB) replaceData(old, schema []Field, what string, fill func(tmp *DB) (int, error)) (int, error) {
+	// Queued records have the old layout, write them before anything else
+	db.asyncMu.Lock()
+	defer db.asyncMu.Unlock()
+	if w := db.async; w != nil {
+		done := make(chan error, 1)
+		w.ch <- asyncItem{done: done}
+		if err := <-done; err != nil {
+			// Keep it for the next Flush to report
+			w.setErr(err)
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.handle == nil {
+		return 0, errors.New("database not initialized")
+	}
+	if !sameSchema(old, db.schema) {
+		return 0, fmt.Errorf("%s failed: the schema changed meanwhile", what)
+	}
+	if err := db.flush(); err != nil {
+		return 0, err
+	}
+	if len(db.segments) > 0 {
+		return 0, fmt.Errorf("%s failed: database has compressed segments", what)
+	}
+
+	tmpDir, err := os.MkdirTemp(db.dataDir(), "."+db.ticker+".migrate*")
+	if err != nil {
+		return 0, fmt.Errorf("%s failed: %w", what, err)
+	}
+	defer os.RemoveAll(tmpDir)
+	records, err := db.fillFile(tmpDir, schema, fill)
+	if err != nil {
+		return 0, fmt.Errorf("%s failed: %w", what, err)
+	}
+
+	// Swap the files while no handle has the data file open
+	engineClose(db.handle)
+	db.handle = nil
+	if db.syncFile != nil {
+		db.syncFile.Close()
+		db.syncFile = nil
+	}
+	db.closeSubscriptions()
+
+	oldColumns := db.columnFiles()
+	var indexed, oldIndexes []string
+	for _, idx := range db.indexes {
+		indexed = append(indexed, db.schema[idx.field].Name)
+		oldIndexes = append(oldIndexes, db.indexFile(idx.field))
+	}
+	err = os.Rename(filepath.Join(tmpDir, db.ticker+dataFileExt), db.dataFile())
+	if err == nil {
+		// The new file has the fields under their current names
+		db.setSchema(schema)
+		db.columns = nil
+		err = db.writeMetadata()
+	}
+	db.handle = openHandle(db.ticker, db.dataDir(), withColumns(db.schema, db.columns), db.options)
+	if db.handle == nil && err == nil {
+		err = errors.New("failed to initialize HOCDB")
+	}
+	if err == nil {
+		err = db.resetChecksums()
+	}
+	if err == nil {
+		err = db.resetColumns(oldColumns)
+	}
+	if err == nil {
+		err = db.remapIndexes(indexed, oldIndexes)
+	}
+	if err == nil {
+		err = db.resetZones()
+	}
+	if err == nil {
+		err = db.resetTimeIndex()
+	}
+	if err == nil {
+		err = db.resealAll()
+	}
+	if err != nil {
+		db.logError(what+" failed", err)
+		return 0, fmt.Errorf("%s failed: %w", what, err)
+	}
+
+	db.unflushed = 0
+	// Rotations and evictions are mirrored with the new record size
+	db.locateCursors()
+	db.notifyReaders(true)
+	return records, nil
+}
+
+// setSchema replaces the schema and the field map; db.mu must be held
+func (db *DB) setSchema(schema []Field) {
+	fieldMap := make(map[string]int, len(schema))
+	for i, field := range schema {
+		fieldMap[field.Name] = i
+	}
+	db.schemaMu.Lock()
+	db.schema, db.fieldMap = schema, fieldMap
+	db.schemaMu.Unlock()
+}
+
+// sameSchema reports whether a and b are the same schema slice, which schema
+// changes replace
+func sameSchema(a, b []Field) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// fillFile creates a data file of schema in dir, with the file layout of the
+// database, and writes it with fill; db.mu must be held
+func (db *DB) fillFile(dir string, schema []Field, fill func(tmp *DB) (int, error)) (int, error) {
+	handle := openHandle(db.ticker, dir, schema, Options{
+		MaxFileSize:   db.options.MaxFileSize,
+		OverwriteFull: db.options.OverwriteFull,
+	})
+	if handle == nil {
+		return 0, errors.New("failed to initialize HOCDB")
+	}
+	tmp := &DB{handle: handle, schema: schema}
+	defer engineClose(handle)
+
+	records, err := fill(tmp)
+	if err != nil {
+		return 0, err
+	}
+	if err := tmp.flush(); err != nil {
+		return 0, err
+	}
+	return records, nil
+}
+
+// rewrite appends the records of the database to tmp, converted with convert, and
+// returns their number; db.mu must be held
+func (db *DB) rewrite(tmp *DB, convert func(dst, src []byte)) (int, error) {
+	data, free, err := db.loadRaw()
+	if err != nil {
+		return 0, err
+	}
+	defer free()
+
+	size, newSize := RecordSize(db.schema), RecordSize(tmp.schema)
+	rec := make([]byte, newSize)
+	records := 0
+	for off := 0; off+size <= len(data); off += size {
+		for i := range rec {
+			rec[i] = 0
+		}
+		convert(rec, data[off:off+size])
+		if err := tmp.append(rec); err != nil {
+			return 0, err
+		}
+		records++
+	}
+	return records, nil
+}
+
+// loadRaw returns every record of the database in the engine's memory, which free
+// releases; db.mu must be held
+func (db *DB) loadRaw() (data []byte, free func(), err error) {
+	dataPtr, outLen := engineLoad(db.handle)
+	if dataPtr == nil {
+		return nil, nil, errors.New("failed to load data from HOCDB")
+	}
+	return unsafe.Slice((*byte)(dataPtr), outLen), func() { engineFree(dataPtr) }, nil
+}
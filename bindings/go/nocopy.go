@@ -0,0 +1,51 @@
+package hocdb
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// Result is a query result left in the memory the engine allocated for it, see
+// QueryNoCopy
+type Result struct {
+	// Data holds the raw records. It points into C memory: it is only valid until
+	// Release, and must not be appended to or retained afterwards.
+	Data []byte
+
+	ptr  unsafe.Pointer
+	once sync.Once
+}
+
+// Release frees the memory behind Data. It is safe to call more than once, and
+// after the database was closed.
+func (r *Result) Release() {
+	r.once.Do(func() {
+		if r.ptr != nil {
+			engineFree(r.ptr)
+		}
+		r.ptr = nil
+		r.Data = nil
+	})
+}
+
+// QueryNoCopy is Query without copying the result into Go memory, for result sets
+// large enough that the copy matters. The caller must call Release on the result
+// once done with Data; the memory is not garbage collected.
+func (db *DB) QueryNoCopy(startTs, endTs int64, filters interface{}) (*Result, error) {
+	dataPtr, outLen, err := db.query(startTs, endTs, filters, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if dataPtr == nil || outLen == 0 {
+		if dataPtr != nil {
+			engineFree(dataPtr)
+		}
+		return &Result{Data: []byte{}}, nil
+	}
+
+	return &Result{
+		Data: unsafe.Slice((*byte)(dataPtr), outLen),
+		ptr:  dataPtr,
+	}, nil
+}
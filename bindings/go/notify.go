@@ -0,0 +1,153 @@
+package hocdb
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// headFileExt is the extension of the hidden file a writer with
+// Options.NotifyReaders rewrites whenever it flushed new records, see DB.Wait
+const headFileExt = ".head"
+
+// headFile holds the generation a writer with Options.NotifyReaders bumps whenever
+// the database changed. A nil *headFile notifies nobody.
+type headFile struct {
+	f     *os.File
+	gen   uint64
+	dirty bool // Records were appended since the last notification
+}
+
+// headFilePath returns the path of the head file of a database
+func headFilePath(path, ticker string) string {
+	return filepath.Join(path, "."+ticker+headFileExt)
+}
+
+// openHeadFile opens the head file of a database for its writer, or removes the one
+// a previous writer left when notify isn't set, so that readers don't wait on it
+func openHeadFile(path, ticker string, notify bool) (*headFile, error) {
+	if !notify {
+		if err := os.Remove(headFilePath(path, ticker)); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	f, err := os.OpenFile(headFilePath(path, ticker), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// Generations start at the time of opening, so that a restarted writer doesn't
+	// repeat one a reader saw
+	return &headFile{f: f, gen: uint64(time.Now().UnixNano())}, nil
+}
+
+// notify bumps the generation when records were appended since the last time, or
+// always when force is set, for changes other than appends
+func (h *headFile) notify(force bool) error {
+	if h == nil || !(h.dirty || force) {
+		return nil
+	}
+	h.dirty = false
+	h.gen++
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], h.gen)
+	_, err := h.f.WriteAt(buf[:], 0)
+	return err
+}
+
+// close closes the head file, and removes it when remove is set
+func (h *headFile) close(remove bool) {
+	if h == nil {
+		return
+	}
+	if remove {
+		os.Remove(h.f.Name())
+	}
+	h.f.Close()
+}
+
+// notifyReaders bumps the generation of the head file, logging failures since the
+// change it reports already happened; db.mu must be held
+func (db *DB) notifyReaders(force bool) {
+	if err := db.head.notify(force); err != nil {
+		db.logError("failed to notify readers", err)
+	}
+}
+
+// changeMark identifies the state of a database as a read-only handle sees it from
+// the outside
+type changeMark struct {
+	gen      uint64 // Of the head file, 0 without one
+	size     int64  // Of the data file and its modification time, without a head file
+	mod      int64
+	segments int
+	lastSeq  int
+}
+
+// changeMark returns the current mark of a read-only database
+func (db *DB) changeMark() (changeMark, error) {
+	var m changeMark
+	var buf [8]byte
+	if f, err := os.Open(headFilePath(db.path, db.ticker)); err == nil {
+		_, err = f.ReadAt(buf[:], 0)
+		f.Close()
+		if err == nil {
+			m.gen = binary.LittleEndian.Uint64(buf[:])
+			return m, nil
+		}
+	}
+	info, err := os.Stat(db.dataFile())
+	if err != nil {
+		return m, err
+	}
+	m.size, m.mod = info.Size(), info.ModTime().UnixNano()
+	segments, err := listSegments(db.path, db.ticker)
+	if err != nil {
+		return m, err
+	}
+	if m.segments = len(segments); m.segments > 0 {
+		m.lastSeq = segments[m.segments-1].seq
+	}
+	return m, nil
+}
+
+// Wait blocks until the database opened with OpenReadOnly changed since the handle
+// last read it or Wait last returned, or until ctx is done. It returns right away
+// when the writer flushed records the handle hasn't read yet, so a loop of queries
+// and waits misses nothing.
+//
+// A writer opened with Options.NotifyReaders bumps a counter in a hidden file after
+// every flush that wrote records and every rewrite of the data file, which Wait
+// polls. Without it Wait polls the size and modification time of the data file and
+// the segment files, which also change while the writer's buffer fills up.
+func (db *DB) Wait(ctx context.Context) error {
+	if !db.readOnly {
+		return errors.New("waiting for changes needs a database opened with OpenReadOnly")
+	}
+	ticker := time.NewTicker(subscribePollInterval)
+	defer ticker.Stop()
+	for {
+		db.mu.Lock()
+		if db.roFile == nil {
+			db.mu.Unlock()
+			return errors.New("database not initialized")
+		}
+		mark, err := db.changeMark()
+		changed := err == nil && mark != db.seen
+		if changed {
+			db.seen = mark
+		}
+		db.mu.Unlock()
+		if err != nil || changed {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package hocdb
+
+import (
+	"errors"
+	"fmt"
+	"hocdb/store"
+	"math"
+	"unsafe"
+)
+
+// ErrNull is returned by GetLatest when the latest record holds a null in the field
+var ErrNull = store.ErrNull
+
+// nullsColumn names the field that holds the null bitmap in the engine's schema.
+// The engine knows nothing of nulls: it sees the bitmap as a string field at the
+// end of each record, one bit per nullable field in schema order, and the values
+// of null fields as zeros.
+const nullsColumn = "_nulls"
+
+// maxNullableFields is the number of bits the widest string field holds
+const maxNullableFields = stringFieldSize * 8
+
+// nullBitmapSize returns the size of the null bitmap ending the records of a schema,
+// 0 when no field is nullable
+func nullBitmapSize(schema []Field) int {
+	n := 0
+	for _, field := range schema {
+		if field.Nullable {
+			n++
+		}
+	}
+	return (n + 7) / 8
+}
+
+// checkNullable reports nullable fields the record layout can't hold
+func checkNullable(schema []Field) error {
+	n := 0
+	for _, field := range schema {
+		if !field.Nullable {
+			continue
+		}
+		if field.Name == "timestamp" {
+			return errors.New("the timestamp field can't be nullable")
+		}
+		n++
+	}
+	if n > maxNullableFields {
+		return fmt.Errorf("%d nullable fields, at most %d are supported", n, maxNullableFields)
+	}
+	return nil
+}
+
+// engineSchema returns the schema the engine opens the data file with, which holds
+// the null bitmap as an extra field
+func engineSchema(schema []Field) []Field {
+	size := nullBitmapSize(schema)
+	if size == 0 {
+		return schema
+	}
+	return append(schema[:len(schema):len(schema)], Field{Name: nullsColumn, Type: StringType(size)})
+}
+
+// nullBit returns where the null bit of a nullable field is in a record
+func nullBit(schema []Field, fieldIndex int) (offset int, mask byte) {
+	bit := 0
+	for _, field := range schema[:fieldIndex] {
+		if field.Nullable {
+			bit++
+		}
+	}
+	return RecordSize(schema) - nullBitmapSize(schema) + bit/8, 1 << (bit % 8)
+}
+
+// nullCopier returns a function setting the null bits of a record of dstSchema from
+// those of a record of srcSchema, where index maps each field of dstSchema to the
+// same field in srcSchema, or to -1 for a new one
+func nullCopier(dstSchema, srcSchema []Field, index func(int) int) func(dst, src []byte) {
+	type bitCopy struct {
+		srcOffset, dstOffset int
+		srcMask, dstMask     byte
+	}
+	var copies []bitCopy
+	for i, field := range dstSchema {
+		j := index(i)
+		if !field.Nullable || j < 0 || !srcSchema[j].Nullable {
+			continue
+		}
+		var c bitCopy
+		c.srcOffset, c.srcMask = nullBit(srcSchema, j)
+		c.dstOffset, c.dstMask = nullBit(dstSchema, i)
+		copies = append(copies, c)
+	}
+	return func(dst, src []byte) {
+		for _, c := range copies {
+			if src[c.srcOffset]&c.srcMask != 0 {
+				dst[c.dstOffset] |= c.dstMask
+			}
+		}
+	}
+}
+
+// nullFilters returns the filters for the engine and those to check again once it
+// has run: the engine can't tell nulls from zeros, nor match nulls asked for with
+// nil filter values
+func (db *DB) nullFilters(filters []Filter) (engine, check []Filter) {
+	if nullBitmapSize(db.schema) == 0 {
+		return filters, nil
+	}
+	for _, f := range filters {
+		if f.FieldIndex >= 0 && f.FieldIndex < len(db.schema) && db.schema[f.FieldIndex].Nullable {
+			check = append(check, f)
+			if f.Value == nil {
+				continue
+			}
+		}
+		engine = append(engine, f)
+	}
+	return engine, check
+}
+
+// filterResult drops the records of a query result in C memory that don't match
+// filters, returning the length of the records kept at its start
+func (db *DB) filterResult(dataPtr unsafe.Pointer, outLen int, filters []Filter) (int, error) {
+	matchers, err := db.matchers(filters)
+	if err != nil || dataPtr == nil {
+		return 0, err
+	}
+	data := unsafe.Slice((*byte)(dataPtr), outLen)
+	size, n := RecordSize(db.schema), 0
+	for off := 0; off+size <= len(data); off += size {
+		rec := data[off : off+size]
+		if matchAll(matchers, rec) {
+			n += copy(data[n:], rec)
+		}
+	}
+	return n, nil
+}
+
+// matchAll reports whether a record matches every matcher
+func matchAll(matchers []matcher, rec []byte) bool {
+	for i := range matchers {
+		if !matchers[i].match(rec) {
+			return false
+		}
+	}
+	return true
+}
+
+// nullableStats is GetStats for nullable fields, leaving the nulls out, which the
+// engine counts as zeros; db.mu must be held
+func (db *DB) nullableStats(startTs, endTs int64, fieldIndex int) (*Stats, error) {
+	dataPtr, outLen := engineQuery(db.handle, startTs, endTs, nil)
+	if dataPtr == nil {
+		return &Stats{}, nil
+	}
+	defer engineFree(dataPtr)
+	data := unsafe.Slice((*byte)(dataPtr), outLen)
+
+	size := RecordSize(db.schema)
+	offset, typ := db.fieldOffset(fieldIndex), db.schema[fieldIndex].Type
+	nullOffset, mask := nullBit(db.schema, fieldIndex)
+	stats := &Stats{Min: math.MaxFloat64, Max: -math.MaxFloat64}
+	for off := 0; off+size <= len(data); off += size {
+		rec := data[off : off+size]
+		if rec[nullOffset]&mask != 0 {
+			continue
+		}
+		val := numericValue(typ, rec[offset:])
+		stats.Min = math.Min(stats.Min, val)
+		stats.Max = math.Max(stats.Max, val)
+		stats.Sum += val
+		stats.Count++
+	}
+	if stats.Count == 0 {
+		return &Stats{}, nil
+	}
+	stats.Mean = stats.Sum / float64(stats.Count)
+	return stats, nil
+}
+
+// latestIsNull reports whether the field is null in the latest record, whose
+// timestamp is ts; db.mu must be held
+func (db *DB) latestIsNull(fieldIndex int, ts int64) (bool, error) {
+	dataPtr, outLen := engineQuery(db.handle, ts, ts+1, nil)
+	size := RecordSize(db.schema)
+	if dataPtr == nil || outLen < size {
+		return false, errors.New("failed to get latest value from HOCDB")
+	}
+	defer engineFree(dataPtr)
+	data := unsafe.Slice((*byte)(dataPtr), outLen)
+
+	offset, mask := nullBit(db.schema, fieldIndex)
+	return data[len(data)-size+offset]&mask != 0, nil
+}
@@ -0,0 +1,441 @@
+package hocdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Parquet physical types, converted types and enums from parquet.thrift
+const (
+	parquetBoolean   = 0
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetFloat     = 4
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetConvertedUTF8    = 0
+	parquetConvertedDecimal = 5
+	parquetConvertedUint8   = 11
+	parquetConvertedUint32  = 13
+	parquetConvertedUint64  = 14
+	parquetConvertedInt16   = 16
+
+	parquetRequired     = 0
+	parquetOptional     = 1
+	parquetPlain        = 0
+	parquetRLE          = 3
+	parquetUncompressed = 0
+	parquetDataPage     = 0
+)
+
+// parquetRowGroupSize is the number of rows written per Parquet row group
+const parquetRowGroupSize = 1 << 16
+
+var parquetMagic = []byte("PAR1")
+
+// ExportParquet writes all records in [startTs, endTs) to w as a Parquet file.
+//
+// Every schema field becomes a required column: i64 as INT64, u64 as INT64
+// annotated UINT_64, f64 as DOUBLE, bool as BOOLEAN and string as UTF8 BYTE_ARRAY
+// with the zero padding removed. The narrow types become INT32, annotated UINT_32,
+// INT_16 or UINT_8 unless i32, and f32 FLOAT. Nullable fields become optional
+// columns. Pages are PLAIN encoded and uncompressed so the
+// file can be read by pandas, Spark or any other Parquet reader. With
+// MaxResultMemory, the range is read in chunks, see QueryFunc, and row groups end
+// with the chunks.
+func (db *DB) ExportParquet(w io.Writer, startTs, endTs int64) error {
+	if !db.isOpen() {
+		return errors.New("database not initialized")
+	}
+
+	schema, _ := db.layout()
+	recordSize := RecordSize(schema)
+	numRows := 0
+
+	cw := &countingWriter{w: w}
+	if _, err := cw.Write(parquetMagic); err != nil {
+		return err
+	}
+
+	var rowGroups [][]parquetColumnChunk
+	err := db.queryEach(startTs, endTs, nil, func(data []byte) error {
+		n := len(data) / recordSize
+		for first := 0; first < n; first += parquetRowGroupSize {
+			rows := n - first
+			if rows > parquetRowGroupSize {
+				rows = parquetRowGroupSize
+			}
+			chunks, err := writeParquetRowGroup(cw, schema, data[first*recordSize:(first+rows)*recordSize], rows)
+			if err != nil {
+				return err
+			}
+			rowGroups = append(rowGroups, chunks)
+		}
+		numRows += n
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	meta := parquetFileMetaData(schema, int64(numRows), rowGroups)
+	if _, err := cw.Write(meta); err != nil {
+		return err
+	}
+	var footer [4]byte
+	binary.LittleEndian.PutUint32(footer[:], uint32(len(meta)))
+	if _, err := cw.Write(footer[:]); err != nil {
+		return err
+	}
+	_, err = cw.Write(parquetMagic)
+	return err
+}
+
+// parquetColumnChunk records where a column chunk was written for the footer
+type parquetColumnChunk struct {
+	offset int64
+	size   int64
+	rows   int
+}
+
+// writeParquetRowGroup writes one data page per column for the given records
+func writeParquetRowGroup(cw *countingWriter, schema []Field, data []byte, rows int) ([]parquetColumnChunk, error) {
+	recordSize := RecordSize(schema)
+	chunks := make([]parquetColumnChunk, len(schema))
+
+	fieldOffset := 0
+	for i, field := range schema {
+		size := field.Type.Size()
+
+		// Optional columns start with definition levels, 0 for nulls, and leave the
+		// nulls out of the values
+		var page []byte
+		present := make([]int, 0, rows)
+		if field.Nullable {
+			levels := make([]bool, rows)
+			nullOffset, mask := nullBit(schema, i)
+			for r := 0; r < rows; r++ {
+				if levels[r] = data[r*recordSize+nullOffset]&mask == 0; levels[r] {
+					present = append(present, r)
+				}
+			}
+			page = appendParquetLevels(page, levels)
+		} else {
+			for r := 0; r < rows; r++ {
+				present = append(present, r)
+			}
+		}
+
+		page, err := appendParquetValues(page, field.Type, data, recordSize, fieldOffset, present)
+		if err != nil {
+			return nil, err
+		}
+
+		header := parquetPageHeader(len(page), rows)
+		chunks[i] = parquetColumnChunk{
+			offset: cw.n,
+			size:   int64(len(header) + len(page)),
+			rows:   rows,
+		}
+		if _, err := cw.Write(header); err != nil {
+			return nil, err
+		}
+		if _, err := cw.Write(page); err != nil {
+			return nil, err
+		}
+
+		fieldOffset += size
+	}
+
+	return chunks, nil
+}
+
+// appendParquetValues appends the PLAIN encoded values of a field in the given rows
+func appendParquetValues(page []byte, t FieldType, data []byte, recordSize, fieldOffset int, rows []int) ([]byte, error) {
+	size := t.Size()
+	switch t.kind() {
+	case TypeI64, TypeF64, TypeU64, TypeDecimal:
+		// Little-endian 8-byte values are already in PLAIN layout
+		for _, r := range rows {
+			start := r*recordSize + fieldOffset
+			page = append(page, data[start:start+8]...)
+		}
+	case TypeI32, TypeU32, TypeF32:
+		for _, r := range rows {
+			start := r*recordSize + fieldOffset
+			page = append(page, data[start:start+4]...)
+		}
+	case TypeI16:
+		for _, r := range rows {
+			start := r*recordSize + fieldOffset
+			page = binary.LittleEndian.AppendUint32(page, uint32(int32(int16(binary.LittleEndian.Uint16(data[start:])))))
+		}
+	case TypeU8:
+		for _, r := range rows {
+			page = binary.LittleEndian.AppendUint32(page, uint32(data[r*recordSize+fieldOffset]))
+		}
+	case TypeBool:
+		bits := make([]byte, (len(rows)+7)/8)
+		for j, r := range rows {
+			if data[r*recordSize+fieldOffset] != 0 {
+				bits[j/8] |= 1 << (j % 8)
+			}
+		}
+		page = append(page, bits...)
+	case TypeString:
+		for _, r := range rows {
+			start := r*recordSize + fieldOffset
+			value := trimPadding(data[start : start+size])
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(value)))
+			page = append(page, value...)
+		}
+	case TypeBytes:
+		for _, r := range rows {
+			start := r*recordSize + fieldOffset
+			n := int(binary.LittleEndian.Uint16(data[start:]))
+			if n > size-2 {
+				return nil, errors.New("blob length exceeds its field")
+			}
+			page = binary.LittleEndian.AppendUint32(page, uint32(n))
+			page = append(page, data[start+2:start+2+n]...)
+		}
+	default:
+		return nil, errors.New("unsupported field type")
+	}
+	return page, nil
+}
+
+// appendParquetLevels appends definition levels of bit width 1 in the RLE hybrid
+// encoding, as runs of equal levels after the 4-byte length of the encoded runs
+func appendParquetLevels(page []byte, levels []bool) []byte {
+	start := len(page)
+	page = append(page, 0, 0, 0, 0)
+	for r := 0; r < len(levels); {
+		n := 1
+		for r+n < len(levels) && levels[r+n] == levels[r] {
+			n++
+		}
+		page = binary.AppendUvarint(page, uint64(n)<<1)
+		if levels[r] {
+			page = append(page, 1)
+		} else {
+			page = append(page, 0)
+		}
+		r += n
+	}
+	binary.LittleEndian.PutUint32(page[start:], uint32(len(page)-start-4))
+	return page
+}
+
+// parquetPageHeader encodes the PageHeader of an uncompressed PLAIN data page
+func parquetPageHeader(pageSize, numValues int) []byte {
+	var t thriftWriter
+	t.i32(1, parquetDataPage)
+	t.i32(2, int32(pageSize))
+	t.i32(3, int32(pageSize))
+	t.structBegin(5)
+	t.i32(1, int32(numValues))
+	t.i32(2, parquetPlain)
+	t.i32(3, parquetRLE)
+	t.i32(4, parquetRLE)
+	t.structEnd()
+	t.structEnd()
+	return t.buf
+}
+
+// parquetFileMetaData encodes the FileMetaData footer describing the schema and row groups
+func parquetFileMetaData(schema []Field, numRows int64, rowGroups [][]parquetColumnChunk) []byte {
+	var t thriftWriter
+	t.i32(1, 1)
+
+	t.listBegin(2, thriftStruct, len(schema)+1)
+	t.elemBegin()
+	t.binary(4, []byte("schema"))
+	t.i32(5, int32(len(schema)))
+	t.structEnd()
+	for _, field := range schema {
+		t.elemBegin()
+		t.i32(1, parquetPhysicalType(field.Type))
+		if field.Nullable {
+			t.i32(3, parquetOptional)
+		} else {
+			t.i32(3, parquetRequired)
+		}
+		t.binary(4, []byte(field.Name))
+		switch field.Type.kind() {
+		case TypeString:
+			t.i32(6, parquetConvertedUTF8)
+		case TypeU64:
+			t.i32(6, parquetConvertedUint64)
+		case TypeU32:
+			t.i32(6, parquetConvertedUint32)
+		case TypeI16:
+			t.i32(6, parquetConvertedInt16)
+		case TypeU8:
+			t.i32(6, parquetConvertedUint8)
+		case TypeDecimal:
+			t.i32(6, parquetConvertedDecimal)
+			t.i32(7, int32(field.Type.Scale()))
+			t.i32(8, maxDecimalScale)
+		}
+		t.structEnd()
+	}
+
+	t.i64(3, numRows)
+
+	t.listBegin(4, thriftStruct, len(rowGroups))
+	for _, chunks := range rowGroups {
+		var totalSize int64
+		rows := 0
+		t.elemBegin()
+		t.listBegin(1, thriftStruct, len(chunks))
+		for i, chunk := range chunks {
+			field := schema[i]
+			totalSize += chunk.size
+			rows = chunk.rows
+
+			t.elemBegin()
+			t.i64(2, chunk.offset)
+			t.structBegin(3)
+			t.i32(1, parquetPhysicalType(field.Type))
+			t.listBegin(2, thriftI32, 2)
+			t.listI32(parquetPlain)
+			t.listI32(parquetRLE)
+			t.listBegin(3, thriftBinary, 1)
+			t.listBinary([]byte(field.Name))
+			t.i32(4, parquetUncompressed)
+			t.i64(5, int64(chunk.rows))
+			t.i64(6, chunk.size)
+			t.i64(7, chunk.size)
+			t.i64(9, chunk.offset)
+			t.structEnd()
+			t.structEnd()
+		}
+		t.i64(2, totalSize)
+		t.i64(3, int64(rows))
+		t.structEnd()
+	}
+
+	t.binary(6, []byte("hocdb"))
+	t.structEnd()
+	return t.buf
+}
+
+// parquetPhysicalType maps a field type onto its Parquet physical type
+func parquetPhysicalType(t FieldType) int32 {
+	switch t.kind() {
+	case TypeF64:
+		return parquetDouble
+	case TypeF32:
+		return parquetFloat
+	case TypeI32, TypeU32, TypeI16, TypeU8:
+		return parquetInt32
+	case TypeString, TypeBytes:
+		return parquetByteArray
+	case TypeBool:
+		return parquetBoolean
+	default:
+		return parquetInt64
+	}
+}
+
+// countingWriter tracks the number of bytes written so file offsets can be recorded
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Thrift compact protocol type ids
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter is a minimal encoder for the Thrift compact protocol, covering
+// just the constructs needed for Parquet metadata
+type thriftWriter struct {
+	buf    []byte
+	lastID int16
+	stack  []int16
+}
+
+func (t *thriftWriter) fieldHeader(id int16, typ byte) {
+	delta := id - t.lastID
+	if delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.buf = binary.AppendUvarint(t.buf, zigzag(int64(id)))
+	}
+	t.lastID = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.fieldHeader(id, thriftI32)
+	t.buf = binary.AppendUvarint(t.buf, zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.fieldHeader(id, thriftI64)
+	t.buf = binary.AppendUvarint(t.buf, zigzag(v))
+}
+
+func (t *thriftWriter) binary(id int16, v []byte) {
+	t.fieldHeader(id, thriftBinary)
+	t.listBinary(v)
+}
+
+// structBegin starts a nested struct field
+func (t *thriftWriter) structBegin(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.elemBegin()
+}
+
+// elemBegin starts a struct that is an element of a list
+func (t *thriftWriter) elemBegin() {
+	t.stack = append(t.stack, t.lastID)
+	t.lastID = 0
+}
+
+// structEnd writes the stop byte and restores the enclosing field id
+func (t *thriftWriter) structEnd() {
+	t.buf = append(t.buf, 0)
+	if n := len(t.stack); n > 0 {
+		t.lastID = t.stack[n-1]
+		t.stack = t.stack[:n-1]
+	}
+}
+
+func (t *thriftWriter) listBegin(id int16, elemType byte, size int) {
+	t.fieldHeader(id, thriftList)
+	if size < 15 {
+		t.buf = append(t.buf, byte(size)<<4|elemType)
+	} else {
+		t.buf = append(t.buf, 0xF0|elemType)
+		t.buf = binary.AppendUvarint(t.buf, uint64(size))
+	}
+}
+
+func (t *thriftWriter) listI32(v int32) {
+	t.buf = binary.AppendUvarint(t.buf, zigzag(int64(v)))
+}
+
+func (t *thriftWriter) listBinary(v []byte) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(v)))
+	t.buf = append(t.buf, v...)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
@@ -0,0 +1,166 @@
+package hocdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Partition is the calendar period of the files of a database partitioned with
+// Options.PartitionBy
+type Partition int
+
+const (
+	PartitionNone  Partition = iota // Records stay in the data file, the default
+	PartitionDay                    // One file per calendar day
+	PartitionMonth                  // One file per calendar month
+)
+
+func (p Partition) String() string {
+	switch p {
+	case PartitionNone:
+		return "none"
+	case PartitionDay:
+		return "day"
+	case PartitionMonth:
+		return "month"
+	}
+	return fmt.Sprintf("Partition(%d)", int(p))
+}
+
+// Start returns the start of the partition holding t in loc, UTC when nil
+func (p Partition) Start(t time.Time, loc *time.Location) time.Time {
+	if loc == nil {
+		loc = time.UTC
+	}
+	y, m, d := t.In(loc).Date()
+	if p == PartitionMonth {
+		d = 1
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+// End returns the end of the partition holding t in loc, which is the start of
+// the next one
+func (p Partition) End(t time.Time, loc *time.Location) time.Time {
+	start := p.Start(t, loc)
+	if p == PartitionMonth {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// partitionEnd returns the timestamp where the partition holding ts ends
+func (db *DB) partitionEnd(ts int64) int64 {
+	return db.Timestamp(db.options.PartitionBy.End(db.Time(ts), db.options.PartitionLocation))
+}
+
+// segmentCompression returns the settings segments are written with: Compression,
+// or storing records as they are for a database that is only partitioned. It is
+// nil when the database has no segments of its own.
+func (db *DB) segmentCompression() *Compression {
+	if c := db.options.Compression; c != nil {
+		return c
+	}
+	if db.options.PartitionBy != PartitionNone {
+		return &Compression{Codec: "none"}
+	}
+	return nil
+}
+
+// partitionCuts returns the number of records of each finished partition at the
+// start of the data file f, leaving the partition of its newest record
+func (db *DB) partitionCuts(f *os.File) ([]int64, error) {
+	v, err := db.dataView(f)
+	if err != nil || v.count == 0 {
+		return nil, err
+	}
+	var cuts []int64
+	for from := int64(0); ; {
+		ts, err := v.timestampAt(from)
+		if err != nil {
+			return nil, err
+		}
+		to, err := v.search(db.partitionEnd(ts))
+		if err != nil {
+			return nil, err
+		}
+		if to >= v.count {
+			return cuts, nil
+		}
+		cuts = append(cuts, to-from)
+		from = to
+	}
+}
+
+// partitionDue reports whether the data file of a partitioned database holds
+// records of more than one partition; db.mu must be held
+func (db *DB) partitionDue() bool {
+	if db.partEnd == 0 {
+		f, err := os.Open(db.dataFile())
+		if err != nil {
+			return false
+		}
+		defer f.Close()
+		tsOffset, _ := timestampOffset(db.schema)
+		var buf [8]byte
+		if _, err := f.ReadAt(buf[:], fileHeaderSize+int64(tsOffset)); err != nil {
+			return false // Empty
+		}
+		db.partEnd = db.partitionEnd(int64(binary.LittleEndian.Uint64(buf[:])))
+	}
+	latest, err := db.getLatest(db.fieldMap["timestamp"])
+	return err == nil && latest.Timestamp >= db.partEnd
+}
+
+// DropPartition deletes the files of the finished partition holding t, for
+// retention. The partition the data file holds can't be dropped. Files a running
+// QueryFunc reads are deleted once it returns.
+func (db *DB) DropPartition(t time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	if db.handle == nil {
+		return errors.New("database not initialized")
+	}
+	p := db.options.PartitionBy
+	if p == PartitionNone {
+		return errors.New("database was opened without PartitionBy")
+	}
+	start := db.Timestamp(p.Start(t, db.options.PartitionLocation))
+	end := db.Timestamp(p.End(t, db.options.PartitionLocation))
+	kept := db.segments[:0:0]
+	dropped := 0
+	for _, s := range db.segments {
+		if s.first >= start && s.last < end {
+			if db.segRefs[s.seq] > 0 {
+				db.retired = append(db.retired, s)
+			} else {
+				if err := os.Remove(s.file); err != nil {
+					return fmt.Errorf("failed to drop partition: %w", err)
+				}
+				os.Remove(segmentZoneFile(s))
+				os.Remove(bloomFile(s))
+				if s.data != "" {
+					os.Remove(s.data)
+				}
+				db.removeCold(s)
+			}
+			delete(db.segZones, s.seq)
+			dropped++
+			continue
+		}
+		kept = append(kept, s)
+	}
+	if dropped == 0 {
+		return fmt.Errorf("no finished partition holds %s", t.Format(time.RFC3339))
+	}
+	db.segments = kept
+	db.segCache, db.segCacheFile = nil, ""
+	db.notifyReaders(true)
+	return syncFile(db.path)
+}
@@ -0,0 +1,499 @@
+package hocdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// Pool serves queries on one database from several read handles, so concurrent
+// readers don't queue up behind the mutex of a single handle.
+//
+// The engine locks its data file exclusively, so a pool keeps a single engine handle
+// for appends, stats and everything else, and n read handles that query the data
+// file directly. Queries flush pending writes first and see every record appended
+// before the call, and none appended during it. A full database opened with
+// OverwriteFull rewrites old records in place, so a query running concurrently with
+// appends to it leaves out the records they overwrite instead of returning the ones
+// that replaced them or a record half-written.
+type Pool struct {
+	db       *DB
+	readers  chan *os.File
+	n        int
+	done     chan struct{}
+	stop     sync.Once
+	size     int64 // Record size
+	tsOffset int
+}
+
+// NewPool opens a database like New and adds n read handles for Query and Load
+func NewPool(ticker, path string, schema []Field, options Options, n int) (*Pool, error) {
+	if n < 1 {
+		return nil, errors.New("pool needs at least one read handle")
+	}
+	tsOffset, ok := timestampOffset(schema)
+	if !ok {
+		return nil, errors.New("schema has no i64 timestamp field")
+	}
+
+	if options.Compression != nil || options.PartitionBy != PartitionNone {
+		return nil, errors.New("pool needs a database without Compression or PartitionBy")
+	}
+
+	db, err := New(ticker, path, schema, options)
+	if err != nil {
+		return nil, err
+	}
+	if len(db.segments) > 0 {
+		// Read handles only see the data file
+		db.Close()
+		return nil, errors.New("pool needs a database without compressed segments")
+	}
+
+	p := &Pool{
+		db:       db,
+		readers:  make(chan *os.File, n),
+		n:        n,
+		done:     make(chan struct{}),
+		size:     int64(RecordSize(schema)),
+		tsOffset: tsOffset,
+	}
+	for i := 0; i < n; i++ {
+		f, err := os.Open(db.dataFile())
+		if err != nil {
+			close(p.readers)
+			for f := range p.readers {
+				f.Close()
+			}
+			db.Close()
+			return nil, err
+		}
+		p.readers <- f
+	}
+	return p, nil
+}
+
+// DB returns the engine handle of the pool, for appends, stats and everything but
+// Query and Load. It is closed by Close.
+func (p *Pool) DB() *DB {
+	return p.db
+}
+
+// Append adds a raw record to the database
+func (p *Pool) Append(data []byte) error {
+	return p.db.Append(data)
+}
+
+// Load retrieves all records from the database
+func (p *Pool) Load() ([]byte, error) {
+	return p.Query(math.MinInt64, math.MaxInt64, nil)
+}
+
+// Query retrieves records within [startTs, endTs) with optional filters like
+// DB.Query, on one of the pool's read handles
+func (p *Pool) Query(startTs, endTs int64, filters interface{}) ([]byte, error) {
+	start := time.Now()
+	parsedFilters, err := p.db.parseFilters(filters)
+	if err != nil {
+		return nil, err
+	}
+	matchers, err := p.db.matchers(parsedFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	var f *os.File
+	select {
+	case f = <-p.readers:
+	case <-p.done:
+		return nil, errors.New("database not initialized")
+	}
+	defer func() { p.readers <- f }()
+
+	// The view of the file is fixed while no append can run
+	p.db.mu.Lock()
+	err = p.db.flush()
+	var end int64
+	if err == nil {
+		end, err = dataEnd(f, p.size)
+	}
+	p.db.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &fileView{f: f, size: p.size, tsOffset: p.tsOffset, count: (end - fileHeaderSize) / p.size}
+	if p.db.options.OverwriteFull && end >= p.db.maxFileSize() {
+		if v.start, err = v.oldest(); err != nil {
+			return nil, err
+		}
+		if err := v.setLive(); err != nil {
+			return nil, err
+		}
+	}
+	data, scanned, err := v.query(startTs, endTs, matchers)
+	if err != nil {
+		return nil, err
+	}
+	p.db.observeQuery(&queryInfo{op: "Query", start: start, startTs: startTs, endTs: endTs, filters: filters, scanned: scanned, returned: len(data) / int(p.size), ok: true})
+	return data, nil
+}
+
+// Close closes the read handles, once running queries are done, and the database
+func (p *Pool) Close() {
+	p.stop.Do(func() {
+		close(p.done)
+		for i := 0; i < p.n; i++ {
+			f := <-p.readers
+			f.Close()
+		}
+		p.db.Close()
+	})
+}
+
+// matcher checks one filter against a raw record
+type matcher struct {
+	offset int
+	size   int
+	typ    FieldType
+	raw    []byte  // Expected bytes for integer and string fields
+	f64    float64 // Expected value for float fields, compared numerically
+	b      bool
+	never  bool // The filter doesn't fit the field, as the engine matches nothing then
+
+	// Nullable fields have their null bit checked first: null values match only
+	// nil filters, which match nothing else
+	nullByte int
+	nullMask byte
+	isNull   bool
+
+	// Integer filters match narrow integer fields by value, float filters f32 fields
+	// as float32
+	narrow FieldType
+	i64    int64
+}
+
+// matchers converts filters into raw comparisons, following the engine's rules
+func (db *DB) matchers(filters []Filter) ([]matcher, error) {
+	schema, _ := db.layout()
+	offsets := make([]int, len(schema))
+	offset := 0
+	for i, field := range schema {
+		offsets[i] = offset
+		offset += field.Type.Size()
+	}
+
+	result := make([]matcher, len(filters))
+	for i, filter := range filters {
+		var m matcher
+		if filter.FieldIndex >= 0 && filter.FieldIndex < len(schema) && schema[filter.FieldIndex].Nullable {
+			m.nullByte, m.nullMask = nullBit(schema, filter.FieldIndex)
+		}
+		switch v := widenFilterValue(filter.Value).(type) {
+		case nil:
+			if m.nullMask == 0 {
+				return nil, errors.New("nil filter value for a field that isn't nullable")
+			}
+			m.isNull = true
+			result[i] = m
+			continue
+		case int64:
+			m.typ, m.raw = TypeI64, binary.LittleEndian.AppendUint64(nil, uint64(v))
+		case int:
+			m.typ, m.raw = TypeI64, binary.LittleEndian.AppendUint64(nil, uint64(int64(v)))
+		case float64:
+			m.typ, m.f64 = TypeF64, v
+		case uint64:
+			m.typ, m.raw = TypeU64, binary.LittleEndian.AppendUint64(nil, v)
+		case string:
+			m.typ, m.raw = TypeString, make([]byte, stringFieldSize)
+			copy(m.raw, v)
+			m.raw[min(stringFieldSize-1, len(v))] = 0
+		case bool:
+			m.typ, m.b = TypeBool, v
+		default:
+			return nil, errors.New("unsupported filter value type")
+		}
+		if filter.FieldIndex >= 0 && filter.FieldIndex < len(schema) {
+			if t := schema[filter.FieldIndex].Type; t != m.typ && m.matchNarrow(t, filter.Value) {
+				m.offset, m.size = offsets[filter.FieldIndex], t.Size()
+				result[i] = m
+				continue
+			}
+		}
+		if filter.FieldIndex < 0 || filter.FieldIndex >= len(schema) || schema[filter.FieldIndex].Type != m.typ {
+			m.never = true
+		} else {
+			m.offset, m.size = offsets[filter.FieldIndex], m.typ.Size()
+		}
+		result[i] = m
+	}
+	return result, nil
+}
+
+// matchNarrow sets up the matcher for a field of a narrow type, reporting whether
+// the filter's type matches it
+func (m *matcher) matchNarrow(t FieldType, value interface{}) bool {
+	switch t {
+	case TypeI32, TypeU32, TypeI16, TypeU8:
+		if m.typ != TypeI64 && m.typ != TypeU64 {
+			return false
+		}
+		v, ok := integerValue(widenFilterValue(value))
+		m.narrow, m.i64, m.never = t, v, !ok
+		return true
+	case TypeF32:
+		if m.typ != TypeF64 {
+			return false
+		}
+		m.narrow = t
+		return true
+	}
+	if t.IsDecimal() && m.typ == TypeI64 {
+		// parseFilters converted the value to the unscaled one
+		return true
+	}
+	if t.IsString() && m.typ == TypeString {
+		// Strings longer than the field can't be in it
+		width := t.Size()
+		m.never = width == 0 || len(bytes.Trim(m.raw[width:], "\x00")) > 0
+		m.raw = m.raw[:width]
+		return true
+	}
+	return false
+}
+
+func (m *matcher) match(rec []byte) bool {
+	if m.never {
+		return false
+	}
+	if m.nullMask != 0 && (rec[m.nullByte]&m.nullMask != 0) != m.isNull {
+		return false
+	}
+	if m.isNull {
+		return true
+	}
+	field := rec[m.offset : m.offset+m.size]
+	switch m.narrow {
+	case TypeI32:
+		return int64(int32(binary.LittleEndian.Uint32(field))) == m.i64
+	case TypeU32:
+		return int64(binary.LittleEndian.Uint32(field)) == m.i64
+	case TypeI16:
+		return int64(int16(binary.LittleEndian.Uint16(field))) == m.i64
+	case TypeU8:
+		return int64(field[0]) == m.i64
+	case TypeF32:
+		return math.Float32frombits(binary.LittleEndian.Uint32(field)) == float32(m.f64)
+	}
+	switch m.typ {
+	case TypeF64:
+		return math.Float64frombits(binary.LittleEndian.Uint64(field)) == m.f64
+	case TypeBool:
+		return (field[0] != 0) == m.b
+	default:
+		return bytes.Equal(field, m.raw)
+	}
+}
+
+// fileView reads the records of a data file in time order. Once a ring buffer has
+// wrapped, the oldest record is at index start and the rest follow circularly.
+type fileView struct {
+	f        io.ReaderAt
+	size     int64
+	tsOffset int
+	count    int64
+	start    int64
+	marks    []int64     // Timestamps of every timeIndexStride-th record, see Options.TimeIndex
+	limit    *queryLimit // Bounds of the query reading the view, see QueryOpts
+
+	// A live view is read without the lock of the writer, which may overwrite the
+	// oldest records of a full ring buffer meanwhile. Their slots then hold records
+	// newer than newest, the newest record of the view, which it leaves out.
+	live   bool
+	newest int64
+}
+
+// setLive marks a view as read while a writer may overwrite its oldest records
+func (v *fileView) setLive() error {
+	if v.count == 0 {
+		return nil
+	}
+	newest, err := v.timestampAt((v.start + v.count - 1) % v.count)
+	if err != nil {
+		return err
+	}
+	v.live, v.newest = true, newest
+	return nil
+}
+
+// overwritten returns how many of the oldest records of a live view the writer
+// has overwritten, or may be overwriting, so far. Records are written front to
+// back, so the ones overwritten come first; when the timestamp isn't the first
+// field, the record after them may have been partly written too.
+func (v *fileView) overwritten() (int64, error) {
+	ts, err := v.timestampAt(v.start)
+	if err != nil || ts <= v.newest {
+		return 0, err
+	}
+	lo, hi := int64(1), v.count
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		ts, err := v.timestampAt((v.start + mid) % v.count)
+		if err != nil {
+			return 0, err
+		}
+		if ts > v.newest {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if v.tsOffset > 0 && lo < v.count {
+		lo++
+	}
+	return lo, nil
+}
+
+// offset returns the file offset of the i-th oldest record
+func (v *fileView) offset(i int64) int64 {
+	return fileHeaderSize + (v.start+i)%v.count*v.size
+}
+
+func (v *fileView) timestampAt(physical int64) (int64, error) {
+	var buf [8]byte
+	if _, err := v.f.ReadAt(buf[:], fileHeaderSize+physical*v.size+int64(v.tsOffset)); err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(buf[:])), nil
+}
+
+// oldest finds the physical index of the oldest record in a wrapped file, where
+// timestamps increase up to the write position and then drop back
+func (v *fileView) oldest() (int64, error) {
+	lo, hi := int64(0), v.count-1
+	last, err := v.timestampAt(hi)
+	if err != nil {
+		return 0, err
+	}
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		ts, err := v.timestampAt(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ts > last {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// search returns the index of the first record at or after ts
+func (v *fileView) search(ts int64) (int64, error) {
+	lo, hi := v.bounds(ts)
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		t, err := v.timestampAt((v.start + mid) % v.count)
+		if err != nil {
+			return 0, err
+		}
+		if v.live && t > v.newest {
+			// Overwritten, the record that was there is older than any
+			t = math.MinInt64
+		}
+		if t < ts {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// query returns the matching records of [startTs, endTs) and how many records it read
+func (v *fileView) query(startTs, endTs int64, matchers []matcher) ([]byte, int, error) {
+	result := []byte{}
+	scanned, err := v.scan(startTs, endTs, func(rec []byte) {
+		for k := range matchers {
+			if !matchers[k].match(rec) {
+				return
+			}
+		}
+		result = append(result, rec...)
+		v.limit.match()
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return result, scanned, nil
+}
+
+// scan calls fn for the records of [startTs, endTs) in time order and returns how
+// many there were. rec is only valid during the call.
+func (v *fileView) scan(startTs, endTs int64, fn func(rec []byte)) (int, error) {
+	return v.chunks(startTs, endTs, func(chunk []byte) error {
+		for off := int64(0); off < int64(len(chunk)); off += v.size {
+			fn(chunk[off : off+v.size])
+		}
+		return v.limit.check(int64(len(chunk)))
+	})
+}
+
+// chunks calls fn with the records of [startTs, endTs) in time order, up to 4096
+// at a time, and returns how many there were. An error of fn stops it. chunk is
+// only valid during the call.
+func (v *fileView) chunks(startTs, endTs int64, fn func(chunk []byte) error) (int, error) {
+	if v.count == 0 {
+		return 0, nil
+	}
+	first, err := v.search(startTs)
+	if err != nil {
+		return 0, err
+	}
+	last, err := v.search(endTs)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := first; i < last; {
+		// Read up to the end of the file at once, a wrapped range takes two reads
+		off := v.offset(i)
+		n := last - i
+		if untilEOF := (fileHeaderSize + v.count*v.size - off) / v.size; n > untilEOF {
+			n = untilEOF
+		}
+		if n > 4096 {
+			n = 4096
+		}
+		chunk := make([]byte, n*v.size)
+		if _, err := v.f.ReadAt(chunk, off); err != nil {
+			return 0, err
+		}
+		if v.live {
+			// Checked after the read, so that it covers records overwritten during it
+			gone, err := v.overwritten()
+			if err != nil {
+				return 0, err
+			}
+			if gone > i {
+				chunk = chunk[min64(gone-i, n)*v.size:]
+			}
+		}
+		if err := fn(chunk); err != nil {
+			return 0, err
+		}
+		i += n
+	}
+	if last < first {
+		return 0, nil
+	}
+	return int(last - first), nil
+}
@@ -0,0 +1,377 @@
+/*
+Package promremote lets Prometheus use HOCDB as long-term storage through the
+remote_write and remote_read protocols.
+
+Every series is stored in its own HOCDB ticker with a timestamp (milliseconds) and
+a value field. Series are grouped in one directory per metric name, together with
+a series.json index mapping tickers back to their label sets:
+
+	<path>/<metric>/series.json
+	<path>/<metric>/<series id>.bin
+
+Each series keeps its data file open, so the process needs a file descriptor per
+active series.
+
+Example usage:
+
+	s := promremote.NewStorage("./prometheus", hocdb.Options{})
+	defer s.Close()
+
+	http.Handle("/api/v1/write", promremote.WriteHandler(s))
+	http.Handle("/api/v1/read", promremote.ReadHandler(s))
+
+with the matching Prometheus configuration:
+
+	remote_write:
+	  - url: http://localhost:9201/api/v1/write
+	remote_read:
+	  - url: http://localhost:9201/api/v1/read
+*/
+package promremote
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"hocdb"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Schema is the schema of every series ticker
+var Schema = []hocdb.Field{
+	{Name: "timestamp", Type: hocdb.TypeI64},
+	{Name: "value", Type: hocdb.TypeF64},
+}
+
+// seriesIndexFile lists the series of a metric directory, one JSON object per line
+const seriesIndexFile = "series.json"
+
+// maxRequestSize is the largest compressed request body accepted
+const maxRequestSize = 32 << 20
+
+// Label is a Prometheus label
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Storage stores Prometheus series under a common directory. It is safe for
+// concurrent use.
+type Storage struct {
+	mu      sync.Mutex
+	path    string
+	options hocdb.Options
+	metrics map[string]*metric
+}
+
+type metric struct {
+	dir    string
+	series map[string]*series
+}
+
+type series struct {
+	id     string
+	labels []Label
+	db     *hocdb.DB
+	last   int64 // Timestamp of the newest stored sample
+}
+
+// NewStorage creates a Storage keeping its data under path
+func NewStorage(path string, options hocdb.Options) *Storage {
+	return &Storage{
+		path:    path,
+		options: options,
+		metrics: make(map[string]*metric),
+	}
+}
+
+// Flush flushes every open series
+func (s *Storage) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range s.metrics {
+		for _, sr := range m.series {
+			if sr.db == nil {
+				continue
+			}
+			if err := sr.db.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes every open series
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range s.metrics {
+		for _, sr := range m.series {
+			if sr.db != nil {
+				sr.db.Close()
+				sr.db = nil
+			}
+		}
+	}
+	s.metrics = make(map[string]*metric)
+	return nil
+}
+
+// write stores decoded series and flushes the tickers it touched. Samples that are
+// not newer than the last stored sample of their series are dropped, which makes
+// retried requests idempotent.
+func (s *Storage) write(batch []timeSeries) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	touched := make(map[*series]bool)
+	for _, ts := range batch {
+		sr, err := s.series(ts.labels)
+		if err != nil {
+			return err
+		}
+		for _, smp := range ts.samples {
+			if smp.timestamp <= sr.last {
+				continue
+			}
+			record, err := hocdb.CreateRecordBytes(Schema, smp.timestamp, smp.value)
+			if err != nil {
+				return err
+			}
+			if err := sr.db.Append(record); err != nil {
+				return err
+			}
+			sr.last = smp.timestamp
+			touched[sr] = true
+		}
+	}
+
+	for sr := range touched {
+		if err := sr.db.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// series returns the open series for a label set, registering it on first use
+func (s *Storage) series(labels []Label) (*series, error) {
+	labels = sortLabels(labels)
+	name := labelValue(labels, "__name__")
+	if name == "" {
+		return nil, errors.New("series without a metric name")
+	}
+
+	m, err := s.metric(name)
+	if err != nil {
+		return nil, err
+	}
+
+	id := seriesID(labels)
+	sr, ok := m.series[id]
+	if !ok {
+		sr = &series{id: id, labels: labels}
+		if err := m.register(sr); err != nil {
+			return nil, err
+		}
+		m.series[id] = sr
+	}
+	if err := m.open(sr, s.options); err != nil {
+		return nil, err
+	}
+	return sr, nil
+}
+
+// metric returns a metric directory, loading its series index on first use.
+// Metrics are keyed by directory so a series is never opened twice.
+func (s *Storage) metric(name string) (*metric, error) {
+	dir := metricDir(name)
+	if m, ok := s.metrics[dir]; ok {
+		return m, nil
+	}
+
+	m := &metric{
+		dir:    filepath.Join(s.path, dir),
+		series: make(map[string]*series),
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	s.metrics[dir] = m
+	return m, nil
+}
+
+// indexEntry is one line of the series index
+type indexEntry struct {
+	ID     string            `json:"id"`
+	Labels map[string]string `json:"labels"`
+}
+
+// load reads the series index of the metric directory if it exists
+func (m *metric) load() error {
+	f, err := os.Open(filepath.Join(m.dir, seriesIndexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry indexEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A torn last line from a crash mid-append; the series is re-registered on its next write
+			continue
+		}
+		labels := make([]Label, 0, len(entry.Labels))
+		for name, value := range entry.Labels {
+			labels = append(labels, Label{Name: name, Value: value})
+		}
+		m.series[entry.ID] = &series{id: entry.ID, labels: sortLabels(labels)}
+	}
+	return scanner.Err()
+}
+
+// register appends a new series to the index
+func (m *metric) register(sr *series) error {
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return err
+	}
+
+	entry := indexEntry{ID: sr.id, Labels: make(map[string]string, len(sr.labels))}
+	for _, label := range sr.labels {
+		entry.Labels[label.Name] = label.Value
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(m.dir, seriesIndexFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// open opens the ticker of a series if it isn't open yet
+func (m *metric) open(sr *series, options hocdb.Options) error {
+	if sr.db != nil {
+		return nil
+	}
+
+	db, err := hocdb.New(sr.id, m.dir, Schema, options)
+	if err != nil {
+		return fmt.Errorf("failed to open series %s: %w", sr.id, err)
+	}
+	sr.db = db
+	sr.last = math.MinInt64
+	if latest, err := db.GetLatest(1); err == nil {
+		sr.last = latest.Timestamp
+	}
+	return nil
+}
+
+// sortLabels returns the labels sorted by name, the order used for series IDs
+func sortLabels(labels []Label) []Label {
+	sorted := append([]Label(nil), labels...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
+
+func labelValue(labels []Label, name string) string {
+	for _, label := range labels {
+		if label.Name == name {
+			return label.Value
+		}
+	}
+	return ""
+}
+
+// seriesID hashes a sorted label set into the ticker name of the series
+func seriesID(labels []Label) string {
+	h := fnv.New64a()
+	for _, label := range labels {
+		h.Write([]byte(label.Name))
+		h.Write([]byte{0xff})
+		h.Write([]byte(label.Value))
+		h.Write([]byte{0xff})
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// metricDir returns the directory name for a metric. Valid metric names are already
+// safe file names; anything else is sanitized.
+func metricDir(name string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", "..", "__").Replace(name)
+}
+
+// WriteHandler returns an http.Handler implementing the Prometheus remote_write
+// endpoint (protocol 1.0, snappy-compressed protobuf) on top of s. Malformed
+// requests get a 400 so Prometheus drops them; storage failures get a 500 so it
+// retries.
+func WriteHandler(s *Storage) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			rw.Header().Set("Allow", http.MethodPost)
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if strings.Contains(req.Header.Get("Content-Type"), "io.prometheus.write.v2") {
+			http.Error(rw, "remote write 2.0 is not supported", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		compressed, err := io.ReadAll(io.LimitReader(req.Body, maxRequestSize+1))
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(compressed) > maxRequestSize {
+			http.Error(rw, "request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		buf, err := snappyDecode(compressed)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		batch, err := decodeWriteRequest(buf)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, ts := range batch {
+			if labelValue(ts.labels, "__name__") == "" {
+				http.Error(rw, "series without a metric name", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := s.write(batch); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,255 @@
+package promremote
+
+import (
+	"errors"
+	"fmt"
+	"hocdb"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+)
+
+// matcher is a compiled label matcher
+type matcher struct {
+	labelMatcher
+	re *regexp.Regexp
+}
+
+func compileMatchers(ms []labelMatcher) ([]matcher, error) {
+	compiled := make([]matcher, len(ms))
+	for i, m := range ms {
+		compiled[i].labelMatcher = m
+		switch m.kind {
+		case matchEqual, matchNotEqual:
+		case matchRegexp, matchNotRegexp:
+			// Prometheus regular expressions are fully anchored
+			re, err := regexp.Compile("^(?:" + m.value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression for %s: %w", m.name, err)
+			}
+			compiled[i].re = re
+		default:
+			return nil, fmt.Errorf("unknown matcher type %d", m.kind)
+		}
+	}
+	return compiled, nil
+}
+
+// matches reports whether a label value satisfies the matcher; a missing label
+// has the empty value
+func (m matcher) matches(value string) bool {
+	switch m.kind {
+	case matchEqual:
+		return value == m.value
+	case matchNotEqual:
+		return value != m.value
+	case matchRegexp:
+		return m.re.MatchString(value)
+	default:
+		return !m.re.MatchString(value)
+	}
+}
+
+// selector is a query with its matchers compiled
+type selector struct {
+	start    int64
+	end      int64
+	matchers []matcher
+}
+
+func compileQueries(queries []query) ([]selector, error) {
+	selectors := make([]selector, len(queries))
+	for i, q := range queries {
+		matchers, err := compileMatchers(q.matchers)
+		if err != nil {
+			return nil, err
+		}
+		selectors[i] = selector{start: q.start, end: q.end, matchers: matchers}
+	}
+	return selectors, nil
+}
+
+// read runs each selector against the stored series
+func (s *Storage) read(selectors []selector) ([][]timeSeries, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([][]timeSeries, len(selectors))
+	for i, sel := range selectors {
+		var err error
+		results[i], err = s.selectSeries(sel.start, sel.end, sel.matchers)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// selectSeries returns the samples in [start, end] of every series matching all matchers
+func (s *Storage) selectSeries(start, end int64, matchers []matcher) ([]timeSeries, error) {
+	names, err := s.metricNames(matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []timeSeries
+	for _, name := range names {
+		m, err := s.metric(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, sr := range m.series {
+			if !matchesAll(sr.labels, matchers) {
+				continue
+			}
+			samples, err := m.samples(sr, s.options, start, end)
+			if err != nil {
+				return nil, err
+			}
+			if len(samples) > 0 {
+				result = append(result, timeSeries{labels: sr.labels, samples: samples})
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return labelsLess(result[i].labels, result[j].labels)
+	})
+	return result, nil
+}
+
+// metricNames lists the metrics a query can touch. An equality matcher on the
+// metric name avoids scanning the storage directory.
+func (s *Storage) metricNames(matchers []matcher) ([]string, error) {
+	for _, m := range matchers {
+		if m.name == "__name__" && m.kind == matchEqual {
+			return []string{m.value}, nil
+		}
+	}
+
+	entries, err := os.ReadDir(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		// Directory names are metric names, possibly sanitized; matching is done on
+		// the label sets from the index, which keep the real name
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
+
+// samples reads the samples of a series in the inclusive range [start, end]
+func (m *metric) samples(sr *series, options hocdb.Options, start, end int64) ([]sample, error) {
+	if err := m.open(sr, options); err != nil {
+		return nil, err
+	}
+	if end < math.MaxInt64 {
+		end++
+	}
+
+	data, err := sr.db.Query(start, end, nil)
+	if err != nil {
+		return nil, err
+	}
+	records, err := hocdb.DecodeRecords(Schema, data)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]sample, len(records))
+	for i, record := range records {
+		samples[i] = sample{
+			timestamp: record.Values[0].(int64),
+			value:     record.Values[1].(float64),
+		}
+	}
+	return samples, nil
+}
+
+func matchesAll(labels []Label, matchers []matcher) bool {
+	for _, m := range matchers {
+		if !m.matches(labelValue(labels, m.name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// labelsLess orders sorted label sets the way Prometheus does
+func labelsLess(a, b []Label) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].Name != b[i].Name {
+			return a[i].Name < b[i].Name
+		}
+		if a[i].Value != b[i].Value {
+			return a[i].Value < b[i].Value
+		}
+	}
+	return len(a) < len(b)
+}
+
+// ReadHandler returns an http.Handler implementing the Prometheus remote_read
+// endpoint on top of s. Results use the SAMPLES response type; clients that only
+// accept streamed chunks are rejected.
+func ReadHandler(s *Storage) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			rw.Header().Set("Allow", http.MethodPost)
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		compressed, err := io.ReadAll(io.LimitReader(req.Body, maxRequestSize+1))
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(compressed) > maxRequestSize {
+			http.Error(rw, "request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		buf, err := snappyDecode(compressed)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		queries, samples, err := decodeReadRequest(buf)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !samples {
+			http.Error(rw, "only the SAMPLES response type is supported", http.StatusBadRequest)
+			return
+		}
+
+		selectors, err := compileQueries(queries)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		results, err := s.read(selectors)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/x-protobuf")
+		rw.Header().Set("Content-Encoding", "snappy")
+		rw.Write(snappyEncode(encodeReadResponse(results)))
+	})
+}
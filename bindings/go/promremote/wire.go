@@ -0,0 +1,546 @@
+package promremote
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Remote read and write payloads are snappy-compressed protobuf messages. Only the
+// few messages of the remote protocol are needed, so both formats are handled by
+// hand instead of pulling in the Prometheus and protobuf modules.
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// protoReader iterates over the fields of a protobuf message
+type protoReader struct {
+	buf []byte
+	pos int
+}
+
+// next returns the number and wire type of the next field, or ok=false at the end
+func (r *protoReader) next() (field int, wireType int, ok bool, err error) {
+	if r.pos >= len(r.buf) {
+		return 0, 0, false, nil
+	}
+	key, err := r.varint()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return int(key >> 3), int(key & 7), true, nil
+}
+
+func (r *protoReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	r.pos += n
+	return v, nil
+}
+
+func (r *protoReader) fixed64() (uint64, error) {
+	if len(r.buf)-r.pos < 8 {
+		return 0, errTruncated
+	}
+	v := binary.LittleEndian.Uint64(r.buf[r.pos:])
+	r.pos += 8
+	return v, nil
+}
+
+func (r *protoReader) double() (float64, error) {
+	v, err := r.fixed64()
+	return math.Float64frombits(v), err
+}
+
+func (r *protoReader) bytes() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.buf)-r.pos) {
+		return nil, errTruncated
+	}
+	b := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// skip discards the value of a field the decoder doesn't use
+func (r *protoReader) skip(wireType int) error {
+	var err error
+	switch wireType {
+	case wireVarint:
+		_, err = r.varint()
+	case wireFixed64:
+		_, err = r.fixed64()
+	case wireBytes:
+		_, err = r.bytes()
+	case wireFixed32:
+		if len(r.buf)-r.pos < 4 {
+			return errTruncated
+		}
+		r.pos += 4
+	default:
+		err = errors.New("unsupported protobuf wire type")
+	}
+	return err
+}
+
+// timeSeries is a prometheus.TimeSeries: its labels and samples
+type timeSeries struct {
+	labels  []Label
+	samples []sample
+}
+
+type sample struct {
+	value     float64
+	timestamp int64 // Milliseconds
+}
+
+// decodeWriteRequest decodes a prometheus.WriteRequest. Metadata, exemplars and
+// native histograms are skipped.
+func decodeWriteRequest(buf []byte) ([]timeSeries, error) {
+	var series []timeSeries
+	r := &protoReader{buf: buf}
+	for {
+		field, wireType, ok, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return series, nil
+		}
+		if field != 1 || wireType != wireBytes {
+			if err := r.skip(wireType); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		msg, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		ts, err := decodeTimeSeries(msg)
+		if err != nil {
+			return nil, err
+		}
+		series = append(series, ts)
+	}
+}
+
+func decodeTimeSeries(buf []byte) (timeSeries, error) {
+	var ts timeSeries
+	r := &protoReader{buf: buf}
+	for {
+		field, wireType, ok, err := r.next()
+		if err != nil {
+			return ts, err
+		}
+		if !ok {
+			return ts, nil
+		}
+		switch {
+		case field == 1 && wireType == wireBytes:
+			msg, err := r.bytes()
+			if err != nil {
+				return ts, err
+			}
+			label, err := decodeLabel(msg)
+			if err != nil {
+				return ts, err
+			}
+			ts.labels = append(ts.labels, label)
+		case field == 2 && wireType == wireBytes:
+			msg, err := r.bytes()
+			if err != nil {
+				return ts, err
+			}
+			s, err := decodeSample(msg)
+			if err != nil {
+				return ts, err
+			}
+			ts.samples = append(ts.samples, s)
+		default:
+			if err := r.skip(wireType); err != nil {
+				return ts, err
+			}
+		}
+	}
+}
+
+func decodeLabel(buf []byte) (Label, error) {
+	var label Label
+	r := &protoReader{buf: buf}
+	for {
+		field, wireType, ok, err := r.next()
+		if err != nil {
+			return label, err
+		}
+		if !ok {
+			return label, nil
+		}
+		if (field == 1 || field == 2) && wireType == wireBytes {
+			b, err := r.bytes()
+			if err != nil {
+				return label, err
+			}
+			if field == 1 {
+				label.Name = string(b)
+			} else {
+				label.Value = string(b)
+			}
+			continue
+		}
+		if err := r.skip(wireType); err != nil {
+			return label, err
+		}
+	}
+}
+
+func decodeSample(buf []byte) (sample, error) {
+	var s sample
+	r := &protoReader{buf: buf}
+	for {
+		field, wireType, ok, err := r.next()
+		if err != nil {
+			return s, err
+		}
+		if !ok {
+			return s, nil
+		}
+		switch {
+		case field == 1 && wireType == wireFixed64:
+			s.value, err = r.double()
+		case field == 2 && wireType == wireVarint:
+			var v uint64
+			v, err = r.varint()
+			s.timestamp = int64(v)
+		default:
+			err = r.skip(wireType)
+		}
+		if err != nil {
+			return s, err
+		}
+	}
+}
+
+// maxDecodedSize bounds the memory a single request can make the decoder allocate
+const maxDecodedSize = 64 << 20
+
+// snappyDecode decodes a snappy block (not the framed stream format)
+func snappyDecode(src []byte) ([]byte, error) {
+	n, read := binary.Uvarint(src)
+	if read <= 0 {
+		return nil, errors.New("invalid snappy header")
+	}
+	if n > maxDecodedSize {
+		return nil, errors.New("snappy block too large")
+	}
+	dst := make([]byte, 0, n)
+	src = src[read:]
+
+	for len(src) > 0 {
+		tag := src[0]
+		switch tag & 3 {
+		case 0:
+			length := int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				extra := length - 59
+				if len(src) < extra {
+					return nil, errors.New("corrupt snappy literal")
+				}
+				length = 0
+				for i := extra - 1; i >= 0; i-- {
+					length = length<<8 | int(src[i])
+				}
+				src = src[extra:]
+			}
+			length++
+			if length > len(src) || len(dst)+length > int(n) {
+				return nil, errors.New("corrupt snappy literal")
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case 1:
+			if len(src) < 2 {
+				return nil, errors.New("corrupt snappy copy")
+			}
+			length := 4 + int(tag>>2&7)
+			offset := int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+			if err := snappyCopy(&dst, offset, length, int(n)); err != nil {
+				return nil, err
+			}
+		case 2:
+			if len(src) < 3 {
+				return nil, errors.New("corrupt snappy copy")
+			}
+			length := 1 + int(tag>>2)
+			offset := int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+			if err := snappyCopy(&dst, offset, length, int(n)); err != nil {
+				return nil, err
+			}
+		case 3:
+			if len(src) < 5 {
+				return nil, errors.New("corrupt snappy copy")
+			}
+			length := 1 + int(tag>>2)
+			offset := int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+			if err := snappyCopy(&dst, offset, length, int(n)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(dst) != int(n) {
+		return nil, errors.New("snappy length mismatch")
+	}
+	return dst, nil
+}
+
+// snappyCopy appends a back-reference; the ranges may overlap
+func snappyCopy(dst *[]byte, offset, length, limit int) error {
+	d := *dst
+	if offset <= 0 || offset > len(d) || len(d)+length > limit {
+		return errors.New("corrupt snappy copy")
+	}
+	start := len(d) - offset
+	for i := 0; i < length; i++ {
+		d = append(d, d[start+i])
+	}
+	*dst = d
+	return nil
+}
+
+// Label matcher types of prometheus.LabelMatcher
+const (
+	matchEqual = iota
+	matchNotEqual
+	matchRegexp
+	matchNotRegexp
+)
+
+// Response types of prometheus.ReadRequest
+const (
+	responseSamples = iota
+	responseStreamedChunks
+)
+
+type labelMatcher struct {
+	kind  int
+	name  string
+	value string
+}
+
+// query is a prometheus.Query; the time range is inclusive and in milliseconds
+type query struct {
+	start    int64
+	end      int64
+	matchers []labelMatcher
+}
+
+// decodeReadRequest decodes a prometheus.ReadRequest, returning its queries and
+// whether the client accepts the SAMPLES response type
+func decodeReadRequest(buf []byte) ([]query, bool, error) {
+	var queries []query
+	var types []uint64
+	r := &protoReader{buf: buf}
+	for {
+		field, wireType, ok, err := r.next()
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			break
+		}
+		switch {
+		case field == 1 && wireType == wireBytes:
+			msg, err := r.bytes()
+			if err != nil {
+				return nil, false, err
+			}
+			q, err := decodeQuery(msg)
+			if err != nil {
+				return nil, false, err
+			}
+			queries = append(queries, q)
+		case field == 2 && wireType == wireVarint:
+			v, err := r.varint()
+			if err != nil {
+				return nil, false, err
+			}
+			types = append(types, v)
+		case field == 2 && wireType == wireBytes:
+			// Packed repeated enum
+			packed, err := r.bytes()
+			if err != nil {
+				return nil, false, err
+			}
+			pr := &protoReader{buf: packed}
+			for pr.pos < len(packed) {
+				v, err := pr.varint()
+				if err != nil {
+					return nil, false, err
+				}
+				types = append(types, v)
+			}
+		default:
+			if err := r.skip(wireType); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+
+	// An empty list means the client predates response types and expects samples
+	samples := len(types) == 0
+	for _, t := range types {
+		if t == responseSamples {
+			samples = true
+		}
+	}
+	return queries, samples, nil
+}
+
+func decodeQuery(buf []byte) (query, error) {
+	var q query
+	r := &protoReader{buf: buf}
+	for {
+		field, wireType, ok, err := r.next()
+		if err != nil {
+			return q, err
+		}
+		if !ok {
+			return q, nil
+		}
+		switch {
+		case (field == 1 || field == 2) && wireType == wireVarint:
+			v, err := r.varint()
+			if err != nil {
+				return q, err
+			}
+			if field == 1 {
+				q.start = int64(v)
+			} else {
+				q.end = int64(v)
+			}
+		case field == 3 && wireType == wireBytes:
+			msg, err := r.bytes()
+			if err != nil {
+				return q, err
+			}
+			m, err := decodeLabelMatcher(msg)
+			if err != nil {
+				return q, err
+			}
+			q.matchers = append(q.matchers, m)
+		default:
+			if err := r.skip(wireType); err != nil {
+				return q, err
+			}
+		}
+	}
+}
+
+func decodeLabelMatcher(buf []byte) (labelMatcher, error) {
+	var m labelMatcher
+	r := &protoReader{buf: buf}
+	for {
+		field, wireType, ok, err := r.next()
+		if err != nil {
+			return m, err
+		}
+		if !ok {
+			return m, nil
+		}
+		switch {
+		case field == 1 && wireType == wireVarint:
+			v, err := r.varint()
+			if err != nil {
+				return m, err
+			}
+			m.kind = int(v)
+		case (field == 2 || field == 3) && wireType == wireBytes:
+			b, err := r.bytes()
+			if err != nil {
+				return m, err
+			}
+			if field == 2 {
+				m.name = string(b)
+			} else {
+				m.value = string(b)
+			}
+		default:
+			if err := r.skip(wireType); err != nil {
+				return m, err
+			}
+		}
+	}
+}
+
+func appendProtoBytes(buf []byte, field int, data []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field<<3|wireBytes))
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+// encodeReadResponse encodes a prometheus.ReadResponse with one result per query
+func encodeReadResponse(results [][]timeSeries) []byte {
+	var buf, result, ts, msg []byte
+	for _, series := range results {
+		result = result[:0]
+		for _, s := range series {
+			ts = ts[:0]
+			for _, label := range s.labels {
+				msg = appendProtoBytes(msg[:0], 1, []byte(label.Name))
+				msg = appendProtoBytes(msg, 2, []byte(label.Value))
+				ts = appendProtoBytes(ts, 1, msg)
+			}
+			for _, smp := range s.samples {
+				msg = append(msg[:0], 1<<3|wireFixed64)
+				msg = binary.LittleEndian.AppendUint64(msg, math.Float64bits(smp.value))
+				msg = append(msg, 2<<3|wireVarint)
+				msg = binary.AppendUvarint(msg, uint64(smp.timestamp))
+				ts = appendProtoBytes(ts, 2, msg)
+			}
+			result = appendProtoBytes(result, 1, ts)
+		}
+		buf = appendProtoBytes(buf, 1, result)
+	}
+	return buf
+}
+
+// snappyEncode writes src as a snappy block made only of literals. It doesn't
+// compress, but any snappy decoder reads it and responses stay cheap to produce.
+func snappyEncode(src []byte) []byte {
+	dst := binary.AppendUvarint(make([]byte, 0, len(src)+len(src)/65536*3+16), uint64(len(src)))
+	for len(src) > 0 {
+		n := len(src)
+		if n > 65536 {
+			n = 65536
+		}
+		switch {
+		case n <= 60:
+			dst = append(dst, byte(n-1)<<2)
+		case n <= 256:
+			dst = append(dst, 60<<2, byte(n-1))
+		default:
+			dst = append(dst, 61<<2, byte(n-1), byte((n-1)>>8))
+		}
+		dst = append(dst, src[:n]...)
+		src = src[n:]
+	}
+	return dst
+}
@@ -0,0 +1,143 @@
+package reader
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// decodeColumns decodes the columns of a segment written with
+// hocdb.EncodingGorilla into records in dst, which holds count records of schema.
+// Each column is preceded by its length: the timestamp field as delta-of-delta,
+// F64 fields as Gorilla XORs and the rest as their raw bytes.
+func decodeColumns(dst, data []byte, schema *Schema, count int) error {
+	for _, field := range schema.fields {
+		if len(data) < 4 || int(binary.LittleEndian.Uint32(data)) > len(data)-4 {
+			return errors.New("truncated column")
+		}
+		n := int(binary.LittleEndian.Uint32(data))
+		column := data[4 : 4+n]
+		data = data[4+n:]
+		var err error
+		switch {
+		case field.offset == schema.tsOffset:
+			err = decodeTimestamps(dst, column, schema.size, field.offset, count)
+		case field.kind == "f64":
+			err = decodeFloats(dst, column, schema.size, field.offset, count)
+		default:
+			if len(column) != count*field.size {
+				return errors.New("truncated column")
+			}
+			for i := 0; i < count; i++ {
+				copy(dst[i*schema.size+field.offset:], column[i*field.size:(i+1)*field.size])
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeTimestamps(dst, column []byte, recordSize, offset, count int) error {
+	r := bitReader{data: column}
+	var prev, delta int64
+	for i := 0; i < count; i++ {
+		var ts int64
+		switch i {
+		case 0:
+			ts = int64(r.read(64))
+		case 1:
+			delta = int64(r.read(64))
+			ts = prev + delta
+		default:
+			var dod int64
+			switch {
+			case r.read(1) == 0:
+			case r.read(1) == 0:
+				dod = r.readSigned(7)
+			case r.read(1) == 0:
+				dod = r.readSigned(9)
+			case r.read(1) == 0:
+				dod = r.readSigned(12)
+			default:
+				dod = int64(r.read(64))
+			}
+			delta += dod
+			ts = prev + delta
+		}
+		if r.overrun {
+			return errors.New("truncated timestamp column")
+		}
+		binary.LittleEndian.PutUint64(dst[i*recordSize+offset:], uint64(ts))
+		prev = ts
+	}
+	return nil
+}
+
+func decodeFloats(dst, column []byte, recordSize, offset, count int) error {
+	r := bitReader{data: column}
+	var prev uint64
+	leading, trailing := 0, 0
+	for i := 0; i < count; i++ {
+		v := prev
+		switch {
+		case i == 0:
+			v = r.read(64)
+		case r.read(1) == 0:
+		case r.read(1) == 0:
+			v ^= r.read(64-leading-trailing) << trailing
+		default:
+			leading = int(r.read(5))
+			meaningful := int(r.read(6))
+			if meaningful == 0 {
+				meaningful = 64
+			}
+			trailing = 64 - leading - meaningful
+			if trailing < 0 {
+				return errors.New("invalid float column")
+			}
+			v ^= r.read(meaningful) << trailing
+		}
+		if r.overrun {
+			return errors.New("truncated float column")
+		}
+		binary.LittleEndian.PutUint64(dst[i*recordSize+offset:], v)
+		prev = v
+	}
+	return nil
+}
+
+// bitReader reads values of up to 64 bits, most significant bit first, reading zeros and setting overrun past
+// the end
+type bitReader struct {
+	data    []byte
+	pos     int // Bit position
+	overrun bool
+}
+
+func (r *bitReader) read(n int) uint64 {
+	var v uint64
+	for n > 0 {
+		if r.pos >= len(r.data)*8 {
+			r.overrun = true
+			return v << n
+		}
+		avail := 8 - r.pos%8
+		take := min(n, avail)
+		b := r.data[r.pos/8] >> (avail - take) & (1<<take - 1)
+		v = v<<take | uint64(b)
+		r.pos += take
+		n -= take
+	}
+	return v
+}
+
+// readSigned reads an n-bit two's complement value
+func (r *bitReader) readSigned(n int) int64 {
+	v := r.read(n)
+	if v&(1<<(n-1)) != 0 {
+		v |= math.MaxUint64 << n
+	}
+	return int64(v)
+}
@@ -0,0 +1,458 @@
+/*
+Package reader reads HOCDB databases in pure Go, without CGO or the engine, for
+tools that only query them: in lambdas, cross-compiled binaries and CI. It reads
+the data file, including ring buffers that wrapped, and the compressed segments
+next to it, and decodes records like hocdb.DecodeRecord.
+
+A Reader doesn't lock anything and may read a database that a writer appends to,
+seeing the records written before each call. Encrypted databases can't be read.
+
+Example usage:
+
+	r, err := reader.Open("./data", "BTC_USD")
+	if err != nil {
+	    log.Fatal(err)
+	}
+	err = r.Scan(start, end, func(rec []byte) error {
+	    values, err := r.Schema().Decode(rec)
+	    ...
+	})
+*/
+package reader
+
+import (
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// fileHeaderSize is the size of the magic and schema hash at the start of a data file
+	fileHeaderSize = 12
+
+	dataMagic     = "HOC1"
+	segmentMagic  = "HOCZ"
+	columnarMagic = "HOCG" // Segment encoded with hocdb.EncodingGorilla
+
+	// scanRecords is how many records Scan reads from the data file at once
+	scanRecords = 4096
+)
+
+// ErrCorrupt is matched by the errors of reading segments that fail their checksum
+// or don't decompress
+var ErrCorrupt = errors.New("data file is corrupt")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]func(io.Reader) (io.ReadCloser, error){
+		"deflate": func(r io.Reader) (io.ReadCloser, error) { return flate.NewReader(r), nil },
+		"none":    func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil },
+	}
+)
+
+// RegisterCodec makes a decompressor available for the segments written with the
+// codec of that name. "deflate" and "none" are built in; segments written with
+// the codecs of hocdbcompress need their decompressors registered. It panics when
+// the name is taken.
+func RegisterCodec(name string, newReader func(r io.Reader) (io.ReadCloser, error)) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if newReader == nil {
+		panic("reader: RegisterCodec newReader is nil")
+	}
+	if _, dup := codecs[name]; dup {
+		panic("reader: RegisterCodec called twice for codec " + name)
+	}
+	codecs[name] = newReader
+}
+
+func lookupCodec(name string) (func(io.Reader) (io.ReadCloser, error), error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	newReader, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression codec %q, register it with RegisterCodec", name)
+	}
+	return newReader, nil
+}
+
+// Reader reads the records of a database. It is safe for concurrent use.
+type Reader struct {
+	path   string
+	ticker string
+	schema *Schema
+}
+
+// metadata is the part of <ticker>.schema.json a Reader needs
+type metadata struct {
+	Fields []struct {
+		Name     string `json:"name"`
+		Type     string `json:"type"`
+		Nullable bool   `json:"nullable"`
+	} `json:"fields"`
+}
+
+// Open opens the database of ticker in directory path, with the schema its
+// metadata file records
+func Open(path, ticker string) (*Reader, error) {
+	raw, err := os.ReadFile(filepath.Join(path, ticker+".schema.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema metadata: %w", err)
+	}
+	var meta metadata
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse schema metadata: %w", err)
+	}
+	fields := make([]Field, len(meta.Fields))
+	for i, f := range meta.Fields {
+		fields[i] = Field{Name: f.Name, Type: f.Type, Nullable: f.Nullable}
+	}
+	schema, err := newSchema(fields)
+	if err != nil {
+		return nil, err
+	}
+	return open(path, ticker, schema)
+}
+
+// OpenSchema opens the database of ticker in directory path with a schema written
+// as for ParseSchema, for databases without a metadata file
+func OpenSchema(path, ticker, spec string) (*Reader, error) {
+	schema, err := ParseSchema(spec)
+	if err != nil {
+		return nil, err
+	}
+	return open(path, ticker, schema)
+}
+
+func open(path, ticker string, schema *Schema) (*Reader, error) {
+	r := &Reader{path: path, ticker: ticker, schema: schema}
+	if _, err := os.Stat(r.dataFile()); err != nil {
+		if _, encErr := os.Stat(r.dataFile() + ".enc"); encErr == nil {
+			return nil, errors.New("database is encrypted")
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// Schema returns the schema of the records
+func (r *Reader) Schema() *Schema {
+	return r.schema
+}
+
+func (r *Reader) dataFile() string {
+	return filepath.Join(r.path, r.ticker+".bin")
+}
+
+// Query returns the records of [startTs, endTs) in time order
+func (r *Reader) Query(startTs, endTs int64) ([]byte, error) {
+	result := []byte{}
+	err := r.Scan(startTs, endTs, func(rec []byte) error {
+		result = append(result, rec...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Load returns all records in time order
+func (r *Reader) Load() ([]byte, error) {
+	return r.Query(math.MinInt64, math.MaxInt64)
+}
+
+// Scan calls fn with each record of [startTs, endTs) in time order, stopping at
+// the first error fn returns, which Scan returns. The record is only valid during
+// the call.
+func (r *Reader) Scan(startTs, endTs int64, fn func(rec []byte) error) error {
+	segments, f, err := r.open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, s := range segments {
+		if s.first >= endTs || s.last < startTs {
+			continue
+		}
+		if err := r.scanSegment(s, startTs, endTs, fn); err != nil {
+			return err
+		}
+	}
+	// Records a writer is compacting are in the data file and the last segment
+	if n := len(segments); n > 0 && startTs <= segments[n-1].last {
+		startTs = segments[n-1].last + 1
+	}
+	return r.scanData(f, startTs, endTs, fn)
+}
+
+// open lists the segments and opens the data file, listing them again until a
+// writer didn't compact in between
+func (r *Reader) open() ([]segment, *os.File, error) {
+	segments, err := r.segments()
+	for err == nil {
+		var f *os.File
+		if f, err = os.Open(r.dataFile()); err != nil {
+			break
+		}
+		var again []segment
+		if again, err = r.segments(); err == nil && len(again) == len(segments) &&
+			(len(again) == 0 || again[len(again)-1].seq == segments[len(segments)-1].seq) {
+			return segments, f, nil
+		}
+		f.Close()
+		segments = again
+	}
+	return nil, nil, err
+}
+
+// segment describes a segment file
+type segment struct {
+	file        string
+	seq         int
+	codec       string
+	columnar    bool
+	count       int64
+	first, last int64 // Timestamps of the first and last records
+	crc         uint32
+	dataOffset  int64
+}
+
+// segmentHeader is what follows the magic of a segment file, then the codec name
+type segmentHeader struct {
+	Count    int64
+	First    int64
+	Last     int64
+	CRC      uint32 // CRC-32C of the uncompressed records
+	CodecLen uint8
+}
+
+// segments returns the segments of the database in order
+func (r *Reader) segments() ([]segment, error) {
+	entries, err := os.ReadDir(r.path)
+	if err != nil {
+		return nil, err
+	}
+	var segments []segment
+	for _, entry := range entries {
+		// Exactly <ticker>.<10 digits>.seg, which no other ticker's files match
+		rest, ok := strings.CutPrefix(entry.Name(), r.ticker+".")
+		if !ok || len(rest) != 10+len(".seg") || !strings.HasSuffix(rest, ".seg") {
+			continue
+		}
+		seq, err := strconv.Atoi(rest[:10])
+		if err != nil || strings.ContainsAny(rest[:10], "+-") {
+			continue
+		}
+		s, err := readSegmentHeader(filepath.Join(r.path, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		s.seq = seq
+		segments = append(segments, s)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].seq < segments[j].seq })
+	return segments, nil
+}
+
+// readSegmentHeader reads the header of a segment file
+func readSegmentHeader(file string) (segment, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return segment{}, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(segmentMagic))
+	var h segmentHeader
+	if _, err := io.ReadFull(f, magic); err != nil || (string(magic) != segmentMagic && string(magic) != columnarMagic) {
+		return segment{}, fmt.Errorf("%s is not a HOCDB segment", file)
+	}
+	if err := binary.Read(f, binary.LittleEndian, &h); err != nil {
+		return segment{}, fmt.Errorf("%s is not a HOCDB segment", file)
+	}
+	codec := make([]byte, h.CodecLen)
+	if _, err := io.ReadFull(f, codec); err != nil {
+		return segment{}, fmt.Errorf("%s is not a HOCDB segment", file)
+	}
+	return segment{
+		file:       file,
+		codec:      string(codec),
+		columnar:   string(magic) == columnarMagic,
+		count:      h.Count,
+		first:      h.First,
+		last:       h.Last,
+		crc:        h.CRC,
+		dataOffset: int64(len(segmentMagic)+binary.Size(h)) + int64(h.CodecLen),
+	}, nil
+}
+
+// scanSegment decompresses a segment and calls fn with its records of [startTs,
+// endTs)
+func (r *Reader) scanSegment(s segment, startTs, endTs int64, fn func(rec []byte) error) error {
+	newReader, err := lookupCodec(s.codec)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(s.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(s.dataOffset, io.SeekStart); err != nil {
+		return err
+	}
+	dec, err := newReader(f)
+	if err != nil {
+		return err
+	}
+	defer dec.Close()
+
+	size := r.schema.size
+	data := make([]byte, s.count*int64(size))
+	if s.columnar {
+		encoded, err := io.ReadAll(dec)
+		if err == nil {
+			err = decodeColumns(data, encoded, r.schema, int(s.count))
+		}
+		if err != nil {
+			return fmt.Errorf("%w: segment %s: %v", ErrCorrupt, s.file, err)
+		}
+	} else if _, err := io.ReadFull(dec, data); err != nil {
+		return fmt.Errorf("%w: segment %s: %v", ErrCorrupt, s.file, err)
+	}
+	if crc32.Checksum(data, castagnoli) != s.crc {
+		return fmt.Errorf("%w: segment %s fails its checksum", ErrCorrupt, s.file)
+	}
+	i := sort.Search(int(s.count), func(i int) bool { return r.schema.Timestamp(data[i*size:]) >= startTs })
+	for off := i * size; off < len(data); off += size {
+		rec := data[off : off+size]
+		if r.schema.Timestamp(rec) >= endTs {
+			break
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dataView reads the records of a data file in time order. Once a ring buffer has
+// wrapped, the oldest record is at index start and the rest follow circularly.
+type dataView struct {
+	f     io.ReaderAt
+	size  int64
+	ts    int64 // Offset of the timestamp within a record
+	count int64
+	start int64
+}
+
+func (v *dataView) timestampAt(physical int64) (int64, error) {
+	var buf [8]byte
+	if _, err := v.f.ReadAt(buf[:], fileHeaderSize+physical*v.size+v.ts); err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(buf[:])), nil
+}
+
+// oldest finds the physical index of the oldest record, where timestamps increase
+// up to the write position of a wrapped file and then drop back
+func (v *dataView) oldest() (int64, error) {
+	lo, hi := int64(0), v.count-1
+	last, err := v.timestampAt(hi)
+	if err != nil {
+		return 0, err
+	}
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		ts, err := v.timestampAt(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ts > last {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// search returns the index of the first record at or after ts
+func (v *dataView) search(ts int64) (int64, error) {
+	lo, hi := int64(0), v.count
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		t, err := v.timestampAt((v.start + mid) % v.count)
+		if err != nil {
+			return 0, err
+		}
+		if t < ts {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// scanData calls fn with the records of [startTs, endTs) in the data file f
+func (r *Reader) scanData(f *os.File, startTs, endTs int64, fn func(rec []byte) error) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	var magic [len(dataMagic)]byte
+	if _, err := f.ReadAt(magic[:], 0); err != nil || string(magic[:]) != dataMagic {
+		return fmt.Errorf("%s is not a HOCDB data file", r.dataFile())
+	}
+	v := &dataView{f: f, size: int64(r.schema.size), ts: int64(r.schema.tsOffset)}
+	if info.Size() > fileHeaderSize {
+		// A record being appended may be partly written
+		v.count = (info.Size() - fileHeaderSize) / v.size
+	}
+	if v.count == 0 {
+		return nil
+	}
+	// The writer's settings are unknown, the timestamps tell whether it wrapped
+	if v.start, err = v.oldest(); err != nil {
+		return err
+	}
+	i, err := v.search(startTs)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, scanRecords*v.size)
+	for i < v.count {
+		// Read up to the end of the file, where a wrapped file continues at its start
+		physical := (v.start + i) % v.count
+		n := min(v.count-i, v.count-physical, scanRecords)
+		chunk := buf[:n*v.size]
+		if _, err := f.ReadAt(chunk, fileHeaderSize+physical*v.size); err != nil {
+			return err
+		}
+		for off := 0; off < len(chunk); off += int(v.size) {
+			rec := chunk[off : off+int(v.size)]
+			if r.schema.Timestamp(rec) >= endTs {
+				return nil
+			}
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+		i += n
+	}
+	return nil
+}
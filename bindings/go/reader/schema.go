@@ -0,0 +1,192 @@
+package reader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Field is a field of the records of a database
+type Field struct {
+	Name     string
+	Type     string // Type name as hocdb.FieldType.String returns it, such as "f64" or "string(8)"
+	Nullable bool
+
+	kind   string // Type without width, capacity or scale
+	arg    int    // Width, capacity or scale
+	offset int
+	size   int
+	bit    int // Null bit of nullable fields
+}
+
+// Decimal is the exact value of a decimal field, Unscaled / 10^Scale, like
+// hocdb.Decimal
+type Decimal struct {
+	Unscaled int64
+	Scale    int
+}
+
+// String formats the decimal with all of its Scale digits after the point
+func (d Decimal) String() string {
+	return new(big.Rat).SetFrac(big.NewInt(d.Unscaled), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(d.Scale)), nil)).FloatString(d.Scale)
+}
+
+// layout sets the kind, argument and size of a field from its type name
+func (f *Field) layout() error {
+	name := f.Type
+	kind, arg, hasArg := strings.Cut(strings.TrimSuffix(name, ")"), "(")
+	if hasArg {
+		n, err := strconv.Atoi(arg)
+		if err != nil || !strings.HasSuffix(name, ")") {
+			return fmt.Errorf("unknown field type: %s", name)
+		}
+		f.arg = n
+	}
+	f.kind = kind
+	switch {
+	case kind == "string" && !hasArg:
+		f.size = 128
+	case kind == "string" && f.arg >= 1 && f.arg <= 128:
+		f.size = f.arg
+	case kind == "bytes" && !hasArg:
+		f.size = 2 + 256
+	case kind == "bytes" && f.arg >= 1 && f.arg <= math.MaxUint16:
+		f.size = 2 + f.arg
+	case kind == "decimal" && f.arg >= 0 && f.arg <= 18:
+		f.size = 8
+	case hasArg:
+		return fmt.Errorf("unknown field type: %s", name)
+	case kind == "i64" || kind == "f64" || kind == "u64":
+		f.size = 8
+	case kind == "i32" || kind == "u32" || kind == "f32":
+		f.size = 4
+	case kind == "i16":
+		f.size = 2
+	case kind == "bool" || kind == "u8":
+		f.size = 1
+	default:
+		return fmt.Errorf("unknown field type: %s", name)
+	}
+	return nil
+}
+
+// Schema describes how the records of a database are laid out
+type Schema struct {
+	fields   []Field
+	size     int
+	tsOffset int
+}
+
+// ParseSchema parses a schema written like for hocdb.ParseSchema, as
+// comma-separated name:type pairs with "?" after the types of nullable fields, for
+// example "timestamp:i64,price:f64,side:string(8),fee:f64?"
+func ParseSchema(spec string) (*Schema, error) {
+	var fields []Field
+	for _, part := range strings.Split(spec, ",") {
+		name, typeName, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid field %q", part)
+		}
+		typeName, nullable := strings.CutSuffix(typeName, "?")
+		fields = append(fields, Field{Name: name, Type: typeName, Nullable: nullable})
+	}
+	return newSchema(fields)
+}
+
+// newSchema lays out fields, whose names, types and nullability are set
+func newSchema(fields []Field) (*Schema, error) {
+	s := &Schema{fields: fields, tsOffset: -1}
+	nullable := 0
+	for i := range fields {
+		f := &fields[i]
+		if err := f.layout(); err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		if f.Name == "timestamp" && f.kind == "i64" && !f.Nullable {
+			s.tsOffset = s.size
+		}
+		f.offset = s.size
+		s.size += f.size
+		if f.Nullable {
+			f.bit = nullable
+			nullable++
+		}
+	}
+	if s.tsOffset < 0 {
+		return nil, errors.New("schema has no timestamp field of type i64")
+	}
+	// The null bitmap ends the record
+	s.size += (nullable + 7) / 8
+	return s, nil
+}
+
+// Fields returns the fields in record order
+func (s *Schema) Fields() []Field {
+	return append([]Field(nil), s.fields...)
+}
+
+// RecordSize returns the size of a record in bytes
+func (s *Schema) RecordSize() int {
+	return s.size
+}
+
+// Timestamp returns the timestamp of a record
+func (s *Schema) Timestamp(rec []byte) int64 {
+	return int64(binary.LittleEndian.Uint64(rec[s.tsOffset:]))
+}
+
+// Decode converts a record to its values in field order, like hocdb.DecodeRecord:
+// int64, float64, uint64, string or bool, int32, uint32, float32, int16 or uint8
+// for the narrow types, []byte for blobs and Decimal for decimals. Nulls are nil.
+func (s *Schema) Decode(rec []byte) ([]interface{}, error) {
+	if len(rec) != s.size {
+		return nil, errors.New("record size doesn't match schema")
+	}
+	nullsStart := s.fields[len(s.fields)-1].offset + s.fields[len(s.fields)-1].size
+	values := make([]interface{}, len(s.fields))
+	for i, f := range s.fields {
+		if f.Nullable && rec[nullsStart+f.bit/8]&(1<<(f.bit%8)) != 0 {
+			continue
+		}
+		raw := rec[f.offset : f.offset+f.size]
+		switch f.kind {
+		case "i64":
+			values[i] = int64(binary.LittleEndian.Uint64(raw))
+		case "f64":
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(raw))
+		case "u64":
+			values[i] = binary.LittleEndian.Uint64(raw)
+		case "string":
+			if end := bytes.IndexByte(raw, 0); end >= 0 {
+				raw = raw[:end]
+			}
+			values[i] = string(raw)
+		case "bytes":
+			n := int(binary.LittleEndian.Uint16(raw))
+			if n > f.size-2 {
+				return nil, errors.New("blob length exceeds its field")
+			}
+			values[i] = append([]byte{}, raw[2:2+n]...)
+		case "decimal":
+			values[i] = Decimal{Unscaled: int64(binary.LittleEndian.Uint64(raw)), Scale: f.arg}
+		case "bool":
+			values[i] = raw[0] != 0
+		case "i32":
+			values[i] = int32(binary.LittleEndian.Uint32(raw))
+		case "u32":
+			values[i] = binary.LittleEndian.Uint32(raw)
+		case "f32":
+			values[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw))
+		case "i16":
+			values[i] = int16(binary.LittleEndian.Uint16(raw))
+		case "u8":
+			values[i] = raw[0]
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,299 @@
+package hocdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"unsafe"
+)
+
+// ErrReadOnly is returned by appends to a database opened with OpenReadOnly
+var ErrReadOnly = errors.New("database is read-only")
+
+// OpenReadOnly opens the existing database of a ticker for reading only. It reads the
+// data file directly instead of through the engine: it neither takes the engine's
+// lock nor writes to the file, so it can open a database another process is writing
+// and sees every record that process has flushed so far.
+//
+// Appends return ErrReadOnly, Flush does nothing and Drop only closes the handle.
+// Queries, stats, Subscribe, exports and backups work as usual, each reading what
+// the writer flushed by the time it starts, and Wait blocks until there is more.
+// Segments the writer compacts or drops and data files it replaces are picked up
+// as well, so any number of processes can read a database while it's written. A
+// database opened
+// with OverwriteFull that has wrapped rewrites old records in place, so a query
+// running while the writer overwrites them leaves them out, rather than returning
+// the records that replaced them or one half-written. Only the record the writer is
+// in the middle of writing when the query starts may be read half-written;
+// Subscribe waits for such records to settle.
+//
+// Like New, it fails with a *SchemaMismatchError when the schema differs from the
+// one recorded for the data file.
+func OpenReadOnly(ticker, path string, schema []Field) (*DB, error) {
+	if err := loadLibrary(); err != nil {
+		return nil, err
+	}
+	tsOffset, ok := timestampOffset(schema)
+	if !ok {
+		return nil, errors.New("schema has no i64 timestamp field")
+	}
+	for _, field := range schema {
+		if field.Type.Size() == 0 {
+			return nil, fmt.Errorf("field %s: unsupported type %d", field.Name, field.Type)
+		}
+	}
+	if err := checkNullable(schema); err != nil {
+		return nil, err
+	}
+
+	fieldMap := make(map[string]int)
+	for i, field := range schema {
+		fieldMap[field.Name] = i
+	}
+	db := &DB{
+		fieldMap: fieldMap,
+		ticker:   ticker,
+		path:     path,
+		schema:   append([]Field(nil), schema...),
+		readOnly: true,
+		tsOffset: tsOffset,
+	}
+
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		return nil, err
+	}
+	meta, err := checkSchema(ticker, path, schema)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// Times convert at the precision the writer recorded
+	if db.options.TimestampPrecision, err = checkPrecisionMatch(ticker, meta, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	var magic [4]byte
+	if _, err := f.ReadAt(magic[:], 0); err != nil || string(magic[:]) != "HOC1" {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a HOCDB data file", db.dataFile())
+	}
+	db.roFile = f
+	if db.seen, err = db.changeMark(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// view returns a view of the records in the data file of a read-only database;
+// db.mu must be held
+func (db *DB) view() (*fileView, error) {
+	// Taken before reading, so that Wait returns for what changes meanwhile
+	if mark, err := db.changeMark(); err == nil {
+		db.seen = mark
+	}
+	if err := db.refreshSegments(); err != nil {
+		return nil, err
+	}
+	size := int64(RecordSize(db.schema))
+	end, err := dataEnd(db.roFile, size)
+	if err != nil {
+		return nil, err
+	}
+	v := &fileView{f: db.roFile, size: size, tsOffset: db.tsOffset, count: (end - fileHeaderSize) / size}
+	if v.count > 0 {
+		// The writer's settings are unknown, the timestamps tell whether it wrapped
+		if v.start, err = v.oldest(); err != nil {
+			return nil, err
+		}
+	}
+	// The writer may be wrapping around while the view is read
+	if err := v.setLive(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// readQuery is query for read-only databases, returning the result in C memory
+// like the engine, see withSegments for q; db.mu must be held
+func (db *DB) readQuery(startTs, endTs int64, filters []Filter, q *queryInfo) (unsafe.Pointer, int, int, error) {
+	dataPtr, outLen, scanned, err := db.readQueryOnce(startTs, endTs, filters, q)
+	if errors.Is(err, os.ErrNotExist) {
+		// The writer dropped or compacted a segment since the segments were listed
+		return db.readQueryOnce(startTs, endTs, filters, q)
+	}
+	return dataPtr, outLen, scanned, err
+}
+
+// readQueryOnce is readQuery without retrying; db.mu must be held
+func (db *DB) readQueryOnce(startTs, endTs int64, filters []Filter, q *queryInfo) (unsafe.Pointer, int, int, error) {
+	matchers, err := db.matchers(filters)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	v, err := db.view()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if q != nil {
+		v.limit = q.limit
+	}
+	data, scanned, err := v.query(db.tailStart(startTs), endTs, matchers)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if q != nil {
+		q.bytesRead += int64(scanned) * v.size
+	}
+	var dataPtr unsafe.Pointer
+	if len(data) > 0 {
+		dataPtr = cBytes(data)
+	}
+	dataPtr, outLen, segScanned, err := db.withSegments(dataPtr, len(data), startTs, endTs, filters, q)
+	if err != nil {
+		if dataPtr != nil {
+			engineFree(dataPtr)
+		}
+		return nil, 0, 0, err
+	}
+	return dataPtr, outLen, scanned + segScanned, nil
+}
+
+// readStats is GetStats for read-only databases, following the engine; db.mu must
+// be held
+func (db *DB) readStats(startTs, endTs int64, fieldIndex int) (*Stats, error) {
+	stats, err := db.readStatsOnce(startTs, endTs, fieldIndex)
+	if errors.Is(err, os.ErrNotExist) {
+		// The writer dropped or compacted a segment since the segments were listed
+		return db.readStatsOnce(startTs, endTs, fieldIndex)
+	}
+	return stats, err
+}
+
+// readStatsOnce is readStats without retrying; db.mu must be held
+func (db *DB) readStatsOnce(startTs, endTs int64, fieldIndex int) (*Stats, error) {
+	if fieldIndex < 0 || fieldIndex >= len(db.schema) {
+		return nil, errors.New("failed to get stats from HOCDB")
+	}
+	v, err := db.view()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{Min: math.MaxFloat64, Max: -math.MaxFloat64}
+	if err := db.scanStats(stats, v, db.tailStart(startTs), endTs, fieldIndex); err != nil {
+		return nil, err
+	}
+	return db.segmentStats(finishStats(stats), startTs, endTs, fieldIndex)
+}
+
+// scanStats adds the values of a field in the records of [startTs, endTs) of a view
+// to stats, whose Mean finishStats sets
+func (db *DB) scanStats(stats *Stats, v *fileView, startTs, endTs int64, fieldIndex int) error {
+	offset, typ := db.fieldOffset(fieldIndex), db.schema[fieldIndex].Type
+	nullOffset, mask := -1, byte(0)
+	if db.schema[fieldIndex].Nullable {
+		nullOffset, mask = nullBit(db.schema, fieldIndex)
+	}
+	_, err := v.scan(startTs, endTs, func(rec []byte) {
+		if nullOffset >= 0 && rec[nullOffset]&mask != 0 {
+			return
+		}
+		val := numericValue(typ, rec[offset:])
+		stats.Min = math.Min(stats.Min, val)
+		stats.Max = math.Max(stats.Max, val)
+		stats.Sum += val
+		stats.Count++
+	})
+	return err
+}
+
+// finishStats sets the mean of stats accumulated by scanStats, or returns empty
+// stats when there were no values
+func finishStats(stats *Stats) *Stats {
+	if stats.Count == 0 {
+		return &Stats{}
+	}
+	stats.Mean = stats.Sum / float64(stats.Count)
+	return stats
+}
+
+// readLatest is getLatest for read-only databases; db.mu must be held
+func (db *DB) readLatest(fieldIndex int) (*Latest, error) {
+	v, err := db.view()
+	if err != nil {
+		return nil, err
+	}
+	if v.count == 0 || fieldIndex < 0 || fieldIndex >= len(db.schema) {
+		return nil, errors.New("failed to get latest value from HOCDB")
+	}
+
+	rec := make([]byte, v.size)
+	if _, err := v.f.ReadAt(rec, v.offset(v.count-1)); err != nil {
+		return nil, err
+	}
+	if db.schema[fieldIndex].Nullable {
+		if offset, mask := nullBit(db.schema, fieldIndex); rec[offset]&mask != 0 {
+			return nil, fmt.Errorf("latest %s: %w", db.schema[fieldIndex].Name, ErrNull)
+		}
+	}
+	return &Latest{
+		Value:     numericValue(db.schema[fieldIndex].Type, rec[db.fieldOffset(fieldIndex):]),
+		Timestamp: int64(binary.LittleEndian.Uint64(rec[db.tsOffset:])),
+	}, nil
+}
+
+// readCursor is writeCursor for read-only databases; db.mu must be held
+func (db *DB) readCursor() (int64, error) {
+	v, err := db.view()
+	if err != nil {
+		return 0, err
+	}
+	if v.start > 0 {
+		return fileHeaderSize + v.start*v.size, nil
+	}
+	return fileHeaderSize + v.count*v.size, nil
+}
+
+// fieldOffset returns the byte offset of a field within a record
+func (db *DB) fieldOffset(fieldIndex int) int {
+	offset := 0
+	for _, field := range db.schema[:fieldIndex] {
+		offset += field.Type.Size()
+	}
+	return offset
+}
+
+// numericValue converts a raw field to float64 like the engine's stats do; strings
+// count as 0
+func numericValue(t FieldType, b []byte) float64 {
+	switch t {
+	case TypeI64:
+		return float64(int64(binary.LittleEndian.Uint64(b)))
+	case TypeF64:
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	case TypeU64:
+		return float64(binary.LittleEndian.Uint64(b))
+	case TypeBool:
+		if b[0] != 0 {
+			return 1
+		}
+	case TypeI32:
+		return float64(int32(binary.LittleEndian.Uint32(b)))
+	case TypeU32:
+		return float64(binary.LittleEndian.Uint32(b))
+	case TypeF32:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	case TypeI16:
+		return float64(int16(binary.LittleEndian.Uint16(b)))
+	case TypeU8:
+		return float64(b[0])
+	}
+	if t.IsDecimal() {
+		return Decimal{Unscaled: int64(binary.LittleEndian.Uint64(b)), Scale: t.Scale()}.Float64()
+	}
+	return 0
+}
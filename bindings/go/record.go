@@ -0,0 +1,435 @@
+package hocdb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// stringFieldSize is the fixed on-disk width of a TypeString field
+const stringFieldSize = 128
+
+// StringType returns the type of string fields width bytes wide, from 1 to 128,
+// for strings known to be shorter than TypeString's 128 bytes. StringType(128) is
+// TypeString. Like TypeString, the field holds strings up to width bytes, padded
+// with zeros.
+func StringType(width int) FieldType {
+	if width == stringFieldSize {
+		return TypeString
+	}
+	return FieldType(width<<8) | TypeString
+}
+
+// IsString reports whether the type is TypeString or a type from StringType
+func (t FieldType) IsString() bool {
+	return t&0xff == TypeString
+}
+
+// bytesFieldSize is the capacity of a TypeBytes field, which holds its payload
+// after a 2-byte little-endian length
+const bytesFieldSize = 256
+
+// maxBytesFieldSize is the largest capacity of a type from BytesType
+const maxBytesFieldSize = math.MaxUint16
+
+// BytesType returns the type of blob fields holding up to capacity bytes, from 1 to
+// 65535. BytesType(256) is TypeBytes.
+func BytesType(capacity int) FieldType {
+	if capacity == bytesFieldSize {
+		return TypeBytes
+	}
+	return FieldType(capacity<<8) | TypeBytes
+}
+
+// IsBytes reports whether the type is TypeBytes or a type from BytesType
+func (t FieldType) IsBytes() bool {
+	return t&0xff == TypeBytes
+}
+
+// kind returns the type with the width of string and blob types and the scale of
+// decimal types removed, so TypeString for any string type, TypeBytes for any blob
+// type and TypeDecimal for any decimal type
+func (t FieldType) kind() FieldType {
+	if t.IsString() || t.IsBytes() || t.IsDecimal() {
+		return t & 0xff
+	}
+	return t
+}
+
+// Size returns the number of bytes a field of this type occupies in a record
+func (t FieldType) Size() int {
+	if kind := t.kind(); kind != t {
+		width := int(t >> 8)
+		switch {
+		case kind == TypeString && width > 0 && width < stringFieldSize:
+			return width
+		case kind == TypeBytes && width > 0 && width <= maxBytesFieldSize:
+			return 2 + width
+		case kind == TypeDecimal && width <= maxDecimalScale:
+			return 8
+		}
+		return 0
+	}
+	switch t {
+	case TypeI64, TypeF64, TypeU64, TypeDecimal:
+		return 8
+	case TypeI32, TypeU32, TypeF32:
+		return 4
+	case TypeI16:
+		return 2
+	case TypeString:
+		return stringFieldSize
+	case TypeBytes:
+		return 2 + bytesFieldSize
+	case TypeBool, TypeU8:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// String returns the name of the field type as used in the core engine
+func (t FieldType) String() string {
+	switch t {
+	case TypeI64:
+		return "i64"
+	case TypeF64:
+		return "f64"
+	case TypeU64:
+		return "u64"
+	case TypeString:
+		return "string"
+	case TypeBytes:
+		return "bytes"
+	case TypeDecimal:
+		return "decimal"
+	case TypeBool:
+		return "bool"
+	case TypeI32:
+		return "i32"
+	case TypeU32:
+		return "u32"
+	case TypeF32:
+		return "f32"
+	case TypeI16:
+		return "i16"
+	case TypeU8:
+		return "u8"
+	default:
+		if t.IsString() && t.Size() > 0 {
+			return fmt.Sprintf("string(%d)", t.Size())
+		}
+		if t.IsBytes() && t.Size() > 0 {
+			return fmt.Sprintf("bytes(%d)", t.Size()-2)
+		}
+		if t.IsDecimal() && t.Size() > 0 {
+			return fmt.Sprintf("decimal(%d)", t.Scale())
+		}
+		return fmt.Sprintf("FieldType(%d)", int(t))
+	}
+}
+
+// ParseFieldType returns the field type with the given engine name ("i64", "f64",
+// "u64", "string", "bool", "i32", "u32", "f32", "i16", "u8", "bytes" or "decimal"),
+// or "string(N)", "bytes(N)" and "decimal(N)" for StringType(N), BytesType(N) and
+// DecimalType(N)
+func ParseFieldType(name string) (FieldType, error) {
+	if arg, ok := strings.CutPrefix(name, "string("); ok && strings.HasSuffix(arg, ")") {
+		width, err := strconv.Atoi(strings.TrimSuffix(arg, ")"))
+		if err != nil || width < 1 || width > stringFieldSize {
+			return 0, fmt.Errorf("invalid string width: %s", name)
+		}
+		return StringType(width), nil
+	}
+	if arg, ok := strings.CutPrefix(name, "bytes("); ok && strings.HasSuffix(arg, ")") {
+		capacity, err := strconv.Atoi(strings.TrimSuffix(arg, ")"))
+		if err != nil || capacity < 1 || capacity > maxBytesFieldSize {
+			return 0, fmt.Errorf("invalid bytes capacity: %s", name)
+		}
+		return BytesType(capacity), nil
+	}
+	if arg, ok := strings.CutPrefix(name, "decimal("); ok && strings.HasSuffix(arg, ")") {
+		scale, err := strconv.Atoi(strings.TrimSuffix(arg, ")"))
+		if err != nil || scale < 0 || scale > maxDecimalScale {
+			return 0, fmt.Errorf("invalid decimal scale: %s", name)
+		}
+		return DecimalType(scale), nil
+	}
+	for _, t := range []FieldType{TypeI64, TypeF64, TypeU64, TypeString, TypeBool, TypeI32, TypeU32, TypeF32, TypeI16, TypeU8, TypeBytes, TypeDecimal} {
+		if t.String() == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown field type: %s", name)
+}
+
+// ParseSchema parses a schema written as comma-separated name:type pairs, for
+// example "timestamp:i64,price:f64,side:string". A type ending in "?", such as
+// "f64?", makes the field nullable.
+func ParseSchema(spec string) ([]Field, error) {
+	var schema []Field
+	for _, part := range strings.Split(spec, ",") {
+		name, typeName, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid field %q", part)
+		}
+		typeName, nullable := strings.CutSuffix(typeName, "?")
+		t, err := ParseFieldType(typeName)
+		if err != nil {
+			return nil, err
+		}
+		schema = append(schema, Field{Name: name, Type: t, Nullable: nullable})
+	}
+	return schema, nil
+}
+
+// ParseValue converts text into the Go value CreateRecordBytes expects for the field
+// type. Blobs are written in standard base64.
+func ParseValue(t FieldType, text string) (interface{}, error) {
+	switch t.kind() {
+	case TypeI64:
+		return strconv.ParseInt(text, 10, 64)
+	case TypeF64:
+		return strconv.ParseFloat(text, 64)
+	case TypeU64:
+		return strconv.ParseUint(text, 10, 64)
+	case TypeString:
+		if len(text) > t.Size() {
+			return nil, fmt.Errorf("string longer than %d bytes", t.Size())
+		}
+		return text, nil
+	case TypeBool:
+		return strconv.ParseBool(text)
+	case TypeBytes:
+		v, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return nil, err
+		}
+		if len(v) > t.Size()-2 {
+			return nil, fmt.Errorf("value longer than %d bytes", t.Size()-2)
+		}
+		return v, nil
+	case TypeDecimal:
+		return ParseDecimal(text, t.Scale())
+	case TypeI32:
+		v, err := strconv.ParseInt(text, 10, 32)
+		return int32(v), err
+	case TypeU32:
+		v, err := strconv.ParseUint(text, 10, 32)
+		return uint32(v), err
+	case TypeF32:
+		v, err := strconv.ParseFloat(text, 32)
+		return float32(v), err
+	case TypeI16:
+		v, err := strconv.ParseInt(text, 10, 16)
+		return int16(v), err
+	case TypeU8:
+		v, err := strconv.ParseUint(text, 10, 8)
+		return uint8(v), err
+	default:
+		return nil, errors.New("unsupported field type")
+	}
+}
+
+// intRange returns the range of values of a narrow integer type
+func (t FieldType) intRange() (int64, int64) {
+	switch t {
+	case TypeI32:
+		return math.MinInt32, math.MaxInt32
+	case TypeU32:
+		return 0, math.MaxUint32
+	case TypeI16:
+		return math.MinInt16, math.MaxInt16
+	case TypeU8:
+		return 0, math.MaxUint8
+	default:
+		return math.MinInt64, math.MaxInt64
+	}
+}
+
+// integerValue converts any Go integer to int64, for the narrow integer types
+func integerValue(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case uint32:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// widenFilterValue converts a narrow Go value of a filter to the 64-bit type the
+// engine's filters hold, which match fields of the narrow types by value
+func widenFilterValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int32:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case uint32:
+		return uint64(v)
+	case uint16:
+		return uint64(v)
+	case uint8:
+		return uint64(v)
+	case float32:
+		return float64(v)
+	default:
+		return v
+	}
+}
+
+// RecordSize returns the size in bytes of a single record for the given schema
+func RecordSize(schema []Field) int {
+	size := 0
+	for _, field := range schema {
+		size += field.Type.Size()
+	}
+	return size + nullBitmapSize(schema)
+}
+
+// Record is a single decoded record. Values are stored in schema order and hold
+// int64, float64, uint64, string or bool depending on the field type, int32,
+// uint32, float32, int16 or uint8 for the narrow types, []byte for blobs and Decimal
+// for decimals.
+type Record struct {
+	Schema []Field
+	Values []interface{}
+}
+
+// Get returns the value of the named field
+func (r Record) Get(name string) (interface{}, bool) {
+	for i, field := range r.Schema {
+		if field.Name == name {
+			return r.Values[i], true
+		}
+	}
+	return nil, false
+}
+
+// Timestamp returns the value of the timestamp field, or 0 if the schema has none
+func (r Record) Timestamp() int64 {
+	v, ok := r.Get("timestamp")
+	if !ok {
+		return 0
+	}
+	ts, _ := v.(int64)
+	return ts
+}
+
+// DecodeRecord decodes a single raw record into Go values in schema order.
+// String fields are returned with their zero padding removed, and null values of
+// nullable fields as nil.
+func DecodeRecord(schema []Field, data []byte) ([]interface{}, error) {
+	if len(data) != RecordSize(schema) {
+		return nil, errors.New("record size doesn't match schema")
+	}
+
+	values := make([]interface{}, len(schema))
+	nulls := data[len(data)-nullBitmapSize(schema):]
+	offset, bit := 0, 0
+	for i, field := range schema {
+		size := field.Type.Size()
+		raw := data[offset : offset+size]
+
+		if field.Nullable {
+			null := nulls[bit/8]&(1<<(bit%8)) != 0
+			bit++
+			if null {
+				offset += size
+				continue
+			}
+		}
+
+		switch field.Type.kind() {
+		case TypeI64:
+			values[i] = int64(binary.LittleEndian.Uint64(raw))
+		case TypeF64:
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(raw))
+		case TypeU64:
+			values[i] = binary.LittleEndian.Uint64(raw)
+		case TypeString:
+			values[i] = string(trimPadding(raw))
+		case TypeBytes:
+			n := int(binary.LittleEndian.Uint16(raw))
+			if n > size-2 {
+				return nil, errors.New("blob length exceeds its field")
+			}
+			values[i] = append([]byte{}, raw[2:2+n]...)
+		case TypeDecimal:
+			values[i] = Decimal{Unscaled: int64(binary.LittleEndian.Uint64(raw)), Scale: field.Type.Scale()}
+		case TypeBool:
+			values[i] = raw[0] != 0
+		case TypeI32:
+			values[i] = int32(binary.LittleEndian.Uint32(raw))
+		case TypeU32:
+			values[i] = binary.LittleEndian.Uint32(raw)
+		case TypeF32:
+			values[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw))
+		case TypeI16:
+			values[i] = int16(binary.LittleEndian.Uint16(raw))
+		case TypeU8:
+			values[i] = raw[0]
+		default:
+			return nil, errors.New("unsupported field type")
+		}
+
+		offset += size
+	}
+
+	return values, nil
+}
+
+// DecodeRecords splits raw query output into records and decodes each of them
+func DecodeRecords(schema []Field, data []byte) ([]Record, error) {
+	recordSize := RecordSize(schema)
+	if recordSize == 0 {
+		return nil, errors.New("invalid schema")
+	}
+	if len(data)%recordSize != 0 {
+		return nil, errors.New("data length is not a multiple of the record size")
+	}
+
+	records := make([]Record, 0, len(data)/recordSize)
+	for offset := 0; offset < len(data); offset += recordSize {
+		values, err := DecodeRecord(schema, data[offset:offset+recordSize])
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, Record{Schema: schema, Values: values})
+	}
+
+	return records, nil
+}
+
+// trimPadding strips the zero padding from a fixed-size string field
+func trimPadding(raw []byte) []byte {
+	if end := bytes.IndexByte(raw, 0); end >= 0 {
+		return raw[:end]
+	}
+	return raw
+}
@@ -0,0 +1,143 @@
+package hocdb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// RecordWriter is an io.Writer appending the stream of raw records written to it
+// to a database, see NewRecordWriter. It is not safe for concurrent use.
+type RecordWriter struct {
+	db      *DB
+	partial []byte // Start of a record split across writes
+	size    int
+	closed  bool
+}
+
+// NewRecordWriter returns a writer appending the records written to it, encoded as
+// Append takes them, so that a stream of records can be copied into the database
+// with io.Copy. Records may be split across writes; Close reports a record left
+// incomplete and flushes the database.
+func (db *DB) NewRecordWriter() *RecordWriter {
+	return &RecordWriter{db: db, size: RecordSize(db.Schema())}
+}
+
+// Write appends the records of p, keeping a trailing partial record for the next
+// write. When an append fails, n counts the bytes of the records appended before.
+func (w *RecordWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("record writer is closed")
+	}
+	n := 0
+	if len(w.partial) > 0 {
+		n = min(w.size-len(w.partial), len(p))
+		w.partial = append(w.partial, p[:n]...)
+		if len(w.partial) < w.size {
+			return n, nil
+		}
+		if err := w.db.Append(w.partial); err != nil {
+			// The record's bytes from p are not written
+			w.partial = w.partial[:len(w.partial)-n]
+			return 0, err
+		}
+		w.partial = w.partial[:0]
+	}
+	for ; len(p)-n >= w.size; n += w.size {
+		if err := w.db.Append(p[n : n+w.size]); err != nil {
+			return n, err
+		}
+	}
+	w.partial = append(w.partial, p[n:]...)
+	return len(p), nil
+}
+
+// Close flushes the database, failing with io.ErrUnexpectedEOF when the stream ended
+// within a record
+func (w *RecordWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if len(w.partial) > 0 {
+		return fmt.Errorf("record writer closed with %d bytes of a %d-byte record: %w", len(w.partial), w.size, io.ErrUnexpectedEOF)
+	}
+	return w.db.Flush()
+}
+
+// RecordReader is an io.Reader of the raw records of a time range of a database,
+// see NewRecordReader. It is not safe for concurrent use.
+type RecordReader struct {
+	db             *DB
+	startTs, endTs int64
+	snap           *snapshot
+	q              queryInfo
+	chunk          []byte // Rest of the current chunk
+	err            error  // Returned once the chunk is read
+}
+
+// NewRecordReader returns a reader of the records of [startTs, endTs) in time order,
+// encoded as Query returns them, so that they can be copied into any io.Writer. It
+// reads the records in chunks like QueryFunc, from a snapshot taken at the first
+// Read, whose segments stay pinned until the reader reaches io.EOF or is closed.
+func (db *DB) NewRecordReader(startTs, endTs int64) *RecordReader {
+	return &RecordReader{db: db, startTs: startTs, endTs: endTs}
+}
+
+// Read reads the next bytes of the records
+func (r *RecordReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.next()
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+// next reads the next chunk, or sets r.err
+func (r *RecordReader) next() {
+	if r.snap == nil {
+		r.q = queryInfo{op: "Query", start: time.Now(), startTs: r.startTs, endTs: r.endTs}
+		snap, err := r.db.pin()
+		if err != nil {
+			r.err = err
+			return
+		}
+		r.snap = snap
+		r.endTs = min64(r.endTs, snap.end)
+	}
+	if r.startTs >= r.endTs {
+		r.q.ok = true
+		r.release(io.EOF)
+		return
+	}
+	chunk, next, err := r.db.queryChunk(r.startTs, r.endTs, nil, r.snap, &r.q)
+	if err != nil {
+		r.release(err)
+		return
+	}
+	r.chunk, r.startTs = chunk, next
+}
+
+// release unpins the snapshot of the reader, which then returns err
+func (r *RecordReader) release(err error) {
+	r.err = err
+	if r.snap != nil {
+		r.db.unpin(r.snap)
+		r.snap = nil
+		r.db.observeQuery(&r.q)
+	}
+}
+
+// Close releases the snapshot of the reader before it reached io.EOF
+func (r *RecordReader) Close() error {
+	if r.err == nil {
+		r.release(errors.New("record reader is closed"))
+	}
+	r.chunk = nil
+	return nil
+}
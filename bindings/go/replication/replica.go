@@ -0,0 +1,223 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hocdb"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTimeout is how long a replica waits for the primary to answer by
+	// default, see Replica.Timeout
+	DefaultTimeout = 3 * time.Second
+
+	// DefaultRetryInterval is how long a replica waits before reconnecting by
+	// default, see Replica.RetryInterval
+	DefaultRetryInterval = time.Second
+)
+
+// RejectedError reports a primary refusing a replica, for an unknown ticker or a
+// different schema. Run returns it instead of reconnecting.
+type RejectedError struct {
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return "rejected by the primary: " + e.Reason
+}
+
+// Status describes the state of a replica
+type Status struct {
+	Connected bool
+	Latest    int64 // Timestamp of the latest record appended, math.MinInt64 before the first
+	Err       error // Why the last connection ended, nil before the first ended
+}
+
+// Replica follows a ticker of a primary, appending its records to a local
+// database
+type Replica struct {
+	// Timeout is how long the replica waits for the primary to connect and send
+	// something, DefaultTimeout when zero. The primary sends heartbeats every
+	// third of it, and drops replicas silent for longer.
+	Timeout time.Duration
+
+	// RetryInterval is how long the replica waits before reconnecting after the
+	// connection ended, DefaultRetryInterval when zero
+	RetryInterval time.Duration
+
+	// OnRotate runs on the replica's goroutine whenever the primary's ring buffer
+	// wrapped around
+	OnRotate func()
+
+	addr   string
+	ticker string
+	db     *hocdb.DB
+
+	mu     sync.Mutex
+	status Status
+}
+
+// NewReplica returns a replica appending the records of a ticker of the primary at
+// addr to db, which needs the same schema and shouldn't be written otherwise. Run
+// starts it.
+func NewReplica(addr, ticker string, db *hocdb.DB) *Replica {
+	return &Replica{addr: addr, ticker: ticker, db: db, status: Status{Latest: math.MinInt64}}
+}
+
+// Status returns the state of the replica
+func (r *Replica) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Run follows the primary until ctx is done, reconnecting whenever the connection
+// ends, and returns ctx.Err(). It returns earlier with a *RejectedError when the
+// primary refuses the replica, and with the error of an append that failed.
+func (r *Replica) Run(ctx context.Context) error {
+	retry := r.RetryInterval
+	if retry <= 0 {
+		retry = DefaultRetryInterval
+	}
+	for {
+		err := r.follow(ctx)
+		r.mu.Lock()
+		r.status.Connected, r.status.Err = false, err
+		r.mu.Unlock()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var rejected *RejectedError
+		var appendErr *appendError
+		if errors.As(err, &rejected) {
+			return err
+		} else if errors.As(err, &appendErr) {
+			return appendErr.err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retry):
+		}
+	}
+}
+
+// appendError marks the failed appends that end Run
+type appendError struct {
+	err error
+}
+
+func (e *appendError) Error() string {
+	return e.err.Error()
+}
+
+// follow connects to the primary and appends the records it sends until the
+// connection ends
+func (r *Replica) follow(ctx context.Context) error {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	schema := r.db.Schema()
+	size := hocdb.RecordSize(schema)
+	tsOffset, err := timestampOffset(schema)
+	if err != nil {
+		return &appendError{err}
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	br, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+
+	// The records after the latest one here are missing
+	latest := int64(math.MinInt64)
+	if l, err := r.db.GetLatestByName("timestamp"); err == nil {
+		latest = l.Timestamp
+	}
+	from := latest
+	if latest != math.MinInt64 {
+		from++
+	}
+	payload, err := json.Marshal(hello{
+		Version:   protocolVersion,
+		Ticker:    r.ticker,
+		Schema:    schema,
+		From:      from,
+		Heartbeat: int64(timeout / 3),
+	})
+	if err != nil {
+		return err
+	}
+	ack := func() error {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], uint64(latest))
+		if err := writeFrame(w, frameAck, buf[:]); err != nil {
+			return err
+		}
+		conn.SetWriteDeadline(time.Now().Add(timeout))
+		return w.Flush()
+	}
+	if err := writeFrame(w, frameHello, payload); err != nil {
+		return err
+	}
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.status.Connected, r.status.Latest = true, latest
+	r.mu.Unlock()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		typ, payload, err := readFrame(br)
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case frameRecords:
+			if len(payload)%size != 0 {
+				return fmt.Errorf("received %d bytes, not a multiple of the record size %d", len(payload), size)
+			}
+			for data := payload; len(data) > 0; data = data[size:] {
+				if err := r.db.Append(data[:size]); err != nil {
+					return &appendError{fmt.Errorf("failed to append a replicated record: %w", err)}
+				}
+				latest = int64(binary.LittleEndian.Uint64(data[tsOffset:]))
+			}
+			r.mu.Lock()
+			r.status.Latest = latest
+			r.mu.Unlock()
+			if err := ack(); err != nil {
+				return err
+			}
+		case frameBeat:
+			if err := ack(); err != nil {
+				return err
+			}
+		case frameRotate:
+			if r.OnRotate != nil {
+				r.OnRotate()
+			}
+		case frameError:
+			return &RejectedError{Reason: string(payload)}
+		default:
+			return fmt.Errorf("unexpected frame %q from the primary", typ)
+		}
+	}
+}
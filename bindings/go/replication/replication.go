@@ -0,0 +1,432 @@
+/*
+Package replication streams the records appended to HOCDB databases from a primary
+to replicas over TCP, for high availability.
+
+A Primary serves the databases added to it. A Replica connects to it, asks for the
+records of a ticker after the latest one its own database holds and appends them
+as they arrive: first the records it missed, then every record the primary appends,
+along with the rotations of the primary's ring buffer. Since timestamps only grow,
+the latest one is the replica's offset: when the connection drops, the replica
+reconnects and catches up from where it stopped, so a replica can also start from
+an empty database or a restored backup.
+
+Example usage:
+
+	// On the primary
+	p := replication.NewPrimary()
+	p.Add("BTC_USD", db)
+	l, _ := net.Listen("tcp", ":7070")
+	go p.Serve(l)
+
+	// On a replica
+	r := replication.NewReplica("primary:7070", "BTC_USD", replicaDB)
+	go r.Run(ctx)
+*/
+package replication
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hocdb"
+	"io"
+	"math"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Frames are a type byte, the length of the payload as a little-endian uint32 and
+// the payload
+const (
+	frameHello   = 'H' // From the replica: the JSON hello
+	frameRecords = 'R' // From the primary: records as stored in the data file
+	frameRotate  = 'W' // From the primary: its ring buffer wrapped around
+	frameBeat    = 'P' // From the primary: nothing new
+	frameAck     = 'A' // From the replica: the timestamp of its latest record
+	frameError   = 'E' // From the primary: why it refused the replica, then it hangs up
+)
+
+const (
+	// protocolVersion is sent in the hello, for future changes of the protocol
+	protocolVersion = 1
+
+	// maxFrame bounds the payload of frames read, against garbage on the wire
+	maxFrame = 64 << 20
+
+	// maxBatch is the payload size records are batched up to
+	maxBatch = 1 << 20
+
+	// helloTimeout is how long a primary waits for the hello of a new connection
+	helloTimeout = 10 * time.Second
+)
+
+// ErrClosed is returned by Serve after Close
+var ErrClosed = errors.New("primary closed")
+
+// hello opens a replication stream
+type hello struct {
+	Version   int           `json:"version"`
+	Ticker    string        `json:"ticker"`
+	Schema    []hocdb.Field `json:"schema"`
+	From      int64         `json:"from"`      // Timestamp of the first record wanted
+	Heartbeat int64         `json:"heartbeat"` // Interval in nanoseconds
+}
+
+// writeFrame writes a frame to w, which the caller flushes
+func writeFrame(w *bufio.Writer, typ byte, payload []byte) error {
+	var header [5]byte
+	header[0] = typ
+	binary.LittleEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readFrame reads a frame from r
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.LittleEndian.Uint32(header[1:])
+	if n > maxFrame {
+		return 0, nil, fmt.Errorf("frame of %d bytes exceeds %d", n, maxFrame)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+// timestampOffset returns the offset of the timestamp within records of schema
+func timestampOffset(schema []hocdb.Field) (int, error) {
+	offset := 0
+	for _, field := range schema {
+		if field.Name == "timestamp" && field.Type == hocdb.TypeI64 {
+			return offset, nil
+		}
+		offset += field.Type.Size()
+	}
+	return 0, errors.New("schema has no i64 timestamp field")
+}
+
+// ReplicaInfo describes a replica connected to a primary
+type ReplicaInfo struct {
+	Ticker string
+	Addr   string // Remote address of the replica
+	Sent   int64  // Timestamp of the last record sent, math.MinInt64 before the first
+	Acked  int64  // Timestamp of the latest record the replica reported appending
+}
+
+// Primary streams the records appended to its databases to the replicas that
+// connect to it
+type Primary struct {
+	mu        sync.Mutex
+	dbs       map[string]*hocdb.DB
+	listeners map[net.Listener]struct{}
+	streams   map[*stream]struct{}
+	closed    bool
+}
+
+// NewPrimary returns a primary without databases
+func NewPrimary() *Primary {
+	return &Primary{
+		dbs:       make(map[string]*hocdb.DB),
+		listeners: make(map[net.Listener]struct{}),
+		streams:   make(map[*stream]struct{}),
+	}
+}
+
+// Add makes a database available to replicas under a ticker name. The primary
+// relays its rotations through OnRotate, so a database should be added once.
+func (p *Primary) Add(name string, db *hocdb.DB) {
+	p.mu.Lock()
+	p.dbs[name] = db
+	p.mu.Unlock()
+	db.OnRotate(func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for s := range p.streams {
+			if s.db == db {
+				s.rotations.Add(1)
+				s.signal()
+			}
+		}
+	})
+}
+
+// Remove stops serving a ticker and disconnects its replicas. The database isn't
+// closed.
+func (p *Primary) Remove(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.dbs, name)
+	for s := range p.streams {
+		if s.ticker == name {
+			s.conn.Close()
+		}
+	}
+}
+
+// Replicas returns the replicas currently connected
+func (p *Primary) Replicas() []ReplicaInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	infos := make([]ReplicaInfo, 0, len(p.streams))
+	for s := range p.streams {
+		infos = append(infos, ReplicaInfo{
+			Ticker: s.ticker,
+			Addr:   s.conn.RemoteAddr().String(),
+			Sent:   s.sent.Load(),
+			Acked:  s.acked.Load(),
+		})
+	}
+	return infos
+}
+
+// Serve accepts replicas on l until it fails or Close is called, which makes it
+// return ErrClosed
+func (p *Primary) Serve(l net.Listener) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	p.listeners[l] = struct{}{}
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.listeners, l)
+		p.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+			if closed {
+				return ErrClosed
+			}
+			return err
+		}
+		go p.serveConn(conn)
+	}
+}
+
+// Close stops the listeners and disconnects the replicas. The databases aren't
+// closed.
+func (p *Primary) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	var err error
+	for l := range p.listeners {
+		if lerr := l.Close(); lerr != nil && err == nil {
+			err = lerr
+		}
+	}
+	for s := range p.streams {
+		s.conn.Close()
+	}
+	return err
+}
+
+// stream sends the records of a database to a replica
+type stream struct {
+	ticker string
+	db     *hocdb.DB
+	conn   net.Conn
+
+	wake      chan struct{}
+	rotations atomic.Int64 // Not yet sent
+	sent      atomic.Int64
+	acked     atomic.Int64
+}
+
+// signal wakes the stream up without blocking
+func (s *stream) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// serveConn runs the stream a replica asks for in its hello
+func (p *Primary) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+
+	conn.SetReadDeadline(time.Now().Add(helloTimeout))
+	typ, payload, err := readFrame(r)
+	if err != nil || typ != frameHello {
+		return
+	}
+	var h hello
+	if err := json.Unmarshal(payload, &h); err != nil {
+		return
+	}
+	s := &stream{ticker: h.Ticker, conn: conn, wake: make(chan struct{}, 1)}
+	s.sent.Store(math.MinInt64)
+	s.acked.Store(max(h.From, math.MinInt64+1) - 1)
+	if s.db, err = p.register(s, h); err != nil {
+		writeFrame(w, frameError, []byte(err.Error()))
+		w.Flush()
+		return
+	}
+	defer func() {
+		p.mu.Lock()
+		delete(p.streams, s)
+		p.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interval := time.Duration(h.Heartbeat)
+	if interval <= 0 {
+		interval = DefaultTimeout / 3
+	}
+	go func() {
+		// A replica that stops acknowledging heartbeats is gone
+		defer cancel()
+		for {
+			conn.SetReadDeadline(time.Now().Add(3 * interval))
+			typ, payload, err := readFrame(r)
+			if err != nil || typ != frameAck || len(payload) != 8 {
+				return
+			}
+			s.acked.Store(int64(binary.LittleEndian.Uint64(payload)))
+		}
+	}()
+	s.run(ctx, w, h.From, interval)
+}
+
+// register checks the hello of a replica and registers its stream, returning the
+// database it follows
+func (p *Primary) register(s *stream, h hello) (*hocdb.DB, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrClosed
+	}
+	if h.Version != protocolVersion {
+		return nil, fmt.Errorf("unsupported protocol version %d", h.Version)
+	}
+	db, ok := p.dbs[h.Ticker]
+	if !ok {
+		return nil, fmt.Errorf("unknown ticker %s", h.Ticker)
+	}
+	if !slices.Equal(db.Schema(), h.Schema) {
+		return nil, fmt.Errorf("schema of %s differs from the primary's", h.Ticker)
+	}
+	p.streams[s] = struct{}{}
+	return db, nil
+}
+
+// run sends the records from the timestamp from on, then the records appended
+// meanwhile and later, until the connection or ctx ends
+func (s *stream) run(ctx context.Context, w *bufio.Writer, from int64, interval time.Duration) error {
+	// Subscribing first, the records appended while catching up are delivered too
+	records, err := s.db.Subscribe(ctx)
+	if err != nil {
+		return err
+	}
+	schema := s.db.Schema()
+	size := hocdb.RecordSize(schema)
+	tsOffset, err := timestampOffset(schema)
+	if err != nil {
+		return err
+	}
+	send := func(data []byte) error {
+		for len(data) > 0 {
+			n := min(len(data), max(maxBatch/size, 1)*size)
+			if err := writeFrame(w, frameRecords, data[:n]); err != nil {
+				return err
+			}
+			data = data[n:]
+		}
+		return nil
+	}
+	flush := func() error {
+		s.conn.SetWriteDeadline(time.Now().Add(3 * interval))
+		return w.Flush()
+	}
+
+	next := from // Timestamp of the first record not sent yet
+	err = s.db.QueryFunc(from, math.MaxInt64, nil, func(data []byte) error {
+		if err := send(data); err != nil {
+			return err
+		}
+		last := int64(binary.LittleEndian.Uint64(data[len(data)-size+tsOffset:]))
+		next = last + 1
+		s.sent.Store(last)
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+
+	beat := time.NewTicker(interval)
+	defer beat.Stop()
+	var batch, buf []byte
+	for {
+		select {
+		case rec, ok := <-records:
+			if !ok {
+				return errors.New("database closed")
+			}
+			// Batch whatever else is queued with it
+			batch = batch[:0]
+		queued:
+			for ok {
+				if ts := rec.Timestamp(); ts >= next {
+					if buf, err = hocdb.EncodeRecordTo(buf, schema, rec.Values...); err != nil {
+						return err
+					}
+					batch = append(batch, buf...)
+					next = ts + 1
+				}
+				if len(batch) >= maxBatch {
+					break
+				}
+				select {
+				case rec, ok = <-records:
+				default:
+					break queued
+				}
+			}
+			if len(batch) == 0 {
+				continue
+			}
+			if err := send(batch); err != nil {
+				return err
+			}
+			s.sent.Store(next - 1)
+		case <-s.wake:
+			for n := s.rotations.Swap(0); n > 0; n-- {
+				if err := writeFrame(w, frameRotate, nil); err != nil {
+					return err
+				}
+			}
+		case <-beat.C:
+			if err := writeFrame(w, frameBeat, nil); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+}
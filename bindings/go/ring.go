@@ -0,0 +1,216 @@
+package hocdb
+
+import (
+	"errors"
+	"os"
+)
+
+// engineBufferSize is the size of the engine's write buffer, whose records aren't
+// in the data file until it fills or is flushed
+const engineBufferSize = 4096
+
+// RingInfo describes the ring buffer of a database opened with OverwriteFull, see
+// DB.RingInfo. Positions are slots, the indexes of records in the data file.
+type RingInfo struct {
+	Capacity int64 // Records the data file holds
+	Records  int64 // Records it holds now, Capacity once full
+	Head     int64 // Slot the next record is written to
+	Tail     int64 // Slot of the oldest record
+	Oldest   int64 // Timestamp of the oldest surviving record, 0 when empty
+	Newest   int64 // Timestamp of the newest record, 0 when empty
+}
+
+// RingInfo returns how much history the ring buffer of a database opened with
+// OverwriteFull retains: its capacity and occupancy, where the next record goes
+// and where the oldest is, and the time range it holds. Like Query, it flushes
+// first.
+func (db *DB) RingInfo() (*RingInfo, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.handle == nil {
+		return nil, errors.New("database not initialized")
+	}
+	if !db.options.OverwriteFull {
+		return nil, errors.New("ring info needs a database opened with OverwriteFull")
+	}
+	if err := db.flush(); err != nil {
+		return nil, err
+	}
+	cursor, _, err := db.ringPosition()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	v, err := db.dataView(f)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(RecordSize(db.schema))
+	info := &RingInfo{
+		Capacity: (db.maxFileSize() - fileHeaderSize) / size,
+		Records:  v.count,
+		Tail:     v.start,
+	}
+	info.Head = (cursor - fileHeaderSize) / size % info.Capacity
+	if v.count > 0 {
+		if info.Oldest, err = v.timestampAt(v.start); err != nil {
+			return nil, err
+		}
+		if info.Newest, err = v.timestampAt((v.start + v.count - 1) % v.count); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// OnEvict registers a callback that runs with every record a full database opened
+// with OverwriteFull overwrites, so evicted history can be archived. It runs after
+// the OnRotate callbacks and before the OnAppend callbacks of the append that
+// overwrote the record. Registering it flushes pending writes to locate the
+// engine's write position; while it is registered, every append to a full ring
+// buffer reads the record it overwrites first.
+func (db *DB) OnEvict(fn func(Record)) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.hookMu.Lock()
+	defer db.hookMu.Unlock()
+	db.hooks.onEvict = append(db.hooks.onEvict, fn)
+
+	if db.handle == nil || !db.options.OverwriteFull || db.hooks.evictAt != 0 {
+		return
+	}
+	if err := db.flush(); err != nil {
+		return
+	}
+	if cursor, full, err := db.ringPosition(); err == nil {
+		db.hooks.evictAt, db.hooks.evictFull = cursor, full
+	}
+}
+
+// ringPosition returns the engine's write position and whether the data file is
+// full, so that the next append overwrites a record or wraps around. Pending
+// writes must have been flushed.
+func (db *DB) ringPosition() (int64, bool, error) {
+	cursor, err := db.writeCursor()
+	if err != nil {
+		return 0, false, err
+	}
+	info, err := os.Stat(db.dataFile())
+	if err != nil {
+		return 0, false, err
+	}
+	return cursor, info.Size() >= db.maxFileSize(), nil
+}
+
+// locateCursors finds the engine's write position again for the rotations and
+// evictions hooks mirror, after the data file was rewritten; db.mu must be held and
+// pending writes flushed
+func (db *DB) locateCursors() {
+	db.hookMu.Lock()
+	defer db.hookMu.Unlock()
+	if db.hooks.cursor != 0 {
+		if cursor, err := db.writeCursor(); err == nil {
+			db.hooks.cursor = cursor
+		}
+	}
+	if db.hooks.evictAt != 0 {
+		db.hooks.evicted = nil
+		if cursor, full, err := db.ringPosition(); err == nil {
+			db.hooks.evictAt, db.hooks.evictFull = cursor, full
+		}
+	}
+}
+
+// evictions holds the records the appends of one engine call overwrite
+type evictions struct {
+	records [][]byte // Record each append overwrites, nil while the ring isn't full
+	ends    []int64  // Write position after each append
+	wrap    int      // Index of the first append that wraps around, -1 if none
+}
+
+// readEvictions reads the records the appends of data, records back to back, will
+// overwrite, when OnEvict needs them; db.mu must be held. The result is nil without
+// OnEvict.
+func (db *DB) readEvictions(data []byte) *evictions {
+	db.hookMu.Lock()
+	at, full := db.hooks.evictAt, db.hooks.evictFull
+	db.hookMu.Unlock()
+	if at == 0 {
+		return nil
+	}
+	size := int64(RecordSize(db.schema))
+	max := db.maxFileSize()
+	capacity := int((max - fileHeaderSize) / size)
+	n := len(data) / int(size)
+	e := &evictions{records: make([][]byte, n), ends: make([]int64, n), wrap: -1}
+	var f *os.File
+	for i := range e.records {
+		if at+size > max {
+			at, full = fileHeaderSize, true
+			if e.wrap < 0 {
+				e.wrap = i
+			}
+		}
+		switch {
+		case i >= capacity:
+			// A batch larger than the ring overwrites its own records
+			e.records[i] = data[(i-capacity)*int(size) : (i-capacity+1)*int(size)]
+		case full:
+			if f == nil {
+				if f = db.openEvictions(); f == nil {
+					break
+				}
+			}
+			rec := make([]byte, size)
+			if _, err := f.ReadAt(rec, at); err != nil {
+				db.logError("failed to read an evicted record", err)
+			} else {
+				e.records[i] = rec
+			}
+		}
+		at += size
+		e.ends[i] = at
+	}
+	if f != nil {
+		f.Close()
+	}
+	return e
+}
+
+// openEvictions opens the data file to read the records appends overwrite;
+// db.mu must be held
+func (db *DB) openEvictions() *os.File {
+	if db.maxFileSize()-fileHeaderSize <= engineBufferSize {
+		// Records to overwrite may still be in the engine's buffer
+		if err := db.flush(); err != nil {
+			db.logError("failed to read an evicted record", err)
+		}
+	}
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		db.logError("failed to read an evicted record", err)
+		return nil
+	}
+	return f
+}
+
+// commitEvictions queues what the first appended of the appends of readEvictions
+// overwrote for noteAppend, which runs the OnEvict callbacks with it; db.mu must
+// be held
+func (db *DB) commitEvictions(e *evictions, appended int) {
+	if e == nil || appended == 0 {
+		return
+	}
+	db.hookMu.Lock()
+	defer db.hookMu.Unlock()
+	db.hooks.evictAt = e.ends[appended-1]
+	if e.wrap >= 0 && e.wrap < appended {
+		db.hooks.evictFull = true
+	}
+	db.hooks.evicted = append(db.hooks.evicted, e.records[:appended]...)
+}
@@ -0,0 +1,476 @@
+package sqldriver
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hocdb"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// predicate is a condition evaluated while scanning
+type predicate struct {
+	index int
+	op    string
+	value interface{}
+}
+
+// run executes a parsed statement with its arguments bound
+func (c *Connector) run(stmt *selectStmt, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) != stmt.numArgs {
+		return nil, fmt.Errorf("hocdb: expected %d arguments, got %d", stmt.numArgs, len(args))
+	}
+
+	c.mu.Lock()
+	schema, ok := c.schemas[stmt.ticker]
+	c.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("hocdb: no schema for ticker %s", stmt.ticker)
+	}
+
+	index := make(map[string]int, len(schema))
+	for i, field := range schema {
+		index[field.Name] = i
+	}
+
+	columns := make([]int, 0, len(schema))
+	if stmt.columns == nil {
+		for i := range schema {
+			columns = append(columns, i)
+		}
+	}
+	for _, name := range stmt.columns {
+		i, ok := lookupColumn(index, name)
+		if !ok {
+			return nil, fmt.Errorf("hocdb: unknown column %s", name)
+		}
+		columns = append(columns, i)
+	}
+
+	startTs, endTs := int64(math.MinInt64), int64(math.MaxInt64)
+	none := false // Set by a timestamp condition no timestamp meets
+	var filters []hocdb.Filter
+	var predicates []predicate
+
+	for _, cond := range stmt.conds {
+		i, ok := lookupColumn(index, cond.column)
+		if !ok {
+			return nil, fmt.Errorf("hocdb: unknown column %s", cond.column)
+		}
+		field := schema[i]
+
+		values := make([]interface{}, len(cond.operands))
+		for j, op := range cond.operands {
+			v := op.value
+			if op.arg >= 0 {
+				v = args[op.arg].Value
+			}
+			converted, err := convertOperand(v, field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("hocdb: column %s: %w", field.Name, err)
+			}
+			values[j] = converted
+		}
+
+		if field.Name == "timestamp" && field.Type == hocdb.TypeI64 {
+			// Narrow the half-open [startTs, endTs) range passed to Query
+			low, high := int64(math.MinInt64), int64(math.MaxInt64)
+			switch cond.op {
+			case "=":
+				low, high = values[0].(int64), values[0].(int64)
+			case ">":
+				if values[0].(int64) == math.MaxInt64 {
+					none = true
+					continue
+				}
+				low = values[0].(int64) + 1
+			case ">=":
+				low = values[0].(int64)
+			case "<":
+				if values[0].(int64) == math.MinInt64 {
+					none = true
+					continue
+				}
+				high = values[0].(int64) - 1
+			case "<=":
+				high = values[0].(int64)
+			case "BETWEEN":
+				low, high = values[0].(int64), values[1].(int64)
+			default:
+				predicates = append(predicates, predicate{index: i, op: cond.op, value: values[0]})
+				continue
+			}
+			if low > startTs {
+				startTs = low
+			}
+			if high < math.MaxInt64 && high+1 < endTs {
+				endTs = high + 1
+			}
+			continue
+		}
+
+		switch cond.op {
+		case "=":
+			filters = append(filters, hocdb.Filter{FieldIndex: i, Value: values[0]})
+		case "BETWEEN":
+			predicates = append(predicates,
+				predicate{index: i, op: ">=", value: values[0]},
+				predicate{index: i, op: "<=", value: values[1]})
+		default:
+			predicates = append(predicates, predicate{index: i, op: cond.op, value: values[0]})
+		}
+	}
+
+	limit := int64(-1)
+	if stmt.limit != nil {
+		v := stmt.limit.value
+		if stmt.limit.arg >= 0 {
+			v = args[stmt.limit.arg].Value
+		}
+		n, ok := v.(int64)
+		if !ok || n < 0 {
+			return nil, errors.New("hocdb: LIMIT must be a non-negative integer")
+		}
+		limit = n
+	}
+
+	var data []byte
+	if startTs < endTs && limit != 0 && !none {
+		var err error
+		data, err = c.query(stmt.ticker, startTs, endTs, filters)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &rows{
+		schema:     schema,
+		columns:    columns,
+		predicates: predicates,
+		data:       data,
+		recordSize: hocdb.RecordSize(schema),
+		limit:      limit,
+	}, nil
+}
+
+// lookupColumn resolves a column name, accepting ts as an alias for timestamp
+func lookupColumn(index map[string]int, name string) (int, bool) {
+	if i, ok := index[name]; ok {
+		return i, true
+	}
+	if strings.EqualFold(name, "ts") {
+		i, ok := index["timestamp"]
+		return i, ok
+	}
+	return 0, false
+}
+
+// wideType returns the 64-bit type whose Go type rows use for a narrow type
+func wideType(t hocdb.FieldType) hocdb.FieldType {
+	switch t {
+	case hocdb.TypeI32, hocdb.TypeI16:
+		return hocdb.TypeI64
+	case hocdb.TypeU32, hocdb.TypeU8:
+		return hocdb.TypeU64
+	case hocdb.TypeF32:
+		return hocdb.TypeF64
+	default:
+		if t.IsString() {
+			return hocdb.TypeString
+		}
+		if t.IsBytes() {
+			return hocdb.TypeBytes
+		}
+		return t
+	}
+}
+
+// widenValue converts a decoded value of a narrow type to its wide type
+func widenValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int32:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case uint32:
+		return uint64(v)
+	case uint8:
+		return uint64(v)
+	case float32:
+		return float64(v)
+	default:
+		return v
+	}
+}
+
+// convertOperand converts a literal or argument into the Go type of a field, the
+// wide one for narrow types
+func convertOperand(v interface{}, t hocdb.FieldType) (interface{}, error) {
+	if wide := wideType(t); wide != t {
+		converted, err := convertOperand(v, wide)
+		if f, ok := converted.(float64); ok {
+			// Compare with the stored precision
+			converted = float64(float32(f))
+		}
+		return converted, err
+	}
+	if t.IsDecimal() {
+		switch val := v.(type) {
+		case int64, float64, string:
+			if d, err := hocdb.ParseValue(t, fmt.Sprint(val)); err == nil {
+				return d, nil
+			}
+		}
+		return nil, fmt.Errorf("cannot compare %s with %v", t, v)
+	}
+
+	switch t {
+	case hocdb.TypeI64:
+		switch val := v.(type) {
+		case int64:
+			return val, nil
+		case float64:
+			if val == math.Trunc(val) && val >= math.MinInt64 && val < math.MaxInt64 {
+				return int64(val), nil
+			}
+		}
+	case hocdb.TypeU64:
+		switch val := v.(type) {
+		case int64:
+			if val >= 0 {
+				return uint64(val), nil
+			}
+		case uint64:
+			return val, nil
+		}
+	case hocdb.TypeF64:
+		switch val := v.(type) {
+		case float64:
+			return val, nil
+		case int64:
+			return float64(val), nil
+		}
+	case hocdb.TypeString:
+		switch val := v.(type) {
+		case string:
+			return val, nil
+		case []byte:
+			return string(val), nil
+		}
+	case hocdb.TypeBytes:
+		switch val := v.(type) {
+		case []byte:
+			return val, nil
+		case string:
+			return []byte(val), nil
+		}
+	case hocdb.TypeBool:
+		switch val := v.(type) {
+		case bool:
+			return val, nil
+		case int64:
+			if val == 0 || val == 1 {
+				return val == 1, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("cannot compare %s with %v", t, v)
+}
+
+// compare returns -1, 0 or 1 comparing two values of the same field type
+func compare(a, b interface{}) int {
+	switch x := a.(type) {
+	case int64:
+		y := b.(int64)
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+	case uint64:
+		y := b.(uint64)
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+	case float64:
+		y := b.(float64)
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+	case string:
+		return strings.Compare(x, b.(string))
+	case []byte:
+		return bytes.Compare(x, b.([]byte))
+	case hocdb.Decimal:
+		// Of the same field, so of the same scale
+		y := b.(hocdb.Decimal)
+		if x.Unscaled < y.Unscaled {
+			return -1
+		} else if x.Unscaled > y.Unscaled {
+			return 1
+		}
+	case bool:
+		y := b.(bool)
+		if !x && y {
+			return -1
+		} else if x && !y {
+			return 1
+		}
+	}
+	return 0
+}
+
+func (p predicate) matches(values []interface{}) bool {
+	if values[p.index] == nil {
+		// Like SQL, no comparison with NULL holds
+		return false
+	}
+	c := compare(values[p.index], p.value)
+	switch p.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+// rows decodes query output one record at a time
+type rows struct {
+	schema     []hocdb.Field
+	columns    []int
+	predicates []predicate
+	data       []byte
+	recordSize int
+	offset     int
+	limit      int64 // -1 for no limit
+}
+
+func (r *rows) Columns() []string {
+	names := make([]string, len(r.columns))
+	for i, c := range r.columns {
+		names[i] = r.schema[c].Name
+	}
+	return names
+}
+
+func (r *rows) Close() error {
+	r.data = nil
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	for r.limit != 0 && r.offset+r.recordSize <= len(r.data) {
+		values, err := hocdb.DecodeRecord(r.schema, r.data[r.offset:r.offset+r.recordSize])
+		if err != nil {
+			return err
+		}
+		r.offset += r.recordSize
+		for i, v := range values {
+			values[i] = widenValue(v)
+		}
+
+		if !r.match(values) {
+			continue
+		}
+		for i, c := range r.columns {
+			dest[i] = values[c]
+			if d, ok := values[c].(hocdb.Decimal); ok {
+				// Exact, unlike float64
+				dest[i] = d.String()
+			}
+		}
+		if r.limit > 0 {
+			r.limit--
+		}
+		return nil
+	}
+	return io.EOF
+}
+
+func (r *rows) match(values []interface{}) bool {
+	for _, p := range r.predicates {
+		if !p.matches(values) {
+			return false
+		}
+	}
+	return true
+}
+
+// ColumnTypeDatabaseTypeName returns the engine type name, e.g. "I64"
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	return strings.ToUpper(r.schema[r.columns[index]].Type.String())
+}
+
+// ColumnTypeNullable reports whether the column is of a nullable field
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return r.schema[r.columns[index]].Nullable, true
+}
+
+// ColumnTypeScanType returns the Go type values of the column are scanned as, the
+// sql.Null type for those of nullable fields
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	field := r.schema[r.columns[index]]
+	if field.Nullable {
+		return nullScanType(field.Type)
+	}
+	switch wideType(field.Type) {
+	case hocdb.TypeI64:
+		return reflect.TypeOf(int64(0))
+	case hocdb.TypeU64:
+		return reflect.TypeOf(uint64(0))
+	case hocdb.TypeF64:
+		return reflect.TypeOf(float64(0))
+	case hocdb.TypeString:
+		return reflect.TypeOf("")
+	case hocdb.TypeBytes:
+		return reflect.TypeOf([]byte(nil))
+	default:
+		if r.schema[r.columns[index]].Type.IsDecimal() {
+			return reflect.TypeOf("")
+		}
+		return reflect.TypeOf(false)
+	}
+}
+
+// nullScanType returns the Go type the values of a nullable field are scanned as;
+// database/sql has no NullUint64, so unsigned values scan into a *uint64
+func nullScanType(t hocdb.FieldType) reflect.Type {
+	switch wideType(t) {
+	case hocdb.TypeI64:
+		return reflect.TypeOf(sql.NullInt64{})
+	case hocdb.TypeU64:
+		return reflect.TypeOf((*uint64)(nil))
+	case hocdb.TypeF64:
+		return reflect.TypeOf(sql.NullFloat64{})
+	case hocdb.TypeBytes:
+		return reflect.TypeOf([]byte(nil))
+	case hocdb.TypeBool:
+		return reflect.TypeOf(sql.NullBool{})
+	default:
+		// Strings and decimals, which are scanned as strings
+		return reflect.TypeOf(sql.NullString{})
+	}
+}
+
+var (
+	_ driver.RowsColumnTypeDatabaseTypeName = (*rows)(nil)
+	_ driver.RowsColumnTypeNullable         = (*rows)(nil)
+	_ driver.RowsColumnTypeScanType         = (*rows)(nil)
+)
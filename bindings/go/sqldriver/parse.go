@@ -0,0 +1,318 @@
+package sqldriver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// selectStmt is a parsed query of the form
+//
+//	SELECT <* | column, ...> FROM <ticker> [WHERE <condition> [AND <condition>]...] [LIMIT <n>]
+type selectStmt struct {
+	columns []string // nil selects every field
+	ticker  string
+	conds   []condition
+	limit   *operand
+	numArgs int
+}
+
+// condition compares a column with one operand, or two for BETWEEN
+type condition struct {
+	column   string
+	op       string // =, !=, <, <=, >, >= or BETWEEN
+	operands []operand
+}
+
+// operand is either a literal or a ? placeholder
+type operand struct {
+	value interface{} // int64, float64, string or bool
+	arg   int         // Index of the placeholder, -1 for literals
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokKeyword
+	tokNumber
+	tokString
+	tokSymbol
+	tokPlaceholder
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+var keywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "AND": true,
+	"BETWEEN": true, "LIMIT": true, "TRUE": true, "FALSE": true,
+}
+
+// tokenize splits a query into tokens. Keywords are case-insensitive, identifiers
+// may be double-quoted and strings are single-quoted, with a doubled quote
+// standing for a literal one.
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(query) && isIdentPart(query[j]) {
+				j++
+			}
+			word := query[i:j]
+			if keywords[strings.ToUpper(word)] {
+				tokens = append(tokens, token{tokKeyword, strings.ToUpper(word)})
+			} else {
+				tokens = append(tokens, token{tokIdent, word})
+			}
+			i = j
+		case c >= '0' && c <= '9' || c == '-' || c == '.':
+			j := i + 1
+			for j < len(query) && (isIdentPart(query[j]) || query[j] == '.' ||
+				(query[j] == '-' || query[j] == '+') && (query[j-1] == 'e' || query[j-1] == 'E')) {
+				j++
+			}
+			tokens = append(tokens, token{tokNumber, query[i:j]})
+			i = j
+		case c == '\'' || c == '"':
+			var b strings.Builder
+			j := i + 1
+			for {
+				if j >= len(query) {
+					return nil, errors.New("unterminated quoted text")
+				}
+				if query[j] == c {
+					if j+1 < len(query) && query[j+1] == c {
+						b.WriteByte(c)
+						j += 2
+						continue
+					}
+					break
+				}
+				b.WriteByte(query[j])
+				j++
+			}
+			kind := tokString
+			if c == '"' {
+				kind = tokIdent
+			}
+			tokens = append(tokens, token{kind, b.String()})
+			i = j + 1
+		case c == '?':
+			tokens = append(tokens, token{tokPlaceholder, "?"})
+			i++
+		case c == '!' || c == '<' || c == '>':
+			if i+1 < len(query) && (query[i+1] == '=' || c == '<' && query[i+1] == '>') {
+				op := query[i : i+2]
+				if op == "<>" {
+					op = "!="
+				}
+				tokens = append(tokens, token{tokSymbol, op})
+				i += 2
+			} else if c == '!' {
+				return nil, errors.New("unexpected character '!'")
+			} else {
+				tokens = append(tokens, token{tokSymbol, string(c)})
+				i++
+			}
+		case c == '=' || c == ',' || c == '*' || c == ';':
+			tokens = append(tokens, token{tokSymbol, string(c)})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	args   int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(kind tokenKind, text string) bool {
+	if t := p.peek(); t.kind == kind && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	if !p.accept(kind, text) {
+		return fmt.Errorf("expected %s, found %s", text, describe(p.peek()))
+	}
+	return nil
+}
+
+func (p *parser) ident() (string, error) {
+	t := p.next()
+	if t.kind != tokIdent {
+		return "", fmt.Errorf("expected identifier, found %s", describe(t))
+	}
+	return t.text, nil
+}
+
+func (p *parser) operand() (operand, error) {
+	t := p.next()
+	switch t.kind {
+	case tokPlaceholder:
+		p.args++
+		return operand{arg: p.args - 1}, nil
+	case tokString:
+		return operand{value: t.text, arg: -1}, nil
+	case tokKeyword:
+		if t.text == "TRUE" || t.text == "FALSE" {
+			return operand{value: t.text == "TRUE", arg: -1}, nil
+		}
+	case tokNumber:
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return operand{value: i, arg: -1}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return operand{}, fmt.Errorf("invalid number %s", t.text)
+		}
+		return operand{value: f, arg: -1}, nil
+	}
+	return operand{}, fmt.Errorf("expected value, found %s", describe(t))
+}
+
+// parse parses a SELECT statement
+func parse(query string) (*selectStmt, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	stmt := &selectStmt{}
+
+	if err := p.expect(tokKeyword, "SELECT"); err != nil {
+		return nil, errors.New("only SELECT statements are supported")
+	}
+	if !p.accept(tokSymbol, "*") {
+		for {
+			column, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			stmt.columns = append(stmt.columns, column)
+			if !p.accept(tokSymbol, ",") {
+				break
+			}
+		}
+	}
+
+	if err := p.expect(tokKeyword, "FROM"); err != nil {
+		return nil, err
+	}
+	if stmt.ticker, err = p.ident(); err != nil {
+		return nil, err
+	}
+
+	if p.accept(tokKeyword, "WHERE") {
+		for {
+			cond, err := p.condition()
+			if err != nil {
+				return nil, err
+			}
+			stmt.conds = append(stmt.conds, cond)
+			if !p.accept(tokKeyword, "AND") {
+				break
+			}
+		}
+	}
+
+	if p.accept(tokKeyword, "LIMIT") {
+		limit, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		stmt.limit = &limit
+	}
+
+	p.accept(tokSymbol, ";")
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s", describe(t))
+	}
+
+	stmt.numArgs = p.args
+	return stmt, nil
+}
+
+func (p *parser) condition() (condition, error) {
+	column, err := p.ident()
+	if err != nil {
+		return condition{}, err
+	}
+
+	if p.accept(tokKeyword, "BETWEEN") {
+		low, err := p.operand()
+		if err != nil {
+			return condition{}, err
+		}
+		if err := p.expect(tokKeyword, "AND"); err != nil {
+			return condition{}, err
+		}
+		high, err := p.operand()
+		if err != nil {
+			return condition{}, err
+		}
+		return condition{column: column, op: "BETWEEN", operands: []operand{low, high}}, nil
+	}
+
+	t := p.next()
+	switch t.text {
+	case "=", "!=", "<", "<=", ">", ">=":
+		if t.kind != tokSymbol {
+			break
+		}
+		value, err := p.operand()
+		if err != nil {
+			return condition{}, err
+		}
+		return condition{column: column, op: t.text, operands: []operand{value}}, nil
+	}
+	return condition{}, fmt.Errorf("expected comparison, found %s", describe(t))
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokString:
+		return strconv.Quote(t.text)
+	default:
+		return t.text
+	}
+}
@@ -0,0 +1,226 @@
+/*
+Package sqldriver is a read-only database/sql driver for HOCDB, registered as "hocdb".
+
+It understands a minimal SQL dialect:
+
+	SELECT <* | field, ...> FROM <ticker>
+	    [WHERE <condition> [AND <condition>]...]
+	    [LIMIT <n>]
+
+where a condition compares a field with a literal or a ? placeholder using =, !=,
+<>, <, <=, >, >= or BETWEEN ... AND ... (inclusive). Conditions on the timestamp
+field (also reachable as ts) select the time range, equality on other fields is
+pushed down to the engine's filters and the remaining comparisons are evaluated
+while scanning. Ticker names that aren't plain identifiers can be double-quoted.
+
+HOCDB files don't record their schema, so every ticker's schema is part of the data
+source name, given as a query parameter per ticker:
+
+	db, err := sql.Open("hocdb", "./data?BTC_USD=timestamp:i64,price:f64,volume:f64")
+	if err != nil {
+	    panic(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT timestamp, price FROM BTC_USD WHERE ts BETWEEN ? AND ?", start, end)
+
+NewConnector configures the same from Go values for use with sql.OpenDB. Tickers are
+opened on first use and shared by every connection of the sql.DB, and stay open
+until it is closed. They must not be opened elsewhere in the same process, since
+the engine holds an exclusive lock on each open ticker.
+*/
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hocdb"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+func init() {
+	sql.Register("hocdb", &Driver{})
+}
+
+// Driver implements driver.Driver and driver.DriverContext
+type Driver struct{}
+
+// Open opens a standalone connection. sql.DB uses OpenConnector instead, which lets
+// connections share open tickers.
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{connector: c.(*Connector), owner: true}, nil
+}
+
+// OpenConnector parses a data source name of the form
+// path?ticker=field:type,field:type&ticker=...
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	path, query := dsn, ""
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		path, query = dsn[:i], dsn[i+1:]
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data source name: %w", err)
+	}
+
+	schemas := make(map[string][]hocdb.Field, len(params))
+	for ticker, specs := range params {
+		schema, err := hocdb.ParseSchema(specs[len(specs)-1])
+		if err != nil {
+			return nil, fmt.Errorf("schema for %s: %w", ticker, err)
+		}
+		schemas[ticker] = schema
+	}
+
+	return NewConnector(path, schemas, hocdb.Options{}), nil
+}
+
+// Connector opens tickers under a directory with known schemas. It implements
+// driver.Connector and io.Closer; sql.DB.Close closes every ticker it opened.
+type Connector struct {
+	mu      sync.Mutex
+	path    string
+	schemas map[string][]hocdb.Field
+	options hocdb.Options
+	dbs     map[string]*hocdb.DB
+}
+
+// NewConnector returns a connector for use with sql.OpenDB
+func NewConnector(path string, schemas map[string][]hocdb.Field, options hocdb.Options) *Connector {
+	return &Connector{
+		path:    path,
+		schemas: schemas,
+		options: options,
+		dbs:     make(map[string]*hocdb.DB),
+	}
+}
+
+// Connect returns a connection sharing the connector's tickers
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &conn{connector: c}, nil
+}
+
+// Driver returns the hocdb driver
+func (c *Connector) Driver() driver.Driver {
+	return &Driver{}
+}
+
+// Close closes every ticker opened through the connector
+func (c *Connector) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, db := range c.dbs {
+		db.Close()
+		delete(c.dbs, name)
+	}
+	return nil
+}
+
+// query opens the ticker if needed and runs Query while holding the connector lock
+func (c *Connector) query(ticker string, startTs, endTs int64, filters []hocdb.Filter) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	db, ok := c.dbs[ticker]
+	if !ok {
+		schema, ok := c.schemas[ticker]
+		if !ok {
+			return nil, fmt.Errorf("no schema for ticker %s", ticker)
+		}
+		var err error
+		db, err = hocdb.New(ticker, c.path, schema, c.options)
+		if err != nil {
+			return nil, err
+		}
+		c.dbs[ticker] = db
+	}
+
+	if len(filters) == 0 {
+		return db.Query(startTs, endTs, nil)
+	}
+	return db.Query(startTs, endTs, filters)
+}
+
+var errReadOnly = errors.New("hocdb: the SQL driver is read-only")
+
+// conn is a connection; all state lives in the connector
+type conn struct {
+	connector *Connector
+	owner     bool // Close the connector with the connection when opened by Driver.Open
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("hocdb: %w", err)
+	}
+	return &statement{conn: c, stmt: stmt}, nil
+}
+
+func (c *conn) Close() error {
+	if c.owner {
+		return c.connector.Close()
+	}
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, errReadOnly
+}
+
+// QueryContext runs a query without a separate prepare step
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	stmt, err := parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("hocdb: %w", err)
+	}
+	return c.connector.run(stmt, args)
+}
+
+// statement is a prepared statement
+type statement struct {
+	conn *conn
+	stmt *selectStmt
+}
+
+func (s *statement) Close() error {
+	return nil
+}
+
+func (s *statement) NumInput() int {
+	return s.stmt.numArgs
+}
+
+func (s *statement) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errReadOnly
+}
+
+func (s *statement) Query(args []driver.Value) (driver.Rows, error) {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return s.conn.connector.run(s.stmt, named)
+}
+
+func (s *statement) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.connector.run(s.stmt, args)
+}
+
+var (
+	_ driver.DriverContext    = (*Driver)(nil)
+	_ driver.QueryerContext   = (*conn)(nil)
+	_ driver.StmtQueryContext = (*statement)(nil)
+	_ io.Closer               = (*Connector)(nil)
+)
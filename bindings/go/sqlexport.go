@@ -0,0 +1,381 @@
+package hocdb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqlDialect is a database ExportSQL copies records into
+type sqlDialect int
+
+const (
+	sqlClickHouse sqlDialect = iota
+	sqlPostgres
+)
+
+// sqlDrivers are the database/sql drivers of each dialect, in order of preference
+var sqlDrivers = map[sqlDialect][]string{
+	sqlClickHouse: {"clickhouse"},
+	sqlPostgres:   {"pgx", "postgres"},
+}
+
+// sqlDriverPackages are the packages registering the drivers, for the error when
+// none is
+var sqlDriverPackages = map[sqlDialect]string{
+	sqlClickHouse: "github.com/ClickHouse/clickhouse-go/v2",
+	sqlPostgres:   "github.com/jackc/pgx/v5/stdlib or github.com/lib/pq",
+}
+
+const (
+	// sqlBatchRows is the number of records ClickHouse receives per insert batch
+	sqlBatchRows = 100000
+	// sqlMaxParams is the most placeholders a Postgres statement may hold
+	sqlMaxParams = 65535
+	// sqlInsertRows caps the records of a Postgres insert statement
+	sqlInsertRows = 1000
+)
+
+// ExportSQL copies all records in [startTs, endTs) into table of the ClickHouse or
+// Postgres database of dsn, for ad-hoc SQL analytics. The scheme of dsn picks the
+// database: clickhouse:// or postgres:// (postgresql://). The database/sql driver
+// must be registered by importing it, github.com/ClickHouse/clickhouse-go/v2 for
+// ClickHouse and github.com/jackc/pgx/v5/stdlib or github.com/lib/pq for Postgres.
+//
+// The table is created from the schema when it doesn't exist, see SQLTableDDL. On
+// Postgres with the TimescaleDB extension it is made a hypertable on the
+// timestamp. Postgres receives the records in one transaction, ClickHouse in
+// batches of 100000. With MaxResultMemory, the range is read in chunks, see
+// QueryFunc.
+func (db *DB) ExportSQL(dsn, table string, startTs, endTs int64) error {
+	if !db.isOpen() {
+		return errors.New("database not initialized")
+	}
+	dialect, err := parseSQLDSN(dsn)
+	if err != nil {
+		return err
+	}
+	driver, err := sqlDriver(dialect)
+	if err != nil {
+		return err
+	}
+	schema, _ := db.layout()
+	ddl, err := sqlTableDDL(dialect, table, schema, db.TimestampPrecision())
+	if err != nil {
+		return err
+	}
+
+	conn, err := sql.Open(driver, dsn)
+	if err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Exec(ddl); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", table, err)
+	}
+
+	if dialect == sqlClickHouse {
+		return db.exportClickHouse(conn, schema, table, startTs, endTs)
+	}
+	if err := createHypertable(conn, table); err != nil {
+		return err
+	}
+	return db.exportPostgres(conn, schema, table, startTs, endTs)
+}
+
+// SQLTableDDL returns the CREATE TABLE IF NOT EXISTS statement ExportSQL runs for
+// a schema, for the database of dsn. The timestamp becomes a DateTime64 in UTC at
+// the precision of the timestamps on ClickHouse, ordering a MergeTree table, and a
+// TIMESTAMPTZ on Postgres, which keeps microseconds. Integers, floats and bools map
+// to their types of the same width, u64 to NUMERIC(20) on Postgres, strings to
+// String or TEXT, bytes to String or BYTEA and decimals to decimals of their
+// scale. Fields that aren't nullable are NOT NULL.
+func SQLTableDDL(dsn, table string, schema []Field, precision time.Duration) (string, error) {
+	dialect, err := parseSQLDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+	if precision == 0 {
+		precision = time.Nanosecond
+	}
+	if err := checkPrecision(precision); err != nil {
+		return "", err
+	}
+	return sqlTableDDL(dialect, table, schema, precision)
+}
+
+// parseSQLDSN returns the dialect of the scheme of dsn
+func parseSQLDSN(dsn string) (sqlDialect, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return 0, fmt.Errorf("invalid DSN: %w", err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "clickhouse":
+		return sqlClickHouse, nil
+	case "postgres", "postgresql":
+		return sqlPostgres, nil
+	}
+	return 0, fmt.Errorf("unsupported DSN scheme %q, expected clickhouse or postgres", u.Scheme)
+}
+
+// sqlDriver returns the first registered driver of a dialect
+func sqlDriver(dialect sqlDialect) (string, error) {
+	registered := make(map[string]bool)
+	for _, name := range sql.Drivers() {
+		registered[name] = true
+	}
+	for _, name := range sqlDrivers[dialect] {
+		if registered[name] {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no database/sql driver %s registered, import %s",
+		strings.Join(sqlDrivers[dialect], " or "), sqlDriverPackages[dialect])
+}
+
+// quoteIdent quotes an identifier, with dots separating a database or schema from
+// a table
+func quoteIdent(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, ".")
+}
+
+func sqlTableDDL(dialect sqlDialect, table string, schema []Field, precision time.Duration) (string, error) {
+	if table == "" {
+		return "", errors.New("export needs a table name")
+	}
+	columns := make([]string, len(schema))
+	for i, field := range schema {
+		typ, err := sqlColumnType(dialect, field, precision)
+		if err != nil {
+			return "", err
+		}
+		columns[i] = quoteIdent(field.Name) + " " + typ
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE TABLE IF NOT EXISTS %s (\n\t%s\n)", quoteIdent(table), strings.Join(columns, ",\n\t"))
+	if dialect == sqlClickHouse {
+		b.WriteString(" ENGINE = MergeTree ORDER BY ")
+		if _, ok := timestampOffset(schema); ok {
+			b.WriteString(quoteIdent("timestamp"))
+		} else {
+			b.WriteString("tuple()")
+		}
+	}
+	return b.String(), nil
+}
+
+// sqlColumnType returns the column type of a field, see SQLTableDDL
+func sqlColumnType(dialect sqlDialect, field Field, precision time.Duration) (string, error) {
+	var typ string
+	t := field.Type
+	switch {
+	case t == TypeI64 && field.Name == "timestamp":
+		if dialect == sqlClickHouse {
+			digits := map[time.Duration]int{time.Second: 0, time.Millisecond: 3, time.Microsecond: 6, time.Nanosecond: 9}[precision]
+			typ = fmt.Sprintf("DateTime64(%d, 'UTC')", digits)
+		} else {
+			typ = "TIMESTAMPTZ"
+		}
+	case t.IsString():
+		typ = sqlTypeName(dialect, "String", "TEXT")
+	case t.IsBytes():
+		typ = sqlTypeName(dialect, "String", "BYTEA")
+	case t.IsDecimal():
+		typ = fmt.Sprintf("%s(19, %d)", sqlTypeName(dialect, "Decimal", "NUMERIC"), t.Scale())
+	case t == TypeI64:
+		typ = sqlTypeName(dialect, "Int64", "BIGINT")
+	case t == TypeU64:
+		typ = sqlTypeName(dialect, "UInt64", "NUMERIC(20)")
+	case t == TypeI32:
+		typ = sqlTypeName(dialect, "Int32", "INTEGER")
+	case t == TypeU32:
+		typ = sqlTypeName(dialect, "UInt32", "BIGINT")
+	case t == TypeI16:
+		typ = sqlTypeName(dialect, "Int16", "SMALLINT")
+	case t == TypeU8:
+		typ = sqlTypeName(dialect, "UInt8", "SMALLINT")
+	case t == TypeF64:
+		typ = sqlTypeName(dialect, "Float64", "DOUBLE PRECISION")
+	case t == TypeF32:
+		typ = sqlTypeName(dialect, "Float32", "REAL")
+	case t == TypeBool:
+		typ = sqlTypeName(dialect, "Bool", "BOOLEAN")
+	default:
+		return "", fmt.Errorf("field %s: unsupported type %v", field.Name, t)
+	}
+
+	switch {
+	case dialect == sqlClickHouse && field.Nullable:
+		return "Nullable(" + typ + ")", nil
+	case dialect == sqlPostgres && !field.Nullable:
+		return typ + " NOT NULL", nil
+	}
+	return typ, nil
+}
+
+func sqlTypeName(dialect sqlDialect, clickHouse, postgres string) string {
+	if dialect == sqlClickHouse {
+		return clickHouse
+	}
+	return postgres
+}
+
+// createHypertable makes a Postgres table a hypertable on its timestamp when the
+// TimescaleDB extension is installed
+func createHypertable(conn *sql.DB, table string) error {
+	var timescale bool
+	err := conn.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')").Scan(&timescale)
+	if err != nil {
+		return fmt.Errorf("failed to look for TimescaleDB: %w", err)
+	}
+	if !timescale {
+		return nil
+	}
+	_, err = conn.Exec("SELECT create_hypertable($1::regclass, 'timestamp', if_not_exists => TRUE, migrate_data => TRUE)", quoteIdent(table))
+	if err != nil {
+		return fmt.Errorf("failed to create hypertable %s: %w", table, err)
+	}
+	return nil
+}
+
+// sqlColumns returns the quoted column list of a schema
+func sqlColumns(schema []Field) string {
+	names := make([]string, len(schema))
+	for i, field := range schema {
+		names[i] = quoteIdent(field.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// sqlValues appends the values of a record as arguments for a dialect's driver
+func (db *DB) sqlValues(dialect sqlDialect, schema []Field, args []interface{}, record []byte) ([]interface{}, error) {
+	values, err := DecodeRecord(schema, record)
+	if err != nil {
+		return nil, err
+	}
+	for i, field := range schema {
+		v := values[i]
+		switch x := v.(type) {
+		case int64:
+			if field.Name == "timestamp" {
+				v = db.Time(x)
+			}
+		case uint64:
+			if dialect == sqlPostgres {
+				// database/sql has no conversion for the u64 beyond int64
+				v = strconv.FormatUint(x, 10)
+			}
+		case []byte:
+			if dialect == sqlClickHouse {
+				v = string(x)
+			}
+		case Decimal:
+			v = x.String()
+		}
+		args = append(args, v)
+	}
+	return args, nil
+}
+
+// exportClickHouse inserts records in batches, a prepared INSERT in a transaction
+// being how clickhouse-go sends a block of rows
+func (db *DB) exportClickHouse(conn *sql.DB, schema []Field, table string, startTs, endTs int64) error {
+	recordSize := RecordSize(schema)
+	insert := fmt.Sprintf("INSERT INTO %s (%s)", quoteIdent(table), sqlColumns(schema))
+	args := make([]interface{}, 0, len(schema))
+	return db.queryEach(startTs, endTs, nil, func(data []byte) error {
+		for len(data) > 0 {
+			n := min(len(data), sqlBatchRows*recordSize)
+			tx, err := conn.Begin()
+			if err != nil {
+				return fmt.Errorf("export failed: %w", err)
+			}
+			stmt, err := tx.Prepare(insert)
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("export failed: %w", err)
+			}
+			for offset := 0; offset+recordSize <= n; offset += recordSize {
+				if args, err = db.sqlValues(sqlClickHouse, schema, args[:0], data[offset:offset+recordSize]); err == nil {
+					_, err = stmt.Exec(args...)
+				}
+				if err != nil {
+					tx.Rollback()
+					return fmt.Errorf("export failed: %w", err)
+				}
+			}
+			if err := tx.Commit(); err != nil {
+				return fmt.Errorf("export failed: %w", err)
+			}
+			data = data[n:]
+		}
+		return nil
+	})
+}
+
+// exportPostgres inserts records with multi-row INSERTs in one transaction
+func (db *DB) exportPostgres(conn *sql.DB, schema []Field, table string, startTs, endTs int64) error {
+	recordSize := RecordSize(schema)
+	rows := min(sqlInsertRows, sqlMaxParams/len(schema))
+	tx, err := conn.Begin()
+	if err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+
+	args := make([]interface{}, 0, rows*len(schema))
+	insert := func(n int) error {
+		var b strings.Builder
+		fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES ", quoteIdent(table), sqlColumns(schema))
+		for row := 0; row < n; row++ {
+			if row > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteByte('(')
+			for i := range schema {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				fmt.Fprintf(&b, "$%d", row*len(schema)+i+1)
+			}
+			b.WriteByte(')')
+		}
+		_, err := tx.Exec(b.String(), args...)
+		args = args[:0]
+		return err
+	}
+	err = db.queryEach(startTs, endTs, nil, func(data []byte) error {
+		for offset := 0; offset+recordSize <= len(data); offset += recordSize {
+			var err error
+			if args, err = db.sqlValues(sqlPostgres, schema, args, data[offset:offset+recordSize]); err != nil {
+				return err
+			}
+			if len(args) == rows*len(schema) {
+				if err := insert(rows); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err == nil && len(args) > 0 {
+		err = insert(len(args) / len(schema))
+	}
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("export failed: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,395 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Mem is an in-memory Store for tests. It lays records out like HOCDB, so records
+// built with hocdb.CreateRecordBytes can be appended and Query results decoded with
+// hocdb.DecodeRecords, and follows the engine's rules: timestamps must increase,
+// stats treat strings as 0 and skip nulls, and filters match by equality, with nil
+// matching nulls and decimals matching their unscaled value. It doesn't persist
+// anything. Mem is safe for concurrent use.
+type Mem struct {
+	mu       sync.Mutex
+	fields   []memField
+	size     int
+	tsOffset int
+	data     []byte
+	closed   bool
+}
+
+// memField is the layout of a field of a Mem record
+type memField struct {
+	name     string
+	kind     string // Type name without width, capacity or scale
+	offset   int
+	size     int
+	nullable bool
+	nullOff  int // Byte of the null bit of nullable fields
+	nullMask byte
+}
+
+// NewMem returns an empty Mem for the schema written as for hocdb.ParseSchema, for
+// example "timestamp:i64,price:f64,side:string(8),fee:f64?"
+func NewMem(schema string) (*Mem, error) {
+	m := &Mem{tsOffset: -1}
+	nullable := 0
+	for _, part := range strings.Split(schema, ",") {
+		name, typeName, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid field %q", part)
+		}
+		typeName, null := strings.CutSuffix(typeName, "?")
+		kind, size, err := fieldLayout(typeName)
+		if err != nil {
+			return nil, err
+		}
+		if name == "timestamp" && kind == "i64" && !null {
+			m.tsOffset = m.size
+		}
+		f := memField{name: name, kind: kind, offset: m.size, size: size, nullable: null}
+		if null {
+			f.nullOff, f.nullMask = nullable/8, 1<<(nullable%8)
+			nullable++
+		}
+		m.fields = append(m.fields, f)
+		m.size += size
+	}
+	if m.tsOffset < 0 {
+		return nil, errors.New("schema needs a timestamp field of type i64")
+	}
+	// The null bitmap ends the record
+	for i := range m.fields {
+		m.fields[i].nullOff += m.size
+	}
+	m.size += (nullable + 7) / 8
+	return m, nil
+}
+
+// fieldLayout returns the kind and size of a field type name
+func fieldLayout(name string) (string, int, error) {
+	kind, arg, hasArg := strings.Cut(strings.TrimSuffix(name, ")"), "(")
+	n := 0
+	if hasArg {
+		var err error
+		if n, err = strconv.Atoi(arg); err != nil || !strings.HasSuffix(name, ")") {
+			return "", 0, fmt.Errorf("unknown field type: %s", name)
+		}
+	}
+	switch {
+	case kind == "string" && !hasArg:
+		return kind, 128, nil
+	case kind == "string" && n >= 1 && n <= 128:
+		return kind, n, nil
+	case kind == "bytes" && !hasArg:
+		return kind, 2 + 256, nil
+	case kind == "bytes" && n >= 1 && n <= math.MaxUint16:
+		return kind, 2 + n, nil
+	case kind == "decimal" && n >= 0 && n <= 18:
+		return kind, 8, nil
+	case hasArg:
+		return "", 0, fmt.Errorf("unknown field type: %s", name)
+	}
+	switch kind {
+	case "i64", "f64", "u64":
+		return kind, 8, nil
+	case "i32", "u32", "f32":
+		return kind, 4, nil
+	case "i16":
+		return kind, 2, nil
+	case "bool", "u8":
+		return kind, 1, nil
+	}
+	return "", 0, fmt.Errorf("unknown field type: %s", name)
+}
+
+// RecordSize returns the size of the records of the schema
+func (m *Mem) RecordSize() int {
+	return m.size
+}
+
+// timestamp returns the timestamp of a record
+func (m *Mem) timestamp(rec []byte) int64 {
+	return int64(binary.LittleEndian.Uint64(rec[m.tsOffset:]))
+}
+
+// Append adds a raw record
+func (m *Mem) Append(data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return errors.New("database not initialized")
+	}
+	if len(data) != m.size {
+		return fmt.Errorf("record size %d doesn't match schema size %d", len(data), m.size)
+	}
+	if n := len(m.data); n > 0 && m.timestamp(data) <= m.timestamp(m.data[n-m.size:]) {
+		return ErrTimestampNotMonotonic
+	}
+	m.data = append(m.data, data...)
+	return nil
+}
+
+// Query returns the records of [startTs, endTs) matching filters, a []Filter or a
+// map[string]interface{} of field names to values
+func (m *Mem) Query(startTs, endTs int64, filters interface{}) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, errors.New("database not initialized")
+	}
+	parsed, err := m.parseFilters(filters)
+	if err != nil {
+		return nil, err
+	}
+	result := []byte{}
+	for off := 0; off < len(m.data); off += m.size {
+		rec := m.data[off : off+m.size]
+		if ts := m.timestamp(rec); ts < startTs || ts >= endTs {
+			continue
+		}
+		if m.matchAll(parsed, rec) {
+			result = append(result, rec...)
+		}
+	}
+	return result, nil
+}
+
+// Load returns all records
+func (m *Mem) Load() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, errors.New("database not initialized")
+	}
+	return append([]byte{}, m.data...), nil
+}
+
+// GetStats returns statistics for a field within a time range
+func (m *Mem) GetStats(startTs, endTs int64, fieldIndex int) (*Stats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed || fieldIndex < 0 || fieldIndex >= len(m.fields) {
+		return nil, errors.New("failed to get stats from HOCDB")
+	}
+	f := m.fields[fieldIndex]
+	stats := &Stats{Min: math.MaxFloat64, Max: -math.MaxFloat64}
+	for off := 0; off < len(m.data); off += m.size {
+		rec := m.data[off : off+m.size]
+		if ts := m.timestamp(rec); ts < startTs || ts >= endTs || f.isNull(rec) {
+			continue
+		}
+		v := f.number(rec)
+		stats.Min = math.Min(stats.Min, v)
+		stats.Max = math.Max(stats.Max, v)
+		stats.Sum += v
+		stats.Count++
+	}
+	if stats.Count == 0 {
+		return &Stats{}, nil
+	}
+	stats.Mean = stats.Sum / float64(stats.Count)
+	return stats, nil
+}
+
+// GetLatest returns the value of a field in the last record and its timestamp
+func (m *Mem) GetLatest(fieldIndex int) (*Latest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed || len(m.data) == 0 || fieldIndex < 0 || fieldIndex >= len(m.fields) {
+		return nil, errors.New("failed to get latest value from HOCDB")
+	}
+	rec := m.data[len(m.data)-m.size:]
+	f := m.fields[fieldIndex]
+	if f.isNull(rec) {
+		return nil, fmt.Errorf("latest %s: %w", f.name, ErrNull)
+	}
+	return &Latest{Value: f.number(rec), Timestamp: m.timestamp(rec)}, nil
+}
+
+// Close discards the records; later calls fail
+func (m *Mem) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed, m.data = true, nil
+}
+
+// parseFilters converts filters to a []Filter
+func (m *Mem) parseFilters(filters interface{}) ([]Filter, error) {
+	switch v := filters.(type) {
+	case nil:
+		return nil, nil
+	case []Filter:
+		for _, f := range v {
+			if f.FieldIndex < 0 || f.FieldIndex >= len(m.fields) {
+				return nil, fmt.Errorf("invalid filter field index %d", f.FieldIndex)
+			}
+		}
+		return v, nil
+	case map[string]interface{}:
+		var parsed []Filter
+		for name, val := range v {
+			idx := -1
+			for i, f := range m.fields {
+				if f.name == name {
+					idx = i
+				}
+			}
+			if idx < 0 {
+				return nil, fmt.Errorf("unknown field in filter: %s", name)
+			}
+			parsed = append(parsed, Filter{FieldIndex: idx, Value: val})
+		}
+		return parsed, nil
+	default:
+		return nil, errors.New("invalid filters type: expected []Filter or map[string]interface{}")
+	}
+}
+
+// matchAll reports whether a record matches every filter
+func (m *Mem) matchAll(filters []Filter, rec []byte) bool {
+	for _, filter := range filters {
+		f := m.fields[filter.FieldIndex]
+		if filter.Value == nil || f.isNull(rec) {
+			if filter.Value != nil || !f.isNull(rec) {
+				return false
+			}
+			continue
+		}
+		if !f.equal(rec, filter.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// isNull reports whether the field is null in a record
+func (f *memField) isNull(rec []byte) bool {
+	return f.nullable && rec[f.nullOff]&f.nullMask != 0
+}
+
+// raw returns the bytes of the field in a record
+func (f *memField) raw(rec []byte) []byte {
+	return rec[f.offset : f.offset+f.size]
+}
+
+// number returns the value of the field as float64 like the engine's stats,
+// strings and blobs counting as 0 and decimals as their unscaled value
+func (f *memField) number(rec []byte) float64 {
+	b := f.raw(rec)
+	switch f.kind {
+	case "i64", "decimal":
+		return float64(int64(binary.LittleEndian.Uint64(b)))
+	case "f64":
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	case "u64":
+		return float64(binary.LittleEndian.Uint64(b))
+	case "i32":
+		return float64(int32(binary.LittleEndian.Uint32(b)))
+	case "u32":
+		return float64(binary.LittleEndian.Uint32(b))
+	case "f32":
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	case "i16":
+		return float64(int16(binary.LittleEndian.Uint16(b)))
+	case "u8", "bool":
+		return float64(b[0])
+	}
+	return 0
+}
+
+// equal reports whether the field of a record holds the filter value v
+func (f *memField) equal(rec []byte, v interface{}) bool {
+	b := f.raw(rec)
+	switch f.kind {
+	case "string":
+		s, ok := v.(string)
+		return ok && string(bytes.TrimRight(b, "\x00")) == s
+	case "bytes":
+		n := int(binary.LittleEndian.Uint16(b))
+		switch v := v.(type) {
+		case []byte:
+			return bytes.Equal(b[2:2+n], v)
+		case string:
+			return string(b[2:2+n]) == v
+		}
+		return false
+	case "bool":
+		want, ok := v.(bool)
+		return ok && (b[0] != 0) == want
+	case "f64", "f32":
+		want, ok := floatValue(v)
+		return ok && f.number(rec) == want
+	case "u64":
+		want, ok := intValue(v)
+		return ok && binary.LittleEndian.Uint64(b) == uint64(want)
+	}
+	// The other integer types, and decimals by their unscaled value
+	want, ok := intValue(v)
+	return ok && f.integer(rec) == want
+}
+
+// integer returns the value of an integer or decimal field
+func (f *memField) integer(rec []byte) int64 {
+	b := f.raw(rec)
+	switch f.kind {
+	case "i32":
+		return int64(int32(binary.LittleEndian.Uint32(b)))
+	case "u32":
+		return int64(binary.LittleEndian.Uint32(b))
+	case "i16":
+		return int64(int16(binary.LittleEndian.Uint16(b)))
+	case "u8":
+		return int64(b[0])
+	}
+	return int64(binary.LittleEndian.Uint64(b))
+}
+
+// intValue converts a Go integer to int64
+func intValue(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case uint:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// floatValue converts a Go number to float64
+func floatValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+	if i, ok := intValue(v); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
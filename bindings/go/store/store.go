@@ -0,0 +1,58 @@
+/*
+Package store declares the operations services use on a HOCDB database as the
+Store interface, implemented by *hocdb.DB, and an in-memory fake of it. It is pure
+Go and doesn't import hocdb, so code written against Store can be unit-tested
+without the C library installed:
+
+	func NewRecorder(s store.Store) *Recorder { ... }
+
+	// In production
+	db, err := hocdb.New("BTC_USD", "./data", schema, hocdb.Options{})
+	rec := NewRecorder(db)
+
+	// In tests
+	mem, err := store.NewMem("timestamp:i64,price:f64,volume:f64")
+	rec := NewRecorder(mem)
+*/
+package store
+
+import "errors"
+
+// Store is the part of *hocdb.DB services commonly depend on, see the methods of
+// hocdb.DB for their contracts
+type Store interface {
+	Append(data []byte) error
+	Query(startTs, endTs int64, filters interface{}) ([]byte, error)
+	Load() ([]byte, error)
+	GetStats(startTs, endTs int64, fieldIndex int) (*Stats, error)
+	GetLatest(fieldIndex int) (*Latest, error)
+	Close()
+}
+
+// Stats represents statistics for a field in a time range
+type Stats struct {
+	Min   float64
+	Max   float64
+	Sum   float64
+	Count uint64
+	Mean  float64
+}
+
+// Latest represents the latest value and timestamp for a field
+type Latest struct {
+	Value     float64
+	Timestamp int64
+}
+
+// Filter represents a filter condition for queries
+type Filter struct {
+	FieldIndex int
+	Value      interface{}
+}
+
+// ErrNull is returned by GetLatest when the latest record holds a null in the field
+var ErrNull = errors.New("value is null")
+
+// ErrTimestampNotMonotonic is matched by the errors of appends rejected because
+// their timestamp isn't after the previous record's
+var ErrTimestampNotMonotonic = errors.New("append failed: timestamp not monotonic - timestamps must be strictly increasing")
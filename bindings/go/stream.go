@@ -0,0 +1,230 @@
+package hocdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"time"
+)
+
+// defaultChunkSize is the most bytes of a chunk of QueryFunc without MaxResultMemory
+const defaultChunkSize = 4 << 20
+
+// errChunkFull stops the scans of a chunk of QueryFunc once it holds enough records
+var errChunkFull = errors.New("chunk full")
+
+// QueryFunc runs a query like Query, but hands its result to fn in chunks of whole
+// records in time order instead of returning it, so that results of any size take
+// bounded memory. Chunks hold at most MaxResultMemory bytes, or 4 MiB without it.
+// data is only valid during the call, and an error fn returns stops the query and
+// is returned. The database isn't locked while fn runs, but the chunks come from a
+// snapshot taken when the call starts: records appended meanwhile are left out, and
+// the segments it reads stay on disk until it returns, even once DropPartition
+// dropped them.
+func (db *DB) QueryFunc(startTs, endTs int64, filters interface{}, fn func(data []byte) error) error {
+	q := queryInfo{op: "Query", start: time.Now(), startTs: startTs, endTs: endTs, filters: filters}
+	defer db.observeQuery(&q) // Once unlocked, see observeQuery
+	snap, err := db.pin()
+	if err != nil {
+		return err
+	}
+	defer db.unpin(snap)
+	if endTs > snap.end {
+		endTs = snap.end
+	}
+	for startTs < endTs {
+		data, next, err := db.queryChunk(startTs, endTs, filters, snap, &q)
+		if err != nil {
+			return err
+		}
+		if len(data) > 0 {
+			if err := fn(data); err != nil {
+				return err
+			}
+		}
+		startTs = next
+	}
+	q.ok = true
+	return nil
+}
+
+// snapshot is what the chunks of a QueryFunc read: the segments when it started,
+// pinned against DropPartition, and the end of the records it sees
+type snapshot struct {
+	segments []segment
+	seq      int   // Sequence number of the last of them, later ones were compacted since
+	end      int64 // Just past the newest record when it started
+}
+
+// pin takes a snapshot of the database for QueryFunc, which unpin releases
+func (db *DB) pin() (*snapshot, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.handle == nil && db.roFile == nil {
+		return nil, errors.New("database not initialized")
+	}
+	if db.readOnly {
+		if err := db.refreshSegments(); err != nil {
+			return nil, err
+		}
+	} else if err := db.flush(); err != nil {
+		return nil, err
+	}
+
+	snap := &snapshot{segments: db.segments, end: math.MinInt64}
+	if n := len(db.segments); n > 0 {
+		snap.seq, snap.end = db.segments[n-1].seq, db.segments[n-1].last+1
+	}
+	if latest, err := db.getLatest(db.fieldMap["timestamp"]); err == nil && latest.Timestamp < math.MaxInt64 {
+		snap.end = latest.Timestamp + 1
+	}
+	if db.segRefs == nil {
+		db.segRefs = make(map[int]int)
+	}
+	for _, s := range snap.segments {
+		db.segRefs[s.seq]++
+	}
+	return snap, nil
+}
+
+// unpin releases the segments of a snapshot, deleting those dropped meanwhile once
+// no other snapshot holds them
+func (db *DB) unpin(snap *snapshot) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, s := range snap.segments {
+		if db.segRefs[s.seq]--; db.segRefs[s.seq] <= 0 {
+			delete(db.segRefs, s.seq)
+		}
+	}
+	kept := db.retired[:0]
+	for _, s := range db.retired {
+		if db.segRefs[s.seq] > 0 {
+			kept = append(kept, s)
+			continue
+		}
+		db.removeSegment(s)
+	}
+	db.retired = kept
+}
+
+// segmentsOf returns the segments a chunk of a snapshot reads: its own, and those
+// compacted since from records of the data file; db.mu must be held
+func (db *DB) segmentsOf(snap *snapshot) []segment {
+	segments := snap.segments
+	for i, s := range db.segments {
+		if s.seq > snap.seq {
+			return append(segments[:len(segments):len(segments)], db.segments[i:]...)
+		}
+	}
+	return segments
+}
+
+// queryChunk returns the first matching records of [startTs, endTs) that fit in a
+// chunk of QueryFunc and the timestamp the next chunk starts at, endTs after the
+// last one, reading the segments of snap and counting what it read in q
+func (db *DB) queryChunk(startTs, endTs int64, filters interface{}, snap *snapshot, q *queryInfo) ([]byte, int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.handle == nil && db.roFile == nil {
+		return nil, 0, errors.New("database not initialized")
+	}
+	parsed, err := db.parseFilters(filters)
+	if err != nil {
+		return nil, 0, err
+	}
+	matchers, err := db.matchers(parsed)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := db.checkChecksums(startTs, endTs); err != nil {
+		return nil, 0, err
+	}
+
+	var v *fileView
+	dataStart := startTs
+	if db.readOnly {
+		if v, err = db.view(); err != nil {
+			return nil, 0, err
+		}
+		dataStart = db.tailStart(startTs)
+	} else {
+		if err := db.flush(); err != nil {
+			return nil, 0, err
+		}
+		f, err := os.Open(db.dataFile())
+		if err != nil {
+			return nil, 0, err
+		}
+		defer f.Close()
+		if v, err = db.dataView(f); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	budget := db.options.MaxResultMemory
+	if budget <= 0 {
+		budget = defaultChunkSize
+	}
+	maxRows := max(1, budget/v.size)
+	var chunk []byte
+	next := endTs
+	collect := func(view *fileView, from int64) error {
+		_, err := view.chunks(from, endTs, func(records []byte) error {
+			for off := int64(0); off < int64(len(records)); off += v.size {
+				rec := records[off : off+v.size]
+				q.scanned++
+				if !matchAll(matchers, rec) {
+					continue
+				}
+				chunk = append(chunk, rec...)
+				q.returned++
+				if int64(len(chunk)) >= maxRows*v.size {
+					// Timestamps are unique, the next chunk starts right after
+					next = int64(binary.LittleEndian.Uint64(rec[v.tsOffset:])) + 1
+					return errChunkFull
+				}
+			}
+			return nil
+		})
+		return err
+	}
+
+	skip := func(s segment) bool {
+		if db.bloomExcludes(s, parsed, matchers) {
+			return true
+		}
+		q.bytesRead += s.size
+		return false
+	}
+	err = db.scanSegmentList(db.segmentsOf(snap), startTs, endTs, skip, func(sv *fileView) error {
+		q.blocksScanned++
+		return collect(sv, startTs)
+	})
+	if err == nil {
+		before := q.scanned
+		err = collect(v, dataStart)
+		q.bytesRead += int64(q.scanned-before) * v.size
+	}
+	if err == errChunkFull {
+		return chunk, next, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return chunk, endTs, nil
+}
+
+// queryEach calls fn with the result of a query, in chunks through QueryFunc with
+// MaxResultMemory, else whole
+func (db *DB) queryEach(startTs, endTs int64, filters interface{}, fn func(data []byte) error) error {
+	if db.options.MaxResultMemory > 0 {
+		return db.QueryFunc(startTs, endTs, filters, fn)
+	}
+	data, err := db.Query(startTs, endTs, filters)
+	if err != nil {
+		return err
+	}
+	return fn(data)
+}
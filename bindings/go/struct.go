@@ -0,0 +1,441 @@
+package hocdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// structField maps a field of a struct to a field of its schema
+type structField struct {
+	index []int // Of the struct field, for reflect.Value.FieldByIndex
+	Field
+}
+
+var (
+	decimalType = reflect.TypeOf(Decimal{})
+	timeType    = reflect.TypeOf(time.Time{})
+
+	// structTypes caches the structFields of struct types, or their error
+	structTypes sync.Map
+)
+
+// SchemaFromStruct returns the schema of the records a struct holds, given the
+// struct or a pointer to it, so that the two are declared once. Each exported
+// field is a schema field, in order, described by a tag such as
+//
+//	Price float64 `hocdb:"price,f64"`
+//
+// The name defaults to the Go name in snake case, bid_price for BidPrice, and the
+// type to the one of the Go type: i64 for int64, int and time.Time, f64 for
+// float64, u64 for uint64 and uint, string, bool, i32, u32, f32, i16, u8, bytes for
+// []byte, and decimal for Decimal. Types such as string(8) or decimal(2) need the
+// tag, and must suit the Go type. Pointer fields are nullable, nil when null, and
+// so are []byte fields of a type ending in "?". A tag of "-" skips the field.
+func SchemaFromStruct(v interface{}) ([]Field, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%T is not a struct", v)
+	}
+	fields, err := structFields(t)
+	if err != nil {
+		return nil, err
+	}
+	schema := make([]Field, len(fields))
+	for i, f := range fields {
+		schema[i] = f.Field
+	}
+	return schema, nil
+}
+
+// cachedStructFields is structFields, cached
+func cachedStructFields(t reflect.Type) ([]structField, error) {
+	type result struct {
+		fields []structField
+		err    error
+	}
+	if r, ok := structTypes.Load(t); ok {
+		return r.(result).fields, r.(result).err
+	}
+	fields, err := structFields(t)
+	structTypes.Store(t, result{fields, err})
+	return fields, err
+}
+
+// structFields returns the schema fields of the exported fields of a struct type
+func structFields(t reflect.Type) ([]structField, error) {
+	var fields []structField
+	names := make(map[string]string)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, tagged := sf.Tag.Lookup("hocdb")
+		if !sf.IsExported() || tag == "-" {
+			continue
+		}
+		name, typeName, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = snakeCase(sf.Name)
+		}
+		f, err := structFieldType(sf.Type, typeName)
+		if err != nil {
+			if tagged {
+				return nil, fmt.Errorf("field %s with tag %q: %w", sf.Name, tag, err)
+			}
+			return nil, fmt.Errorf("field %s: %w", sf.Name, err)
+		}
+		if other, ok := names[name]; ok {
+			return nil, fmt.Errorf("fields %s and %s are both named %s", other, sf.Name, name)
+		}
+		names[name] = sf.Name
+		f.Name = name
+		fields = append(fields, structField{index: sf.Index, Field: f})
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%v has no exported fields", t)
+	}
+	return fields, nil
+}
+
+// structFieldType returns the type of the schema field of a struct field of Go type
+// t, typeName being the type in its tag, if any
+func structFieldType(t reflect.Type, typeName string) (Field, error) {
+	var f Field
+	typeName, f.Nullable = strings.CutSuffix(typeName, "?")
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		f.Nullable = true
+	} else if f.Nullable && t.Kind() != reflect.Slice {
+		return f, fmt.Errorf("nullable field of Go type %v, which isn't a pointer", t)
+	}
+	goType, ok := fieldTypeOf(t)
+	if !ok {
+		return f, fmt.Errorf("unsupported Go type %v", t)
+	}
+	f.Type = goType
+	if typeName != "" {
+		declared, err := ParseFieldType(typeName)
+		if err != nil {
+			return f, err
+		}
+		if declared.kind() != goType {
+			return f, fmt.Errorf("%v field of Go type %v", declared, t)
+		}
+		f.Type = declared
+	}
+	return f, nil
+}
+
+// fieldTypeOf returns the field type of the values of a Go type, TypeString,
+// TypeBytes and TypeDecimal for any width or scale
+func fieldTypeOf(t reflect.Type) (FieldType, bool) {
+	switch t {
+	case decimalType:
+		return TypeDecimal, true
+	case timeType:
+		return TypeI64, true
+	}
+	switch t.Kind() {
+	case reflect.Int64, reflect.Int:
+		return TypeI64, true
+	case reflect.Float64:
+		return TypeF64, true
+	case reflect.Uint64, reflect.Uint:
+		return TypeU64, true
+	case reflect.String:
+		return TypeString, true
+	case reflect.Bool:
+		return TypeBool, true
+	case reflect.Int32:
+		return TypeI32, true
+	case reflect.Uint32:
+		return TypeU32, true
+	case reflect.Float32:
+		return TypeF32, true
+	case reflect.Int16:
+		return TypeI16, true
+	case reflect.Uint8:
+		return TypeU8, true
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return TypeBytes, true
+		}
+	}
+	return 0, false
+}
+
+// snakeCase returns a Go name in snake case, such as bid_price for BidPrice and
+// http_status for HTTPStatus
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// structCodec encodes and decodes the records of a database as values of a struct
+// type
+type structCodec struct {
+	schema []Field       // Of the database, when the codec was made
+	fields []structField // The struct field of each schema field
+}
+
+// structCodec returns the codec of a struct type for the schema of the database,
+// made once per type and schema
+func (db *DB) structCodec(t reflect.Type) (*structCodec, error) {
+	schema, fieldMap := db.layout()
+	if c, ok := db.structs.Load(t); ok {
+		// Schema changes replace the schema slice
+		if c := c.(*structCodec); sameSchema(c.schema, schema) {
+			return c, nil
+		}
+	}
+	fields, err := cachedStructFields(t)
+	if err != nil {
+		return nil, err
+	}
+	c := &structCodec{schema: schema, fields: make([]structField, len(schema))}
+	if len(fields) != len(schema) {
+		return nil, fmt.Errorf("%v has %d fields, the schema %d", t, len(fields), len(schema))
+	}
+	for _, f := range fields {
+		i, ok := fieldMap[f.Name]
+		if !ok || i >= len(schema) || schema[i].Name != f.Name {
+			return nil, fmt.Errorf("%v has a field %s the schema doesn't", t, f.Name)
+		}
+		if schema[i].Type != f.Type || schema[i].Nullable != f.Nullable {
+			return nil, fmt.Errorf("%v has field %s as %s, the schema as %s", t, f.Name, fieldSpec(f.Field), fieldSpec(schema[i]))
+		}
+		c.fields[i] = f
+	}
+	db.structs.Store(t, c)
+	return c, nil
+}
+
+// fieldSpec returns the type of a field as ParseSchema reads it
+func fieldSpec(f Field) string {
+	if f.Nullable {
+		return f.Type.String() + "?"
+	}
+	return f.Type.String()
+}
+
+// encode writes the struct v as a record into dst, grown if too small, converting
+// time.Time values at precision
+func (c *structCodec) encode(dst []byte, v reflect.Value, precision time.Duration) ([]byte, error) {
+	size := RecordSize(c.schema)
+	if cap(dst) < size {
+		dst = make([]byte, size)
+	}
+	record := dst[:size]
+	clear(record)
+	offset, bit := 0, 0
+	nulls := record[size-nullBitmapSize(c.schema):]
+	for i, field := range c.schema {
+		out := record[offset : offset+field.Type.Size()]
+		offset += len(out)
+		fv := v.FieldByIndex(c.fields[i].index)
+		if field.Nullable {
+			idx, mask := bit/8, byte(1)<<(bit%8)
+			bit++
+			if fv.IsNil() {
+				nulls[idx] |= mask
+				continue
+			}
+			if fv.Kind() == reflect.Pointer {
+				fv = fv.Elem()
+			}
+		}
+
+		switch field.Type.kind() {
+		case TypeI64:
+			if fv.Type() == timeType {
+				binary.LittleEndian.PutUint64(out, uint64(timestampOf(fv.Interface().(time.Time), precision)))
+			} else {
+				binary.LittleEndian.PutUint64(out, uint64(fv.Int()))
+			}
+		case TypeF64:
+			binary.LittleEndian.PutUint64(out, math.Float64bits(fv.Float()))
+		case TypeU64:
+			binary.LittleEndian.PutUint64(out, fv.Uint())
+		case TypeString:
+			if fv.Len() > len(out) {
+				return nil, fmt.Errorf("string of %d bytes longer than the %d bytes of field %s", fv.Len(), len(out), field.Name)
+			}
+			copy(out, fv.String())
+		case TypeBytes:
+			val := fv.Bytes()
+			if len(val) > len(out)-2 {
+				return nil, fmt.Errorf("value of %d bytes longer than the %d bytes of field %s", len(val), len(out)-2, field.Name)
+			}
+			binary.LittleEndian.PutUint16(out, uint16(len(val)))
+			copy(out[2:], val)
+		case TypeDecimal:
+			val, err := decimalValue(field.Type, fv.Interface())
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			binary.LittleEndian.PutUint64(out, uint64(val))
+		case TypeBool:
+			if fv.Bool() {
+				out[0] = 1
+			}
+		case TypeI32:
+			binary.LittleEndian.PutUint32(out, uint32(fv.Int()))
+		case TypeU32:
+			binary.LittleEndian.PutUint32(out, uint32(fv.Uint()))
+		case TypeF32:
+			binary.LittleEndian.PutUint32(out, math.Float32bits(float32(fv.Float())))
+		case TypeI16:
+			binary.LittleEndian.PutUint16(out, uint16(fv.Int()))
+		case TypeU8:
+			out[0] = uint8(fv.Uint())
+		}
+	}
+	return record, nil
+}
+
+// decode sets the fields of the struct v from a record, converting timestamps
+// into time.Time values with timeOf
+func (c *structCodec) decode(v reflect.Value, data []byte, timeOf func(int64) time.Time) error {
+	nulls := data[len(data)-nullBitmapSize(c.schema):]
+	offset, bit := 0, 0
+	for i, field := range c.schema {
+		raw := data[offset : offset+field.Type.Size()]
+		offset += len(raw)
+		fv := v.FieldByIndex(c.fields[i].index)
+		if field.Nullable {
+			null := nulls[bit/8]&(1<<(bit%8)) != 0
+			bit++
+			if null {
+				fv.SetZero()
+				continue
+			}
+			if fv.Kind() == reflect.Pointer {
+				fv.Set(reflect.New(fv.Type().Elem()))
+				fv = fv.Elem()
+			}
+		}
+
+		switch field.Type.kind() {
+		case TypeI64:
+			ts := int64(binary.LittleEndian.Uint64(raw))
+			if fv.Type() == timeType {
+				fv.Set(reflect.ValueOf(timeOf(ts)))
+			} else {
+				fv.SetInt(ts)
+			}
+		case TypeF64:
+			fv.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(raw)))
+		case TypeU64:
+			fv.SetUint(binary.LittleEndian.Uint64(raw))
+		case TypeString:
+			fv.SetString(string(trimPadding(raw)))
+		case TypeBytes:
+			n := int(binary.LittleEndian.Uint16(raw))
+			if n > len(raw)-2 {
+				return errors.New("blob length exceeds its field")
+			}
+			fv.SetBytes(append(make([]byte, 0, n), raw[2:2+n]...))
+		case TypeDecimal:
+			fv.Set(reflect.ValueOf(Decimal{Unscaled: int64(binary.LittleEndian.Uint64(raw)), Scale: field.Type.Scale()}))
+		case TypeBool:
+			fv.SetBool(raw[0] != 0)
+		case TypeI32:
+			fv.SetInt(int64(int32(binary.LittleEndian.Uint32(raw))))
+		case TypeU32:
+			fv.SetUint(uint64(binary.LittleEndian.Uint32(raw)))
+		case TypeF32:
+			fv.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(raw))))
+		case TypeI16:
+			fv.SetInt(int64(int16(binary.LittleEndian.Uint16(raw))))
+		case TypeU8:
+			fv.SetUint(uint64(raw[0]))
+		}
+	}
+	return nil
+}
+
+// AppendStruct appends the record a struct holds, given the struct or a pointer to
+// it. Its fields map to those of the schema by name as SchemaFromStruct describes
+// them, in any order, and must match the schema. time.Time values are stored at the
+// TimestampPrecision of the database. What AppendStruct learns of a struct type by
+// reflection is cached, making it a middle ground between AppendValues and the
+// code hocdbgen generates.
+func (db *DB) AppendStruct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("%T is not a struct", v)
+	}
+	c, err := db.structCodec(rv.Type())
+	if err != nil {
+		return err
+	}
+
+	buf := recordBuffers.Get().(*[]byte)
+	defer recordBuffers.Put(buf)
+	record, err := c.encode(*buf, rv, db.TimestampPrecision())
+	if err != nil {
+		return err
+	}
+	*buf = record
+	return db.Append(record)
+}
+
+// QueryStructs runs a query like Query and decodes the records into dst, a pointer
+// to a slice of structs whose fields match the schema as for AppendStruct. dst is
+// replaced with the records, reusing its capacity. Timestamps of time.Time fields
+// are in UTC, see Time.
+func (db *DB) QueryStructs(dst interface{}, startTs, endTs int64, filters interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Slice || rv.Elem().Type().Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%T is not a pointer to a slice of structs", dst)
+	}
+	slice := rv.Elem()
+	c, err := db.structCodec(slice.Type().Elem())
+	if err != nil {
+		return err
+	}
+
+	// Records go into the capacity of the slice, grown when full
+	size := RecordSize(c.schema)
+	n := 0
+	slice.Set(slice.Slice(0, slice.Cap()))
+	err = db.QueryFunc(startTs, endTs, filters, func(data []byte) error {
+		for offset := 0; offset+size <= len(data); offset += size {
+			if n == slice.Cap() {
+				slice.Set(reflect.Append(slice.Slice(0, n), reflect.Zero(slice.Type().Elem())))
+				slice.Set(slice.Slice(0, slice.Cap()))
+			}
+			elem := slice.Index(n)
+			elem.SetZero() // Of fields left out of the schema too
+			if err := c.decode(elem, data[offset:offset+size], db.Time); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	slice.Set(slice.Slice(0, n))
+	return err
+}
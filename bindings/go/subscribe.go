@@ -0,0 +1,292 @@
+package hocdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// subscribePollInterval is how often subscriptions check the data file for
+	// records written by other handles
+	subscribePollInterval = 50 * time.Millisecond
+
+	// subscribeBuffer is the capacity of the channel returned by Subscribe
+	subscribeBuffer = 1024
+)
+
+// subscription follows the appends to a database for Subscribe
+type subscription struct {
+	lock     sync.Locker // Of the handle writing the file, nil for a read-only one
+	file     string
+	schema   []Field
+	size     int64 // Record size
+	tsOffset int
+
+	ch   chan Record
+	wake chan struct{}
+	done chan struct{}
+	stop sync.Once
+
+	mu    sync.Mutex
+	queue []Record
+	last  int64 // Timestamp of the last record queued for delivery
+
+	// File cursor: the offset where the next record is expected and the timestamp
+	// of the last record read from the file
+	pos      int64
+	fileLast int64
+
+	// Records before end, the largest size the file had, are rewritten in place,
+	// and another process may be in the middle of writing one: the last one a poll
+	// reads is held back until it has read the same at heldAt for a poll interval
+	end       int64
+	held      []byte
+	heldAt    int64
+	heldSince time.Time
+}
+
+// Subscribe returns a channel delivering every record appended after the call, in
+// timestamp order, until ctx is done or the database is closed; the channel is then
+// closed.
+//
+// Records appended through this handle are delivered as soon as Append returns.
+// Records written to the data file by other handles, including other processes,
+// are picked up by polling the file and arrive once they have been flushed; those
+// a full ring buffer writes in place arrive a poll later, once they have read the
+// same for a poll interval, so that none is delivered half-written.
+// Records queue up while the receiver is busy, so drain the channel promptly.
+func (db *DB) Subscribe(ctx context.Context) (<-chan Record, error) {
+	// Holding the lock until the subscription is registered means no append falls
+	// between the file cursor and the first delivered record
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !db.opened() {
+		return nil, errors.New("database not initialized")
+	}
+
+	tsOffset, ok := timestampOffset(db.schema)
+	if !ok {
+		return nil, errors.New("subscribe failed: schema has no i64 timestamp field")
+	}
+
+	// Everything written so far goes to disk, so the file cursor starts after it
+	if err := db.flush(); err != nil {
+		return nil, fmt.Errorf("subscribe failed: %w", err)
+	}
+	last := int64(math.MinInt64)
+	if latest, err := db.getLatest(db.fieldMap["timestamp"]); err == nil {
+		last = latest.Timestamp
+	}
+
+	s := &subscription{
+		file:     db.dataFile(),
+		schema:   db.schema,
+		size:     int64(RecordSize(db.schema)),
+		tsOffset: tsOffset,
+		ch:       make(chan Record, subscribeBuffer),
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		last:     last,
+		fileLast: last,
+	}
+	pos, err := db.writeCursor()
+	if err != nil {
+		return nil, fmt.Errorf("subscribe failed: %w", err)
+	}
+	s.pos = pos
+	if info, err := os.Stat(s.file); err == nil {
+		s.end = info.Size()
+	}
+	if !db.readOnly {
+		s.lock = &db.mu
+	}
+
+	db.subMu.Lock()
+	if db.subs == nil {
+		db.subs = make(map[*subscription]struct{})
+	}
+	db.subs[s] = struct{}{}
+	db.subMu.Unlock()
+
+	go func() {
+		s.run(ctx)
+		db.subMu.Lock()
+		delete(db.subs, s)
+		db.subMu.Unlock()
+	}()
+
+	return s.ch, nil
+}
+
+// subscribed reports whether the database has subscriptions
+func (db *DB) subscribed() bool {
+	db.subMu.Lock()
+	defer db.subMu.Unlock()
+	return len(db.subs) > 0
+}
+
+// publish delivers a record appended through this handle to the subscriptions
+func (db *DB) publish(rec Record) {
+	db.subMu.Lock()
+	defer db.subMu.Unlock()
+	for s := range db.subs {
+		s.deliver(rec)
+	}
+}
+
+// closeSubscriptions ends every subscription, closing their channels
+func (db *DB) closeSubscriptions() {
+	db.subMu.Lock()
+	defer db.subMu.Unlock()
+	for s := range db.subs {
+		s.close()
+	}
+}
+
+// poll delivers the records written to the file since the last poll
+func (s *subscription) poll() error {
+	// The engine writes while its handle is locked, so its records aren't read
+	// half-written
+	if s.lock != nil {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+	}
+	f, err := os.Open(s.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	end, err := dataEnd(f, s.size)
+	if err != nil {
+		return err
+	}
+
+	var records []Record
+	collect := func(rec []byte) {
+		values, err := DecodeRecord(s.schema, rec)
+		if err == nil {
+			records = append(records, Record{Schema: s.schema, Values: values})
+		}
+	}
+
+	if s.pos > end {
+		// The file was replaced by a shorter one, for example by compaction
+		err = scanRecords(f, s.size, s.tsOffset, fileHeaderSize, end, func(offset, ts int64, rec []byte) bool {
+			if ts > s.fileLast {
+				s.fileLast = ts
+				collect(rec)
+			}
+			return true
+		})
+		s.pos = end
+	} else {
+		if s.pos == end && end > fileHeaderSize {
+			// A full ring buffer continues at the start of the file
+			var head [8]byte
+			if _, err := f.ReadAt(head[:], fileHeaderSize+int64(s.tsOffset)); err == nil &&
+				int64(binary.LittleEndian.Uint64(head[:])) > s.fileLast {
+				s.pos = fileHeaderSize
+			}
+		}
+		// Records are newer than their predecessor until the cursor reaches a slot
+		// that hasn't been overwritten yet
+		from := s.pos
+		s.pos = end
+		lastAt, lastOffset, lastBefore := 0, int64(-1), s.fileLast
+		var last []byte
+		err = scanRecords(f, s.size, s.tsOffset, from, end, func(offset, ts int64, rec []byte) bool {
+			if ts <= s.fileLast {
+				s.pos = offset
+				return false
+			}
+			lastAt, lastOffset, lastBefore = len(records), offset, s.fileLast
+			last = append(last[:0], rec...)
+			s.fileLast = ts
+			collect(rec)
+			return true
+		})
+		if lastOffset >= 0 && lastOffset < s.end {
+			if lastOffset != s.heldAt || !bytes.Equal(last, s.held) {
+				s.held, s.heldAt, s.heldSince = last, lastOffset, time.Now()
+			}
+			if time.Since(s.heldSince) < subscribePollInterval {
+				records = records[:lastAt]
+				s.pos, s.fileLast = lastOffset, lastBefore
+			}
+		}
+	}
+	s.end = max(s.end, end)
+
+	for _, rec := range records {
+		s.deliver(rec)
+	}
+	return err
+}
+
+// deliver queues a record unless it was already delivered
+func (s *subscription) deliver(rec Record) {
+	s.mu.Lock()
+	ts := rec.Timestamp()
+	if ts <= s.last {
+		s.mu.Unlock()
+		return
+	}
+	s.last = ts
+	s.queue = append(s.queue, rec)
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) close() {
+	s.stop.Do(func() { close(s.done) })
+}
+
+// run forwards queued records to the channel and polls the file until the
+// subscription ends
+func (s *subscription) run(ctx context.Context) {
+	defer close(s.ch)
+
+	ticker := time.NewTicker(subscribePollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.mu.Lock()
+		batch := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+
+		for _, rec := range batch {
+			select {
+			case s.ch <- rec:
+			case <-ctx.Done():
+				return
+			case <-s.done:
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.done:
+			return
+		case <-s.wake:
+		case <-ticker.C:
+			// A missing or unreadable file is retried on the next tick
+			s.poll()
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"math"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestAddField(t *testing.T) {
+	testDir := "../../../b_go_test_data_add_field"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+	for i := 1; i <= 3; i++ {
+		if err := db.AppendValues(int64(i), float64(i)*10); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	for i := 4; i <= 5; i++ {
+		if err := db.AppendAsync(mustRecord(t, schema, int64(i), float64(i)*10)); err != nil {
+			t.Fatalf("Failed to queue record: %v", err)
+		}
+	}
+
+	if err := db.AddField(hocdb.Field{Name: "price", Type: hocdb.TypeF64}, 0.0); err == nil {
+		t.Errorf("Expected an error adding an existing field")
+	}
+	if err := db.AddField(hocdb.Field{Name: "side", Type: hocdb.TypeString}, 1.5); err == nil {
+		t.Errorf("Expected an error for a default value of the wrong type")
+	}
+	if err := db.AddField(hocdb.Field{Name: "side", Type: hocdb.TypeString}, "buy"); err != nil {
+		t.Fatalf("Failed to add field: %v", err)
+	}
+
+	want := append(schema, hocdb.Field{Name: "side", Type: hocdb.TypeString})
+	if !reflect.DeepEqual(db.Schema(), want) {
+		t.Fatalf("Expected schema %v, got %v", want, db.Schema())
+	}
+	if err := db.AppendValues(int64(6), 60.0, "sell"); err != nil {
+		t.Fatalf("Failed to append after adding a field: %v", err)
+	}
+
+	data, err := db.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	records, err := hocdb.DecodeRecords(want, data)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(records) != 6 {
+		t.Fatalf("Expected 6 records, got %d", len(records))
+	}
+	for i, rec := range records {
+		side, _ := rec.Get("side")
+		wantSide := "buy"
+		if i == 5 {
+			wantSide = "sell"
+		}
+		if rec.Timestamp() != int64(i+1) || rec.Values[1] != float64(i+1)*10 || side != wantSide {
+			t.Errorf("Unexpected record %d: %v", i, rec.Values)
+		}
+	}
+
+	// The new schema was recorded
+	db.Close()
+	db, found, err := hocdb.OpenExisting("BTC_USD", testDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("Expected recorded schema %v, got %v", want, found)
+	}
+}
+
+// TestAddFieldConcurrent changes the schema while other goroutines append and read
+// it, for the race detector to check
+func TestAddFieldConcurrent(t *testing.T) {
+	testDir := "../../../b_go_test_data_add_field_concurrent"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	// Appends start before the schema changes and go on after it
+	done, started, widened := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	var wg sync.WaitGroup
+	appended := 0
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		wide := false
+		for ts := int64(1); ; ts++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			// Appends fail while the schema they were made for is replaced
+			values := []interface{}{ts, float64(ts)}
+			if len(db.Schema()) == 3 {
+				values = append(values, int32(ts))
+			}
+			if db.AppendValues(values...) != nil {
+				continue
+			}
+			if appended++; appended == 1 {
+				close(started)
+			}
+			if len(values) == 3 && !wide {
+				close(widened)
+				wide = true
+			}
+		}
+	}()
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if s := db.Schema(); len(s) < 2 || s[1].Name != "price" {
+					t.Errorf("Unexpected schema %v", s)
+				}
+				if _, ok := db.FieldIndex("price"); !ok {
+					t.Errorf("Field price missing")
+				}
+				db.RecordSize()
+				db.GetStatsByName(math.MinInt64, math.MaxInt64, "price")
+				db.Query(math.MinInt64, math.MaxInt64, map[string]interface{}{"price": 1.0})
+			}
+		}()
+	}
+
+	<-started
+	err = db.AddField(hocdb.Field{Name: "qty", Type: hocdb.TypeI32}, int32(0))
+	if err == nil {
+		<-widened
+	}
+	close(done)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("Failed to add field: %v", err)
+	}
+
+	want := append(schema, hocdb.Field{Name: "qty", Type: hocdb.TypeI32})
+	if !reflect.DeepEqual(db.Schema(), want) {
+		t.Fatalf("Expected schema %v, got %v", want, db.Schema())
+	}
+	data, err := db.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	records, err := hocdb.DecodeRecords(want, data)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(records) != appended {
+		t.Errorf("Expected %d records, got %d", appended, len(records))
+	}
+}
+
+func mustRecord(t *testing.T, schema []hocdb.Field, values ...interface{}) []byte {
+	t.Helper()
+	data, err := hocdb.CreateRecordBytes(schema, values...)
+	if err != nil {
+		t.Fatalf("Failed to create record: %v", err)
+	}
+	return data
+}
@@ -0,0 +1,106 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAppendStruct(t *testing.T) {
+	testDir := "../../../b_go_test_data_appendstruct"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	type Trade struct {
+		Side      string `hocdb:"side,string(8)"`
+		Timestamp time.Time
+		Price     float64
+		Fee       hocdb.Decimal `hocdb:"fee,decimal(2)"`
+		Bid       *float64      `hocdb:"bid_price"`
+		Payload   []byte        `hocdb:"payload,bytes(16)?"`
+		Qty       int32
+		Note      string `hocdb:"-"`
+	}
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "side", Type: hocdb.StringType(8)},
+		{Name: "qty", Type: hocdb.TypeI32},
+		{Name: "fee", Type: hocdb.DecimalType(2)},
+		{Name: "bid_price", Type: hocdb.TypeF64, Nullable: true},
+		{Name: "payload", Type: hocdb.BytesType(16), Nullable: true},
+	}
+	db, err := hocdb.New("TRADES", testDir, schema, hocdb.Options{TimestampPrecision: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	// Fields map by name, whatever their order
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	bid := 99.5
+	trades := []Trade{
+		{Side: "buy", Timestamp: start, Price: 100, Fee: hocdb.Decimal{Unscaled: 125, Scale: 2}, Bid: &bid, Payload: []byte{1, 2}, Qty: 3},
+		{Side: "sell", Timestamp: start.Add(time.Second), Price: 101, Fee: hocdb.Decimal{Unscaled: 3, Scale: 1}, Qty: -1},
+	}
+	for i := range trades {
+		if err := db.AppendStruct(&trades[i]); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	values, err := hocdb.DecodeRecords(schema, mustQuery(t, db))
+	if err != nil || values[1].Values[0] != start.Add(time.Second).UnixMilli() || values[1].Values[4] != (hocdb.Decimal{Unscaled: 30, Scale: 2}) {
+		t.Errorf("Expected millisecond timestamps and rescaled decimals, got %v, %v", values, err)
+	}
+
+	// QueryStructs decodes them back, reusing the slice
+	got := make([]Trade, 5)
+	got[1].Note = "stale"
+	if err := db.QueryStructs(&got, math.MinInt64, math.MaxInt64, nil); err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	trades[1].Fee = hocdb.Decimal{Unscaled: 30, Scale: 2}
+	if !reflect.DeepEqual(got, trades) || cap(got) != 5 {
+		t.Errorf("Expected the trades back, got %+v", got)
+	}
+	var sells []Trade
+	if err := db.QueryStructs(&sells, math.MinInt64, math.MaxInt64, map[string]interface{}{"side": "sell"}); err != nil || len(sells) != 1 || sells[0].Qty != -1 {
+		t.Errorf("Expected the sell, got %+v, %v", sells, err)
+	}
+
+	// Structs must match the schema
+	type Narrow struct {
+		Timestamp int64
+		Price     float64
+	}
+	if err := db.AppendStruct(Narrow{Timestamp: 5}); err == nil {
+		t.Errorf("Expected a struct missing fields to fail")
+	}
+	type Mistyped struct {
+		Timestamp int64
+		Price     float32
+		Side      string `hocdb:"side,string(8)"`
+		Qty       int32
+		Fee       hocdb.Decimal `hocdb:"fee,decimal(2)"`
+		Bid       *float64      `hocdb:"bid_price"`
+		Payload   []byte        `hocdb:"payload,bytes(16)?"`
+	}
+	if err := db.QueryStructs(&[]Mistyped{}, math.MinInt64, math.MaxInt64, nil); err == nil {
+		t.Errorf("Expected a struct with another type to fail")
+	}
+	if err := db.QueryStructs([]Trade{}, math.MinInt64, math.MaxInt64, nil); err == nil {
+		t.Errorf("Expected a slice rather than a pointer to fail")
+	}
+}
+
+func mustQuery(t *testing.T, db *hocdb.DB) []byte {
+	t.Helper()
+	data, err := db.Query(math.MinInt64, math.MaxInt64, nil)
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	return data
+}
@@ -0,0 +1,102 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"errors"
+	"hocdb"
+	"hocdb/hocdbtest"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArchivePartition(t *testing.T) {
+	testDir := "../../../b_go_test_data_archive"
+	archiveDir := "../../../b_go_test_data_archive_files"
+	otherDir := "../../../b_go_test_data_archive_other"
+	for _, dir := range []string{testDir, archiveDir, otherDir} {
+		os.RemoveAll(dir)
+		defer os.RemoveAll(dir)
+	}
+
+	options := hocdb.Options{
+		TimestampPrecision: time.Second,
+		PartitionBy:        hocdb.PartitionDay,
+		Compression:        &hocdb.Compression{Codec: "deflate"},
+	}
+	db, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	// Hourly records over three days, the first two in partitions
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 72; i++ {
+		if err := db.AppendValues(start.Add(time.Duration(i)*time.Hour), float64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	want, err := db.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	segments, _ := db.Segments()
+
+	path, err := db.ArchivePartition(start.Add(12*time.Hour), archiveDir)
+	if err != nil {
+		t.Fatalf("Failed to archive partition: %v", err)
+	}
+	if filepath.Base(path) != hocdbtest.Ticker+".2024-03-04.tar" {
+		t.Errorf("Expected the archive to be named after the day, got %s", path)
+	}
+	if data, err := db.Query(math.MinInt64, math.MaxInt64, nil); err != nil || len(data) != 48*24 {
+		t.Errorf("Expected 48 records after archiving a day, got %d bytes, %v", len(data), err)
+	}
+	if _, err := db.ArchivePartition(start.AddDate(0, 0, 2), archiveDir); err == nil {
+		t.Errorf("Expected an error for the partition of the data file")
+	}
+
+	// Attaching it restores the day under its old segment
+	if err := db.AttachArchive(path); err != nil {
+		t.Fatalf("Failed to attach archive: %v", err)
+	}
+	if got, err := db.Load(); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Expected the 72 records back, got %d bytes, %v", len(got), err)
+	}
+	if attached, _ := db.Segments(); len(attached) != 2 || attached[0] != segments[0] {
+		t.Errorf("Expected the partition back as %+v, got %+v", segments[0], attached)
+	}
+	if err := db.AttachArchive(path); err == nil {
+		t.Errorf("Expected attaching the same partition twice to fail")
+	}
+
+	// Other databases of the same schema can attach it, others can't
+	other, err := hocdb.New(hocdbtest.Ticker, otherDir, hocdbtest.TickSchema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer other.Close()
+	if err := other.AttachArchive(path); err != nil {
+		t.Fatalf("Failed to attach archive to another DB: %v", err)
+	}
+	if got, err := other.Load(); err != nil || !bytes.Equal(got, want[:24*24]) {
+		t.Errorf("Expected the 24 archived records, got %d bytes, %v", len(got), err)
+	}
+	narrowDir := otherDir + "_narrow"
+	os.RemoveAll(narrowDir)
+	defer os.RemoveAll(narrowDir)
+	narrow, err := hocdb.New(hocdbtest.Ticker, narrowDir, []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}}, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer narrow.Close()
+	if err := narrow.AttachArchive(path); !errors.Is(err, hocdb.ErrSchemaMismatch) {
+		t.Errorf("Expected a schema mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package hocdb_test
+
+import (
+	"errors"
+	"hocdb"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAppendAsync(t *testing.T) {
+	testDir := "../../../b_go_test_data_async"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	options := hocdb.Options{AsyncBatchSize: 64, AsyncFlushInterval: time.Hour}
+	db, err := hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+
+	for i := 1; i <= 1000; i++ {
+		record, _ := hocdb.CreateRecordBytes(schema, int64(i), float64(i))
+		if err := db.AppendAsync(record); err != nil {
+			t.Fatalf("Failed to queue record %d: %v", i, err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	data, err := db.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if len(data) != 1000*hocdb.RecordSize(schema) {
+		t.Errorf("Expected 1000 records after Flush, got %d bytes", len(data))
+	}
+
+	// Errors of background appends are returned by the next Flush
+	record, _ := hocdb.CreateRecordBytes(schema, int64(5), 5.0)
+	if err := db.AppendAsync(record); err != nil {
+		t.Fatalf("Failed to queue record: %v", err)
+	}
+	if err := db.Flush(); err == nil {
+		t.Errorf("Expected Flush to report the non-monotonic append")
+	}
+	if err := db.Flush(); err != nil {
+		t.Errorf("Expected the error to be reported once, got %v", err)
+	}
+
+	if err := db.AppendAsync([]byte{1, 2, 3}); err == nil {
+		t.Errorf("Expected an error for an invalid record size")
+	}
+
+	// Close writes what is still queued
+	record, _ = hocdb.CreateRecordBytes(schema, int64(1001), 1001.0)
+	if err := db.AppendAsync(record); err != nil {
+		t.Fatalf("Failed to queue record: %v", err)
+	}
+	db.Close()
+	if err := db.AppendAsync(record); err == nil {
+		t.Errorf("Expected an error queueing on a closed database")
+	}
+
+	db, err = hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db.Close()
+	latest, err := db.GetLatest(0)
+	if err != nil || latest.Timestamp != 1001 {
+		t.Errorf("Expected the queued record to be written on close, got %v, %v", latest, err)
+	}
+}
+
+func TestAppendAsyncBackpressure(t *testing.T) {
+	testDir := "../../../b_go_test_data_async_backpressure"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{AsyncBufferSize: 2, AsyncBatchSize: 1})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	// Stall the background writer in a callback of the first record
+	stalled := make(chan struct{})
+	release := make(chan struct{})
+	db.OnAppend(func(rec hocdb.Record) {
+		if rec.Timestamp() == 1 {
+			close(stalled)
+			<-release
+		}
+	})
+
+	var full bool
+	for i := 1; i <= 10; i++ {
+		record, _ := hocdb.CreateRecordBytes(schema, int64(i), float64(i))
+		err := db.AppendAsync(record)
+		if i == 1 {
+			<-stalled
+		}
+		if errors.Is(err, hocdb.ErrBufferFull) {
+			full = true
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to queue record %d: %v", i, err)
+		}
+	}
+	close(release)
+	if !full {
+		t.Errorf("Expected ErrBufferFull while the writer is stalled")
+	}
+	if err := db.Flush(); err != nil {
+		t.Errorf("Failed to flush: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"os"
+	"testing"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+
+	testDir := "../../../b_go_test_data_snapshot"
+	snapDir := testDir + "/snap"
+	restoreDir := testDir + "/restored"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New("SNAP_TEST", testDir+"/live", schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	for i := 1; i <= 5; i++ {
+		record, _ := hocdb.CreateRecordBytes(schema, int64(i), float64(i))
+		if err := db.Append(record); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+
+	if err := db.Snapshot(snapDir); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	// Writes after the snapshot must not leak into it
+	record, _ := hocdb.CreateRecordBytes(schema, int64(6), 6.0)
+	if err := db.Append(record); err != nil {
+		t.Fatalf("Failed to append after snapshot: %v", err)
+	}
+
+	if err := db.Snapshot(snapDir); err == nil {
+		t.Error("Expected error when snapshotting into a directory that already holds the ticker")
+	}
+
+	if err := hocdb.Restore(snapDir, restoreDir); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if err := hocdb.Restore(snapDir, restoreDir); err == nil {
+		t.Error("Expected error when restoring over an existing ticker")
+	}
+
+	restored, err := hocdb.New("SNAP_TEST", restoreDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open restored DB: %v", err)
+	}
+	defer restored.Close()
+
+	data, err := restored.Load()
+	if err != nil {
+		t.Fatalf("Failed to load restored DB: %v", err)
+	}
+
+	recordSize := 16
+	if len(data) != 5*recordSize {
+		t.Errorf("Expected 5 records in restored DB, got %d bytes", len(data))
+	}
+}
+
+func TestBackupToRestoreFrom(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+
+	testDir := "../../../b_go_test_data_backup_stream"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New("STREAM_TEST", testDir+"/live", schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	for i := 1; i <= 3; i++ {
+		record, _ := hocdb.CreateRecordBytes(schema, int64(i), float64(i))
+		db.Append(record)
+	}
+
+	var buf bytes.Buffer
+	if err := db.BackupTo(&buf); err != nil {
+		t.Fatalf("BackupTo failed: %v", err)
+	}
+
+	if err := hocdb.RestoreFrom(bytes.NewReader(buf.Bytes()), testDir+"/restored"); err != nil {
+		t.Fatalf("RestoreFrom failed: %v", err)
+	}
+	if err := hocdb.RestoreFrom(bytes.NewReader(buf.Bytes()), testDir+"/restored"); err == nil {
+		t.Error("Expected error when restoring over an existing ticker")
+	}
+
+	restored, err := hocdb.New("STREAM_TEST", testDir+"/restored", schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open restored DB: %v", err)
+	}
+	defer restored.Close()
+
+	data, _ := restored.Load()
+	if len(data) != 3*16 {
+		t.Errorf("Expected 3 records in restored DB, got %d bytes", len(data))
+	}
+}
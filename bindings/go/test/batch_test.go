@@ -0,0 +1,178 @@
+package hocdb_test
+
+import (
+	"errors"
+	"fmt"
+	"hocdb"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	testDir := "../../../b_go_test_data_batch"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	tradeSchema := []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}, {Name: "qty", Type: hocdb.TypeF64}}
+	positionSchema := []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}, {Name: "position", Type: hocdb.TypeF64}}
+	trades, err := hocdb.New("TRADES", testDir, tradeSchema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	positions, err := hocdb.New("POSITIONS", testDir, positionSchema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	count := func(db *hocdb.DB) int {
+		data, err := db.Load()
+		if err != nil {
+			t.Fatalf("Failed to load: %v", err)
+		}
+		return len(data) / db.RecordSize()
+	}
+
+	var appended int
+	trades.OnAppend(func(hocdb.Record) { appended++ })
+	batch := hocdb.NewBatch()
+	for i := 1; i <= 3; i++ {
+		if err := batch.AppendValues(trades, int64(i), 1.0); err != nil {
+			t.Fatalf("Failed to add to batch: %v", err)
+		}
+		if err := batch.AppendValues(positions, int64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to add to batch: %v", err)
+		}
+	}
+	if err := batch.Append(trades, []byte{1, 2, 3}); err == nil {
+		t.Errorf("Expected an error for an invalid record size")
+	}
+	if count(trades) != 0 {
+		t.Errorf("Expected nothing written before Commit")
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if count(trades) != 3 || count(positions) != 3 || appended != 3 {
+		t.Errorf("Expected 3 records in each database and 3 callbacks, got %d, %d and %d", count(trades), count(positions), appended)
+	}
+	if err := batch.Commit(); err == nil {
+		t.Errorf("Expected an error committing twice")
+	}
+
+	// A record out of order in one database fails the whole batch
+	batch = hocdb.NewBatch()
+	batch.AppendValues(trades, int64(4), 1.0)
+	batch.AppendValues(positions, int64(3), 4.0)
+	var orderErr *hocdb.TimestampOrderError
+	if err := batch.Commit(); !errors.As(err, &orderErr) {
+		t.Errorf("Expected a TimestampOrderError, got %v", err)
+	}
+	if count(trades) != 3 || count(positions) != 3 {
+		t.Errorf("Expected no records of the failed batch, got %d and %d", count(trades), count(positions))
+	}
+
+	// A journal left by a commit interrupted before its marker rolls the records back
+	info, err := os.Stat(filepath.Join(testDir, "POSITIONS.bin"))
+	if err != nil {
+		t.Fatalf("Failed to stat: %v", err)
+	}
+	if err := positions.AppendValues(int64(4), 4.0); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	positions.Close()
+	journal := fmt.Sprintf(`{"size":%d,"marker":%q}`, info.Size(), filepath.Join(testDir, ".batch-0.committed"))
+	if err := os.WriteFile(filepath.Join(testDir, ".POSITIONS.batch"), []byte(journal), 0644); err != nil {
+		t.Fatalf("Failed to write journal: %v", err)
+	}
+	positions, err = hocdb.New("POSITIONS", testDir, positionSchema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer positions.Close()
+	if n := count(positions); n != 3 {
+		t.Errorf("Expected the interrupted commit rolled back to 3 records, got %d", n)
+	}
+	if _, err := os.Stat(filepath.Join(testDir, ".POSITIONS.batch")); !os.IsNotExist(err) {
+		t.Errorf("Expected the journal to be removed, got %v", err)
+	}
+	if tickers, _ := hocdb.ListTickers(testDir); len(tickers) != 2 {
+		t.Errorf("Expected only the two tickers, got %v", tickers)
+	}
+	trades.Close()
+
+	ring, err := hocdb.New("RING", testDir, tradeSchema, hocdb.Options{OverwriteFull: true})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer ring.Close()
+	if err := hocdb.NewBatch().AppendValues(ring, int64(1), 1.0); err == nil {
+		t.Errorf("Expected an error for a database with OverwriteFull")
+	}
+}
+
+func TestBatchLeftoverMarker(t *testing.T) {
+	testDir := "../../../b_go_test_data_batch_marker"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+	otherDir := filepath.Join(testDir, "other")
+	if err := os.MkdirAll(otherDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	schema := []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}, {Name: "qty", Type: hocdb.TypeF64}}
+	abs := func(name string) string {
+		p, err := filepath.Abs(name)
+		if err != nil {
+			t.Fatalf("Failed to resolve %s: %v", name, err)
+		}
+		return p
+	}
+	writeFile := func(name, data string) {
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	// A crash after the journals of a commit were removed left its marker
+	done := filepath.Join(testDir, ".batch-1.committed")
+	writeFile(done, fmt.Sprintf(`{"journals":[%q,%q]}`, abs(filepath.Join(testDir, ".TRADES.batch")), abs(filepath.Join(otherDir, ".OTHER.batch"))))
+	// A commit whose journal in another directory still needs the marker
+	pending := filepath.Join(testDir, ".batch-2.committed")
+	writeFile(pending, fmt.Sprintf(`{"journals":[%q]}`, abs(filepath.Join(otherDir, ".OTHER.batch"))))
+	writeFile(filepath.Join(otherDir, ".OTHER.batch"), fmt.Sprintf(`{"size":0,"marker":%q}`, abs(pending)))
+	// A marker of a commit from before markers listed their journals
+	legacy := filepath.Join(testDir, ".batch-3.committed")
+	writeFile(legacy, "")
+
+	db, err := hocdb.New("TRADES", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := os.Stat(done); !os.IsNotExist(err) {
+		t.Errorf("Expected the leftover marker to be removed, got %v", err)
+	}
+	if _, err := os.Stat(pending); err != nil {
+		t.Errorf("Expected the marker a journal refers to to be kept, got %v", err)
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		t.Errorf("Expected the marker without journals to be kept, got %v", err)
+	}
+
+	// A commit leaves neither journals nor a marker behind
+	batch := hocdb.NewBatch()
+	if err := batch.AppendValues(db, int64(1), 1.0); err != nil {
+		t.Fatalf("Failed to add to batch: %v", err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	markers, _ := filepath.Glob(filepath.Join(testDir, ".batch-*.committed"))
+	if len(markers) != 2 {
+		t.Errorf("Expected only the two markers kept, got %v", markers)
+	}
+	if _, err := os.Stat(filepath.Join(testDir, ".TRADES.batch")); !os.IsNotExist(err) {
+		t.Errorf("Expected the journal to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package hocdb_test
+
+import (
+	"fmt"
+	"hocdb"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBloomFilters(t *testing.T) {
+	testDir := "../../../b_go_test_data_bloom"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "event", Type: hocdb.StringType(16)},
+	}
+	for _, fields := range [][]string{{"missing"}, {"price"}} {
+		options := hocdb.Options{Compression: &hocdb.Compression{Codec: "deflate", BloomFilters: fields}}
+		if _, err := hocdb.New("BTC_USD", testDir, schema, options); err == nil {
+			t.Errorf("Expected an error for bloom filters on %v", fields)
+		}
+	}
+
+	var slow []hocdb.SlowQuery
+	options := hocdb.Options{
+		Compression:        &hocdb.Compression{Codec: "deflate", SegmentRecords: 1000, BloomFilters: []string{"event"}},
+		SlowQueryThreshold: 1,
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Drop()
+	db.OnSlowQuery(func(q hocdb.SlowQuery) { slow = append(slow, q) })
+	for i := 1; i <= 5000; i++ {
+		event := "trade"
+		if i == 3500 || i == 4500 {
+			event = "liquidation"
+		}
+		if err := db.AppendValues(int64(i), float64(i), event); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	for seq := 1; seq <= 4; seq++ {
+		if _, err := os.Stat(filepath.Join(testDir, fmt.Sprintf("BTC_USD.%010d.bloom", seq))); err != nil {
+			t.Errorf("Expected bloom filters for segment %d: %v", seq, err)
+		}
+	}
+
+	// Only the fourth of the four segments can hold a liquidation
+	data, err := db.Query(0, 10000, map[string]interface{}{"event": "liquidation"})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if len(data) != 2*db.RecordSize() {
+		t.Errorf("Expected 2 liquidations, got %d bytes", len(data))
+	}
+	if len(slow) != 1 || slow[0].BlocksScanned != 1 || slow[0].BlocksPruned != 3 {
+		t.Errorf("Expected 1 segment scanned and 3 pruned, got %+v", slow)
+	}
+	// The engine reports the records it returned from the data file as read
+	if slow[0].RowsScanned != 1000+1 {
+		t.Errorf("Expected the pruned segments not to be read, got %d rows scanned", slow[0].RowsScanned)
+	}
+
+	slow = nil
+	data, err = db.Query(0, 10000, map[string]interface{}{"event": "trade"})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if len(data) != 4998*db.RecordSize() {
+		t.Errorf("Expected 4998 trades, got %d bytes", len(data))
+	}
+	if len(slow) != 1 || slow[0].BlocksScanned != 4 || slow[0].BlocksPruned != 0 {
+		t.Errorf("Expected 4 segments scanned, got %+v", slow)
+	}
+}
@@ -0,0 +1,91 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestBytesField(t *testing.T) {
+	testDir := "../../../b_go_test_data_bytes"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema, err := hocdb.ParseSchema("timestamp:i64,book:bytes,tag:bytes(4)")
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+	if schema[1].Type != hocdb.TypeBytes || schema[2].Type != hocdb.BytesType(4) || schema[2].Type.String() != "bytes(4)" {
+		t.Errorf("Unexpected types: %v", schema)
+	}
+	if size := hocdb.RecordSize(schema); size != 8+258+6 {
+		t.Errorf("Expected record size 272, got %d", size)
+	}
+	if _, err := hocdb.CreateRecordBytes(schema, int64(1), []byte{}, []byte("12345")); err == nil {
+		t.Errorf("Expected an error for a blob longer than the field")
+	}
+	if _, err := hocdb.CreateRecordBytes(schema, int64(1), "text", []byte{}); err == nil {
+		t.Errorf("Expected an error for a string in a bytes field")
+	}
+
+	db, err := hocdb.New("BOOK", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	// Zero bytes in the payload survive, unlike in strings
+	book := bytes.Repeat([]byte{0, 1, 2, 0xff}, 64)
+	if err := db.AppendValues(int64(1), book, []byte{0, 0}); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if err := db.AppendValues(int64(2), []byte{}, []byte("abcd")); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+
+	data, err := db.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	records, err := hocdb.DecodeRecords(schema, data)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	want := [][]interface{}{
+		{int64(1), book, []byte{0, 0}},
+		{int64(2), []byte{}, []byte("abcd")},
+	}
+	for i, rec := range records {
+		if !reflect.DeepEqual(rec.Values, want[i]) {
+			t.Errorf("Expected record %v, got %v", want[i], rec.Values)
+		}
+	}
+
+	// Exports write blobs in base64, which imports read back
+	var buf bytes.Buffer
+	if err := db.ExportJSON(&buf, 0, 10); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	copyDir := testDir + "/copy"
+	cp, err := hocdb.New("BOOK", copyDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer cp.Close()
+	if _, err := cp.ImportJSON(&buf); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	copied, err := cp.Load()
+	if err != nil || !bytes.Equal(copied, data) {
+		t.Errorf("Expected the imported records to match, got %v", err)
+	}
+
+	if v, err := hocdb.ParseValue(hocdb.BytesType(4), "YWJjZA=="); err != nil || !bytes.Equal(v.([]byte), []byte("abcd")) {
+		t.Errorf("Unexpected parsed value %v, %v", v, err)
+	}
+	if _, err := hocdb.ParseValue(hocdb.BytesType(4), "YWJjZGU="); err == nil {
+		t.Errorf("Expected an error for a value longer than the field")
+	}
+}
@@ -0,0 +1,75 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"os"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestCalendarBuckets(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Failed to load location: %v", err)
+	}
+
+	// Hourly buckets keep to the wall clock across the end of DST
+	hourly := hocdb.Bucket(time.Hour, ny)
+	at := time.Date(2024, 11, 3, 0, 30, 0, 0, ny)
+	if start, end := hourly.Start(at), hourly.End(at); !start.Equal(time.Date(2024, 11, 3, 0, 0, 0, 0, ny)) || end.Sub(start) != time.Hour {
+		t.Errorf("Unexpected bucket %v to %v", start, end)
+	}
+	daily := hocdb.Bucket(24*time.Hour, ny)
+	if start, end := daily.Start(at), daily.End(at); end.Sub(start) != 25*time.Hour {
+		t.Errorf("Expected the day DST ends to last 25 hours, got %v to %v", start, end)
+	}
+	weekly := hocdb.Bucket(7*24*time.Hour, ny)
+	if start := weekly.Start(at); start.Weekday() != time.Monday || !start.Equal(time.Date(2024, 10, 28, 0, 0, 0, 0, ny)) {
+		t.Errorf("Expected the week to start on Monday, got %v", start)
+	}
+	bars := hocdb.Bucket(30*time.Minute, nil)
+	if start := bars.Start(time.Date(2024, 1, 1, 9, 59, 59, 0, time.UTC)); !start.Equal(time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected bucket start %v", start)
+	}
+
+	testDir := "../../../b_go_test_data_calendar"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}, {Name: "price", Type: hocdb.TypeF64}}
+	db, err := hocdb.New("CALENDAR", testDir, schema, hocdb.Options{TimestampPrecision: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	// One record every 6 hours from New York midnight, over two days
+	open := time.Date(2024, 3, 4, 0, 0, 0, 0, ny)
+	for i := 0; i < 8; i++ {
+		if err := db.AppendValues(open.Add(time.Duration(i)*6*time.Hour), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+
+	// The UTC day of 2024-03-05 05:00 is the New York day of 2024-03-05
+	data, err := db.QueryDay(time.Date(2024, 3, 5, 5, 0, 0, 0, time.UTC), ny, nil)
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	records, err := hocdb.DecodeRecords(schema, data)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(records) != 4 || records[0].Values[1] != 4.0 {
+		t.Errorf("Expected the records of the second day, got %v", records)
+	}
+
+	buckets, err := db.GetStatsBuckets(open, open.AddDate(0, 0, 2), daily, 1)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if len(buckets) != 2 || buckets[0].Sum != 6 || buckets[1].Sum != 22 || !buckets[1].Start.Equal(open.AddDate(0, 0, 1)) {
+		t.Errorf("Unexpected daily stats %+v", buckets)
+	}
+}
@@ -0,0 +1,118 @@
+package hocdb_test
+
+import (
+	"errors"
+	"fmt"
+	"hocdb"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestCatalog(t *testing.T) {
+	testDir := "../../../b_go_test_data_catalog"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	if _, err := hocdb.OpenCatalog(testDir, hocdb.Options{}, 0); err == nil {
+		t.Errorf("Expected an error for a catalog without open databases")
+	}
+	catalog, err := hocdb.OpenCatalog(testDir, hocdb.Options{}, 2)
+	if err != nil {
+		t.Fatalf("Failed to open catalog: %v", err)
+	}
+
+	schema := []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}, {Name: "price", Type: hocdb.TypeF64}}
+	tickers := []string{"BTC_USD", "ETH_USD", "SOL_USD"}
+	for _, ticker := range tickers {
+		if err := catalog.Create(ticker, schema); err != nil {
+			t.Fatalf("Failed to create %s: %v", ticker, err)
+		}
+	}
+	if err := catalog.Create("../escape", schema); err == nil {
+		t.Errorf("Expected an error for a ticker outside the directory")
+	}
+	if err := catalog.Append("XRP_USD", nil); !errors.Is(err, hocdb.ErrUnknownTicker) {
+		t.Errorf("Expected ErrUnknownTicker, got %v", err)
+	}
+	if err := catalog.Create("BTC_USD", []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}}); !errors.Is(err, hocdb.ErrSchemaMismatch) {
+		t.Errorf("Expected a schema mismatch, got %v", err)
+	}
+
+	// Appends from several goroutines to more tickers than stay open
+	var wg sync.WaitGroup
+	for _, ticker := range tickers {
+		wg.Add(1)
+		go func(ticker string) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				record, _ := hocdb.CreateRecordBytes(schema, int64(i+1), float64(i))
+				if err := catalog.Append(ticker, record); err != nil {
+					t.Errorf("Failed to append to %s: %v", ticker, err)
+					return
+				}
+			}
+		}(ticker)
+	}
+	wg.Wait()
+
+	for _, ticker := range tickers {
+		data, err := catalog.Query(ticker, 0, 10000, nil)
+		if err != nil {
+			t.Fatalf("Failed to query %s: %v", ticker, err)
+		}
+		if n := len(data) / hocdb.RecordSize(schema); n != 50 {
+			t.Errorf("Expected 50 records for %s, got %d", ticker, n)
+		}
+	}
+
+	// The least recently used ticker was closed, so another handle can open it
+	db, _, err := hocdb.OpenExisting(tickers[0], testDir)
+	if err != nil {
+		t.Fatalf("Expected %s to be closed: %v", tickers[0], err)
+	}
+	db.Close()
+
+	if got, err := catalog.Tickers(); err != nil || !reflect.DeepEqual(got, tickers) {
+		t.Errorf("Expected tickers %v, got %v, %v", tickers, got, err)
+	}
+	stats, err := catalog.GetStats("SOL_USD", 0, 10000, 1)
+	if err != nil || stats.Count != 50 {
+		t.Errorf("Unexpected stats %+v, %v", stats, err)
+	}
+
+	catalog.Close()
+	if err := catalog.AppendValues("BTC_USD", int64(5000), 1.0); err == nil {
+		t.Errorf("Expected an error appending to a closed catalog")
+	}
+
+	// A new catalog opens the existing tickers with their recorded schema
+	catalog, err = hocdb.OpenCatalog(testDir, hocdb.Options{}, 1)
+	if err != nil {
+		t.Fatalf("Failed to open catalog: %v", err)
+	}
+	defer catalog.Close()
+	for _, ticker := range tickers {
+		got, err := catalog.Schema(ticker)
+		if err != nil || !reflect.DeepEqual(got, schema) {
+			t.Errorf("Expected schema %v for %s, got %v, %v", schema, ticker, got, err)
+		}
+	}
+	if err := catalog.AppendValues("BTC_USD", int64(5000), 1.0); err != nil {
+		t.Errorf("Failed to append: %v", err)
+	}
+	err = catalog.Do("BTC_USD", func(db *hocdb.DB) error {
+		latest, err := db.GetLatestByName("price")
+		if err != nil {
+			return err
+		}
+		if latest.Timestamp != 5000 {
+			return fmt.Errorf("unexpected latest %+v", latest)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Failed to get latest: %v", err)
+	}
+}
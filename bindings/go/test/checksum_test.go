@@ -0,0 +1,82 @@
+package hocdb_test
+
+import (
+	"errors"
+	"hocdb"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyChecksums(t *testing.T) {
+	testDir := "../../../b_go_test_data_checksum"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}, {Name: "price", Type: hocdb.TypeF64}}
+	options := hocdb.Options{VerifyChecksums: true}
+	db, err := hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	for i := 1; i <= 2500; i++ {
+		if err := db.AppendValues(int64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if _, err := db.Load(); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	db.Close()
+
+	// Flip a bit in a price of the second block
+	file := filepath.Join(testDir, "BTC_USD.bin")
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Failed to read data file: %v", err)
+	}
+	data[12+1500*16+8] ^= 1
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	db, err = hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db.Close()
+	if data, err := db.Query(1, 1000, nil); err != nil || len(data) != 999*16 {
+		t.Errorf("Expected the first block to read fine, got %d bytes, %v", len(data), err)
+	}
+	if data, err := db.Query(2100, 2500, nil); err != nil || len(data) != 400*16 {
+		t.Errorf("Expected the incomplete block to read fine, got %d bytes, %v", len(data), err)
+	}
+	var corruptErr *hocdb.CorruptError
+	if _, err := db.Query(1000, 1100, nil); !errors.As(err, &corruptErr) || !errors.Is(err, hocdb.ErrCorrupt) {
+		t.Fatalf("Expected a CorruptError, got %v", err)
+	}
+	if corruptErr.StartTs != 1025 || corruptErr.EndTs != 2048 {
+		t.Errorf("Expected the block of timestamps 1025 to 2048, got %d to %d", corruptErr.StartTs, corruptErr.EndTs)
+	}
+	if _, err := db.GetStats(0, 3000, 1); !errors.Is(err, hocdb.ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt from GetStats, got %v", err)
+	}
+
+	report, err := db.Verify()
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if len(report.Problems) != 1 {
+		t.Errorf("Expected one corrupt block, got %v", report.Problems)
+	}
+	if _, err := db.Repair(); err == nil {
+		t.Errorf("Expected Repair to refuse corrupt blocks")
+	}
+
+	if _, err := hocdb.New("ETH_USD", testDir, schema, hocdb.Options{VerifyChecksums: true, OverwriteFull: true}); err == nil {
+		t.Errorf("Expected an error for checksums with OverwriteFull")
+	}
+}
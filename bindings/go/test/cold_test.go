@@ -0,0 +1,145 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"context"
+	"hocdb"
+	"hocdb/hocdbtest"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memStore is an ObjectStore in memory that counts downloads
+type memStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	gets    int
+}
+
+func (m *memStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = data
+	return nil
+}
+
+func (m *memStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	m.gets++
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func TestColdStorage(t *testing.T) {
+	testDir := "../../../b_go_test_data_cold"
+	cacheDir := "../../../b_go_test_data_cold_cache"
+	os.RemoveAll(testDir)
+	os.RemoveAll(cacheDir)
+	defer os.RemoveAll(testDir)
+	defer os.RemoveAll(cacheDir)
+
+	store := &memStore{objects: make(map[string][]byte)}
+	options := hocdb.Options{
+		Compression: &hocdb.Compression{Codec: "deflate", SegmentRecords: 10},
+		ColdStorage: &hocdb.ColdStorage{Store: store, Prefix: "db1/", KeepLocal: 1},
+	}
+	db, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	for i := 1; i <= 50; i++ {
+		if err := db.AppendValues(int64(i), float64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	want, err := db.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+
+	// Four segments, of which all but the newest are replaced by stubs
+	segments, err := db.Segments()
+	if err != nil || len(segments) != 4 {
+		t.Fatalf("Expected 4 segments, got %d, %v", len(segments), err)
+	}
+	for i, s := range segments {
+		info, err := os.Stat(s.Path)
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", s.Path, err)
+		}
+		if i == 3 {
+			if s.Key != "" || info.Size() != s.Size {
+				t.Errorf("Expected the newest segment to stay local, got %+v", s)
+			}
+			continue
+		}
+		if !strings.HasPrefix(s.Key, "db1/") || int64(len(store.objects[s.Key])) != s.Size || info.Size() >= s.Size {
+			t.Errorf("Expected segment %d in cold storage with a stub, got %+v of %d bytes", i, s, info.Size())
+		}
+	}
+	if got, err := db.Load(); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Expected the 50 records from all tiers, got %d bytes, %v", len(got), err)
+	}
+	db.Close()
+
+	// Another cache fetches the segments a query needs once
+	options.ColdStorage.CacheDir = cacheDir
+	db, err = hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, options)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db.Close()
+	gets := store.gets
+	if data, err := db.Query(35, math.MaxInt64, nil); err != nil || len(data) != 16*24 {
+		t.Errorf("Expected 16 records, got %d bytes, %v", len(data), err)
+	}
+	if store.gets != gets {
+		t.Errorf("Expected no download for the local records, got %d", store.gets-gets)
+	}
+	for i := 0; i < 2; i++ {
+		if got, err := db.Load(); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("Expected the 50 records, got %d bytes, %v", len(got), err)
+		}
+	}
+	if store.gets != gets+3 {
+		t.Errorf("Expected 3 downloads, got %d", store.gets-gets)
+	}
+
+	// Read-only handles can't fetch them
+	reader, err := hocdb.OpenReadOnly(hocdbtest.Ticker, testDir, hocdbtest.TickSchema)
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	if _, err := reader.Load(); err == nil || !strings.Contains(err.Error(), "cold storage") {
+		t.Errorf("Expected reading cold segments read-only to fail, got %v", err)
+	}
+	reader.Close()
+
+	// Dropping the database deletes its objects
+	db.Drop()
+	if len(store.objects) != 0 {
+		t.Errorf("Expected the objects to be deleted, got %d", len(store.objects))
+	}
+}
@@ -0,0 +1,95 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestColumnar(t *testing.T) {
+	testDir := "../../../b_go_test_data_columnar"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "qty", Type: hocdb.TypeI32, Nullable: true},
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{Columnar: true})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	for i := 1; i <= 1000; i++ {
+		var qty interface{}
+		if i%2 == 0 {
+			qty = int32(i)
+		}
+		if err := db.AppendValues(int64(i), float64(i), qty); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+
+	// Stats see appends that weren't flushed yet
+	stats, err := db.GetStats(100, 200, 1)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Count != 100 || stats.Min != 100 || stats.Max != 199 || stats.Mean != 149.5 {
+		t.Errorf("Expected stats of prices 100 to 199, got %+v", stats)
+	}
+	stats, err = db.GetStats(0, 2000, 2)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Count != 500 || stats.Min != 2 || stats.Max != 1000 {
+		t.Errorf("Expected stats skipping null quantities, got %+v", stats)
+	}
+	for name, size := range map[string]int64{"BTC_USD.0.col": 8, "BTC_USD.1.col": 8, "BTC_USD.2.col": 4, "BTC_USD.nulls.col": 1} {
+		info, err := os.Stat(filepath.Join(testDir, name))
+		if err != nil {
+			t.Fatalf("Failed to stat column file: %v", err)
+		}
+		if info.Size() != 1000*size {
+			t.Errorf("Expected %s to hold 1000 values, got %d bytes", name, info.Size())
+		}
+	}
+	db.Close()
+
+	// Column files are kept in step without Columnar while they exist
+	db, err = hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	for i := 1001; i <= 1100; i++ {
+		if err := db.AppendValues(int64(i), float64(i), int32(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if stats, err := db.GetStats(900, 2000, 1); err != nil || stats.Count != 201 || stats.Max != 1100 {
+		t.Errorf("Expected stats of prices 900 to 1100, got %+v, %v", stats, err)
+	}
+	if info, err := os.Stat(filepath.Join(testDir, "BTC_USD.1.col")); err != nil || info.Size() != 1100*8 {
+		t.Errorf("Expected the price column to hold 1100 values, got %v", err)
+	}
+
+	// Schema changes rebuild the columns
+	if err := db.DropField("qty"); err != nil {
+		t.Fatalf("Failed to drop field: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(testDir, "BTC_USD.nulls.col")); !os.IsNotExist(err) {
+		t.Errorf("Expected the null bitmaps column to be removed, got %v", err)
+	}
+	if stats, err := db.GetStats(0, 2000, 1); err != nil || stats.Count != 1100 {
+		t.Errorf("Expected stats over 1100 prices, got %+v, %v", stats, err)
+	}
+	db.Drop()
+	if files, _ := filepath.Glob(filepath.Join(testDir, "*.col")); len(files) != 0 {
+		t.Errorf("Expected Drop to remove the column files, got %v", files)
+	}
+
+	if _, err := hocdb.New("ETH_USD", testDir, schema, hocdb.Options{Columnar: true, OverwriteFull: true}); err == nil {
+		t.Errorf("Expected an error for a columnar layout with OverwriteFull")
+	}
+}
@@ -0,0 +1,234 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	testDir := "../../../b_go_test_data_compress"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}, {Name: "price", Type: hocdb.TypeF64}}
+	options := hocdb.Options{Compression: &hocdb.Compression{Codec: "deflate", SegmentRecords: 100}}
+	db, err := hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	for i := 1; i <= 350; i++ {
+		if err := db.AppendValues(int64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	full, err := os.ReadFile(filepath.Join(testDir, "BTC_USD.bin"))
+	if err != nil {
+		t.Fatalf("Failed to read data file: %v", err)
+	}
+	if len(full) != 12+150*16 {
+		t.Errorf("Expected 150 records left in the data file, got %d bytes", len(full))
+	}
+	segments, _ := filepath.Glob(filepath.Join(testDir, "BTC_USD.*.seg"))
+	if len(segments) != 2 {
+		t.Errorf("Expected 2 segments, got %v", segments)
+	}
+
+	check := func(db *hocdb.DB) {
+		t.Helper()
+		if data, err := db.Load(); err != nil || len(data) != 350*16 {
+			t.Errorf("Expected Load to return 350 records, got %d bytes, %v", len(data), err)
+		}
+		data, err := db.Query(150, 260, nil)
+		if err != nil || len(data) != 110*16 {
+			t.Fatalf("Expected 110 records across segments and the data file, got %d bytes, %v", len(data), err)
+		}
+		for i := 0; i < 110; i++ {
+			if ts := int64(data[i*16]) | int64(data[i*16+1])<<8; ts != int64(150+i) {
+				t.Fatalf("Expected record %d to have timestamp %d, got %d", i, 150+i, ts)
+			}
+		}
+		if data, err := db.Query(0, 1000, []hocdb.Filter{{FieldIndex: 1, Value: 42.0}}); err != nil || len(data) != 16 {
+			t.Errorf("Expected the filter to match one record in a segment, got %d bytes, %v", len(data), err)
+		}
+		stats, err := db.GetStats(0, 1000, 1)
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		if stats.Count != 350 || stats.Min != 1 || stats.Max != 350 || stats.Sum != 350*351/2 {
+			t.Errorf("Expected stats over all 350 records, got %+v", stats)
+		}
+		if latest, err := db.GetLatest(1); err != nil || latest.Timestamp != 350 {
+			t.Errorf("Expected the latest record at 350, got %+v, %v", latest, err)
+		}
+	}
+	check(db)
+	db.Close()
+
+	// Segments are read without Compression, and by read-only handles
+	db, err = hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	check(db)
+	if err := db.Compact(); err == nil {
+		t.Errorf("Expected Compact to fail without Compression")
+	}
+	ro, err := hocdb.OpenReadOnly("BTC_USD", testDir, schema)
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	check(ro)
+	ro.Close()
+	db.Close()
+
+	// A compaction interrupted before cutting the data file leaves records in both
+	data := make([]byte, 12+350*16)
+	copy(data, full[:12])
+	copy(data[12:], mustRecords(t, schema, 1, 350))
+	if err := os.WriteFile(filepath.Join(testDir, "BTC_USD.bin"), data, 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+	db, err = hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	check(db)
+
+	// Flushes compact in the background once two segments' worth accumulate
+	for i := 351; i <= 500; i++ {
+		if err := db.AppendValues(int64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	db.Close()
+	if segments, _ := filepath.Glob(filepath.Join(testDir, "BTC_USD.*.seg")); len(segments) != 4 {
+		t.Errorf("Expected 4 segments after the background compaction, got %v", segments)
+	}
+
+	db, err = hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	if data, err := db.Load(); err != nil || len(data) != 500*16 {
+		t.Errorf("Expected Load to return 500 records, got %d bytes, %v", len(data), err)
+	}
+	db.Drop()
+	if segments, _ := filepath.Glob(filepath.Join(testDir, "BTC_USD.*.seg")); len(segments) != 0 {
+		t.Errorf("Expected Drop to remove the segments, got %v", segments)
+	}
+
+	if _, err := hocdb.New("ETH_USD", testDir, schema, hocdb.Options{Compression: &hocdb.Compression{Codec: "snappy"}}); err == nil {
+		t.Errorf("Expected an error for an unknown codec")
+	}
+	if _, err := hocdb.New("ETH_USD", testDir, schema, hocdb.Options{Compression: &hocdb.Compression{Codec: "deflate"}, OverwriteFull: true}); err == nil {
+		t.Errorf("Expected an error for compression with OverwriteFull")
+	}
+}
+
+func TestGorillaEncoding(t *testing.T) {
+	testDir := "../../../b_go_test_data_gorilla"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "volume", Type: hocdb.TypeI64},
+		{Name: "side", Type: hocdb.TypeU8},
+	}
+	// Regular intervals with jitter, gaps and a large jump; prices that repeat,
+	// drift and jump to extremes
+	var want []byte
+	ts, price := int64(1_700_000_000_000), 100.0
+	for i := 0; i < 3000; i++ {
+		switch {
+		case i%500 == 499:
+			ts += 1 << 40
+		case i%97 == 0:
+			ts += 1000 + int64(i%300)
+		case i%13 == 0:
+			ts += 999
+		default:
+			ts += 1000
+		}
+		switch {
+		case i == 1500:
+			price = math.MaxFloat64
+		case i == 1501:
+			price = -0.0
+		case i%7 == 0:
+			price += 0.25
+		case i%11 == 0:
+			price = math.Round(price*1.01*100) / 100
+		}
+		rec, err := hocdb.CreateRecordBytes(schema, ts, price, int64(i*i), uint8(i%2))
+		if err != nil {
+			t.Fatalf("Failed to create record: %v", err)
+		}
+		want = append(want, rec...)
+	}
+
+	sizes := make(map[string]int64)
+	for _, encoding := range []string{"", hocdb.EncodingGorilla} {
+		options := hocdb.Options{Compression: &hocdb.Compression{Codec: "none", Encoding: encoding, SegmentRecords: 1000}}
+		db, err := hocdb.New("BTC_USD", testDir, schema, options)
+		if err != nil {
+			t.Fatalf("Failed to create DB: %v", err)
+		}
+		size := len(want) / 3000
+		for off := 0; off < len(want); off += size {
+			if err := db.Append(want[off : off+size]); err != nil {
+				t.Fatalf("Failed to append: %v", err)
+			}
+		}
+		if err := db.Compact(); err != nil {
+			t.Fatalf("Failed to compact: %v", err)
+		}
+		db.Close()
+
+		db, err = hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+		if err != nil {
+			t.Fatalf("Failed to reopen DB: %v", err)
+		}
+		if got, err := db.Load(); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("Encoding %q: expected the records back unchanged, got %d bytes, %v", encoding, len(got), err)
+		}
+		info, err := os.Stat(filepath.Join(testDir, "BTC_USD.0000000001.seg"))
+		if err != nil {
+			t.Fatalf("Failed to stat segment: %v", err)
+		}
+		sizes[encoding] = info.Size()
+		db.Drop()
+	}
+	if sizes[hocdb.EncodingGorilla]*2 > sizes[""] {
+		t.Errorf("Expected gorilla segments to be half the raw size or less, got %d and %d bytes", sizes[hocdb.EncodingGorilla], sizes[""])
+	}
+
+	if _, err := hocdb.New("ETH_USD", testDir, schema, hocdb.Options{Compression: &hocdb.Compression{Codec: "none", Encoding: "rle"}}); err == nil {
+		t.Errorf("Expected an error for an unknown encoding")
+	}
+}
+
+// mustRecords encodes records with timestamps and prices from first to last
+func mustRecords(t *testing.T, schema []hocdb.Field, first, last int) []byte {
+	t.Helper()
+	var data []byte
+	for i := first; i <= last; i++ {
+		rec, err := hocdb.CreateRecordBytes(schema, int64(i), float64(i))
+		if err != nil {
+			t.Fatalf("Failed to create record: %v", err)
+		}
+		data = append(data, rec...)
+	}
+	return data
+}
@@ -0,0 +1,98 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"math"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentUse(t *testing.T) {
+	testDir := "../../../b_go_test_data_concurrency"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "value", Type: hocdb.TypeF64},
+	}
+	// The engine assigns timestamps, so appends from any goroutine are in order
+	db, err := hocdb.New("CONCURRENT", testDir, schema, hocdb.Options{AutoIncrement: &hocdb.AutoIncrement{}})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	var appended sync.Map
+	db.OnAppend(func(rec hocdb.Record) {
+		// Callbacks may call back into the database
+		if _, err := db.GetStats(math.MinInt64, math.MaxInt64, 1); err != nil {
+			t.Errorf("Failed to get stats from a callback: %v", err)
+		}
+		if _, loaded := appended.LoadOrStore(rec.Timestamp(), true); loaded {
+			t.Errorf("Timestamp %d reported twice", rec.Timestamp())
+		}
+	})
+
+	const writers, perWriter = 8, 100
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				record, _ := hocdb.CreateRecordBytes(schema, int64(0), float64(i))
+				if err := db.Append(record); err != nil {
+					t.Errorf("Failed to append: %v", err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter/10; i++ {
+				if _, err := db.Query(math.MinInt64, math.MaxInt64, nil); err != nil {
+					t.Errorf("Failed to query: %v", err)
+					return
+				}
+				db.GetLatest(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, err := db.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	records, err := hocdb.DecodeRecords(schema, data)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(records) != writers*perWriter {
+		t.Errorf("Expected %d records, got %d", writers*perWriter, len(records))
+	}
+	for i, rec := range records {
+		if rec.Timestamp() != int64(i+1) {
+			t.Fatalf("Expected timestamp %d, got %d", i+1, rec.Timestamp())
+		}
+		if _, ok := appended.Load(rec.Timestamp()); !ok {
+			t.Errorf("No callback for timestamp %d", rec.Timestamp())
+		}
+	}
+
+	// Closing while other goroutines still use the handle is safe too
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			db.Query(math.MinInt64, math.MaxInt64, nil)
+		}
+	}()
+	db.Close()
+	wg.Wait()
+	if _, err := db.Query(math.MinInt64, math.MaxInt64, nil); err == nil {
+		t.Errorf("Expected an error querying a closed database")
+	}
+}
@@ -0,0 +1,154 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportCSV(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "event", Type: hocdb.TypeString},
+		{Name: "active", Type: hocdb.TypeBool},
+	}
+
+	testDir := "../../../b_go_test_data_csv_export"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New("CSV_EXPORT", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	rec1, _ := hocdb.CreateRecordBytes(schema, int64(1620000000), 50000.5, "buy", true)
+	db.Append(rec1)
+	rec2, _ := hocdb.CreateRecordBytes(schema, int64(1620000001), 50001.0, "sell, all", false)
+	db.Append(rec2)
+
+	var buf bytes.Buffer
+	if err := db.ExportCSV(&buf, 0, 2000000000, hocdb.CSVOptions{}); err != nil {
+		t.Fatalf("ExportCSV failed: %v", err)
+	}
+
+	expected := "timestamp,price,event,active\n" +
+		"1620000000,50000.5,buy,true\n" +
+		"1620000001,50001,\"sell, all\",false\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected CSV output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	opts := hocdb.CSVOptions{NoHeader: true, TimestampRFC3339: true, TimestampUnit: time.Second}
+	if err := db.ExportCSV(&buf, 1620000001, 2000000000, opts); err != nil {
+		t.Fatalf("ExportCSV failed: %v", err)
+	}
+
+	expected = "2021-05-03T00:00:01Z,50001,\"sell, all\",false\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected RFC3339 CSV output:\n%s", buf.String())
+	}
+}
+
+func TestCSVTimestampPrecision(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+
+	testDir := "../../../b_go_test_data_csv_precision"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	// Without a TimestampUnit, RFC3339 timestamps are at the database's precision,
+	// nanoseconds when it has none
+	db, err := hocdb.New("CSV_PRECISION", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	at := time.Date(2021, 5, 3, 0, 0, 1, 500, time.UTC)
+	input := "timestamp,price\n" + at.Format(time.RFC3339Nano) + ",1.5\n"
+	result, err := db.ImportCSV(strings.NewReader(input), hocdb.CSVMapping{TimestampRFC3339: true})
+	if err != nil || result.Imported != 1 {
+		t.Fatalf("ImportCSV failed: %v %v", err, result)
+	}
+
+	data, err := db.QueryTime(at, at.Add(time.Nanosecond), nil)
+	if err != nil {
+		t.Fatalf("QueryTime failed: %v", err)
+	}
+	if len(data) != hocdb.RecordSize(schema) {
+		t.Fatalf("Expected the imported record at %v, got %d bytes", at, len(data))
+	}
+
+	var buf bytes.Buffer
+	if err := db.ExportCSV(&buf, 0, at.UnixNano()+1, hocdb.CSVOptions{NoHeader: true, TimestampRFC3339: true}); err != nil {
+		t.Fatalf("ExportCSV failed: %v", err)
+	}
+	if expected := "2021-05-03T00:00:01.0000005Z,1.5\n"; buf.String() != expected {
+		t.Errorf("Unexpected RFC3339 CSV output:\n%s", buf.String())
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "event", Type: hocdb.TypeString},
+	}
+
+	testDir := "../../../b_go_test_data_csv_import"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New("CSV_IMPORT", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	// Columns are out of order, "px" is renamed and line 4 has a bad price
+	input := "event,ts,px\n" +
+		"buy,100,1.5\n" +
+		"sell,200,2.5\n" +
+		"buy,300,oops\n" +
+		"sell,150,3.5\n" +
+		"buy,400,4.5\n"
+
+	mapping := hocdb.CSVMapping{
+		Columns:   map[string]string{"timestamp": "ts", "price": "px"},
+		BatchSize: 2,
+	}
+	result, err := db.ImportCSV(strings.NewReader(input), mapping)
+	if err != nil {
+		t.Fatalf("ImportCSV failed: %v", err)
+	}
+
+	if result.Imported != 3 {
+		t.Errorf("Expected 3 imported records, got %d", result.Imported)
+	}
+	// Line 4 fails to parse, line 5 is not monotonic
+	if len(result.Errors) != 2 || result.Errors[0].Line != 4 || result.Errors[1].Line != 5 {
+		t.Fatalf("Unexpected line errors: %v", result.Errors)
+	}
+
+	data, _ := db.Load()
+	records, err := hocdb.DecodeRecords(schema, data)
+	if err != nil {
+		t.Fatalf("DecodeRecords failed: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 stored records, got %d", len(records))
+	}
+	if records[2].Timestamp() != 400 || records[2].Values[2] != "buy" {
+		t.Errorf("Unexpected last record: %v", records[2].Values)
+	}
+}
@@ -0,0 +1,97 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDecimalField(t *testing.T) {
+	testDir := "../../../b_go_test_data_decimal"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema, err := hocdb.ParseSchema("timestamp:i64,price:decimal(2),qty:decimal")
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+	if schema[1].Type != hocdb.DecimalType(2) || schema[1].Type.Scale() != 2 || schema[2].Type != hocdb.TypeDecimal {
+		t.Errorf("Unexpected types: %v", schema)
+	}
+	if size := hocdb.RecordSize(schema); size != 24 {
+		t.Errorf("Expected record size 24, got %d", size)
+	}
+
+	// Values must be exact at the scale of the field
+	tenth := 0.1
+	for _, v := range []interface{}{"1.005", tenth + 0.2, "1e17", 1.5i} {
+		if _, err := hocdb.CreateRecordBytes(schema, int64(1), v, 0); err == nil {
+			t.Errorf("Expected an error for %v", v)
+		}
+	}
+	if _, err := hocdb.CreateRecordBytes(schema, int64(1), 1.5, 0); err != nil {
+		t.Errorf("Failed to encode 1.5: %v", err)
+	}
+
+	db, err := hocdb.New("LEDGER", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.AppendValues(int64(1), "19.99", 3); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if err := db.AppendValues(int64(2), big.NewRat(-1, 4), int64(-2)); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if err := db.AppendValues(int64(3), hocdb.Decimal{Unscaled: 5, Scale: 1}, uint8(1)); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+
+	data, err := db.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	records, err := hocdb.DecodeRecords(schema, data)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	var prices []string
+	for _, rec := range records {
+		prices = append(prices, rec.Values[1].(hocdb.Decimal).String())
+	}
+	if got := strings.Join(prices, " "); got != "19.99 -0.25 0.50" {
+		t.Errorf("Unexpected prices %s", got)
+	}
+	if d := records[0].Values[1].(hocdb.Decimal); d.Unscaled != 1999 || d.Rat().Cmp(big.NewRat(1999, 100)) != 0 {
+		t.Errorf("Unexpected decimal %+v", d)
+	}
+
+	// Filters take decimal values, stats are scaled
+	for _, filter := range []interface{}{"19.99", big.NewRat(1999, 100), hocdb.Decimal{Unscaled: 19990, Scale: 3}} {
+		data, err := db.Query(0, 10, map[string]interface{}{"price": filter})
+		if err != nil {
+			t.Fatalf("Failed to query: %v", err)
+		}
+		if records, _ := hocdb.DecodeRecords(schema, data); len(records) != 1 || records[0].Timestamp() != 1 {
+			t.Errorf("Expected record 1 for %v, got %v", filter, records)
+		}
+	}
+	stats, err := db.GetStatsByName(0, 10, "price")
+	if err != nil || stats.Min != -0.25 || stats.Max != 19.99 {
+		t.Errorf("Unexpected stats %+v, %v", stats, err)
+	}
+
+	// JSON holds the exact digits
+	var buf bytes.Buffer
+	if err := db.ExportJSON(&buf, 0, 2); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"price":19.99`) {
+		t.Errorf("Expected the exact price in %s", buf.String())
+	}
+}
@@ -0,0 +1,103 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDropAndRenameField(t *testing.T) {
+	testDir := "../../../b_go_test_data_drop_rename_field"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "side", Type: hocdb.TypeString},
+		{Name: "volume", Type: hocdb.TypeF64},
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer func() { db.Close() }()
+	for i := 1; i <= 3; i++ {
+		if err := db.AppendValues(int64(i), float64(i)*10, "buy", float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+
+	if err := db.RenameField("timestamp", "ts"); err == nil {
+		t.Errorf("Expected an error renaming the timestamp")
+	}
+	if err := db.RenameField("price", "side"); err == nil {
+		t.Errorf("Expected an error renaming to an existing field")
+	}
+	if err := db.RenameField("price", "close"); err != nil {
+		t.Fatalf("Failed to rename field: %v", err)
+	}
+	if _, ok := db.FieldIndex("close"); !ok {
+		t.Errorf("Expected field close after the rename")
+	}
+	stats, err := db.GetStatsByName(0, 10, "close")
+	if err != nil || stats.Max != 30 {
+		t.Errorf("Expected stats of the renamed field, got %v, %v", stats, err)
+	}
+	if _, err := db.Query(0, 10, map[string]interface{}{"price": 10.0}); err == nil {
+		t.Errorf("Expected an error filtering on the old name")
+	}
+
+	// Renaming leaves the data file alone, reopening maps the names again
+	renamed := []hocdb.Field{schema[0], {Name: "close", Type: hocdb.TypeF64}, schema[2], schema[3]}
+	db.Close()
+	if _, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{}); err == nil {
+		t.Fatalf("Expected the old schema to be refused")
+	}
+	db, found, err := hocdb.OpenExisting("BTC_USD", testDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	if !reflect.DeepEqual(found, renamed) {
+		t.Fatalf("Expected schema %v, got %v", renamed, found)
+	}
+	if err := db.AppendValues(int64(4), 40.0, "sell", 4.0); err != nil {
+		t.Fatalf("Failed to append after reopening: %v", err)
+	}
+
+	if err := db.DropField("timestamp"); err == nil {
+		t.Errorf("Expected an error dropping the timestamp")
+	}
+	if err := db.DropField("side"); err != nil {
+		t.Fatalf("Failed to drop field: %v", err)
+	}
+	want := []hocdb.Field{schema[0], {Name: "close", Type: hocdb.TypeF64}, schema[3]}
+	if !reflect.DeepEqual(db.Schema(), want) {
+		t.Fatalf("Expected schema %v, got %v", want, db.Schema())
+	}
+
+	data, err := db.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	records, err := hocdb.DecodeRecords(want, data)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("Expected 4 records, got %d", len(records))
+	}
+	for i, rec := range records {
+		n := float64(i + 1)
+		if !reflect.DeepEqual(rec.Values, []interface{}{int64(i + 1), n * 10, n}) {
+			t.Errorf("Unexpected record %d: %v", i, rec.Values)
+		}
+	}
+
+	db.Close()
+	db, err = hocdb.New("BTC_USD", testDir, want, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to reopen DB with the new schema: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDumpRecords(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "side", Type: hocdb.StringType(8)},
+		{Name: "payload", Type: hocdb.BytesType(4), Nullable: true},
+		{Name: "fee", Type: hocdb.DecimalType(2)},
+	}
+	ts := time.Date(2024, 3, 4, 12, 30, 0, 500, time.UTC)
+	first, _ := hocdb.CreateRecordBytes(schema, ts.UnixNano(), 100.5, "buy", []byte{0xca, 0xfe}, "1.25")
+	second, _ := hocdb.CreateRecordBytes(schema, ts.Add(time.Second).UnixNano(), 99.0, "a\tb", nil, "-3")
+
+	var out bytes.Buffer
+	if err := hocdb.DumpRecords(&out, schema, append(first, second...)); err != nil {
+		t.Fatalf("Failed to dump: %v", err)
+	}
+	want := "timestamp                     price  side    payload  fee\n" +
+		"2024-03-04T12:30:00.0000005Z  100.5  buy     0xcafe   1.25\n" +
+		"2024-03-04T12:30:01.0000005Z  99     \"a\\tb\"  NULL     -3.00\n"
+	if out.String() != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, out.String())
+	}
+	if err := hocdb.DumpRecords(&out, schema, first[:10]); err == nil {
+		t.Errorf("Expected a partial record to fail")
+	}
+
+	// Databases dump at their timestamp precision
+	testDir := "../../../b_go_test_data_dump"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+	db, err := hocdb.New("TICKS", testDir, schema[:3], hocdb.Options{TimestampPrecision: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+	if err := db.AppendValues(ts, 100.5, "buy"); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	out.Reset()
+	if err := db.Dump(&out, math.MinInt64, math.MaxInt64); err != nil {
+		t.Fatalf("Failed to dump: %v", err)
+	}
+	if want := "timestamp             price  side\n2024-03-04T12:30:00Z  100.5  buy\n"; out.String() != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, out.String())
+	}
+}
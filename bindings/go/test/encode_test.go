@@ -0,0 +1,84 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"os"
+	"testing"
+)
+
+func TestEncodeRecordTo(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "side", Type: hocdb.TypeString},
+		{Name: "taker", Type: hocdb.TypeBool},
+	}
+
+	var buf []byte
+	var err error
+	for _, values := range [][]interface{}{
+		{int64(1), 1.5, "a long side name", true},
+		{int64(2), 2.5, "b", false},
+	} {
+		buf, err = hocdb.EncodeRecordTo(buf, schema, values...)
+		if err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		// Reusing the buffer leaves nothing of the previous record behind
+		want, _ := hocdb.CreateRecordBytes(schema, values...)
+		if !bytes.Equal(buf, want) {
+			t.Errorf("EncodeRecordTo(%v) = %x, want %x", values, buf, want)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = hocdb.EncodeRecordTo(buf, schema, int64(3), 3.5, "c", true)
+	})
+	if allocs > 0 {
+		t.Errorf("Expected no allocations when reusing the buffer, got %.0f", allocs)
+	}
+
+	if _, err := hocdb.EncodeRecordTo(buf, schema, int64(1)); err == nil {
+		t.Errorf("Expected an error for a missing value")
+	}
+	if _, err := hocdb.EncodeRecordTo(buf, schema, "x", 1.0, "a", true); err == nil {
+		t.Errorf("Expected an error for a wrong value type")
+	}
+}
+
+func TestAppendValues(t *testing.T) {
+	testDir := "../../../b_go_test_data_append_values"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "side", Type: hocdb.TypeString},
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.AppendValues(int64(1), 1.5, "buy"); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if err := db.AppendValues(int64(2), 2.5, "s"); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if err := db.AppendValues(int64(3), "oops", "sell"); err == nil {
+		t.Errorf("Expected an error for a wrong value type")
+	}
+
+	data, _ := db.Load()
+	records, err := hocdb.DecodeRecords(schema, data)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d, %v", len(records), err)
+	}
+	if side, _ := records[1].Get("side"); side != "s" {
+		t.Errorf("Unexpected side of the second record: %q", side)
+	}
+}
@@ -0,0 +1,182 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"errors"
+	"hocdb"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	testDir := "../../../b_go_test_data_encrypt"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}, {Name: "price", Type: hocdb.TypeF64}}
+	key := bytes.Repeat([]byte{1}, 32)
+	workDir := filepath.Join(testDir, "work")
+	os.MkdirAll(workDir, 0700)
+	options := hocdb.Options{EncryptionKey: key, EncryptionDir: workDir}
+	count := func(db *hocdb.DB) int {
+		data, err := db.Load()
+		if err != nil {
+			t.Fatalf("Failed to load: %v", err)
+		}
+		return len(data) / db.RecordSize()
+	}
+
+	// A database that wasn't encrypted is encrypted on open
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		if err := db.AppendValues(int64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	db.Close()
+	db, err = hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to open DB with a key: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(testDir, "BTC_USD.bin")); !os.IsNotExist(err) {
+		t.Errorf("Expected no plaintext data file, got %v", err)
+	}
+	if n := count(db); n != 5 {
+		t.Errorf("Expected 5 records, got %d", n)
+	}
+	for i := 6; i <= 10; i++ {
+		if err := db.AppendValues(int64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if _, err := hocdb.New("BTC_USD", testDir, schema, options); err == nil {
+		t.Errorf("Expected an error opening the database twice")
+	}
+	db.Close()
+
+	data, err := os.ReadFile(filepath.Join(testDir, "BTC_USD.bin.enc"))
+	if err != nil {
+		t.Fatalf("Failed to read encrypted file: %v", err)
+	}
+	if bytes.Contains(data, []byte("HOC1")) {
+		t.Errorf("Expected the encrypted file not to hold the plaintext header")
+	}
+	if entries, _ := os.ReadDir(workDir); len(entries) != 0 {
+		t.Errorf("Expected Close to remove the plaintext copy, got %d entries", len(entries))
+	}
+
+	if _, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{}); !errors.Is(err, hocdb.ErrEncryptionKey) {
+		t.Errorf("Expected ErrEncryptionKey without a key, got %v", err)
+	}
+	wrong := hocdb.Options{EncryptionKey: bytes.Repeat([]byte{2}, 32), EncryptionDir: workDir}
+	if _, err := hocdb.New("BTC_USD", testDir, schema, wrong); !errors.Is(err, hocdb.ErrEncryptionKey) {
+		t.Errorf("Expected ErrEncryptionKey with another key, got %v", err)
+	}
+
+	// Rotating the key re-encrypts the file
+	db, err = hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	if n := count(db); n != 10 {
+		t.Errorf("Expected 10 records, got %d", n)
+	}
+	if err := db.Rekey(wrong.EncryptionKey); err != nil {
+		t.Fatalf("Failed to rekey: %v", err)
+	}
+	if err := db.AppendValues(int64(11), 11.0); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	snapshot := filepath.Join(testDir, "snapshot")
+	if err := db.Snapshot(snapshot); err != nil {
+		t.Fatalf("Failed to snapshot: %v", err)
+	}
+	db.Close()
+	if _, err := hocdb.New("BTC_USD", testDir, schema, options); !errors.Is(err, hocdb.ErrEncryptionKey) {
+		t.Errorf("Expected ErrEncryptionKey with the old key, got %v", err)
+	}
+	for _, dir := range []string{testDir, snapshot} {
+		db, err = hocdb.New("BTC_USD", dir, schema, wrong)
+		if err != nil {
+			t.Fatalf("Failed to open DB with the new key: %v", err)
+		}
+		if n := count(db); n != 11 {
+			t.Errorf("Expected 11 records in %s, got %d", dir, n)
+		}
+		db.Close()
+	}
+
+	if _, err := hocdb.New("ETH_USD", testDir, schema, hocdb.Options{EncryptionKey: []byte("short")}); err == nil {
+		t.Errorf("Expected an error for an invalid key")
+	}
+}
+
+func TestEncryptionStaleWorkDir(t *testing.T) {
+	testDir := "../../../b_go_test_data_encrypt_stale"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}, {Name: "price", Type: hocdb.TypeF64}}
+	options := hocdb.Options{EncryptionKey: bytes.Repeat([]byte{1}, 32)}
+	workDirs := func() []string {
+		matches, _ := filepath.Glob(filepath.Join(testDir, "hocdb-BTC_USD-*"))
+		return matches
+	}
+
+	// Without an EncryptionDir the plaintext copy is next to the database
+	db, err := hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	if err := db.AppendValues(int64(1), 1.0); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	open := workDirs()
+	if len(open) != 1 {
+		t.Fatalf("Expected one working directory, got %v", open)
+	}
+
+	// Stand in for the copy a crashed process left behind
+	stale := strings.TrimRight(open[0], "0123456789") + "1"
+	if stale == open[0] {
+		stale += "1"
+	}
+	if err := os.Mkdir(stale, 0700); err != nil {
+		t.Fatalf("Failed to create stale directory: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(open[0], "BTC_USD.bin"))
+	if err != nil {
+		t.Fatalf("Failed to read plaintext copy: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(stale, "BTC_USD.bin"), data, 0600); err != nil {
+		t.Fatalf("Failed to write stale copy: %v", err)
+	}
+	other := filepath.Join(testDir, "hocdb-BTC_USD-other")
+	if err := os.Mkdir(other, 0700); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	db.Close()
+
+	db, err = hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale plaintext copy to be removed, got %v", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("Expected directories not left by the database to be kept, got %v", err)
+	}
+	db.Close()
+	if dirs := workDirs(); len(dirs) != 1 || dirs[0] != other {
+		t.Errorf("Expected Close to remove the plaintext copy, got %v", dirs)
+	}
+}
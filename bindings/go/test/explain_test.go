@@ -0,0 +1,95 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	testDir := "../../../b_go_test_data_explain"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "event", Type: hocdb.StringType(16)},
+	}
+	options := hocdb.Options{
+		ZoneMaps:    true,
+		Compression: &hocdb.Compression{Codec: "deflate", SegmentRecords: 5000, BloomFilters: []string{"event"}},
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Drop()
+	for i := 1; i <= 20000; i++ {
+		event := "trade"
+		if i == 12000 {
+			event = "liquidation"
+		}
+		if err := db.AppendValues(int64(i), float64(i), event); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+
+	// Segments hold 1 to 15000, the data file 15001 to 20000 in two blocks
+	plan, err := db.Explain(0, 30000, map[string]interface{}{"event": "liquidation"})
+	if err != nil {
+		t.Fatalf("Failed to explain: %v", err)
+	}
+	if plan.Path != hocdb.PathZoneMap || len(plan.Files) != 4 {
+		t.Fatalf("Expected a zone map plan over 3 segments and the data file, got %v", plan)
+	}
+	for i, want := range []string{hocdb.PrunedBloomFilter, hocdb.PrunedBloomFilter, "", ""} {
+		if plan.Files[i].Pruned != want {
+			t.Errorf("Expected file %d to be pruned by %q, got %q", i, want, plan.Files[i].Pruned)
+		}
+	}
+	if f := plan.Files[2]; !f.Segment || f.Records != 5000 || f.First != 10001 || f.Last != 15000 || f.EstimatedRows != 5000 {
+		t.Errorf("Expected the third segment to be read whole, got %+v", f)
+	}
+	if f := plan.Files[3]; f.Segment || f.Records != 5000 || f.Blocks != 2 || f.BlocksPruned != 0 {
+		t.Errorf("Expected the data file's 2 blocks to be read, got %+v", f)
+	}
+	if plan.EstimatedRows != 10000 {
+		t.Errorf("Expected 10000 estimated rows, got %d", plan.EstimatedRows)
+	}
+
+	plan, err = db.Explain(16000, 16100, map[string]interface{}{"price": 16050.0})
+	if err != nil {
+		t.Fatalf("Failed to explain: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if plan.Files[i].Pruned != hocdb.PrunedTimeRange {
+			t.Errorf("Expected segment %d to be pruned by time range, got %+v", i, plan.Files[i])
+		}
+	}
+	if f := plan.Files[3]; f.BlocksPruned != 1 || f.EstimatedRows != 100 {
+		t.Errorf("Expected 1 block pruned and 100 rows, got %+v", f)
+	}
+	if s := plan.String(); !strings.Contains(s, "via zone map") || !strings.Contains(s, "pruned by time range") || !strings.Contains(s, "1 of 2 blocks pruned") {
+		t.Errorf("Unexpected plan text:\n%s", s)
+	}
+
+	// An index takes precedence over zones
+	if err := db.CreateIndex("event"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	plan, err = db.Explain(0, 30000, map[string]interface{}{"event": "trade"})
+	if err != nil {
+		t.Fatalf("Failed to explain: %v", err)
+	}
+	if plan.Path != hocdb.PathIndex || plan.Index != "event" || plan.Files[3].EstimatedRows != 5000 {
+		t.Errorf("Expected a plan through the index on event, got %v", plan)
+	}
+	if _, err := db.Explain(0, 1, map[string]interface{}{"missing": 1}); err == nil {
+		t.Errorf("Expected an error for an unknown field")
+	}
+}
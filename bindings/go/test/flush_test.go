@@ -0,0 +1,81 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlushPolicy(t *testing.T) {
+	testDir := "../../../b_go_test_data_flush_policy"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+
+	cases := []struct {
+		name    string
+		options hocdb.Options
+		flushes int32
+	}{
+		{"default", hocdb.Options{}, 0},
+		{"every_n", hocdb.Options{FlushEveryN: 3}, 3},
+		{"fsync_every_append", hocdb.Options{SyncMode: hocdb.SyncFsync}, 10},
+		{"fsync_every_n", hocdb.Options{SyncMode: hocdb.SyncFsync, FlushEveryN: 5}, 2},
+	}
+	for _, c := range cases {
+		db, err := hocdb.New(c.name, testDir, schema, c.options)
+		if err != nil {
+			t.Fatalf("Failed to create DB: %v", err)
+		}
+		var flushes int32
+		db.OnFlush(func() { atomic.AddInt32(&flushes, 1) })
+
+		for i := int64(1); i <= 10; i++ {
+			record, _ := hocdb.CreateRecordBytes(schema, i, float64(i))
+			if err := db.Append(record); err != nil {
+				t.Fatalf("%s: failed to append: %v", c.name, err)
+			}
+		}
+		if flushes != c.flushes {
+			t.Errorf("%s: expected %d flushes, got %d", c.name, c.flushes, flushes)
+		}
+		if err := db.Flush(); err != nil {
+			t.Errorf("%s: failed to flush: %v", c.name, err)
+		}
+		db.Close()
+	}
+
+	// FlushInterval syncs pending appends once, not on every tick
+	db, err := hocdb.New("interval", testDir, schema, hocdb.Options{FlushInterval: 10 * time.Millisecond, SyncMode: hocdb.SyncFsync})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	var flushes int32
+	db.OnFlush(func() { atomic.AddInt32(&flushes, 1) })
+	record, _ := hocdb.CreateRecordBytes(schema, int64(1), 1.0)
+	if err := db.Append(record); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if n := atomic.LoadInt32(&flushes); n != 0 {
+		t.Errorf("Expected no flush on append with FlushInterval, got %d", n)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&flushes) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&flushes); n != 1 {
+		t.Errorf("Expected one interval flush, got %d", n)
+	}
+	db.Close()
+
+	if hocdb.SyncFsync.String() != "fsync" {
+		t.Errorf("Unexpected SyncMode name: %s", hocdb.SyncFsync)
+	}
+}
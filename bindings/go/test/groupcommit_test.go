@@ -0,0 +1,105 @@
+package hocdb_test
+
+import (
+	"errors"
+	"hocdb"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGroupCommit(t *testing.T) {
+	testDir := "../../../b_go_test_data_group_commit"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "writer", Type: hocdb.TypeI64},
+	}
+	db, err := hocdb.New("GROUP", testDir, schema, hocdb.Options{AutoIncrement: &hocdb.AutoIncrement{}, SyncMode: hocdb.SyncFsync})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	var flushes, appended int32
+	db.OnFlush(func() { atomic.AddInt32(&flushes, 1) })
+	db.OnAppend(func(rec hocdb.Record) { atomic.AddInt32(&appended, 1) })
+
+	const writers, perWriter = 8, 100
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				record, _ := hocdb.CreateRecordBytes(schema, int64(0), int64(w))
+				if err := db.Append(record); err != nil {
+					t.Errorf("Failed to append: %v", err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	data, err := db.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	records, _ := hocdb.DecodeRecords(schema, data)
+	if len(records) != writers*perWriter || appended != writers*perWriter {
+		t.Errorf("Expected %d records and callbacks, got %d and %d", writers*perWriter, len(records), appended)
+	}
+	perWriterCount := make(map[int64]int)
+	for _, rec := range records {
+		v, _ := rec.Get("writer")
+		perWriterCount[v.(int64)]++
+	}
+	for w := int64(0); w < writers; w++ {
+		if perWriterCount[w] != perWriter {
+			t.Errorf("Expected %d records of writer %d, got %d", perWriter, w, perWriterCount[w])
+		}
+	}
+
+	// Concurrent writers share syncs
+	if flushes == 0 || flushes >= writers*perWriter {
+		t.Errorf("Expected fewer syncs than appends, got %d for %d appends", flushes, writers*perWriter)
+	}
+}
+
+func TestGroupCommitErrors(t *testing.T) {
+	testDir := "../../../b_go_test_data_group_commit_errors"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	db, err := hocdb.New("GROUP", testDir, schema, hocdb.Options{SyncMode: hocdb.SyncFlush})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+
+	record, _ := hocdb.CreateRecordBytes(schema, int64(5), 5.0)
+	if err := db.Append(record); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	record, _ = hocdb.CreateRecordBytes(schema, int64(3), 3.0)
+	var orderErr *hocdb.TimestampOrderError
+	if err := db.Append(record); !errors.As(err, &orderErr) || orderErr.Timestamp != 3 || orderErr.Previous != 5 {
+		t.Errorf("Expected a TimestampOrderError for a non-monotonic append, got %v", err)
+	}
+	if err := db.Append([]byte{1, 2, 3}); err == nil {
+		t.Errorf("Expected an error for an invalid record size")
+	}
+
+	db.Close()
+	record, _ = hocdb.CreateRecordBytes(schema, int64(6), 6.0)
+	if err := db.Append(record); err == nil {
+		t.Errorf("Expected an error appending to a closed database")
+	}
+}
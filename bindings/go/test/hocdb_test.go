@@ -2,6 +2,7 @@ package hocdb_test
 
 import (
 	"encoding/binary"
+	"errors"
 	"hocdb"
 	"math"
 	"os"
@@ -222,8 +223,8 @@ func TestAutoIncrement(t *testing.T) {
 	os.MkdirAll(testDir, 0755)
 	defer os.RemoveAll(testDir)
 
-	// 1. Initialize with AutoIncrement = true
-	db, err := hocdb.New("TEST_AUTO_INC", testDir, schema, hocdb.Options{AutoIncrement: true})
+	// 1. Initialize with AutoIncrement
+	db, err := hocdb.New("TEST_AUTO_INC", testDir, schema, hocdb.Options{AutoIncrement: &hocdb.AutoIncrement{}})
 	if err != nil {
 		t.Fatalf("Failed to create DB: %v", err)
 	}
@@ -239,7 +240,7 @@ func TestAutoIncrement(t *testing.T) {
 	db.Close()
 
 	// 2. Reopen and verify
-	db, err = hocdb.New("TEST_AUTO_INC", testDir, schema, hocdb.Options{AutoIncrement: true})
+	db, err = hocdb.New("TEST_AUTO_INC", testDir, schema, hocdb.Options{AutoIncrement: &hocdb.AutoIncrement{}})
 	if err != nil {
 		t.Fatalf("Failed to reopen DB: %v", err)
 	}
@@ -275,6 +276,115 @@ func TestAutoIncrement(t *testing.T) {
 	db.Close()
 }
 
+func TestAutoIncrementStartStep(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "value", Type: hocdb.TypeF64},
+	}
+
+	testDir := "../../../b_go_test_auto_inc_step"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	if _, err := hocdb.New("TEST_AUTO_STEP", testDir, schema, hocdb.Options{AutoIncrement: &hocdb.AutoIncrement{Step: -1}}); err == nil {
+		t.Errorf("Expected an error for a negative step")
+	}
+
+	timestamps := func(db *hocdb.DB) []int64 {
+		data, err := db.Load()
+		if err != nil {
+			t.Fatalf("Failed to load: %v", err)
+		}
+		var ts []int64
+		for off := 0; off+16 <= len(data); off += 16 {
+			ts = append(ts, int64(binary.LittleEndian.Uint64(data[off:off+8])))
+		}
+		return ts
+	}
+
+	db, err := hocdb.New("TEST_AUTO_STEP", testDir, schema, hocdb.Options{AutoIncrement: &hocdb.AutoIncrement{Start: 100, Step: 10}})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := db.AppendValues(int64(0), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	db.Close()
+
+	// Reopening resumes after the last record, with the recorded step
+	db, _, err = hocdb.OpenExisting("TEST_AUTO_STEP", testDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	if err := db.AppendValues(int64(0), 3.0); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if ts := timestamps(db); len(ts) != 4 || ts[0] != 100 || ts[3] != 130 {
+		t.Errorf("Expected timestamps 100 to 130, got %v", ts)
+	}
+	db.Close()
+
+	// A later start skips ahead, an earlier one doesn't go back
+	for _, start := range []int64{1000, 5} {
+		db, err = hocdb.New("TEST_AUTO_STEP", testDir, schema, hocdb.Options{AutoIncrement: &hocdb.AutoIncrement{Start: start}})
+		if err != nil {
+			t.Fatalf("Failed to reopen DB: %v", err)
+		}
+		if err := db.AppendValues(int64(0), 4.0); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+		db.Close()
+	}
+	db, err = hocdb.New("TEST_AUTO_STEP", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db.Close()
+	if ts := timestamps(db); len(ts) != 6 || ts[4] != 1000 || ts[5] != 1001 {
+		t.Errorf("Expected timestamps 1000 and 1001 last, got %v", ts)
+	}
+}
+
+func TestTimestampOrder(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "value", Type: hocdb.TypeF64},
+	}
+
+	testDir := "../../../b_go_test_timestamp_order"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New("TEST_ORDER", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.AppendValues(int64(10), 1.0); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	// Equal and earlier timestamps are both rejected
+	for _, ts := range []int64{10, 9} {
+		err := db.AppendValues(ts, 2.0)
+		var orderErr *hocdb.TimestampOrderError
+		if !errors.As(err, &orderErr) || orderErr.Timestamp != ts || orderErr.Previous != 10 {
+			t.Errorf("Expected a TimestampOrderError for timestamp %d, got %v", ts, err)
+		}
+		if !errors.Is(err, hocdb.ErrTimestampNotMonotonic) {
+			t.Errorf("Expected ErrTimestampNotMonotonic, got %v", err)
+		}
+	}
+	if err := db.AppendValues(int64(11), 3.0); err != nil {
+		t.Fatalf("Failed to append after a rejected record: %v", err)
+	}
+	if data, err := db.Load(); err != nil || len(data) != 2*hocdb.RecordSize(schema) {
+		t.Errorf("Expected 2 records, got %d bytes, %v", len(data), err)
+	}
+}
+
 func BenchmarkAppend(b *testing.B) {
 	schema := []hocdb.Field{
 		{Name: "timestamp", Type: hocdb.TypeI64},
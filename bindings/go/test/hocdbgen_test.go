@@ -0,0 +1,74 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"hocdb/cmd/hocdbgen/example"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestGeneratedRecords(t *testing.T) {
+	testDir := "../../../b_go_test_data_hocdbgen"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	bid, note := 99.5, "abc"
+	trades := []example.Trade{
+		{Timestamp: 1, Price: 100.25, Volume: 7, Symbol: "BTC", Venue: "binance", Payload: []byte{1, 2, 3},
+			Fee: hocdb.Decimal{Unscaled: 125, Scale: 2}, Maker: true, Qty: -4, Seq: 9, Ratio: 0.5, Level: -2, Kind: 3,
+			BidPrice: &bid, Note: &note, Tag: []byte{}},
+		{Timestamp: 2, Price: 101, Symbol: "ETH", Fee: hocdb.Decimal{Scale: 2}},
+	}
+
+	// Generated encoding matches CreateRecordBytes, and decoding DecodeRecord
+	var data []byte
+	for _, trade := range trades {
+		var err error
+		if data, err = trade.AppendRecord(data); err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+	}
+	want, _ := hocdb.CreateRecordBytes(example.TradeSchema, int64(1), 100.25, uint64(7), "BTC", "binance", []byte{1, 2, 3},
+		hocdb.Decimal{Unscaled: 125, Scale: 2}, true, int32(-4), uint32(9), float32(0.5), int16(-2), uint8(3), bid, note, []byte{})
+	if len(data) != 2*example.TradeSize || !bytes.Equal(data[:example.TradeSize], want) {
+		t.Errorf("Expected the generated encoding to match CreateRecordBytes")
+	}
+	if values, err := hocdb.DecodeRecord(example.TradeSchema, data[example.TradeSize:]); err != nil || values[13] != nil || values[15] != nil {
+		t.Errorf("Expected nulls for the nil fields, got %v, %v", values, err)
+	}
+	if _, err := (&example.Trade{Symbol: "TOO LONG!"}).AppendRecord(nil); err == nil {
+		t.Errorf("Expected a string longer than its field to fail")
+	}
+	if _, err := (&example.Trade{Fee: hocdb.Decimal{Unscaled: 1, Scale: 3}}).AppendRecord(nil); err == nil {
+		t.Errorf("Expected a decimal of another scale to fail")
+	}
+
+	// Records round-trip through a database
+	db, err := hocdb.New("TRADES", testDir, example.TradeSchema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+	for o := 0; o < len(data); o += example.TradeSize {
+		if err := db.Append(data[o : o+example.TradeSize]); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	out, err := db.Query(math.MinInt64, math.MaxInt64, nil)
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	got, err := example.DecodeTrades(out, nil)
+	if err != nil || !reflect.DeepEqual(got, trades) {
+		t.Errorf("Expected the trades back, got %+v, %v", got, err)
+	}
+	if prices := example.TradePriceColumn(out, nil); !reflect.DeepEqual(prices, []float64{100.25, 101}) {
+		t.Errorf("Expected the prices, got %v", prices)
+	}
+	if symbols := example.TradeSymbolColumn(out, nil); !reflect.DeepEqual(symbols, []string{"BTC", "ETH"}) {
+		t.Errorf("Expected the symbols, got %v", symbols)
+	}
+}
@@ -0,0 +1,54 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"hocdb/hocdbtest"
+	"os"
+	"testing"
+)
+
+func TestHocdbtest(t *testing.T) {
+	var dir string
+	t.Run("temp", func(t *testing.T) {
+		db := hocdbtest.NewTempDB(t, hocdbtest.TickSchema, hocdb.Options{})
+		want := hocdbtest.Fill(t, db, 100, 1000, 10)
+		data, err := db.Query(0, 10000, nil)
+		if err != nil {
+			t.Fatalf("Failed to query: %v", err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Errorf("Expected the %d bytes Fill appended, got %d", len(want), len(data))
+		}
+		if first, _ := hocdb.DecodeRecord(db.Schema(), data[:db.RecordSize()]); first[0] != int64(1000) || first[1] != 0.0 {
+			t.Errorf("Unexpected first record %v", first)
+		}
+		dir = t.TempDir()
+	})
+	// Cleanups ran with the subtest
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Expected the temporary directory to be removed, got %v", err)
+	}
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "symbol", Type: hocdb.StringType(2)},
+		{Name: "flag", Type: hocdb.TypeBool},
+		{Name: "qty", Type: hocdb.TypeU8},
+		{Name: "payload", Type: hocdb.BytesType(8)},
+		{Name: "amount", Type: hocdb.DecimalType(2), Nullable: true},
+	}
+	rec, err := hocdb.DecodeRecord(schema, hocdbtest.Record(t, schema, 300, 5))
+	if err != nil {
+		t.Fatalf("Failed to decode record: %v", err)
+	}
+	if rec[0] != int64(5) || rec[1] != "00" || rec[2] != true || rec[3] != uint8(44) || string(rec[4].([]byte)) != "300" {
+		t.Errorf("Unexpected generated record %v", rec)
+	}
+	if d, ok := rec[5].(hocdb.Decimal); !ok || d.String() != "3.00" {
+		t.Errorf("Expected amount 3.00, got %v", rec[5])
+	}
+	if data := hocdbtest.Records(t, schema, 10, 0, 1); len(data) != 10*hocdb.RecordSize(schema) {
+		t.Errorf("Expected 10 records, got %d bytes", len(data))
+	}
+}
@@ -0,0 +1,118 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"os"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	testDir := "../../../b_go_test_data_hooks"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "value", Type: hocdb.TypeI64},
+	}
+	// Room for four records
+	db, err := hocdb.New("RING", testDir, schema, hocdb.Options{MaxFileSize: 12 + 4*16, OverwriteFull: true})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	appendRange := func(from, to int64) {
+		for i := from; i <= to; i++ {
+			record, _ := hocdb.CreateRecordBytes(schema, i, i*10)
+			if err := db.Append(record); err != nil {
+				t.Fatalf("Failed to append: %v", err)
+			}
+		}
+	}
+
+	// The ring has already wrapped once before the hooks are registered
+	appendRange(1, 6)
+
+	var appended []int64
+	var flushes, rotations int
+	var rotatedBefore []int64
+	db.OnAppend(func(rec hocdb.Record) {
+		if v, _ := rec.Get("value"); v != rec.Timestamp()*10 {
+			t.Errorf("Unexpected record: %v", rec.Values)
+		}
+		appended = append(appended, rec.Timestamp())
+	})
+	db.OnFlush(func() { flushes++ })
+	db.OnRotate(func() {
+		rotations++
+		rotatedBefore = append(rotatedBefore, int64(len(appended)))
+	})
+
+	// Records 7 and 8 fill the ring, 9 wraps it again
+	appendRange(7, 9)
+	if len(appended) != 3 || appended[0] != 7 || appended[2] != 9 {
+		t.Errorf("Unexpected appended records: %v", appended)
+	}
+	if rotations != 1 || rotatedBefore[0] != 2 {
+		t.Errorf("Expected one rotation before the append of 9, got %d %v", rotations, rotatedBefore)
+	}
+
+	// Four more records wrap it once more
+	appendRange(10, 13)
+	if rotations != 2 {
+		t.Errorf("Expected 2 rotations, got %d", rotations)
+	}
+
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if flushes != 1 {
+		t.Errorf("Expected 1 flush, got %d", flushes)
+	}
+
+	// Failed appends run no hooks
+	record, _ := hocdb.CreateRecordBytes(schema, int64(5), int64(50))
+	if err := db.Append(record); err == nil {
+		t.Errorf("Expected a non-monotonic append to fail")
+	}
+	if len(appended) != 7 {
+		t.Errorf("Expected 7 appended records, got %d", len(appended))
+	}
+}
+
+func TestHooksAutoIncrement(t *testing.T) {
+	testDir := "../../../b_go_test_data_hooks_autoinc"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "value", Type: hocdb.TypeF64},
+	}
+	db, err := hocdb.New("AUTO", testDir, schema, hocdb.Options{AutoIncrement: &hocdb.AutoIncrement{}, FlushOnWrite: true})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	var timestamps []int64
+	var flushes int
+	db.OnAppend(func(rec hocdb.Record) { timestamps = append(timestamps, rec.Timestamp()) })
+	db.OnFlush(func() { flushes++ })
+
+	for i := 0; i < 3; i++ {
+		record, _ := hocdb.CreateRecordBytes(schema, int64(0), float64(i))
+		if err := db.Append(record); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+
+	// The hooks see the timestamps assigned by the engine
+	if len(timestamps) != 3 || timestamps[0] != 1 || timestamps[2] != 3 {
+		t.Errorf("Unexpected timestamps: %v", timestamps)
+	}
+	if flushes != 3 {
+		t.Errorf("Expected a flush per append with FlushOnWrite, got %d", flushes)
+	}
+}
@@ -0,0 +1,477 @@
+package hocdb_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"hocdb"
+	"hocdb/httpapi"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPAPI(t *testing.T) {
+	testDir := "../../../b_go_test_data_httpapi"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "side", Type: hocdb.TypeI64},
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	srv := httpapi.New()
+	srv.Add("BTC_USD", db)
+	ts := httptest.NewServer(http.StripPrefix("/api", srv))
+	defer ts.Close()
+
+	do := func(method, path, contentType, accept, body string) (int, string) {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		return resp.StatusCode, string(data)
+	}
+
+	// Append a single object, an array and NDJSON
+	status, body := do("POST", "/api/tickers/BTC_USD/records", "application/json", "", `{"timestamp":100,"price":1.5,"side":0}`)
+	if status != http.StatusOK || !strings.Contains(body, `"appended":1`) {
+		t.Fatalf("Unexpected append response %d: %s", status, body)
+	}
+	status, body = do("POST", "/api/tickers/BTC_USD/records", "application/json", "", `[
+		{"timestamp":200,"price":2.5,"side":1},
+		{"timestamp":300,"price":3.5,"side":0}
+	]`)
+	if status != http.StatusOK || !strings.Contains(body, `"appended":2`) {
+		t.Fatalf("Unexpected append response %d: %s", status, body)
+	}
+	status, body = do("POST", "/api/tickers/BTC_USD/records", "application/x-ndjson", "",
+		"{\"timestamp\":400,\"price\":4.5,\"side\":1}\n{\"timestamp\":50,\"price\":0.5,\"side\":1}\n")
+	if status != http.StatusUnprocessableEntity || !strings.Contains(body, `"appended":1`) || !strings.Contains(body, `"line":2`) {
+		t.Fatalf("Expected a partial append, got %d: %s", status, body)
+	}
+
+	status, body = do("POST", "/api/tickers/BTC_USD/records", "application/json", "", `{"timestamp":`)
+	if status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid JSON, got %d: %s", status, body)
+	}
+
+	// Query as a JSON array
+	status, body = do("GET", "/api/tickers/BTC_USD/records?start=150&end=500", "", "", "")
+	if status != http.StatusOK {
+		t.Fatalf("Query failed with %d: %s", status, body)
+	}
+	var records []map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &records); err != nil {
+		t.Fatalf("Failed to decode query response %q: %v", body, err)
+	}
+	if len(records) != 3 || records[0]["timestamp"] != float64(200) || records[2]["price"] != 4.5 {
+		t.Errorf("Unexpected records: %v", records)
+	}
+
+	// Filtered query as CSV, through the Accept header
+	status, body = do("GET", "/api/tickers/BTC_USD/records?side=1", "", "text/csv", "")
+	if status != http.StatusOK {
+		t.Fatalf("CSV query failed with %d: %s", status, body)
+	}
+	if body != "timestamp,price,side\n200,2.5,1\n400,4.5,1\n" {
+		t.Errorf("Unexpected CSV:\n%s", body)
+	}
+
+	// NDJSON through the format parameter
+	status, body = do("GET", "/api/tickers/BTC_USD/records?end=150&format=ndjson", "", "", "")
+	if status != http.StatusOK || strings.Count(body, "\n") != 1 {
+		t.Errorf("Unexpected NDJSON response %d: %s", status, body)
+	}
+
+	status, body = do("GET", "/api/tickers/BTC_USD/records?side=abc", "", "", "")
+	if status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a bad filter value, got %d: %s", status, body)
+	}
+	status, body = do("GET", "/api/tickers/BTC_USD/records?volume=1", "", "", "")
+	if status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown field, got %d: %s", status, body)
+	}
+
+	// Stats, latest and schema
+	status, body = do("GET", "/api/tickers/BTC_USD/stats?field=price", "", "", "")
+	var stats struct {
+		Min, Max, Sum, Mean float64
+		Count               uint64
+	}
+	if err := json.Unmarshal([]byte(body), &stats); status != http.StatusOK || err != nil {
+		t.Fatalf("Stats failed with %d: %s", status, body)
+	}
+	if stats.Count != 4 || stats.Min != 1.5 || stats.Max != 4.5 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	status, body = do("GET", "/api/tickers/BTC_USD/latest?field=price", "", "text/csv", "")
+	if status != http.StatusOK || body != "value,timestamp\n4.5,400\n" {
+		t.Errorf("Unexpected latest response %d: %s", status, body)
+	}
+
+	status, body = do("GET", "/api/tickers/BTC_USD/schema", "", "", "")
+	var info struct {
+		Fields []struct {
+			Name string
+			Type string
+		}
+		RecordSize int `json:"record_size"`
+	}
+	if err := json.Unmarshal([]byte(body), &info); status != http.StatusOK || err != nil {
+		t.Fatalf("Schema failed with %d: %s", status, body)
+	}
+	if len(info.Fields) != 3 || info.Fields[1].Name != "price" || info.Fields[1].Type != hocdb.TypeF64.String() || info.RecordSize != 24 {
+		t.Errorf("Unexpected schema: %+v", info)
+	}
+
+	status, body = do("GET", "/api/tickers", "", "", "")
+	if status != http.StatusOK || strings.TrimSpace(body) != `{"tickers":["BTC_USD"]}` {
+		t.Errorf("Unexpected ticker list %d: %s", status, body)
+	}
+
+	// Errors
+	if status, body = do("GET", "/api/tickers/ETH_USD/schema", "", "", ""); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown ticker, got %d: %s", status, body)
+	}
+	if status, body = do("DELETE", "/api/tickers/BTC_USD/records", "", "", ""); status != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d: %s", status, body)
+	}
+	if status, body = do("GET", "/api/tickers/BTC_USD/stats?field=volume", "", "", ""); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown stats field, got %d: %s", status, body)
+	}
+}
+
+func TestHTTPAPITail(t *testing.T) {
+	testDir := "../../../b_go_test_data_httpapi_tail"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	record, _ := hocdb.CreateRecordBytes(schema, int64(100), 1.5)
+	if err := db.Append(record); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+
+	srv := httpapi.New()
+	srv.TailInterval = 20 * time.Millisecond
+	srv.Add("BTC_USD", db)
+	defer srv.Close()
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/tickers/BTC_USD/tail")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("Expected 426 without an upgrade, got %d", resp.StatusCode)
+	}
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest("GET", ts.URL+"/tickers/BTC_USD/tail?since=0", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("Failed to send handshake: %v", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err = http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatalf("Failed to read handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Unexpected handshake response: %d %v", resp.StatusCode, resp.Header)
+	}
+
+	// Stored records are replayed first
+	if opcode, msg := readWSFrame(t, br); opcode != 1 || msg != `{"timestamp":100,"price":1.5}` {
+		t.Errorf("Unexpected replayed message %d: %s", opcode, msg)
+	}
+
+	// Records appended through the API are pushed
+	post, err := http.Post(ts.URL+"/tickers/BTC_USD/records", "application/json",
+		strings.NewReader(`[{"timestamp":200,"price":2.5},{"timestamp":300,"price":3.5}]`))
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	post.Body.Close()
+	if opcode, msg := readWSFrame(t, br); opcode != 1 || msg != `{"timestamp":200,"price":2.5}` {
+		t.Errorf("Unexpected message %d: %s", opcode, msg)
+	}
+	if opcode, msg := readWSFrame(t, br); opcode != 1 || msg != `{"timestamp":300,"price":3.5}` {
+		t.Errorf("Unexpected message %d: %s", opcode, msg)
+	}
+
+	writeWSFrame(t, conn, 0x9, []byte("hi"))
+	if opcode, msg := readWSFrame(t, br); opcode != 0xa || msg != "hi" {
+		t.Errorf("Expected pong, got %d: %s", opcode, msg)
+	}
+
+	writeWSFrame(t, conn, 0x8, binary.BigEndian.AppendUint16(nil, 1000))
+	opcode, msg := readWSFrame(t, br)
+	if opcode != 0x8 || len(msg) < 2 || binary.BigEndian.Uint16([]byte(msg)) != 1000 {
+		t.Errorf("Expected close frame, got %d: %q", opcode, msg)
+	}
+
+	// Fragmented messages are refused rather than misread
+	status, conn, br := dialTail(t, ts, "")
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("Unexpected handshake response: %d", status)
+	}
+	defer conn.Close()
+	frame := []byte{0x01, 0x80 | 2, 1, 2, 3, 4, 'h' ^ 1, 'i' ^ 2} // Text frame without FIN
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+	opcode, msg = readWSFrame(t, br)
+	if opcode != 0x8 || len(msg) < 2 || binary.BigEndian.Uint16([]byte(msg)) != 1003 {
+		t.Errorf("Expected close frame with status 1003, got %d: %q", opcode, msg)
+	}
+
+	// Pages of other sites can't open the tail, unless CheckOrigin allows them
+	u, _ := url.Parse(ts.URL)
+	for origin, want := range map[string]int{
+		"http://" + u.Host:       http.StatusSwitchingProtocols,
+		"https://evil.example":   http.StatusForbidden,
+		"http://trusted.example": http.StatusForbidden,
+	} {
+		status, conn, _ := dialTail(t, ts, origin)
+		conn.Close()
+		if status != want {
+			t.Errorf("Expected %d for origin %s, got %d", want, origin, status)
+		}
+	}
+	trusting := httpapi.New()
+	trusting.CheckOrigin = func(req *http.Request) bool { return req.Header.Get("Origin") == "http://trusted.example" }
+	trusting.Add("BTC_USD", db)
+	defer trusting.Close()
+	trustingTS := httptest.NewServer(trusting)
+	defer trustingTS.Close()
+	status, conn, _ = dialTail(t, trustingTS, "http://trusted.example")
+	conn.Close()
+	if status != http.StatusSwitchingProtocols {
+		t.Errorf("Expected CheckOrigin to accept the origin, got %d", status)
+	}
+}
+
+// dialTail sends a WebSocket handshake for the tail of BTC_USD, with origin as its
+// Origin when set, and returns the status of the response and the connection
+func dialTail(t *testing.T, ts *httptest.Server, origin string) (int, net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	req, _ := http.NewRequest("GET", ts.URL+"/tickers/BTC_USD/tail", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("Failed to send handshake: %v", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatalf("Failed to read handshake: %v", err)
+	}
+	return resp.StatusCode, conn, br
+}
+
+// readWSFrame reads an unmasked server frame
+func readWSFrame(t *testing.T, r io.Reader) (byte, string) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	length := int(head[1] & 0x7f)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	return head[0] & 0x0f, string(payload)
+}
+
+// writeWSFrame writes a small masked client frame
+func writeWSFrame(t *testing.T, w io.Writer, opcode byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := w.Write(frame); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+}
+
+func TestGrafanaHandler(t *testing.T) {
+	testDir := "../../../b_go_test_data_grafana"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "event", Type: hocdb.TypeString},
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	// One record per second from 2024-01-01T00:00:00Z
+	base := int64(1704067200)
+	for i := 0; i < 10; i++ {
+		event := ""
+		if i == 4 {
+			event = "halt"
+		}
+		record, _ := hocdb.CreateRecordBytes(schema, base+int64(i), float64(i), event)
+		if err := db.Append(record); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+
+	srv := httpapi.New()
+	srv.Add("BTC_USD", db)
+	ts := httptest.NewServer(httpapi.GrafanaHandler(srv, httpapi.GrafanaOptions{}))
+	defer ts.Close()
+
+	post := func(path, body string, out interface{}) int {
+		resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if out != nil && resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				t.Fatalf("Failed to decode %s response: %v", path, err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 for the connection test, got %d", resp.StatusCode)
+	}
+
+	var targets []string
+	post("/search", `{"target":""}`, &targets)
+	if len(targets) != 1 || targets[0] != "BTC_USD.price" {
+		t.Errorf("Unexpected search result: %v", targets)
+	}
+
+	rangeJSON := `"range":{"from":"2024-01-01T00:00:02Z","to":"2024-01-01T00:00:07Z"}`
+	var series []struct {
+		Target     string
+		Datapoints [][2]float64
+	}
+	status := post("/query", `{`+rangeJSON+`,"maxDataPoints":100,"targets":[{"target":"BTC_USD.price","refId":"A"}]}`, &series)
+	if status != http.StatusOK || len(series) != 1 {
+		t.Fatalf("Unexpected query response %d: %v", status, series)
+	}
+	points := series[0].Datapoints
+	if len(points) != 6 || points[0] != [2]float64{2, float64((base + 2) * 1000)} || points[5][0] != 7 {
+		t.Errorf("Unexpected datapoints: %v", points)
+	}
+
+	// Averaged into buckets when the panel wants fewer points
+	post("/query", `{`+rangeJSON+`,"maxDataPoints":3,"targets":[{"target":"BTC_USD.price","refId":"A"}]}`, &series)
+	if points := series[0].Datapoints; len(points) != 3 || points[0][0] != 2.5 || points[2][0] != 6.5 {
+		t.Errorf("Unexpected downsampled datapoints: %v", points)
+	}
+
+	var tables []struct {
+		Type    string
+		Columns []struct{ Text, Type string }
+		Rows    [][]interface{}
+	}
+	post("/query", `{`+rangeJSON+`,"targets":[{"target":"BTC_USD","type":"table","refId":"A"}]}`, &tables)
+	if len(tables) != 1 || len(tables[0].Columns) != 3 || tables[0].Columns[2].Type != "string" || len(tables[0].Rows) != 6 {
+		t.Fatalf("Unexpected table: %+v", tables)
+	}
+	if row := tables[0].Rows[2]; row[1] != float64(4) || row[2] != "halt" {
+		t.Errorf("Unexpected table row: %v", row)
+	}
+
+	var annotations []struct {
+		Time  int64
+		Title string
+		Text  string
+		Tags  []string
+	}
+	post("/annotations", `{`+rangeJSON+`,"annotation":{"name":"halts","enable":true,"query":"BTC_USD.event=halt"}}`, &annotations)
+	if len(annotations) != 1 || annotations[0].Time != (base+4)*1000 || annotations[0].Text != "halt" {
+		t.Errorf("Unexpected annotations: %+v", annotations)
+	}
+
+	if status := post("/query", `{`+rangeJSON+`,"targets":[{"target":"ETH_USD.price"}]}`, nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown ticker, got %d", status)
+	}
+	if status := post("/query", `{`+rangeJSON+`,"targets":[{"target":"BTC_USD.event"}]}`, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a non-numeric series, got %d", status)
+	}
+}
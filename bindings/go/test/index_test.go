@@ -0,0 +1,132 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scanRecorder records the records the last query read
+type scanRecorder struct {
+	mu      sync.Mutex
+	scanned int
+}
+
+func (r *scanRecorder) ObserveAppend(records, bytes int)        {}
+func (r *scanRecorder) ObserveFlush(d time.Duration, err error) {}
+func (r *scanRecorder) ObserveQuery(d time.Duration, scanned, returned int) {
+	r.mu.Lock()
+	r.scanned = scanned
+	r.mu.Unlock()
+}
+
+func (r *scanRecorder) last() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.scanned
+}
+
+func TestIndex(t *testing.T) {
+	testDir := "../../../b_go_test_data_index"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "event", Type: hocdb.StringType(16)},
+		{Name: "venue", Type: hocdb.TypeI32},
+	}
+	metrics := &scanRecorder{}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{Metrics: metrics})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	appendRange := func(db *hocdb.DB, from, to int) {
+		for i := from; i <= to; i++ {
+			event := "trade"
+			if i%500 == 0 {
+				event = "liquidation"
+			}
+			if err := db.AppendValues(int64(i), float64(i), event, int32(i%3)); err != nil {
+				t.Fatalf("Failed to append: %v", err)
+			}
+		}
+	}
+	appendRange(db, 1, 5000)
+
+	filters := map[string]interface{}{"event": "liquidation"}
+	scan, err := db.Query(0, 10000, filters)
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if len(scan) != 10*db.RecordSize() {
+		t.Fatalf("Expected 10 liquidations, got %d bytes", len(scan))
+	}
+
+	if err := db.CreateIndex("price"); err == nil {
+		t.Errorf("Expected an error for an index on a float field")
+	}
+	if err := db.CreateIndex("event"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if err := db.CreateIndex("venue"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if got := db.Indexes(); !reflect.DeepEqual(got, []string{"event", "venue"}) {
+		t.Errorf("Expected indexes on event and venue, got %v", got)
+	}
+	indexed, err := db.Query(0, 10000, filters)
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if !bytes.Equal(indexed, scan) {
+		t.Errorf("Expected the index to return the records a scan does")
+	}
+	if metrics.last() != 10 {
+		t.Errorf("Expected the index to read 10 records, got %d", metrics.last())
+	}
+	if data, err := db.Query(1000, 2001, []hocdb.Filter{{FieldIndex: 2, Value: "liquidation"}, {FieldIndex: 3, Value: 1}}); err != nil || len(data) != db.RecordSize() {
+		t.Errorf("Expected one liquidation at venue 1 in range, got %d bytes, %v", len(data), err)
+	}
+
+	// Unflushed appends and reopening
+	appendRange(db, 5001, 6000)
+	if data, err := db.Query(0, 10000, filters); err != nil || len(data) != 12*db.RecordSize() {
+		t.Errorf("Expected 12 liquidations with unflushed appends, got %d bytes, %v", len(data), err)
+	}
+	db.Close()
+	db, err = hocdb.New("BTC_USD", testDir, schema, hocdb.Options{Metrics: metrics})
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	if got := db.Indexes(); len(got) != 2 {
+		t.Errorf("Expected the indexes to be reopened, got %v", got)
+	}
+	if data, err := db.Query(0, 10000, filters); err != nil || len(data) != 12*db.RecordSize() || metrics.last() != 12 {
+		t.Errorf("Expected 12 liquidations from the index, got %d bytes, %d read, %v", len(data), metrics.last(), err)
+	}
+
+	// Schema changes carry indexes over to the fields that remain
+	if err := db.DropField("venue"); err != nil {
+		t.Fatalf("Failed to drop field: %v", err)
+	}
+	if got := db.Indexes(); !reflect.DeepEqual(got, []string{"event"}) {
+		t.Errorf("Expected the index on event to remain, got %v", got)
+	}
+	if data, err := db.Query(0, 10000, filters); err != nil || len(data) != 12*db.RecordSize() || metrics.last() != 12 {
+		t.Errorf("Expected 12 liquidations from the index, got %d bytes, %d read, %v", len(data), metrics.last(), err)
+	}
+	if err := db.DropIndex("event"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(testDir, "*.idx")); len(files) != 0 {
+		t.Errorf("Expected no index files, got %v", files)
+	}
+	db.Drop()
+}
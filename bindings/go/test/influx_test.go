@@ -0,0 +1,146 @@
+package hocdb_test
+
+import (
+	"encoding/json"
+	"hocdb"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// influxServer serves the points of a cpu measurement on /query, honoring the
+// time bounds, LIMIT and OFFSET of the queries of ImportInflux
+func influxServer(t *testing.T, rows [][]interface{}) (*httptest.Server, *int) {
+	timeFrom := regexp.MustCompile(`time >= (-?\d+)`)
+	timeTo := regexp.MustCompile(`time < (-?\d+)`)
+	page := regexp.MustCompile(`LIMIT (\d+) OFFSET (\d+)`)
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		q := r.URL.Query()
+		if r.URL.Path != "/query" || q.Get("db") != "telegraf" || q.Get("epoch") != "ns" {
+			http.Error(w, "unexpected request "+r.URL.String(), http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("Authorization") != "Token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "authorization failed"})
+			return
+		}
+		from, to := int64(-1<<63), int64(1<<63-1)
+		if m := timeFrom.FindStringSubmatch(q.Get("q")); m != nil {
+			from, _ = strconv.ParseInt(m[1], 10, 64)
+		}
+		if m := timeTo.FindStringSubmatch(q.Get("q")); m != nil {
+			to, _ = strconv.ParseInt(m[1], 10, 64)
+		}
+		m := page.FindStringSubmatch(q.Get("q"))
+		limit, _ := strconv.Atoi(m[1])
+		offset, _ := strconv.Atoi(m[2])
+
+		values := [][]interface{}{}
+		for _, row := range rows {
+			if ts := row[0].(int64); ts >= from && ts < to {
+				values = append(values, row)
+			}
+		}
+		values = values[min(offset, len(values)):]
+		values = values[:min(limit, len(values))]
+		series := []interface{}{}
+		if len(values) > 0 {
+			series = append(series, map[string]interface{}{
+				"name":    "cpu",
+				"columns": []string{"time", "host", "usage_user", "cores"},
+				"values":  values,
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": []interface{}{map[string]interface{}{"statement_id": 0, "series": series}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestImportInflux(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "usage", Type: hocdb.TypeF64},
+		{Name: "cores", Type: hocdb.TypeI32, Nullable: true},
+	}
+
+	testDir := "../../../b_go_test_data_influx"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	// Points of three hosts sharing times across page boundaries
+	rows := [][]interface{}{
+		{int64(1000), "a", 0.5, 4},
+		{int64(1000), "b", 0.25, nil},
+		{int64(2000), "a", 0.75, 4},
+		{int64(2000), "b", "busy", nil},
+		{int64(2000), "c", 0.125, 8},
+		{int64(3000), "a", 1.0, 4},
+		{int64(4000), "b", 0.5, nil},
+	}
+	srv, requests := influxServer(t, rows)
+
+	mapping := hocdb.InfluxMapping{
+		Dir:        testDir,
+		Schema:     schema,
+		Options:    hocdb.Options{TimestampPrecision: time.Microsecond},
+		Columns:    map[string]string{"usage": "usage_user"},
+		TickerTags: []string{"host"},
+		Token:      "secret",
+		End:        time.Unix(0, 4000),
+		PageSize:   2,
+	}
+	result, err := hocdb.ImportInflux(srv.URL, "telegraf", "cpu", mapping)
+	if err != nil {
+		t.Fatalf("ImportInflux failed: %v", err)
+	}
+	if result.Imported != 5 {
+		t.Errorf("Expected 5 imported points, got %d", result.Imported)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Line != 4 {
+		t.Errorf("Expected the fourth point to fail, got %v", result.Errors)
+	}
+	if *requests != 4 {
+		t.Errorf("Expected 4 pages, got %d", *requests)
+	}
+
+	want := map[string][][]interface{}{
+		"cpu_a": {{int64(1), 0.5, int32(4)}, {int64(2), 0.75, int32(4)}, {int64(3), 1.0, int32(4)}},
+		"cpu_b": {{int64(1), 0.25, nil}},
+		"cpu_c": {{int64(2), 0.125, int32(8)}},
+	}
+	for ticker, values := range want {
+		db, err := hocdb.New(ticker, testDir, schema, hocdb.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", ticker, err)
+		}
+		data, _ := db.Load()
+		db.Close()
+		records, _ := hocdb.DecodeRecords(schema, data)
+		if len(records) != len(values) {
+			t.Fatalf("Expected %d records in %s, got %d", len(values), ticker, len(records))
+		}
+		for i, record := range records {
+			for j, v := range values[i] {
+				if record.Values[j] != v {
+					t.Errorf("%s record %d: expected %v, got %v", ticker, i, values[i], record.Values)
+					break
+				}
+			}
+		}
+	}
+
+	mapping.Token = "wrong"
+	if _, err := hocdb.ImportInflux(srv.URL, "telegraf", "cpu", mapping); err == nil {
+		t.Errorf("Expected a rejected token to fail")
+	}
+}
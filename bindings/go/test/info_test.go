@@ -0,0 +1,98 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"hocdb/hocdbtest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInfo(t *testing.T) {
+	testDir := "../../../b_go_test_data_info"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	options := hocdb.Options{Compression: &hocdb.Compression{Codec: "deflate", SegmentRecords: 100}}
+	db, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	info, err := db.Info()
+	if err != nil {
+		t.Fatalf("Failed to get info: %v", err)
+	}
+	if info.Records != 0 || info.Oldest != 0 || info.Newest != 0 {
+		t.Errorf("Expected an empty database, got %+v", info)
+	}
+
+	for i := 1; i <= 350; i++ {
+		if err := db.AppendValues(int64(i), float64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	// Files of a ticker named like this one aren't counted
+	other, err := hocdb.New(hocdbtest.Ticker+"_X", testDir, hocdbtest.TickSchema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer other.Close()
+	if err := other.AppendValues(int64(1), 1.0, 1.0); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	other.Flush()
+
+	info, err = db.Info()
+	if err != nil {
+		t.Fatalf("Failed to get info: %v", err)
+	}
+	if info.Records != 350 || info.Oldest != 1 || info.Newest != 350 {
+		t.Errorf("Expected 350 records from 1 to 350, got %d from %d to %d", info.Records, info.Oldest, info.Newest)
+	}
+	if info.ActiveFile != filepath.Join(testDir, hocdbtest.Ticker+".bin") || len(info.Schema) != len(hocdbtest.TickSchema) {
+		t.Errorf("Unexpected active file %s or schema %v", info.ActiveFile, info.Schema)
+	}
+
+	entries, _ := os.ReadDir(testDir)
+	files, size := 0, int64(0)
+	for _, entry := range entries {
+		// Hidden files, such as the lock, aren't part of the database
+		if strings.HasPrefix(entry.Name(), hocdbtest.Ticker+"_X") || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		fi, _ := entry.Info()
+		files++
+		size += fi.Size()
+	}
+	// Data file, metadata and 2 segments at least
+	if info.Files != files || info.DiskBytes != size || files < 4 {
+		t.Errorf("Expected %d files of %d bytes, got %d of %d", files, size, info.Files, info.DiskBytes)
+	}
+
+	// A ring buffer that wrapped starts at its oldest surviving record
+	ringDir := testDir + "_ring"
+	os.RemoveAll(ringDir)
+	defer os.RemoveAll(ringDir)
+	ring, err := hocdb.New(hocdbtest.Ticker, ringDir, hocdbtest.TickSchema, hocdb.Options{MaxFileSize: 12 + 10*24, OverwriteFull: true})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer ring.Close()
+	for i := 1; i <= 25; i++ {
+		if err := ring.AppendValues(int64(i), float64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if info, err = ring.Info(); err != nil {
+		t.Fatalf("Failed to get info: %v", err)
+	}
+	if info.Records != 10 || info.Oldest != 16 || info.Newest != 25 {
+		t.Errorf("Expected 10 records from 16 to 25, got %d from %d to %d", info.Records, info.Oldest, info.Newest)
+	}
+}
@@ -0,0 +1,70 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"os"
+	"testing"
+)
+
+func TestQueryInto(t *testing.T) {
+	testDir := "../../../b_go_test_data_into"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	for i := int64(1); i <= 100; i++ {
+		record, _ := hocdb.CreateRecordBytes(schema, i, float64(i))
+		if err := db.Append(record); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+
+	// A buffer too small for the result is replaced
+	buf := make([]byte, 0, 16)
+	buf, err = db.LoadInto(buf)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	want, _ := db.Load()
+	if !bytes.Equal(buf, want) {
+		t.Errorf("LoadInto returned %d bytes, Load %d", len(buf), len(want))
+	}
+
+	// A large enough buffer is reused
+	first := &buf[:1][0]
+	for _, r := range [][2]int64{{10, 20}, {0, 1000}, {500, 600}, {1, 2}} {
+		buf, err = db.QueryInto(buf, r[0], r[1], nil)
+		if err != nil {
+			t.Fatalf("Failed to query: %v", err)
+		}
+		want, _ := db.Query(r[0], r[1], nil)
+		if !bytes.Equal(buf, want) {
+			t.Errorf("QueryInto(%d, %d) returned %d bytes, Query %d", r[0], r[1], len(buf), len(want))
+		}
+		if cap(buf) > 0 && &buf[:1][0] != first {
+			t.Errorf("QueryInto(%d, %d) allocated a new buffer", r[0], r[1])
+		}
+	}
+
+	buf, err = db.QueryInto(buf, 0, 1000, map[string]interface{}{"price": 7.0})
+	if err != nil || len(buf) != hocdb.RecordSize(schema) {
+		t.Errorf("Unexpected filtered result: %d bytes, %v", len(buf), err)
+	}
+
+	allocs := testing.AllocsPerRun(20, func() {
+		buf, _ = db.QueryInto(buf, 0, 1000, nil)
+	})
+	if allocs > 2 {
+		t.Errorf("Expected QueryInto to reuse the buffer, got %.0f allocations per call", allocs)
+	}
+}
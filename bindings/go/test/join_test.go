@@ -0,0 +1,80 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestJoinAsOf(t *testing.T) {
+	testDir := "../../../b_go_test_data_join"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	trades, err := hocdb.New("TRADES", testDir, []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer trades.Close()
+	quotes, err := hocdb.New("QUOTES", testDir, []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "bid", Type: hocdb.TypeF64},
+		{Name: "ask", Type: hocdb.TypeF64},
+	}, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer quotes.Close()
+
+	for _, q := range [][]interface{}{{int64(5), 9.0, 11.0}, {int64(20), 19.0, 21.0}, {int64(30), 29.0, 31.0}} {
+		if err := quotes.AppendValues(q...); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	for _, tr := range [][]interface{}{{int64(3), 1.0}, {int64(10), 10.0}, {int64(20), 20.0}, {int64(29), 25.0}, {int64(40), 30.0}} {
+		if err := trades.AppendValues(tr...); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+
+	for _, tc := range []struct {
+		start, tolerance int64
+		want             []interface{} // Bid joined with each trade, nil for none
+	}{
+		{0, -1, []interface{}{nil, 9.0, 19.0, 19.0, 29.0}},
+		{0, 9, []interface{}{nil, 9.0, 19.0, 19.0, nil}},
+		{0, 0, []interface{}{nil, nil, 19.0, nil, nil}},
+		// The quote before the range is still found
+		{10, 5, []interface{}{9.0, 19.0, nil, nil}},
+	} {
+		joined, err := hocdb.JoinAsOf(trades, quotes, tc.start, 100, tc.tolerance)
+		if err != nil {
+			t.Fatalf("Failed to join: %v", err)
+		}
+		if len(joined) != len(tc.want) {
+			t.Fatalf("Expected %d rows, got %d", len(tc.want), len(joined))
+		}
+		for i, row := range joined {
+			var bid interface{}
+			if row.Right != nil {
+				bid, _ = row.Right.Get("bid")
+			}
+			if bid != tc.want[i] {
+				t.Errorf("Tolerance %d, trade %d: expected bid %v, got %v", tc.tolerance, row.Left.Timestamp(), tc.want[i], bid)
+			}
+		}
+	}
+
+	other, err := hocdb.New("OTHER", testDir, []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}}, hocdb.Options{TimestampPrecision: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer other.Close()
+	if _, err := hocdb.JoinAsOf(trades, other, 0, 100, -1); err == nil {
+		t.Errorf("Expected an error for different timestamp precisions")
+	}
+}
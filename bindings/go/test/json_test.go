@@ -0,0 +1,116 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"hocdb"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExportImportJSON(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "volume", Type: hocdb.TypeU64},
+		{Name: "event", Type: hocdb.TypeString},
+		{Name: "active", Type: hocdb.TypeBool},
+	}
+
+	testDir := "../../../b_go_test_data_json"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	src, err := hocdb.New("JSON_SRC", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer src.Close()
+
+	rec1, _ := hocdb.CreateRecordBytes(schema, int64(100), 1.5, uint64(18446744073709551615), "say \"hi\"", true)
+	src.Append(rec1)
+	rec2, _ := hocdb.CreateRecordBytes(schema, int64(200), 2.0, uint64(7), "bye", false)
+	src.Append(rec2)
+
+	var buf bytes.Buffer
+	if err := src.ExportJSON(&buf, 0, 1000); err != nil {
+		t.Fatalf("ExportJSON failed: %v", err)
+	}
+
+	expected := `{"timestamp":100,"price":1.5,"volume":18446744073709551615,"event":"say \"hi\"","active":true}` + "\n" +
+		`{"timestamp":200,"price":2,"volume":7,"event":"bye","active":false}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected JSON output:\n%s", buf.String())
+	}
+
+	dst, err := hocdb.New("JSON_DST", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer dst.Close()
+
+	input := buf.String() + `{"timestamp":300,"price":"bad","volume":1,"event":"x","active":true}` + "\n"
+	result, err := dst.ImportJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ImportJSON failed: %v", err)
+	}
+	if result.Imported != 2 || len(result.Errors) != 1 || result.Errors[0].Line != 3 {
+		t.Fatalf("Unexpected import result: %d imported, errors %v", result.Imported, result.Errors)
+	}
+
+	original, _ := src.Load()
+	imported, _ := dst.Load()
+	if !bytes.Equal(original, imported) {
+		t.Error("Imported records differ from the exported ones")
+	}
+}
+
+func TestRecordMarshalJSON(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "side", Type: hocdb.StringType(8)},
+		{Name: "price", Type: hocdb.DecimalType(2)},
+		{Name: "size", Type: hocdb.TypeF32},
+		{Name: "note", Type: hocdb.BytesType(8), Nullable: true},
+		{Name: "bid", Type: hocdb.TypeF64, Nullable: true},
+	}
+	var data []byte
+	for _, values := range [][]interface{}{
+		{int64(1), "buy", hocdb.Decimal{Unscaled: 10050, Scale: 2}, float32(1.5), []byte("hi"), 99.5},
+		{int64(2), "sell", hocdb.Decimal{Unscaled: -1, Scale: 2}, float32(math.NaN()), nil, nil},
+	} {
+		record, err := hocdb.CreateRecordBytes(schema, values...)
+		if err != nil {
+			t.Fatalf("Failed to create record: %v", err)
+		}
+		data = append(data, record...)
+	}
+	records, err := hocdb.DecodeRecords(schema, data)
+	if err != nil {
+		t.Fatalf("Failed to decode records: %v", err)
+	}
+
+	got, err := json.Marshal(records)
+	if err != nil {
+		t.Fatalf("Failed to marshal records: %v", err)
+	}
+	want := `[{"timestamp":1,"side":"buy","price":100.50,"size":1.5,"note":"aGk=","bid":99.5},` +
+		`{"timestamp":2,"side":"sell","price":-0.01,"size":null,"note":null,"bid":null}]`
+	if string(got) != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	// Padding left in a string by hand is trimmed too
+	record := hocdb.Record{Schema: schema[:2], Values: []interface{}{int64(3), "ask\x00\x00\x00\x00\x00"}}
+	if got, err := json.Marshal(record); err != nil || string(got) != `{"timestamp":3,"side":"ask"}` {
+		t.Errorf("Expected padding trimmed, got %s, %v", got, err)
+	}
+	if record.Values[1] != "ask\x00\x00\x00\x00\x00" {
+		t.Errorf("Expected the record's values to be left unchanged")
+	}
+	if _, err := json.Marshal(hocdb.Record{Schema: schema, Values: []interface{}{int64(1)}}); err == nil {
+		t.Errorf("Expected a record with missing values to fail")
+	}
+}
@@ -0,0 +1,78 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"errors"
+	"hocdb"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestQueryLimits(t *testing.T) {
+	testDir := "../../../b_go_test_data_limits"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	options := hocdb.Options{Compression: &hocdb.Compression{Codec: "deflate", SegmentRecords: 5000}}
+	db, err := hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Drop()
+	for i := 1; i <= 20000; i++ {
+		if err := db.AppendValues(int64(i), float64(i%10)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+
+	// Within its limits a query returns what Query does, over segments and the data file
+	want, err := db.Query(0, math.MaxInt64, map[string]interface{}{"price": 3.0})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	got, err := db.QueryWithOpts(0, math.MaxInt64, map[string]interface{}{"price": 3.0}, hocdb.QueryOpts{MaxRows: 2000, MaxDuration: time.Minute})
+	if err != nil {
+		t.Fatalf("Failed to query with limits: %v", err)
+	}
+	if !bytes.Equal(got, want) || len(got) != 2000*db.RecordSize() {
+		t.Errorf("Expected the 2000 records of Query, got %d bytes", len(got))
+	}
+
+	var limitErr *hocdb.QueryLimitError
+	_, err = db.QueryWithOpts(0, math.MaxInt64, nil, hocdb.QueryOpts{MaxRows: 1999})
+	if !errors.As(err, &limitErr) || limitErr.Limit != "MaxRows" || limitErr.Max != 1999 || !errors.Is(err, hocdb.ErrQueryLimit) {
+		t.Errorf("Expected a MaxRows error, got %v", err)
+	}
+	// Filtered out records count against MaxBytes but not MaxRows
+	_, err = db.QueryWithOpts(0, math.MaxInt64, map[string]interface{}{"price": 3.0}, hocdb.QueryOpts{MaxRows: 5000, MaxBytes: 1 << 10})
+	if !errors.As(err, &limitErr) || limitErr.Limit != "MaxBytes" {
+		t.Errorf("Expected a MaxBytes error, got %v", err)
+	}
+	_, err = db.QueryWithOpts(0, math.MaxInt64, nil, hocdb.QueryOpts{MaxDuration: time.Nanosecond})
+	if !errors.As(err, &limitErr) || limitErr.Limit != "MaxDuration" {
+		t.Errorf("Expected a MaxDuration error, got %v", err)
+	}
+
+	// Only the data file is read for its range
+	got, err = db.QueryWithOpts(19000, 19100, nil, hocdb.QueryOpts{MaxRows: 100, MaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatalf("Failed to query with limits: %v", err)
+	}
+	if len(got) != 100*db.RecordSize() {
+		t.Errorf("Expected 100 records, got %d bytes", len(got))
+	}
+	// Zero options don't limit
+	got, err = db.QueryWithOpts(0, math.MaxInt64, nil, hocdb.QueryOpts{})
+	if err != nil || len(got) != 20000*db.RecordSize() {
+		t.Errorf("Expected all records without limits, got %d bytes, %v", len(got), err)
+	}
+}
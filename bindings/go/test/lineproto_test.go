@@ -0,0 +1,163 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"hocdb"
+	"hocdb/lineproto"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	p, err := lineproto.ParseLine(`cpu\ load,host=server\,01,region=us-west usage=0.64,count=3i,total=7u,ok=t,msg="a \"quoted\" value" 1465839830100400200`)
+	if err != nil {
+		t.Fatalf("ParseLine failed: %v", err)
+	}
+
+	if p.Measurement != "cpu load" {
+		t.Errorf("Expected measurement 'cpu load', got %q", p.Measurement)
+	}
+	if host, _ := p.Tag("host"); host != "server,01" {
+		t.Errorf("Expected host 'server,01', got %q", host)
+	}
+	if region, _ := p.Tag("region"); region != "us-west" {
+		t.Errorf("Expected region 'us-west', got %q", region)
+	}
+	if v := p.Fields["usage"]; v.Kind != lineproto.Float || v.F != 0.64 {
+		t.Errorf("Unexpected usage field: %+v", v)
+	}
+	if v := p.Fields["count"]; v.Kind != lineproto.Integer || v.I != 3 {
+		t.Errorf("Unexpected count field: %+v", v)
+	}
+	if v := p.Fields["total"]; v.Kind != lineproto.Unsigned || v.U != 7 {
+		t.Errorf("Unexpected total field: %+v", v)
+	}
+	if v := p.Fields["ok"]; v.Kind != lineproto.Boolean || !v.B {
+		t.Errorf("Unexpected ok field: %+v", v)
+	}
+	if v := p.Fields["msg"]; v.Kind != lineproto.String || v.S != `a "quoted" value` {
+		t.Errorf("Unexpected msg field: %+v", v)
+	}
+	if !p.HasTimestamp || p.Timestamp != 1465839830100400200 {
+		t.Errorf("Unexpected timestamp: %d", p.Timestamp)
+	}
+
+	p, err = lineproto.ParseLine("mem free=1i")
+	if err != nil {
+		t.Fatalf("ParseLine failed: %v", err)
+	}
+	if p.HasTimestamp {
+		t.Error("Expected no timestamp")
+	}
+
+	for _, line := range []string{"", "cpu", "cpu,host usage=1", "cpu usage=", `cpu msg="open`, "cpu usage=1 abc", "cpu count=1.5i"} {
+		if _, err := lineproto.ParseLine(line); err == nil {
+			t.Errorf("Expected error for %q", line)
+		}
+	}
+}
+
+func TestLineProtoWriter(t *testing.T) {
+	testDir := "../../../b_go_test_data_lineproto"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	w := lineproto.NewWriter(testDir, hocdb.Options{}, lineproto.Mapping{
+		TickerTags:    []string{"host"},
+		TimestampUnit: time.Millisecond,
+	})
+
+	input := strings.Join([]string{
+		"# comment",
+		"cpu,host=a usage=0.5,count=1i 1000",
+		"cpu,host=b usage=0.7,count=2i 1000",
+		"",
+		"cpu,host=a usage=0.6 2000",
+		"cpu,host=a usage=0.6,extra=1 3000",
+		"cpu,host=a usage=0.9 1500",
+	}, "\n")
+
+	result, err := w.WriteLines(strings.NewReader(input), time.Second)
+	if err != nil {
+		t.Fatalf("WriteLines failed: %v", err)
+	}
+	if result.Imported != 3 || len(result.Errors) != 2 || result.Errors[0].Line != 6 || result.Errors[1].Line != 7 {
+		t.Fatalf("Unexpected result: %d imported, errors %v", result.Imported, result.Errors)
+	}
+
+	// Gzipped request through the HTTP handler, millisecond precision
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	gz.Write([]byte("cpu,host=b usage=0.8,count=4i 5000000\n"))
+	gz.Close()
+
+	server := httptest.NewServer(lineproto.Handler(w))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/write?precision=ms", &body)
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(server.URL+"/write", "text/plain", strings.NewReader("cpu,host=b usage=\n"))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d", resp.StatusCode)
+	}
+
+	w.Close()
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "count", Type: hocdb.TypeI64},
+		{Name: "usage", Type: hocdb.TypeF64},
+	}
+
+	a, err := hocdb.New("cpu_a", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open cpu_a: %v", err)
+	}
+	data, _ := a.Load()
+	a.Close()
+	records, err := hocdb.DecodeRecords(schema, data)
+	if err != nil {
+		t.Fatalf("DecodeRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records for cpu_a, got %d", len(records))
+	}
+	if records[0].Timestamp() != 1000000 || records[1].Timestamp() != 2000000 {
+		t.Errorf("Unexpected timestamps: %d, %d", records[0].Timestamp(), records[1].Timestamp())
+	}
+	if count, _ := records[1].Get("count"); count != int64(0) {
+		t.Errorf("Expected missing count to be 0, got %v", count)
+	}
+
+	b, err := hocdb.New("cpu_b", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open cpu_b: %v", err)
+	}
+	data, _ = b.Load()
+	b.Close()
+	records, _ = hocdb.DecodeRecords(schema, data)
+	if len(records) != 2 || records[1].Timestamp() != 5000000 {
+		t.Fatalf("Unexpected cpu_b records: %v", records)
+	}
+	if usage, _ := records[1].Get("usage"); usage != 0.8 {
+		t.Errorf("Expected usage 0.8, got %v", usage)
+	}
+}
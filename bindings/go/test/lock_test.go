@@ -0,0 +1,64 @@
+package hocdb_test
+
+import (
+	"errors"
+	"hocdb"
+	"hocdb/hocdbtest"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestErrLocked(t *testing.T) {
+	testDir := "../../../b_go_test_data_lock"
+	if dir := os.Getenv("HOCDB_LOCK_TEST_DIR"); dir != "" {
+		// Another process opening the database, see below
+		_, err := hocdb.New(hocdbtest.Ticker, dir, hocdbtest.TickSchema, hocdb.Options{})
+		if !errors.Is(err, hocdb.ErrLocked) {
+			t.Fatalf("Expected ErrLocked in another process, got %v", err)
+		}
+		return
+	}
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	if err := db.AppendValues(int64(1), 1.0, 1.0); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	db.Flush()
+
+	// A second writer fails, in this process or another one
+	if _, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, hocdb.Options{}); !errors.Is(err, hocdb.ErrLocked) {
+		t.Errorf("Expected ErrLocked, got %v", err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestErrLocked$")
+	cmd.Env = append(os.Environ(), "HOCDB_LOCK_TEST_DIR="+testDir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("Expected ErrLocked in another process: %v\n%s", err, out)
+	}
+	if err := hocdb.DropTicker(testDir, hocdbtest.Ticker); !errors.Is(err, hocdb.ErrLocked) {
+		t.Errorf("Expected DropTicker to fail with ErrLocked, got %v", err)
+	}
+
+	// Readers don't take the lock
+	reader, err := hocdb.OpenReadOnly(hocdbtest.Ticker, testDir, hocdbtest.TickSchema)
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	defer reader.Close()
+	if data, err := reader.Load(); err != nil || len(data) != 24 {
+		t.Errorf("Expected the record from the reader, got %d bytes, %v", len(data), err)
+	}
+
+	// Closing releases the lock
+	db.Close()
+	db, err = hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	db.Close()
+}
@@ -0,0 +1,93 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"hocdb"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// logEntries decodes the entries a JSON slog handler wrote
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Failed to decode log entry %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	buf.Reset()
+	return entries
+}
+
+func TestLogger(t *testing.T) {
+	testDir := "../../../b_go_test_data_logger"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	var buf bytes.Buffer
+	opts := hocdb.Options{
+		Logger:        slog.New(slog.NewJSONHandler(&buf, nil)),
+		MaxFileSize:   12 + 3*16,
+		OverwriteFull: true,
+	}
+
+	db, err := hocdb.New("BTC_USD", testDir, schema, opts)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	entries := logEntries(t, &buf)
+	if len(entries) != 1 || entries[0]["msg"] != "created database" || entries[0]["ticker"] != "BTC_USD" {
+		t.Errorf("Unexpected log entries on create: %v", entries)
+	}
+
+	for i := 1; i <= 4; i++ {
+		if err := db.AppendValues(int64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	entries = logEntries(t, &buf)
+	if len(entries) != 1 || entries[0]["msg"] != "data file rotated, overwriting the oldest records" {
+		t.Errorf("Expected the fourth append to log a rotation, got %v", entries)
+	}
+	db.Close()
+
+	db, err = hocdb.New("BTC_USD", testDir, schema, opts)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	entries = logEntries(t, &buf)
+	if len(entries) != 1 || entries[0]["msg"] != "recovered database" || entries[0]["records"] != 3.0 || entries[0]["wrapped"] != true {
+		t.Errorf("Unexpected log entries on reopen: %v", entries)
+	}
+	db.Close()
+
+	// A torn write leaves a partial record behind
+	f, err := os.OpenFile(filepath.Join(testDir, "BTC_USD.bin"), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Failed to open data file: %v", err)
+	}
+	f.Truncate(12 + 16 + 5)
+	f.Close()
+
+	if _, err := hocdb.New("BTC_USD", testDir, schema, opts); err == nil {
+		t.Fatalf("Expected opening a torn data file to fail")
+	}
+	entries = logEntries(t, &buf)
+	if len(entries) != 1 || entries[0]["level"] != "ERROR" || !strings.Contains(entries[0]["reason"].(string), "partial record") {
+		t.Errorf("Unexpected log entries on a failed open: %v", entries)
+	}
+}
@@ -0,0 +1,90 @@
+package hocdb_test
+
+import (
+	"errors"
+	"hocdb"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	testDir := "../../../b_go_test_data_merge"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}, {Name: "price", Type: hocdb.TypeF64}}
+	open := func(dir string, timestamps ...int64) *hocdb.DB {
+		db, err := hocdb.New("BTC_USD", testDir+"/"+dir, schema, hocdb.Options{})
+		if err != nil {
+			t.Fatalf("Failed to create DB: %v", err)
+		}
+		for _, ts := range timestamps {
+			if err := db.AppendValues(ts, float64(ts)+0.5); err != nil {
+				t.Fatalf("Failed to append: %v", err)
+			}
+		}
+		return db
+	}
+	timestamps := func(db *hocdb.DB) []int64 {
+		data, err := db.Load()
+		if err != nil {
+			t.Fatalf("Failed to load: %v", err)
+		}
+		records, err := hocdb.DecodeRecords(schema, data)
+		if err != nil {
+			t.Fatalf("Failed to decode: %v", err)
+		}
+		var ts []int64
+		for _, rec := range records {
+			if rec.Values[1] != float64(rec.Timestamp())+0.5 {
+				t.Errorf("Unexpected record %v", rec.Values)
+			}
+			ts = append(ts, rec.Timestamp())
+		}
+		return ts
+	}
+
+	history := open("history", 1, 3, 5)
+	defer history.Close()
+	day1 := open("day1", 2, 3, 4, 6)
+	defer day1.Close()
+	day2 := open("day2", 7, 8)
+	defer day2.Close()
+
+	// Interleaved records rewrite the file, skipping the duplicate
+	if n, err := hocdb.Merge(history, day1); err != nil || n != 3 {
+		t.Fatalf("Expected 3 merged records, got %d, %v", n, err)
+	}
+	if ts := timestamps(history); !reflect.DeepEqual(ts, []int64{1, 2, 3, 4, 5, 6}) {
+		t.Errorf("Unexpected timestamps after the merge: %v", ts)
+	}
+	if ts := timestamps(day1); len(ts) != 4 {
+		t.Errorf("Expected the source to be unchanged, got %v", ts)
+	}
+
+	// Newer records are appended
+	var appended int
+	history.OnAppend(func(hocdb.Record) { appended++ })
+	if n, err := hocdb.Merge(history, day2); err != nil || n != 2 || appended != 2 {
+		t.Fatalf("Expected 2 appended records, got %d (%d callbacks), %v", n, appended, err)
+	}
+	if ts := timestamps(history); !reflect.DeepEqual(ts, []int64{1, 2, 3, 4, 5, 6, 7, 8}) {
+		t.Errorf("Unexpected timestamps after the merge: %v", ts)
+	}
+	if err := history.AppendValues(int64(9), 9.5); err != nil {
+		t.Errorf("Failed to append after merging: %v", err)
+	}
+
+	other, err := hocdb.New("BTC_USD", testDir+"/other", []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}}, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer other.Close()
+	if _, err := hocdb.Merge(history, other); !errors.Is(err, hocdb.ErrSchemaMismatch) {
+		t.Errorf("Expected a schema mismatch, got %v", err)
+	}
+	if _, err := hocdb.Merge(history, history); err == nil {
+		t.Errorf("Expected an error merging a database into itself")
+	}
+}
@@ -0,0 +1,109 @@
+package hocdb_test
+
+import (
+	"encoding/json"
+	"hocdb"
+	"hocdb/metrics"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	testDir := "../../../b_go_test_data_metrics"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	c := metrics.NewCollector()
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{Metrics: c.For("BTC_USD")})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	for i := 1; i <= 3; i++ {
+		if err := db.AppendValues(int64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if _, err := db.Query(2, 10, nil); err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if _, err := db.GetStats(0, 10, 1); err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+
+	s := c.Snapshot()["BTC_USD"]
+	if s.Appends != 3 || s.AppendBytes != 48 {
+		t.Errorf("Expected 3 appends of 48 bytes, got %d of %d", s.Appends, s.AppendBytes)
+	}
+	if s.Flushes == 0 || s.FlushErrors != 0 || s.FlushLatency.Count != s.Flushes {
+		t.Errorf("Unexpected flush metrics: %+v", s)
+	}
+	if s.Queries != 2 || s.RowsReturned != 2 || s.RowsScanned != 5 || s.QueryLatency.Count != 2 {
+		t.Errorf("Unexpected query metrics: %+v", s)
+	}
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE hocdb_appends_total counter",
+		`hocdb_appends_total{ticker="BTC_USD"} 3`,
+		`hocdb_rows_returned_total{ticker="BTC_USD"} 2`,
+		`hocdb_query_duration_seconds_bucket{ticker="BTC_USD",le="+Inf"} 2`,
+		`hocdb_query_duration_seconds_count{ticker="BTC_USD"} 2`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Prometheus output lacks %q:\n%s", line, body)
+		}
+	}
+
+	var vars map[string]metrics.Snapshot
+	if err := json.Unmarshal([]byte(c.Expvar().String()), &vars); err != nil {
+		t.Fatalf("Failed to decode expvar output: %v", err)
+	}
+	if vars["BTC_USD"].Appends != 3 {
+		t.Errorf("Expected 3 appends in expvar output, got %+v", vars)
+	}
+}
+
+func TestPoolMetrics(t *testing.T) {
+	testDir := "../../../b_go_test_data_pool_metrics"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "side", Type: hocdb.TypeI64},
+	}
+	c := metrics.NewCollector()
+	p, err := hocdb.NewPool("BTC_USD", testDir, schema, hocdb.Options{Metrics: c.For("BTC_USD")}, 2)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+	defer p.Close()
+
+	for i := 1; i <= 4; i++ {
+		if err := p.DB().AppendValues(int64(i), int64(i%2)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if _, err := p.Query(1, 4, map[string]interface{}{"side": int64(1)}); err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+
+	// A pool reads the records of the range, and returns the ones matching
+	s := c.Snapshot()["BTC_USD"]
+	if s.RowsScanned != 3 || s.RowsReturned != 2 {
+		t.Errorf("Expected 3 records scanned and 2 returned, got %d and %d", s.RowsScanned, s.RowsReturned)
+	}
+}
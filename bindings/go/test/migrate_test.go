@@ -0,0 +1,82 @@
+package hocdb_test
+
+import (
+	"errors"
+	"hocdb"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	testDir := "../../../b_go_test_data_migrate"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	for _, ticker := range []string{"BTC_USD", "ETH_USD"} {
+		db, err := hocdb.New(ticker, testDir, schema, hocdb.Options{})
+		if err != nil {
+			t.Fatalf("Failed to create DB: %v", err)
+		}
+		db.AppendValues(int64(1), 100.0)
+		if v := db.SchemaVersion(); v != 0 {
+			t.Errorf("Expected schema version 0, got %d", v)
+		}
+		db.Close()
+	}
+
+	applied := map[int]int{}
+	migrations := []hocdb.Migration{
+		{Version: 2, Description: "rename price", Apply: func(db *hocdb.DB) error {
+			applied[2]++
+			return db.RenameField("price", "close")
+		}},
+		{Version: 1, Description: "add volume", Apply: func(db *hocdb.DB) error {
+			applied[1]++
+			return db.AddField(hocdb.Field{Name: "volume", Type: hocdb.TypeF64}, 0.0)
+		}},
+	}
+	if err := hocdb.Migrate(testDir, migrations...); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if applied[1] != 2 || applied[2] != 2 {
+		t.Errorf("Expected each migration to run once per ticker, got %v", applied)
+	}
+
+	// Done migrations are skipped, new ones run
+	failing := errors.New("boom")
+	migrations = append(migrations, hocdb.Migration{Version: 3, Description: "fail", Apply: func(db *hocdb.DB) error {
+		return failing
+	}})
+	if err := hocdb.Migrate(testDir, migrations...); !errors.Is(err, failing) {
+		t.Errorf("Expected the failing migration's error, got %v", err)
+	}
+	if applied[1] != 2 || applied[2] != 2 {
+		t.Errorf("Expected applied migrations to be skipped, got %v", applied)
+	}
+
+	want := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "close", Type: hocdb.TypeF64},
+		{Name: "volume", Type: hocdb.TypeF64},
+	}
+	db, found, err := hocdb.OpenExisting("ETH_USD", testDir)
+	if err != nil {
+		t.Fatalf("Failed to open migrated DB: %v", err)
+	}
+	defer db.Close()
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("Expected schema %v, got %v", want, found)
+	}
+	if v := db.SchemaVersion(); v != 2 {
+		t.Errorf("Expected schema version 2, got %d", v)
+	}
+
+	if err := hocdb.Migrate(testDir, hocdb.Migration{Version: 0, Apply: migrations[0].Apply}); err == nil {
+		t.Errorf("Expected an error for version 0")
+	}
+}
@@ -0,0 +1,93 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestNarrowTypes(t *testing.T) {
+	testDir := "../../../b_go_test_data_narrow"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema, err := hocdb.ParseSchema("timestamp:i64,temp:f32,reading:i32,count:u32,delta:i16,level:u8")
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+	if size := hocdb.RecordSize(schema); size != 8+4+4+4+2+1 {
+		t.Errorf("Expected record size 23, got %d", size)
+	}
+
+	db, err := hocdb.New("SENSOR", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	// Any Go integer fits a narrow integer field when in range
+	if err := db.AppendValues(int64(1), float32(20.5), int32(-7), uint32(40000), int16(-300), uint8(3)); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if err := db.AppendValues(int64(2), 21.25, 1<<20, 7, 300, 255); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if _, err := hocdb.CreateRecordBytes(schema, int64(3), 1.0, 0, 0, 1<<15, 0); err == nil {
+		t.Errorf("Expected an error for a value out of range of i16")
+	}
+	if _, err := hocdb.CreateRecordBytes(schema, int64(3), 1.0, 0, -1, 0, 0); err == nil {
+		t.Errorf("Expected an error for a negative u32")
+	}
+
+	data, err := db.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	records, err := hocdb.DecodeRecords(schema, data)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	want := [][]interface{}{
+		{int64(1), float32(20.5), int32(-7), uint32(40000), int16(-300), uint8(3)},
+		{int64(2), float32(21.25), int32(1 << 20), uint32(7), int16(300), uint8(255)},
+	}
+	for i, rec := range records {
+		if !reflect.DeepEqual(rec.Values, want[i]) {
+			t.Errorf("Expected record %v, got %v", want[i], rec.Values)
+		}
+	}
+
+	stats, err := db.GetStatsByName(0, 10, "delta")
+	if err != nil || stats.Min != -300 || stats.Max != 300 {
+		t.Errorf("Unexpected stats of i16 field: %+v, %v", stats, err)
+	}
+
+	ro, err := hocdb.OpenReadOnly("SENSOR", testDir, schema)
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	defer ro.Close()
+
+	// Integer filters match narrow integer fields by value, float filters f32 fields
+	for _, filters := range []map[string]interface{}{
+		{"reading": -7},
+		{"count": uint64(40000)},
+		{"delta": int16(-300)},
+		{"level": 3},
+		{"temp": 20.5},
+	} {
+		for name, d := range map[string]*hocdb.DB{"engine": db, "read-only": ro} {
+			data, err := d.Query(0, 10, filters)
+			if err != nil {
+				t.Fatalf("Failed to query %v: %v", filters, err)
+			}
+			if records, _ := hocdb.DecodeRecords(schema, data); len(records) != 1 || records[0].Timestamp() != 1 {
+				t.Errorf("%s: expected record 1 for filter %v, got %v", name, filters, records)
+			}
+		}
+	}
+	if data, _ := db.Query(0, 10, map[string]interface{}{"level": 1000}); len(data) != 0 {
+		t.Errorf("Expected no match for a value out of range of the field")
+	}
+}
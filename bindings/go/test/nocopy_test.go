@@ -0,0 +1,80 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"os"
+	"testing"
+)
+
+func TestQueryNoCopy(t *testing.T) {
+	testDir := "../../../b_go_test_data_nocopy"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	for i := int64(1); i <= 100; i++ {
+		record, _ := hocdb.CreateRecordBytes(schema, i, float64(i)*1.5)
+		if err := db.Append(record); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+
+	want, err := db.Query(10, 50, nil)
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	result, err := db.QueryNoCopy(10, 50, nil)
+	if err != nil {
+		t.Fatalf("Failed to query without copying: %v", err)
+	}
+	if !bytes.Equal(result.Data, want) {
+		t.Errorf("QueryNoCopy returned %d bytes, Query %d", len(result.Data), len(want))
+	}
+	records, err := hocdb.DecodeRecords(schema, result.Data)
+	if err != nil || len(records) != 40 || records[0].Timestamp() != 10 {
+		t.Errorf("Unexpected records: %d, %v", len(records), err)
+	}
+	result.Release()
+	result.Release()
+	if result.Data != nil {
+		t.Errorf("Expected Data to be cleared by Release")
+	}
+
+	// Filters and empty results
+	result, err = db.QueryNoCopy(0, 1000, map[string]interface{}{"price": 3.0})
+	if err != nil || len(result.Data) != hocdb.RecordSize(schema) {
+		t.Errorf("Unexpected filtered result: %d bytes, %v", len(result.Data), err)
+	}
+	result.Release()
+
+	result, err = db.QueryNoCopy(500, 600, nil)
+	if err != nil || len(result.Data) != 0 {
+		t.Errorf("Expected an empty result, got %d bytes, %v", len(result.Data), err)
+	}
+	result.Release()
+
+	// Results outlive the database
+	result, err = db.QueryNoCopy(0, 1000, nil)
+	if err != nil {
+		t.Fatalf("Failed to query without copying: %v", err)
+	}
+	db.Close()
+	if len(result.Data) != 100*hocdb.RecordSize(schema) {
+		t.Errorf("Expected 100 records, got %d bytes", len(result.Data))
+	}
+	result.Release()
+
+	if _, err := db.QueryNoCopy(0, 1000, nil); err == nil {
+		t.Errorf("Expected an error querying a closed database")
+	}
+}
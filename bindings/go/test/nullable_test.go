@@ -0,0 +1,181 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"errors"
+	"hocdb"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNullableFields(t *testing.T) {
+	testDir := "../../../b_go_test_data_nullable"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema, err := hocdb.ParseSchema("timestamp:i64,price:f64?,qty:i32,note:string(8)?")
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+	if !schema[1].Nullable || schema[2].Nullable || !schema[3].Nullable {
+		t.Errorf("Unexpected nullability: %v", schema)
+	}
+	// One byte of null bitmap after the values
+	if size := hocdb.RecordSize(schema); size != 8+8+4+8+1 {
+		t.Errorf("Expected record size 29, got %d", size)
+	}
+	if _, err := hocdb.CreateRecordBytes(schema, int64(1), 1.5, nil, "x"); err == nil {
+		t.Errorf("Expected an error for a nil value in a field that isn't nullable")
+	}
+	if _, err := hocdb.New("NULLS", testDir, []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64, Nullable: true}}, hocdb.Options{}); err == nil {
+		t.Errorf("Expected an error for a nullable timestamp")
+	}
+
+	db, err := hocdb.New("NULLS", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	rows := [][]interface{}{
+		{int64(1), 10.0, int32(1), "a"},
+		{int64(2), nil, int32(2), nil},
+		{int64(3), 0.0, int32(3), "c"},
+		{int64(4), 30.0, int32(4), nil},
+	}
+	for _, row := range rows {
+		if err := db.AppendValues(row...); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+
+	data, err := db.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	records, err := hocdb.DecodeRecords(schema, data)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	for i, rec := range records {
+		if !reflect.DeepEqual(rec.Values, rows[i]) {
+			t.Errorf("Expected record %v, got %v", rows[i], rec.Values)
+		}
+	}
+
+	// Zero values don't match nil filters, nor nulls value filters
+	for _, tc := range []struct {
+		filters map[string]interface{}
+		want    []int64
+	}{
+		{map[string]interface{}{"price": nil}, []int64{2}},
+		{map[string]interface{}{"price": 0.0}, []int64{3}},
+		{map[string]interface{}{"note": nil, "qty": 4}, []int64{4}},
+	} {
+		data, err := db.Query(0, 10, tc.filters)
+		if err != nil {
+			t.Fatalf("Failed to query: %v", err)
+		}
+		var got []int64
+		records, _ := hocdb.DecodeRecords(schema, data)
+		for _, rec := range records {
+			got = append(got, rec.Timestamp())
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Expected %v for %v, got %v", tc.want, tc.filters, got)
+		}
+	}
+	if _, err := db.Query(0, 10, map[string]interface{}{"qty": nil}); err == nil {
+		t.Errorf("Expected an error for a nil filter on a field that isn't nullable")
+	}
+
+	// Stats leave the nulls out
+	stats, err := db.GetStatsByName(0, 10, "price")
+	if err != nil || stats.Count != 3 || stats.Min != 0 || stats.Mean != 40.0/3 {
+		t.Errorf("Unexpected stats %+v, %v", stats, err)
+	}
+	if _, err := db.GetLatestByName("note"); !errors.Is(err, hocdb.ErrNull) {
+		t.Errorf("Expected ErrNull for the latest note, got %v", err)
+	}
+	if latest, err := db.GetLatestByName("price"); err != nil || latest.Value != 30 {
+		t.Errorf("Unexpected latest price %+v, %v", latest, err)
+	}
+
+	// CSV writes nulls as empty values, which imports read back
+	var buf bytes.Buffer
+	if err := db.ExportCSV(&buf, 0, 10, hocdb.CSVOptions{}); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	if !strings.Contains(buf.String(), "2,,2,\n") {
+		t.Errorf("Expected empty nulls in %s", buf.String())
+	}
+	cp, err := hocdb.New("NULLS", testDir+"/copy", schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer cp.Close()
+	if _, err := cp.ImportCSV(&buf, hocdb.CSVMapping{}); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if copied, err := cp.Load(); err != nil || !bytes.Equal(copied, data) {
+		t.Errorf("Expected the imported records to match, got %v", err)
+	}
+
+	// Schema changes keep the nulls
+	if err := db.AddField(hocdb.Field{Name: "venue", Type: hocdb.TypeU8, Nullable: true}, nil); err != nil {
+		t.Fatalf("Failed to add field: %v", err)
+	}
+	if err := db.DropField("price"); err != nil {
+		t.Fatalf("Failed to drop field: %v", err)
+	}
+	schema = db.Schema()
+	data, err = db.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	records, err = hocdb.DecodeRecords(schema, data)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if want := []interface{}{int64(2), int32(2), nil, nil}; len(records) != 4 || !reflect.DeepEqual(records[1].Values, want) {
+		t.Errorf("Expected record %v after the schema changes, got %v", want, records)
+	}
+	db.Close()
+
+	// The recorded schema has the nullable fields
+	if _, err := hocdb.New("NULLS", testDir, []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "qty", Type: hocdb.TypeI32},
+		{Name: "note", Type: hocdb.StringType(8)},
+		{Name: "venue", Type: hocdb.TypeU8, Nullable: true},
+	}, hocdb.Options{}); !errors.Is(err, hocdb.ErrSchemaMismatch) {
+		t.Errorf("Expected a schema mismatch for note, got %v", err)
+	}
+	reopened, stored, err := hocdb.OpenExisting("NULLS", testDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	defer reopened.Close()
+	if !reflect.DeepEqual(stored, schema) {
+		t.Errorf("Expected schema %v, got %v", schema, stored)
+	}
+
+	// Read-only handles match nulls by themselves
+	ro, err := hocdb.OpenReadOnly("NULLS", testDir, schema)
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	defer ro.Close()
+	data, err = ro.Query(0, 10, map[string]interface{}{"note": nil})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if n := len(data) / hocdb.RecordSize(schema); n != 2 {
+		t.Errorf("Expected 2 null notes, got %d", n)
+	}
+	if _, err := ro.GetLatestByName("venue"); !errors.Is(err, hocdb.ErrNull) {
+		t.Errorf("Expected ErrNull for the latest venue, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package hocdb_test
+
+import (
+	"errors"
+	"hocdb"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOpenExisting(t *testing.T) {
+	testDir := "../../../b_go_test_data_open_existing"
+	snapDir := "../../../b_go_test_data_open_existing_snap"
+	os.RemoveAll(testDir)
+	os.RemoveAll(snapDir)
+	defer os.RemoveAll(testDir)
+	defer os.RemoveAll(snapDir)
+
+	if _, _, err := hocdb.OpenExisting("BTC_USD", testDir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected os.ErrNotExist for a missing database, got %v", err)
+	}
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "side", Type: hocdb.TypeString},
+		{Name: "taker", Type: hocdb.TypeBool},
+	}
+	size := int64(hocdb.RecordSize(schema))
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{MaxFileSize: 12 + 3*size, OverwriteFull: true})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	for i := 1; i <= 2; i++ {
+		db.AppendValues(int64(i), float64(i), "buy", true)
+	}
+	db.Close()
+
+	db, found, err := hocdb.OpenExisting("BTC_USD", testDir)
+	if err != nil {
+		t.Fatalf("Failed to open existing DB: %v", err)
+	}
+	if !reflect.DeepEqual(found, schema) {
+		t.Errorf("Expected schema %v, got %v", schema, found)
+	}
+
+	// The ring buffer options came along: appends wrap instead of failing
+	for i := 3; i <= 4; i++ {
+		if err := db.AppendValues(int64(i), float64(i), "sell", false); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	data, _ := db.Load()
+	records, _ := hocdb.DecodeRecords(found, data)
+	if len(records) != 3 || records[0].Timestamp() != 2 {
+		t.Errorf("Expected records 2 to 4, got %v", records)
+	}
+
+	if err := db.Snapshot(snapDir); err != nil {
+		t.Fatalf("Failed to snapshot: %v", err)
+	}
+	snap, _, err := hocdb.OpenExisting("BTC_USD", snapDir)
+	if err != nil {
+		t.Fatalf("Failed to open the snapshot: %v", err)
+	}
+	snap.Close()
+
+	db.Drop()
+	if _, err := os.Stat(filepath.Join(testDir, "BTC_USD.schema.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected Drop to remove the metadata, got %v", err)
+	}
+}
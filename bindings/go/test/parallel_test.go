@@ -0,0 +1,90 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hocdb"
+	"hocdb/hocdbtest"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestParallelQuery(t *testing.T) {
+	testDir := "../../../b_go_test_data_parallel_query"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	compression := &hocdb.Compression{Codec: "deflate", SegmentRecords: 100}
+	db, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, hocdb.Options{Compression: compression})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	for i := 1; i <= 2050; i++ {
+		if err := db.AppendValues(int64(i), float64(i), float64(i%7)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	segments, err := db.Segments()
+	if err != nil {
+		t.Fatalf("Failed to list segments: %v", err)
+	}
+	if len(segments) < 10 {
+		t.Fatalf("Expected 10 segments at least, got %d", len(segments))
+	}
+	db.Close()
+
+	query := func(parallelism int, start, end int64) []byte {
+		db, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, hocdb.Options{Compression: compression, QueryParallelism: parallelism})
+		if err != nil {
+			t.Fatalf("Failed to open DB: %v", err)
+		}
+		defer db.Close()
+		data, err := db.Query(start, end, nil)
+		if err != nil {
+			t.Fatalf("Failed to query: %v", err)
+		}
+		return data
+	}
+
+	// Any number of workers gives the records of a sequential scan, in time order
+	for _, r := range [][2]int64{{math.MinInt64, math.MaxInt64}, {150, 1777}, {2001, 2051}} {
+		want := query(1, r[0], r[1])
+		for _, parallelism := range []int{0, 3, 64} {
+			if got := query(parallelism, r[0], r[1]); !bytes.Equal(got, want) {
+				t.Errorf("Expected %d records from [%d, %d) with %d workers, got %d", len(want)/24, r[0], r[1], parallelism, len(got)/24)
+			}
+		}
+	}
+	all := query(4, math.MinInt64, math.MaxInt64)
+	if len(all) != 2050*24 {
+		t.Fatalf("Expected 2050 records, got %d", len(all)/24)
+	}
+	for i := 0; i < 2050; i++ {
+		if ts := int64(binary.LittleEndian.Uint64(all[i*24:])); ts != int64(i+1) {
+			t.Fatalf("Expected timestamp %d at %d, got %d", i+1, i, ts)
+		}
+	}
+
+	// A corrupt segment fails the query whichever worker reads it
+	data, err := os.ReadFile(segments[5].Path)
+	if err != nil {
+		t.Fatalf("Failed to read segment: %v", err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(segments[5].Path, data, 0644); err != nil {
+		t.Fatalf("Failed to corrupt segment: %v", err)
+	}
+	db, err = hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, hocdb.Options{Compression: compression, QueryParallelism: 4})
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Query(math.MinInt64, math.MaxInt64, nil); !errors.Is(err, hocdb.ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"hocdb/hocdbtest"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPartitionBy(t *testing.T) {
+	testDir := "../../../b_go_test_data_partition"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	// Trading days in New York, whose midnight is 04:00 or 05:00 UTC
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("No time zone data: %v", err)
+	}
+	options := hocdb.Options{TimestampPrecision: time.Second, PartitionBy: hocdb.PartitionDay, PartitionLocation: ny}
+	db, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	// Hourly records over three days
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, ny)
+	for i := 0; i < 72; i++ {
+		ts := start.Add(time.Duration(i) * time.Hour)
+		if err := db.AppendValues(ts, float64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+
+	// The first two days are segments, the third stays in the data file
+	segments, err := db.Segments()
+	if err != nil {
+		t.Fatalf("Failed to list segments: %v", err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("Expected 2 partitions, got %d", len(segments))
+	}
+	for i, s := range segments {
+		day := start.AddDate(0, 0, i)
+		if s.Records != 24 || s.First != day.Unix() || s.Last != day.Add(23*time.Hour).Unix() || s.Codec != "none" {
+			t.Errorf("Unexpected partition %d: %+v", i, s)
+		}
+	}
+	data, err := db.Query(math.MinInt64, math.MaxInt64, nil)
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if n := len(data) / db.RecordSize(); n != 72 {
+		t.Errorf("Expected 72 records, got %d", n)
+	}
+
+	if err := db.DropPartition(start.Add(12 * time.Hour)); err != nil {
+		t.Fatalf("Failed to drop partition: %v", err)
+	}
+	if _, err := os.Stat(segments[0].Path); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be deleted", segments[0].Path)
+	}
+	data, err = db.Query(math.MinInt64, math.MaxInt64, nil)
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if n := len(data) / db.RecordSize(); n != 48 {
+		t.Errorf("Expected 48 records after dropping a day, got %d", n)
+	}
+	if err := db.DropPartition(start.AddDate(0, 0, 2)); err == nil {
+		t.Errorf("Expected an error for the partition of the data file")
+	}
+
+	// A flush on the next day rolls the third one in the background
+	if err := db.AppendValues(start.AddDate(0, 0, 3), 72.0, 72.0); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	db.Close()
+	db, err = hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, options)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	if segments, _ = db.Segments(); len(segments) != 2 || segments[1].First != start.AddDate(0, 0, 2).Unix() {
+		t.Errorf("Expected the third day rolled into a partition, got %+v", segments)
+	}
+
+	if p := hocdb.PartitionMonth; p.Start(start.AddDate(0, 0, 10), ny) != time.Date(2024, 3, 1, 0, 0, 0, 0, ny) ||
+		p.End(start, ny) != time.Date(2024, 4, 1, 0, 0, 0, 0, ny) {
+		t.Errorf("Unexpected month boundaries")
+	}
+	if _, err := hocdb.New("RING", testDir, hocdbtest.TickSchema, hocdb.Options{PartitionBy: hocdb.PartitionDay, OverwriteFull: true}); err == nil {
+		t.Errorf("Expected an error for partitioning with OverwriteFull")
+	}
+}
@@ -0,0 +1,144 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"math"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	testDir := "../../../b_go_test_data_pool"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "side", Type: hocdb.TypeString},
+		{Name: "taker", Type: hocdb.TypeBool},
+	}
+	pool, err := hocdb.NewPool("BTC_USD", testDir, schema, hocdb.Options{}, 4)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+	defer pool.Close()
+
+	for i := 0; i < 1000; i++ {
+		side := "buy"
+		if i%3 == 0 {
+			side = "sell"
+		}
+		record, _ := hocdb.CreateRecordBytes(schema, int64(i*10), float64(i%7), side, i%2 == 0)
+		if err := pool.Append(record); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+
+	// Pool queries return what the engine returns
+	cases := []struct {
+		start, end int64
+		filters    interface{}
+	}{
+		{math.MinInt64, math.MaxInt64, nil},
+		{100, 5000, nil},
+		{105, 106, nil},
+		{0, 10000, map[string]interface{}{"side": "sell"}},
+		{0, 10000, []hocdb.Filter{{FieldIndex: 1, Value: 3.0}, {FieldIndex: 3, Value: true}}},
+		{0, 10000, []hocdb.Filter{{FieldIndex: 1, Value: int64(3)}}},
+	}
+	for _, c := range cases {
+		want, err := pool.DB().Query(c.start, c.end, c.filters)
+		if err != nil {
+			t.Fatalf("Engine query failed: %v", err)
+		}
+		got, err := pool.Query(c.start, c.end, c.filters)
+		if err != nil {
+			t.Fatalf("Pool query failed: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("Query(%d, %d, %v) returned %d bytes, the engine %d", c.start, c.end, c.filters, len(got), len(want))
+		}
+	}
+
+	// Concurrent readers and a writer
+	var wg sync.WaitGroup
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				data, err := pool.Query(0, 5000, nil)
+				if err != nil {
+					t.Errorf("Failed to query: %v", err)
+					return
+				}
+				if len(data) != 500*hocdb.RecordSize(schema) {
+					t.Errorf("Expected 500 records, got %d bytes", len(data))
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1000; i < 1100; i++ {
+			record, _ := hocdb.CreateRecordBytes(schema, int64(i*10), 1.0, "buy", false)
+			if err := pool.Append(record); err != nil {
+				t.Errorf("Failed to append: %v", err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	data, err := pool.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if len(data) != 1100*hocdb.RecordSize(schema) {
+		t.Errorf("Expected 1100 records, got %d bytes", len(data))
+	}
+
+	pool.Close()
+	if _, err := pool.Query(0, 100, nil); err == nil {
+		t.Errorf("Expected an error querying a closed pool")
+	}
+}
+
+func TestPoolRingBuffer(t *testing.T) {
+	testDir := "../../../b_go_test_data_pool_ring"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "value", Type: hocdb.TypeI64},
+	}
+	pool, err := hocdb.NewPool("RING", testDir, schema, hocdb.Options{MaxFileSize: 12 + 10*16, OverwriteFull: true}, 2)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+	defer pool.Close()
+
+	for i := int64(1); i <= 25; i++ {
+		record, _ := hocdb.CreateRecordBytes(schema, i, i)
+		if err := pool.Append(record); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+
+		for _, r := range [][2]int64{{math.MinInt64, math.MaxInt64}, {3, 18}, {i - 2, i}} {
+			want, _ := pool.DB().Query(r[0], r[1], nil)
+			got, err := pool.Query(r[0], r[1], nil)
+			if err != nil {
+				t.Fatalf("Pool query failed: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("After %d appends, Query(%d, %d) returned %d bytes, the engine %d", i, r[0], r[1], len(got), len(want))
+			}
+		}
+	}
+}
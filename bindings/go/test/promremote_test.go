@@ -0,0 +1,314 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hocdb"
+	"hocdb/promremote"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Minimal protobuf and snappy encoders for building remote-write requests
+
+func appendProtoBytes(buf []byte, field int, data []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field<<3|2))
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+func encodeTimeSeries(labels []promremote.Label, timestamps []int64, values []float64) []byte {
+	var ts []byte
+	for _, label := range labels {
+		var l []byte
+		l = appendProtoBytes(l, 1, []byte(label.Name))
+		l = appendProtoBytes(l, 2, []byte(label.Value))
+		ts = appendProtoBytes(ts, 1, l)
+	}
+	for i := range timestamps {
+		s := []byte{1<<3 | 1}
+		s = binary.LittleEndian.AppendUint64(s, math.Float64bits(values[i]))
+		s = append(s, 2<<3)
+		s = binary.AppendUvarint(s, uint64(timestamps[i]))
+		ts = appendProtoBytes(ts, 2, s)
+	}
+	return ts
+}
+
+// snappyLiteral encodes data as a snappy block made only of literals
+func snappyLiteral(data []byte) []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(data)))
+	for len(data) > 0 {
+		n := len(data)
+		if n > 65536 {
+			n = 65536
+		}
+		buf = append(buf, 61<<2, byte(n-1), byte((n-1)>>8))
+		buf = append(buf, data[:n]...)
+		data = data[n:]
+	}
+	return buf
+}
+
+// snappyLiteralDecode reverses snappyLiteral, also accepting the shorter literal tags
+func snappyLiteralDecode(t *testing.T, data []byte) []byte {
+	n, read := binary.Uvarint(data)
+	data = data[read:]
+	out := make([]byte, 0, n)
+	for len(data) > 0 {
+		length := int(data[0] >> 2)
+		if data[0]&3 != 0 {
+			t.Fatalf("Unexpected snappy copy tag")
+		}
+		data = data[1:]
+		if length >= 60 {
+			extra := length - 59
+			length = 0
+			for i := extra - 1; i >= 0; i-- {
+				length = length<<8 | int(data[i])
+			}
+			data = data[extra:]
+		}
+		out = append(out, data[:length+1]...)
+		data = data[length+1:]
+	}
+	return out
+}
+
+// protoFields splits a protobuf message into the raw values of each field number
+func protoFields(t *testing.T, msg []byte) map[int][][]byte {
+	fields := make(map[int][][]byte)
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		msg = msg[n:]
+		var value []byte
+		switch key & 7 {
+		case 0:
+			_, n := binary.Uvarint(msg)
+			value, msg = msg[:n], msg[n:]
+		case 1:
+			value, msg = msg[:8], msg[8:]
+		case 2:
+			length, n := binary.Uvarint(msg)
+			value, msg = msg[n:n+int(length)], msg[n+int(length):]
+		default:
+			t.Fatalf("Unexpected wire type %d", key&7)
+		}
+		fields[int(key>>3)] = append(fields[int(key>>3)], value)
+	}
+	return fields
+}
+
+func encodeReadQuery(start, end int64, matchers ...[3]string) []byte {
+	var q []byte
+	q = append(q, 1<<3)
+	q = binary.AppendUvarint(q, uint64(start))
+	q = append(q, 2<<3)
+	q = binary.AppendUvarint(q, uint64(end))
+	for _, m := range matchers {
+		kinds := map[string]byte{"=": 0, "!=": 1, "=~": 2, "!~": 3}
+		lm := []byte{1 << 3, kinds[m[1]]}
+		lm = appendProtoBytes(lm, 2, []byte(m[0]))
+		lm = appendProtoBytes(lm, 3, []byte(m[2]))
+		q = appendProtoBytes(q, 3, lm)
+	}
+	return q
+}
+
+func postRemoteWrite(t *testing.T, url string, series ...[]byte) int {
+	var req []byte
+	for _, ts := range series {
+		req = appendProtoBytes(req, 1, ts)
+	}
+	resp, err := http.Post(url, "application/x-protobuf", bytes.NewReader(snappyLiteral(req)))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestPromRemoteWrite(t *testing.T) {
+	testDir := "../../../b_go_test_data_promremote"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	s := promremote.NewStorage(testDir, hocdb.Options{})
+	server := httptest.NewServer(promremote.WriteHandler(s))
+	defer server.Close()
+
+	upA := []promremote.Label{{Name: "job", Value: "a"}, {Name: "__name__", Value: "up"}}
+	upB := []promremote.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "b"}}
+
+	status := postRemoteWrite(t, server.URL,
+		encodeTimeSeries(upA, []int64{1000, 2000}, []float64{1, 0}),
+		encodeTimeSeries(upB, []int64{1000}, []float64{1}),
+	)
+	if status != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", status)
+	}
+
+	// A retried request overlapping stored samples only adds the new ones
+	status = postRemoteWrite(t, server.URL, encodeTimeSeries(upA, []int64{2000, 3000}, []float64{0, math.NaN()}))
+	if status != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", status)
+	}
+
+	status = postRemoteWrite(t, server.URL, encodeTimeSeries([]promremote.Label{{Name: "job", Value: "a"}}, []int64{1000}, []float64{1}))
+	if status != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for series without a name, got %d", status)
+	}
+
+	resp, err := http.Post(server.URL, "application/x-protobuf", bytes.NewReader([]byte{0xff}))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for corrupt body, got %d", resp.StatusCode)
+	}
+
+	s.Close()
+
+	if _, err := os.Stat(filepath.Join(testDir, "up", "series.json")); err != nil {
+		t.Fatalf("Missing series index: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(testDir, "up", "*.bin"))
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 series files, got %d", len(files))
+	}
+
+	total := 0
+	for _, file := range files {
+		ticker := filepath.Base(file)
+		ticker = ticker[:len(ticker)-len(".bin")]
+		db, err := hocdb.New(ticker, filepath.Join(testDir, "up"), promremote.Schema, hocdb.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open series: %v", err)
+		}
+		data, _ := db.Load()
+		db.Close()
+		records, err := hocdb.DecodeRecords(promremote.Schema, data)
+		if err != nil {
+			t.Fatalf("DecodeRecords failed: %v", err)
+		}
+		total += len(records)
+		if len(records) == 3 {
+			if v, _ := records[2].Get("value"); !math.IsNaN(v.(float64)) {
+				t.Errorf("Expected staleness NaN, got %v", v)
+			}
+		}
+	}
+	if total != 4 {
+		t.Errorf("Expected 4 samples in total, got %d", total)
+	}
+
+	// Reopening picks up the existing series and their last timestamps
+	s = promremote.NewStorage(testDir, hocdb.Options{})
+	defer s.Close()
+	server.Config.Handler = promremote.WriteHandler(s)
+	status = postRemoteWrite(t, server.URL, encodeTimeSeries(upA, []int64{3000, 4000}, []float64{1, 1}))
+	if status != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", status)
+	}
+	files, _ = filepath.Glob(filepath.Join(testDir, "up", "*.bin"))
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 series files after reopen, got %d", len(files))
+	}
+}
+
+func TestPromRemoteRead(t *testing.T) {
+	testDir := "../../../b_go_test_data_promremote_read"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	s := promremote.NewStorage(testDir, hocdb.Options{})
+	defer s.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/write", promremote.WriteHandler(s))
+	mux.Handle("/read", promremote.ReadHandler(s))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	status := postRemoteWrite(t, server.URL+"/write",
+		encodeTimeSeries([]promremote.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}}, []int64{1000, 2000, 3000}, []float64{1, 0, 1}),
+		encodeTimeSeries([]promremote.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "db"}}, []int64{1000, 2000}, []float64{1, 1}),
+		encodeTimeSeries([]promremote.Label{{Name: "__name__", Value: "load"}, {Name: "job", Value: "api"}}, []int64{2000}, []float64{0.5}),
+	)
+	if status != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", status)
+	}
+
+	read := func(queries ...[]byte) [][]byte {
+		var req []byte
+		for _, q := range queries {
+			req = appendProtoBytes(req, 1, q)
+		}
+		req = append(req, 2<<3, 0) // Accept SAMPLES
+		resp, err := http.Post(server.URL+"/read", "application/x-protobuf", bytes.NewReader(snappyLiteral(req)))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", resp.StatusCode)
+		}
+		body := new(bytes.Buffer)
+		body.ReadFrom(resp.Body)
+		return protoFields(t, snappyLiteralDecode(t, body.Bytes()))[1]
+	}
+
+	// Inclusive time range, equality on the name and a regexp on the job
+	results := read(
+		encodeReadQuery(2000, 3000, [3]string{"__name__", "=", "up"}, [3]string{"job", "=~", "a.*"}),
+		encodeReadQuery(0, 5000, [3]string{"job", "!=", "db"}),
+	)
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 query results, got %d", len(results))
+	}
+
+	series := protoFields(t, results[0])[1]
+	if len(series) != 1 {
+		t.Fatalf("Expected 1 series, got %d", len(series))
+	}
+	ts := protoFields(t, series[0])
+	if len(ts[1]) != 2 || len(ts[2]) != 2 {
+		t.Fatalf("Expected 2 labels and 2 samples, got %d and %d", len(ts[1]), len(ts[2]))
+	}
+	if job := protoFields(t, ts[1][1]); string(job[2][0]) != "api" {
+		t.Errorf("Expected job=api, got %s", job[2][0])
+	}
+	first := protoFields(t, ts[2][0])
+	if math.Float64frombits(binary.LittleEndian.Uint64(first[1][0])) != 0 {
+		t.Errorf("Unexpected first sample value")
+	}
+	if tsMs, _ := binary.Uvarint(first[2][0]); tsMs != 2000 {
+		t.Errorf("Expected first sample at 2000, got %d", tsMs)
+	}
+
+	// Without a name matcher every metric is scanned; series come back sorted by labels
+	series = protoFields(t, results[1])[1]
+	if len(series) != 2 {
+		t.Fatalf("Expected 2 series, got %d", len(series))
+	}
+	name := protoFields(t, protoFields(t, series[0])[1][0])
+	if string(name[2][0]) != "load" {
+		t.Errorf("Expected load first, got %s", name[2][0])
+	}
+
+	var req []byte
+	req = appendProtoBytes(req, 1, encodeReadQuery(0, 1, [3]string{"job", "=~", "("}))
+	resp, err := http.Post(server.URL+"/read", "application/x-protobuf", bytes.NewReader(snappyLiteral(req)))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for invalid regexp, got %d", resp.StatusCode)
+	}
+}
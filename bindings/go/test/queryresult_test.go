@@ -0,0 +1,81 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"os"
+	"testing"
+)
+
+func TestQueryWithResult(t *testing.T) {
+	testDir := "../../../b_go_test_data_queryresult"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	for i := 1; i <= 100; i++ {
+		if err := db.AppendValues(int64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	data, result, err := db.QueryWithResult(10, 20, nil)
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if len(data) != 10*db.RecordSize() {
+		t.Errorf("Expected 10 records, got %d bytes", len(data))
+	}
+	if result.RowsReturned != 10 || result.RowsScanned != 10 || result.BytesRead != int64(len(data)) || result.Duration <= 0 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	data, result, err = db.QueryWithResult(1000, 2000, nil)
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if len(data) != 0 || result.RowsReturned != 0 || result.BytesRead != 0 {
+		t.Errorf("Expected an empty result, got %d bytes and %+v", len(data), result)
+	}
+	if _, _, err := db.QueryWithResult(0, 10, map[string]interface{}{"missing": 1}); err == nil {
+		t.Errorf("Expected an error for an unknown field")
+	}
+	db.Drop()
+
+	// Segments and zones report what they skipped
+	options := hocdb.Options{
+		ZoneMaps:    true,
+		Compression: &hocdb.Compression{Codec: "deflate", SegmentRecords: 5000},
+	}
+	db, err = hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Drop()
+	for i := 1; i <= 20000; i++ {
+		if err := db.AppendValues(int64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	// Segments hold 1 to 15000, the data file 15001 to 20000 in two blocks
+	data, result, err = db.QueryWithResult(0, 30000, map[string]interface{}{"price": 7500.0})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if len(data) != db.RecordSize() || result.RowsReturned != 1 || result.RowsScanned != 5000 {
+		t.Errorf("Expected 1 of the 5000 records of one segment, got %d bytes and %+v", len(data), result)
+	}
+	if result.BlocksScanned != 1 || result.BlocksPruned != 4 || result.SegmentsPruned != 2 {
+		t.Errorf("Expected 1 segment read, 2 segments and 2 blocks skipped, got %+v", result)
+	}
+	if result.BytesRead <= 0 || result.BytesRead >= int64(5000*db.RecordSize()) {
+		t.Errorf("Expected the compressed bytes of one segment read, got %d", result.BytesRead)
+	}
+}
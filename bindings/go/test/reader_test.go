@@ -0,0 +1,134 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"errors"
+	"hocdb"
+	"hocdb/hocdbtest"
+	"hocdb/reader"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	testDir := "../../../b_go_test_data_reader"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	for _, encoding := range []string{"", hocdb.EncodingGorilla} {
+		ticker := "BTC_USD" + encoding
+		schema := []hocdb.Field{
+			{Name: "timestamp", Type: hocdb.TypeI64},
+			{Name: "price", Type: hocdb.TypeF64},
+			{Name: "side", Type: hocdb.StringType(4)},
+			{Name: "amount", Type: hocdb.DecimalType(2)},
+			// Gorilla columns don't include the null bitmap
+			{Name: "fee", Type: hocdb.TypeF64, Nullable: encoding == ""},
+		}
+		options := hocdb.Options{Compression: &hocdb.Compression{Codec: "deflate", Encoding: encoding, SegmentRecords: 100}}
+		db, err := hocdb.New(ticker, testDir, schema, options)
+		if err != nil {
+			t.Fatalf("Failed to create DB: %v", err)
+		}
+		for i := 1; i <= 350; i++ {
+			var fee interface{} = float64(i) / 100
+			if i%10 == 0 && encoding == "" {
+				fee = nil
+			}
+			if err := db.AppendValues(int64(i), float64(i), "buy", hocdb.Decimal{Unscaled: int64(i), Scale: 2}, fee); err != nil {
+				t.Fatalf("Failed to append: %v", err)
+			}
+		}
+		if err := db.Compact(); err != nil {
+			t.Fatalf("Failed to compact: %v", err)
+		}
+
+		r, err := reader.Open(testDir, ticker)
+		if err != nil {
+			t.Fatalf("Failed to open reader: %v", err)
+		}
+		if r.Schema().RecordSize() != db.RecordSize() {
+			t.Fatalf("Expected record size %d, got %d", db.RecordSize(), r.Schema().RecordSize())
+		}
+		// Ranges within and across segments and the data file
+		for _, q := range [][2]int64{{math.MinInt64, math.MaxInt64}, {150, 260}, {20, 80}, {300, 400}, {500, 600}} {
+			want, err := db.Query(q[0], q[1], nil)
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			got, err := r.Query(q[0], q[1])
+			if err != nil {
+				t.Fatalf("Failed to query reader: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%q: Query(%d, %d) returned %d bytes, expected %d", encoding, q[0], q[1], len(got), len(want))
+			}
+		}
+
+		data, _ := r.Query(30, 31)
+		values, err := r.Schema().Decode(data)
+		if err != nil {
+			t.Fatalf("Failed to decode: %v", err)
+		}
+		if values[0] != int64(30) || values[1] != 30.0 || values[2] != "buy" || (encoding == "" && values[4] != nil) {
+			t.Errorf("Unexpected record %v", values)
+		}
+		if d, ok := values[3].(reader.Decimal); !ok || d.String() != "0.30" {
+			t.Errorf("Expected amount 0.30, got %v", values[3])
+		}
+		db.Close()
+	}
+
+	// Scan stops at the error of its callback
+	r, err := reader.OpenSchema(testDir, "BTC_USD", "timestamp:i64,price:f64,side:string(4),amount:decimal(2),fee:f64?")
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	stop := errors.New("stop")
+	n := 0
+	err = r.Scan(0, 1000, func(rec []byte) error {
+		if n++; n == 5 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 5 {
+		t.Errorf("Expected Scan to stop after 5 records, got %d: %v", n, err)
+	}
+	if _, err := reader.Open(testDir, "MISSING"); err == nil {
+		t.Errorf("Expected an error for a missing database")
+	}
+}
+
+func TestReaderRing(t *testing.T) {
+	testDir := "../../../b_go_test_data_reader_ring"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, hocdb.Options{MaxFileSize: 12 + 10*24, OverwriteFull: true})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+	r, err := reader.Open(testDir, hocdbtest.Ticker)
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	for i := 1; i <= 25; i++ {
+		if err := db.AppendValues(int64(i), float64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatalf("Failed to flush: %v", err)
+		}
+		want, _ := db.Load()
+		got, err := r.Load()
+		if err != nil {
+			t.Fatalf("Failed to load: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("After %d appends, Load returned %d bytes, expected %d", i, len(got), len(want))
+		}
+	}
+}
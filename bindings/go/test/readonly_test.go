@@ -0,0 +1,130 @@
+package hocdb_test
+
+import (
+	"context"
+	"errors"
+	"hocdb"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestOpenReadOnly(t *testing.T) {
+	testDir := "../../../b_go_test_data_read_only"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "side", Type: hocdb.TypeString},
+	}
+
+	if _, err := hocdb.OpenReadOnly("BTC_USD", testDir, schema); err == nil {
+		t.Fatalf("Expected opening a missing database to fail")
+	}
+
+	writer, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer writer.Close()
+	for i := 1; i <= 3; i++ {
+		if err := writer.AppendValues(int64(i), float64(i)*10, "buy"); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	writer.Flush()
+
+	// The writer keeps the database open
+	reader, err := hocdb.OpenReadOnly("BTC_USD", testDir, schema)
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	defer reader.Close()
+
+	record, _ := hocdb.CreateRecordBytes(schema, int64(10), 1.0, "sell")
+	if err := reader.Append(record); !errors.Is(err, hocdb.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from Append, got %v", err)
+	}
+	if err := reader.AppendAsync(record); !errors.Is(err, hocdb.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from AppendAsync, got %v", err)
+	}
+
+	want, _ := writer.Query(2, 10, map[string]interface{}{"side": "buy"})
+	got, err := reader.Query(2, 10, map[string]interface{}{"side": "buy"})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if string(got) != string(want) || len(got) != 2*hocdb.RecordSize(schema) {
+		t.Errorf("Read-only query returned %d bytes, expected the writer's %d", len(got), len(want))
+	}
+
+	stats, err := reader.GetStatsByName(0, 10, "price")
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Count != 3 || stats.Min != 10 || stats.Max != 30 || stats.Mean != 20 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// Records the writer flushes later show up
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	records, err := reader.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	writer.AppendValues(int64(4), 40.0, "sell")
+	writer.Flush()
+
+	latest, err := reader.GetLatestByName("price")
+	if err != nil || latest.Timestamp != 4 || latest.Value != 40 {
+		t.Errorf("Unexpected latest value: %+v, %v", latest, err)
+	}
+	select {
+	case rec := <-records:
+		if rec.Timestamp() != 4 {
+			t.Errorf("Expected the record at 4, got %d", rec.Timestamp())
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Timed out waiting for the subscription")
+	}
+}
+
+func TestOpenReadOnlyWrapped(t *testing.T) {
+	testDir := "../../../b_go_test_data_read_only_wrapped"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+	}
+	writer, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{MaxFileSize: 12 + 3*8, OverwriteFull: true})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer writer.Close()
+	for i := 1; i <= 5; i++ {
+		writer.AppendValues(int64(i))
+	}
+	writer.Flush()
+
+	reader, err := hocdb.OpenReadOnly("BTC_USD", testDir, schema)
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	defer reader.Close()
+
+	data, err := reader.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	records, _ := hocdb.DecodeRecords(schema, data)
+	if len(records) != 3 || records[0].Timestamp() != 3 || records[2].Timestamp() != 5 {
+		t.Errorf("Expected records 3 to 5 in order, got %v", records)
+	}
+	if latest, err := reader.GetLatest(0); err != nil || latest.Timestamp != 5 {
+		t.Errorf("Expected the latest record at 5, got %+v, %v", latest, err)
+	}
+}
@@ -0,0 +1,70 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"errors"
+	"hocdb"
+	"hocdb/hocdbtest"
+	"io"
+	"math"
+	"os"
+	"testing"
+	"testing/iotest"
+)
+
+func TestRecordReaderWriter(t *testing.T) {
+	testDir := "../../../b_go_test_data_recordio"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, hocdb.Options{MaxResultMemory: 10 * 24})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	var want []byte
+	for i := 1; i <= 100; i++ {
+		record, _ := hocdb.CreateRecordBytes(hocdbtest.TickSchema, int64(i), float64(i), 1.0)
+		want = append(want, record...)
+	}
+
+	// Records split across writes of a byte at a time are appended whole
+	w := db.NewRecordWriter()
+	if n, err := io.Copy(w, iotest.OneByteReader(bytes.NewReader(want))); err != nil || n != int64(len(want)) {
+		t.Fatalf("Failed to copy the records: %d, %v", n, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close the writer: %v", err)
+	}
+	w = db.NewRecordWriter()
+	next, _ := hocdb.CreateRecordBytes(hocdbtest.TickSchema, int64(101), 101.0, 1.0)
+	if _, err := w.Write(next[:10]); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := w.Close(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected a partial record to fail, got %v", err)
+	}
+	if _, err := db.NewRecordWriter().Write(want[:24]); !errors.Is(err, hocdb.ErrTimestampNotMonotonic) {
+		t.Errorf("Expected an out of order record to fail, got %v", err)
+	}
+
+	// The reader returns the records in chunks of 10
+	r := db.NewRecordReader(math.MinInt64, math.MaxInt64)
+	if err := iotest.TestReader(r, want); err != nil {
+		t.Errorf("Unexpected reader behavior: %v", err)
+	}
+	got, err := io.ReadAll(db.NewRecordReader(20, 60))
+	if err != nil || !bytes.Equal(got, want[19*24:59*24]) {
+		t.Errorf("Expected records 20 to 59, got %d bytes, %v", len(got), err)
+	}
+	r = db.NewRecordReader(math.MinInt64, math.MaxInt64)
+	buf := make([]byte, 5)
+	if n, err := r.Read(buf); err != nil || n != 5 {
+		t.Errorf("Expected 5 bytes, got %d, %v", n, err)
+	}
+	r.Close()
+	if _, err := r.Read(buf); err == nil {
+		t.Errorf("Expected reading a closed reader to fail")
+	}
+}
@@ -0,0 +1,166 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hocdb"
+	"hocdb/hocdbtest"
+	"hocdb/replication"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// eventually fails the test unless cond holds within a few seconds
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReplication(t *testing.T) {
+	primaryDir := "../../../b_go_test_data_replication_primary"
+	replicaDir := "../../../b_go_test_data_replication_replica"
+	os.RemoveAll(primaryDir)
+	os.RemoveAll(replicaDir)
+	defer os.RemoveAll(primaryDir)
+	defer os.RemoveAll(replicaDir)
+
+	db, err := hocdb.New(hocdbtest.Ticker, primaryDir, hocdbtest.TickSchema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+	appendRange := func(from, to int64) {
+		for i := from; i <= to; i++ {
+			if err := db.AppendValues(i, float64(i), 1.0); err != nil {
+				t.Fatalf("Failed to append: %v", err)
+			}
+		}
+	}
+	appendRange(1, 50)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := l.Addr().String()
+	primary := replication.NewPrimary()
+	primary.Add(hocdbtest.Ticker, db)
+	go primary.Serve(l)
+
+	replicaDB, err := hocdb.New(hocdbtest.Ticker, replicaDir, hocdbtest.TickSchema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create replica DB: %v", err)
+	}
+	defer replicaDB.Close()
+	replica := replication.NewReplica(addr, hocdbtest.Ticker, replicaDB)
+	replica.Timeout = 300 * time.Millisecond
+	replica.RetryInterval = 20 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- replica.Run(ctx) }()
+
+	// The replica catches up, then follows appends
+	eventually(t, "the catch-up", func() bool { return replica.Status().Latest == 50 })
+	appendRange(51, 100)
+	eventually(t, "the live records", func() bool { return replica.Status().Latest == 100 })
+	eventually(t, "the acknowledgement", func() bool {
+		infos := primary.Replicas()
+		return len(infos) == 1 && infos[0].Acked == 100 && infos[0].Sent == 100
+	})
+
+	// Records appended while the primary is away arrive once it's back
+	primary.Close()
+	eventually(t, "the disconnect", func() bool { return !replica.Status().Connected })
+	appendRange(101, 120)
+	if l, err = net.Listen("tcp", addr); err != nil {
+		t.Fatalf("Failed to listen again: %v", err)
+	}
+	primary = replication.NewPrimary()
+	primary.Add(hocdbtest.Ticker, db)
+	go primary.Serve(l)
+	defer primary.Close()
+	eventually(t, "the reconnect", func() bool { return replica.Status().Latest == 120 })
+
+	want, _ := db.Load()
+	got, err := replicaDB.Load()
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Expected the replica to hold the primary's %d records, got %d, %v", len(want)/24, len(got)/24, err)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Run to return when canceled, got %v", err)
+	}
+
+	// Replicas with another schema are refused for good
+	otherDir := "../../../b_go_test_data_replication_other"
+	os.RemoveAll(otherDir)
+	defer os.RemoveAll(otherDir)
+	other, err := hocdb.New(hocdbtest.Ticker, otherDir, []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}}, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer other.Close()
+	var rejected *replication.RejectedError
+	if err := replication.NewReplica(addr, hocdbtest.Ticker, other).Run(context.Background()); !errors.As(err, &rejected) {
+		t.Errorf("Expected a RejectedError, got %v", err)
+	}
+}
+
+func TestReplicationRotate(t *testing.T) {
+	primaryDir := "../../../b_go_test_data_replication_ring"
+	replicaDir := "../../../b_go_test_data_replication_ring_replica"
+	os.RemoveAll(primaryDir)
+	os.RemoveAll(replicaDir)
+	defer os.RemoveAll(primaryDir)
+	defer os.RemoveAll(replicaDir)
+
+	// Room for four records
+	options := hocdb.Options{MaxFileSize: 12 + 4*24, OverwriteFull: true}
+	db, err := hocdb.New(hocdbtest.Ticker, primaryDir, hocdbtest.TickSchema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	primary := replication.NewPrimary()
+	primary.Add(hocdbtest.Ticker, db)
+	go primary.Serve(l)
+	defer primary.Close()
+
+	replicaDB, err := hocdb.New(hocdbtest.Ticker, replicaDir, hocdbtest.TickSchema, options)
+	if err != nil {
+		t.Fatalf("Failed to create replica DB: %v", err)
+	}
+	defer replicaDB.Close()
+	replica := replication.NewReplica(l.Addr().String(), hocdbtest.Ticker, replicaDB)
+	var rotations atomic.Int32
+	replica.OnRotate = func() { rotations.Add(1) }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go replica.Run(ctx)
+	eventually(t, "the connection", func() bool { return len(primary.Replicas()) == 1 })
+
+	for i := int64(1); i <= 6; i++ {
+		if err := db.AppendValues(i, float64(i), 1.0); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	eventually(t, "the records", func() bool { return replica.Status().Latest == 6 })
+	eventually(t, "the rotation", func() bool { return rotations.Load() == 1 })
+	want, _ := db.Load()
+	if got, err := replicaDB.Load(); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Expected the replica to hold the primary's %d records, got %d, %v", len(want)/24, len(got)/24, err)
+	}
+}
@@ -0,0 +1,144 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"hocdb/hocdbtest"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestRingInfo(t *testing.T) {
+	testDir := "../../../b_go_test_data_ring_info"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, hocdb.Options{MaxFileSize: 12 + 10*24, OverwriteFull: true})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+	appendRange := func(from, to int) {
+		for i := from; i <= to; i++ {
+			if err := db.AppendValues(int64(i), float64(i), float64(i)); err != nil {
+				t.Fatalf("Failed to append: %v", err)
+			}
+		}
+	}
+
+	appendRange(1, 7)
+	var evicted []int64
+	db.OnEvict(func(rec hocdb.Record) { evicted = append(evicted, rec.Timestamp()) })
+	info, err := db.RingInfo()
+	if err != nil {
+		t.Fatalf("Failed to get ring info: %v", err)
+	}
+	if *info != (hocdb.RingInfo{Capacity: 10, Records: 7, Head: 7, Tail: 0, Oldest: 1, Newest: 7}) {
+		t.Errorf("Unexpected ring info %+v", info)
+	}
+
+	// Filling the ring evicts nothing, the 15 appends after evict 1 to 15
+	appendRange(8, 25)
+	if len(evicted) != 15 || evicted[0] != 1 || evicted[14] != 15 {
+		t.Errorf("Expected records 1 to 15 evicted, got %v", evicted)
+	}
+	if info, err = db.RingInfo(); err != nil {
+		t.Fatalf("Failed to get ring info: %v", err)
+	}
+	if *info != (hocdb.RingInfo{Capacity: 10, Records: 10, Head: 5, Tail: 5, Oldest: 16, Newest: 25}) {
+		t.Errorf("Unexpected ring info %+v", info)
+	}
+
+	linear, err := hocdb.New(hocdbtest.Ticker, testDir+"_linear", hocdbtest.TickSchema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer os.RemoveAll(testDir + "_linear")
+	defer linear.Close()
+	if _, err := linear.RingInfo(); err == nil {
+		t.Errorf("Expected an error without OverwriteFull")
+	}
+}
+
+func TestOnEvictLargeRing(t *testing.T) {
+	testDir := "../../../b_go_test_data_ring_evict"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	// Larger than the engine's write buffer, so evicted records are read from disk
+	db, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, hocdb.Options{MaxFileSize: 12 + 300*24, OverwriteFull: true})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+	var evicted []hocdb.Record
+	db.OnEvict(func(rec hocdb.Record) { evicted = append(evicted, rec) })
+	for i := 1; i <= 1000; i++ {
+		if err := db.AppendValues(int64(i), float64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if len(evicted) != 700 {
+		t.Fatalf("Expected 700 evicted records, got %d", len(evicted))
+	}
+	for i, rec := range evicted {
+		if price, _ := rec.Get("price"); rec.Timestamp() != int64(i+1) || price != float64(i+1) {
+			t.Fatalf("Expected record %d evicted, got %v", i+1, rec.Values)
+		}
+	}
+}
+
+func TestOnEvictGroupCommit(t *testing.T) {
+	testDir := "../../../b_go_test_data_ring_evict_group"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "writer", Type: hocdb.TypeI64},
+	}
+	options := hocdb.Options{MaxFileSize: 12 + 10*16, OverwriteFull: true, AutoIncrement: &hocdb.AutoIncrement{}, SyncMode: hocdb.SyncFsync}
+	db, err := hocdb.New("GROUP", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+	var mu sync.Mutex
+	var evicted []int64
+	db.OnEvict(func(rec hocdb.Record) {
+		mu.Lock()
+		evicted = append(evicted, rec.Timestamp())
+		mu.Unlock()
+	})
+
+	const writers, perWriter = 8, 50
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				record, _ := hocdb.CreateRecordBytes(schema, int64(0), int64(w))
+				if err := db.Append(record); err != nil {
+					t.Errorf("Failed to append: %v", err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// Every record but the last 10 is evicted once, whatever the groups were
+	mu.Lock()
+	defer mu.Unlock()
+	if len(evicted) != writers*perWriter-10 {
+		t.Fatalf("Expected %d evicted records, got %d", writers*perWriter-10, len(evicted))
+	}
+	seen := make(map[int64]bool)
+	for _, ts := range evicted {
+		if ts < 1 || ts > writers*perWriter-10 || seen[ts] {
+			t.Fatalf("Unexpected evicted record %d", ts)
+		}
+		seen[ts] = true
+	}
+}
@@ -0,0 +1,41 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"os"
+	"testing"
+)
+
+func TestSchemaIntrospection(t *testing.T) {
+	testDir := "../../../b_go_test_data_schema_introspection"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "side", Type: hocdb.TypeString},
+		{Name: "taker", Type: hocdb.TypeBool},
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	if size := db.RecordSize(); size != 8+128+1 {
+		t.Errorf("Expected a record size of 137, got %d", size)
+	}
+	if idx, ok := db.FieldIndex("taker"); !ok || idx != 2 {
+		t.Errorf("Expected field taker at 2, got %d, %v", idx, ok)
+	}
+	if _, ok := db.FieldIndex("price"); ok {
+		t.Errorf("Expected no field price")
+	}
+
+	// Schema returns a copy
+	got := db.Schema()
+	got[0].Name = "changed"
+	if db.Schema()[0].Name != "timestamp" {
+		t.Errorf("Modifying the returned schema changed the database's")
+	}
+}
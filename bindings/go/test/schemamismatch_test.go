@@ -0,0 +1,61 @@
+package hocdb_test
+
+import (
+	"errors"
+	"hocdb"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSchemaMismatch(t *testing.T) {
+	testDir := "../../../b_go_test_data_schema_mismatch"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "side", Type: hocdb.TypeString},
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	db.AppendValues(int64(1), 100.0, "buy")
+	db.Close()
+
+	other := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeI64},
+		{Name: "volume", Type: hocdb.TypeString},
+		{Name: "taker", Type: hocdb.TypeBool},
+	}
+	_, err = hocdb.New("BTC_USD", testDir, other, hocdb.Options{})
+	if !errors.Is(err, hocdb.ErrSchemaMismatch) {
+		t.Fatalf("Expected ErrSchemaMismatch, got %v", err)
+	}
+	var mismatch *hocdb.SchemaMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected a *SchemaMismatchError, got %T", err)
+	}
+	if len(mismatch.Diffs) != 3 {
+		t.Errorf("Expected 3 differences, got %v", mismatch.Diffs)
+	}
+	for _, want := range []string{"price is f64, not i64", "side:string, not volume:string", "taker:bool is not in the stored schema"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in %q", want, err.Error())
+		}
+	}
+
+	if _, err := hocdb.OpenReadOnly("BTC_USD", testDir, other); !errors.Is(err, hocdb.ErrSchemaMismatch) {
+		t.Errorf("Expected ErrSchemaMismatch from OpenReadOnly, got %v", err)
+	}
+
+	// The matching schema still opens the database
+	db, err = hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	db.Close()
+}
@@ -0,0 +1,63 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"hocdb/hocdbtest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestOnSegment(t *testing.T) {
+	testDir := "../../../b_go_test_data_segments"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	options := hocdb.Options{Compression: &hocdb.Compression{Codec: "deflate", SegmentRecords: 100}}
+	db, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+	var completed []hocdb.SegmentInfo
+	db.OnSegment(func(s hocdb.SegmentInfo) { completed = append(completed, s) })
+
+	for i := 1; i <= 350; i++ {
+		if err := db.AppendValues(int64(i), float64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+
+	// The data file keeps the last 150 records
+	if len(completed) != 2 {
+		t.Fatalf("Expected 2 segments, got %d", len(completed))
+	}
+	for i, s := range completed {
+		if s.Records != 100 || s.First != int64(i*100+1) || s.Last != int64(i*100+100) || s.Codec != "deflate" {
+			t.Errorf("Unexpected segment %+v", s)
+		}
+		info, err := os.Stat(s.Path)
+		if err != nil || info.Size() != s.Size {
+			t.Errorf("Expected %s of %d bytes, got %v", s.Path, s.Size, err)
+		}
+	}
+
+	segments, err := db.Segments()
+	if err != nil {
+		t.Fatalf("Failed to list segments: %v", err)
+	}
+	if !reflect.DeepEqual(segments, completed) {
+		t.Errorf("Expected Segments to list %v, got %v", completed, segments)
+	}
+
+	// Nothing to compact runs no callbacks
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if len(completed) != 2 {
+		t.Errorf("Expected no new segments, got %d", len(completed)-2)
+	}
+}
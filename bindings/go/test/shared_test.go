@@ -0,0 +1,125 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hocdb"
+	"hocdb/hocdbtest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitFor waits for changes with a timeout
+func waitFor(db *hocdb.DB, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return db.Wait(ctx)
+}
+
+func TestSharedRead(t *testing.T) {
+	testDir := "../../../b_go_test_data_shared"
+	if dir := os.Getenv("HOCDB_SHARED_TEST_DIR"); dir != "" {
+		// A reader in another process, see below, following the writer to 5 records
+		reader, err := hocdb.OpenReadOnly(hocdbtest.Ticker, dir, hocdbtest.TickSchema)
+		if err != nil {
+			t.Fatalf("Failed to open read-only: %v", err)
+		}
+		defer reader.Close()
+		for {
+			data, err := reader.Load()
+			if err != nil {
+				t.Fatalf("Failed to load: %v", err)
+			}
+			if len(data) == 5*24 {
+				return
+			}
+			if err := waitFor(reader, 10*time.Second); err != nil {
+				t.Fatalf("Failed to wait for %d records after %d: %v", 5, len(data)/24, err)
+			}
+		}
+	}
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, hocdb.Options{NotifyReaders: true})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer func() { db.Close() }()
+	if err := db.AppendValues(int64(1), 1.0, 1.0); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	db.Flush()
+	if _, err := os.Stat(filepath.Join(testDir, "."+hocdbtest.Ticker+".head")); err != nil {
+		t.Errorf("Expected a head file: %v", err)
+	}
+
+	reader, err := hocdb.OpenReadOnly(hocdbtest.Ticker, testDir, hocdbtest.TickSchema)
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	defer reader.Close()
+	if err := waitFor(db, time.Second); err == nil {
+		t.Errorf("Expected Wait to fail on a writable handle")
+	}
+	if err := waitFor(reader, 100*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Wait to time out without changes, got %v", err)
+	}
+
+	// Another process follows the records as they're flushed
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSharedRead$")
+	cmd.Env = append(os.Environ(), "HOCDB_SHARED_TEST_DIR="+testDir)
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start reader process: %v", err)
+	}
+	for i := int64(2); i <= 5; i++ {
+		time.Sleep(20 * time.Millisecond)
+		if err := db.AppendValues(i, 1.0, 1.0); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+		db.Flush()
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Errorf("Reader process failed: %v\n%s", err, out.String())
+	}
+
+	// Changes the handle hasn't read return right away, once
+	if err := waitFor(reader, time.Second); err != nil {
+		t.Errorf("Expected Wait to return for the flushed records, got %v", err)
+	}
+	if err := waitFor(reader, 100*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Wait to time out after returning, got %v", err)
+	}
+	if data, err := reader.Load(); err != nil || len(data) != 5*24 {
+		t.Errorf("Expected 5 records, got %d bytes, %v", len(data), err)
+	}
+
+	// Without NotifyReaders the head file goes and readers watch the data file
+	db.Close()
+	if db, err = hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, hocdb.Options{}); err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(testDir, "."+hocdbtest.Ticker+".head")); !os.IsNotExist(err) {
+		t.Errorf("Expected the head file to be removed, got %v", err)
+	}
+	reader.Load()
+	if err := waitFor(reader, 100*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Wait to time out without changes, got %v", err)
+	}
+	if err := db.AppendValues(int64(6), 1.0, 1.0); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	db.Flush()
+	if err := waitFor(reader, time.Second); err != nil {
+		t.Errorf("Expected Wait to return for the flushed record, got %v", err)
+	}
+	if data, err := reader.Load(); err != nil || len(data) != 6*24 {
+		t.Errorf("Expected 6 records, got %d bytes, %v", len(data), err)
+	}
+}
@@ -0,0 +1,98 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSlowQuery(t *testing.T) {
+	testDir := "../../../b_go_test_data_slow_query"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "side", Type: hocdb.TypeI64},
+	}
+	var buf bytes.Buffer
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{
+		Logger:             slog.New(slog.NewJSONHandler(&buf, nil)),
+		SlowQueryThreshold: time.Nanosecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	for i := 1; i <= 4; i++ {
+		if err := db.AppendValues(int64(i), int64(i%2)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	logEntries(t, &buf)
+
+	var slow []hocdb.SlowQuery
+	db.OnSlowQuery(func(q hocdb.SlowQuery) {
+		// Callbacks run outside the lock and may use the database
+		if _, err := db.GetLatest(0); err != nil {
+			t.Errorf("Failed to get latest from the callback: %v", err)
+		}
+		slow = append(slow, q)
+	})
+
+	filters := map[string]interface{}{"side": int64(1)}
+	if _, err := db.Query(1, 4, filters); err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if _, err := db.GetStats(1, 4, 1); err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+
+	if len(slow) != 2 {
+		t.Fatalf("Expected 2 slow queries, got %d", len(slow))
+	}
+	q := slow[0]
+	if q.Op != "Query" || q.Start != 1 || q.End != 4 || q.RowsReturned != 2 || q.Duration <= 0 {
+		t.Errorf("Unexpected slow query: %+v", q)
+	}
+	if f, ok := q.Filters.(map[string]interface{}); !ok || f["side"] != int64(1) {
+		t.Errorf("Expected the filters of the query, got %v", q.Filters)
+	}
+	if q := slow[1]; q.Op != "GetStats" || q.RowsScanned != 3 || q.RowsReturned != 0 {
+		t.Errorf("Unexpected slow stats: %+v", q)
+	}
+
+	entries := logEntries(t, &buf)
+	if len(entries) != 2 || entries[0]["msg"] != "slow query" || entries[0]["op"] != "Query" || entries[0]["rows_returned"] != 2.0 {
+		t.Errorf("Unexpected log entries: %v", entries)
+	}
+}
+
+func TestSlowQueryDisabled(t *testing.T) {
+	testDir := "../../../b_go_test_data_slow_query_disabled"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{SlowQueryThreshold: -1})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	called := false
+	db.OnSlowQuery(func(hocdb.SlowQuery) { called = true })
+	db.AppendValues(int64(1))
+	if _, err := db.Load(); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if called {
+		t.Errorf("Expected no slow queries with a negative threshold")
+	}
+}
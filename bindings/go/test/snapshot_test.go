@@ -0,0 +1,217 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hocdb"
+	"hocdb/hocdbtest"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueryFuncSnapshot(t *testing.T) {
+	testDir := "../../../b_go_test_data_snapshot"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	options := hocdb.Options{TimestampPrecision: time.Second, PartitionBy: hocdb.PartitionDay, MaxResultMemory: 24 * 10}
+	db, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	// Hourly records over three days, two of them in partitions
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 72; i++ {
+		if err := db.AppendValues(start.Add(time.Duration(i)*time.Hour), float64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	segments, err := db.Segments()
+	if err != nil || len(segments) != 2 {
+		t.Fatalf("Expected 2 partitions, got %d, %v", len(segments), err)
+	}
+	var want []byte
+	err = db.QueryFunc(math.MinInt64, math.MaxInt64, nil, func(data []byte) error {
+		want = append(want, data...)
+		return nil
+	})
+	if err != nil || len(want) != 72*24 {
+		t.Fatalf("Expected 72 records, got %d bytes, %v", len(want), err)
+	}
+
+	// Appends, compactions and dropped partitions between chunks don't change the
+	// result, and the dropped files stay until it's done
+	var got []byte
+	chunks := 0
+	err = db.QueryFunc(math.MinInt64, math.MaxInt64, nil, func(data []byte) error {
+		got = append(got, data...)
+		if chunks++; chunks != 1 {
+			return nil
+		}
+		for i := 72; i < 96; i++ {
+			if err := db.AppendValues(start.Add(time.Duration(i)*time.Hour), float64(i), float64(i)); err != nil {
+				return err
+			}
+		}
+		if err := db.DropPartition(start); err != nil {
+			return err
+		}
+		if err := db.Compact(); err != nil {
+			return err
+		}
+		if _, err := os.Stat(segments[0].Path); err != nil {
+			t.Errorf("Expected %s to stay while the query runs: %v", segments[0].Path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to query in chunks: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Expected the %d records when the query started, got %d", len(want)/24, len(got)/24)
+	}
+	if _, err := os.Stat(segments[0].Path); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be deleted once the query returned", segments[0].Path)
+	}
+	n := 0
+	err = db.QueryFunc(math.MinInt64, math.MaxInt64, nil, func(data []byte) error {
+		n += len(data) / 24
+		return nil
+	})
+	if err != nil || n != 72 {
+		t.Errorf("Expected 72 records after dropping a day and adding one, got %d, %v", n, err)
+	}
+}
+
+func TestPoolRingSnapshot(t *testing.T) {
+	testDir := "../../../b_go_test_data_pool_ring_snapshot"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "value", Type: hocdb.TypeI64},
+	}
+	pool, err := hocdb.NewPool("RING", testDir, schema, hocdb.Options{MaxFileSize: 12 + 64*16, OverwriteFull: true}, 2)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+	defer pool.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := int64(1); i <= 5000; i++ {
+			record, _ := hocdb.CreateRecordBytes(schema, i, -i)
+			if err := pool.Append(record); err != nil {
+				t.Errorf("Failed to append: %v", err)
+				return
+			}
+		}
+	}()
+
+	// Queries racing the writer around the ring only return whole records, in order
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		data, err := pool.Load()
+		if err != nil {
+			t.Fatalf("Failed to load: %v", err)
+		}
+		records, _ := hocdb.DecodeRecords(schema, data)
+		for i, rec := range records {
+			if rec.Values[1] != -rec.Timestamp() || (i > 0 && rec.Timestamp() != records[i-1].Timestamp()+1) {
+				t.Fatalf("Unexpected record %v after %v", rec.Values, records[max(i-1, 0)].Values)
+			}
+		}
+	}
+}
+
+// halfWrite writes the timestamp of a record into a slot of a wrapped ring buffer,
+// as a writer overwriting it does first, and returns a function writing the rest
+func halfWrite(t *testing.T, file string, offset int64, ts, value int64) func() {
+	f, err := os.OpenFile(file, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open data file: %v", err)
+	}
+	defer f.Close()
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(ts))
+	if _, err := f.WriteAt(buf[:], offset); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+	return func() {
+		f, err := os.OpenFile(file, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatalf("Failed to open data file: %v", err)
+		}
+		defer f.Close()
+		binary.LittleEndian.PutUint64(buf[:], uint64(value))
+		if _, err := f.WriteAt(buf[:], offset+8); err != nil {
+			t.Fatalf("Failed to write data file: %v", err)
+		}
+	}
+}
+
+func TestSubscribeHalfWritten(t *testing.T) {
+	testDir := "../../../b_go_test_data_torn_ring"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "value", Type: hocdb.TypeI64},
+	}
+	// Room for four records, of which 3 to 6 survive: the oldest is in the third slot
+	writer, err := hocdb.New("RING", testDir, schema, hocdb.Options{MaxFileSize: 12 + 4*16, OverwriteFull: true})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer writer.Close()
+	for i := int64(1); i <= 6; i++ {
+		record, _ := hocdb.CreateRecordBytes(schema, i, i)
+		if err := writer.Append(record); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	writer.Flush()
+
+	reader, err := hocdb.OpenReadOnly("RING", testDir, schema)
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	defer reader.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	records, err := reader.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	// Record 7 half-written over record 3 by another process, while the poll 100ms
+	// after subscribing reads it, is only delivered once complete
+	time.Sleep(70 * time.Millisecond)
+	finish := halfWrite(t, filepath.Join(testDir, "RING.bin"), 12+2*16, 7, 7)
+	time.Sleep(40 * time.Millisecond)
+	finish()
+	select {
+	case rec := <-records:
+		if rec.Timestamp() != 7 || rec.Values[1] != int64(7) {
+			t.Errorf("Expected record 7, got %v", rec.Values)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for record 7")
+	}
+}
@@ -0,0 +1,124 @@
+package hocdb_test
+
+import (
+	"database/sql"
+	"hocdb"
+	_ "hocdb/sqldriver"
+	"os"
+	"testing"
+)
+
+func TestSQLDriver(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "volume", Type: hocdb.TypeU64},
+		{Name: "side", Type: hocdb.TypeString},
+	}
+
+	testDir := "../../../b_go_test_data_sql"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	sides := []string{"buy", "sell", "buy", "sell", "buy"}
+	for i, side := range sides {
+		record, _ := hocdb.CreateRecordBytes(schema, int64(100*(i+1)), float64(10+i), uint64(i), side)
+		db.Append(record)
+	}
+	db.Close()
+
+	sqlDB, err := sql.Open("hocdb", testDir+"?BTC_USD=timestamp:i64,price:f64,volume:u64,side:string")
+	if err != nil {
+		t.Fatalf("Failed to open SQL DB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	rows, err := sqlDB.Query("SELECT timestamp, price FROM BTC_USD WHERE ts BETWEEN ? AND ? AND side = 'buy'", 100, 300)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	var got []int64
+	for rows.Next() {
+		var ts int64
+		var price float64
+		if err := rows.Scan(&ts, &price); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		if price != float64(10+ts/100-1) {
+			t.Errorf("Unexpected price %v at %d", price, ts)
+		}
+		got = append(got, ts)
+	}
+	rows.Close()
+	if len(got) != 2 || got[0] != 100 || got[1] != 300 {
+		t.Errorf("Expected timestamps [100 300], got %v", got)
+	}
+
+	// Comparisons evaluated while scanning, plus LIMIT
+	var count int
+	rows, err = sqlDB.Query("select * from \"BTC_USD\" where price >= 11.5 and volume <> ? limit 5;", 3)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	columns, _ := rows.Columns()
+	if len(columns) != 4 || columns[3] != "side" {
+		t.Errorf("Unexpected columns %v", columns)
+	}
+	types, _ := rows.ColumnTypes()
+	if types[2].DatabaseTypeName() != "U64" {
+		t.Errorf("Expected U64, got %s", types[2].DatabaseTypeName())
+	}
+	for rows.Next() {
+		count++
+	}
+	rows.Close()
+	if count != 2 {
+		t.Errorf("Expected 2 rows, got %d", count)
+	}
+
+	var side string
+	if err := sqlDB.QueryRow("SELECT side FROM BTC_USD WHERE timestamp > 100 LIMIT 1").Scan(&side); err != nil {
+		t.Fatalf("QueryRow failed: %v", err)
+	}
+	if side != "sell" {
+		t.Errorf("Expected sell, got %s", side)
+	}
+
+	// Bounds past the ends of int64 match nothing rather than wrapping around
+	for _, query := range []string{
+		"SELECT * FROM BTC_USD WHERE timestamp > 9223372036854775807",
+		"SELECT * FROM BTC_USD WHERE timestamp < -9223372036854775808",
+	} {
+		rows, err := sqlDB.Query(query)
+		if err != nil {
+			t.Fatalf("Query %q failed: %v", query, err)
+		}
+		count = 0
+		for rows.Next() {
+			count++
+		}
+		rows.Close()
+		if count != 0 {
+			t.Errorf("Expected no rows for %q, got %d", query, count)
+		}
+	}
+
+	for _, query := range []string{
+		"DELETE FROM BTC_USD",
+		"SELECT missing FROM BTC_USD",
+		"SELECT * FROM UNKNOWN",
+		"SELECT * FROM BTC_USD WHERE price = 'x'",
+	} {
+		if rows, err := sqlDB.Query(query); err == nil {
+			rows.Close()
+			t.Errorf("Expected error for %q", query)
+		}
+	}
+	if _, err := sqlDB.Exec("SELECT * FROM BTC_USD"); err == nil {
+		t.Error("Expected Exec to fail")
+	}
+}
@@ -0,0 +1,187 @@
+package hocdb_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"hocdb"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sqlRecorder is a database/sql driver recording the statements it executes, with
+// TimescaleDB installed when timescale is set
+type sqlRecorder struct {
+	mu        sync.Mutex
+	timescale bool
+	execs     []string
+	args      [][]driver.Value
+	commits   int
+}
+
+func (d *sqlRecorder) Open(name string) (driver.Conn, error) { return &sqlRecorderConn{d}, nil }
+
+func (d *sqlRecorder) reset(timescale bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.timescale, d.execs, d.args, d.commits = timescale, nil, nil, 0
+}
+
+type sqlRecorderConn struct{ d *sqlRecorder }
+
+func (c *sqlRecorderConn) Prepare(query string) (driver.Stmt, error) {
+	return &sqlRecorderStmt{c.d, query}, nil
+}
+func (c *sqlRecorderConn) Close() error              { return nil }
+func (c *sqlRecorderConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *sqlRecorderConn) Rollback() error           { return nil }
+func (c *sqlRecorderConn) Commit() error {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.commits++
+	return nil
+}
+
+// CheckNamedValue passes every value as is, as clickhouse-go does
+func (c *sqlRecorderConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+type sqlRecorderStmt struct {
+	d     *sqlRecorder
+	query string
+}
+
+func (s *sqlRecorderStmt) Close() error  { return nil }
+func (s *sqlRecorderStmt) NumInput() int { return -1 }
+func (s *sqlRecorderStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.execs = append(s.d.execs, s.query)
+	s.d.args = append(s.d.args, args)
+	return driver.RowsAffected(1), nil
+}
+func (s *sqlRecorderStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &sqlRecorderRows{value: s.d.timescale}, nil
+}
+
+type sqlRecorderRows struct {
+	value bool
+	done  bool
+}
+
+func (r *sqlRecorderRows) Columns() []string { return []string{"exists"} }
+func (r *sqlRecorderRows) Close() error      { return nil }
+func (r *sqlRecorderRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
+
+var clickHouseRecorder, postgresRecorder = &sqlRecorder{}, &sqlRecorder{}
+
+func init() {
+	sql.Register("clickhouse", clickHouseRecorder)
+	sql.Register("postgres", postgresRecorder)
+}
+
+func TestExportSQL(t *testing.T) {
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.DecimalType(2)},
+		{Name: "volume", Type: hocdb.TypeU64},
+		{Name: "side", Type: hocdb.StringType(8)},
+		{Name: "note", Type: hocdb.TypeBytes, Nullable: true},
+	}
+
+	testDir := "../../../b_go_test_data_sqlexport"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	db, err := hocdb.New("SQL_EXPORT", testDir, schema, hocdb.Options{TimestampPrecision: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+	for i := int64(1); i <= 3; i++ {
+		var note interface{}
+		if i == 2 {
+			note = []byte("late")
+		}
+		if err := db.AppendValues(i*1000, "100.25", uint64(1)<<63+uint64(i), "buy", note); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+
+	ddl, err := hocdb.SQLTableDDL("clickhouse://localhost:9000/default", "analytics.trades", schema, time.Millisecond)
+	if err != nil {
+		t.Fatalf("Failed to generate DDL: %v", err)
+	}
+	for _, column := range []string{`"analytics"."trades"`, `"timestamp" DateTime64(3, 'UTC')`, `"price" Decimal(19, 2)`, `"volume" UInt64`, `"note" Nullable(String)`, `ORDER BY "timestamp"`} {
+		if !strings.Contains(ddl, column) {
+			t.Errorf("Expected %s in ClickHouse DDL, got %s", column, ddl)
+		}
+	}
+
+	if err := db.ExportSQL("clickhouse://localhost:9000/default", "trades", 0, 2500); err != nil {
+		t.Fatalf("ExportSQL to ClickHouse failed: %v", err)
+	}
+	if len(clickHouseRecorder.execs) != 3 || !strings.HasPrefix(clickHouseRecorder.execs[0], "CREATE TABLE IF NOT EXISTS") {
+		t.Fatalf("Expected the DDL and an insert per record, got %q", clickHouseRecorder.execs)
+	}
+	if want := `INSERT INTO "trades" ("timestamp", "price", "volume", "side", "note")`; clickHouseRecorder.execs[1] != want {
+		t.Errorf("Expected %s, got %s", want, clickHouseRecorder.execs[1])
+	}
+	want := []driver.Value{time.UnixMilli(2000).UTC(), "100.25", uint64(1)<<63 + 2, "buy", "late"}
+	if got := clickHouseRecorder.args[2]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if clickHouseRecorder.commits != 1 {
+		t.Errorf("Expected one batch, got %d", clickHouseRecorder.commits)
+	}
+
+	postgresRecorder.reset(true)
+	if err := db.ExportSQL("postgres://localhost/analytics", "trades", 0, 10000); err != nil {
+		t.Fatalf("ExportSQL to Postgres failed: %v", err)
+	}
+	execs := postgresRecorder.execs
+	if len(execs) != 3 {
+		t.Fatalf("Expected the DDL, the hypertable and one insert, got %q", execs)
+	}
+	for _, column := range []string{`"timestamp" TIMESTAMPTZ NOT NULL`, `"volume" NUMERIC(20) NOT NULL`, "\"note\" BYTEA\n)"} {
+		if !strings.Contains(execs[0], column) {
+			t.Errorf("Expected %s in Postgres DDL, got %s", column, execs[0])
+		}
+	}
+	if !strings.Contains(execs[1], "create_hypertable") {
+		t.Errorf("Expected a hypertable with TimescaleDB, got %s", execs[1])
+	}
+	if !strings.HasSuffix(execs[2], "($11, $12, $13, $14, $15)") {
+		t.Errorf("Expected three rows in the insert, got %s", execs[2])
+	}
+	args := postgresRecorder.args[2]
+	if len(args) != 15 || args[2] != "9223372036854775809" || args[4] != nil || !reflect.DeepEqual(args[9], []byte("late")) {
+		t.Errorf("Unexpected insert arguments %v", args)
+	}
+	if postgresRecorder.commits != 1 {
+		t.Errorf("Expected one transaction, got %d", postgresRecorder.commits)
+	}
+
+	// Without TimescaleDB the table stays a plain one
+	postgresRecorder.reset(false)
+	if err := db.ExportSQL("postgresql://localhost/analytics", "trades", 0, 1500); err != nil {
+		t.Fatalf("ExportSQL to Postgres failed: %v", err)
+	}
+	if len(postgresRecorder.execs) != 2 {
+		t.Errorf("Expected the DDL and one insert, got %q", postgresRecorder.execs)
+	}
+
+	if err := db.ExportSQL("mysql://localhost/analytics", "trades", 0, 10000); err == nil {
+		t.Errorf("Expected an unsupported DSN scheme to fail")
+	}
+}
@@ -0,0 +1,122 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"errors"
+	"hocdb"
+	"hocdb/store"
+	"os"
+	"testing"
+)
+
+func TestMemStore(t *testing.T) {
+	testDir := "../../../b_go_test_data_store"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	spec := "timestamp:i64,price:f64,side:string(4),qty:i32,fee:f64?"
+	schema, err := hocdb.ParseSchema(spec)
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	mem, err := store.NewMem(spec)
+	if err != nil {
+		t.Fatalf("Failed to create Mem: %v", err)
+	}
+	if mem.RecordSize() != db.RecordSize() {
+		t.Fatalf("Expected record size %d, got %d", db.RecordSize(), mem.RecordSize())
+	}
+	if _, err := store.NewMem("price:f64"); err == nil {
+		t.Errorf("Expected an error for a schema without timestamp")
+	}
+
+	// The same calls on both stores give the same results
+	stores := []hocdb.Store{db, mem}
+	for i := 1; i <= 100; i++ {
+		side := "buy"
+		if i%3 == 0 {
+			side = "sell"
+		}
+		var fee interface{}
+		if i%10 != 0 {
+			fee = float64(i) / 100
+		}
+		rec, err := hocdb.CreateRecordBytes(schema, int64(i), float64(i%7), side, int32(i), fee)
+		if err != nil {
+			t.Fatalf("Failed to create record: %v", err)
+		}
+		for _, s := range stores {
+			if err := s.Append(rec); err != nil {
+				t.Fatalf("Failed to append: %v", err)
+			}
+		}
+	}
+	for _, s := range stores {
+		rec, _ := hocdb.CreateRecordBytes(schema, int64(50), 1.0, "buy", int32(0), nil)
+		if err := s.Append(rec); !errors.Is(err, hocdb.ErrTimestampNotMonotonic) {
+			t.Errorf("Expected %T to reject an older timestamp, got %v", s, err)
+		}
+	}
+
+	queries := []interface{}{
+		nil,
+		map[string]interface{}{"side": "sell"},
+		map[string]interface{}{"price": 3.0, "side": "buy"},
+		map[string]interface{}{"fee": nil},
+		[]hocdb.Filter{{FieldIndex: 3, Value: int32(42)}},
+	}
+	for _, filters := range queries {
+		want, err := db.Query(10, 90, filters)
+		if err != nil {
+			t.Fatalf("Failed to query: %v", err)
+		}
+		got, err := mem.Query(10, 90, filters)
+		if err != nil {
+			t.Fatalf("Failed to query Mem: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("Query with %v returned %d bytes, expected %d", filters, len(got), len(want))
+		}
+	}
+	if _, err := mem.Query(0, 1, map[string]interface{}{"missing": 1}); err == nil {
+		t.Errorf("Expected an error for an unknown field")
+	}
+	want, _ := db.Load()
+	if got, err := mem.Load(); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Load returned %d bytes, expected %d: %v", len(got), len(want), err)
+	}
+	for _, field := range []int{1, 3, 4} {
+		want, err := db.GetStats(0, 50, field)
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		got, err := mem.GetStats(0, 50, field)
+		if err != nil || *got != *want {
+			t.Errorf("Stats of field %d are %+v, expected %+v: %v", field, got, want, err)
+		}
+	}
+	want2, err := db.GetLatest(1)
+	if err != nil {
+		t.Fatalf("Failed to get latest: %v", err)
+	}
+	if got, err := mem.GetLatest(1); err != nil || *got != *want2 {
+		t.Errorf("Latest is %+v, expected %+v: %v", got, want2, err)
+	}
+	// The last record has no fee
+	for _, s := range stores {
+		if _, err := s.GetLatest(4); !errors.Is(err, hocdb.ErrNull) {
+			t.Errorf("Expected %T to report a null fee, got %v", s, err)
+		}
+	}
+
+	for _, s := range stores {
+		s.Close()
+	}
+	if _, err := mem.Query(0, 100, nil); err == nil {
+		t.Errorf("Expected an error after Close")
+	}
+}
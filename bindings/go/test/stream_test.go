@@ -0,0 +1,121 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hocdb"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestMaxResultMemory(t *testing.T) {
+	testDir := "../../../b_go_test_data_stream"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	recordSize := int64(hocdb.RecordSize(schema))
+	bounded, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{
+		MaxResultMemory: 1000 * recordSize,
+		Compression:     &hocdb.Compression{Codec: "deflate", SegmentRecords: 5000},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer bounded.Drop()
+	plain, err := hocdb.New("ETH_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer plain.Close()
+	for i := 1; i <= 20000; i++ {
+		for _, db := range []*hocdb.DB{bounded, plain} {
+			if err := db.AppendValues(int64(i), float64(i%10)); err != nil {
+				t.Fatalf("Failed to append: %v", err)
+			}
+		}
+	}
+	if err := bounded.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+
+	var limitErr *hocdb.QueryLimitError
+	if _, err := bounded.Query(0, math.MaxInt64, nil); !errors.As(err, &limitErr) || limitErr.Limit != "MaxResultMemory" {
+		t.Errorf("Expected a MaxResultMemory error, got %v", err)
+	}
+	if _, err := bounded.Load(); !errors.Is(err, hocdb.ErrQueryLimit) {
+		t.Errorf("Expected Load to exceed MaxResultMemory, got %v", err)
+	}
+	data, err := bounded.Query(4500, 5500, nil)
+	if err != nil || len(data) != 1000*int(recordSize) {
+		t.Errorf("Expected a result of 1000 records within the bound, got %d bytes, %v", len(data), err)
+	}
+
+	// QueryFunc hands over the records in bounded chunks
+	for _, filters := range []map[string]interface{}{nil, {"price": 3.0}} {
+		want, err := plain.Query(0, math.MaxInt64, filters)
+		if err != nil {
+			t.Fatalf("Failed to query: %v", err)
+		}
+		var got []byte
+		chunks := 0
+		err = bounded.QueryFunc(0, math.MaxInt64, filters, func(data []byte) error {
+			if int64(len(data)) > 1000*recordSize || int64(len(data))%recordSize != 0 {
+				t.Errorf("Unexpected chunk of %d bytes", len(data))
+			}
+			got = append(got, data...)
+			chunks++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to query in chunks: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("Expected the %d bytes of Query with %v, got %d", len(want), filters, len(got))
+		}
+		if wantChunks := len(want) / int(recordSize) / 1000; chunks != wantChunks {
+			t.Errorf("Expected %d chunks, got %d", wantChunks, chunks)
+		}
+	}
+	stop := errors.New("stop")
+	first := int64(0)
+	err = bounded.QueryFunc(0, math.MaxInt64, nil, func(data []byte) error {
+		first = int64(binary.LittleEndian.Uint64(data))
+		return stop
+	})
+	if err != stop || first != 1 {
+		t.Errorf("Expected the error of the callback after the first chunk, got %v", err)
+	}
+
+	// Exports read in chunks and match those of an unbounded database
+	var got, want bytes.Buffer
+	if err := bounded.ExportCSV(&got, 0, math.MaxInt64, hocdb.CSVOptions{}); err != nil {
+		t.Fatalf("Failed to export CSV: %v", err)
+	}
+	if err := plain.ExportCSV(&want, 0, math.MaxInt64, hocdb.CSVOptions{}); err != nil {
+		t.Fatalf("Failed to export CSV: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Errorf("Expected the CSV of an unbounded database, got %d bytes instead of %d", got.Len(), want.Len())
+	}
+	got.Reset()
+	if err := bounded.ExportCSV(&got, 50000, 60000, hocdb.CSVOptions{}); err != nil || got.String() != "timestamp,price\n" {
+		t.Errorf("Expected only the header for an empty range, got %q, %v", got.String(), err)
+	}
+	got.Reset()
+	want.Reset()
+	if err := bounded.ExportJSON(&got, 0, math.MaxInt64); err != nil {
+		t.Fatalf("Failed to export JSON: %v", err)
+	}
+	if err := plain.ExportJSON(&want, 0, math.MaxInt64); err != nil {
+		t.Fatalf("Failed to export JSON: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Errorf("Expected the JSON of an unbounded database, got %d bytes instead of %d", got.Len(), want.Len())
+	}
+}
@@ -0,0 +1,95 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStringWidth(t *testing.T) {
+	testDir := "../../../b_go_test_data_stringwidth"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema, err := hocdb.ParseSchema("timestamp:i64,event:string(16),note:string")
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+	if schema[1].Type != hocdb.StringType(16) || schema[1].Type.String() != "string(16)" {
+		t.Errorf("Expected string(16), got %v", schema[1].Type)
+	}
+	if hocdb.StringType(128) != hocdb.TypeString || !schema[1].Type.IsString() {
+		t.Errorf("Expected StringType(128) to be TypeString")
+	}
+	if size := hocdb.RecordSize(schema); size != 8+16+128 {
+		t.Errorf("Expected record size 152, got %d", size)
+	}
+	for _, name := range []string{"string(0)", "string(129)", "string(x)"} {
+		if _, err := hocdb.ParseFieldType(name); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+	if _, err := hocdb.ParseValue(schema[1].Type, strings.Repeat("x", 17)); err == nil {
+		t.Errorf("Expected an error for a string longer than the field")
+	}
+
+	db, err := hocdb.New("EVENTS", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	if err := db.AppendValues(int64(1), "login", "a"); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if err := db.AppendValues(int64(2), "sixteen-byte-evt", "b"); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	db.Close()
+
+	// The width is part of the recorded schema
+	db, got, err := hocdb.OpenExisting("EVENTS", testDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db.Close()
+	if got[1].Type != hocdb.StringType(16) {
+		t.Errorf("Expected the recorded type string(16), got %v", got[1].Type)
+	}
+	if _, err := hocdb.New("EVENTS", testDir, []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "event", Type: hocdb.TypeString},
+		{Name: "note", Type: hocdb.TypeString},
+	}, hocdb.Options{}); err == nil {
+		t.Errorf("Expected a schema mismatch for another string width")
+	}
+
+	data, err := db.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	records, err := hocdb.DecodeRecords(schema, data)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(records) != 2 || records[0].Values[1] != "login" || records[1].Values[1] != "sixteen-byte-evt" {
+		t.Errorf("Unexpected records: %v", records)
+	}
+
+	ro, err := hocdb.OpenReadOnly("EVENTS", testDir, schema)
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	defer ro.Close()
+
+	for name, d := range map[string]*hocdb.DB{"engine": db, "read-only": ro} {
+		for filter, want := range map[string]int{"login": 1, "sixteen-byte-evt": 1, "sixteen-byte-event": 0, "log": 0} {
+			data, err := d.Query(0, 10, map[string]interface{}{"event": filter})
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			if records, _ := hocdb.DecodeRecords(schema, data); len(records) != want {
+				t.Errorf("%s: expected %d records for %q, got %v", name, want, filter, records)
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"hocdb/cmd/hocdbgen/example"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSchemaFromStruct(t *testing.T) {
+	type Tick struct {
+		Timestamp time.Time
+		BidPrice  float64
+		Side      string         `hocdb:"side,string(8)"`
+		Fee       *hocdb.Decimal `hocdb:",decimal(2)"`
+		Payload   []byte         `hocdb:"payload,bytes(16)?"`
+		HTTPCode  uint16         `hocdb:"-"`
+		note      string
+	}
+	schema, err := hocdb.SchemaFromStruct(&Tick{})
+	if err != nil {
+		t.Fatalf("Failed to get the schema: %v", err)
+	}
+	want := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "bid_price", Type: hocdb.TypeF64},
+		{Name: "side", Type: hocdb.StringType(8)},
+		{Name: "fee", Type: hocdb.DecimalType(2), Nullable: true},
+		{Name: "payload", Type: hocdb.BytesType(16), Nullable: true},
+	}
+	if !reflect.DeepEqual(schema, want) {
+		t.Errorf("Expected %v, got %v", want, schema)
+	}
+
+	// The tags of generated structs describe their schema
+	if schema, err := hocdb.SchemaFromStruct(example.Trade{}); err != nil || !reflect.DeepEqual(schema, example.TradeSchema) {
+		t.Errorf("Expected the schema of the generated struct, got %v, %v", schema, err)
+	}
+
+	for _, tc := range []struct {
+		v   interface{}
+		err string
+	}{
+		{42, "not a struct"},
+		{struct {
+			Price float64 `hocdb:"price,i64"`
+		}{}, "i64 field of Go type float64"},
+		{struct {
+			Price float64 `hocdb:"price,f64?"`
+		}{}, "isn't a pointer"},
+		{struct{ Code uint16 }{}, "unsupported Go type uint16"},
+		{struct {
+			BidPrice float64
+			Bid      float64 `hocdb:"bid_price"`
+		}{}, "both named bid_price"},
+	} {
+		if _, err := hocdb.SchemaFromStruct(tc.v); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Expected an error with %q for %T, got %v", tc.err, tc.v, err)
+		}
+	}
+}
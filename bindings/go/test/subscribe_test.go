@@ -0,0 +1,159 @@
+package hocdb_test
+
+import (
+	"context"
+	"hocdb"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	testDir := "../../../b_go_test_data_subscribe"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	record, _ := hocdb.CreateRecordBytes(schema, int64(100), 1.0)
+	if err := db.Append(record); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	records, err := db.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	next := func() hocdb.Record {
+		select {
+		case rec, ok := <-records:
+			if !ok {
+				t.Fatalf("Subscription closed early")
+			}
+			return rec
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for a record")
+		}
+		return hocdb.Record{}
+	}
+
+	// Appends through the handle are delivered, earlier records are not
+	for i := int64(2); i <= 3; i++ {
+		record, _ := hocdb.CreateRecordBytes(schema, i*100, float64(i))
+		if err := db.Append(record); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if rec := next(); rec.Timestamp() != 200 || rec.Values[1] != 2.0 {
+		t.Errorf("Unexpected record: %v", rec.Values)
+	}
+	if rec := next(); rec.Timestamp() != 300 {
+		t.Errorf("Unexpected record: %v", rec.Values)
+	}
+
+	// A record written to the data file by another writer is picked up by polling
+	external, _ := hocdb.CreateRecordBytes(schema, int64(400), 4.0)
+	f, err := os.OpenFile(filepath.Join(testDir, "BTC_USD.bin"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("Failed to open data file: %v", err)
+	}
+	if _, err := f.Write(external); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+	f.Close()
+	if rec := next(); rec.Timestamp() != 400 || rec.Values[1] != 4.0 {
+		t.Errorf("Unexpected external record: %v", rec.Values)
+	}
+
+	// Cancelling closes the channel
+	cancel()
+	for range records {
+	}
+
+	// So does closing the database
+	other, err := db.Subscribe(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	db.Close()
+	select {
+	case _, ok := <-other:
+		if ok {
+			t.Errorf("Expected no records after close")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Subscription not closed with the database")
+	}
+
+	if _, err := db.Subscribe(context.Background()); err == nil {
+		t.Errorf("Expected an error subscribing to a closed database")
+	}
+}
+
+func TestSubscribeRingBuffer(t *testing.T) {
+	testDir := "../../../b_go_test_data_subscribe_ring"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "value", Type: hocdb.TypeI64},
+	}
+	// Room for four records
+	db, err := hocdb.New("RING", testDir, schema, hocdb.Options{MaxFileSize: 12 + 4*16, OverwriteFull: true})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	for i := int64(1); i <= 6; i++ {
+		record, _ := hocdb.CreateRecordBytes(schema, i, i)
+		if err := db.Append(record); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	records, err := db.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	for i := int64(7); i <= 10; i++ {
+		record, _ := hocdb.CreateRecordBytes(schema, i, i)
+		if err := db.Append(record); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	for want := int64(7); want <= 10; want++ {
+		select {
+		case rec := <-records:
+			if rec.Timestamp() != want {
+				t.Fatalf("Expected timestamp %d, got %d", want, rec.Timestamp())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for record %d", want)
+		}
+	}
+
+	// Nothing is delivered twice once the file has caught up
+	time.Sleep(200 * time.Millisecond)
+	select {
+	case rec := <-records:
+		t.Errorf("Unexpected duplicate record: %v", rec.Values)
+	default:
+	}
+}
@@ -0,0 +1,106 @@
+package hocdb_test
+
+import (
+	"errors"
+	"hocdb"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTickerFiles(t *testing.T) {
+	testDir := "../../../b_go_test_data_tickers"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}, {Name: "price", Type: hocdb.TypeF64}}
+	for _, ticker := range []string{"ETH_USD", "BTC_USD", "LUNA_USD"} {
+		db, err := hocdb.New(ticker, testDir, schema, hocdb.Options{})
+		if err != nil {
+			t.Fatalf("Failed to create DB: %v", err)
+		}
+		if err := db.AppendValues(int64(1), 1.0); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+		db.Close()
+	}
+	// Data files without metadata and hidden files
+	os.WriteFile(filepath.Join(testDir, "OLD_USD.bin"), nil, 0644)
+	os.WriteFile(filepath.Join(testDir, ".BTC_USD.schema.json.tmp1"), nil, 0644)
+
+	tickers, err := hocdb.ListTickers(testDir)
+	if err != nil {
+		t.Fatalf("Failed to list tickers: %v", err)
+	}
+	if want := []string{"BTC_USD", "ETH_USD", "LUNA_USD", "OLD_USD"}; !reflect.DeepEqual(tickers, want) {
+		t.Errorf("Expected tickers %v, got %v", want, tickers)
+	}
+
+	// An open database is neither dropped nor renamed
+	db, _, err := hocdb.OpenExisting("LUNA_USD", testDir)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	if err := hocdb.DropTicker(testDir, "LUNA_USD"); err == nil {
+		t.Errorf("Expected an error dropping an open database")
+	}
+	if err := hocdb.RenameTicker(testDir, "LUNA_USD", "LUNC_USD"); err == nil {
+		t.Errorf("Expected an error renaming an open database")
+	}
+	db.Close()
+
+	if err := hocdb.DropTicker(testDir, "LUNA_USD"); err != nil {
+		t.Fatalf("Failed to drop: %v", err)
+	}
+	if err := hocdb.DropTicker(testDir, "LUNA_USD"); !errors.Is(err, hocdb.ErrUnknownTicker) {
+		t.Errorf("Expected ErrUnknownTicker, got %v", err)
+	}
+	if err := hocdb.DropTicker(testDir, "OLD_USD"); err == nil {
+		t.Errorf("Expected an error dropping a database without metadata")
+	}
+	if err := hocdb.RenameTicker(testDir, "ETH_USD", "BTC_USD"); err == nil {
+		t.Errorf("Expected an error renaming onto an existing ticker")
+	}
+	if err := hocdb.RenameTicker(testDir, "ETH_USD", "../ETH_USD"); err == nil {
+		t.Errorf("Expected an error renaming outside the directory")
+	}
+	if err := hocdb.RenameTicker(testDir, "ETH_USD", "ETHW_USD"); err != nil {
+		t.Fatalf("Failed to rename: %v", err)
+	}
+
+	tickers, _ = hocdb.ListTickers(testDir)
+	if want := []string{"BTC_USD", "ETHW_USD", "OLD_USD"}; !reflect.DeepEqual(tickers, want) {
+		t.Errorf("Expected tickers %v, got %v", want, tickers)
+	}
+	db, stored, err := hocdb.OpenExisting("ETHW_USD", testDir)
+	if err != nil {
+		t.Fatalf("Failed to open renamed DB: %v", err)
+	}
+	defer db.Close()
+	if data, err := db.Load(); err != nil || len(data) != hocdb.RecordSize(stored) {
+		t.Errorf("Expected the renamed record, got %d bytes, %v", len(data), err)
+	}
+
+	// A catalog closes its handle before dropping or renaming
+	catalog, err := hocdb.OpenCatalog(testDir, hocdb.Options{}, 4)
+	if err != nil {
+		t.Fatalf("Failed to open catalog: %v", err)
+	}
+	defer catalog.Close()
+	if err := catalog.AppendValues("BTC_USD", int64(2), 2.0); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if err := catalog.Rename("BTC_USD", "XBT_USD"); err != nil {
+		t.Fatalf("Failed to rename: %v", err)
+	}
+	if data, err := catalog.Query("XBT_USD", 0, 10, nil); err != nil || len(data) != 2*hocdb.RecordSize(schema) {
+		t.Errorf("Expected 2 records, got %d bytes, %v", len(data), err)
+	}
+	if err := catalog.Drop("XBT_USD"); err != nil {
+		t.Fatalf("Failed to drop: %v", err)
+	}
+	if _, err := catalog.Schema("XBT_USD"); !errors.Is(err, hocdb.ErrUnknownTicker) {
+		t.Errorf("Expected ErrUnknownTicker, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"hocdb/hocdbtest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTiering(t *testing.T) {
+	testDir := "../../../b_go_test_data_tier"
+	warmDir := "../../../b_go_test_data_tier_warm"
+	snapDir := "../../../b_go_test_data_tier_snap"
+	for _, dir := range []string{testDir, warmDir, snapDir} {
+		os.RemoveAll(dir)
+		defer os.RemoveAll(dir)
+	}
+
+	// Ten records of two days ago, ten of two hours ago and five of now
+	now := time.Now()
+	var want []byte
+	appendAt := func(db *hocdb.DB, base time.Time, n int) {
+		for i := 0; i < n; i++ {
+			ts := base.Add(time.Duration(i) * time.Second).UnixNano()
+			if err := db.AppendValues(ts, float64(i), 1.0); err != nil {
+				t.Fatalf("Failed to append: %v", err)
+			}
+			record, _ := hocdb.CreateRecordBytes(hocdbtest.TickSchema, ts, float64(i), 1.0)
+			want = append(want, record...)
+		}
+	}
+	compression := &hocdb.Compression{Codec: "deflate", SegmentRecords: 10}
+	db, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, hocdb.Options{Compression: compression})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	appendAt(db, now.Add(-48*time.Hour), 10)
+	appendAt(db, now.Add(-2*time.Hour), 10)
+	appendAt(db, now, 5)
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	db.Close()
+
+	store := &memStore{objects: make(map[string][]byte)}
+	options := hocdb.Options{
+		Compression: compression,
+		ColdStorage: &hocdb.ColdStorage{Store: store},
+		Tiering:     &hocdb.Tiering{WarmAfter: time.Hour, WarmPath: warmDir, ColdAfter: 24 * time.Hour},
+	}
+	if _, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, hocdb.Options{
+		Compression: compression,
+		Tiering:     &hocdb.Tiering{ColdAfter: time.Hour},
+	}); err == nil {
+		t.Errorf("Expected ColdAfter without ColdStorage to fail")
+	}
+	db, err = hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, options)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db.Close()
+
+	// The records of two hours ago leave the data file for the warm tier, and the
+	// segment of two days ago moves on to the cold tier
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	tiers, err := db.Tiers()
+	if err != nil {
+		t.Fatalf("Failed to get tiers: %v", err)
+	}
+	for i, n := range []int64{5, 10, 10} {
+		if tiers[i].Records != n {
+			t.Errorf("Expected %d records in the %v tier, got %d", n, tiers[i].Tier, tiers[i].Records)
+		}
+	}
+	if tiers[0].First != now.UnixNano() || tiers[2].Last != now.Add(-48*time.Hour+9*time.Second).UnixNano() {
+		t.Errorf("Expected the time ranges of the tiers, got %+v", tiers)
+	}
+	segments, err := db.Segments()
+	if err != nil || len(segments) != 2 {
+		t.Fatalf("Expected 2 segments, got %d, %v", len(segments), err)
+	}
+	if segments[0].Key == "" || len(store.objects) != 1 {
+		t.Errorf("Expected the first segment in cold storage, got %+v", segments[0])
+	}
+	if segments[1].Key != "" || filepath.Dir(segments[1].Path) != mustAbs(t, warmDir) {
+		t.Errorf("Expected the second segment in the warm tier, got %+v", segments[1])
+	}
+	if entries, _ := os.ReadDir(warmDir); len(entries) != 1 {
+		t.Errorf("Expected one file in the warm tier, got %d", len(entries))
+	}
+	if got, err := db.Load(); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Expected the 25 records from all tiers, got %d bytes, %v", len(got), err)
+	}
+
+	// Read-only handles follow the stubs to the warm tier
+	reader, err := hocdb.OpenReadOnly(hocdbtest.Ticker, testDir, hocdbtest.TickSchema)
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	data, err := reader.Query(now.Add(-3*time.Hour).UnixNano(), now.Add(-time.Hour).UnixNano(), nil)
+	reader.Close()
+	if err != nil || !bytes.Equal(data, want[10*24:20*24]) {
+		t.Errorf("Expected the 10 warm records, got %d bytes, %v", len(data), err)
+	}
+
+	// Snapshots hold the warm segments themselves
+	if err := db.Snapshot(snapDir); err != nil {
+		t.Fatalf("Failed to snapshot: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(snapDir, filepath.Base(segments[1].Path))); err != nil || info.Size() != segments[1].Size {
+		t.Errorf("Expected the warm segment in the snapshot, got %v", err)
+	}
+
+	db.Drop()
+	if entries, _ := os.ReadDir(warmDir); len(entries) != 0 || len(store.objects) != 0 {
+		t.Errorf("Expected Drop to delete the warm and cold segments, got %d files and %d objects", len(entries), len(store.objects))
+	}
+}
+
+func mustAbs(t *testing.T, path string) string {
+	t.Helper()
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		t.Fatalf("Failed to get the absolute path: %v", err)
+	}
+	return abs
+}
@@ -0,0 +1,84 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTimeIndex(t *testing.T) {
+	testDir := "../../../b_go_test_data_timeindex"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	indexed, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{TimeIndex: true})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	plain, err := hocdb.New("ETH_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer plain.Close()
+	appendRange := func(db *hocdb.DB, from, to int) {
+		// Timestamps 10 apart, so that ranges also start between records
+		for i := from; i <= to; i++ {
+			if err := db.AppendValues(int64(i*10), float64(i%7)); err != nil {
+				t.Fatalf("Failed to append: %v", err)
+			}
+		}
+	}
+	appendRange(indexed, 1, 5000)
+	appendRange(plain, 1, 5000)
+
+	compare := func(start, end int64, filters map[string]interface{}) {
+		t.Helper()
+		got, err := indexed.Query(start, end, filters)
+		if err != nil {
+			t.Fatalf("Failed to query: %v", err)
+		}
+		want, err := plain.Query(start, end, filters)
+		if err != nil {
+			t.Fatalf("Failed to query: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("Query(%d, %d, %v) returned %d bytes, expected %d", start, end, filters, len(got), len(want))
+		}
+	}
+	for _, r := range [][2]int64{
+		{0, 100000}, {10, 11}, {10230, 10250}, {10240, 10241}, {10241, 20481},
+		{20470, 20490}, {25000, 40965}, {49990, 50001}, {50001, 60000}, {-5, 5}, {300, 200},
+	} {
+		compare(r[0], r[1], nil)
+	}
+	compare(12345, 45678, map[string]interface{}{"price": 3.0})
+
+	info, err := os.Stat(filepath.Join(testDir, "BTC_USD.tsidx"))
+	if err != nil {
+		t.Fatalf("Failed to stat time index: %v", err)
+	}
+	if info.Size() != 5*8 {
+		t.Errorf("Expected 5 timestamps in the time index, got %d bytes", info.Size())
+	}
+	indexed.Close()
+
+	// The index is kept without TimeIndex while it exists
+	indexed, err = hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer indexed.Drop()
+	appendRange(indexed, 5001, 6000)
+	appendRange(plain, 5001, 6000)
+	compare(51195, 51215, nil)
+	compare(40000, 70000, nil)
+	if info, err := os.Stat(filepath.Join(testDir, "BTC_USD.tsidx")); err != nil || info.Size() != 6*8 {
+		t.Errorf("Expected 6 timestamps in the time index, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimestampPrecision(t *testing.T) {
+	testDir := "../../../b_go_test_data_precision"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "expiry", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	if _, err := hocdb.New("TIMES", testDir, schema, hocdb.Options{TimestampPrecision: time.Minute}); err == nil {
+		t.Errorf("Expected an error for a precision of a minute")
+	}
+
+	db, err := hocdb.New("TIMES", testDir, schema, hocdb.Options{TimestampPrecision: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		ts := base.Add(time.Duration(i)*time.Second + 999*time.Microsecond)
+		if err := db.AppendValues(ts, base.AddDate(0, 1, 0), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+
+	data, err := db.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	records, err := hocdb.DecodeRecords(schema, data)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	// Microseconds are truncated at millisecond precision
+	if ts := records[1].Timestamp(); ts != base.UnixMilli()+1000 {
+		t.Errorf("Expected timestamp %d, got %d", base.UnixMilli()+1000, ts)
+	}
+	if got := db.Time(records[1].Timestamp()); !got.Equal(base.Add(time.Second)) {
+		t.Errorf("Expected time %v, got %v", base.Add(time.Second), got)
+	}
+
+	// Time ranges and time filters convert the same way
+	data, err = db.QueryTime(base.Add(time.Second), base.Add(3*time.Second), map[string]interface{}{"expiry": base.AddDate(0, 1, 0)})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if n := len(data) / hocdb.RecordSize(schema); n != 2 {
+		t.Errorf("Expected 2 records, got %d", n)
+	}
+	if _, err := db.Query(0, 0, map[string]interface{}{"price": base}); err == nil {
+		t.Errorf("Expected an error for a time filter on an f64 field")
+	}
+	stats, err := db.GetStatsTime(base, base.Add(2*time.Second), 2)
+	if err != nil || stats.Count != 2 || stats.Sum != 1 {
+		t.Errorf("Unexpected stats %+v, %v", stats, err)
+	}
+
+	// CSV renders the timestamps at the database's precision
+	var buf bytes.Buffer
+	if err := db.ExportCSV(&buf, 0, db.Timestamp(base.Add(time.Second)), hocdb.CSVOptions{TimestampRFC3339: true}); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	if !strings.Contains(buf.String(), "2024-05-01T12:00:00Z,") {
+		t.Errorf("Expected an RFC3339 timestamp in %s", buf.String())
+	}
+
+	// The precision is recorded with the schema
+	db.Close()
+	if _, err := hocdb.New("TIMES", testDir, schema, hocdb.Options{TimestampPrecision: time.Second}); err == nil {
+		t.Errorf("Expected an error for another precision")
+	}
+	reopened, _, err := hocdb.OpenExisting("TIMES", testDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	defer reopened.Close()
+	if p := reopened.TimestampPrecision(); p != time.Millisecond {
+		t.Errorf("Expected millisecond precision, got %v", p)
+	}
+}
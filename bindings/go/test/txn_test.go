@@ -0,0 +1,70 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"os"
+	"testing"
+)
+
+func TestTxn(t *testing.T) {
+	testDir := "../../../b_go_test_data_txn"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}, {Name: "price", Type: hocdb.TypeF64}}
+	db, err := hocdb.New("ETL", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+	count := func() int {
+		data, err := db.Load()
+		if err != nil {
+			t.Fatalf("Failed to load: %v", err)
+		}
+		return len(data) / db.RecordSize()
+	}
+
+	// A file that fails halfway leaves nothing behind
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		if err := tx.AppendValues(int64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if err := tx.AppendValues(int64(6), "not a price"); err == nil {
+		t.Fatalf("Expected an error for a bad value")
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if n := count(); n != 0 {
+		t.Errorf("Expected no records after the rollback, got %d", n)
+	}
+	if err := tx.Commit(); err == nil {
+		t.Errorf("Expected an error committing a rolled back transaction")
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		tx.AppendValues(int64(i), float64(i))
+	}
+	if n := count(); n != 0 || tx.Len() != 5 {
+		t.Errorf("Expected 5 buffered records and none written, got %d written", n)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if n := count(); n != 5 {
+		t.Errorf("Expected 5 records after the commit, got %d", n)
+	}
+	if err := tx.Rollback(); err == nil {
+		t.Errorf("Expected an error rolling back a committed transaction")
+	}
+}
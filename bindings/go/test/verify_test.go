@@ -0,0 +1,100 @@
+package hocdb_test
+
+import (
+	"errors"
+	"hocdb"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyRepair(t *testing.T) {
+	testDir := "../../../b_go_test_data_verify"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{{Name: "timestamp", Type: hocdb.TypeI64}, {Name: "price", Type: hocdb.TypeF64}}
+	db, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		if err := db.AppendValues(int64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	report, err := db.Verify()
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if !report.OK() || report.Records != 5 {
+		t.Errorf("Expected a sane file with 5 records, got %+v", report)
+	}
+	db.Close()
+
+	// A crash in the middle of a write leaves a partial record the engine refuses
+	file := filepath.Join(testDir, "BTC_USD.bin")
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open data file: %v", err)
+	}
+	f.Write([]byte{6, 0, 0, 0, 0})
+	f.Close()
+	if _, err := hocdb.New("BTC_USD", testDir, schema, hocdb.Options{}); err == nil {
+		t.Fatalf("Expected the engine to refuse a partial record")
+	}
+	report, err = hocdb.VerifyTicker(testDir, "BTC_USD")
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if report.OK() || report.Records != 5 || report.Size-report.ValidSize != 5 {
+		t.Errorf("Expected a partial record of 5 bytes after 5 records, got %+v", report)
+	}
+	if _, err := hocdb.RepairTicker(testDir, "BTC_USD"); err != nil {
+		t.Fatalf("Failed to repair: %v", err)
+	}
+	if report, err := hocdb.VerifyTicker(testDir, "BTC_USD"); err != nil || !report.OK() {
+		t.Errorf("Expected a sane file after the repair, got %+v, %v", report, err)
+	}
+
+	db, err = hocdb.New("BTC_USD", testDir, schema, hocdb.Options{})
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db.Close()
+	if err := db.AppendValues(int64(6), 6.0); err != nil {
+		t.Fatalf("Failed to append after the repair: %v", err)
+	}
+
+	// A record out of order is dropped along with everything after it
+	recordSize := int64(db.RecordSize())
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Failed to read data file: %v", err)
+	}
+	data[12+3*recordSize] = 1
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+	report, err = db.Repair()
+	if err != nil {
+		t.Fatalf("Failed to repair: %v", err)
+	}
+	if report.Dropped != 3 || report.ValidSize != 12+3*recordSize {
+		t.Errorf("Expected 3 records dropped, got %+v", report)
+	}
+	loaded, err := db.Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if n := int64(len(loaded)) / recordSize; n != 3 {
+		t.Errorf("Expected 3 records after the repair, got %d", n)
+	}
+	if err := db.AppendValues(int64(4), 4.0); err != nil {
+		t.Errorf("Failed to append after the repair: %v", err)
+	}
+
+	if _, err := hocdb.VerifyTicker(testDir, "ETH_USD"); !errors.Is(err, hocdb.ErrUnknownTicker) {
+		t.Errorf("Expected ErrUnknownTicker, got %v", err)
+	}
+}
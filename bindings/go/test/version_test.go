@@ -0,0 +1,31 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	v, err := hocdb.Version()
+	if err != nil {
+		t.Fatalf("Failed to get version: %v", err)
+	}
+	if v.String() == "0.0.0" {
+		t.Errorf("Expected the library to report its version")
+	}
+	// Every type of the Go bindings and auto-increment
+	want := hocdb.SupportsAutoIncrement | hocdb.SupportsNarrowTypes | hocdb.SupportsStringWidth | hocdb.SupportsBytes | hocdb.SupportsDecimal
+	if !v.Supports(want) {
+		t.Errorf("Expected features %s, got %s", want, v.Features)
+	}
+	if v.Supports(want | hocdb.SupportsDelete) {
+		t.Errorf("Expected Supports to need all features")
+	}
+
+	if s := (hocdb.SupportsBytes | hocdb.SupportsDelete).String(); s != "bytes, delete" {
+		t.Errorf("Expected \"bytes, delete\", got %q", s)
+	}
+	if s := hocdb.Feature(1 << 40).String(); s != "0x10000000000" {
+		t.Errorf("Expected unknown features in hex, got %q", s)
+	}
+}
@@ -0,0 +1,95 @@
+package hocdb_test
+
+import (
+	"bytes"
+	"hocdb"
+	"hocdb/hocdbtest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecoverTo(t *testing.T) {
+	testDir := "../../../b_go_test_data_wal"
+	walDir := "../../../b_go_test_data_wal_log"
+	recoverDir := "../../../b_go_test_data_wal_recover"
+	for _, dir := range []string{testDir, walDir, recoverDir} {
+		os.RemoveAll(dir)
+		defer os.RemoveAll(dir)
+	}
+
+	options := hocdb.Options{WAL: &hocdb.WAL{Dir: walDir}}
+	if _, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, hocdb.Options{
+		WAL:           &hocdb.WAL{Dir: walDir},
+		OverwriteFull: true,
+	}); err == nil {
+		t.Errorf("Expected WAL with OverwriteFull to fail")
+	}
+	db, err := hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+
+	// Three batches of ten records, a checkpoint after the second
+	var want []byte
+	var instants []time.Time
+	for batch := 0; batch < 3; batch++ {
+		for i := 0; i < 10; i++ {
+			ts := int64(batch*10 + i + 1)
+			if err := db.AppendValues(ts, float64(ts), 1.0); err != nil {
+				t.Fatalf("Failed to append: %v", err)
+			}
+			record, _ := hocdb.CreateRecordBytes(hocdbtest.TickSchema, ts, float64(ts), 1.0)
+			want = append(want, record...)
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatalf("Failed to flush: %v", err)
+		}
+		if batch == 1 {
+			if err := db.Checkpoint(); err != nil {
+				t.Fatalf("Failed to checkpoint: %v", err)
+			}
+		}
+		instants = append(instants, time.Now())
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Each instant gets the batches appended until then, whether replayed from the
+	// first checkpoint, taken by New, or from the second
+	for i, instant := range instants {
+		dest := filepath.Join(recoverDir, instant.Format("150405.000000000"))
+		if err := hocdb.RecoverTo(walDir, hocdbtest.Ticker, instant, dest); err != nil {
+			t.Fatalf("Failed to recover: %v", err)
+		}
+		recovered, _, err := hocdb.OpenExisting(hocdbtest.Ticker, dest)
+		if err != nil {
+			t.Fatalf("Failed to open the recovered DB: %v", err)
+		}
+		got, err := recovered.Load()
+		recovered.Close()
+		if n := (i + 1) * 10; err != nil || !bytes.Equal(got, want[:n*24]) {
+			t.Errorf("Expected %d records at %v, got %d bytes, %v", n, instant, len(got), err)
+		}
+	}
+	if err := hocdb.RecoverTo(walDir, hocdbtest.Ticker, time.Now().Add(-time.Hour), recoverDir); err == nil {
+		t.Errorf("Expected recovering to before the first checkpoint to fail")
+	}
+
+	// Checkpoints past the retention take the older checkpoints and logs with them
+	db.Close()
+	options.WAL.Retention = time.Nanosecond
+	db, err = hocdb.New(hocdbtest.Ticker, testDir, hocdbtest.TickSchema, options)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	if err := db.Checkpoint(); err != nil {
+		t.Fatalf("Failed to checkpoint: %v", err)
+	}
+	for _, pattern := range []string{"*.snap", "*.wal"} {
+		if files, _ := filepath.Glob(filepath.Join(walDir, hocdbtest.Ticker+pattern)); len(files) != 1 {
+			t.Errorf("Expected one %s file after pruning, got %v", pattern, files)
+		}
+	}
+}
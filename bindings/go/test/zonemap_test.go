@@ -0,0 +1,156 @@
+package hocdb_test
+
+import (
+	"hocdb"
+	"hocdb/metrics"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestZoneMaps(t *testing.T) {
+	testDir := "../../../b_go_test_data_zonemaps"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+		{Name: "venue", Type: hocdb.TypeI32},
+		{Name: "qty", Type: hocdb.TypeU64, Nullable: true},
+	}
+	collector := metrics.NewCollector()
+	var slow []hocdb.SlowQuery
+	options := hocdb.Options{ZoneMaps: true, Metrics: collector.For("BTC_USD"), SlowQueryThreshold: 1}
+	db, err := hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	db.OnSlowQuery(func(q hocdb.SlowQuery) { slow = append(slow, q) })
+	for i := 1; i <= 20000; i++ {
+		var qty interface{}
+		if i%2 == 0 {
+			qty = uint64(i)
+		}
+		if err := db.AppendValues(int64(i), float64(i), int32(i/5000), qty); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+
+	// 20000 records make 4 complete blocks and an incomplete one
+	check := func(filters map[string]interface{}, start, end int64, records, scanned, pruned int) {
+		t.Helper()
+		slow = nil
+		data, err := db.Query(start, end, filters)
+		if err != nil {
+			t.Fatalf("Failed to query: %v", err)
+		}
+		if len(data) != records*db.RecordSize() {
+			t.Errorf("Expected %d records for %v, got %d bytes", records, filters, len(data))
+		}
+		if len(slow) != 1 {
+			t.Fatalf("Expected the query to be reported, got %d reports", len(slow))
+		}
+		if slow[0].BlocksScanned != scanned || slow[0].BlocksPruned != pruned {
+			t.Errorf("Expected %d blocks scanned and %d pruned for %v, got %d and %d", scanned, pruned, filters, slow[0].BlocksScanned, slow[0].BlocksPruned)
+		}
+	}
+	check(map[string]interface{}{"price": 15000.0}, 0, 30000, 1, 1, 4)
+	check(map[string]interface{}{"venue": int32(3)}, 0, 30000, 5000, 2, 3)
+	check(map[string]interface{}{"venue": int32(9)}, 0, 30000, 0, 0, 5)
+	check(map[string]interface{}{"qty": uint64(20000)}, 0, 30000, 1, 1, 4)
+	check(map[string]interface{}{"qty": nil}, 0, 30000, 10000, 5, 0)
+	check(nil, 1, 4097, 4096, 1, 4)
+	check(map[string]interface{}{"price": 15000.0}, 1, 4097, 0, 0, 5)
+
+	s := collector.Snapshot()["BTC_USD"]
+	if s.BlocksScanned != 10 || s.BlocksPruned != 25 {
+		t.Errorf("Expected 10 blocks scanned and 25 pruned, got %d and %d", s.BlocksScanned, s.BlocksPruned)
+	}
+	info, err := os.Stat(filepath.Join(testDir, "BTC_USD.zones"))
+	if err != nil {
+		t.Fatalf("Failed to stat zone map: %v", err)
+	}
+	if info.Size() != 4*(16+16*4) {
+		t.Errorf("Expected 4 complete zones, got %d bytes", info.Size())
+	}
+	db.Close()
+
+	// The zone map is kept without ZoneMaps while it exists, and the records of the
+	// incomplete block are read again
+	options.ZoneMaps = false
+	db, err = hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	db.OnSlowQuery(func(q hocdb.SlowQuery) { slow = append(slow, q) })
+	if err := db.AppendValues(int64(20001), 20001.0, int32(4), nil); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	check(map[string]interface{}{"price": 20001.0}, 0, 30000, 1, 1, 4)
+	check(map[string]interface{}{"price": 17000.0}, 0, 30000, 1, 1, 4)
+	db.Drop()
+	if _, err := os.Stat(filepath.Join(testDir, "BTC_USD.zones")); !os.IsNotExist(err) {
+		t.Errorf("Expected Drop to remove the zone map, got %v", err)
+	}
+}
+
+func TestZoneMapsSegments(t *testing.T) {
+	testDir := "../../../b_go_test_data_zonemaps_segments"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	schema := []hocdb.Field{
+		{Name: "timestamp", Type: hocdb.TypeI64},
+		{Name: "price", Type: hocdb.TypeF64},
+	}
+	var slow []hocdb.SlowQuery
+	options := hocdb.Options{
+		ZoneMaps:           true,
+		Compression:        &hocdb.Compression{Codec: "deflate", SegmentRecords: 1000},
+		SlowQueryThreshold: 1,
+	}
+	db, err := hocdb.New("BTC_USD", testDir, schema, options)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Drop()
+	db.OnSlowQuery(func(q hocdb.SlowQuery) { slow = append(slow, q) })
+	for i := 1; i <= 3500; i++ {
+		if err := db.AppendValues(int64(i), float64(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(testDir, "BTC_USD.0000000001.zone")); err != nil {
+		t.Fatalf("Expected a zone for the first segment: %v", err)
+	}
+
+	// Two segments and the data file's one block
+	data, err := db.Query(0, 10000, map[string]interface{}{"price": 1500.0})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if len(data) != db.RecordSize() {
+		t.Errorf("Expected 1 record, got %d bytes", len(data))
+	}
+	if len(slow) != 1 || slow[0].BlocksScanned != 1 || slow[0].BlocksPruned != 2 {
+		t.Errorf("Expected 1 segment scanned and 2 blocks pruned, got %+v", slow)
+	}
+	data, err = db.Query(0, 10000, map[string]interface{}{"price": 3200.0})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if len(data) != db.RecordSize() {
+		t.Errorf("Expected 1 record, got %d bytes", len(data))
+	}
+	all, err := db.Query(0, 10000, nil)
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if len(all) != 3500*db.RecordSize() {
+		t.Errorf("Expected 3500 records, got %d bytes", len(all))
+	}
+}
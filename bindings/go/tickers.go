@@ -0,0 +1,179 @@
+package hocdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ListTickers returns the tickers with a data file or schema metadata in the
+// directory at path, sorted. Hidden files, such as the temporary files of
+// migrations, are skipped.
+func ListTickers(path string) ([]string, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var tickers []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		var ticker string
+		switch {
+		case strings.HasSuffix(name, metaFileExt):
+			ticker = strings.TrimSuffix(name, metaFileExt)
+		case strings.HasSuffix(name, dataFileExt):
+			ticker = strings.TrimSuffix(name, dataFileExt)
+		default:
+			continue
+		}
+		if !seen[ticker] {
+			seen[ticker] = true
+			tickers = append(tickers, ticker)
+		}
+	}
+	sort.Strings(tickers)
+	return tickers, nil
+}
+
+// DropTicker deletes the data file and metadata of a ticker. It opens the database
+// first, so it fails instead of deleting a database that is open elsewhere, and
+// needs the metadata New records to do so.
+func DropTicker(path, ticker string) error {
+	if err := checkTicker(ticker); err != nil {
+		return err
+	}
+	db, err := openTicker(path, ticker, Options{})
+	if err != nil {
+		return fmt.Errorf("failed to drop %s: %w", ticker, err)
+	}
+	db.Drop()
+	return nil
+}
+
+// RenameTicker renames the data file and metadata of a ticker. Like DropTicker it
+// fails for a database that is open elsewhere, and also when the new ticker exists.
+// The metadata is written under the new name before the data file is moved, so an
+// interrupted rename leaves the old name openable or the new one complete.
+func RenameTicker(path, oldTicker, newTicker string) error {
+	if err := checkTicker(oldTicker); err != nil {
+		return err
+	}
+	if err := checkTicker(newTicker); err != nil {
+		return err
+	}
+	for _, ext := range []string{dataFileExt, metaFileExt} {
+		if _, err := os.Stat(filepath.Join(path, newTicker+ext)); err == nil {
+			return fmt.Errorf("failed to rename %s: %s already exists", oldTicker, newTicker)
+		}
+	}
+
+	// Holding the database open keeps other processes from opening it meanwhile
+	db, err := openTicker(path, oldTicker, Options{})
+	if err != nil {
+		return fmt.Errorf("failed to rename %s: %w", oldTicker, err)
+	}
+	defer db.Close()
+	if err := db.Flush(); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", oldTicker, err)
+	}
+
+	oldMeta, newMeta := filepath.Join(path, oldTicker+metaFileExt), filepath.Join(path, newTicker+metaFileExt)
+	meta, err := os.ReadFile(oldMeta)
+	if err != nil {
+		return fmt.Errorf("failed to rename %s: %w", oldTicker, err)
+	}
+	if err := copyFileAtomic(newMeta, bytes.NewReader(meta), int64(len(meta))); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", oldTicker, err)
+	}
+	if err := os.Rename(db.dataFile(), filepath.Join(path, newTicker+dataFileExt)); err != nil {
+		os.Remove(newMeta)
+		return fmt.Errorf("failed to rename %s: %w", oldTicker, err)
+	}
+	if err := os.Rename(db.checksumFile(), filepath.Join(path, newTicker+checksumFileExt)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		// Checksums are computed anew without their file
+		os.Remove(db.checksumFile())
+	}
+	if db.colFiles != nil {
+		// Column files are rebuilt without them
+		files := db.columnFiles()
+		db.closeColumns()
+		renamed := &DB{ticker: newTicker, path: path, schema: db.schema}
+		for i, name := range renamed.columnFiles() {
+			if err := os.Rename(files[i], name); err != nil {
+				os.Remove(files[i])
+			}
+		}
+	}
+	for _, idx := range db.indexes {
+		// Indexes are dropped rather than left stale
+		idx.file.Close()
+		renamed := &DB{ticker: newTicker, path: path}
+		if err := os.Rename(db.indexFile(idx.field), renamed.indexFile(idx.field)); err != nil {
+			os.Remove(db.indexFile(idx.field))
+		}
+	}
+	db.indexes = nil
+	renamed := &DB{ticker: newTicker, path: path}
+	if db.zoneMap != nil {
+		// The zone map is rebuilt without it
+		db.closeZones()
+		if err := os.Rename(db.zoneFile(), renamed.zoneFile()); err != nil {
+			os.Remove(db.zoneFile())
+		}
+	}
+	if db.tsIndex != nil {
+		db.closeTimeIndex()
+		if err := os.Rename(db.timeIndexFile(), renamed.timeIndexFile()); err != nil {
+			os.Remove(db.timeIndexFile())
+		}
+	}
+	for _, s := range db.segments {
+		if s.data != "" {
+			// Files in the warm tier are renamed too, so that they don't clash with a
+			// new database of the old ticker
+			data := segmentFile(filepath.Dir(s.data), newTicker, s.seq)
+			if err := os.Rename(s.data, data); err != nil {
+				return fmt.Errorf("failed to rename %s: %w", oldTicker, err)
+			}
+			s.data = data
+			stub, err := segmentStub(warmMagic, s, data)
+			if err == nil {
+				err = copyFileAtomic(s.file, bytes.NewReader(stub), int64(len(stub)))
+			}
+			if err != nil {
+				return fmt.Errorf("failed to rename %s: %w", oldTicker, err)
+			}
+		}
+		if err := os.Rename(s.file, segmentFile(path, newTicker, s.seq)); err != nil {
+			return fmt.Errorf("failed to rename %s: %w", oldTicker, err)
+		}
+		// Zones of segments are computed again without theirs
+		renamed := segment{file: segmentFile(path, newTicker, s.seq)}
+		if err := os.Rename(segmentZoneFile(s), segmentZoneFile(renamed)); err != nil {
+			os.Remove(segmentZoneFile(s))
+		}
+		os.Rename(bloomFile(s), bloomFile(renamed))
+	}
+	os.Remove(db.lock.Name())
+	return os.Remove(oldMeta)
+}
+
+// openTicker opens an existing database by its metadata, see openExisting
+func openTicker(path, ticker string, options Options) (*DB, error) {
+	if _, err := os.Stat(filepath.Join(path, ticker+metaFileExt)); errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(filepath.Join(path, ticker+dataFileExt)); err == nil {
+			return nil, errors.New("no recorded schema, open the database with New once to record it")
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTicker, ticker)
+	}
+	db, _, err := openExisting(ticker, path, options)
+	return db, err
+}
@@ -0,0 +1,291 @@
+package hocdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// warmMagic starts the stub a segment file is replaced with once Tiering moved
+	// the segment to WarmPath, laid out like the stub of coldMagic with the
+	// absolute path of the segment file in place of the key
+	warmMagic = "HOCW"
+
+	// tierInterval is how often flushes start a compaction to apply the age
+	// policies of Tiering when nothing else does
+	tierInterval = time.Minute
+)
+
+// Tiering places the records of a database in storage tiers by age: hot records in
+// the uncompressed data file on the disk at its path, warm ones in segments on
+// local disk, possibly another volume, and cold ones in ColdStorage. Compactions
+// move records down the tiers, and queries read all of them.
+type Tiering struct {
+	// WarmAfter moves records older than it out of the data file at the next
+	// compaction, in segments of up to Compression.SegmentRecords, besides those
+	// past two segments' worth. Partitioned databases move whole partitions and
+	// don't support it.
+	WarmAfter time.Duration
+
+	// WarmPath is the directory segments are kept in, such as a larger and slower
+	// volume than the data file's; a stub of a few bytes next to the data file
+	// points to each. Compactions move the segments at the database path there.
+	// Segments stay at the database path when empty.
+	WarmPath string
+
+	// ColdAfter moves the segments whose newest record is older than it to
+	// ColdStorage, which it needs, unless they are among the newest
+	// ColdStorage.KeepLocal
+	ColdAfter time.Duration
+}
+
+// check validates the tiering of a database with options
+func (t *Tiering) check(options Options) error {
+	if options.Compression == nil && options.PartitionBy == PartitionNone {
+		return errors.New("tiering needs a database with Compression or PartitionBy")
+	}
+	if t.WarmAfter < 0 || t.ColdAfter < 0 {
+		return errors.New("tiering ages must not be negative")
+	}
+	if t.WarmAfter > 0 && options.PartitionBy != PartitionNone {
+		return errors.New("tiering WarmAfter needs a database without PartitionBy")
+	}
+	if t.ColdAfter > 0 && options.ColdStorage == nil {
+		return errors.New("tiering ColdAfter needs ColdStorage")
+	}
+	return nil
+}
+
+// openWarmPath creates the warm directory of a tiering and returns its absolute
+// path, or "" without one
+func openWarmPath(t *Tiering) (string, error) {
+	if t == nil || t.WarmPath == "" {
+		return "", nil
+	}
+	warm, err := filepath.Abs(t.WarmPath)
+	if err != nil {
+		return "", err
+	}
+	return warm, os.MkdirAll(warm, 0755)
+}
+
+// Tier is a storage tier of Tiering
+type Tier int
+
+const (
+	TierHot  Tier = iota // The data file
+	TierWarm             // Segments on local disk
+	TierCold             // Segments in ColdStorage
+)
+
+func (t Tier) String() string {
+	switch t {
+	case TierHot:
+		return "hot"
+	case TierWarm:
+		return "warm"
+	case TierCold:
+		return "cold"
+	}
+	return fmt.Sprintf("Tier(%d)", int(t))
+}
+
+// TierInfo describes the records of a database in a storage tier
+type TierInfo struct {
+	Tier        Tier
+	Records     int64
+	First, Last int64 // Timestamps of the first and last records, 0 without records
+	Bytes       int64 // On local disk for the hot and warm tiers, in the object store for the cold tier
+}
+
+// Tiers returns how the records of the database are spread over the storage
+// tiers, hottest first. Databases without Tiering have warm and cold tiers too
+// when they have segments or ColdStorage.
+func (db *DB) Tiers() ([]TierInfo, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if !db.opened() {
+		return nil, errors.New("database not initialized")
+	}
+	if db.readOnly {
+		if err := db.refreshSegments(); err != nil {
+			return nil, err
+		}
+	} else if err := db.flush(); err != nil {
+		return nil, err
+	}
+
+	tiers := []TierInfo{{Tier: TierHot}, {Tier: TierWarm}, {Tier: TierCold}}
+	add := func(t *TierInfo, count, first, last, size int64) {
+		if count == 0 {
+			return
+		}
+		if t.Records == 0 {
+			t.First = first
+		}
+		t.Records += count
+		t.Last = last
+		t.Bytes += size
+	}
+	for _, s := range db.segments {
+		t := &tiers[TierWarm]
+		if s.key != "" {
+			t = &tiers[TierCold]
+		}
+		add(t, s.count, s.first, s.last, s.dataOffset+s.size)
+	}
+
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	v, err := db.dataView(f)
+	if err != nil {
+		return nil, err
+	}
+	if v.count > 0 {
+		first, err := v.timestampAt(0)
+		if err != nil {
+			return nil, err
+		}
+		last, err := v.timestampAt(v.count - 1)
+		if err != nil {
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		add(&tiers[TierHot], v.count, first, last, info.Size())
+	}
+	return tiers, nil
+}
+
+// dataPath returns the file holding the data of a local segment: the segment file,
+// or the file in Tiering.WarmPath its stub points to
+func (s segment) dataPath() string {
+	if s.data != "" {
+		return s.data
+	}
+	return s.file
+}
+
+// warmRecords returns how many records at the start of the data file f are older
+// than Tiering.WarmAfter; db.mu must be held
+func (db *DB) warmRecords(f *os.File) (int64, error) {
+	t := db.options.Tiering
+	if t == nil || t.WarmAfter <= 0 {
+		return 0, nil
+	}
+	v, err := db.dataView(f)
+	if err != nil || v.count == 0 {
+		return 0, err
+	}
+	return v.search(db.Timestamp(time.Now().Add(-t.WarmAfter)))
+}
+
+// tierDue reports whether the age policies of Tiering are due to be applied by a
+// compaction, and notes that they are; db.mu must be held
+func (db *DB) tierDue() bool {
+	t := db.options.Tiering
+	if t == nil || (t.WarmAfter <= 0 && t.ColdAfter <= 0) || time.Since(db.tiered) < tierInterval {
+		return false
+	}
+	db.tiered = time.Now()
+	return true
+}
+
+// newSegment writes segment seq of records, into Tiering.WarmPath behind a stub
+// when set
+func (db *DB) newSegment(seq int, records []byte, c *Compression) (segment, error) {
+	file := segmentFile(db.path, db.ticker, seq)
+	if db.warm == "" {
+		return writeSegment(file, records, db.schema, c)
+	}
+	s, err := writeSegment(segmentFile(db.warm, db.ticker, seq), records, db.schema, c)
+	if err != nil {
+		return s, err
+	}
+	if err := syncFile(db.warm); err != nil {
+		return s, err
+	}
+	stub, err := segmentStub(warmMagic, s, s.file)
+	if err != nil {
+		return s, err
+	}
+	if err := copyFileAtomic(file, bytes.NewReader(stub), int64(len(stub))); err != nil {
+		os.Remove(s.file)
+		return s, err
+	}
+	s.file, s.data = file, s.file
+	return s, nil
+}
+
+// moveWarm moves the segments at the database path to Tiering.WarmPath. Segments
+// a QueryFunc reads wait for the next time.
+func (db *DB) moveWarm() error {
+	if db.warm == "" {
+		return nil
+	}
+	db.mu.Lock()
+	var todo []segment
+	for _, s := range db.segments {
+		if s.key == "" && s.data == "" && db.segRefs[s.seq] == 0 {
+			todo = append(todo, s)
+		}
+	}
+	db.mu.Unlock()
+
+	for _, s := range todo {
+		data := segmentFile(db.warm, db.ticker, s.seq)
+		if err := copySegment(data, s.file); err != nil {
+			return fmt.Errorf("failed to move %s to %s: %w", s.file, db.warm, err)
+		}
+		replaced, err := db.replaceWithStub(s, warmMagic, data)
+		if !replaced {
+			os.Remove(data)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to move %s to %s: %w", s.file, db.warm, err)
+		}
+	}
+	return nil
+}
+
+// replaceWithStub replaces the file of a segment copied to ref, a file in the warm
+// tier or an object in the cold tier by magic, with its stub, unless the segment
+// was dropped, moved or pinned by a QueryFunc meanwhile. It reports whether it
+// did, and otherwise the caller removes the copy.
+func (db *DB) replaceWithStub(s segment, magic, ref string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	i := sort.Search(len(db.segments), func(i int) bool { return db.segments[i].seq >= s.seq })
+	if i == len(db.segments) || db.segments[i] != s || db.segRefs[s.seq] > 0 {
+		return false, nil // Moved again next time if it's still there
+	}
+	stub, err := segmentStub(magic, s, ref)
+	if err != nil {
+		return false, err
+	}
+	if magic == coldMagic {
+		db.cold.add(ref, s.dataPath(), s.dataOffset+s.size)
+	}
+	if err := copyFileAtomic(s.file, bytes.NewReader(stub), int64(len(stub))); err != nil {
+		return false, err
+	}
+	if s.data != "" {
+		os.Remove(s.data)
+	}
+	if magic == coldMagic {
+		db.segments[i].key, db.segments[i].data = ref, ""
+	} else {
+		db.segments[i].data = ref
+	}
+	return true, nil
+}
@@ -0,0 +1,208 @@
+package hocdb
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+	"unsafe"
+)
+
+// timeIndexExt is the extension of the sparse time index of Options.TimeIndex,
+// named <ticker>.tsidx, holding the timestamp of every timeIndexStride-th record
+// of the data file
+const (
+	timeIndexExt    = ".tsidx"
+	timeIndexStride = 1024
+)
+
+// timeIndexFile returns the path of the sparse time index
+func (db *DB) timeIndexFile() string {
+	return filepath.Join(db.dataDir(), db.ticker+timeIndexExt)
+}
+
+// openTimeIndex opens the sparse time index of the data file, creating it when
+// create is set, and brings it up to date. Like the column files, it is kept
+// without TimeIndex while it exists.
+func (db *DB) openTimeIndex(create bool) error {
+	if !create {
+		if _, err := os.Stat(db.timeIndexFile()); err != nil {
+			return nil
+		}
+	}
+	f, err := os.OpenFile(db.timeIndexFile(), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		f.Close()
+		return err
+	}
+	db.tsIndex, db.tsMarks = f, make([]int64, 0, len(data)/8)
+	for off := 0; off+8 <= len(data); off += 8 {
+		db.tsMarks = append(db.tsMarks, int64(binary.LittleEndian.Uint64(data[off:])))
+	}
+	if err := db.updateTimeIndex(); err != nil {
+		db.closeTimeIndex()
+		return err
+	}
+	return nil
+}
+
+// closeTimeIndex closes the sparse time index
+func (db *DB) closeTimeIndex() {
+	if db.tsIndex != nil {
+		db.tsIndex.Close()
+	}
+	db.tsIndex, db.tsMarks, db.tsRows = nil, nil, 0
+}
+
+// removeTimeIndex deletes the sparse time index; db.mu must be held
+func (db *DB) removeTimeIndex() {
+	if db.tsIndex == nil {
+		return
+	}
+	db.closeTimeIndex()
+	os.Remove(db.timeIndexFile())
+}
+
+// resetTimeIndex rebuilds the sparse time index of a rewritten data file; db.mu
+// must be held
+func (db *DB) resetTimeIndex() error {
+	if db.tsIndex == nil {
+		return nil
+	}
+	db.closeTimeIndex()
+	os.Remove(db.timeIndexFile())
+	return db.openTimeIndex(true)
+}
+
+// updateTimeIndex adds the timestamps of the records flushed to the data file since
+// the last update to the sparse time index. Like the column files, it is cut back
+// or rebuilt when the data file was truncated or rewritten; db.mu must be held.
+func (db *DB) updateTimeIndex() error {
+	if db.tsIndex == nil || db.readOnly {
+		return nil
+	}
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	recordSize := int64(RecordSize(db.schema))
+	end, err := dataEnd(f, recordSize)
+	if err != nil {
+		return err
+	}
+	rows := (end - fileHeaderSize) / recordSize
+	tsOffset, _ := timestampOffset(db.schema)
+
+	v := &fileView{f: f, size: recordSize, tsOffset: tsOffset, count: rows}
+	marks := (rows + timeIndexStride - 1) / timeIndexStride
+	if int64(len(db.tsMarks)) > marks {
+		db.tsMarks = db.tsMarks[:marks]
+	}
+	if n := int64(len(db.tsMarks)); n > 0 {
+		for _, i := range []int64{0, n - 1} {
+			ts, err := v.timestampAt(i * timeIndexStride)
+			if err != nil {
+				return err
+			}
+			if ts != db.tsMarks[i] {
+				db.tsMarks = db.tsMarks[:0]
+				break
+			}
+		}
+	}
+	if err := db.tsIndex.Truncate(int64(len(db.tsMarks)) * 8); err != nil {
+		return err
+	}
+
+	var entries []byte
+	from := int64(len(db.tsMarks))
+	for i := from; i < marks; i++ {
+		ts, err := v.timestampAt(i * timeIndexStride)
+		if err != nil {
+			db.tsMarks = db.tsMarks[:from]
+			return err
+		}
+		entries = binary.LittleEndian.AppendUint64(entries, uint64(ts))
+		db.tsMarks = append(db.tsMarks, ts)
+	}
+	if _, err := db.tsIndex.WriteAt(entries, from*8); err != nil {
+		db.tsMarks = db.tsMarks[:from]
+		return err
+	}
+	db.tsRows = rows
+	return nil
+}
+
+// bounds narrows the records a search for ts has to look at down to the stride
+// around it, the whole view without marks
+func (v *fileView) bounds(ts int64) (int64, int64) {
+	if len(v.marks) == 0 {
+		return 0, v.count
+	}
+	// Marks are of records 0, stride, 2*stride... so the first record at or after
+	// ts follows the last mark before ts, and is at most the first mark after
+	k := int64(sort.Search(len(v.marks), func(i int) bool { return v.marks[i] >= ts }))
+	lo, hi := int64(0), v.count
+	if k > 0 {
+		lo = (k-1)*timeIndexStride + 1
+	}
+	if k < int64(len(v.marks)) {
+		hi = min64(hi, k*timeIndexStride)
+	}
+	return min64(lo, hi), hi
+}
+
+// timeIndexQuery runs a query by reading the records of its range straight from
+// the data file, found through the sparse time index, returning the result in C
+// memory like the engine and the number of records read, or false without the
+// index. Queries with QueryOpts take this path without the index too, searching
+// the whole file, since the engine can't stop part way; db.mu must be held.
+func (db *DB) timeIndexQuery(startTs, endTs int64, filters []Filter, q *queryInfo) (unsafe.Pointer, int, bool, error) {
+	if db.tsIndex == nil && q.limit == nil {
+		return nil, 0, false, nil
+	}
+	matchers, err := db.matchers(filters)
+	if err != nil {
+		return nil, 0, true, err
+	}
+	// The index covers flushed records only
+	if err := db.flush(); err != nil {
+		return nil, 0, true, err
+	}
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		return nil, 0, true, err
+	}
+	defer f.Close()
+	tsOffset, _ := timestampOffset(db.schema)
+	v := &fileView{f: f, size: int64(RecordSize(db.schema)), tsOffset: tsOffset, count: db.tsRows, marks: db.tsMarks}
+	if db.tsIndex == nil {
+		if v, err = db.dataView(f); err != nil {
+			return nil, 0, true, err
+		}
+	}
+	v.limit = q.limit
+	data, scanned, err := v.query(startTs, endTs, matchers)
+	if err != nil {
+		return nil, 0, true, err
+	}
+	var dataPtr unsafe.Pointer
+	if len(data) > 0 {
+		dataPtr = cBytes(data)
+	}
+	dataPtr, outLen, segScanned, err := db.withSegments(dataPtr, len(data), startTs, endTs, filters, q)
+	if err != nil {
+		if dataPtr != nil {
+			engineFree(dataPtr)
+		}
+		return nil, 0, true, err
+	}
+	q.scanned = scanned + segScanned
+	q.bytesRead += int64(scanned) * v.size
+	return dataPtr, outLen, true, nil
+}
@@ -0,0 +1,88 @@
+package hocdb
+
+import (
+	"fmt"
+	"time"
+)
+
+// precisionNames names the timestamp precisions in schema metadata
+var precisionNames = map[time.Duration]string{
+	time.Second:      "s",
+	time.Millisecond: "ms",
+	time.Microsecond: "us",
+	time.Nanosecond:  "ns",
+}
+
+// checkPrecision reports a TimestampPrecision other than the supported units
+func checkPrecision(precision time.Duration) error {
+	if _, ok := precisionNames[precision]; !ok && precision != 0 {
+		return fmt.Errorf("invalid timestamp precision %v, expected a second, millisecond, microsecond or nanosecond", precision)
+	}
+	return nil
+}
+
+// parsePrecision is the inverse of precisionNames, 0 for an empty name
+func parsePrecision(name string) (time.Duration, error) {
+	if name == "" {
+		return 0, nil
+	}
+	for precision, n := range precisionNames {
+		if n == name {
+			return precision, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid timestamp precision %q", name)
+}
+
+// TimestampPrecision returns the unit of the database's timestamps, see
+// Options.TimestampPrecision
+func (db *DB) TimestampPrecision() time.Duration {
+	if db.options.TimestampPrecision == 0 {
+		return time.Nanosecond
+	}
+	return db.options.TimestampPrecision
+}
+
+// Timestamp converts t to a timestamp in the database's precision, truncating
+// what is finer
+func (db *DB) Timestamp(t time.Time) int64 {
+	return timestampOf(t, db.TimestampPrecision())
+}
+
+// Time converts a timestamp in the database's precision to a time in UTC
+func (db *DB) Time(ts int64) time.Time {
+	switch db.TimestampPrecision() {
+	case time.Second:
+		return time.Unix(ts, 0).UTC()
+	case time.Millisecond:
+		return time.UnixMilli(ts).UTC()
+	case time.Microsecond:
+		return time.UnixMicro(ts).UTC()
+	default:
+		return time.Unix(0, ts).UTC()
+	}
+}
+
+// QueryTime is Query over the times in [start, end)
+func (db *DB) QueryTime(start, end time.Time, filters interface{}) ([]byte, error) {
+	return db.Query(db.Timestamp(start), db.Timestamp(end), filters)
+}
+
+// GetStatsTime is GetStats over the times in [start, end)
+func (db *DB) GetStatsTime(start, end time.Time, fieldIndex int) (*Stats, error) {
+	return db.GetStats(db.Timestamp(start), db.Timestamp(end), fieldIndex)
+}
+
+// timestampOf converts t to a count of precision since the Unix epoch
+func timestampOf(t time.Time, precision time.Duration) int64 {
+	switch precision {
+	case time.Second:
+		return t.Unix()
+	case time.Millisecond:
+		return t.UnixMilli()
+	case time.Microsecond:
+		return t.UnixMicro()
+	default:
+		return t.UnixNano()
+	}
+}
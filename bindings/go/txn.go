@@ -0,0 +1,65 @@
+package hocdb
+
+import "errors"
+
+// Txn buffers appends to one database until Commit writes them, like a Batch, or
+// Rollback drops them. It is not safe for concurrent use.
+type Txn struct {
+	db    *DB
+	batch *Batch
+}
+
+// errTxnDone is returned by the calls on a transaction after Commit or Rollback
+var errTxnDone = errors.New("transaction is already committed or rolled back")
+
+// Begin starts a transaction on the database. Its records are invisible to other
+// calls until Commit, which writes and syncs them all or none of them, also across
+// a crash. Databases with OverwriteFull don't support transactions.
+func (db *DB) Begin() (*Txn, error) {
+	if db.readOnly {
+		return nil, ErrReadOnly
+	}
+	if db.options.OverwriteFull {
+		return nil, errors.New("transactions need a database without OverwriteFull")
+	}
+	return &Txn{db: db, batch: NewBatch()}, nil
+}
+
+// Append buffers a raw record
+func (tx *Txn) Append(data []byte) error {
+	if tx.batch.done {
+		return errTxnDone
+	}
+	return tx.batch.Append(tx.db, data)
+}
+
+// AppendValues buffers a record, see DB.AppendValues
+func (tx *Txn) AppendValues(values ...interface{}) error {
+	if tx.batch.done {
+		return errTxnDone
+	}
+	return tx.batch.AppendValues(tx.db, values...)
+}
+
+// Len returns the number of buffered records
+func (tx *Txn) Len() int {
+	return tx.batch.Len()
+}
+
+// Commit writes the buffered records, see Batch.Commit
+func (tx *Txn) Commit() error {
+	if tx.batch.done {
+		return errTxnDone
+	}
+	return tx.batch.Commit()
+}
+
+// Rollback drops the buffered records, leaving the database as it was
+func (tx *Txn) Rollback() error {
+	if tx.batch.done {
+		return errTxnDone
+	}
+	tx.batch.done = true
+	tx.batch.ops = nil
+	return nil
+}
@@ -0,0 +1,279 @@
+package hocdb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// VerifyReport describes the state of a data file as found by Verify
+type VerifyReport struct {
+	Size      int64    // Size of the data file
+	Records   int64    // Number of whole records in the file
+	ValidSize int64    // Size of the file up to its last valid record, which Repair truncates it to
+	Dropped   int64    // Number of whole records after the last valid one, which Repair drops
+	Problems  []string // What is wrong with the file, empty when it is sane
+
+	badHeader   bool
+	badRing     bool
+	badChecksum bool
+}
+
+// OK reports whether no problem was found
+func (r *VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Verify flushes pending writes and checks the data file for damage an unclean
+// shutdown or a failing disk can leave: a partial record at the end, records whose
+// timestamps are out of order, or blocks that fail the checksums kept with
+// VerifyChecksums. It only reads the file; see Repair.
+func (db *DB) Verify() (*VerifyReport, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if !db.readOnly {
+		if db.handle == nil {
+			return nil, errors.New("database not initialized")
+		}
+		if err := db.flush(); err != nil {
+			return nil, err
+		}
+	}
+	return db.verify()
+}
+
+// Repair truncates the data file after its last valid record, dropping any records
+// Verify reports as damaged, and returns the report of the file before the repair.
+// A file whose header is damaged, or a ring buffer that has wrapped and whose
+// records are out of order, is left alone and returns an error.
+func (db *DB) Repair() (*VerifyReport, error) {
+	if db.readOnly {
+		return nil, ErrReadOnly
+	}
+	// Queued records must not land before the truncation
+	db.asyncMu.Lock()
+	defer db.asyncMu.Unlock()
+	if w := db.async; w != nil {
+		done := make(chan error, 1)
+		w.ch <- asyncItem{done: done}
+		if err := <-done; err != nil {
+			w.setErr(err)
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.handle == nil {
+		return nil, errors.New("database not initialized")
+	}
+	if err := db.flush(); err != nil {
+		return nil, err
+	}
+	report, err := db.verify()
+	if err != nil || report.OK() {
+		return report, err
+	}
+	if err := report.repairable(); err != nil {
+		return report, err
+	}
+	err = db.withFileClosed(func() error {
+		return truncateDataFile(db.dataFile(), report.ValidSize)
+	})
+	if err != nil {
+		db.logError("repair failed", err)
+		return report, fmt.Errorf("repair failed: %w", err)
+	}
+	db.logRepair(report)
+	return report, nil
+}
+
+// VerifyTicker checks the data file of a database that is not open, see DB.Verify.
+// Unlike New it also works on a file the engine refuses to open because it ends
+// with a partial record. The database must have recorded its schema.
+func VerifyTicker(path, ticker string) (*VerifyReport, error) {
+	db, err := tickerFiles(path, ticker)
+	if err != nil {
+		return nil, err
+	}
+	return db.verify()
+}
+
+// RepairTicker repairs the data file of a database, see DB.Repair, so that New can
+// open it again after an unclean shutdown. The database must not be open while
+// RepairTicker runs.
+func RepairTicker(path, ticker string) (*VerifyReport, error) {
+	db, err := tickerFiles(path, ticker)
+	if err != nil {
+		return nil, err
+	}
+	report, err := db.verify()
+	if err != nil || report.OK() {
+		return report, err
+	}
+	if err := report.repairable(); err != nil {
+		return report, err
+	}
+	if err := truncateDataFile(db.dataFile(), report.ValidSize); err != nil {
+		return report, fmt.Errorf("repair failed: %w", err)
+	}
+	return report, nil
+}
+
+// tickerFiles returns an unopened DB describing the files of a ticker, as recorded
+// in its metadata, enough to verify them
+func tickerFiles(path, ticker string) (*DB, error) {
+	if err := checkTicker(ticker); err != nil {
+		return nil, err
+	}
+	metaFile := filepath.Join(path, ticker+metaFileExt)
+	if _, err := os.Stat(metaFile); errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(filepath.Join(path, ticker+dataFileExt)); err == nil {
+			return nil, errors.New("no recorded schema, open the database with New once to record it")
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTicker, ticker)
+	}
+	meta, err := readMetadata(metaFile)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := meta.schema()
+	if err != nil {
+		return nil, err
+	}
+	return &DB{
+		ticker: ticker,
+		path:   path,
+		schema: withColumns(schema, meta.columns()),
+		options: Options{
+			MaxFileSize:   meta.MaxFileSize,
+			OverwriteFull: meta.OverwriteFull,
+		},
+	}, nil
+}
+
+// verify checks the data file; db.mu must be held unless db isn't open
+func (db *DB) verify() (*VerifyReport, error) {
+	f, err := os.Open(db.dataFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return &VerifyReport{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VerifyReport{Size: info.Size()}
+	if report.Size == 0 {
+		// The engine writes the header of a new file itself
+		return report, nil
+	}
+	if report.Size < fileHeaderSize {
+		report.Problems = append(report.Problems, fmt.Sprintf("data file is %d bytes, shorter than its header", report.Size))
+		return report, nil
+	}
+	var magic [4]byte
+	if _, err := f.ReadAt(magic[:], 0); err != nil {
+		return nil, err
+	}
+	if string(magic[:]) != "HOC1" {
+		report.badHeader = true
+		report.ValidSize = report.Size
+		report.Problems = append(report.Problems, "data file has no HOCDB header")
+		return report, nil
+	}
+
+	size := int64(RecordSize(db.schema))
+	end, err := dataEnd(f, size)
+	if err != nil {
+		return nil, err
+	}
+	report.Records = (end - fileHeaderSize) / size
+	report.ValidSize = end
+	if end != report.Size {
+		report.Problems = append(report.Problems, fmt.Sprintf("data file ends with %d bytes of a partial record", report.Size-end))
+	}
+
+	// Records are in timestamp order, except that a ring buffer that has wrapped
+	// drops back once, where its oldest records start
+	wrapped := db.options.OverwriteFull && end >= db.maxFileSize()
+	tsOffset, _ := timestampOffset(db.schema)
+	var first, prev int64
+	drops := 0
+	err = scanRecords(f, size, tsOffset, fileHeaderSize, end, func(offset, ts int64, rec []byte) bool {
+		if offset == fileHeaderSize {
+			first, prev = ts, ts
+			return true
+		}
+		if ts > prev {
+			prev = ts
+			return true
+		}
+		if wrapped && ts < prev && drops == 0 {
+			drops++
+			prev = ts
+			return true
+		}
+		index := (offset - fileHeaderSize) / size
+		report.Problems = append(report.Problems, fmt.Sprintf("record %d has timestamp %d, not after the %d before it", index, ts, prev))
+		if wrapped {
+			report.badRing = true
+		} else {
+			report.ValidSize = offset
+			report.Dropped = report.Records - index
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if wrapped && drops > 0 && !report.badRing && prev >= first {
+		report.badRing = true
+		report.Problems = append(report.Problems, fmt.Sprintf("oldest record has timestamp %d, not before the newest %d", first, prev))
+	}
+
+	// Blocks a truncation removed are no longer covered, see updateChecksums
+	blocks, err := readChecksums(db.checksumFile())
+	if err != nil {
+		return nil, err
+	}
+	if complete := int((end - fileHeaderSize) / (size * checksumBlockRecords)); len(blocks) > complete {
+		blocks = blocks[:complete]
+	}
+	corrupt, err := db.corruptBlocks(f, blocks, math.MinInt64, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range corrupt {
+		report.badChecksum = true
+		report.Problems = append(report.Problems, fmt.Sprintf("block at offset %d with timestamps %d to %d fails its checksum", c.Offset, c.StartTs, c.EndTs))
+	}
+	return report, nil
+}
+
+// repairable returns why Repair can't fix the problems found, if it can't
+func (r *VerifyReport) repairable() error {
+	if r.badHeader {
+		return errors.New("data file has no HOCDB header, it can't be repaired")
+	}
+	if r.badRing {
+		return errors.New("ring buffer records are out of order, it can't be repaired by truncating")
+	}
+	if r.badChecksum {
+		return errors.New("blocks fail their checksums, restore the database from a backup")
+	}
+	return nil
+}
+
+// truncateDataFile truncates a data file and syncs it
+func truncateDataFile(file string, size int64) error {
+	if err := os.Truncate(file, size); err != nil {
+		return err
+	}
+	return syncFile(file)
+}
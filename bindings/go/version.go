@@ -0,0 +1,105 @@
+package hocdb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupported is matched by the errors of New for schemas and options the
+// libhocdb_c in use doesn't support, see Version
+var ErrUnsupported = errors.New("not supported by the HOCDB library")
+
+// Feature is a bitmask of features of libhocdb_c, the HOCDB_FEATURE_* constants
+// of hocdb.h
+type Feature uint64
+
+const (
+	SupportsAutoIncrement Feature = 1 << iota // Options.AutoIncrement
+	SupportsNarrowTypes                       // TypeI32, TypeU32, TypeF32 and TypeI16
+	SupportsStringWidth                       // StringType
+	SupportsBytes                             // TypeBytes and BytesType
+	SupportsDecimal                           // TypeDecimal and DecimalType
+	SupportsCompression                       // Compression of the data file by the engine
+	SupportsDelete                            // Deleting records in the engine
+)
+
+var featureNames = []string{"auto-increment", "narrow types", "string widths", "bytes", "decimal", "compression", "delete"}
+
+// String returns the names of the features, separated by commas
+func (f Feature) String() string {
+	var names []string
+	for i, name := range featureNames {
+		if f&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if rest := f &^ (1<<len(featureNames) - 1); rest != 0 {
+		names = append(names, fmt.Sprintf("%#x", uint64(rest)))
+	}
+	return strings.Join(names, ", ")
+}
+
+// LibraryVersion is the version of libhocdb_c and the features it supports
+type LibraryVersion struct {
+	Major, Minor, Patch int
+	Features            Feature
+}
+
+// String returns the version as major.minor.patch
+func (v LibraryVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Supports reports whether the library supports all of features
+func (v LibraryVersion) Supports(features Feature) bool {
+	return v.Features&features == features
+}
+
+// Version returns the version of the libhocdb_c the package linked or, with the
+// hocdb_purego build tag, loaded, so that callers can fail fast or degrade
+// gracefully against older libraries. Libraries from before hocdb_version report
+// version 0.0.0 without features.
+func Version() (LibraryVersion, error) {
+	if err := loadLibrary(); err != nil {
+		return LibraryVersion{}, err
+	}
+	version, features := engineVersion()
+	var v LibraryVersion
+	if version != "" {
+		if _, err := fmt.Sscanf(version, "%d.%d.%d", &v.Major, &v.Minor, &v.Patch); err != nil {
+			return LibraryVersion{}, fmt.Errorf("invalid HOCDB library version %q", version)
+		}
+	}
+	v.Features = Feature(features)
+	return v, nil
+}
+
+// checkFeatures fails with ErrUnsupported when the schema or auto-increment needs
+// features the library lacks
+func checkFeatures(schema []Field, autoIncrement bool) error {
+	v, err := Version()
+	if err != nil {
+		return err
+	}
+	var needed Feature
+	if autoIncrement {
+		needed |= SupportsAutoIncrement
+	}
+	for _, field := range schema {
+		switch t := field.Type; {
+		case t == TypeI32 || t == TypeU32 || t == TypeF32 || t == TypeI16:
+			needed |= SupportsNarrowTypes
+		case t.IsString() && t != TypeString:
+			needed |= SupportsStringWidth
+		case t.IsBytes():
+			needed |= SupportsBytes
+		case t.IsDecimal():
+			needed |= SupportsDecimal
+		}
+	}
+	if missing := needed &^ v.Features; missing != 0 {
+		return fmt.Errorf("%w: library %s lacks %s", ErrUnsupported, v, missing)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+//go:build hocdb_purego && (darwin || linux || windows)
+
+package hocdb
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestVersionOldLibrary stands in for a libhocdb_c from before hocdb_version by
+// hiding the symbols such a library lacks
+func TestVersionOldLibrary(t *testing.T) {
+	if err := loadLibrary(); err != nil {
+		t.Fatalf("Failed to load library: %v", err)
+	}
+	version, features, setAutoIncrement := hocdbVersion, hocdbFeatures, hocdbSetAutoIncrement
+	hocdbVersion, hocdbFeatures, hocdbSetAutoIncrement = 0, 0, 0
+	defer func() {
+		hocdbVersion, hocdbFeatures, hocdbSetAutoIncrement = version, features, setAutoIncrement
+	}()
+
+	v, err := Version()
+	if err != nil {
+		t.Fatalf("Failed to get version: %v", err)
+	}
+	if v.String() != "0.0.0" || v.Features != 0 {
+		t.Errorf("Expected version 0.0.0 without features, got %s with %s", v, v.Features)
+	}
+
+	testDir := "../../b_go_test_data_old_library"
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+	schema := []Field{{Name: "timestamp", Type: TypeI64}, {Name: "value", Type: TypeF64}}
+
+	_, err = New("OLD", testDir, schema, Options{AutoIncrement: &AutoIncrement{}})
+	if !errors.Is(err, ErrUnsupported) || !strings.Contains(err.Error(), "auto-increment") {
+		t.Errorf("Expected auto-increment to be unsupported, got %v", err)
+	}
+	_, err = New("OLD", testDir, []Field{{Name: "timestamp", Type: TypeI64}, {Name: "value", Type: TypeI32}}, Options{})
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected narrow types to be unsupported, got %v", err)
+	}
+
+	// What the library always supported still works
+	db, err := New("OLD", testDir, schema, Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AppendValues(int64(100), 1.5); err != nil {
+		t.Errorf("Failed to append: %v", err)
+	}
+	db.Close()
+}
@@ -0,0 +1,419 @@
+package hocdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// walMagic starts the files of the write-ahead log, followed by the length of
+	// the schema metadata as a uint32 and the metadata. Entries follow: the wall
+	// clock time of the append in Unix nanoseconds as an int64, the record and the
+	// CRC-32C of both.
+	walMagic = "HOCJ"
+
+	// walFileExt is the extension of the files of the write-ahead log, named after
+	// the ticker and the Unix nanoseconds they were started at
+	walFileExt = ".wal"
+
+	// walSnapshotExt is the extension of the checkpoints in the WAL directory,
+	// snapshots named after the ticker and the Unix nanoseconds they were complete at
+	walSnapshotExt = ".snap"
+
+	// walFileSize is the size past which a flush starts a new log file
+	walFileSize = 64 << 20
+)
+
+// WAL logs every record appended to a database with the time it was appended,
+// next to checkpoints, the snapshots Checkpoint takes, so that RecoverTo can
+// restore the database as of any instant since the oldest checkpoint kept.
+// Flushes write the log out, and fsync it with SyncFsync. The log holds appends
+// only: other changes, such as DropPartition, reach recoveries through the next
+// checkpoint.
+type WAL struct {
+	// Dir is the directory of the log and checkpoints, ideally on another disk
+	// than the database. Databases of different tickers can share it.
+	Dir string
+
+	// Retention is how far back RecoverTo must be able to go. Checkpoint deletes
+	// the checkpoints and log files only needed for earlier instants. Nothing is
+	// deleted when it is 0.
+	Retention time.Duration
+}
+
+// walLog is the write-ahead log of a database, safe for concurrent use
+type walLog struct {
+	dir, ticker string
+
+	mu    sync.Mutex
+	meta  []byte // Schema metadata heading each file
+	f     *os.File
+	w     *bufio.Writer
+	size  int64
+	entry []byte
+}
+
+// openWAL opens the write-ahead log of the database and takes its first checkpoint
+// when the WAL directory holds none
+func (db *DB) openWAL() error {
+	cfg := db.options.WAL
+	if cfg == nil {
+		return nil
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to open the WAL: %w", err)
+	}
+	meta, err := os.ReadFile(db.metaFile())
+	if err != nil {
+		return fmt.Errorf("failed to open the WAL: %w", err)
+	}
+	db.wal = &walLog{dir: cfg.Dir, ticker: db.ticker, meta: meta}
+	snapshots, err := listWALFiles(cfg.Dir, db.ticker, walSnapshotExt)
+	if err != nil || len(snapshots) > 0 {
+		return err
+	}
+	if err := db.Checkpoint(); err != nil {
+		return fmt.Errorf("failed to take the first checkpoint: %w", err)
+	}
+	return nil
+}
+
+// append buffers a record with the current time, starting a log file if needed
+func (l *walLog) append(data []byte) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		if err := l.start(); err != nil {
+			return err
+		}
+	}
+	l.entry = binary.LittleEndian.AppendUint64(l.entry[:0], uint64(time.Now().UnixNano()))
+	l.entry = append(l.entry, data...)
+	l.entry = binary.LittleEndian.AppendUint32(l.entry, crc32.Checksum(l.entry, castagnoli))
+	_, err := l.w.Write(l.entry)
+	l.size += int64(len(l.entry))
+	return err
+}
+
+// start creates a log file; l.mu must be held
+func (l *walLog) start() error {
+	name := filepath.Join(l.dir, fmt.Sprintf("%s.%020d%s", l.ticker, time.Now().UnixNano(), walFileExt))
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	l.f, l.w = f, bufio.NewWriter(f)
+	l.w.WriteString(walMagic)
+	binary.Write(l.w, binary.LittleEndian, uint32(len(l.meta)))
+	l.w.Write(l.meta)
+	l.size = int64(len(walMagic) + 4 + len(l.meta))
+	return nil
+}
+
+// write writes the buffered entries to the log file, then closes it once it
+// outgrew walFileSize
+func (l *walLog) write() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	if err := l.w.Flush(); err != nil {
+		return err
+	}
+	if l.size >= walFileSize {
+		return l.end()
+	}
+	return nil
+}
+
+// sync fsyncs the log file
+func (l *walLog) sync() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	return l.f.Sync()
+}
+
+// end writes out and closes the log file, the next append starting another;
+// l.mu must be held
+func (l *walLog) end() error {
+	err := l.w.Flush()
+	if syncErr := l.f.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := l.f.Close(); err == nil {
+		err = closeErr
+	}
+	l.f, l.w = nil, nil
+	return err
+}
+
+// reset starts a new log file for the appends after a schema change
+func (l *walLog) reset(meta []byte) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var err error
+	if l.f != nil {
+		err = l.end()
+	}
+	l.meta = meta
+	return err
+}
+
+// close writes out and closes the log
+func (l *walLog) close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	return l.end()
+}
+
+// walFile is a log file or checkpoint in the WAL directory
+type walFile struct {
+	path string
+	time int64 // Unix nanoseconds in its name
+}
+
+// listWALFiles returns the log files or checkpoints of a ticker by extension, in
+// time order
+func listWALFiles(dir, ticker, ext string) ([]walFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []walFile
+	for _, entry := range entries {
+		rest, ok := strings.CutPrefix(entry.Name(), ticker+".")
+		if !ok || len(rest) != 20+len(ext) || !strings.HasSuffix(rest, ext) {
+			continue
+		}
+		t, err := strconv.ParseInt(rest[:20], 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, walFile{path: filepath.Join(dir, entry.Name()), time: t})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].time < files[j].time })
+	return files, nil
+}
+
+// Checkpoint takes a snapshot of the database into the WAL directory, from which
+// RecoverTo replays the log, and deletes what Retention no longer needs. New takes
+// the first one; taking one daily, say, bounds how much log a recovery replays.
+func (db *DB) Checkpoint() error {
+	cfg := db.options.WAL
+	if cfg == nil {
+		return errors.New("database was opened without WAL")
+	}
+	tmp, err := os.MkdirTemp(cfg.Dir, "."+db.ticker+walSnapshotExt)
+	if err != nil {
+		return fmt.Errorf("checkpoint failed: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := db.Snapshot(tmp); err != nil {
+		return fmt.Errorf("checkpoint failed: %w", err)
+	}
+
+	// Named after its completion, the checkpoint only holds records appended
+	// before that time
+	name := filepath.Join(cfg.Dir, fmt.Sprintf("%s.%020d%s", db.ticker, time.Now().UnixNano(), walSnapshotExt))
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("checkpoint failed: %w", err)
+	}
+	if err := syncFile(cfg.Dir); err != nil {
+		return fmt.Errorf("checkpoint failed: %w", err)
+	}
+	if cfg.Retention > 0 {
+		if err := pruneWAL(cfg.Dir, db.ticker, time.Now().Add(-cfg.Retention).UnixNano()); err != nil {
+			return fmt.Errorf("checkpoint failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// pruneWAL deletes the checkpoints and log files of a ticker that recovering to an
+// instant from cutoff on doesn't need
+func pruneWAL(dir, ticker string, cutoff int64) error {
+	snapshots, err := listWALFiles(dir, ticker, walSnapshotExt)
+	if err != nil {
+		return err
+	}
+	logs, err := listWALFiles(dir, ticker, walFileExt)
+	if err != nil {
+		return err
+	}
+	// The newest checkpoint before the cutoff is the base of recovering to it
+	base := sort.Search(len(snapshots), func(i int) bool { return snapshots[i].time > cutoff }) - 1
+	if base <= 0 {
+		return nil
+	}
+	for _, s := range snapshots[:base] {
+		if err := os.RemoveAll(s.path); err != nil {
+			return err
+		}
+	}
+	// A log file ends before the next one starts
+	for i := 0; i+1 < len(logs) && logs[i+1].time <= snapshots[base].time; i++ {
+		if err := os.Remove(logs[i].path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecoverTo restores a database of a ticker into dest as it was at the instant t,
+// from the WAL directory of a database opened with Options.WAL: it restores the
+// newest checkpoint taken before t, like Restore, then appends the records the log
+// holds after it that were appended until t. Like Restore, it refuses to overwrite
+// a ticker that already exists in dest. A database with ColdStorage must be opened
+// with the same store to read the segments its checkpoint left there.
+func RecoverTo(dir, ticker string, t time.Time, dest string) error {
+	snapshots, err := listWALFiles(dir, ticker, walSnapshotExt)
+	if err != nil {
+		return fmt.Errorf("recovery failed: %w", err)
+	}
+	base := sort.Search(len(snapshots), func(i int) bool { return snapshots[i].time > t.UnixNano() }) - 1
+	if base < 0 {
+		return fmt.Errorf("recovery failed: no checkpoint of %s in %s before %s", ticker, dir, t.Format(time.RFC3339Nano))
+	}
+	if err := Restore(snapshots[base].path, dest); err != nil {
+		return err
+	}
+	db, schema, err := openExisting(ticker, dest, Options{})
+	if err != nil {
+		return fmt.Errorf("recovery failed: %w", err)
+	}
+	defer db.Close()
+
+	// Timestamps only grow, so the log entries past the newest record of the
+	// checkpoint are those it misses
+	latest, err := db.newestTimestamp()
+	if err != nil {
+		return fmt.Errorf("recovery failed: %w", err)
+	}
+	logs, err := listWALFiles(dir, ticker, walFileExt)
+	if err != nil {
+		return fmt.Errorf("recovery failed: %w", err)
+	}
+	tsOffset, _ := timestampOffset(schema)
+	for i, l := range logs {
+		if l.time > t.UnixNano() {
+			break
+		}
+		if i+1 < len(logs) && logs[i+1].time <= snapshots[base].time {
+			continue // Ended before the checkpoint
+		}
+		err := replayWAL(l.path, schema, func(wall int64, rec []byte) error {
+			ts := int64(binary.LittleEndian.Uint64(rec[tsOffset:]))
+			if wall > t.UnixNano() || ts <= latest {
+				return nil
+			}
+			latest = ts
+			return db.Append(rec)
+		})
+		if err != nil {
+			return fmt.Errorf("recovery failed: %s: %w", l.path, err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		return fmt.Errorf("recovery failed: %w", err)
+	}
+	return nil
+}
+
+// newestTimestamp returns the timestamp of the newest record of the database, or
+// math.MinInt64 without records
+func (db *DB) newestTimestamp() (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	latest := int64(math.MinInt64)
+	if len(db.segments) > 0 {
+		latest = db.segments[len(db.segments)-1].last
+	}
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	v, err := db.dataView(f)
+	if err != nil || v.count == 0 {
+		return latest, err
+	}
+	return v.timestampAt(v.count - 1)
+}
+
+// replayWAL calls fn with the entries of a log file written with schema, stopping at an entry torn by a crash
+func replayWAL(file string, schema []Field, fn func(wall int64, rec []byte) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	header := make([]byte, len(walMagic)+4)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(walMagic)]) != walMagic {
+		return errors.New("not a HOCDB write-ahead log")
+	}
+	logMeta := make([]byte, binary.LittleEndian.Uint32(header[len(walMagic):]))
+	if _, err := io.ReadFull(r, logMeta); err != nil {
+		return errors.New("not a HOCDB write-ahead log")
+	}
+	var meta metadata
+	if err := json.Unmarshal(logMeta, &meta); err != nil {
+		return fmt.Errorf("invalid schema metadata: %w", err)
+	}
+	logSchema, err := meta.schema()
+	if err != nil {
+		return err
+	}
+	if len(schemaDiff(logSchema, schema)) > 0 {
+		return errors.New("logged with another schema than the checkpoint's, recover from a checkpoint taken since")
+	}
+	recordSize := RecordSize(schema)
+	entry := make([]byte, 8+recordSize+4)
+	for {
+		if _, err := io.ReadFull(r, entry); err != nil {
+			return nil // Complete, or torn by a crash
+		}
+		body := entry[:8+recordSize]
+		if crc32.Checksum(body, castagnoli) != binary.LittleEndian.Uint32(entry[len(body):]) {
+			return nil
+		}
+		if err := fn(int64(binary.LittleEndian.Uint64(body)), body[8:]); err != nil {
+			return err
+		}
+	}
+}
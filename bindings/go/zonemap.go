@@ -0,0 +1,460 @@
+package hocdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"unsafe"
+)
+
+// zoneFileExt is the extension of the zone map of Options.ZoneMaps, named
+// <ticker>.zones. It holds the time range and the range of the values of each
+// field of every complete block of zoneBlockRecords records of the data file.
+// Segments have theirs in <ticker>.<seq>.zone.
+const (
+	zoneFileExt        = ".zones"
+	segmentZoneExt     = ".zone"
+	zoneBlockRecords   = 4096
+	zoneEntryFixedSize = 16 // First and last timestamps
+)
+
+// zone is the range of the timestamps and values of a block of records. Values are
+// kept as zoneKey orders them; a field without any value, such as a string or one
+// that is null throughout, has min > max.
+type zone struct {
+	rows        int64
+	first, last int64
+	min, max    []uint64
+}
+
+func newZone(fields int) *zone {
+	z := &zone{min: make([]uint64, fields), max: make([]uint64, fields)}
+	for i := range z.min {
+		z.min[i] = math.MaxUint64
+	}
+	return z
+}
+
+// zoneKey maps a value to a uint64 ordered like the value, reporting false for
+// values zones don't track: strings, bytes and NaNs
+func zoneKey(t FieldType, b []byte) (uint64, bool) {
+	switch {
+	case t == TypeF64 || t == TypeF32:
+		v := numericValue(t, b)
+		return floatKey(v), !math.IsNaN(v)
+	case t == TypeU64:
+		return binary.LittleEndian.Uint64(b), true
+	case t == TypeI64 || t.IsDecimal():
+		return signedKey(int64(binary.LittleEndian.Uint64(b))), true
+	case t == TypeI32:
+		return signedKey(int64(int32(binary.LittleEndian.Uint32(b)))), true
+	case t == TypeU32:
+		return signedKey(int64(binary.LittleEndian.Uint32(b))), true
+	case t == TypeI16:
+		return signedKey(int64(int16(binary.LittleEndian.Uint16(b)))), true
+	case t == TypeU8:
+		return signedKey(int64(b[0])), true
+	case t == TypeBool:
+		if b[0] != 0 {
+			return signedKey(1), true
+		}
+		return signedKey(0), true
+	}
+	return 0, false
+}
+
+func signedKey(v int64) uint64 {
+	return uint64(v) ^ 1<<63
+}
+
+func floatKey(v float64) uint64 {
+	if v == 0 {
+		v = 0 // -0 equals 0
+	}
+	bits := math.Float64bits(v)
+	if bits>>63 != 0 {
+		return ^bits
+	}
+	return bits | 1<<63
+}
+
+// filterKey returns the key of the value a matcher compares a field with, and
+// whether zones can rule it out
+func filterKey(m *matcher) (uint64, bool) {
+	if m.never || m.isNull {
+		return 0, false
+	}
+	switch m.narrow {
+	case TypeI32, TypeU32, TypeI16, TypeU8:
+		return signedKey(m.i64), true
+	case TypeF32:
+		v := float64(float32(m.f64))
+		return floatKey(v), !math.IsNaN(v)
+	}
+	switch m.typ {
+	case TypeF64:
+		return floatKey(m.f64), !math.IsNaN(m.f64)
+	case TypeBool:
+		if m.b {
+			return signedKey(1), true
+		}
+		return signedKey(0), true
+	case TypeU64:
+		return binary.LittleEndian.Uint64(m.raw), true
+	case TypeI64:
+		return signedKey(int64(binary.LittleEndian.Uint64(m.raw))), true
+	}
+	return 0, false
+}
+
+// zoneFilter is a filter zones can rule out
+type zoneFilter struct {
+	field int
+	key   uint64
+}
+
+// zoneFilters returns the filters zones can rule out
+func zoneFilters(filters []Filter, matchers []matcher) []zoneFilter {
+	var result []zoneFilter
+	for i := range matchers {
+		if key, ok := filterKey(&matchers[i]); ok {
+			result = append(result, zoneFilter{field: filters[i].FieldIndex, key: key})
+		}
+	}
+	return result
+}
+
+// excludes reports whether no record of the zone can be in [startTs, endTs) and
+// match the filters
+func (z *zone) excludes(startTs, endTs int64, filters []zoneFilter) bool {
+	if z.rows == 0 || z.last < startTs || z.first >= endTs {
+		return true
+	}
+	for _, f := range filters {
+		if f.key < z.min[f.field] || f.key > z.max[f.field] {
+			return true
+		}
+	}
+	return false
+}
+
+// add adds a record to the zone
+func (z *zone) add(schema []Field, ts int64, rec []byte) {
+	if z.rows == 0 {
+		z.first = ts
+	}
+	z.last = ts
+	z.rows++
+	offset := 0
+	for i, field := range schema {
+		size := field.Type.Size()
+		value := rec[offset : offset+size]
+		offset += size
+		if field.Nullable {
+			if nullOffset, mask := nullBit(schema, i); rec[nullOffset]&mask != 0 {
+				continue
+			}
+		}
+		if key, ok := zoneKey(field.Type, value); ok {
+			if key < z.min[i] {
+				z.min[i] = key
+			}
+			if key > z.max[i] {
+				z.max[i] = key
+			}
+		}
+	}
+}
+
+// appendZone appends the encoding of a zone to buf
+func appendZone(buf []byte, z *zone) []byte {
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(z.first))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(z.last))
+	for i := range z.min {
+		buf = binary.LittleEndian.AppendUint64(buf, z.min[i])
+		buf = binary.LittleEndian.AppendUint64(buf, z.max[i])
+	}
+	return buf
+}
+
+// decodeZone decodes a zone appendZone encoded, of the given number of records
+func decodeZone(data []byte, fields int, rows int64) *zone {
+	z := newZone(fields)
+	z.rows = rows
+	z.first = int64(binary.LittleEndian.Uint64(data))
+	z.last = int64(binary.LittleEndian.Uint64(data[8:]))
+	for i := range z.min {
+		z.min[i] = binary.LittleEndian.Uint64(data[zoneEntryFixedSize+16*i:])
+		z.max[i] = binary.LittleEndian.Uint64(data[zoneEntryFixedSize+16*i+8:])
+	}
+	return z
+}
+
+// zoneEntrySize returns the size of an encoded zone of schema
+func zoneEntrySize(schema []Field) int {
+	return zoneEntryFixedSize + 16*len(schema)
+}
+
+// zoneFile returns the path of the zone map of the data file
+func (db *DB) zoneFile() string {
+	return filepath.Join(db.dataDir(), db.ticker+zoneFileExt)
+}
+
+// segmentZoneFile returns the path of the zone of a segment
+func segmentZoneFile(s segment) string {
+	return s.file[:len(s.file)-len(segmentExt)] + segmentZoneExt
+}
+
+// openZones opens the zone map of the data file, creating it when create is set,
+// and brings it up to date. Like the column files, it is kept without ZoneMaps
+// while it exists.
+func (db *DB) openZones(create bool) error {
+	if !create {
+		if _, err := os.Stat(db.zoneFile()); err != nil {
+			return nil
+		}
+	}
+	f, err := os.OpenFile(db.zoneFile(), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		f.Close()
+		return err
+	}
+	db.zoneMap, db.zones = f, nil
+	entrySize := zoneEntrySize(db.schema)
+	for off := 0; off+entrySize <= len(data); off += entrySize {
+		db.zones = append(db.zones, decodeZone(data[off:], len(db.schema), zoneBlockRecords))
+	}
+	db.segZones = make(map[int]*zone)
+	for _, s := range db.segments {
+		if data, err := os.ReadFile(segmentZoneFile(s)); err == nil && len(data) == entrySize {
+			db.segZones[s.seq] = decodeZone(data, len(db.schema), s.count)
+		}
+	}
+	if err := db.updateZones(); err != nil {
+		db.closeZones()
+		return err
+	}
+	return nil
+}
+
+// closeZones closes the zone map
+func (db *DB) closeZones() {
+	if db.zoneMap != nil {
+		db.zoneMap.Close()
+	}
+	db.zoneMap, db.zones, db.segZones = nil, nil, nil
+}
+
+// removeZones deletes the zone map; db.mu must be held. The zones of the segments
+// go with them.
+func (db *DB) removeZones() {
+	if db.zoneMap == nil {
+		return
+	}
+	db.closeZones()
+	os.Remove(db.zoneFile())
+}
+
+// resetZones rebuilds the zone map of a data file whose schema changed; db.mu must
+// be held
+func (db *DB) resetZones() error {
+	if db.zoneMap == nil {
+		return nil
+	}
+	db.closeZones()
+	os.Remove(db.zoneFile())
+	return db.openZones(true)
+}
+
+// zoneRows returns the number of records the zones of the data file cover
+func (db *DB) zoneRows() int64 {
+	if len(db.zones) == 0 {
+		return 0
+	}
+	return int64(len(db.zones)-1)*zoneBlockRecords + db.zones[len(db.zones)-1].rows
+}
+
+// updateZones adds the records flushed to the data file since the last update to
+// the zones, the last of which may be incomplete and is only kept in memory. Like
+// the column files, they are cut back or rebuilt when the data file was truncated
+// or rewritten; db.mu must be held.
+func (db *DB) updateZones() error {
+	if db.zoneMap == nil || db.readOnly {
+		return nil
+	}
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	recordSize := int64(RecordSize(db.schema))
+	end, err := dataEnd(f, recordSize)
+	if err != nil {
+		return err
+	}
+	rows := (end - fileHeaderSize) / recordSize
+	if db.zoneRows() > rows {
+		// The incomplete block is rebuilt from the data file
+		db.zones = db.zones[:rows/zoneBlockRecords]
+	}
+	tsOffset, _ := timestampOffset(db.schema)
+	n := db.zoneRows()
+	same, err := sameTimestamps(f, recordSize, tsOffset, n, func(row int64) (int64, error) {
+		if row == 0 {
+			return db.zones[0].first, nil
+		}
+		return db.zones[len(db.zones)-1].last, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !same {
+		db.zones = nil
+	}
+	complete := len(db.zones)
+	if complete > 0 && db.zones[complete-1].rows < zoneBlockRecords {
+		complete--
+	}
+	entrySize := int64(zoneEntrySize(db.schema))
+	if err := db.zoneMap.Truncate(int64(complete) * entrySize); err != nil {
+		return err
+	}
+
+	var entries []byte
+	err = scanRecords(f, recordSize, tsOffset, fileHeaderSize+db.zoneRows()*recordSize, end, func(_, ts int64, rec []byte) bool {
+		if len(db.zones) == 0 || db.zones[len(db.zones)-1].rows == zoneBlockRecords {
+			db.zones = append(db.zones, newZone(len(db.schema)))
+		}
+		z := db.zones[len(db.zones)-1]
+		z.add(db.schema, ts, rec)
+		if z.rows == zoneBlockRecords {
+			entries = appendZone(entries, z)
+		}
+		return true
+	})
+	if err == nil {
+		_, err = db.zoneMap.WriteAt(entries, int64(complete)*entrySize)
+	}
+	if err != nil {
+		// Start over on the next update rather than trust zones the file lacks
+		db.zones = nil
+		return err
+	}
+	return nil
+}
+
+// segmentZone returns the zone of the records of a segment and saves it next to
+// the segment; db.mu must be held
+func (db *DB) segmentZone(s segment, records []byte) *zone {
+	recordSize := RecordSize(db.schema)
+	tsOffset, _ := timestampOffset(db.schema)
+	z := newZone(len(db.schema))
+	for off := 0; off+recordSize <= len(records); off += recordSize {
+		rec := records[off : off+recordSize]
+		z.add(db.schema, int64(binary.LittleEndian.Uint64(rec[tsOffset:])), rec)
+	}
+	db.segZones[s.seq] = z
+	// Computed again next time when it can't be saved
+	copyFileAtomic(segmentZoneFile(s), bytes.NewReader(appendZone(nil, z)), int64(zoneEntrySize(db.schema)))
+	return z
+}
+
+// zoneQuery runs a query over the blocks of the data file and the segments whose
+// zones don't rule it out, returning the result in C memory like the engine, the
+// number of records read, and the number of blocks read and skipped, or false
+// without zones; db.mu must be held
+func (db *DB) zoneQuery(startTs, endTs int64, filters []Filter, q *queryInfo) (unsafe.Pointer, int, bool, error) {
+	if db.zoneMap == nil {
+		return nil, 0, false, nil
+	}
+	matchers, err := db.matchers(filters)
+	if err != nil {
+		return nil, 0, true, err
+	}
+	// The zones cover flushed records only
+	if err := db.flush(); err != nil {
+		return nil, 0, true, err
+	}
+	keys := zoneFilters(filters, matchers)
+	recordSize := RecordSize(db.schema)
+	tsOffset, _ := timestampOffset(db.schema)
+
+	var result []byte
+	for _, s := range db.segments {
+		z := db.segZones[s.seq]
+		if (s.first >= endTs || s.last < startTs) || (z != nil && z.excludes(startTs, endTs, keys)) || db.bloomExcludes(s, filters, matchers) {
+			q.prune()
+			continue
+		}
+		data, err := db.readSegment(s)
+		if err != nil {
+			return nil, 0, true, err
+		}
+		if z == nil {
+			z = db.segmentZone(s, data[fileHeaderSize:])
+			if z.excludes(startTs, endTs, keys) {
+				q.prune()
+				continue
+			}
+		}
+		q.bytesRead += s.size
+		v := &fileView{f: bytes.NewReader(data), size: int64(recordSize), tsOffset: tsOffset, count: s.count, limit: q.limit}
+		records, n, err := v.query(startTs, endTs, matchers)
+		if err != nil {
+			return nil, 0, true, err
+		}
+		result = append(result, records...)
+		q.scanned += n
+		q.blocksScanned++
+	}
+
+	f, err := os.Open(db.dataFile())
+	if err != nil {
+		return nil, 0, true, err
+	}
+	defer f.Close()
+	var block []byte
+	for i, z := range db.zones {
+		if z.excludes(startTs, endTs, keys) {
+			q.blocksPruned++
+			continue
+		}
+		if size := int(z.rows) * recordSize; cap(block) < size {
+			block = make([]byte, size)
+		} else {
+			block = block[:size]
+		}
+		if _, err := f.ReadAt(block, fileHeaderSize+int64(i)*zoneBlockRecords*int64(recordSize)); err != nil {
+			return nil, 0, true, fmt.Errorf("failed to read data file: %w", err)
+		}
+		q.bytesRead += int64(len(block))
+		for off := 0; off < len(block); off += recordSize {
+			rec := block[off : off+recordSize]
+			ts := int64(binary.LittleEndian.Uint64(rec[tsOffset:]))
+			if ts < startTs || ts >= endTs {
+				continue
+			}
+			q.scanned++
+			if matchAll(matchers, rec) {
+				result = append(result, rec...)
+				q.limit.match()
+			}
+		}
+		q.blocksScanned++
+		if err := q.limit.check(int64(len(block))); err != nil {
+			return nil, 0, true, err
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, 0, true, nil
+	}
+	return cBytes(result), len(result), true, nil
+}
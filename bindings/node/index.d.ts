@@ -41,7 +41,7 @@ export interface DBConfig {
 
 export interface FieldDef {
     name: string;
-    type: 'i64' | 'f64' | 'u64';
+    type: 'i64' | 'f64' | 'u64' | 'bool' | 'i32' | 'u32' | 'f32' | 'i16' | 'u8';
 }
 
 export interface DBInstance {
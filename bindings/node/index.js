@@ -33,6 +33,10 @@ try {
 
 const addon = require(nodePath);
 
+// The native filters take 64-bit values; the engine matches them against the
+// narrow fields by value
+const filterTypes = { i32: 'i64', u32: 'i64', i16: 'i64', u8: 'i64', f32: 'f64' };
+
 module.exports = {
     dbInit: (ticker, dirPath, schema, config) => {
         if (!schema || !Array.isArray(schema)) {
@@ -52,6 +56,11 @@ module.exports = {
                 case 'f64': recordSize += 8; break;
                 case 'u64': recordSize += 8; break;
                 case 'bool': recordSize += 1; break;
+                case 'i32': recordSize += 4; break;
+                case 'u32': recordSize += 4; break;
+                case 'f32': recordSize += 4; break;
+                case 'i16': recordSize += 2; break;
+                case 'u8': recordSize += 1; break;
                 default: throw new Error(`Unsupported field type: ${field.type}`);
             }
         }
@@ -75,6 +84,11 @@ module.exports = {
                         case 'f64': buffer.writeDoubleLE(Number(value), info.offset); break;
                         case 'u64': buffer.writeBigUInt64LE(BigInt(value), info.offset); break;
                         case 'bool': buffer.writeUInt8(value ? 1 : 0, info.offset); break;
+                        case 'i32': buffer.writeInt32LE(Number(value), info.offset); break;
+                        case 'u32': buffer.writeUInt32LE(Number(value), info.offset); break;
+                        case 'f32': buffer.writeFloatLE(Number(value), info.offset); break;
+                        case 'i16': buffer.writeInt16LE(Number(value), info.offset); break;
+                        case 'u8': buffer.writeUInt8(Number(value), info.offset); break;
                     }
                 }
                 addon.dbAppend(db, buffer);
@@ -100,6 +114,11 @@ module.exports = {
                             case 'f64': record[name] = view.getFloat64(base + info.offset, true); break;
                             case 'u64': record[name] = view.getBigUint64(base + info.offset, true); break;
                             case 'bool': record[name] = view.getUint8(base + info.offset) !== 0; break;
+                            case 'i32': record[name] = view.getInt32(base + info.offset, true); break;
+                            case 'u32': record[name] = view.getUint32(base + info.offset, true); break;
+                            case 'f32': record[name] = view.getFloat32(base + info.offset, true); break;
+                            case 'i16': record[name] = view.getInt16(base + info.offset, true); break;
+                            case 'u8': record[name] = view.getUint8(base + info.offset); break;
                         }
                     }
                     result[i] = record;
@@ -117,12 +136,13 @@ module.exports = {
                         filterArray.push({
                             field_index: info.index,
                             value: value,
-                            type: info.type
+                            type: filterTypes[info.type] || info.type
                         });
                     }
                 } else if (Array.isArray(filters)) {
                     // Assume already in correct format, but ensure type is present
                     filterArray = filters.map(f => {
+                        if (filterTypes[f.type]) return { ...f, type: filterTypes[f.type] };
                         if (f.type) return f;
                         // If type missing, try to look up by index? Hard if we don't have reverse map.
                         // But if user passes field_index, they should pass type or we need reverse map.
@@ -146,6 +166,11 @@ module.exports = {
                             case 'f64': record[name] = view.getFloat64(base + info.offset, true); break;
                             case 'u64': record[name] = view.getBigUint64(base + info.offset, true); break;
                             case 'bool': record[name] = view.getUint8(base + info.offset) !== 0; break;
+                            case 'i32': record[name] = view.getInt32(base + info.offset, true); break;
+                            case 'u32': record[name] = view.getUint32(base + info.offset, true); break;
+                            case 'f32': record[name] = view.getFloat32(base + info.offset, true); break;
+                            case 'i16': record[name] = view.getInt16(base + info.offset, true); break;
+                            case 'u8': record[name] = view.getUint8(base + info.offset); break;
                         }
                     }
                     result[i] = record;
@@ -0,0 +1,52 @@
+const { dbInit } = require('../index.js');
+const fs = require('fs');
+const path = require('path');
+const assert = require('assert');
+
+const DATA_DIR = path.join(__dirname, '..', '..', '..', 'b_node_test_data_narrow');
+if (fs.existsSync(DATA_DIR)) fs.rmSync(DATA_DIR, { recursive: true });
+fs.mkdirSync(DATA_DIR, { recursive: true });
+
+const schema = [
+    { name: 'timestamp', type: 'i64' },
+    { name: 'qty', type: 'i32' },
+    { name: 'count', type: 'u32' },
+    { name: 'price', type: 'f32' },
+    { name: 'delta', type: 'i16' },
+    { name: 'flags', type: 'u8' }
+];
+
+console.log('Initializing DB...');
+const db = dbInit('NARROW_TEST', DATA_DIR, schema);
+
+console.log('Appending data...');
+db.append({ timestamp: 100n, qty: -70000, count: 4000000000, price: 1.5, delta: -300, flags: 255 });
+db.append({ timestamp: 200n, qty: 5, count: 7, price: 0.1, delta: 12, flags: 1 });
+db.append({ timestamp: 300n, qty: -70000, count: 0, price: -2.25, delta: -300, flags: 0 });
+
+console.log('Querying all...');
+const results = db.query(0n, 1000n);
+assert.strictEqual(results.length, 3);
+assert.deepStrictEqual(results[0], { timestamp: 100n, qty: -70000, count: 4000000000, price: 1.5, delta: -300, flags: 255 });
+// f32 values come back at single precision
+assert.strictEqual(results[1].price, Math.fround(0.1));
+assert.deepStrictEqual(db.load(), results);
+
+console.log('Filtering...');
+const byQty = db.query(0n, 1000n, { qty: -70000 });
+assert.deepStrictEqual(byQty.map(r => r.timestamp), [100n, 300n]);
+const byDelta = db.query(0n, 1000n, { delta: 12, flags: 1 });
+assert.deepStrictEqual(byDelta.map(r => r.timestamp), [200n]);
+const byPrice = db.query(0n, 1000n, [{ field_index: 3, type: 'f32', value: 0.1 }]);
+assert.deepStrictEqual(byPrice.map(r => r.timestamp), [200n]);
+
+console.log('Stats...');
+const stats = db.getStats(0n, 1000n, 'delta');
+assert.strictEqual(stats.min, -300);
+assert.strictEqual(stats.max, 12);
+assert.strictEqual(stats.count, 3n);
+assert.strictEqual(db.getLatest('count').value, 0);
+
+console.log('✅ Narrow types test passed!');
+db.close();
+fs.rmSync(DATA_DIR, { recursive: true });
@@ -207,6 +207,10 @@ pub fn build(b: *std.Build) void {
     lib_step.dependOn(&lib_install.step);
 
     // --- C/C++ Bindings ---
+    // hocdb_version reports the package version of build.zig.zon
+    const c_options = b.addOptions();
+    c_options.addOption([:0]const u8, "version", @import("build.zig.zon").version);
+
     // Create library for C bindings
     const c_lib = b.addLibrary(.{
         .linkage = .dynamic,
@@ -220,6 +224,7 @@ pub fn build(b: *std.Build) void {
 
     c_lib.linkLibC();
     c_lib.root_module.addImport("hocdb", mod);
+    c_lib.root_module.addOptions("build_options", c_options);
 
     const c_lib_install = b.addInstallArtifact(c_lib, .{});
 
@@ -247,4 +252,38 @@ pub fn build(b: *std.Build) void {
     const go_bindings_step = b.step("go-bindings", "Build Go bindings (requires C bindings)");
     go_bindings_step.dependOn(&c_lib_install.step); // Go bindings depend on C library
     go_bindings_step.dependOn(&install_headers_step.step); // Go bindings need headers for CGO
+
+    // Static archives of the C library that the Go bindings link with the
+    // hocdb_static build tag, written to bindings/go/lib/<GOOS>_<GOARCH>/
+    const go_static_step = b.step("go-static", "Build the static C libraries the Go bindings embed with -tags hocdb_static");
+    const go_static_update = b.addUpdateSourceFiles();
+    const go_static_targets = [_]struct { query: std.Target.Query, dir: []const u8 }{
+        .{ .query = .{ .cpu_arch = .x86_64, .os_tag = .linux, .abi = .gnu }, .dir = "linux_amd64" },
+        .{ .query = .{ .cpu_arch = .aarch64, .os_tag = .linux, .abi = .gnu }, .dir = "linux_arm64" },
+        .{ .query = .{ .cpu_arch = .x86_64, .os_tag = .macos }, .dir = "darwin_amd64" },
+        .{ .query = .{ .cpu_arch = .aarch64, .os_tag = .macos }, .dir = "darwin_arm64" },
+    };
+    for (go_static_targets) |t| {
+        const static_target = b.resolveTargetQuery(t.query);
+        const static_mod = b.createModule(.{
+            .root_source_file = b.path("src/root.zig"),
+            .target = static_target,
+        });
+        const static_lib = b.addLibrary(.{
+            .linkage = .static,
+            .name = "hocdb_c",
+            .root_module = b.createModule(.{
+                .root_source_file = b.path("src/c_bindings.zig"),
+                .target = static_target,
+                .optimize = .ReleaseFast,
+            }),
+        });
+        static_lib.linkLibC();
+        // The Go linker doesn't provide Zig's compiler runtime
+        static_lib.bundle_compiler_rt = true;
+        static_lib.root_module.addImport("hocdb", static_mod);
+        static_lib.root_module.addOptions("build_options", c_options);
+        go_static_update.addCopyFileToSource(static_lib.getEmittedBin(), b.fmt("bindings/go/lib/{s}/libhocdb_c.a", .{t.dir}));
+    }
+    go_static_step.dependOn(&go_static_update.step);
 }
@@ -169,7 +169,7 @@ fn dbInit(env: napi_env, info: napi_callback_info) callconv(.c) napi_value {
         defer std.heap.c_allocator.free(type_str);
         if (napi_get_value_string_utf8(env, type_val, type_str.ptr, type_str_len + 1, null) != .ok) return throwError(env, "Failed to get type");
 
-        const f_type: hocdb.FieldType = if (std.mem.eql(u8, type_str[0..type_str_len], "i64")) .i64 else if (std.mem.eql(u8, type_str[0..type_str_len], "f64")) .f64 else if (std.mem.eql(u8, type_str[0..type_str_len], "u64")) .u64 else if (std.mem.eql(u8, type_str[0..type_str_len], "bool")) .bool else return throwError(env, "Unsupported type");
+        const f_type: hocdb.FieldType = if (std.mem.eql(u8, type_str[0..type_str_len], "i64")) .i64 else if (std.mem.eql(u8, type_str[0..type_str_len], "f64")) .f64 else if (std.mem.eql(u8, type_str[0..type_str_len], "u64")) .u64 else if (std.mem.eql(u8, type_str[0..type_str_len], "bool")) .bool else if (std.mem.eql(u8, type_str[0..type_str_len], "i32")) .i32 else if (std.mem.eql(u8, type_str[0..type_str_len], "u32")) .u32 else if (std.mem.eql(u8, type_str[0..type_str_len], "f32")) .f32 else if (std.mem.eql(u8, type_str[0..type_str_len], "i16")) .i16 else if (std.mem.eql(u8, type_str[0..type_str_len], "u8")) .u8 else return throwError(env, "Unsupported type");
 
         fields[i] = .{ .name = name[0..name_len], .type = f_type };
     }
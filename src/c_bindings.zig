@@ -7,7 +7,7 @@ const DB = hocdb.DynamicTimeSeriesDB;
 
 pub const CField = extern struct {
     name: [*:0]const u8,
-    type: c_int, // 1=i64, 2=f64, 3=u64, 5=string, 6=bool
+    type: c_int, // 1=i64, 2=f64, 3=u64, 4=u8, 5=string, 6=bool, 7=i32, 8=u32, 9=f32, 10=i16, 11=bytes, 12=decimal; the bits above the low byte hold a width or scale, see hocdb.h
 };
 
 pub const CFilter = extern struct {
@@ -20,6 +20,24 @@ pub const CFilter = extern struct {
     val_bool: bool,
 };
 
+// The version of build.zig.zon, passed in by build.zig
+const version = @import("build_options").version;
+
+// HOCDB_FEATURE_* bits of hocdb.h
+const feature_auto_increment: u64 = 1 << 0;
+const feature_narrow_types: u64 = 1 << 1;
+const feature_string_width: u64 = 1 << 2;
+const feature_bytes: u64 = 1 << 3;
+const feature_decimal: u64 = 1 << 4;
+
+export fn hocdb_version() [*:0]const u8 {
+    return version.ptr;
+}
+
+export fn hocdb_features() u64 {
+    return feature_auto_increment | feature_narrow_types | feature_string_width | feature_bytes | feature_decimal;
+}
+
 export fn hocdb_init(ticker_z: [*:0]const u8, path_z: [*:0]const u8, schema_ptr: [*]const CField, schema_len: usize, max_size: i64, overwrite: c_int, flush: c_int, auto_increment: c_int) ?*anyopaque {
     const ticker = std.mem.span(ticker_z);
     const path = std.mem.span(path_z);
@@ -41,12 +59,34 @@ export fn hocdb_init(ticker_z: [*:0]const u8, path_z: [*:0]const u8, schema_ptr:
         };
         @memcpy(name, c_field.name[0..name_len]);
 
-        const f_type: hocdb.FieldType = switch (c_field.type) {
+        // String, bytes and decimal types carry their width or scale in the bits above
+        // the type; the default one is stored as 0, keeping the schema hash
+        const width = c_field.type >> 8;
+        const base = c_field.type & 0xff;
+        const has_width = switch (base) {
+            5 => width > 0 and width <= 128,
+            11 => width > 0 and width <= 65535,
+            12 => width > 0 and width <= 18,
+            else => false,
+        };
+        const default_width: c_int = switch (base) {
+            5 => 128,
+            11 => 256,
+            else => 0,
+        };
+        const f_type: hocdb.FieldType = switch (if (has_width) base else c_field.type) {
             1 => .i64,
             2 => .f64,
             3 => .u64,
+            4 => .u8,
             5 => .string,
             6 => .bool,
+            7 => .i32,
+            8 => .u32,
+            9 => .f32,
+            10 => .i16,
+            11 => .bytes,
+            12 => .decimal,
             else => {
                 std.heap.c_allocator.free(name); // Free current name
                 var j: usize = 0; // Free previous names
@@ -57,7 +97,7 @@ export fn hocdb_init(ticker_z: [*:0]const u8, path_z: [*:0]const u8, schema_ptr:
                 return null;
             },
         };
-        fields[i] = .{ .name = name, .type = f_type };
+        fields[i] = .{ .name = name, .type = f_type, .width = if (has_width and width != default_width) @intCast(width) else 0 };
     }
     // We leak names here because we don't have a clean way to free them in this function after init?
     // Actually init doesn't take ownership. So we should free them.
@@ -116,6 +156,12 @@ export fn hocdb_append(db_ptr: *anyopaque, data_ptr: [*]const u8, data_len: usiz
     return 0;
 }
 
+export fn hocdb_set_auto_increment(db_ptr: *anyopaque, start: i64, step: i64) c_int {
+    const db = @as(*DB, @ptrCast(@alignCast(db_ptr)));
+    db.setAutoIncrement(start, step) catch return -1;
+    return 0;
+}
+
 export fn hocdb_flush(db_ptr: *anyopaque) c_int {
     const db = @as(*DB, @ptrCast(@alignCast(db_ptr)));
     db.flush() catch return -1;
@@ -5,14 +5,50 @@ pub const FieldType = enum(u8) {
     f64 = 2,
     u64 = 3,
     u8 = 4,
-    string = 5, // Fixed 128-byte string
+    string = 5, // Fixed-width string, 128 bytes unless FieldInfo.width says otherwise
     bool = 6,
+    i32 = 7,
+    u32 = 8,
+    f32 = 9,
+    i16 = 10,
+    bytes = 11, // 2-byte length, then up to 256 bytes unless FieldInfo.width says otherwise
+    decimal = 12, // i64 scaled by 10^FieldInfo.width
 
     pub fn size(self: FieldType) usize {
         return switch (self) {
-            .i64, .f64, .u64 => 8,
+            .i64, .f64, .u64, .decimal => 8,
+            .i32, .u32, .f32 => 4,
+            .i16 => 2,
             .u8, .bool => 1,
             .string => 128,
+            .bytes => 2 + 256,
+        };
+    }
+
+    /// Reads a numeric field as f64, for stats. Strings have no numeric value.
+    pub fn toF64(self: FieldType, bytes: []const u8) ?f64 {
+        return switch (self) {
+            .f64 => std.mem.bytesToValue(f64, bytes[0..8]),
+            .i64, .decimal => @as(f64, @floatFromInt(std.mem.bytesToValue(i64, bytes[0..8]))),
+            .u64 => @as(f64, @floatFromInt(std.mem.bytesToValue(u64, bytes[0..8]))),
+            .f32 => @as(f64, @floatCast(std.mem.bytesToValue(f32, bytes[0..4]))),
+            .i32 => @as(f64, @floatFromInt(std.mem.bytesToValue(i32, bytes[0..4]))),
+            .u32 => @as(f64, @floatFromInt(std.mem.bytesToValue(u32, bytes[0..4]))),
+            .i16 => @as(f64, @floatFromInt(std.mem.bytesToValue(i16, bytes[0..2]))),
+            .u8 => @as(f64, @floatFromInt(std.mem.bytesToValue(u8, bytes[0..1]))),
+            .bool => if (std.mem.bytesToValue(bool, bytes[0..1])) 1.0 else 0.0,
+            .string, .bytes => null,
+        };
+    }
+
+    /// Reads a narrow integer field (i32, u32, i16, u8) widened to i64
+    pub fn narrowInt(self: FieldType, bytes: []const u8) ?i64 {
+        return switch (self) {
+            .i32 => std.mem.bytesToValue(i32, bytes[0..4]),
+            .u32 => std.mem.bytesToValue(u32, bytes[0..4]),
+            .i16 => std.mem.bytesToValue(i16, bytes[0..2]),
+            .u8 => std.mem.bytesToValue(u8, bytes[0..1]),
+            else => null,
         };
     }
 };
@@ -20,6 +56,23 @@ pub const FieldType = enum(u8) {
 pub const FieldInfo = struct {
     name: []const u8,
     type: FieldType,
+    width: u16 = 0, // Width of a string field (1 to 128), capacity of a bytes field or scale of a decimal; 0 for the default
+
+    pub fn size(self: FieldInfo) usize {
+        if (self.width == 0) return self.type.size();
+        return switch (self.type) {
+            .string => self.width,
+            .bytes => 2 + @as(usize, self.width),
+            else => self.type.size(),
+        };
+    }
+
+    /// Reads a numeric field as f64 like FieldType.toF64, with decimals scaled
+    pub fn toF64(self: FieldInfo, bytes: []const u8) ?f64 {
+        const val = self.type.toF64(bytes) orelse return null;
+        if (self.type != .decimal) return val;
+        return val / std.math.pow(f64, 10, @as(f64, @floatFromInt(self.width)));
+    }
 };
 
 pub const Stats = extern struct {
@@ -49,6 +102,8 @@ pub const Schema = struct {
         for (self.fields) |field| {
             hasher.update(field.name);
             hasher.update(@tagName(field.type));
+            // Fields of the default width keep the hash they had before widths existed
+            if (field.width != 0) hasher.update(std.mem.asBytes(&field.width));
         }
         return hasher.final();
     }
@@ -56,7 +111,7 @@ pub const Schema = struct {
     pub fn recordSize(self: Schema) usize {
         var s: usize = 0;
         for (self.fields) |field| {
-            s += field.type.size();
+            s += field.size();
         }
         return s;
     }
@@ -69,7 +124,7 @@ pub const Schema = struct {
                 // We only support i64 timestamp for now for simplicity in monotonicity check
                 return null;
             }
-            offset += field.type.size();
+            offset += field.size();
         }
         return null;
     }
@@ -83,6 +138,8 @@ pub const DynamicTimeSeriesDB = struct {
         overwrite_on_full: bool = true,
         flush_on_write: bool = false,
         auto_increment: bool = false,
+        auto_increment_start: i64 = 1, // First timestamp of an empty database
+        auto_increment_step: i64 = 1, // Distance between assigned timestamps, must be positive
         index_stride: u64 = 1024, // Number of records between index entries
     };
 
@@ -167,6 +224,7 @@ pub const DynamicTimeSeriesDB = struct {
     overwrite_on_full: bool,
     flush_on_write: bool,
     auto_increment: bool,
+    auto_increment_step: i64,
     write_cursor: u64,
     is_wrapped: bool = false,
 
@@ -383,7 +441,9 @@ pub const DynamicTimeSeriesDB = struct {
                     }
                 }
             }
-            if (last_timestamp == null) last_timestamp = 0;
+            // Resume after the last record, unless the sequence starts later
+            const before_start = config.auto_increment_start - config.auto_increment_step;
+            if (last_timestamp == null or last_timestamp.? < before_start) last_timestamp = before_start;
         }
 
         // Seek to write cursor
@@ -398,7 +458,7 @@ pub const DynamicTimeSeriesDB = struct {
                 for (0..i) |j| allocator.free(fields_copy[j].name);
                 allocator.free(fields_copy);
             }
-            fields_copy[i] = .{ .name = name_copy, .type = f.type };
+            fields_copy[i] = .{ .name = name_copy, .type = f.type, .width = f.width };
         }
 
         return Self{
@@ -409,6 +469,7 @@ pub const DynamicTimeSeriesDB = struct {
             .overwrite_on_full = config.overwrite_on_full,
             .flush_on_write = config.flush_on_write,
             .auto_increment = config.auto_increment,
+            .auto_increment_step = config.auto_increment_step,
             .write_cursor = write_cursor,
             .record_size = record_size,
             .timestamp_offset = ts_offset,
@@ -481,12 +542,26 @@ pub const DynamicTimeSeriesDB = struct {
         try self.buffered_writer.flush();
     }
 
+    /// Changes where auto-increment continues: after the last record, or at start
+    /// when that is later or the database is empty
+    pub fn setAutoIncrement(self: *Self, start: i64, step: i64) !void {
+        if (!self.auto_increment) return error.AutoIncrementDisabled;
+        if (step <= 0) return error.InvalidAutoIncrementStep;
+        self.auto_increment_step = step;
+        const before_start = start - step;
+        // Records still in the write buffer count too
+        const empty = self.write_cursor <= HEADER_SIZE and self.buffered_writer.index == 0 and !self.is_wrapped;
+        if (empty or (self.last_timestamp orelse before_start) < before_start) {
+            self.last_timestamp = before_start;
+        }
+    }
+
     pub fn append(self: *Self, data: []const u8) !void {
         if (data.len != self.record_size) return error.InvalidRecordSize;
 
         if (self.auto_increment) {
             // Increment timestamp
-            const new_ts = (self.last_timestamp orelse 0) + 1;
+            const new_ts = (self.last_timestamp orelse 0) + self.auto_increment_step;
             self.last_timestamp = new_ts;
 
             // Overwrite timestamp in data
@@ -772,24 +847,44 @@ pub const DynamicTimeSeriesDB = struct {
                     const val_ptr = record_buf[field_offset..];
 
                     switch (filter.value) {
+                        // Integer filters also match the narrow integer fields by value
                         .i64 => |v| {
-                            if (field_type != .i64) return error.TypeMismatch;
-                            const val = std.mem.bytesToValue(i64, val_ptr[0..8]);
-                            if (val != v) matches = false;
+                            if (field_type.narrowInt(val_ptr)) |val| {
+                                if (val != v) matches = false;
+                            } else {
+                                // Decimals are matched by their unscaled value
+                                if (field_type != .i64 and field_type != .decimal) return error.TypeMismatch;
+                                const val = std.mem.bytesToValue(i64, val_ptr[0..8]);
+                                if (val != v) matches = false;
+                            }
                         },
                         .f64 => |v| {
-                            if (field_type != .f64) return error.TypeMismatch;
-                            const val = std.mem.bytesToValue(f64, val_ptr[0..8]);
-                            if (val != v) matches = false;
+                            if (field_type == .f32) {
+                                const val = std.mem.bytesToValue(f32, val_ptr[0..4]);
+                                if (val != @as(f32, @floatCast(v))) matches = false;
+                            } else {
+                                if (field_type != .f64) return error.TypeMismatch;
+                                const val = std.mem.bytesToValue(f64, val_ptr[0..8]);
+                                if (val != v) matches = false;
+                            }
                         },
                         .u64 => |v| {
-                            if (field_type != .u64) return error.TypeMismatch;
-                            const val = std.mem.bytesToValue(u64, val_ptr[0..8]);
-                            if (val != v) matches = false;
+                            if (field_type.narrowInt(val_ptr)) |val| {
+                                if (val < 0 or @as(u64, @intCast(val)) != v) matches = false;
+                            } else {
+                                if (field_type != .u64) return error.TypeMismatch;
+                                const val = std.mem.bytesToValue(u64, val_ptr[0..8]);
+                                if (val != v) matches = false;
+                            }
                         },
                         .string => |v| {
                             if (field_type != .string) return error.TypeMismatch;
-                            if (!std.mem.eql(u8, val_ptr[0..128], &v)) matches = false;
+                            // A string longer than the field can't be in it
+                            const width = self.fields[filter.field_index].size();
+                            if (!std.mem.eql(u8, val_ptr[0..width], v[0..width])) matches = false;
+                            for (v[width..]) |c| {
+                                if (c != 0) matches = false;
+                            }
                         },
                         .bool => |v| {
                             if (field_type != .bool) return error.TypeMismatch;
@@ -814,7 +909,7 @@ pub const DynamicTimeSeriesDB = struct {
         if (field_index >= self.fields.len) return error.InvalidFieldIndex;
         var offset: usize = 0;
         for (0..field_index) |i| {
-            offset += self.fields[i].type.size();
+            offset += self.fields[i].size();
         }
         return offset;
     }
@@ -844,16 +939,10 @@ pub const DynamicTimeSeriesDB = struct {
         const ts = std.mem.bytesToValue(i64, record_buf[self.timestamp_offset .. self.timestamp_offset + 8]);
 
         const field_offset = try self.getFieldOffset(field_index);
-        const field_type = self.fields[field_index].type;
-
-        const val: f64 = switch (field_type) {
-            .f64 => std.mem.bytesToValue(f64, record_buf[field_offset .. field_offset + 8]),
-            .i64 => @floatFromInt(std.mem.bytesToValue(i64, record_buf[field_offset .. field_offset + 8])),
-            .u64 => @floatFromInt(std.mem.bytesToValue(u64, record_buf[field_offset .. field_offset + 8])),
-            .u8 => @floatFromInt(std.mem.bytesToValue(u8, record_buf[field_offset .. field_offset + 1])),
-            .bool => if (std.mem.bytesToValue(bool, record_buf[field_offset .. field_offset + 1])) 1.0 else 0.0,
-            .string => return error.InvalidFieldTypeForStats, // Strings don't contribute to stats
-        };
+        const field = self.fields[field_index];
+
+        // Strings don't contribute to stats
+        const val = field.toF64(record_buf[field_offset .. field_offset + field.size()]) orelse return error.InvalidFieldTypeForStats;
 
         return .{ .value = val, .timestamp = ts };
     }
@@ -870,7 +959,7 @@ pub const DynamicTimeSeriesDB = struct {
         }
 
         const field_offset = try self.getFieldOffset(field_index);
-        const field_type = self.fields[field_index].type;
+        const field = self.fields[field_index];
 
         var min: f64 = std.math.floatMax(f64);
         var max: f64 = -std.math.floatMax(f64);
@@ -907,16 +996,9 @@ pub const DynamicTimeSeriesDB = struct {
             var i: usize = 0;
             while (i < chunk_count) : (i += 1) {
                 const rec_start = i * self.record_size;
-                const val_bytes = alloc_buf[rec_start + field_offset .. rec_start + field_offset + field_type.size()];
-
-                const val: f64 = switch (field_type) {
-                    .f64 => std.mem.bytesToValue(f64, val_bytes[0..8]),
-                    .i64 => @floatFromInt(std.mem.bytesToValue(i64, val_bytes[0..8])),
-                    .u64 => @floatFromInt(std.mem.bytesToValue(u64, val_bytes[0..8])),
-                    .u8 => @floatFromInt(std.mem.bytesToValue(u8, val_bytes[0..1])),
-                    .bool => if (std.mem.bytesToValue(bool, val_bytes[0..1])) 1.0 else 0.0,
-                    .string => 0.0, // Strings don't contribute to stats
-                };
+                const val_bytes = alloc_buf[rec_start + field_offset .. rec_start + field_offset + field.size()];
+
+                const val = field.toF64(val_bytes) orelse 0.0; // Strings don't contribute to stats
 
                 if (val < min) min = val;
                 if (val > max) max = val;
@@ -962,6 +1044,10 @@ pub fn TimeSeriesDB(comptime T: type) type {
                     i64 => FieldType.i64,
                     f64 => FieldType.f64,
                     u64 => FieldType.u64,
+                    i32 => FieldType.i32,
+                    u32 => FieldType.u32,
+                    f32 => FieldType.f32,
+                    i16 => FieldType.i16,
                     u8 => FieldType.u8,
                     bool => FieldType.bool,
                     else => @compileError("Unsupported field type"),
@@ -95,3 +95,122 @@ test "AutoIncrement: Missing Timestamp Field" {
         try std.testing.expectEqual(error.MissingTimestampField, err);
     }
 }
+
+test "Auto-Increment: Start and Step" {
+    const TestStruct = struct {
+        timestamp: i64,
+        value: f64,
+    };
+
+    const ticker = "TEST_AUTO_INC_START";
+    var dir_buf: [64]u8 = undefined;
+    const dir = try std.fmt.bufPrint(&dir_buf, "test_auto_inc_start_{x}", .{std.crypto.random.int(u64)});
+
+    // Cleanup
+    std.fs.cwd().deleteTree(dir) catch |err| if (err != error.FileNotFound) return err;
+    defer std.fs.cwd().deleteTree(dir) catch {};
+
+    const DB = TimeSeriesDB(TestStruct);
+
+    // 1. Empty database starts at the configured value
+    {
+        var db = try DB.init(ticker, dir, std.testing.allocator, .{ .auto_increment = true, .auto_increment_start = 1000, .auto_increment_step = 10 });
+        defer db.deinit();
+
+        try db.append(.{ .timestamp = 0, .value = 1.0 });
+        try db.append(.{ .timestamp = 0, .value = 2.0 });
+        try db.append(.{ .timestamp = 0, .value = 3.0 });
+    }
+
+    // 2. Reopen resumes after the last record, not at the start again
+    {
+        var db = try DB.init(ticker, dir, std.testing.allocator, .{ .auto_increment = true, .auto_increment_start = 1000, .auto_increment_step = 10 });
+        defer db.deinit();
+
+        try db.append(.{ .timestamp = 0, .value = 4.0 });
+    }
+
+    // 3. A start beyond the last record jumps ahead; an earlier one is ignored
+    {
+        var db = try DB.init(ticker, dir, std.testing.allocator, .{ .auto_increment = true, .auto_increment_start = 5000 });
+        defer db.deinit();
+        try db.append(.{ .timestamp = 0, .value = 5.0 });
+    }
+    {
+        var db = try DB.init(ticker, dir, std.testing.allocator, .{ .auto_increment = true, .auto_increment_start = 1 });
+        defer db.deinit();
+        try db.append(.{ .timestamp = 0, .value = 6.0 });
+
+        const data = try db.load(std.testing.allocator);
+        defer std.testing.allocator.free(data);
+
+        const expected = [_]i64{ 1000, 1010, 1020, 1030, 5000, 5001 };
+        try std.testing.expectEqual(expected.len, data.len);
+        for (data, expected, 0..) |rec, ts, idx| {
+            try std.testing.expectEqual(ts, rec.timestamp);
+            try std.testing.expectEqual(@as(f64, @floatFromInt(idx + 1)), rec.value);
+        }
+    }
+}
+
+test "Auto-Increment: setAutoIncrement" {
+    const TestStruct = struct {
+        timestamp: i64,
+        value: f64,
+    };
+
+    const ticker = "TEST_AUTO_INC_SET";
+    var dir_buf: [64]u8 = undefined;
+    const dir = try std.fmt.bufPrint(&dir_buf, "test_auto_inc_set_{x}", .{std.crypto.random.int(u64)});
+
+    // Cleanup
+    std.fs.cwd().deleteTree(dir) catch |err| if (err != error.FileNotFound) return err;
+    defer std.fs.cwd().deleteTree(dir) catch {};
+
+    const DB = TimeSeriesDB(TestStruct);
+
+    // 1. Explicit starting value on an empty database
+    {
+        var db = try DB.init(ticker, dir, std.testing.allocator, .{ .auto_increment = true });
+        defer db.deinit();
+
+        try std.testing.expectError(error.InvalidAutoIncrementStep, db.dynamic_db.setAutoIncrement(500, 0));
+        try db.dynamic_db.setAutoIncrement(500, 5);
+        try db.append(.{ .timestamp = 0, .value = 1.0 });
+        try db.append(.{ .timestamp = 0, .value = 2.0 });
+
+        // Records still buffered keep the database from counting as empty
+        try db.dynamic_db.setAutoIncrement(1, 2);
+        try db.append(.{ .timestamp = 0, .value = 3.0 });
+    }
+
+    // 2. Reopen resumes after the last record, then moves ahead on request
+    {
+        var db = try DB.init(ticker, dir, std.testing.allocator, .{ .auto_increment = true });
+        defer db.deinit();
+
+        try db.dynamic_db.setAutoIncrement(1, 1);
+        try db.append(.{ .timestamp = 0, .value = 4.0 });
+        try db.dynamic_db.setAutoIncrement(10_000, 100);
+        try db.append(.{ .timestamp = 0, .value = 5.0 });
+        try db.append(.{ .timestamp = 0, .value = 6.0 });
+
+        const data = try db.load(std.testing.allocator);
+        defer std.testing.allocator.free(data);
+
+        const expected = [_]i64{ 500, 505, 507, 508, 10_000, 10_100 };
+        try std.testing.expectEqual(expected.len, data.len);
+        for (data, expected, 0..) |rec, ts, idx| {
+            try std.testing.expectEqual(ts, rec.timestamp);
+            try std.testing.expectEqual(@as(f64, @floatFromInt(idx + 1)), rec.value);
+        }
+    }
+
+    // 3. Only databases opened with auto-increment accept it
+    {
+        var db = try DB.init(ticker, dir, std.testing.allocator, .{});
+        defer db.deinit();
+
+        try std.testing.expectError(error.AutoIncrementDisabled, db.dynamic_db.setAutoIncrement(1, 1));
+    }
+}
@@ -1,6 +1,7 @@
 const std = @import("std");
 const root = @import("root.zig");
 const TimeSeriesDB = root.TimeSeriesDB;
+const Filter = root.Filter;
 
 test "TimeSeriesDB query usage" {
     // return; // DISABLED due to flakiness/crash
@@ -136,3 +137,159 @@ test "TimeSeriesDB multiple wrap" {
         try std.testing.expectEqual(1000, res3[1].timestamp);
     }
 }
+
+test "DynamicTimeSeriesDB narrow type filters" {
+    // Laid out without padding so the record matches the schema size
+    const NarrowStruct = extern struct {
+        timestamp: i64,
+        a_i32: i32,
+        a_u32: u32,
+        a_f32: f32,
+        a_i16: i16,
+        a_u8: u8,
+        flag: u8,
+    };
+    const ticker = "TEST_QUERY_NARROW";
+    var dir_buf: [64]u8 = undefined;
+    const dir = try std.fmt.bufPrint(&dir_buf, "test_query_narrow_{x}", .{std.crypto.random.int(u64)});
+    const DB = TimeSeriesDB(NarrowStruct);
+
+    // Cleanup
+    std.fs.cwd().deleteTree(dir) catch |err| if (err != error.FileNotFound) return err;
+    defer std.fs.cwd().deleteTree(dir) catch {};
+
+    var db = try DB.init(ticker, dir, std.testing.allocator, .{});
+    defer db.deinit();
+
+    try db.append(.{ .timestamp = 100, .a_i32 = 1_000_000_000, .a_u32 = 1, .a_f32 = 0.1, .a_i16 = 100, .a_u8 = 0, .flag = 0 });
+    try db.append(.{ .timestamp = 200, .a_i32 = 500, .a_u32 = 4_000_000_000, .a_f32 = 0.2, .a_i16 = 200, .a_u8 = 255, .flag = 0 });
+    try db.append(.{ .timestamp = 300, .a_i32 = -2_000_000_000, .a_u32 = 2, .a_f32 = 0.3, .a_i16 = -300, .a_u8 = 7, .flag = 0 });
+
+    const Case = struct {
+        filter: Filter,
+        expected: []const i64, // Timestamps of the matching records
+    };
+    const cases = [_]Case{
+        // Integer filters match narrow fields by value, negatives included
+        .{ .filter = .{ .field_index = 1, .value = .{ .i64 = -2_000_000_000 } }, .expected = &.{300} },
+        .{ .filter = .{ .field_index = 1, .value = .{ .i64 = 500 } }, .expected = &.{200} },
+        .{ .filter = .{ .field_index = 2, .value = .{ .u64 = 4_000_000_000 } }, .expected = &.{200} },
+        .{ .filter = .{ .field_index = 2, .value = .{ .i64 = 2 } }, .expected = &.{300} },
+        .{ .filter = .{ .field_index = 4, .value = .{ .i64 = -300 } }, .expected = &.{300} },
+        .{ .filter = .{ .field_index = 5, .value = .{ .i64 = 255 } }, .expected = &.{200} },
+        .{ .filter = .{ .field_index = 5, .value = .{ .u64 = 7 } }, .expected = &.{300} },
+        // Out of range values match nothing rather than wrapping
+        .{ .filter = .{ .field_index = 4, .value = .{ .i64 = 65236 } }, .expected = &.{} },
+        .{ .filter = .{ .field_index = 4, .value = .{ .u64 = std.math.maxInt(u64) - 299 } }, .expected = &.{} },
+        .{ .filter = .{ .field_index = 5, .value = .{ .i64 = -1 } }, .expected = &.{} },
+        // f64 filters match f32 fields at f32 precision
+        .{ .filter = .{ .field_index = 3, .value = .{ .f64 = 0.1 } }, .expected = &.{100} },
+        .{ .filter = .{ .field_index = 3, .value = .{ .f64 = @as(f32, 0.3) } }, .expected = &.{300} },
+        .{ .filter = .{ .field_index = 3, .value = .{ .f64 = 0.25 } }, .expected = &.{} },
+    };
+
+    for (cases) |case| {
+        const raw = try db.dynamic_db.query(0, 1000, &[_]Filter{case.filter}, std.testing.allocator);
+        defer std.testing.allocator.free(raw);
+
+        const record_size = db.dynamic_db.record_size;
+        try std.testing.expectEqual(case.expected.len * record_size, raw.len);
+        for (case.expected, 0..) |ts, i| {
+            const rec = std.mem.bytesToValue(NarrowStruct, raw[i * record_size .. (i + 1) * record_size]);
+            try std.testing.expectEqual(ts, rec.timestamp);
+        }
+    }
+
+    // Combined filters on several narrow fields
+    {
+        const filters = [_]Filter{
+            .{ .field_index = 1, .value = .{ .i64 = -2_000_000_000 } },
+            .{ .field_index = 4, .value = .{ .i64 = -300 } },
+            .{ .field_index = 3, .value = .{ .f64 = 0.3 } },
+        };
+        const raw = try db.dynamic_db.query(0, 1000, &filters, std.testing.allocator);
+        defer std.testing.allocator.free(raw);
+        try std.testing.expectEqual(db.dynamic_db.record_size, raw.len);
+    }
+
+    // Float filters don't apply to integer fields
+    try std.testing.expectError(error.TypeMismatch, db.dynamic_db.query(0, 1000, &[_]Filter{.{ .field_index = 1, .value = .{ .f64 = 500 } }}, std.testing.allocator));
+}
+
+test "DynamicTimeSeriesDB bytes fields" {
+    const ticker = "TEST_QUERY_BYTES";
+    var dir_buf: [64]u8 = undefined;
+    const dir = try std.fmt.bufPrint(&dir_buf, "test_query_bytes_{x}", .{std.crypto.random.int(u64)});
+
+    // Cleanup
+    std.fs.cwd().deleteTree(dir) catch |err| if (err != error.FileNotFound) return err;
+    defer std.fs.cwd().deleteTree(dir) catch {};
+
+    const fields = [_]root.FieldInfo{
+        .{ .name = "timestamp", .type = .i64 },
+        .{ .name = "payload", .type = .bytes, .width = 10 },
+    };
+    const schema = root.Schema{ .fields = &fields };
+
+    // 2-byte length prefix plus the capacity; 256 bytes by default
+    try std.testing.expectEqual(@as(usize, 8 + 2 + 10), schema.recordSize());
+    const default_fields = [_]root.FieldInfo{
+        .{ .name = "timestamp", .type = .i64 },
+        .{ .name = "payload", .type = .bytes },
+    };
+    try std.testing.expectEqual(@as(usize, 8 + 2 + 256), (root.Schema{ .fields = &default_fields }).recordSize());
+
+    const payloads = [_][]const u8{ "", "\x00\xff\x00", "0123456789" };
+    {
+        var db = try root.DynamicTimeSeriesDB.init(ticker, dir, std.testing.allocator, schema, .{});
+        defer db.deinit();
+        try db.initWriter();
+
+        for (payloads, 0..) |payload, i| {
+            var rec = [_]u8{0} ** 20;
+            std.mem.writeInt(i64, rec[0..8], @as(i64, @intCast(i + 1)) * 100, .little);
+            std.mem.writeInt(u16, rec[8..10], @intCast(payload.len), .little);
+            @memcpy(rec[10 .. 10 + payload.len], payload);
+            try db.append(&rec);
+        }
+
+        // Bytes have no numeric value and can't be filtered on
+        try std.testing.expectError(error.InvalidFieldTypeForStats, db.getLatest(1));
+        var needle = [_]u8{0} ** 128;
+        @memcpy(needle[0..3], "abc");
+        try std.testing.expectError(error.TypeMismatch, db.query(0, 1000, &[_]Filter{.{ .field_index = 1, .value = .{ .string = needle } }}, std.testing.allocator));
+    }
+
+    // Reopen and read the payloads back, embedded zeros included
+    {
+        var db = try root.DynamicTimeSeriesDB.init(ticker, dir, std.testing.allocator, schema, .{});
+        defer db.deinit();
+        try db.initWriter();
+
+        const raw = try db.load(std.testing.allocator);
+        defer std.testing.allocator.free(raw);
+
+        try std.testing.expectEqual(payloads.len * 20, raw.len);
+        for (payloads, 0..) |payload, i| {
+            const rec = raw[i * 20 .. (i + 1) * 20];
+            try std.testing.expectEqual(@as(i64, @intCast(i + 1)) * 100, std.mem.readInt(i64, rec[0..8], .little));
+            const len = std.mem.readInt(u16, rec[8..10], .little);
+            try std.testing.expectEqualSlices(u8, payload, rec[10 .. 10 + len]);
+        }
+    }
+
+    // The capacity is part of the schema
+    {
+        const wider = [_]root.FieldInfo{
+            .{ .name = "timestamp", .type = .i64 },
+            .{ .name = "payload", .type = .bytes, .width = 20 },
+        };
+        if (root.DynamicTimeSeriesDB.init(ticker, dir, std.testing.allocator, .{ .fields = &wider }, .{})) |db_val| {
+            var db = db_val;
+            db.deinit();
+            return error.TestExpectedError;
+        } else |err| {
+            try std.testing.expectEqual(error.SchemaMismatch, err);
+        }
+    }
+}
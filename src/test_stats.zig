@@ -150,3 +150,156 @@ test "Aggregation API (Wrapped Buffer)" {
         try std.testing.expectEqual(50.0, stats.mean);
     }
 }
+
+// Laid out without padding so the record matches the schema size
+const NarrowRecord = extern struct {
+    timestamp: i64,
+    a_i32: i32,
+    a_u32: u32,
+    a_f32: f32,
+    a_i16: i16,
+    a_u8: u8,
+    flag: u8,
+};
+
+test "Aggregation API (Narrow Types)" {
+    const ticker = "TEST_STATS_NARROW";
+    var dir_buf: [64]u8 = undefined;
+    const dir = try std.fmt.bufPrint(&dir_buf, "test_stats_narrow_{x}", .{std.crypto.random.int(u64)});
+
+    std.fs.cwd().deleteTree(dir) catch |err| if (err != error.FileNotFound) return err;
+    defer std.fs.cwd().deleteTree(dir) catch {};
+
+    const DB = TimeSeriesDB(NarrowRecord);
+    var db = try DB.init(ticker, dir, std.testing.allocator, .{});
+    defer db.deinit();
+
+    try std.testing.expectEqual(@as(usize, @sizeOf(NarrowRecord)), db.dynamic_db.record_size);
+
+    try db.append(.{ .timestamp = 100, .a_i32 = 1_000_000_000, .a_u32 = 1, .a_f32 = 0.1, .a_i16 = 100, .a_u8 = 0, .flag = 0 });
+    try db.append(.{ .timestamp = 200, .a_i32 = 500, .a_u32 = 4_000_000_000, .a_f32 = 0.2, .a_i16 = 200, .a_u8 = 255, .flag = 0 });
+    try db.append(.{ .timestamp = 300, .a_i32 = -2_000_000_000, .a_u32 = 2, .a_f32 = 0.3, .a_i16 = -300, .a_u8 = 7, .flag = 0 });
+
+    // i32, negatives included
+    {
+        const stats = try db.dynamic_db.getStats(0, 1000, 1);
+        try std.testing.expectEqual(@as(u64, 3), stats.count);
+        try std.testing.expectEqual(@as(f64, -2_000_000_000), stats.min);
+        try std.testing.expectEqual(@as(f64, 1_000_000_000), stats.max);
+        try std.testing.expectEqual(@as(f64, -999_999_500), stats.sum);
+
+        const latest = try db.dynamic_db.getLatest(1);
+        try std.testing.expectEqual(@as(f64, -2_000_000_000), latest.value);
+        try std.testing.expectEqual(@as(i64, 300), latest.timestamp);
+    }
+
+    // u32 above the i32 range
+    {
+        const stats = try db.dynamic_db.getStats(0, 1000, 2);
+        try std.testing.expectEqual(@as(f64, 1), stats.min);
+        try std.testing.expectEqual(@as(f64, 4_000_000_000), stats.max);
+        try std.testing.expectEqual(@as(f64, 4_000_000_003), stats.sum);
+    }
+
+    // f32 values are widened, not rounded to the nearest f64
+    {
+        const f1: f64 = @as(f32, 0.1);
+        const f2: f64 = @as(f32, 0.2);
+        const f3: f64 = @as(f32, 0.3);
+
+        const stats = try db.dynamic_db.getStats(0, 1000, 3);
+        try std.testing.expectEqual(f1, stats.min);
+        try std.testing.expectEqual(f3, stats.max);
+        try std.testing.expectEqual(f1 + f2 + f3, stats.sum);
+        try std.testing.expect(stats.min != 0.1);
+
+        const latest = try db.dynamic_db.getLatest(3);
+        try std.testing.expectEqual(f3, latest.value);
+    }
+
+    // i16, negatives included
+    {
+        const stats = try db.dynamic_db.getStats(0, 1000, 4);
+        try std.testing.expectEqual(@as(f64, -300), stats.min);
+        try std.testing.expectEqual(@as(f64, 200), stats.max);
+        try std.testing.expectEqual(@as(f64, 0), stats.sum);
+        try std.testing.expectEqual(@as(f64, 0), stats.mean);
+
+        const latest = try db.dynamic_db.getLatest(4);
+        try std.testing.expectEqual(@as(f64, -300), latest.value);
+    }
+
+    // u8
+    {
+        const stats = try db.dynamic_db.getStats(0, 1000, 5);
+        try std.testing.expectEqual(@as(f64, 0), stats.min);
+        try std.testing.expectEqual(@as(f64, 255), stats.max);
+        try std.testing.expectEqual(@as(f64, 262), stats.sum);
+
+        // 200 and 300 only
+        const partial = try db.dynamic_db.getStats(150, 1000, 5);
+        try std.testing.expectEqual(@as(u64, 2), partial.count);
+        try std.testing.expectEqual(@as(f64, 7), partial.min);
+    }
+}
+
+const TestDecimalRecord = extern struct {
+    timestamp: i64,
+    cents: i64,
+};
+
+test "Aggregation API (Decimal)" {
+    const ticker = "TEST_STATS_DECIMAL";
+    var dir_buf: [64]u8 = undefined;
+    const dir = try std.fmt.bufPrint(&dir_buf, "test_stats_decimal_{x}", .{std.crypto.random.int(u64)});
+
+    std.fs.cwd().deleteTree(dir) catch |err| if (err != error.FileNotFound) return err;
+    defer std.fs.cwd().deleteTree(dir) catch {};
+
+    // Prices with 2 decimal places, stored as cents
+    const fields = [_]hocdb.FieldInfo{
+        .{ .name = "timestamp", .type = .i64 },
+        .{ .name = "price", .type = .decimal, .width = 2 },
+    };
+    var db = try DynamicTimeSeriesDB.init(ticker, dir, std.testing.allocator, .{ .fields = &fields }, .{});
+    defer db.deinit();
+    try db.initWriter();
+
+    const cents = [_]i64{ 1050, -250, 12345 };
+    for (cents, 0..) |c, i| {
+        const rec = TestDecimalRecord{ .timestamp = @as(i64, @intCast(i + 1)) * 100, .cents = c };
+        try db.append(std.mem.asBytes(&rec));
+    }
+
+    // Stats are reported in units, not cents
+    {
+        const stats = try db.getStats(0, 1000, 1);
+        try std.testing.expectEqual(@as(u64, 3), stats.count);
+        try std.testing.expectEqual(@as(f64, -2.5), stats.min);
+        try std.testing.expectEqual(@as(f64, 123.45), stats.max);
+        try std.testing.expectApproxEqAbs(@as(f64, 131.45), stats.sum, 1e-9);
+
+        const latest = try db.getLatest(1);
+        try std.testing.expectEqual(@as(f64, 123.45), latest.value);
+        try std.testing.expectEqual(@as(i64, 300), latest.timestamp);
+    }
+
+    // Filters match the unscaled value
+    {
+        const raw = try db.query(0, 1000, &[_]hocdb.Filter{.{ .field_index = 1, .value = .{ .i64 = -250 } }}, std.testing.allocator);
+        defer std.testing.allocator.free(raw);
+        try std.testing.expectEqual(@as(usize, @sizeOf(TestDecimalRecord)), raw.len);
+        try std.testing.expectEqual(@as(i64, 200), std.mem.bytesToValue(TestDecimalRecord, raw).timestamp);
+    }
+
+    // The scale is part of the schema, the default scale 0 keeps the i64-sized record
+    {
+        const scaled = hocdb.Schema{ .fields = &fields };
+        const unscaled = hocdb.Schema{ .fields = &[_]hocdb.FieldInfo{
+            .{ .name = "timestamp", .type = .i64 },
+            .{ .name = "price", .type = .decimal },
+        } };
+        try std.testing.expectEqual(@as(usize, 16), scaled.recordSize());
+        try std.testing.expect(scaled.computeHash() != unscaled.computeHash());
+    }
+}
@@ -31,6 +31,8 @@ echo "[4/8] Running Go Tests..."
 export DYLD_LIBRARY_PATH=$(pwd)/zig-out/lib:$DYLD_LIBRARY_PATH
 export LD_LIBRARY_PATH=$(pwd)/zig-out/lib:$LD_LIBRARY_PATH
 (cd bindings/go && go test -v ./test/...)
+(cd bindings/go && go test -race -run Concurrent ./test/...)
+(cd bindings/go && go test -tags hocdb_purego -run OldLibrary .)
 echo "✅ Go Tests passed"
 
 # 5. Run C++ ABI Tests (testing C header from C++)
@@ -74,6 +76,7 @@ echo "[8/8] Running Node.js Tests..."
 zig build bindings
 node bindings/node/test/test.js
 node bindings/node/test/test_async_drop.js
+node bindings/node/test/test_narrow.js
 echo "✅ Node.js Tests passed"
 
 echo ""